@@ -0,0 +1,324 @@
+package gofat
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aligator/gofat/checkpoint"
+	"github.com/spf13/afero"
+	"gopkg.in/yaml.v3"
+)
+
+// ErrApply may occur while applying a Spec.
+var ErrApply = errors.New("could not apply the spec")
+
+// specAttributes contains the attributes which can be used in a SpecEntry by name.
+var specAttributes = map[string]byte{
+	"readonly": AttrReadOnly,
+	"hidden":   AttrHidden,
+	"system":   AttrSystem,
+	"archive":  AttrArchive,
+}
+
+// Spec describes the content of a filesystem declaratively, so that assembling an image is a reviewable
+// configuration instead of a script. See Fs.Apply.
+type Spec struct {
+	// Label is the volume label. If it is empty, the label is not changed.
+	Label string `json:"label,omitempty" yaml:"label,omitempty"`
+
+	// Entries are the directories and files to create. They are created in the given order.
+	Entries []SpecEntry `json:"entries" yaml:"entries"`
+
+	// RootOverflow is the directory in the root, e.g. "more", into which new root entries are put if they do not
+	// fit into the root directory of a FAT16 filesystem. If it is empty, Apply fails before changing anything.
+	RootOverflow string `json:"rootOverflow,omitempty" yaml:"rootOverflow,omitempty"`
+}
+
+// SpecEntry is a directory or file of a Spec.
+type SpecEntry struct {
+	// Path of the entry, e.g. "boot/config.txt". Missing parent directories are created.
+	// The root directory "." can only be used as directory with a Source.
+	Path string `json:"path" yaml:"path"`
+
+	// Dir creates a directory instead of a file.
+	Dir bool `json:"dir,omitempty" yaml:"dir,omitempty"`
+
+	// Content is the inline content of a file.
+	Content string `json:"content,omitempty" yaml:"content,omitempty"`
+
+	// Source is the path of a file or directory on the host which is copied. For a directory, its whole content
+	// is copied into the directory of the entry. It cannot be combined with Content.
+	Source string `json:"source,omitempty" yaml:"source,omitempty"`
+
+	// Attributes of the entry: "readonly", "hidden", "system" and "archive".
+	Attributes []string `json:"attributes,omitempty" yaml:"attributes,omitempty"`
+
+	// ModTime is the modification time of the entry, e.g. "2021-01-02T15:04:06Z".
+	// If it is not set, copied host files keep their time and all other entries get the current time.
+	ModTime time.Time `json:"modTime" yaml:"modTime"`
+}
+
+// ReadSpec reads a Spec in YAML format, which includes JSON. Unknown fields are rejected, so that typos do not go
+// unnoticed.
+func ReadSpec(r io.Reader) (Spec, error) {
+	decoder := yaml.NewDecoder(r)
+	decoder.KnownFields(true)
+
+	var spec Spec
+	err := decoder.Decode(&spec)
+	if err != nil {
+		return Spec{}, checkpoint.Wrap(err, ErrApply)
+	}
+	return spec, nil
+}
+
+// Apply creates all entries of the spec in order and sets the label.
+// Existing files are overwritten and existing directories are kept, so a spec can be applied again after changing it.
+// The sources of the entries are read from host, e.g. afero.NewOsFs(). It may be nil if no entry has a source.
+// All entries are validated before anything is changed. This includes that all new entries fit into the root
+// directory of a FAT16 filesystem, see Spec.RootOverflow.
+func (f *Fs) Apply(spec Spec, host afero.Fs) error {
+	for _, entry := range spec.Entries {
+		err := validateSpecEntry(entry, host)
+		if err != nil {
+			return checkpoint.Wrap(err, ErrApply)
+		}
+	}
+
+	names, err := specRootNames(spec, host)
+	if err != nil {
+		return checkpoint.Wrap(err, ErrApply)
+	}
+
+	layout, err := f.planRootLayout(names, spec.RootOverflow, spec.Label != "" && spec.Label != f.Label())
+	if err != nil {
+		return checkpoint.Wrap(err, ErrApply)
+	}
+
+	if spec.Label != "" && spec.Label != f.Label() {
+		err := f.SetLabel(spec.Label)
+		if err != nil {
+			return checkpoint.Wrap(err, ErrApply)
+		}
+	}
+
+	if len(layout.overflow) > 0 {
+		err := f.MkdirAll(layout.dir, 0777)
+		if err != nil {
+			return checkpoint.Wrap(err, ErrApply)
+		}
+	}
+
+	for _, entry := range spec.Entries {
+		err := f.applyEntry(entry, host, layout)
+		if err != nil {
+			return checkpoint.Wrap(err, fmt.Errorf("%w: %v", ErrApply, entry.Path))
+		}
+	}
+
+	return nil
+}
+
+// validateSpecEntry checks that the entry can be applied.
+func validateSpecEntry(entry SpecEntry, host afero.Fs) error {
+	name, err := cleanPath(entry.Path)
+	if err != nil {
+		return checkpoint.Wrap(err, fmt.Errorf("%w: %v", ErrInvalidPath, entry.Path))
+	}
+
+	switch {
+	case entry.Content != "" && (entry.Dir || entry.Source != ""):
+		return checkpoint.From(fmt.Errorf("%w: %v: content can only be used for files without a source", ErrInvalidPath, entry.Path))
+	case entry.Source != "" && host == nil:
+		return checkpoint.From(fmt.Errorf("%w: %v: a source needs a host filesystem", ErrInvalidPath, entry.Path))
+	case name == "" && (!entry.Dir || entry.Source == "" || len(entry.Attributes) > 0 || !entry.ModTime.IsZero()):
+		return checkpoint.From(fmt.Errorf("%w: the root directory can only be used as directory with a source", ErrInvalidPath))
+	}
+
+	for _, attribute := range entry.Attributes {
+		if _, ok := specAttributes[attribute]; !ok {
+			return checkpoint.From(fmt.Errorf("%w: %v: unknown attribute '%v'", ErrInvalidPath, entry.Path, attribute))
+		}
+	}
+
+	if entry.Source != "" {
+		info, err := host.Stat(entry.Source)
+		if err != nil {
+			return checkpoint.From(err)
+		}
+		if info.IsDir() != entry.Dir {
+			return checkpoint.From(fmt.Errorf("%w: %v: the source '%v' has to be a directory exactly if the entry is one", ErrInvalidPath, entry.Path, entry.Source))
+		}
+	}
+
+	return nil
+}
+
+// specRootNames returns the names of all entries of the spec which are created directly in the root directory.
+func specRootNames(spec Spec, host afero.Fs) ([]string, error) {
+	var names []string
+	for _, entry := range spec.Entries {
+		name, err := cleanPath(entry.Path)
+		if err != nil {
+			return nil, err
+		}
+
+		if name != "" {
+			names = append(names, strings.SplitN(name, "/", 2)[0])
+			continue
+		}
+
+		// The content of a source directory is copied into the root.
+		infos, err := afero.ReadDir(host, entry.Source)
+		if err != nil {
+			return nil, checkpoint.From(err)
+		}
+		for _, info := range infos {
+			names = append(names, info.Name())
+		}
+	}
+
+	return names, nil
+}
+
+// applyEntry creates a single entry of a spec at the place given by the layout.
+func (f *Fs) applyEntry(entry SpecEntry, host afero.Fs, layout rootLayout) error {
+	name, err := cleanPath(entry.Path)
+	if err != nil {
+		return err
+	}
+	name = layout.place(name)
+
+	modTime := entry.ModTime
+	if entry.Dir {
+		if name != "" {
+			err = f.MkdirAll(name, 0777)
+			if err != nil {
+				return err
+			}
+		}
+
+		if entry.Source != "" {
+			err = f.copyHostDir(host, entry.Source, name, layout)
+			if err != nil {
+				return err
+			}
+		}
+	} else {
+		if dir := path.Dir(name); dir != "." {
+			err = f.MkdirAll(dir, 0777)
+			if err != nil {
+				return err
+			}
+		}
+
+		var reader io.Reader = strings.NewReader(entry.Content)
+		if entry.Source != "" {
+			file, err := host.Open(entry.Source)
+			if err != nil {
+				return checkpoint.From(err)
+			}
+			defer file.Close()
+
+			info, err := file.Stat()
+			if err != nil {
+				return checkpoint.From(err)
+			}
+			if modTime.IsZero() {
+				modTime = info.ModTime()
+			}
+			reader = file
+		}
+
+		err = f.writeFrom(name, reader)
+		if err != nil {
+			return err
+		}
+	}
+
+	if name == "" {
+		return nil
+	}
+
+	if len(entry.Attributes) > 0 {
+		var attributes byte
+		for _, attribute := range entry.Attributes {
+			attributes |= specAttributes[attribute]
+		}
+
+		err = f.SetAttributes(name, attributes)
+		if err != nil {
+			return err
+		}
+	}
+
+	if !modTime.IsZero() {
+		return f.Chtimes(name, modTime, modTime)
+	}
+	return nil
+}
+
+// copyHostDir copies the content of the host directory source into the directory at name.
+// The modification times of the host files and directories are kept.
+// If name is the root directory, the layout decides where the entries are created.
+func (f *Fs) copyHostDir(host afero.Fs, source string, name string, layout rootLayout) error {
+	return afero.Walk(host, source, func(hostPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return checkpoint.From(err)
+		}
+
+		rel, err := filepath.Rel(source, hostPath)
+		if err != nil {
+			return checkpoint.From(err)
+		}
+		if rel == "." {
+			return nil
+		}
+		target := layout.place(path.Join(name, filepath.ToSlash(rel)))
+
+		if info.IsDir() {
+			err = f.MkdirAll(target, 0777)
+		} else {
+			var file afero.File
+			file, err = host.Open(hostPath)
+			if err != nil {
+				return checkpoint.From(err)
+			}
+			err = f.writeFrom(target, file)
+			file.Close()
+		}
+		if err != nil {
+			return err
+		}
+
+		return f.Chtimes(target, info.ModTime(), info.ModTime())
+	})
+}
+
+// writeFrom creates or overwrites the file at name with everything from the reader.
+// A read only attribute of an existing file is removed first.
+func (f *Fs) writeFrom(name string, reader io.Reader) error {
+	if _, err := f.Stat(name); err == nil {
+		err = f.Chmod(name, 0666)
+		if err != nil {
+			return err
+		}
+	}
+
+	file, err := f.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(file, reader)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,210 @@
+package gofat
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+func TestFs_Apply(t *testing.T) {
+	hostTime := time.Date(2019, 5, 6, 7, 8, 10, 0, time.Local)
+	specTime := time.Date(2021, 1, 2, 15, 4, 6, 0, time.Local)
+
+	host := afero.NewMemMapFs()
+	for name, content := range map[string]string{
+		"app.bin":       string(testData(5000)),
+		"tree/c.txt":    "c",
+		"tree/sub/b.md": "b",
+	} {
+		if err := afero.WriteFile(host, name, []byte(content), 0666); err != nil {
+			t.Fatal(err)
+		}
+		if err := host.Chtimes(name, hostTime, hostTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	spec := Spec{
+		Label: "firmware",
+		Entries: []SpecEntry{
+			{Path: "boot", Dir: true, Attributes: []string{"system"}},
+			{Path: "boot/config.txt", Content: "mode=fast\n", Attributes: []string{"readonly", "hidden"}, ModTime: specTime},
+			{Path: "bin/app.bin", Source: "app.bin"},
+			{Path: "data", Dir: true, Source: "tree"},
+			{Path: ".", Dir: true, Source: "tree/sub"},
+			{Path: "empty.txt"},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		path     string
+		want     string
+		wantAttr byte
+		wantTime time.Time
+	}{
+		{name: "directory", path: "boot", wantAttr: AttrDirectory | AttrSystem},
+		{name: "inline content", path: "boot/config.txt", want: "mode=fast\n", wantAttr: AttrReadOnly | AttrHidden, wantTime: specTime},
+		{name: "host file", path: "bin/app.bin", want: string(testData(5000)), wantTime: hostTime},
+		{name: "host directory", path: "data/sub/b.md", want: "b", wantTime: hostTime},
+		{name: "host directory into the root", path: "b.md", want: "b", wantTime: hostTime},
+		{name: "empty file", path: "empty.txt", want: ""},
+	}
+
+	fs := testingFormat(t, FormatOptions{Size: 16 * 1024 * 1024})
+
+	// Applying the spec again must lead to the same result, even with read only files.
+	for i := 0; i < 2; i++ {
+		if err := fs.Apply(spec, host); err != nil {
+			t.Fatalf("Fs.Apply() error = %v", err)
+		}
+	}
+
+	if got := fs.Label(); got != "FIRMWARE" {
+		t.Errorf("Fs.Label() = %v, want %v", got, "FIRMWARE")
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := fs.Stat(tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !info.IsDir() {
+				got, err := afero.ReadFile(fs, tt.path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(got) != tt.want {
+					t.Errorf("%v contains %v bytes, want %v bytes", tt.path, len(got), len(tt.want))
+				}
+			}
+
+			if got := info.(FileInfo).Entry().Attribute &^ AttrArchive; got != tt.wantAttr {
+				t.Errorf("%v attribute = %#x, want %#x", tt.path, got, tt.wantAttr)
+			}
+			if !tt.wantTime.IsZero() && !info.ModTime().Equal(tt.wantTime) {
+				t.Errorf("%v ModTime() = %v, want %v", tt.path, info.ModTime(), tt.wantTime)
+			}
+		})
+	}
+}
+
+func TestFs_ApplyInvalid(t *testing.T) {
+	host := afero.NewMemMapFs()
+	if err := afero.WriteFile(host, "file", []byte("data"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		entry   SpecEntry
+		wantErr error
+	}{
+		{
+			name:    "content and source",
+			entry:   SpecEntry{Path: "a", Content: "data", Source: "file"},
+			wantErr: ErrInvalidPath,
+		},
+		{
+			name:    "directory with content",
+			entry:   SpecEntry{Path: "a", Dir: true, Content: "data"},
+			wantErr: ErrInvalidPath,
+		},
+		{
+			name:    "unknown attribute",
+			entry:   SpecEntry{Path: "a", Attributes: []string{"secret"}},
+			wantErr: ErrInvalidPath,
+		},
+		{
+			name:    "invalid path",
+			entry:   SpecEntry{Path: "/a"},
+			wantErr: ErrInvalidPath,
+		},
+		{
+			name:    "root as file",
+			entry:   SpecEntry{Path: "."},
+			wantErr: ErrInvalidPath,
+		},
+		{
+			name:    "missing source",
+			entry:   SpecEntry{Path: "a", Source: "missing"},
+			wantErr: os.ErrNotExist,
+		},
+		{
+			name:    "file source for a directory",
+			entry:   SpecEntry{Path: "a", Dir: true, Source: "file"},
+			wantErr: ErrInvalidPath,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := testingFormat(t, FormatOptions{Size: 16 * 1024 * 1024})
+
+			// The invalid entry comes last, so nothing must be created.
+			spec := Spec{Entries: []SpecEntry{{Path: "first", Content: "data"}, tt.entry}}
+			err := fs.Apply(spec, host)
+			if !errors.Is(err, tt.wantErr) || !errors.Is(err, ErrApply) {
+				t.Fatalf("Fs.Apply() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if _, err := fs.Stat("first"); !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("Fs.Apply() created entries of an invalid spec")
+			}
+		})
+	}
+}
+
+func TestReadSpec(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    Spec
+		wantErr bool
+	}{
+		{
+			name:  "valid",
+			input: `{"label": "boot", "entries": [{"path": "a.txt", "content": "a", "modTime": "2021-01-02T15:04:06Z"}]}`,
+			want: Spec{Label: "boot", Entries: []SpecEntry{
+				{Path: "a.txt", Content: "a", ModTime: time.Date(2021, 1, 2, 15, 4, 6, 0, time.UTC)},
+			}},
+		},
+		{
+			name:  "yaml",
+			input: "label: boot\nentries:\n  - path: a.txt\n    content: a\n    modTime: 2021-01-02T15:04:06Z\n",
+			want: Spec{Label: "boot", Entries: []SpecEntry{
+				{Path: "a.txt", Content: "a", ModTime: time.Date(2021, 1, 2, 15, 4, 6, 0, time.UTC)},
+			}},
+		},
+		{
+			name:    "unknown field",
+			input:   `{"entries": [{"path": "a.txt", "contents": "a"}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "unknown yaml field",
+			input:   "entries:\n  - path: a.txt\n    contents: a\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ReadSpec(strings.NewReader(tt.input))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ReadSpec() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got.Label != tt.want.Label || len(got.Entries) != 1 || got.Entries[0].Path != tt.want.Entries[0].Path ||
+				got.Entries[0].Content != tt.want.Entries[0].Content || !got.Entries[0].ModTime.Equal(tt.want.Entries[0].ModTime) {
+				t.Errorf("ReadSpec() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
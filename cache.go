@@ -0,0 +1,252 @@
+package gofat
+
+import (
+	"container/list"
+	"sync"
+)
+
+// DefaultCacheSize is the count of sectors which are cached if no other size is configured.
+const DefaultCacheSize = 64
+
+// sectorCache is a LRU cache for sectors.
+// It is not safe for concurrent use, the lock of the cacheShard it belongs to has to be held.
+type sectorCache struct {
+	size    int
+	entries map[uint32]*list.Element
+	// order contains the sectors, the most recently used one at the front.
+	order *list.List
+	// release is called with the buffer of each sector which is dropped from the cache. It may be nil.
+	release func(buffer []byte)
+	// generation is increased each time sectors are written or the cache is cleared.
+	// Sectors read without holding the lock are only added if it did not change in the meantime,
+	// as they may be outdated otherwise.
+	generation uint64
+}
+
+// newSectorCache creates a cache which holds up to size sectors. A size < 1 is treated as 1.
+func newSectorCache(size int) *sectorCache {
+	if size < 1 {
+		size = 1
+	}
+
+	return &sectorCache{
+		size:    size,
+		entries: make(map[uint32]*list.Element, size),
+		order:   list.New(),
+	}
+}
+
+// get returns the cached sector and marks it as recently used.
+func (c *sectorCache) get(sectorNum uint32) (Sector, bool) {
+	element, ok := c.entries[sectorNum]
+	if !ok {
+		return Sector{}, false
+	}
+
+	c.order.MoveToFront(element)
+	return element.Value.(Sector), true
+}
+
+// put adds the sector to the cache or replaces the cached one.
+// If the cache is full, the least recently used sector is dropped.
+func (c *sectorCache) put(sector Sector) {
+	if element, ok := c.entries[sector.current]; ok {
+		c.drop(element.Value.(Sector))
+		element.Value = sector
+		c.order.MoveToFront(element)
+		return
+	}
+
+	if c.order.Len() >= c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(Sector).current)
+		c.drop(oldest.Value.(Sector))
+	}
+
+	c.entries[sector.current] = c.order.PushFront(sector)
+}
+
+// invalidate removes count sectors starting at sectorNum from the cache.
+func (c *sectorCache) invalidate(sectorNum uint32, count uint32) {
+	// Iterate over the smaller set.
+	if int(count) > c.order.Len() {
+		for num, element := range c.entries {
+			if num >= sectorNum && num-sectorNum < count {
+				c.order.Remove(element)
+				delete(c.entries, num)
+				c.drop(element.Value.(Sector))
+			}
+		}
+		return
+	}
+
+	for i := uint32(0); i < count; i++ {
+		if element, ok := c.entries[sectorNum+i]; ok {
+			c.order.Remove(element)
+			delete(c.entries, sectorNum+i)
+			c.drop(element.Value.(Sector))
+		}
+	}
+}
+
+// clear removes all sectors from the cache.
+func (c *sectorCache) clear() {
+	for element := c.order.Front(); element != nil; element = element.Next() {
+		c.drop(element.Value.(Sector))
+	}
+
+	c.entries = make(map[uint32]*list.Element, c.size)
+	c.order.Init()
+	c.generation++
+}
+
+// drop passes the buffer of a sector which was removed from the cache to the release func.
+func (c *sectorCache) drop(sector Sector) {
+	if c.release != nil {
+		c.release(sector.buffer)
+	}
+}
+
+// cacheShardCount is the maximum count of shards the sector cache is split into.
+const cacheShardCount = 16
+
+// cacheShard is one part of the shardedCache with its own lock.
+type cacheShard struct {
+	lock  sync.Mutex
+	cache *sectorCache
+}
+
+// shardedCache splits the sectors over several LRU caches by their number,
+// so that concurrent reads of different sectors do not wait for each other.
+type shardedCache struct {
+	shards []*cacheShard
+}
+
+// newShardedCache creates a cache which holds up to size sectors in total.
+// release is passed to each shard, see sectorCache.release.
+func newShardedCache(size int, release func(buffer []byte)) *shardedCache {
+	if size < 1 {
+		size = 1
+	}
+
+	count := cacheShardCount
+	if size < count {
+		count = size
+	}
+
+	c := &shardedCache{
+		shards: make([]*cacheShard, count),
+	}
+	for i := range c.shards {
+		// Distribute the remainder over the first shards, so that the total size matches.
+		shardSize := size / count
+		if i < size%count {
+			shardSize++
+		}
+
+		cache := newSectorCache(shardSize)
+		cache.release = release
+		c.shards[i] = &cacheShard{cache: cache}
+	}
+
+	return c
+}
+
+// shard returns the shard which is responsible for the sector.
+func (c *shardedCache) shard(sectorNum uint32) *cacheShard {
+	return c.shards[sectorNum%uint32(len(c.shards))]
+}
+
+// invalidate removes count sectors starting at sectorNum from all shards.
+func (c *shardedCache) invalidate(sectorNum uint32, count uint32) {
+	for _, shard := range c.shards {
+		shard.lock.Lock()
+		shard.cache.invalidate(sectorNum, count)
+		shard.cache.generation++
+		shard.lock.Unlock()
+	}
+}
+
+// clear removes all sectors from all shards.
+func (c *shardedCache) clear() {
+	for _, shard := range c.shards {
+		shard.lock.Lock()
+		shard.cache.clear()
+		shard.lock.Unlock()
+	}
+}
+
+// sectorPool reuses the buffers of sectors which were dropped from the cache to avoid
+// allocating a new buffer for each sector read.
+// A nil sectorPool just allocates new buffers.
+type sectorPool struct {
+	pool sync.Pool
+}
+
+// get returns a buffer of the given size. Its content is undefined.
+func (p *sectorPool) get(size int) []byte {
+	if p != nil {
+		if buffer, ok := p.pool.Get().([]byte); ok && len(buffer) == size {
+			return buffer
+		}
+	}
+
+	return make([]byte, size)
+}
+
+// put adds the buffer to the pool. It must not be used anymore afterwards.
+func (p *sectorPool) put(buffer []byte) {
+	if p != nil {
+		p.pool.Put(buffer)
+	}
+}
+
+const (
+	// minBufferShift is log2 of the smallest buffer kept by the bufferPool.
+	minBufferShift = 9
+	// bufferClasses is the count of buffer sizes kept by the bufferPool: 512 bytes up to 4 MiB.
+	bufferClasses = 14
+)
+
+// bufferPool reuses the buffers of reads which span several sectors or clusters (e.g. by File.Read and
+// readSectors), so that sustained reads do not allocate a new buffer for each call.
+// The buffers are kept in classes of power of two sizes. Bigger buffers are just allocated.
+// A nil bufferPool just allocates new buffers.
+type bufferPool struct {
+	pools [bufferClasses]sync.Pool
+}
+
+// bufferClass returns the class of the smallest buffers which can hold size bytes.
+// It returns -1 if the size is too big for the pool.
+func bufferClass(size int) int {
+	for class := 0; class < bufferClasses; class++ {
+		if size <= 1<<(minBufferShift+class) {
+			return class
+		}
+	}
+	return -1
+}
+
+// get returns a buffer of the given size. Its content is undefined.
+func (p *bufferPool) get(size int) []byte {
+	class := bufferClass(size)
+	if p == nil || class < 0 {
+		return make([]byte, size)
+	}
+
+	if buffer, ok := p.pools[class].Get().([]byte); ok {
+		return buffer[:size]
+	}
+	return make([]byte, size, 1<<(minBufferShift+class))
+}
+
+// put adds a buffer returned by get to the pool. It must not be used anymore afterwards.
+// Buffers which were not returned by get are ignored.
+func (p *bufferPool) put(buffer []byte) {
+	class := bufferClass(cap(buffer))
+	if p == nil || class < 0 || cap(buffer) != 1<<(minBufferShift+class) {
+		return
+	}
+	p.pools[class].Put(buffer[:cap(buffer)])
+}
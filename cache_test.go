@@ -0,0 +1,418 @@
+package gofat
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"reflect"
+	"runtime"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func testSector(num uint32) Sector {
+	return Sector{current: num, buffer: []byte{byte(num)}}
+}
+
+func Test_sectorCache(t *testing.T) {
+	tests := []struct {
+		name       string
+		size       int
+		put        []uint32
+		get        []uint32
+		invalidate []uint32
+		want       []uint32
+		wantMissed []uint32
+	}{
+		{
+			name:       "drops the least recently used sector",
+			size:       2,
+			put:        []uint32{1, 2, 3},
+			want:       []uint32{2, 3},
+			wantMissed: []uint32{1},
+		},
+		{
+			name:       "get marks a sector as recently used",
+			size:       2,
+			put:        []uint32{1, 2, 3},
+			get:        []uint32{1},
+			want:       []uint32{1, 3},
+			wantMissed: []uint32{2},
+		},
+		{
+			name:       "size below 1 is treated as 1",
+			size:       0,
+			put:        []uint32{1, 2},
+			want:       []uint32{2},
+			wantMissed: []uint32{1},
+		},
+		{
+			name:       "invalidate a range",
+			size:       10,
+			put:        []uint32{1, 2, 3, 4, 5},
+			invalidate: []uint32{2, 3},
+			want:       []uint32{1, 5},
+			wantMissed: []uint32{2, 3, 4},
+		},
+		{
+			name:       "invalidate a range bigger than the cache",
+			size:       10,
+			put:        []uint32{1, 2, 3, 40},
+			invalidate: []uint32{2, 100},
+			want:       []uint32{1},
+			wantMissed: []uint32{2, 3, 40},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newSectorCache(tt.size)
+			for _, num := range tt.put {
+				c.put(testSector(num))
+				for _, get := range tt.get {
+					c.get(get)
+				}
+			}
+
+			if tt.invalidate != nil {
+				c.invalidate(tt.invalidate[0], tt.invalidate[1])
+			}
+
+			for _, num := range tt.want {
+				got, ok := c.get(num)
+				if !ok {
+					t.Errorf("sectorCache.get(%v) missed", num)
+					continue
+				}
+				if got.current != num || got.buffer[0] != byte(num) {
+					t.Errorf("sectorCache.get(%v) = %v", num, got)
+				}
+			}
+
+			for _, num := range tt.wantMissed {
+				if _, ok := c.get(num); ok {
+					t.Errorf("sectorCache.get(%v) should have missed", num)
+				}
+			}
+		})
+	}
+}
+
+// countingReader counts all Read calls.
+type countingReader struct {
+	io.ReadSeeker
+	reads int
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	r.reads++
+	return r.ReadSeeker.Read(p)
+}
+
+func TestNewWithOptions_CacheSize(t *testing.T) {
+	walk := func(cacheSize int) int {
+		reader := &countingReader{ReadSeeker: testFileReader(fat32)}
+		fs, err := NewWithOptions(reader, Options{CacheSize: cacheSize})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Walk twice, so the second walk can use the cache.
+		for i := 0; i < 2; i++ {
+			if err := afero.Walk(fs, ".", func(string, os.FileInfo, error) error { return nil }); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return reader.reads
+	}
+
+	single := walk(1)
+	cached := walk(DefaultCacheSize)
+	if cached >= single {
+		t.Errorf("reads with cache = %v, want less than %v without cache", cached, single)
+	}
+}
+
+func Test_sectorCache_release(t *testing.T) {
+	var released []byte
+	c := newSectorCache(2)
+	c.release = func(buffer []byte) {
+		released = append(released, buffer[0])
+	}
+
+	// Evicting, replacing, invalidating and clearing release the buffers.
+	c.put(testSector(1))
+	c.put(testSector(2))
+	c.put(testSector(3))
+	c.put(Sector{current: 3, buffer: []byte{33}})
+	c.invalidate(2, 1)
+	c.clear()
+
+	if want := []byte{1, 3, 2, 33}; string(released) != string(want) {
+		t.Errorf("released buffers = %v, want %v", released, want)
+	}
+}
+
+func Test_shardedCache(t *testing.T) {
+	tests := []struct {
+		name       string
+		size       int
+		wantShards int
+	}{
+		{name: "less sectors than shards", size: 3, wantShards: 3},
+		{name: "invalid size", size: 0, wantShards: 1},
+		{name: "remainder", size: 70, wantShards: cacheShardCount},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newShardedCache(tt.size, nil)
+			if len(c.shards) != tt.wantShards {
+				t.Errorf("newShardedCache() created %v shards, want %v", len(c.shards), tt.wantShards)
+			}
+
+			total := 0
+			for _, shard := range c.shards {
+				total += shard.cache.size
+			}
+			if wantSize := tt.size; total != wantSize && !(wantSize < 1 && total == 1) {
+				t.Errorf("newShardedCache() holds %v sectors, want %v", total, wantSize)
+			}
+		})
+	}
+
+	c := newShardedCache(cacheShardCount*2, nil)
+	for num := uint32(0); num < cacheShardCount*2; num++ {
+		shard := c.shard(num)
+		shard.cache.put(testSector(num))
+	}
+
+	// Invalidating a range reaches all shards.
+	c.invalidate(3, cacheShardCount)
+	for num := uint32(0); num < cacheShardCount*2; num++ {
+		_, ok := c.shard(num).cache.get(num)
+		if wantOk := num < 3 || num >= 3+cacheShardCount; ok != wantOk {
+			t.Errorf("sector %v cached = %v, want %v", num, ok, wantOk)
+		}
+	}
+
+	c.clear()
+	for num := uint32(0); num < cacheShardCount*2; num++ {
+		if _, ok := c.shard(num).cache.get(num); ok {
+			t.Errorf("sector %v still cached after clear", num)
+		}
+	}
+}
+
+func TestFs_parallelWalk(t *testing.T) {
+	for _, name := range []string{"io.ReaderAt", "io.ReadSeeker"} {
+		t.Run(name, func(t *testing.T) {
+			var fs *Fs
+			if name == "io.ReaderAt" {
+				fs = testingNew(t, testFileReader(fat32))
+			} else {
+				fs = testingNew(t, struct{ io.ReadSeeker }{testFileReader(fat32)})
+			}
+
+			want := walkContents(t, fs)
+			if len(want) == 0 {
+				t.Fatal("no files found")
+			}
+
+			// Walk and read the whole filesystem from several goroutines at once, all must see the same.
+			results := make(chan map[string]string)
+			for i := 0; i < 8; i++ {
+				go func() {
+					results <- walkContents(t, fs)
+				}()
+			}
+			for i := 0; i < 8; i++ {
+				if got := <-results; !reflect.DeepEqual(got, want) {
+					t.Errorf("a parallel walk returned other contents")
+				}
+			}
+		})
+	}
+}
+
+// walkContents reads all files of the filesystem and returns their contents by path.
+func walkContents(t *testing.T, fs afero.Fs) map[string]string {
+	contents := make(map[string]string)
+	err := afero.Walk(fs, ".", func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+
+		data, err := afero.ReadFile(fs, path)
+		contents[path] = string(data)
+		return err
+	})
+	if err != nil {
+		t.Error(err)
+	}
+	return contents
+}
+
+func Test_sectorPool(t *testing.T) {
+	var nilPool *sectorPool
+	if got := nilPool.get(512); len(got) != 512 {
+		t.Errorf("nil sectorPool.get() returned %v bytes, want 512", len(got))
+	}
+	nilPool.put(make([]byte, 512))
+
+	pool := &sectorPool{}
+	pool.put(make([]byte, 512))
+	if got := pool.get(1024); len(got) != 1024 {
+		t.Errorf("sectorPool.get() returned a buffer of another size: %v bytes", len(got))
+	}
+}
+
+func Test_bufferPool(t *testing.T) {
+	var nilPool *bufferPool
+	if got := nilPool.get(2000); len(got) != 2000 {
+		t.Errorf("nil bufferPool.get() returned %v bytes, want 2000", len(got))
+	}
+	nilPool.put(make([]byte, 2048))
+
+	tests := []struct {
+		name    string
+		size    int
+		wantCap int
+	}{
+		{name: "empty", size: 0, wantCap: 512},
+		{name: "one sector", size: 512, wantCap: 512},
+		{name: "rounded up", size: 2000, wantCap: 2048},
+		{name: "biggest class", size: 4 * 1024 * 1024, wantCap: 4 * 1024 * 1024},
+		{name: "too big", size: 4*1024*1024 + 1, wantCap: 4*1024*1024 + 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pool := &bufferPool{}
+			got := pool.get(tt.size)
+			if len(got) != tt.size || cap(got) != tt.wantCap {
+				t.Errorf("bufferPool.get() returned %v bytes with capacity %v, want %v with %v", len(got), cap(got), tt.size, tt.wantCap)
+			}
+			pool.put(got[:1])
+		})
+	}
+
+	// Buffers which were not returned by get are ignored.
+	pool := &bufferPool{}
+	pool.put(make([]byte, 1000))
+	if got := pool.get(1000); cap(got) != 1024 {
+		t.Errorf("bufferPool.get() returned a foreign buffer with capacity %v", cap(got))
+	}
+}
+
+func TestFile_ReadAtReusesBuffers(t *testing.T) {
+	fs := testingNew(t, testingCopy(t, fat16))
+	data := testData(256 * 1024)
+	if err := afero.WriteFile(fs, "big", data, 0666); err != nil {
+		t.Fatal(err)
+	}
+	file, err := fs.Open("big")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	p := make([]byte, 64*1024)
+	const reads = 100
+	allocated := func(buffers *bufferPool) uint64 {
+		fs.buffers = buffers
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		for i := 0; i < reads; i++ {
+			if _, err := file.ReadAt(p, int64(i%4)*int64(len(p))); err != nil {
+				t.Fatal(err)
+			}
+		}
+		runtime.ReadMemStats(&after)
+		return after.TotalAlloc - before.TotalAlloc
+	}
+
+	pooled := allocated(&bufferPool{})
+	unpooled := allocated(nil)
+
+	if !bytes.Equal(p, data[3*len(p):]) {
+		t.Errorf("File.ReadAt() returned other data than written")
+	}
+	// The race detector drops some buffers of a sync.Pool on purpose, so only half of the buffers have to be saved.
+	if pooled+reads/2*uint64(len(p)) > unpooled {
+		t.Errorf("File.ReadAt() allocated %v bytes with and %v bytes without reusing buffers for %v reads of %v bytes",
+			pooled, unpooled, reads, len(p))
+	}
+}
+
+func TestFs_fetchReturnsCopy(t *testing.T) {
+	fs := testingNew(t, testFileReader(fat32))
+
+	sector, err := fs.fetch(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := sector.buffer[0]
+	sector.buffer[0] = ^want
+
+	// The cached sector must not be changed by the caller.
+	if err := fs.readSector(0, func(buffer []byte) {
+		if buffer[0] != want {
+			t.Errorf("the cached sector was changed through the result of fetch")
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// hookedImage is a testImage which implements io.ReaderAt and calls the hook once after the next ReadAt
+// has copied the data.
+type hookedImage struct {
+	*testImage
+	hook func()
+}
+
+func (i *hookedImage) ReadAt(p []byte, off int64) (int, error) {
+	n := copy(p, i.data[off:])
+
+	if hook := i.hook; hook != nil {
+		i.hook = nil
+		hook()
+	}
+
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func TestFs_readSector_concurrentWrite(t *testing.T) {
+	image := &hookedImage{testImage: testingImage(t)}
+	if err := Format(image, FormatOptions{Size: 32 * 1024 * 1024}); err != nil {
+		t.Fatal(err)
+	}
+	fs := testingNew(t, image)
+	if fs.readerAt == nil {
+		t.Fatal("the io.ReaderAt of the image is not used")
+	}
+
+	sectorNum := fs.info.FirstDataSector + 5
+	want := bytes.Repeat([]byte{0xAB}, int(fs.info.BytesPerSector))
+
+	// Write the sector after it was read but before it is added to the cache.
+	image.hook = func() {
+		if err := fs.storeSectors(sectorNum, want); err != nil {
+			t.Error(err)
+		}
+	}
+	if _, err := fs.fetch(sectorNum); err != nil {
+		t.Fatal(err)
+	}
+
+	// The outdated content must not have been cached.
+	got, err := fs.fetch(sectorNum)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got.buffer, want) {
+		t.Errorf("Fs.fetch() returned outdated data after a concurrent write")
+	}
+}
@@ -0,0 +1,205 @@
+package gofat
+
+import (
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/aligator/gofat/checkpoint"
+)
+
+// clusterIndex caches the cluster chain of a file, so that the cluster containing a specific offset
+// can be found without following the chain from its start again and again.
+// It gets filled lazily while reading and has to be reset if the chain changes.
+// It is safe for concurrent use, so that one index can be shared by concurrent reads of the same file.
+// The zero value is an empty index.
+type clusterIndex struct {
+	lock sync.Mutex
+	// clusters contains the already resolved clusters of the chain in order.
+	clusters []fatEntry
+	// complete is true if the end of the chain was reached.
+	complete bool
+}
+
+// reset removes all clusters from the index.
+func (i *clusterIndex) reset() {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	i.clusters = nil
+	i.complete = false
+}
+
+// chainCacheSize is the count of cluster chains kept by the chainCache.
+const chainCacheSize = 16
+
+// chainCache keeps the clusterIndex of recently used cluster chains by their first cluster, so that operations
+// without an open File (e.g. Tail) can seek into a chain without following it from its start again.
+// All changes of the filesystem drop the whole cache, so it never contains outdated chains.
+// It is safe for concurrent use.
+type chainCache struct {
+	lock    sync.Mutex
+	indexes map[fatEntry]*clusterIndex
+}
+
+// index returns the clusterIndex of the chain starting at the first cluster.
+// A nil cache returns a new empty index each time.
+func (c *chainCache) index(first fatEntry) *clusterIndex {
+	if c == nil {
+		return &clusterIndex{}
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if index, ok := c.indexes[first]; ok {
+		return index
+	}
+
+	// If the cache is full, it gets dropped completely to keep it simple.
+	if c.indexes == nil || len(c.indexes) >= chainCacheSize {
+		c.indexes = make(map[fatEntry]*clusterIndex)
+	}
+
+	index := &clusterIndex{}
+	c.indexes[first] = index
+	return index
+}
+
+// clear removes all chains from the cache.
+func (c *chainCache) clear() {
+	if c == nil {
+		return
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.indexes = nil
+}
+
+// clusterAt returns the n-th cluster (starting at 0) of the chain starting at the first cluster.
+// It returns false if the chain is shorter.
+// If the index does not belong to the given first cluster, it is reset.
+func (f *Fs) clusterAt(first fatEntry, index *clusterIndex, n int) (fatEntry, bool, error) {
+	index.lock.Lock()
+	defer index.lock.Unlock()
+
+	if len(index.clusters) == 0 || index.clusters[0] != first {
+		index.clusters = []fatEntry{first}
+		index.complete = false
+	}
+
+	for len(index.clusters) <= n {
+		if index.complete {
+			return 0, false, nil
+		}
+
+		if uint32(len(index.clusters)) > f.info.ClusterCount {
+			return 0, false, checkpoint.From(fmt.Errorf("%w: invalid cluster chain starting at cluster %d", ErrReadFat, first))
+		}
+
+		next, err := f.getFatEntry(index.clusters[len(index.clusters)-1])
+		if err != nil {
+			return 0, false, err
+		}
+
+		if !next.ReadAsNextCluster() {
+			index.complete = true
+			return 0, false, nil
+		}
+
+		index.clusters = append(index.clusters, next)
+	}
+
+	return index.clusters[n], true, nil
+}
+
+// chainReader reads the data stored in a cluster chain starting at a given offset.
+// It only reads the sectors needed to fill the buffer passed to Read, so reading a few bytes
+// does not read the whole cluster and nothing gets buffered between the calls.
+type chainReader struct {
+	fs    *Fs
+	first fatEntry
+	index *clusterIndex
+	// size is the count of bytes stored in the chain. If it is < 0 the reader reads until the end of the chain.
+	size   int64
+	offset int64
+}
+
+// newChainReader creates a reader for the chain starting at the first cluster.
+// The index may be nil. See readFileAt for the meaning of size.
+func (f *Fs) newChainReader(first fatEntry, index *clusterIndex, size int64, offset int64) *chainReader {
+	if index == nil {
+		index = &clusterIndex{}
+	}
+
+	return &chainReader{
+		fs:     f,
+		first:  first,
+		index:  index,
+		size:   size,
+		offset: offset,
+	}
+}
+
+// Read reads up to len(p) bytes starting at the current offset of the reader.
+// It returns io.EOF at the end of the data and io.ErrUnexpectedEOF if the chain is shorter than the size.
+func (r *chainReader) Read(p []byte) (int, error) {
+	clusterSize := r.fs.clusterSize()
+	bytesPerSector := int64(r.fs.info.BytesPerSector)
+
+	n := 0
+	for n < len(p) {
+		want := int64(len(p) - n)
+		if r.size >= 0 {
+			if r.offset >= r.size {
+				break
+			}
+			if r.size-r.offset < want {
+				want = r.size - r.offset
+			}
+		}
+
+		cluster, ok, err := r.fs.clusterAt(r.first, r.index, int(r.offset/clusterSize))
+		if err != nil {
+			return n, r.wrap(err, r.first)
+		}
+		if !ok {
+			if r.size >= 0 {
+				// The file was not as long as it should be.
+				return n, r.wrap(io.ErrUnexpectedEOF, r.first)
+			}
+			break
+		}
+
+		inCluster := r.offset % clusterSize
+		sectorNum := r.fs.firstSectorOfCluster(cluster) + uint32(inCluster/bytesPerSector)
+		inSector := inCluster % bytesPerSector
+
+		var read int
+		err = r.fs.readSector(sectorNum, func(buffer []byte) {
+			end := inSector + want
+			if end > int64(len(buffer)) {
+				end = int64(len(buffer))
+			}
+			read = copy(p[n:], buffer[inSector:end])
+		})
+		if err != nil {
+			return n, r.wrap(err, cluster)
+		}
+
+		n += read
+		r.offset += int64(read)
+	}
+
+	if n == 0 && len(p) > 0 {
+		return 0, io.EOF
+	}
+	return n, nil
+}
+
+// wrap adds the cluster and the offset to the error, so that the corrupt region can be located.
+func (r *chainReader) wrap(err error, cluster fatEntry) error {
+	return checkpoint.Wrap(err, fmt.Errorf("%w: cluster %d of the chain starting at cluster %d, offset %d", ErrReadFilesystemFile, cluster, r.first, r.offset))
+}
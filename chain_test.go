@@ -0,0 +1,141 @@
+package gofat
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"testing"
+)
+
+func TestFs_clusterAt(t *testing.T) {
+	fs := testingNew(t, testFileReader(fat16))
+
+	// README.md of the FAT16 image uses the clusters 6, 8, 9, 10, 11 and 12.
+	tests := []struct {
+		name   string
+		first  fatEntry
+		n      int
+		want   fatEntry
+		wantOk bool
+	}{
+		{name: "first", first: 6, n: 0, want: 6, wantOk: true},
+		{name: "second", first: 6, n: 1, want: 8, wantOk: true},
+		{name: "last", first: 6, n: 5, want: 12, wantOk: true},
+		{name: "behind the end", first: 6, n: 6, want: 0, wantOk: false},
+	}
+	index := &clusterIndex{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok, err := fs.clusterAt(tt.first, index, tt.n)
+			if err != nil {
+				t.Fatalf("Fs.clusterAt() error = %v", err)
+			}
+			if got != tt.want || ok != tt.wantOk {
+				t.Errorf("Fs.clusterAt() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+
+	if !index.complete || len(index.clusters) != 6 {
+		t.Errorf("index = %v, want all 6 clusters and complete", index)
+	}
+
+	// Using the index for another chain resets it.
+	if got, _, _ := fs.clusterAt(4, index, 0); got != 4 || len(index.clusters) != 1 {
+		t.Errorf("Fs.clusterAt() with another first cluster = %v, index = %v", got, index)
+	}
+}
+
+func TestFile_ReadAtRandom(t *testing.T) {
+	image := testingImage(t)
+	if err := Format(image, FormatOptions{Size: 32 * 1024 * 1024}); err != nil {
+		t.Fatal(err)
+	}
+	fs := testingNew(t, image)
+
+	data := testData(int(fs.clusterSize()) * 20)
+	file, err := fs.OpenFile("file", os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := file.Write(data); err != nil {
+		t.Fatal(err)
+	}
+
+	// Read backwards, so every read needs another cluster.
+	buffer := make([]byte, 100)
+	for offset := int64(len(data)) - 100; offset >= 0; offset -= fs.clusterSize() - 7 {
+		if _, err := file.ReadAt(buffer, offset); err != nil {
+			t.Fatalf("File.ReadAt(%v) error = %v", offset, err)
+		}
+		if !bytes.Equal(buffer, data[offset:offset+100]) {
+			t.Fatalf("File.ReadAt(%v) returned wrong data", offset)
+		}
+	}
+
+	if chain := &file.(*File).chain; len(chain.clusters) != 20 {
+		t.Errorf("the cluster chain was not cached: %v", chain.clusters)
+	}
+
+	// Writing resets the cache, so that the new clusters are found.
+	more := testData(int(fs.clusterSize()) * 2)
+	if _, err := file.WriteAt(more, int64(len(data))); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := file.ReadAt(buffer, int64(len(data)+len(more)-100)); err != nil {
+		t.Fatalf("File.ReadAt() after writing error = %v", err)
+	}
+	if !bytes.Equal(buffer, more[len(more)-100:]) {
+		t.Errorf("File.ReadAt() after writing returned wrong data")
+	}
+}
+
+func Test_chainReader_Read(t *testing.T) {
+	fs := testingNew(t, testFileReader(fat16))
+
+	// DoNotEdit_tests/README.md of the FAT16 image starts at cluster 6.
+	file, err := fs.readFileAt(6, nil, -1, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Skip some bytes at the start and the end to not be aligned to the sectors.
+	want := file[3 : len(file)-3]
+
+	for _, chunk := range []int{1, 7, 512, 1000, len(want) + 1} {
+		reader := fs.newChainReader(6, nil, int64(len(file)-3), 3)
+
+		var got []byte
+		buffer := make([]byte, chunk)
+		for {
+			n, err := reader.Read(buffer)
+			got = append(got, buffer[:n]...)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("chainReader.Read() with chunks of %v error = %v", chunk, err)
+			}
+		}
+
+		if !bytes.Equal(got, want) {
+			t.Errorf("chainReader.Read() with chunks of %v returned %v bytes, want %v bytes", chunk, len(got), len(want))
+		}
+	}
+}
+
+func Test_chainReader_Read_onlyNeededSectors(t *testing.T) {
+	reader := &countingReader{ReadSeeker: testFileReader(fat16)}
+	fs, err := NewWithOptions(reader, Options{CacheSize: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Reading a few bytes of the first sector must not read the rest of the cluster.
+	reader.reads = 0
+	if _, err := fs.newChainReader(6, nil, -1, 10).Read(make([]byte, 10)); err != nil {
+		t.Fatal(err)
+	}
+	if reader.reads != 1 {
+		t.Errorf("reading 10 bytes read %v sectors, want 1", reader.reads)
+	}
+}
@@ -0,0 +1,334 @@
+package gofat
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+
+	"github.com/aligator/gofat/checkpoint"
+)
+
+// FindingKind identifies the kind of problem found by Check.
+type FindingKind string
+
+const (
+	// FindingInvalidCluster is a cluster chain which references a free, bad or not existing cluster.
+	FindingInvalidCluster FindingKind = "invalid-cluster"
+	// FindingChainLoop is a cluster chain which references one of its own clusters again.
+	FindingChainLoop FindingKind = "chain-loop"
+	// FindingCrossLinked is a cluster which is used by more than one file or directory.
+	FindingCrossLinked FindingKind = "cross-linked"
+	// FindingSizeMismatch is a file whose size does not match the length of its cluster chain.
+	FindingSizeMismatch FindingKind = "size-mismatch"
+	// FindingUnreadableDir is a directory whose entries cannot be read.
+	FindingUnreadableDir FindingKind = "unreadable-dir"
+	// FindingLostClusters are clusters which are marked as used but do not belong to any file or directory.
+	FindingLostClusters FindingKind = "lost-clusters"
+	// FindingFreeCount is a free cluster count in the FSInfo sector which does not match the FAT.
+	FindingFreeCount FindingKind = "free-count"
+	// FindingFatMismatch is a FAT copy which differs from the first FAT.
+	FindingFatMismatch FindingKind = "fat-mismatch"
+	// FindingSuspiciousName is an entry with a valid long filename whose short name breaks the rules for short
+	// names (e.g. spaces or invalid characters). Correct implementations never generate such names, so it is a
+	// common sign of buggy writers or of tampering, as other systems may show or match the entry differently.
+	FindingSuspiciousName FindingKind = "suspicious-name"
+)
+
+// Finding is a single problem found by Check.
+type Finding struct {
+	// Kind of the problem.
+	Kind FindingKind `json:"kind"`
+	// Path of the affected file or directory. It is empty for problems which do not belong to a path.
+	// The root directory is ".".
+	Path string `json:"path,omitempty"`
+	// Clusters which are affected.
+	Clusters []uint32 `json:"clusters,omitempty"`
+	// Message describes the problem.
+	Message string `json:"message"`
+	// Fix describes how the problem can be fixed.
+	Fix string `json:"fix"`
+}
+
+// Report is the result of Check.
+// It can be converted to JSON, e.g. using WriteJSON.
+type Report struct {
+	Label        string    `json:"label"`
+	FSType       FATType   `json:"fsType"`
+	ClusterCount uint32    `json:"clusterCount"`
+	UsedClusters uint32    `json:"usedClusters"`
+	Files        int       `json:"files"`
+	Dirs         int       `json:"dirs"`
+	Findings     []Finding `json:"findings"`
+}
+
+// OK returns true if no problems were found.
+func (r Report) OK() bool {
+	return len(r.Findings) == 0
+}
+
+// WriteJSON writes the report as indented JSON.
+func (r Report) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return checkpoint.From(encoder.Encode(r))
+}
+
+// checker holds the state of a running Check.
+type checker struct {
+	fs     *Fs
+	report Report
+	// fat contains all FAT entries of the first FAT.
+	fat []fatEntry
+	// owners contains the path which uses each cluster.
+	owners map[fatEntry]string
+}
+
+// Check checks the whole filesystem for inconsistencies without changing it.
+// It returns an error only if the check itself fails. Found problems are part of the report.
+func (f *Fs) Check() (Report, error) {
+	// Block all changes while checking.
+	f.writeLock.Lock()
+	defer f.writeLock.Unlock()
+
+	c := &checker{
+		fs: f,
+		report: Report{
+			Label:        f.Label(),
+			FSType:       f.FSType(),
+			ClusterCount: f.info.ClusterCount,
+			Findings:     []Finding{},
+		},
+		fat:    make([]fatEntry, f.info.ClusterCount+2),
+		owners: make(map[fatEntry]string),
+	}
+
+	// The first FAT is read once completely and each other FAT while comparing it.
+	fatBytes := int64(f.info.FatSize) * int64(f.info.BytesPerSector)
+	total := fatBytes * int64(f.info.FatCount)
+	entriesPerSector := f.info.BytesPerSector / uint16(f.fatEntrySize())
+
+	for cluster := fatEntry(2); cluster.Value() < f.info.ClusterCount+2; cluster++ {
+		entry, err := f.getFatEntry(cluster)
+		if err != nil {
+			return Report{}, checkpoint.Wrap(err, ErrReadFat)
+		}
+		c.fat[cluster] = entry
+
+		if (cluster.Value()+1)%uint32(entriesPerSector) == 0 {
+			f.reportProgress(int64(cluster.Value()+1)*int64(f.fatEntrySize()), total)
+		}
+	}
+	f.reportProgress(fatBytes, total)
+
+	c.checkDir(".", rootRef())
+	c.checkLostClusters()
+
+	err := c.checkFatCopies()
+	if err != nil {
+		return Report{}, checkpoint.Wrap(err, ErrReadFat)
+	}
+	f.reportProgress(total, total)
+
+	return c.report, nil
+}
+
+// add adds a finding to the report.
+func (c *checker) add(kind FindingKind, path string, clusters []fatEntry, fix string, format string, args ...interface{}) {
+	var values []uint32
+	for _, cluster := range clusters {
+		values = append(values, cluster.Value())
+	}
+
+	finding := Finding{
+		Kind:     kind,
+		Path:     path,
+		Clusters: values,
+		Message:  fmt.Sprintf(format, args...),
+		Fix:      fix,
+	}
+	c.report.Findings = append(c.report.Findings, finding)
+	c.fs.debug("check found a problem", "kind", finding.Kind, "path", finding.Path, "message", finding.Message)
+}
+
+// checkChain follows the cluster chain of the given path and marks all clusters as used by it.
+// It returns the clusters and false if the chain is broken.
+func (c *checker) checkChain(path string, first fatEntry) ([]fatEntry, bool) {
+	var chain []fatEntry
+
+	for current := first; ; {
+		if !c.fs.validCluster(current) {
+			c.add(FindingInvalidCluster, path, []fatEntry{current}, "truncate the chain before the invalid cluster",
+				"the cluster chain references the invalid cluster %d", current)
+			return chain, false
+		}
+
+		if owner, ok := c.owners[current]; ok {
+			if owner == path {
+				c.add(FindingChainLoop, path, []fatEntry{current}, "end the chain before the repeated cluster",
+					"the cluster chain loops back to cluster %d", current)
+			} else {
+				c.add(FindingCrossLinked, path, []fatEntry{current}, "copy the data into new clusters for one of the entries",
+					"cluster %d is also used by %v", current, owner)
+			}
+			return chain, false
+		}
+
+		c.owners[current] = path
+		chain = append(chain, current)
+
+		next := c.fat[current]
+		if next.ReadAsEOF() {
+			return chain, true
+		}
+
+		if next.IsFree() || next.IsBad() {
+			c.add(FindingInvalidCluster, path, []fatEntry{current}, "mark the cluster as end of the chain",
+				"cluster %d references the free or bad cluster value %#x", current, next.Value())
+			return chain, false
+		}
+
+		current = next
+	}
+}
+
+// checkDir checks the given directory and all of its content recursively.
+func (c *checker) checkDir(dirPath string, dir entryRef) {
+	dirCluster := c.fs.entryDirCluster(dir)
+
+	if cluster := c.fs.dirClusterOrRoot(dirCluster); cluster != 0 {
+		if _, ok := c.checkChain(dirPath, cluster); !ok {
+			// Do not read broken directories as they may contain garbage.
+			return
+		}
+	}
+
+	refs, err := c.fs.readDirRefs(dirCluster)
+	if err != nil {
+		c.add(FindingUnreadableDir, dirPath, []fatEntry{dirCluster}, "recover the directory from a backup",
+			"the directory cannot be read")
+		return
+	}
+
+	for _, ref := range refs {
+		entryPath := path.Join(dirPath, ref.FileInfo().Name())
+
+		// The checksum of the long filename matched, otherwise it would not be used.
+		if ref.lfnCount > 0 {
+			if violation := shortNameViolation(ref.Name); violation != "" {
+				c.add(FindingSuspiciousName, entryPath, nil, "rename the entry to generate a valid short name",
+					"the short name %q of the long filename %v", shortNameString(ref.Name), violation)
+			}
+		}
+
+		if ref.isDir() {
+			c.report.Dirs++
+			if ref.firstCluster() == 0 {
+				c.add(FindingInvalidCluster, entryPath, nil, "remove the directory entry",
+					"the directory has no cluster")
+				continue
+			}
+
+			c.checkDir(entryPath, ref)
+			continue
+		}
+
+		c.report.Files++
+		c.checkFile(entryPath, ref)
+	}
+}
+
+// checkFile checks the cluster chain of the given file against its size.
+func (c *checker) checkFile(filePath string, ref entryRef) {
+	size := int64(ref.FileSize)
+	first := ref.firstCluster()
+
+	if first == 0 {
+		if size != 0 {
+			c.add(FindingSizeMismatch, filePath, nil, "set the file size to 0",
+				"the file has a size of %d bytes but no clusters", size)
+		}
+		return
+	}
+
+	chain, ok := c.checkChain(filePath, first)
+	if !ok {
+		return
+	}
+
+	needed := int((size + c.fs.clusterSize() - 1) / c.fs.clusterSize())
+	if len(chain) < needed {
+		c.add(FindingSizeMismatch, filePath, chain[len(chain)-1:],
+			fmt.Sprintf("set the file size to %d bytes", int64(len(chain))*c.fs.clusterSize()),
+			"the file has a size of %d bytes but only %d clusters", size, len(chain))
+	} else if len(chain) > needed && needed > 0 {
+		c.add(FindingSizeMismatch, filePath, chain[needed:], "free the clusters behind the end of the file",
+			"the file has a size of %d bytes but %d clusters", size, len(chain))
+	} else if needed == 0 {
+		c.add(FindingSizeMismatch, filePath, chain, "free the clusters of the empty file",
+			"the file is empty but has %d clusters", len(chain))
+	}
+}
+
+// checkLostClusters searches used clusters which are not referenced and compares the free cluster count.
+func (c *checker) checkLostClusters() {
+	var lost []fatEntry
+	free := uint32(0)
+
+	for cluster := fatEntry(2); cluster.Value() < c.fs.info.ClusterCount+2; cluster++ {
+		entry := c.fat[cluster]
+		switch {
+		case entry.IsFree():
+			free++
+		case entry.IsBad():
+		default:
+			if _, ok := c.owners[cluster]; !ok {
+				lost = append(lost, cluster)
+			}
+		}
+	}
+
+	c.report.UsedClusters = c.fs.info.ClusterCount - free
+
+	if len(lost) > 0 {
+		c.add(FindingLostClusters, "", lost, "free the clusters or recover them into files",
+			"%d clusters are used but do not belong to any file or directory", len(lost))
+	}
+
+	if c.fs.info.FSType == FAT32 && c.fs.alloc.freeCount != unknownFreeCount && c.fs.alloc.freeCount != free {
+		c.add(FindingFreeCount, "", nil, fmt.Sprintf("set the free cluster count to %d", free),
+			"the FSInfo sector reports %d free clusters but %d are free", c.fs.alloc.freeCount, free)
+	}
+}
+
+// checkFatCopies compares all FAT copies with the first one.
+func (c *checker) checkFatCopies() error {
+	fatSize := c.fs.info.FatSize
+	first := uint32(c.fs.info.ReservedSectorCount)
+
+	for i := uint32(1); i < uint32(c.fs.info.FatCount); i++ {
+		for sector := uint32(0); sector < fatSize; sector++ {
+			want, err := c.fs.fetch(first + sector)
+			if err != nil {
+				return err
+			}
+
+			got, err := c.fs.fetch(first + i*fatSize + sector)
+			if err != nil {
+				return err
+			}
+
+			if !bytes.Equal(want.buffer, got.buffer) {
+				c.add(FindingFatMismatch, "", nil, "copy the first FAT over the other FATs",
+					"FAT %d differs from the first FAT starting at its sector %d", i+1, sector)
+				break
+			}
+
+			c.fs.reportProgress(int64(i*fatSize+sector+1)*int64(c.fs.info.BytesPerSector),
+				int64(fatSize)*int64(c.fs.info.BytesPerSector)*int64(c.fs.info.FatCount))
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,272 @@
+package gofat
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestFs_Check(t *testing.T) {
+	// corrupt creates two files on a new filesystem and modifies the FAT afterwards.
+	corrupt := func(t *testing.T, modify func(fs *Fs, a, b []fatEntry)) *Fs {
+		fs := testingFormat(t, FormatOptions{Size: 128 * 1024 * 1024, FSType: FAT32})
+
+		var chains [][]fatEntry
+		for _, name := range []string{"a", "b"} {
+			if err := afero.WriteFile(fs, name, testData(int(fs.clusterSize())*3), 0666); err != nil {
+				t.Fatal(err)
+			}
+
+			ref, err := fs.resolve(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			chain, err := fs.clusterChain(ref.firstCluster())
+			if err != nil {
+				t.Fatal(err)
+			}
+			chains = append(chains, chain)
+		}
+
+		if modify != nil {
+			err := fs.mutate(Mutation{}, func() error {
+				modify(fs, chains[0], chains[1])
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		return fs
+	}
+
+	setFat := func(t *testing.T, fs *Fs, cluster, value fatEntry) {
+		if err := fs.setFatEntry(cluster, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		modify func(t *testing.T, fs *Fs, a, b []fatEntry)
+		want   []FindingKind
+	}{
+		{
+			name: "no problems",
+			want: nil,
+		},
+		{
+			name: "cross linked",
+			modify: func(t *testing.T, fs *Fs, a, b []fatEntry) {
+				setFat(t, fs, b[0], a[1])
+			},
+			// The original clusters of b are also lost now.
+			want: []FindingKind{FindingCrossLinked, FindingLostClusters},
+		},
+		{
+			name: "loop",
+			modify: func(t *testing.T, fs *Fs, a, b []fatEntry) {
+				setFat(t, fs, a[2], a[0])
+			},
+			want: []FindingKind{FindingChainLoop},
+		},
+		{
+			name: "references free cluster",
+			modify: func(t *testing.T, fs *Fs, a, b []fatEntry) {
+				setFat(t, fs, b[2], 0)
+			},
+			// Changing the FAT directly does not update the free count.
+			want: []FindingKind{FindingInvalidCluster, FindingFreeCount},
+		},
+		{
+			name: "chain too short",
+			modify: func(t *testing.T, fs *Fs, a, b []fatEntry) {
+				setFat(t, fs, a[1], eocMarker)
+			},
+			want: []FindingKind{FindingSizeMismatch, FindingLostClusters},
+		},
+		{
+			name: "lost clusters",
+			modify: func(t *testing.T, fs *Fs, a, b []fatEntry) {
+				setFat(t, fs, b[2]+10, eocMarker)
+			},
+			want: []FindingKind{FindingLostClusters, FindingFreeCount},
+		},
+		{
+			name: "wrong free count",
+			modify: func(t *testing.T, fs *Fs, a, b []fatEntry) {
+				fs.alloc.freeCount -= 3
+				fs.alloc.dirty = true
+			},
+			want: []FindingKind{FindingFreeCount},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var modify func(fs *Fs, a, b []fatEntry)
+			if tt.modify != nil {
+				modify = func(fs *Fs, a, b []fatEntry) {
+					tt.modify(t, fs, a, b)
+				}
+			}
+			fs := corrupt(t, modify)
+
+			report, err := fs.Check()
+			if err != nil {
+				t.Fatalf("Fs.Check() error = %v", err)
+			}
+
+			var got []FindingKind
+			for _, finding := range report.Findings {
+				got = append(got, finding.Kind)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Fs.Check() findings = %v, want %v", report.Findings, tt.want)
+			}
+			if report.OK() != (len(tt.want) == 0) {
+				t.Errorf("Report.OK() = %v", report.OK())
+			}
+			if report.Files != 2 {
+				t.Errorf("Report.Files = %v, want 2", report.Files)
+			}
+		})
+	}
+}
+
+func TestFs_CheckImages(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		want []FindingKind
+	}{
+		{name: "FAT32", file: fat32},
+		{name: "FAT16", file: fat16},
+		{
+			name: "FAT16 with invalid files",
+			file: fat16InvalidFiles,
+			want: []FindingKind{FindingSizeMismatch, FindingLostClusters, FindingFatMismatch},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report, err := testingNew(t, testFileReader(tt.file)).Check()
+			if err != nil {
+				t.Fatalf("Fs.Check() error = %v", err)
+			}
+
+			var got []FindingKind
+			for _, finding := range report.Findings {
+				got = append(got, finding.Kind)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Fs.Check() findings = %v, want %v", report.Findings, tt.want)
+			}
+		})
+	}
+}
+
+func TestReport_WriteJSON(t *testing.T) {
+	report, err := testingNew(t, testFileReader(fat16InvalidFiles)).Check()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buffer bytes.Buffer
+	if err := report.WriteJSON(&buffer); err != nil {
+		t.Fatalf("Report.WriteJSON() error = %v", err)
+	}
+
+	var got Report
+	if err := json.Unmarshal(buffer.Bytes(), &got); err != nil {
+		t.Fatalf("Report.WriteJSON() wrote invalid JSON: %v", err)
+	}
+	if !reflect.DeepEqual(got, report) {
+		t.Errorf("Report.WriteJSON() = %v, want %v", got, report)
+	}
+
+	if !bytes.Contains(buffer.Bytes(), []byte(`"path": "DoNotEdit_tests/README.md"`)) {
+		t.Errorf("Report.WriteJSON() does not contain the path of the broken file:\n%s", buffer.String())
+	}
+}
+
+func TestFs_Check_progress(t *testing.T) {
+	var done, total []int64
+	fs, err := NewWithOptions(testFileReader(fat16), Options{Progress: func(d, t int64) {
+		done = append(done, d)
+		total = append(total, t)
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := fs.Check(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := int64(fs.info.FatSize) * int64(fs.info.BytesPerSector) * int64(fs.info.FatCount)
+	if len(done) < 2 {
+		t.Fatalf("the progress was reported %v times", len(done))
+	}
+	for i := range done {
+		if total[i] != want || (i > 0 && done[i] < done[i-1]) {
+			t.Fatalf("progress %v/%v after %v, want increasing values up to %v", done[i], total[i], done[:i], want)
+		}
+	}
+	if last := done[len(done)-1]; last != want {
+		t.Errorf("the last progress is %v, want %v", last, want)
+	}
+}
+
+func TestFs_Check_suspiciousName(t *testing.T) {
+	fs := testingFormat(t, FormatOptions{Size: 32 * 1024 * 1024})
+	name := "Long file name.txt"
+	if err := afero.WriteFile(fs, name, []byte("content"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	ref, err := fs.resolve(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ref.lfnCount == 0 {
+		t.Fatal("the file has no long filename")
+	}
+
+	// Put a space into the short name and fix the checksums, as a buggy writer would do it.
+	err = fs.mutate(Mutation{}, func() error {
+		data, sectors, err := fs.readDirSlots(0)
+		if err != nil {
+			return err
+		}
+
+		slots := data[(ref.index-ref.lfnCount)*entrySize : (ref.index+1)*entrySize]
+		short := slots[ref.lfnCount*entrySize:]
+		short[4] = ' '
+
+		var shortName [11]byte
+		copy(shortName[:], short)
+		for i := 0; i < ref.lfnCount; i++ {
+			slots[i*entrySize+13] = shortNameChecksum(shortName)
+		}
+		return fs.writeDirSlots(sectors, ref.index-ref.lfnCount, slots)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The entry is still accepted with its long name.
+	if _, err := fs.Stat(name); err != nil {
+		t.Fatalf("Fs.Stat() error = %v", err)
+	}
+
+	report, err := fs.Check()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Findings) != 1 || report.Findings[0].Kind != FindingSuspiciousName || report.Findings[0].Path != name {
+		t.Errorf("Fs.Check() findings = %v, want a %v finding for %v", report.Findings, FindingSuspiciousName, name)
+	}
+}
@@ -97,6 +97,14 @@ type checkpoint struct {
 }
 
 func (e *checkpoint) Error() string {
+	// A checkpoint created by From has no prev error.
+	if e.prev == nil {
+		if e.callerOk {
+			return fmt.Sprintf("File: %s:%d\n\t%v", e.file, e.line, e.err)
+		}
+		return fmt.Sprintf("File: unknown\n\t%v", e.err)
+	}
+
 	// Use different formatting for the prev error if it was not also a checkpoint.
 	prevErrString := e.prev.Error()
 	_, ok := e.prev.(*checkpoint)
@@ -0,0 +1,38 @@
+package gofat
+
+import "time"
+
+// Clock provides the current time for all timestamps written into the filesystem: the creation, modification and
+// access times of new and changed entries and the volume ID generated by Format.
+// Tests and reproducible builds can use a FixedClock to create the same image on each run.
+type Clock interface {
+	Now() time.Time
+}
+
+// FixedClock is a Clock which always returns the same time.
+type FixedClock time.Time
+
+// Now returns the fixed time.
+func (c FixedClock) Now() time.Time {
+	return time.Time(c)
+}
+
+// systemClock returns the current system time. It is used if no Clock is set.
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// now returns the current time of the clock of the filesystem.
+func (f *Fs) now() time.Time {
+	return f.clock.Now()
+}
+
+// clockOrSystem returns the clock or the systemClock if it is nil.
+func clockOrSystem(clock Clock) Clock {
+	if clock == nil {
+		return systemClock{}
+	}
+	return clock
+}
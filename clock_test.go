@@ -0,0 +1,87 @@
+package gofat
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+func TestOptions_Clock(t *testing.T) {
+	fixed := time.Date(2021, 1, 2, 15, 4, 6, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		path   string
+		modify func(fs *Fs) error
+	}{
+		{
+			name: "create a file",
+			path: "file.txt",
+			modify: func(fs *Fs) error {
+				return afero.WriteFile(fs, "file.txt", []byte("data"), 0666)
+			},
+		},
+		{
+			name: "create directories",
+			path: "a/b",
+			modify: func(fs *Fs) error {
+				return fs.MkdirAll("a/b", 0777)
+			},
+		},
+		{
+			name: "write into an existing file",
+			path: "go/main.go",
+			modify: func(fs *Fs) error {
+				file, err := fs.OpenFile("go/main.go", os.O_WRONLY, 0)
+				if err != nil {
+					return err
+				}
+				if _, err := file.Write([]byte("package main")); err != nil {
+					return err
+				}
+				return file.Close()
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			image := testingCopy(t, fat16)
+			fs, err := NewWithOptions(image, Options{Clock: FixedClock(fixed)})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := tt.modify(fs); err != nil {
+				t.Fatal(err)
+			}
+
+			info, err := fs.Stat(tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !info.ModTime().Equal(fixed) {
+				t.Errorf("ModTime() = %v, want %v", info.ModTime(), fixed)
+			}
+		})
+	}
+}
+
+func TestFormat_Clock(t *testing.T) {
+	clock := FixedClock(time.Date(2021, 1, 2, 15, 4, 6, 0, time.UTC))
+
+	var images [][]byte
+	for i := 0; i < 2; i++ {
+		image := testingImage(t)
+		if err := Format(image, FormatOptions{Size: 16 * 1024 * 1024, Label: "REPRO", Clock: clock}); err != nil {
+			t.Fatal(err)
+		}
+		images = append(images, image.data)
+	}
+
+	if !bytes.Equal(images[0], images[1]) {
+		t.Errorf("Format() with a FixedClock created different images")
+	}
+}
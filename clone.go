@@ -0,0 +1,198 @@
+package gofat
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/aligator/gofat/checkpoint"
+)
+
+// ErrClone may occur while cloning a filesystem.
+var ErrClone = errors.New("could not clone the filesystem")
+
+// Clone copies the whole filesystem into a newly formatted filesystem on dst and returns the new filesystem.
+// In contrast to a plain byte copy, the target may have a different size and even a different FAT type:
+// the FAT size, the FSInfo and the cluster numbering are calculated for the new geometry and all files
+// are written without fragmentation.
+//
+// The options are used to format dst. All options which are not set are taken from this filesystem
+// (FSType, Label, VolumeID and BytesPerSector). If the FAT type of this filesystem does not fit the new size
+// and no FSType is given, it is chosen based on the size like Format does it.
+// If no size is given, the current size of dst is used or, if dst is empty, the size of this filesystem.
+//
+// Timestamps, attributes and short names of all entries are preserved.
+func (f *Fs) Clone(dst io.ReadWriteSeeker, opts FormatOptions) (*Fs, error) {
+	if opts.Size == 0 {
+		size, err := dst.Seek(0, io.SeekEnd)
+		if err != nil {
+			return nil, checkpoint.Wrap(err, ErrClone)
+		}
+
+		opts.Size = size
+		if size == 0 {
+			opts.Size = int64(f.info.TotalSectorCount) * int64(f.info.BytesPerSector)
+		}
+	}
+
+	if opts.Label == "" && f.Label() != "NO NAME" {
+		opts.Label = f.Label()
+	}
+
+	if opts.VolumeID == 0 {
+		opts.VolumeID = f.VolumeID()
+	}
+
+	if opts.BytesPerSector == 0 {
+		opts.BytesPerSector = f.info.BytesPerSector
+	}
+
+	if opts.FSType == "" {
+		// Keep the type if possible.
+		opts.FSType = f.info.FSType
+		if _, err := calculateGeometry(opts); err != nil {
+			opts.FSType = ""
+		}
+	}
+
+	if opts.Clock == nil {
+		opts.Clock = f.clock
+	}
+
+	err := Format(dst, opts)
+	if err != nil {
+		return nil, checkpoint.Wrap(err, ErrClone)
+	}
+
+	target, err := NewWithOptions(dst, Options{Clock: opts.Clock})
+	if err != nil {
+		return nil, checkpoint.Wrap(err, ErrClone)
+	}
+
+	err = target.mutate(Mutation{Op: OpCopy}, func() error {
+		return f.cloneDir(target, 0, 0)
+	})
+	if err != nil {
+		return nil, checkpoint.Wrap(err, ErrClone)
+	}
+
+	return target, nil
+}
+
+// cloneDir copies all entries of the directory starting at srcCluster into the directory of dst starting at dstCluster.
+func (f *Fs) cloneDir(dst *Fs, srcCluster, dstCluster fatEntry) error {
+	refs, err := f.readDirRefs(srcCluster)
+	if err != nil {
+		return err
+	}
+
+	for _, ref := range refs {
+		name := ref.FileInfo().Name()
+		header := ref.EntryHeader
+		header.setFirstCluster(0)
+
+		if ref.isDir() {
+			newRef, err := dst.mkdirAt(dstCluster, name, header)
+			if err != nil {
+				return err
+			}
+
+			err = f.cloneDir(dst, ref.firstCluster(), newRef.firstCluster())
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		cluster, err := f.cloneData(dst, ref.firstCluster(), int64(ref.FileSize))
+		if err != nil {
+			return checkpoint.Wrap(err, fmt.Errorf("%w: %v", ErrReadFilesystemFile, name))
+		}
+
+		header.setFirstCluster(cluster)
+		_, err = dst.addDirEntry(dstCluster, name, header)
+		if err != nil {
+			_ = dst.freeChain(cluster)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// cloneData copies size bytes of the chain starting at cluster into a new chain of dst.
+// It returns the first cluster of the new chain.
+func (f *Fs) cloneData(dst *Fs, cluster fatEntry, size int64) (fatEntry, error) {
+	if size == 0 {
+		return 0, nil
+	}
+
+	chain, err := f.clusterChain(cluster)
+	if err != nil {
+		return 0, err
+	}
+
+	if int64(len(chain))*f.clusterSize() < size {
+		return 0, checkpoint.From(io.ErrUnexpectedEOF)
+	}
+
+	var first, last fatEntry
+	write := func(data []byte) error {
+		next, err := dst.allocateCluster(last)
+		if err != nil {
+			return err
+		}
+
+		if first == 0 {
+			first = next
+		}
+		last = next
+
+		buffer := make([]byte, dst.clusterSize())
+		copy(buffer, data)
+		return dst.storeSectors(dst.firstSectorOfCluster(next), buffer)
+	}
+
+	// The cluster sizes of both filesystems may differ, so collect the data until a full cluster is available.
+	var pending []byte
+	remaining := size
+	for _, current := range chain {
+		if remaining <= 0 {
+			break
+		}
+
+		var data []byte
+		data, err = f.readSectors(f.firstSectorOfCluster(current), uint32(f.info.SectorsPerCluster))
+		if err != nil {
+			break
+		}
+
+		if int64(len(data)) > remaining {
+			data = data[:remaining]
+		}
+		remaining -= int64(len(data))
+		pending = append(pending, data...)
+		f.buffers.put(data)
+
+		for err == nil && int64(len(pending)) >= dst.clusterSize() {
+			err = write(pending[:dst.clusterSize()])
+			pending = pending[dst.clusterSize():]
+		}
+		if err != nil {
+			break
+		}
+	}
+
+	if err == nil && len(pending) > 0 {
+		err = write(pending)
+	}
+
+	if err != nil {
+		if first != 0 {
+			_ = dst.freeChain(first)
+		}
+		return 0, err
+	}
+
+	return first, nil
+}
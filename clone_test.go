@@ -0,0 +1,124 @@
+package gofat
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+// entryMetadata returns the raw entry of the info without the name and the cluster, which may differ for copies.
+func entryMetadata(info os.FileInfo) EntryHeader {
+	entry := info.(FileInfo).Entry()
+	entry.Name = [11]byte{}
+	entry.setFirstCluster(0)
+	return entry
+}
+
+func TestFs_Clone(t *testing.T) {
+	tests := []struct {
+		name      string
+		source    string
+		opts      FormatOptions
+		wantType  FATType
+		wantLabel string
+	}{
+		{
+			name:      "FAT32 to smaller FAT16",
+			source:    fat32,
+			opts:      FormatOptions{Size: 32 * 1024 * 1024, Label: "CLONED"},
+			wantType:  FAT16,
+			wantLabel: "CLONED",
+		},
+		{
+			name:      "FAT16 to FAT32",
+			source:    fat16,
+			opts:      FormatOptions{Size: 128 * 1024 * 1024, FSType: FAT32, SectorsPerCluster: 2},
+			wantType:  FAT32,
+			wantLabel: "NO NAME",
+		},
+		{
+			name:      "FAT16 to smaller FAT16",
+			source:    fat16,
+			opts:      FormatOptions{Size: 16 * 1024 * 1024},
+			wantType:  FAT16,
+			wantLabel: "NO NAME",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := testingNew(t, testFileReader(tt.source))
+
+			image := testingImage(t)
+			got, err := source.Clone(image, tt.opts)
+			if err != nil {
+				t.Fatalf("Fs.Clone() error = %v", err)
+			}
+
+			if got.FSType() != tt.wantType {
+				t.Errorf("Fs.FSType() = %v, want %v", got.FSType(), tt.wantType)
+			}
+			if got.Label() != tt.wantLabel {
+				t.Errorf("Fs.Label() = %v, want %v", got.Label(), tt.wantLabel)
+			}
+			if got.VolumeID() != source.VolumeID() {
+				t.Errorf("Fs.VolumeID() = %v, want %v", got.VolumeID(), source.VolumeID())
+			}
+
+			// Reopen the image to make sure everything got persisted.
+			cloned := testingNew(t, image)
+
+			err = afero.Walk(source, ".", func(path string, info os.FileInfo, err error) error {
+				if err != nil {
+					return err
+				}
+
+				clonedInfo, err := cloned.Stat(path)
+				if err != nil {
+					t.Errorf("Stat(%v) error = %v", path, err)
+					return nil
+				}
+
+				if clonedInfo.IsDir() != info.IsDir() || clonedInfo.Size() != info.Size() || !clonedInfo.ModTime().Equal(info.ModTime()) {
+					t.Errorf("Stat(%v) = %v, want %v", path, clonedInfo, info)
+				}
+
+				// All timestamps and attributes have to be copied exactly.
+				if got, want := entryMetadata(clonedInfo), entryMetadata(info); got != want {
+					t.Errorf("Stat(%v) metadata = %v, want %v", path, got, want)
+				}
+
+				if info.IsDir() {
+					return nil
+				}
+
+				want, err := afero.ReadFile(source, path)
+				if err != nil {
+					return err
+				}
+				data, err := afero.ReadFile(cloned, path)
+				if err != nil {
+					t.Errorf("ReadFile(%v) error = %v", path, err)
+					return nil
+				}
+				if !bytes.Equal(data, want) {
+					t.Errorf("ReadFile(%v) returned other data than the source", path)
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestFs_CloneTooSmall(t *testing.T) {
+	source := testingNew(t, testFileReader(fat16))
+
+	_, err := source.Clone(testingImage(t), FormatOptions{Size: 16 * 1024 * 1024, FSType: FAT32})
+	if err == nil {
+		t.Errorf("Fs.Clone() expected an error")
+	}
+}
@@ -0,0 +1,191 @@
+package gofat
+
+import (
+	"fmt"
+
+	"github.com/aligator/gofat/checkpoint"
+)
+
+// ClusterState is the state of a data cluster as stored in the FAT.
+type ClusterState uint8
+
+const (
+	// ClusterFree is a cluster which is not used.
+	ClusterFree ClusterState = iota
+	// ClusterUsed is a cluster which belongs to a chain (or is reserved).
+	ClusterUsed
+	// ClusterBad is a cluster which is marked as bad.
+	ClusterBad
+)
+
+// String returns the name of the state.
+func (s ClusterState) String() string {
+	switch s {
+	case ClusterFree:
+		return "free"
+	case ClusterUsed:
+		return "used"
+	case ClusterBad:
+		return "bad"
+	default:
+		return "unknown"
+	}
+}
+
+// ClusterMap returns the state of all data clusters. The first element belongs to cluster 2,
+// as the clusters 0 and 1 do not exist.
+func (f *Fs) ClusterMap() ([]ClusterState, error) {
+	clusters := make([]ClusterState, f.info.ClusterCount)
+	for i := range clusters {
+		entry, err := f.getFatEntry(fatEntry(i + 2))
+		if err != nil {
+			return nil, checkpoint.Wrap(err, ErrReadFat)
+		}
+
+		switch {
+		case entry.IsFree():
+			clusters[i] = ClusterFree
+		case entry.IsBad():
+			clusters[i] = ClusterBad
+		default:
+			clusters[i] = ClusterUsed
+		}
+	}
+
+	return clusters, nil
+}
+
+// FreeClusters counts the free data clusters by reading the whole FAT.
+// Unlike the count in the FSInfo sector of FAT32, it is always correct.
+func (f *Fs) FreeClusters() (uint32, error) {
+	var free uint32
+	for cluster := fatEntry(2); cluster < fatEntry(f.info.ClusterCount)+2; cluster++ {
+		entry, err := f.getFatEntry(cluster)
+		if err != nil {
+			return 0, checkpoint.Wrap(err, ErrReadFat)
+		}
+
+		if entry.IsFree() {
+			free++
+		}
+	}
+
+	return free, nil
+}
+
+// ClusterChain returns the clusters of the file or directory at the given path in their order.
+// It is empty for empty files and for the root directory of FAT16 which is not stored in clusters.
+func (f *Fs) ClusterChain(path string) ([]uint32, error) {
+	cleaned, err := cleanPath(path)
+	if err != nil {
+		return nil, checkpoint.Wrap(err, ErrReadFat)
+	}
+
+	ref, err := f.resolve(cleaned)
+	if err != nil {
+		return nil, checkpoint.Wrap(err, ErrReadFat)
+	}
+
+	// Only the root directory of FAT32 is referenced by cluster 0, empty files have no clusters.
+	first := ref.firstCluster()
+	if ref.isRoot() {
+		first = f.dirClusterOrRoot(0)
+	}
+
+	chain, err := f.clusterChain(first)
+	if err != nil {
+		return nil, checkpoint.Wrap(err, ErrReadFat)
+	}
+
+	clusters := make([]uint32, len(chain))
+	for i, cluster := range chain {
+		clusters[i] = cluster.Value()
+	}
+	return clusters, nil
+}
+
+// FatEntryKind is the interpretation of a FAT entry.
+type FatEntryKind string
+
+const (
+	// FatFree marks a free cluster.
+	FatFree FatEntryKind = "free"
+	// FatNext links to the next cluster of a chain.
+	FatNext FatEntryKind = "next"
+	// FatEOF marks the last cluster of a chain.
+	FatEOF FatEntryKind = "eof"
+	// FatBad marks a bad cluster.
+	FatBad FatEntryKind = "bad"
+	// FatReserved is a reserved value, which is also used for the entries of the not existing clusters 0 and 1.
+	FatReserved FatEntryKind = "reserved"
+)
+
+// FatEntry is the raw entry of a cluster in the FAT together with its interpretation.
+type FatEntry struct {
+	Cluster uint32 `json:"cluster"`
+	// Value is the entry as stored in the FAT. For FAT32 the upper 4 reserved bits are removed.
+	// The FAT12 value 0xFF0 is reported as 0xFFF, as it is read as EOF.
+	Value uint32       `json:"value"`
+	Kind  FatEntryKind `json:"kind"`
+}
+
+// String returns the interpretation of the entry, e.g. "chain→5", "EOF" or "free".
+func (e FatEntry) String() string {
+	switch e.Kind {
+	case FatNext:
+		return fmt.Sprintf("chain→%d", e.Value)
+	case FatEOF:
+		return "EOF"
+	default:
+		return string(e.Kind)
+	}
+}
+
+// FatEntries returns count entries of the first FAT starting at the entry of the first cluster, e.g. to debug broken
+// cluster chains. The entries 0 and 1 can be read as well, even if they do not belong to data clusters.
+// The range is cut at the end of the FAT.
+func (f *Fs) FatEntries(first uint32, count uint32) ([]FatEntry, error) {
+	end := f.info.ClusterCount + 2
+	if first >= end {
+		return nil, checkpoint.From(fmt.Errorf("%w: cluster %d is behind the last cluster %d", ErrReadFat, first, end-1))
+	}
+	if count > end-first {
+		count = end - first
+	}
+
+	entries := make([]FatEntry, count)
+	for i := range entries {
+		cluster := first + uint32(i)
+		value, err := f.getFatEntry(fatEntry(cluster))
+		if err != nil {
+			return nil, checkpoint.Wrap(err, ErrReadFat)
+		}
+
+		entry := FatEntry{Cluster: cluster, Value: value.Value()}
+		switch {
+		case cluster < 2:
+			entry.Kind = FatReserved
+		case value.IsFree():
+			entry.Kind = FatFree
+		case value.IsNextCluster():
+			entry.Kind = FatNext
+		case value.IsBad():
+			entry.Kind = FatBad
+		case value.ReadAsEOF():
+			entry.Kind = FatEOF
+		default:
+			entry.Kind = FatReserved
+		}
+
+		// getFatEntry extends the special values of FAT12 and FAT16 to the ones of FAT32.
+		switch f.info.FSType {
+		case FAT12:
+			entry.Value &= 0x0FFF
+		case FAT16:
+			entry.Value &= 0xFFFF
+		}
+		entries[i] = entry
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,167 @@
+package gofat
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestFs_ClusterChain(t *testing.T) {
+	fat16Fs := testingNew(t, testFileReader(fat16))
+	fat32Fs := testingFormat(t, FormatOptions{Size: 128 * 1024 * 1024, FSType: FAT32})
+	if err := afero.WriteFile(fat32Fs, "empty", nil, 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		fs      *Fs
+		path    string
+		want    []uint32
+		wantErr bool
+	}{
+		{name: "file", fs: fat16Fs, path: "DoNotEdit_tests/README.md", want: []uint32{6, 8, 9, 10, 11, 12}},
+		{name: "FAT16 root", fs: fat16Fs, path: ".", want: []uint32{}},
+		{name: "FAT32 empty file", fs: fat32Fs, path: "empty", want: []uint32{}},
+		{name: "FAT32 root", fs: fat32Fs, path: ".", want: []uint32{fat32Fs.info.fat32Specific.RootCluster.Value()}},
+		{name: "missing", fs: fat16Fs, path: "missing", wantErr: true},
+		{name: "invalid path", fs: fat16Fs, path: "/invalid", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.fs.ClusterChain(tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Fs.ClusterChain() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Fs.ClusterChain() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFs_ClusterMap(t *testing.T) {
+	fs := testingFormat(t, FormatOptions{Size: 32 * 1024 * 1024})
+	if err := fs.setFatEntry(5, 0x0FFFFFF7); err != nil {
+		t.Fatal(err)
+	}
+	file, err := fs.Create("file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := file.Write(testData(int(fs.clusterSize()) * 2)); err != nil {
+		t.Fatal(err)
+	}
+
+	chain, err := fs.ClusterChain("file")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := fs.ClusterMap()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != int(fs.info.ClusterCount) {
+		t.Fatalf("Fs.ClusterMap() returned %v clusters, want %v", len(got), fs.info.ClusterCount)
+	}
+
+	want := make([]ClusterState, len(got))
+	want[5-2] = ClusterBad
+	for _, cluster := range chain {
+		want[cluster-2] = ClusterUsed
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Fs.ClusterMap() does not match the FAT")
+	}
+}
+
+func TestFs_FreeClusters(t *testing.T) {
+	for _, fsType := range []FATType{FAT16, FAT32} {
+		fs := testingFormat(t, FormatOptions{Size: 128 * 1024 * 1024, FSType: fsType})
+		before, err := fs.FreeClusters()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// The root directory of FAT32 needs a cluster.
+		used := uint32(0)
+		if fs.RootCluster() != 0 {
+			used = 1
+		}
+		if before != fs.Info().ClusterCount-used {
+			t.Errorf("Fs.FreeClusters() of the new %v filesystem = %v, want %v", fsType, before, fs.Info().ClusterCount-used)
+		}
+
+		file, err := fs.Create("file")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := file.Write(testData(int(fs.clusterSize()) * 2)); err != nil {
+			t.Fatal(err)
+		}
+
+		after, err := fs.FreeClusters()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if after != before-2 {
+			t.Errorf("Fs.FreeClusters() of the %v filesystem after writing 2 clusters = %v, want %v", fsType, after, before-2)
+		}
+	}
+}
+
+func TestFs_FatEntries(t *testing.T) {
+	fat16Fs := testingNew(t, testFileReader(fat16))
+	fat32Fs := testingFormat(t, FormatOptions{Size: 128 * 1024 * 1024, FSType: FAT32})
+	if err := fat32Fs.setFatEntry(5, 0x0FFFFFF7); err != nil {
+		t.Fatal(err)
+	}
+	last := fat16Fs.Info().ClusterCount + 1
+
+	tests := []struct {
+		name    string
+		fs      *Fs
+		first   uint32
+		count   uint32
+		want    []string
+		wantErr bool
+	}{
+		{name: "FAT16 chain", fs: fat16Fs, first: 11, count: 2, want: []string{"chain→12", "EOF"}},
+		{name: "FAT16 reserved", fs: fat16Fs, first: 0, count: 2, want: []string{"reserved", "reserved"}},
+		{name: "FAT32 bad and free", fs: fat32Fs, first: 5, count: 2, want: []string{"bad", "free"}},
+		{name: "cut at the end", fs: fat16Fs, first: last, count: 10, want: []string{"free"}},
+		{name: "behind the end", fs: fat16Fs, first: last + 1, count: 1, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := tt.fs.FatEntries(tt.first, tt.count)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Fs.FatEntries() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			got := make([]string, len(entries))
+			for i, entry := range entries {
+				if entry.Cluster != tt.first+uint32(i) {
+					t.Errorf("Fs.FatEntries()[%d].Cluster = %v, want %v", i, entry.Cluster, tt.first+uint32(i))
+				}
+				got[i] = entry.String()
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Fs.FatEntries() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	entries, err := fat16Fs.FatEntries(12, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries[0].Value < 0xFFF8 || entries[0].Value > 0xFFFF {
+		t.Errorf("Fs.FatEntries() value of the FAT16 EOF = %#x, want a value between 0xfff8 and 0xffff", entries[0].Value)
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/aligator/gofat"
+	"github.com/spf13/afero"
+)
+
+// sizeUnits are the suffixes accepted by parseSize.
+var sizeUnits = map[string]int64{
+	"K": 1024,
+	"M": 1024 * 1024,
+	"G": 1024 * 1024 * 1024,
+}
+
+// apply populates an image as described by a spec file.
+// If the spec could not be applied, the exit code classifies the error.
+func apply(args []string) int {
+	flags := flag.NewFlagSet("apply", flag.ContinueOnError)
+	size := flags.String("size", "", "create a new image with this size (e.g. 64M) instead of changing an existing one")
+	fsType := flags.String("type", "", "FAT type of a new image, either FAT12, FAT16 or FAT32 (chosen by size if not set)")
+	dryRun := flags.Bool("dry-run", false, "only print the changes without writing them to an existing image")
+	journal := flags.Bool("journal", false, "print the journal of all changes as JSON instead of a summary")
+	record := flags.String("record", "", "record every sector read and write into this file, e.g. to report a problem")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s apply [flags] spec image\n\n"+
+			"Creates the directories and files described by the spec in the image. The spec is YAML or JSON,\n"+
+			"see gofat.Spec. Sources are relative to the directory of the spec.\n\nFlags:\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return usageCode(err)
+	}
+
+	if flags.NArg() != 2 || (*dryRun && *size != "") {
+		flags.Usage()
+		return exitUsage
+	}
+
+	spec, err := readSpec(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCode(err)
+	}
+
+	// Parse the size before the image gets truncated.
+	var bytes int64
+	mode := os.O_RDWR
+	if *dryRun {
+		mode = os.O_RDONLY
+	}
+	if *size != "" {
+		bytes, err = parseSize(*size)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitUsage
+		}
+		mode |= os.O_CREATE | os.O_TRUNC
+	}
+	file, err := os.OpenFile(flags.Arg(1), mode, 0666)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCode(err)
+	}
+	defer file.Close()
+
+	if *size != "" {
+		err = gofat.Format(file, gofat.FormatOptions{Size: bytes, FSType: gofat.FATType(strings.ToUpper(*fsType)), Label: spec.Label})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitCode(err)
+		}
+	}
+
+	opts := gofat.Options{DryRun: *dryRun}
+	if *record != "" {
+		recording, err := os.Create(*record)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitCode(err)
+		}
+		defer recording.Close()
+
+		buffered := bufio.NewWriter(recording)
+		defer buffered.Flush()
+		opts.Record = buffered
+	}
+
+	fs, err := gofat.NewWithOptions(file, opts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCode(err)
+	}
+
+	err = fs.Apply(spec, afero.NewOsFs())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCode(err)
+	}
+
+	if *journal {
+		return printJournal(fs)
+	}
+	if *dryRun {
+		return printChanges(fs)
+	}
+
+	fmt.Printf("applied %d entries to %v\n", len(spec.Entries), flags.Arg(1))
+	return exitOK
+}
+
+// printChanges prints the changes recorded by a dry run.
+func printChanges(fs *gofat.Fs) int {
+	changes, err := fs.Changes()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCode(err)
+	}
+
+	for _, change := range changes.Paths {
+		fmt.Printf("%-8v %v\n", change.Kind, change.Path)
+	}
+	fmt.Printf("%d sectors would be written, %d clusters allocated and %d freed\n",
+		len(changes.Sectors), len(changes.Allocated), len(changes.Freed))
+	return exitOK
+}
+
+// printJournal prints the journal of all changes as JSON.
+func printJournal(fs *gofat.Fs) int {
+	changes, err := fs.Changes()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCode(err)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(changes.Journal); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCode(err)
+	}
+	return exitOK
+}
+
+// readSpec reads the spec file and makes the relative sources relative to the directory of the spec.
+func readSpec(path string) (gofat.Spec, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return gofat.Spec{}, err
+	}
+	defer file.Close()
+
+	spec, err := gofat.ReadSpec(file)
+	if err != nil {
+		return gofat.Spec{}, err
+	}
+
+	for i, entry := range spec.Entries {
+		if entry.Source != "" && !filepath.IsAbs(entry.Source) {
+			spec.Entries[i].Source = filepath.Join(filepath.Dir(path), entry.Source)
+		}
+	}
+	return spec, nil
+}
+
+// parseSize parses a count of bytes with an optional binary unit, e.g. "512", "64M" or "2G".
+func parseSize(size string) (int64, error) {
+	number, multiplier := size, int64(1)
+	if unit, ok := sizeUnits[strings.ToUpper(size[len(size)-1:])]; ok {
+		number, multiplier = size[:len(size)-1], unit
+	}
+
+	value, err := strconv.ParseInt(number, 10, 64)
+	if err != nil || value <= 0 {
+		return 0, fmt.Errorf("invalid size '%v'", size)
+	}
+	return value * multiplier, nil
+}
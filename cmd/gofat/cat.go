@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/aligator/gofat"
+)
+
+// cat streams files of an image to stdout, one after another.
+// The files are copied cluster by cluster (see File.WriteTo), so even big files are never loaded into memory.
+// If the image or a file could not be read, the exit code classifies the error.
+func cat(args []string) int {
+	flags := flag.NewFlagSet("cat", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s cat image path...\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return usageCode(err)
+	}
+
+	if flags.NArg() < 2 {
+		flags.Usage()
+		return exitUsage
+	}
+
+	file, err := openImageFile(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCode(err)
+	}
+	defer file.Close()
+
+	fs, err := gofat.New(file)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCode(err)
+	}
+
+	out := bufio.NewWriterSize(os.Stdout, 64*1024)
+	for _, name := range flags.Args()[1:] {
+		if err := catFile(fs, name, out); err != nil {
+			_ = out.Flush()
+			fmt.Fprintf(os.Stderr, "%v: %v\n", name, err)
+			return exitCode(err)
+		}
+	}
+
+	if err := out.Flush(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCode(err)
+	}
+	return exitOK
+}
+
+// catFile copies the content of a single file into the writer.
+func catFile(fs *gofat.Fs, name string, w io.Writer) error {
+	info, err := fs.Stat(name)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("is a directory")
+	}
+
+	file, err := fs.Open(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = io.Copy(w, file)
+	return err
+}
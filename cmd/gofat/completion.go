@@ -0,0 +1,227 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/aligator/gofat"
+)
+
+// argStyle describes the arguments of a command for the shell completion.
+type argStyle int
+
+const (
+	// hostArgs are files of the host, which the shells complete themselves.
+	hostArgs argStyle = iota
+	// imagePathArgs are written as image:path, the path is completed inside of the image.
+	imagePathArgs
+	// imageArgs are an image followed by paths inside of it.
+	imageArgs
+	// shellArgs are the names of the supported shells.
+	shellArgs
+)
+
+// completeCommand is the hidden command the completion scripts call to get the candidates.
+const completeCommand = "__complete"
+
+// completionScripts are the completion scripts by shell. All of them pass the words to the __complete command and
+// fall back to completing the files of the host if it prints nothing.
+var completionScripts = map[string]string{
+	"bash": `# bash completion for gofat
+_gofat() {
+	local line="${COMP_LINE:0:COMP_POINT}"
+	local -a words
+	read -r -a words <<< "$line"
+	if [[ -z "$line" || "$line" == *[[:space:]] ]]; then
+		words+=("")
+	fi
+
+	local cur="${words[${#words[@]}-1]}"
+	local candidates
+	candidates="$(gofat __complete "${words[@]:1}" 2>/dev/null)"
+	[[ -z "$candidates" ]] && return
+
+	# Bash splits the words at colons, so only the part after the last colon gets replaced.
+	local prefix=""
+	if [[ "$cur" == *:* && "$COMP_WORDBREAKS" == *:* ]]; then
+		prefix="${cur%"${cur##*:}"}"
+	fi
+
+	local IFS=$'\n'
+	COMPREPLY=($candidates)
+	COMPREPLY=("${COMPREPLY[@]#"$prefix"}")
+	if [[ ${#COMPREPLY[@]} -eq 1 && "${COMPREPLY[0]}" == */ ]]; then
+		compopt -o nospace
+	fi
+}
+complete -o default -F _gofat gofat
+`,
+	"zsh": `#compdef gofat
+# zsh completion for gofat
+_gofat() {
+	local -a candidates dirs
+	candidates=("${(@f)$(gofat __complete "${(@)words[2,CURRENT]}" 2>/dev/null)}")
+	if [[ -z "${candidates[*]}" ]]; then
+		_files
+		return
+	fi
+
+	dirs=(${(M)candidates:#*/})
+	candidates=(${candidates:#*/})
+	compadd -Q -S '' -- "${dirs[@]}"
+	compadd -Q -- "${candidates[@]}"
+}
+
+if [[ "${funcstack[1]}" == "_gofat" ]]; then
+	_gofat "$@"
+else
+	compdef _gofat gofat
+fi
+`,
+	"fish": `# fish completion for gofat
+function __gofat_complete
+	set -l tokens (commandline -opc) (commandline -ct)
+	set -l candidates (gofat __complete $tokens[2..-1] 2>/dev/null)
+	if test (count $candidates) -eq 0
+		__fish_complete_path (commandline -ct)
+		return
+	end
+	printf '%s\n' $candidates
+end
+complete -c gofat -f -a '(__gofat_complete)'
+`,
+}
+
+// completion prints the completion script for a shell.
+// Paths inside of images are completed as well, e.g. 'gofat ls image.img DoNot<TAB>'.
+func completion(args []string) int {
+	flags := flag.NewFlagSet("completion", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s completion bash|zsh|fish\n\n"+
+			"Load the script in the shell, e.g. with: source <(gofat completion bash)\n", os.Args[0])
+	}
+	if err := flags.Parse(args); err != nil {
+		return usageCode(err)
+	}
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return exitUsage
+	}
+
+	script, ok := completionScripts[flags.Arg(0)]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown shell '%v'\n", flags.Arg(0))
+		return exitUsage
+	}
+
+	fmt.Print(script)
+	return exitOK
+}
+
+// complete prints the candidates for the last of the given words, one per line. The words are the command line
+// without the program name, the last one is the word being completed.
+// It prints nothing if the shell should complete the files of the host instead. Problems are never reported, as
+// they would disturb the command line.
+func complete(words []string) int {
+	if len(words) == 0 {
+		return exitOK
+	}
+
+	current := words[len(words)-1]
+	if len(words) == 1 {
+		for _, cmd := range commands {
+			if strings.HasPrefix(cmd.name, current) {
+				fmt.Println(cmd.name)
+			}
+		}
+		return exitOK
+	}
+
+	var style argStyle
+	for _, cmd := range commands {
+		if cmd.name == words[0] {
+			style = cmd.args
+		}
+	}
+
+	if strings.HasPrefix(current, "-") {
+		return exitOK
+	}
+
+	switch style {
+	case shellArgs:
+		var shells []string
+		for shell := range completionScripts {
+			if strings.HasPrefix(shell, current) {
+				shells = append(shells, shell)
+			}
+		}
+		sort.Strings(shells)
+		for _, shell := range shells {
+			fmt.Println(shell)
+		}
+	case imagePathArgs:
+		separator := strings.LastIndex(current, ":")
+		if separator >= 0 {
+			completeImagePath(current[:separator], current[separator+1:], current[:separator+1])
+		}
+	case imageArgs:
+		// The image is the first argument which is no flag.
+		for _, word := range words[1 : len(words)-1] {
+			if !strings.HasPrefix(word, "-") {
+				completeImagePath(word, current, "")
+				break
+			}
+		}
+	}
+
+	return exitOK
+}
+
+// completeImagePath prints the entries of the image starting with the partial path, each prefixed by prefix.
+// Directories end with a slash, so that their content can be completed next.
+func completeImagePath(image string, partial string, prefix string) {
+	if info, err := os.Stat(image); err != nil || info.IsDir() {
+		return
+	}
+
+	file, err := os.Open(image)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	fs, err := gofat.New(file)
+	if err != nil {
+		return
+	}
+
+	dir, base := path.Split(partial)
+	listed := strings.TrimPrefix(path.Clean("/"+dir), "/")
+	if listed == "" {
+		listed = "."
+	}
+
+	entries, _, err := fs.ListPage(listed, "", 0)
+	if err != nil {
+		return
+	}
+
+	for _, entry := range entries {
+		// FAT names are case-insensitive.
+		if !strings.HasPrefix(strings.ToLower(entry.Name()), strings.ToLower(base)) {
+			continue
+		}
+
+		candidate := prefix + dir + entry.Name()
+		if entry.IsDir() {
+			candidate += "/"
+		}
+		fmt.Println(candidate)
+	}
+}
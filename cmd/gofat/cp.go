@@ -0,0 +1,215 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/aligator/gofat"
+	"github.com/spf13/afero"
+)
+
+// cp copies files and directories out of images, like cp does on the host.
+// A source is written as 'image:path' where the path may contain wildcards. FAT does not allow ':' in names, so the
+// image ends at the last ':'. Several sources are copied into the destination directory.
+// If a source could not be copied, the exit code classifies the last failure, see exitCode.
+func cp(args []string) int {
+	flags := flag.NewFlagSet("cp", flag.ContinueOnError)
+	recursive := flags.Bool("r", false, "copy directories recursively")
+	all := flags.Bool("all", false, "copy the whole volume of the image into the destination directory")
+	preserve := flags.Bool("p", false, "preserve the modification times")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s cp [flags] image:path... destination\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "       %s cp -all [flags] image destination\n\nFlags:\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return usageCode(err)
+	}
+
+	if flags.NArg() < 2 || *all && flags.NArg() != 2 {
+		flags.Usage()
+		return exitUsage
+	}
+
+	sources := flags.Args()[:flags.NArg()-1]
+	destination := flags.Arg(flags.NArg() - 1)
+
+	images := make(map[string]*gofat.Fs)
+	openImage := func(name string) (*gofat.Fs, error) {
+		if fs, ok := images[name]; ok {
+			return fs, nil
+		}
+
+		file, err := openImageFile(name)
+		if err != nil {
+			return nil, err
+		}
+		// The files stay open until the command exits.
+
+		fs, err := gofat.New(file)
+		if err != nil {
+			_ = file.Close()
+			return nil, err
+		}
+		images[name] = fs
+		return fs, nil
+	}
+
+	if *all {
+		fs, err := openImage(sources[0])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitCode(err)
+		}
+		if err := copyEntry(fs, ".", destination, true, *preserve); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitCode(err)
+		}
+		return exitOK
+	}
+
+	// Expand all sources first, as the count of them decides if the destination is a directory.
+	type entry struct {
+		fs     *gofat.Fs
+		source string
+		name   string
+	}
+	var entries []entry
+	code := exitOK
+	for _, source := range sources {
+		separator := strings.LastIndex(source, ":")
+		if separator < 0 {
+			fmt.Fprintf(os.Stderr, "%v: the source has to be written as image:path\n", source)
+			return exitUsage
+		}
+
+		fs, err := openImage(source[:separator])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitCode(err)
+		}
+
+		names, err := expandSource(fs, source[separator+1:])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v: %v\n", source, err)
+			code = exitCode(err)
+			continue
+		}
+		for _, name := range names {
+			entries = append(entries, entry{fs: fs, source: source, name: name})
+		}
+	}
+
+	info, err := os.Stat(destination)
+	intoDir := err == nil && info.IsDir()
+	if len(entries) > 1 && !intoDir {
+		fmt.Fprintf(os.Stderr, "%v: the destination of several sources has to be a directory\n", destination)
+		return exitUsage
+	}
+
+	for _, entry := range entries {
+		target := destination
+		if intoDir {
+			target = filepath.Join(destination, path.Base(entry.name))
+		}
+
+		if err := copyEntry(entry.fs, entry.name, target, *recursive, *preserve); err != nil {
+			fmt.Fprintf(os.Stderr, "%v: %v\n", entry.source, err)
+			code = exitCode(err)
+		}
+	}
+
+	return code
+}
+
+// expandSource returns the paths in the image matching the path of a source.
+// It fails if a pattern does not match anything.
+func expandSource(fs *gofat.Fs, name string) ([]string, error) {
+	name = path.Clean("/" + name)[1:]
+	if name == "" {
+		name = "."
+	}
+
+	if !strings.ContainsAny(name, "*?[\\") {
+		return []string{name}, nil
+	}
+
+	names, err := gofat.GoFs{Fs: fs}.Glob(name)
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return nil, errors.New("no matching files")
+	}
+	return names, nil
+}
+
+// copyEntry copies a file or, if recursive is set, a directory with all its content from the image to the target.
+func copyEntry(fs *gofat.Fs, name string, target string, recursive bool, preserve bool) error {
+	info, err := fs.Stat(name)
+	if err != nil {
+		return err
+	}
+
+	if !info.IsDir() {
+		if _, err := extractFile(fs, name, target, ""); err != nil {
+			return err
+		}
+		if preserve {
+			return os.Chtimes(target, info.ModTime(), info.ModTime())
+		}
+		return nil
+	}
+
+	if !recursive {
+		return errors.New("is a directory (use -r to copy it)")
+	}
+
+	// The times of the directories are set at the end, as copying their content changes them.
+	var dirs []string
+	var times []os.FileInfo
+	err = afero.Walk(fs, name, func(current string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relative := strings.TrimPrefix(strings.TrimPrefix(current, name), "/")
+		if name == "." {
+			relative = current
+		}
+		currentTarget := filepath.Join(target, filepath.FromSlash(relative))
+
+		if info.IsDir() {
+			dirs = append(dirs, currentTarget)
+			times = append(times, info)
+			return os.MkdirAll(currentTarget, 0755)
+		}
+
+		if _, err := extractFile(fs, current, currentTarget, ""); err != nil {
+			return err
+		}
+		if preserve {
+			return os.Chtimes(currentTarget, info.ModTime(), info.ModTime())
+		}
+		return nil
+	})
+	if err != nil || !preserve {
+		return err
+	}
+
+	for i := len(dirs) - 1; i >= 0; i-- {
+		// The root directory has no times.
+		if times[i].ModTime().IsZero() {
+			continue
+		}
+		if err := os.Chtimes(dirs[i], times[i].ModTime(), times[i].ModTime()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
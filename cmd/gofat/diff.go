@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/aligator/gofat"
+	"github.com/spf13/afero"
+)
+
+// diffEntry is a file or directory found while comparing images.
+type diffEntry struct {
+	name string
+	info os.FileInfo
+}
+
+// diff compares the directory trees of two images and prints each added (A), removed (D) and changed (M) entry
+// with the changed properties, like "M  boot/config.txt (size 120 -> 130, time)". Like FAT, paths are compared case
+// insensitive, so a renamed case counts as change of the name.
+// It exits with exitFailure if the images differ, like diff does. If an image could not be read, the exit code
+// classifies the error.
+func diff(args []string) int {
+	flags := flag.NewFlagSet("diff", flag.ContinueOnError)
+	content := flags.Bool("content", false, "also compare the SHA-256 hashes of files with the same size")
+	ignoreTimes := flags.Bool("ignore-times", false, "do not compare the modification times")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s diff [flags] imageA imageB [path]\n\nFlags:\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return usageCode(err)
+	}
+
+	if flags.NArg() != 2 && flags.NArg() != 3 {
+		flags.Usage()
+		return exitUsage
+	}
+
+	root := "."
+	if flags.NArg() == 3 {
+		root = strings.TrimPrefix(path.Clean("/"+flags.Arg(2)), "/")
+		if root == "" {
+			root = "."
+		}
+	}
+
+	var filesystems [2]*gofat.Fs
+	var trees [2]map[string]diffEntry
+	for i := range filesystems {
+		file, err := openImageFile(flags.Arg(i))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitCode(err)
+		}
+		defer file.Close()
+
+		filesystems[i], err = gofat.New(file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v: %v\n", flags.Arg(i), err)
+			return exitCode(err)
+		}
+
+		trees[i], err = diffTree(filesystems[i], root)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v: %v\n", flags.Arg(i), err)
+			return exitCode(err)
+		}
+	}
+
+	keys := make([]string, 0, len(trees[0])+len(trees[1]))
+	for key := range trees[0] {
+		keys = append(keys, key)
+	}
+	for key := range trees[1] {
+		if _, ok := trees[0][key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	code := exitOK
+	for _, key := range keys {
+		a, inA := trees[0][key]
+		b, inB := trees[1][key]
+
+		switch {
+		case !inA:
+			fmt.Printf("A  %v\n", b.name)
+			code = exitFailure
+			continue
+		case !inB:
+			fmt.Printf("D  %v\n", a.name)
+			code = exitFailure
+			continue
+		}
+
+		changes, err := diffChanges(filesystems, a, b, *content, *ignoreTimes)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v: %v\n", a.name, err)
+			return exitCode(err)
+		}
+		if len(changes) > 0 {
+			fmt.Printf("M  %v (%v)\n", b.name, strings.Join(changes, ", "))
+			code = exitFailure
+		}
+	}
+
+	return code
+}
+
+// diffTree returns all entries below root by their upper case path.
+func diffTree(fs *gofat.Fs, root string) (map[string]diffEntry, error) {
+	tree := make(map[string]diffEntry)
+	err := afero.Walk(fs, root, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if name == root {
+			return nil
+		}
+
+		tree[strings.ToUpper(name)] = diffEntry{name: name, info: info}
+		return nil
+	})
+	return tree, err
+}
+
+// diffChanges returns the properties which differ between the entries of both images.
+func diffChanges(filesystems [2]*gofat.Fs, a, b diffEntry, content bool, ignoreTimes bool) ([]string, error) {
+	var changes []string
+	if a.name != b.name {
+		changes = append(changes, "name")
+	}
+
+	if a.info.IsDir() != b.info.IsDir() {
+		return append(changes, "type"), nil
+	}
+
+	if !a.info.IsDir() && a.info.Size() != b.info.Size() {
+		changes = append(changes, fmt.Sprintf("size %d -> %d", a.info.Size(), b.info.Size()))
+	}
+	if !ignoreTimes && !a.info.ModTime().Equal(b.info.ModTime()) {
+		changes = append(changes, "time")
+	}
+	if a.info.Mode() != b.info.Mode() {
+		changes = append(changes, "mode")
+	}
+
+	if content && !a.info.IsDir() && a.info.Size() == b.info.Size() {
+		hashA, err := fileHash(filesystems[0], a.name)
+		if err != nil {
+			return nil, err
+		}
+		hashB, err := fileHash(filesystems[1], b.name)
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(hashA, hashB) {
+			changes = append(changes, "content")
+		}
+	}
+
+	return changes, nil
+}
+
+// fileHash returns the SHA-256 hash of a file of the image. The file is streamed, so it is never loaded completely.
+func fileHash(fs *gofat.Fs, name string) ([]byte, error) {
+	file, err := fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return nil, err
+	}
+	return hash.Sum(nil), nil
+}
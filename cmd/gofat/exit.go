@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"io"
+	"os"
+	"syscall"
+
+	"github.com/aligator/gofat"
+)
+
+// The exit codes of all commands. Scripts branch on them, so they must never change.
+const (
+	exitOK = 0
+	// exitFailure is used for failures which fit no other class, e.g. files which do not match a manifest.
+	exitFailure = 1
+	// exitNotFound is used if an image or a path does not exist.
+	exitNotFound = 2
+	// exitCorrupt is used if the filesystem is invalid or inconsistent.
+	exitCorrupt = 3
+	// exitUnsupported is used for operations FAT or GoFAT cannot do, e.g. symlinks.
+	exitUnsupported = 4
+	// exitIO is used if reading or writing an image or a file of the host failed.
+	exitIO = 5
+	// exitExists is used if a path already exists.
+	exitExists = 6
+	// exitNoSpace is used if the filesystem or a directory is full.
+	exitNoSpace = 7
+	// exitPermission is used if the image or a path may not be accessed or changed, e.g. read only files.
+	exitPermission = 8
+	// exitUsage is used for invalid arguments. It is the EX_USAGE code of sysexits.h.
+	exitUsage = 64
+)
+
+// exitCodes describe the exit codes in the usage.
+var exitCodes = []struct {
+	code        int
+	description string
+}{
+	{code: exitOK, description: "success"},
+	{code: exitFailure, description: "failure of another kind, e.g. a file not matching the manifest"},
+	{code: exitNotFound, description: "the image or a path does not exist"},
+	{code: exitCorrupt, description: "the filesystem is invalid or inconsistent"},
+	{code: exitUnsupported, description: "the operation is not supported by FAT or GoFAT"},
+	{code: exitIO, description: "reading or writing the image or a file of the host failed"},
+	{code: exitExists, description: "a path already exists"},
+	{code: exitNoSpace, description: "the filesystem or a directory is full"},
+	{code: exitPermission, description: "permission denied or read only"},
+	{code: exitUsage, description: "invalid arguments"},
+}
+
+// exitCode classifies the error into one of the exit codes.
+func exitCode(err error) int {
+	// The specific errors are checked first, as the errors of the host are all *os.PathError
+	// (e.g. a missing image).
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.Is(err, os.ErrNotExist):
+		return exitNotFound
+	case errors.Is(err, os.ErrExist):
+		return exitExists
+	case errors.Is(err, os.ErrPermission), errors.Is(err, gofat.ErrReadOnlyFilesystem):
+		return exitPermission
+	case errors.Is(err, gofat.ErrFilesystemFull), errors.Is(err, gofat.ErrDirectoryFull):
+		return exitNoSpace
+	case errors.Is(err, gofat.ErrNotSupported), errors.Is(err, gofat.ErrNoSymlink):
+		return exitUnsupported
+	case errors.Is(err, syscall.EIO), errors.As(err, new(*os.PathError)), errors.As(err, new(*os.SyscallError)):
+		// Failed reads of the image are I/O problems even if they happened while validating the filesystem.
+		return exitIO
+	case errors.Is(err, gofat.ErrInitializeFilesystem), errors.Is(err, gofat.ErrReadFat),
+		errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		// An image which ends too early (even before the boot sector) is truncated, not unreadable.
+		return exitCorrupt
+	default:
+		return exitFailure
+	}
+}
+
+// usageCode returns the exit code for an error of flag.FlagSet.Parse, which already printed the problem and the
+// usage. Requesting the help is no failure.
+func usageCode(err error) int {
+	if errors.Is(err, flag.ErrHelp) {
+		return exitOK
+	}
+	return exitUsage
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/aligator/gofat"
+	"github.com/spf13/afero"
+)
+
+func Test_exitCode(t *testing.T) {
+	tests := []struct {
+		name string
+		err  func(t *testing.T) error
+		want int
+	}{
+		{
+			name: "no error",
+			err:  func(t *testing.T) error { return nil },
+			want: exitOK,
+		},
+		{
+			name: "missing image",
+			err: func(t *testing.T) error {
+				_, err := os.Open(filepath.Join(t.TempDir(), "missing.img"))
+				return err
+			},
+			want: exitNotFound,
+		},
+		{
+			name: "missing path",
+			err: func(t *testing.T) error {
+				_, err := testingFs(t).Stat("missing.txt")
+				return err
+			},
+			want: exitNotFound,
+		},
+		{
+			name: "directory not empty",
+			err: func(t *testing.T) error {
+				err := testingFs(t).Remove("docs")
+				if !errors.Is(err, syscall.ENOTEMPTY) {
+					t.Fatalf("Remove() error = %v, want %v", err, syscall.ENOTEMPTY)
+				}
+				return err
+			},
+			want: exitExists,
+		},
+		{
+			name: "read only filesystem",
+			err: func(t *testing.T) error {
+				image, err := afero.ReadAll(testingImage(t, 1024*1024))
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				// A reader which cannot write opens the filesystem read only.
+				fs, err := gofat.New(bytes.NewReader(image))
+				if err != nil {
+					t.Fatal(err)
+				}
+				return fs.Mkdir("new", 0755)
+			},
+			want: exitPermission,
+		},
+		{
+			name: "filesystem full",
+			err: func(t *testing.T) error {
+				fs, err := gofat.New(testingImage(t, 1024*1024))
+				if err != nil {
+					t.Fatal(err)
+				}
+				return afero.WriteFile(fs, "huge.bin", make([]byte, 2*1024*1024), 0666)
+			},
+			want: exitNoSpace,
+		},
+		{
+			name: "truncated image",
+			err: func(t *testing.T) error {
+				_, err := gofat.New(bytes.NewReader(make([]byte, 100)))
+				return err
+			},
+			want: exitCorrupt,
+		},
+		{
+			name: "failed read of the host",
+			err: func(t *testing.T) error {
+				return &os.PathError{Op: "read", Path: "image.img", Err: syscall.EINVAL}
+			},
+			want: exitIO,
+		},
+		{
+			name: "unsupported operation",
+			err: func(t *testing.T) error {
+				return testingFs(t).SymlinkIfPossible("README.txt", "link")
+			},
+			want: exitUnsupported,
+		},
+		{
+			name: "other error",
+			err:  func(t *testing.T) error { return errors.New("something else") },
+			want: exitFailure,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.err(t)
+			if got := exitCode(err); got != tt.want {
+				t.Errorf("exitCode(%v) = %v, want %v", err, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/aligator/gofat"
+	"github.com/spf13/afero"
+)
+
+// archiveWriter adds the entries of an image to an archive.
+type archiveWriter interface {
+	// add adds the directory or file with the given path. The content of files is read from r.
+	add(name string, info os.FileInfo, r io.Reader) error
+	// Close writes the end of the archive without closing the underlying writer.
+	Close() error
+}
+
+// archiveFormats contains the supported archive formats by name.
+var archiveFormats = map[string]func(w io.Writer) archiveWriter{
+	"tar": newTarArchive,
+	"zip": newZipArchive,
+}
+
+// export streams the whole image or a subtree of it as tar or zip archive to stdout or into a file with -o.
+// The paths inside of the archive are relative to the root of the image, like "tar -C mnt -c path" would create
+// them. The files are copied cluster by cluster, so even big images are never loaded into memory.
+// If the image could not be read or the archive could not be written, the exit code classifies the error.
+func export(args []string) int {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := flags.String("format", "tar", "format of the archive, tar or zip")
+	output := flags.String("o", "", "write the archive into this file instead of stdout")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s export [flags] image [path]\n\nFlags:\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return usageCode(err)
+	}
+
+	if flags.NArg() != 1 && flags.NArg() != 2 {
+		flags.Usage()
+		return exitUsage
+	}
+
+	newArchive, ok := archiveFormats[*format]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown archive format '%v'\n", *format)
+		return exitUsage
+	}
+
+	root := "."
+	if flags.NArg() == 2 {
+		root = path.Clean(strings.TrimPrefix(flags.Arg(1), "/"))
+	}
+
+	file, err := openImageFile(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCode(err)
+	}
+	defer file.Close()
+
+	fs, err := gofat.New(file)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCode(err)
+	}
+
+	if _, err := fs.Stat(root); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCode(err)
+	}
+
+	target := os.Stdout
+	if *output != "" {
+		target, err = os.Create(*output)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitCode(err)
+		}
+		defer target.Close()
+	}
+
+	out := bufio.NewWriterSize(target, 64*1024)
+	if err := exportArchive(fs, root, newArchive(out)); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCode(err)
+	}
+
+	if err := out.Flush(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCode(err)
+	}
+	if *output != "" {
+		if err := target.Close(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitCode(err)
+		}
+	}
+	return exitOK
+}
+
+// exportArchive adds all entries below root (including root itself, except for the image root) to the archive and
+// closes it.
+func exportArchive(fs *gofat.Fs, root string, archive archiveWriter) error {
+	err := afero.Walk(fs, root, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if name == "." {
+			return nil
+		}
+
+		if info.IsDir() {
+			return archive.add(name, info, nil)
+		}
+
+		file, err := fs.Open(name)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		if err := archive.add(name, info, file); err != nil {
+			return fmt.Errorf("%v: %w", name, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return archive.Close()
+}
+
+// tarArchive writes the entries as tar archive. Names which do not fit into the USTAR format (e.g. unicode
+// names) are stored using PAX headers.
+type tarArchive struct {
+	*tar.Writer
+}
+
+func newTarArchive(w io.Writer) archiveWriter {
+	return tarArchive{tar.NewWriter(w)}
+}
+
+func (a tarArchive) add(name string, info os.FileInfo, r io.Reader) error {
+	header, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+
+	header.Name = name
+	if info.IsDir() {
+		header.Name += "/"
+	}
+
+	if err := a.WriteHeader(header); err != nil {
+		return err
+	}
+	if r == nil {
+		return nil
+	}
+
+	_, err = io.Copy(a.Writer, r)
+	return err
+}
+
+// zipArchive writes the entries as zip archive. Zip stores the modification times in the DOS format just like FAT,
+// so the raw timestamps of the entries are copied as they are. Like on FAT, they are local times without a time zone.
+type zipArchive struct {
+	*zip.Writer
+}
+
+func newZipArchive(w io.Writer) archiveWriter {
+	return zipArchive{zip.NewWriter(w)}
+}
+
+func (a zipArchive) add(name string, info os.FileInfo, r io.Reader) error {
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+
+	header.Name = name
+	header.Method = zip.Deflate
+	if info.IsDir() {
+		header.Name += "/"
+		header.Method = zip.Store
+	}
+
+	if fatInfo, ok := info.(gofat.FileInfo); ok {
+		entry := fatInfo.Entry()
+		header.Modified = time.Time{}
+		header.ModifiedDate = entry.WriteDate
+		header.ModifiedTime = entry.WriteTime
+	}
+
+	w, err := a.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	if r == nil {
+		return nil
+	}
+
+	_, err = io.Copy(w, r)
+	return err
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/aligator/gofat"
+	"github.com/spf13/afero"
+)
+
+// checksums contains the supported checksum algorithms by name and the length of their hex representation.
+var checksums = map[string]struct {
+	new       func() hash.Hash
+	hexLength int
+}{
+	"crc32":  {new: func() hash.Hash { return crc32.NewIEEE() }, hexLength: 8},
+	"sha256": {new: sha256.New, hexLength: 64},
+}
+
+// extract copies all files of an image into a directory.
+// The checksums are calculated while copying, so slow media only have to be read once.
+// It exits with exitFailure if a file does not match the manifest. If the image could not be extracted, the exit
+// code classifies the error.
+func extract(args []string) int {
+	flags := flag.NewFlagSet("extract", flag.ContinueOnError)
+	algorithm := flags.String("sum", "", "print the checksum of each file, either crc32 or sha256")
+	manifest := flags.String("verify", "", "verify the files against a manifest with lines like '<checksum>  <path>' "+
+		"as printed by -sum (the algorithm is detected from the length of the checksums if -sum is not set)")
+	showProgress := flags.Bool("progress", false, "show the progress of copying the files on stderr")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s extract [flags] image destination\n\nFlags:\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return usageCode(err)
+	}
+
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return exitUsage
+	}
+
+	var want map[string]string
+	if *manifest != "" {
+		var err error
+		want, err = readManifest(*manifest)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitCode(err)
+		}
+
+		if *algorithm == "" {
+			*algorithm = detectAlgorithm(want)
+		}
+	}
+
+	if _, ok := checksums[*algorithm]; *algorithm != "" && !ok {
+		fmt.Fprintf(os.Stderr, "unknown checksum algorithm '%v'\n", *algorithm)
+		return exitUsage
+	}
+	if *manifest != "" && *algorithm == "" {
+		fmt.Fprintf(os.Stderr, "cannot detect the checksum algorithm of the manifest '%v'\n", *manifest)
+		return exitUsage
+	}
+
+	file, err := openImageFile(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCode(err)
+	}
+	defer file.Close()
+
+	// report is changed for each file, so that the progress of all files is combined.
+	var report func(done, total int64)
+	fs, err := gofat.NewWithOptions(file, gofat.Options{Progress: func(done, total int64) {
+		if report != nil {
+			report(done, total)
+		}
+	}})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCode(err)
+	}
+
+	var progress *progressLine
+	if *showProgress {
+		usage, err := fs.DiskUsage(".")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitCode(err)
+		}
+		progress = newProgressLine(os.Stderr, usage.Size)
+	}
+
+	destination := flags.Arg(1)
+	code := exitOK
+	extracted := make(map[string]bool)
+	err = afero.Walk(fs, ".", func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(destination, filepath.FromSlash(name))
+		if info.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+
+		if progress != nil {
+			report = progress.report(name)
+		}
+		sum, err := extractFile(fs, name, target, *algorithm)
+		if err != nil {
+			return err
+		}
+		extracted[name] = true
+
+		switch {
+		case want != nil:
+			if expected, ok := want[name]; !ok {
+				fmt.Fprintf(os.Stderr, "%v: not in the manifest\n", name)
+				code = exitFailure
+			} else if !strings.EqualFold(expected, sum) {
+				fmt.Fprintf(os.Stderr, "%v: checksum %v does not match %v\n", name, sum, expected)
+				code = exitFailure
+			}
+		case sum != "":
+			fmt.Printf("%v  %v\n", sum, name)
+		}
+		return nil
+	})
+	if progress != nil {
+		progress.finish()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCode(err)
+	}
+
+	var missing []string
+	for name := range want {
+		if !extracted[name] {
+			missing = append(missing, name)
+		}
+	}
+	sort.Strings(missing)
+	for _, name := range missing {
+		fmt.Fprintf(os.Stderr, "%v: missing in the image\n", name)
+		code = exitFailure
+	}
+
+	return code
+}
+
+// extractFile copies the file from the image to the target and returns its checksum.
+// The checksum is empty if no algorithm is given.
+func extractFile(fs afero.Fs, name string, target string, algorithm string) (string, error) {
+	in, err := fs.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+
+	out, err := os.Create(target)
+	if err != nil {
+		return "", err
+	}
+
+	var writer io.Writer = out
+	var checksum hash.Hash
+	if algorithm != "" {
+		checksum = checksums[algorithm].new()
+		writer = io.MultiWriter(out, checksum)
+	}
+
+	_, err = io.Copy(writer, in)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if checksum == nil {
+		return "", nil
+	}
+	return hex.EncodeToString(checksum.Sum(nil)), nil
+}
+
+// readManifest reads the checksums by path from a file with lines like '<checksum>  <path>'.
+// Empty lines are ignored.
+func readManifest(name string) (map[string]string, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	manifest := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		fields := strings.SplitN(text, " ", 2)
+		if len(fields) != 2 || strings.TrimSpace(fields[1]) == "" {
+			return nil, fmt.Errorf("%v:%d: invalid line '%v'", name, line, text)
+		}
+
+		// Accept the paths with or without leading slash, as the image root is always the base.
+		manifest[path.Clean(strings.TrimLeft(strings.TrimSpace(fields[1]), "/"))] = fields[0]
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(manifest) == 0 {
+		return nil, errors.New("the manifest is empty")
+	}
+
+	return manifest, nil
+}
+
+// detectAlgorithm returns the checksum algorithm matching the length of all checksums of the manifest.
+// It returns an empty string if there is none.
+func detectAlgorithm(manifest map[string]string) string {
+	for name, checksum := range checksums {
+		matches := true
+		for _, sum := range manifest {
+			if len(sum) != checksum.hexLength {
+				matches = false
+				break
+			}
+		}
+
+		if matches {
+			return name
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/aligator/gofat"
+	"github.com/spf13/afero"
+)
+
+// testingImageFile writes a small FAT16 image with the files of testingContent into a temporary directory
+// and returns its path.
+func testingImageFile(t *testing.T) string {
+	name := filepath.Join(t.TempDir(), "image.img")
+	file, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	if err := gofat.Format(file, gofat.FormatOptions{Size: 16 * 1024 * 1024}); err != nil {
+		t.Fatal(err)
+	}
+	fs, err := gofat.New(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Mkdir("docs", 0755); err != nil {
+		t.Fatal(err)
+	}
+	for path, data := range testingContent {
+		if err := afero.WriteFile(fs, path, data, 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return name
+}
+
+// captureOutput runs the command and returns its exit code and everything it printed to stdout and stderr.
+func captureOutput(t *testing.T, command func() int) (int, string, string) {
+	stdout, stderr := os.Stdout, os.Stderr
+	defer func() { os.Stdout, os.Stderr = stdout, stderr }()
+
+	var outputs [2]bytes.Buffer
+	var done [2]chan struct{}
+	var writers [2]*os.File
+	for i := range outputs {
+		r, w, err := os.Pipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		writers[i] = w
+		done[i] = make(chan struct{})
+		go func(i int) {
+			_, _ = io.Copy(&outputs[i], r)
+			_ = r.Close()
+			close(done[i])
+		}(i)
+	}
+	os.Stdout, os.Stderr = writers[0], writers[1]
+
+	code := command()
+	for i := range writers {
+		_ = writers[i].Close()
+		<-done[i]
+	}
+	return code, outputs[0].String(), outputs[1].String()
+}
+
+func Test_extract(t *testing.T) {
+	sha := func(data []byte) string {
+		sum := sha256.Sum256(data)
+		return hex.EncodeToString(sum[:])
+	}
+	crc := func(data []byte) string {
+		sum := crc32.NewIEEE()
+		sum.Write(data)
+		return hex.EncodeToString(sum.Sum(nil))
+	}
+
+	tests := []struct {
+		name       string
+		args       []string
+		manifest   string
+		want       int
+		wantStdout []string
+		wantStderr []string
+	}{
+		{
+			name: "inline checksums",
+			args: []string{"-sum", "crc32"},
+			want: exitOK,
+			wantStdout: []string{
+				crc(testingContent["README.txt"]) + "  README.txt",
+				crc(testingContent["docs/big.bin"]) + "  docs/big.bin",
+			},
+		},
+		{
+			name: "matching manifest",
+			manifest: sha(testingContent["README.txt"]) + "  README.txt\n\n" +
+				strings.ToUpper(sha(testingContent["docs/big.bin"])) + "  /docs/big.bin\n",
+			want: exitOK,
+		},
+		{
+			name: "mismatching manifest",
+			manifest: sha([]byte("other\n")) + "  README.txt\n" +
+				sha(testingContent["docs/big.bin"]) + "  docs/big.bin\n" +
+				sha(nil) + "  missing.txt\n",
+			want: exitFailure,
+			wantStderr: []string{
+				"README.txt: checksum " + sha(testingContent["README.txt"]) + " does not match " + sha([]byte("other\n")),
+				"missing.txt: missing in the image",
+			},
+		},
+		{
+			name:       "file not in the manifest",
+			manifest:   crc(testingContent["README.txt"]) + "  README.txt\n",
+			want:       exitFailure,
+			wantStderr: []string{"docs/big.bin: not in the manifest"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			image := testingImageFile(t)
+			destination := filepath.Join(t.TempDir(), "out")
+
+			args := tt.args
+			if tt.manifest != "" {
+				manifest := filepath.Join(t.TempDir(), "manifest")
+				if err := os.WriteFile(manifest, []byte(tt.manifest), 0644); err != nil {
+					t.Fatal(err)
+				}
+				args = append(args, "-verify", manifest)
+			}
+			args = append(args, image, destination)
+
+			code, stdout, stderr := captureOutput(t, func() int { return extract(args) })
+			if code != tt.want {
+				t.Errorf("extract() = %v, want %v (stderr: %v)", code, tt.want, stderr)
+			}
+			if got := outputLines(stdout); strings.Join(got, "\n") != strings.Join(tt.wantStdout, "\n") {
+				t.Errorf("extract() printed %q, want %q", got, tt.wantStdout)
+			}
+			if got := outputLines(stderr); strings.Join(got, "\n") != strings.Join(tt.wantStderr, "\n") {
+				t.Errorf("extract() printed %q to stderr, want %q", got, tt.wantStderr)
+			}
+
+			// The files are extracted even if they do not match the manifest.
+			for path, want := range testingContent {
+				got, err := os.ReadFile(filepath.Join(destination, filepath.FromSlash(path)))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(got, want) {
+					t.Errorf("%v contains %v bytes, want %v bytes", path, len(got), len(want))
+				}
+			}
+		})
+	}
+}
+
+// outputLines returns the non-empty lines of the output sorted.
+func outputLines(output string) []string {
+	var lines []string
+	for _, line := range strings.Split(output, "\n") {
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	sort.Strings(lines)
+	return lines
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/aligator/gofat"
+)
+
+// fatDumpBatch is the count of FAT entries read at once, so huge FATs are not loaded completely into memory.
+const fatDumpBatch = 4096
+
+// fatdump prints the entries of the first FAT with their interpretation like "chain→5", "EOF", "bad" or "free",
+// e.g. to follow broken cluster chains. Without -from the dump starts at the first data cluster 2.
+// If the image could not be read, the exit code classifies the error.
+func fatdump(args []string) int {
+	flags := flag.NewFlagSet("fatdump", flag.ContinueOnError)
+	from := flags.Uint("from", 2, "first cluster to dump (0 and 1 are the reserved entries)")
+	count := flags.Uint("count", 0, "count of entries to dump (all up to the last cluster if 0)")
+	used := flags.Bool("used", false, "skip free entries")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s fatdump [flags] image\n\nFlags:\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return usageCode(err)
+	}
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return exitUsage
+	}
+
+	file, err := openImageFile(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCode(err)
+	}
+	defer file.Close()
+
+	fs, err := gofat.New(file)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCode(err)
+	}
+
+	info := fs.Info()
+	end := uint64(info.ClusterCount) + 2
+	if uint64(*from) >= end {
+		fmt.Fprintf(os.Stderr, "the clusters have to be between 0 and %d\n", end-1)
+		return exitUsage
+	}
+	if *count == 0 || uint64(*from)+uint64(*count) > end {
+		*count = uint(end - uint64(*from))
+	}
+
+	valueFormat := "0x%08x"
+	switch info.FSType {
+	case gofat.FAT12:
+		valueFormat = "0x%03x"
+	case gofat.FAT16:
+		valueFormat = "0x%04x"
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	for first := uint32(*from); first < uint32(*from)+uint32(*count); first += fatDumpBatch {
+		batch := uint32(*from) + uint32(*count) - first
+		if batch > fatDumpBatch {
+			batch = fatDumpBatch
+		}
+
+		entries, err := fs.FatEntries(first, batch)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitCode(err)
+		}
+
+		for _, entry := range entries {
+			if *used && entry.Kind == gofat.FatFree {
+				continue
+			}
+			fmt.Fprintf(out, "%10d  "+valueFormat+"  %v\n", entry.Cluster, entry.Value, entry)
+		}
+	}
+
+	if err := out.Flush(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCode(err)
+	}
+	return exitOK
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/aligator/gofat"
+)
+
+// result is the outcome of checking one image.
+type result struct {
+	Image  string        `json:"image"`
+	Report *gofat.Report `json:"report,omitempty"`
+	Error  string        `json:"error,omitempty"`
+
+	// err is the error the image could not be checked with, which decides the exit code.
+	err error
+}
+
+// fsck checks the given images.
+// It exits with exitCorrupt if problems were found. If an image could not be checked at all, the exit code
+// classifies the error.
+func fsck(args []string) int {
+	flags := flag.NewFlagSet("fsck", flag.ContinueOnError)
+	asJSON := flags.Bool("json", false, "print the reports as JSON")
+	pattern := flags.String("glob", "", "check all images matching the pattern (e.g. 'images/*.img')")
+	jobs := flags.Int("jobs", runtime.NumCPU(), "count of images checked concurrently")
+	showProgress := flags.Bool("progress", false, "show the progress of reading the FATs on stderr")
+	quiet := flags.Bool("q", false, "print nothing and only report the result by the exit code")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s fsck [flags] [image...]\n\nFlags:\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return usageCode(err)
+	}
+
+	images := flags.Args()
+	if *pattern != "" {
+		matches, err := filepath.Glob(*pattern)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitCode(err)
+		}
+		images = append(images, matches...)
+	}
+
+	if len(images) == 0 {
+		flags.Usage()
+		return exitUsage
+	}
+
+	var progress *progressLine
+	if *showProgress {
+		progress = newProgressLine(os.Stderr, 0)
+	}
+
+	results := checkImages(images, *jobs, progress)
+	if progress != nil {
+		progress.finish()
+	}
+
+	var err error
+	switch {
+	case *quiet:
+	case *asJSON && len(results) == 1 && results[0].Report != nil:
+		err = results[0].Report.WriteJSON(os.Stdout)
+	case *asJSON:
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(results)
+	case len(results) == 1:
+		printResult(results[0])
+	default:
+		err = printSummary(results)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCode(err)
+	}
+
+	code := exitOK
+	for _, r := range results {
+		if r.Report == nil {
+			return exitCode(r.err)
+		}
+		if !r.Report.OK() {
+			code = exitCorrupt
+		}
+	}
+	return code
+}
+
+// checkImages checks all images using the given count of concurrent jobs.
+// The results have the same order as the images. The progress may be nil.
+func checkImages(images []string, jobs int, progress *progressLine) []result {
+	if jobs < 1 {
+		jobs = 1
+	}
+
+	results := make([]result, len(images))
+	indexes := make(chan int)
+
+	var wg sync.WaitGroup
+	for i := 0; i < jobs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range indexes {
+				var onProgress func(done, total int64)
+				if progress != nil {
+					onProgress = progress.report(images[index])
+				}
+				results[index] = checkImage(images[index], onProgress)
+			}
+		}()
+	}
+
+	for i := range images {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	return results
+}
+
+// checkImage opens the image read only and checks it. The progress is passed to onProgress if it is not nil.
+func checkImage(path string, onProgress func(done, total int64)) result {
+	file, err := openImageFile(path)
+	if err != nil {
+		return result{Image: path, Error: err.Error(), err: err}
+	}
+	defer file.Close()
+
+	fs, err := gofat.NewWithOptions(file, gofat.Options{SkipChecks: true, Progress: onProgress})
+	if err != nil {
+		return result{Image: path, Error: err.Error(), err: err}
+	}
+
+	report, err := fs.Check()
+	if err != nil {
+		return result{Image: path, Error: err.Error(), err: err}
+	}
+
+	return result{Image: path, Report: &report}
+}
+
+// printResult prints the result of one image in a human readable form.
+func printResult(r result) {
+	if r.Report == nil {
+		fmt.Fprintln(os.Stderr, r.Error)
+		return
+	}
+
+	report := r.Report
+	fmt.Printf("%v volume '%v': %d files, %d directories, %d/%d clusters used\n",
+		report.FSType, report.Label, report.Files, report.Dirs, report.UsedClusters, report.ClusterCount)
+
+	for _, finding := range report.Findings {
+		location := finding.Path
+		if location == "" {
+			location = "-"
+		}
+		fmt.Printf("%v: %v: %v (fix: %v)\n", finding.Kind, location, finding.Message, finding.Fix)
+		if len(finding.Clusters) > 0 {
+			fmt.Printf("\tclusters: %v\n", finding.Clusters)
+		}
+	}
+
+	if report.OK() {
+		fmt.Println("no problems found")
+	} else {
+		fmt.Printf("%d problems found\n", len(report.Findings))
+	}
+}
+
+// printSummary prints one line per image followed by the totals.
+func printSummary(results []result) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "IMAGE\tTYPE\tFILES\tDIRS\tUSED\tPROBLEMS\tSTATUS")
+
+	var ok, broken, failed int
+	for _, r := range results {
+		if r.Report == nil {
+			failed++
+			fmt.Fprintf(w, "%v\t-\t-\t-\t-\t-\terror: %v\n", r.Image, firstLine(r.Error))
+			continue
+		}
+
+		status := "ok"
+		if r.Report.OK() {
+			ok++
+		} else {
+			broken++
+			status = "problems"
+		}
+
+		fmt.Fprintf(w, "%v\t%v\t%d\t%d\t%d/%d\t%d\t%v\n", r.Image, r.Report.FSType, r.Report.Files, r.Report.Dirs,
+			r.Report.UsedClusters, r.Report.ClusterCount, len(r.Report.Findings), status)
+	}
+
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Printf("\n%d images checked: %d ok, %d with problems, %d failed\n", len(results), ok, broken, failed)
+	return nil
+}
+
+// firstLine returns the message up to the first line break, as checkpoint errors span multiple lines.
+func firstLine(message string) string {
+	for i, c := range message {
+		if c == '\n' {
+			return message[:i]
+		}
+	}
+	return message
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/aligator/gofat"
+)
+
+// hexdump prints sectors or clusters of an image like "hexdump -C" with the offsets inside of the image.
+// Sectors are read directly from the image, so they can even be dumped if the boot sector is corrupt.
+// If the image could not be read, the exit code classifies the error.
+func hexdump(args []string) int {
+	flags := flag.NewFlagSet("hexdump", flag.ContinueOnError)
+	sector := flags.Int64("sector", -1, "dump the sector with this number")
+	cluster := flags.Int64("cluster", -1, "dump the data cluster with this number (starting at 2)")
+	count := flags.Int64("count", 1, "count of sectors or clusters to dump")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s hexdump (-sector n | -cluster n) [flags] image\n\nFlags:\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return usageCode(err)
+	}
+
+	if flags.NArg() != 1 || (*sector < 0) == (*cluster < 0) || *count < 1 {
+		flags.Usage()
+		return exitUsage
+	}
+
+	file, err := openImageFile(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCode(err)
+	}
+	defer file.Close()
+
+	var offset, size int64
+	if *sector >= 0 {
+		bytesPerSector, err := sectorSize(file)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitCode(err)
+		}
+
+		offset = *sector * bytesPerSector
+		size = *count * bytesPerSector
+	} else {
+		fs, err := gofat.New(file)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitCode(err)
+		}
+
+		info := fs.Info()
+		if *cluster < 2 || *cluster+*count > int64(info.ClusterCount)+2 {
+			fmt.Fprintf(os.Stderr, "the clusters have to be between 2 and %d\n", info.ClusterCount+1)
+			return exitUsage
+		}
+
+		clusterSize := int64(info.SectorsPerCluster) * int64(info.BytesPerSector)
+		offset = int64(info.FirstDataSector)*int64(info.BytesPerSector) + (*cluster-2)*clusterSize
+		size = *count * clusterSize
+	}
+
+	data := make([]byte, size)
+	n, err := file.ReadAt(data, offset)
+	if err != nil && err != io.EOF {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCode(err)
+	}
+	if n == 0 {
+		fmt.Fprintf(os.Stderr, "offset %d is behind the end of the image\n", offset)
+		return exitUsage
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	writeHexdump(out, data[:n], offset)
+	if err := out.Flush(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCode(err)
+	}
+	return exitOK
+}
+
+// sectorSize returns the bytes per sector stored in the boot sector. If it is invalid, 512 is used.
+func sectorSize(file io.ReaderAt) (int64, error) {
+	var value [2]byte
+	if _, err := file.ReadAt(value[:], 11); err != nil {
+		return 0, err
+	}
+
+	switch size := binary.LittleEndian.Uint16(value[:]); size {
+	case 512, 1024, 2048, 4096:
+		return int64(size), nil
+	default:
+		return 512, nil
+	}
+}
+
+// writeHexdump writes the data in the format of "hexdump -C" starting at the given offset.
+// Like there, repeated lines are replaced by a single "*".
+func writeHexdump(w io.Writer, data []byte, offset int64) {
+	var previous []byte
+	repeated := false
+	for i := 0; i < len(data); i += 16 {
+		line := data[i:]
+		if len(line) > 16 {
+			line = line[:16]
+		}
+
+		if previous != nil && len(line) == 16 && bytes.Equal(line, previous) {
+			if !repeated {
+				fmt.Fprintln(w, "*")
+				repeated = true
+			}
+			continue
+		}
+		previous = line
+		repeated = false
+
+		fmt.Fprintf(w, "%08x ", offset+int64(i))
+		for j := 0; j < 16; j++ {
+			if j == 8 {
+				fmt.Fprint(w, " ")
+			}
+			if j < len(line) {
+				fmt.Fprintf(w, " %02x", line[j])
+			} else {
+				fmt.Fprint(w, "   ")
+			}
+		}
+
+		printable := make([]byte, len(line))
+		for j, c := range line {
+			printable[j] = '.'
+			if c >= 0x20 && c < 0x7F {
+				printable[j] = c
+			}
+		}
+		fmt.Fprintf(w, "  |%s|\n", printable)
+	}
+	fmt.Fprintf(w, "%08x\n", offset+int64(len(data)))
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/aligator/gofat"
+)
+
+// importTree copies the content of a host directory recursively into the root or a directory of an image, e.g. to
+// build boot media from a staging directory. Unlike put, the host directory itself is not created in the image.
+// The modification times are always kept and names which do not fit into 8.3 get generated short names.
+// If the tree could not be copied, the exit code classifies the error.
+func importTree(args []string) int {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s import hostdir image[:dir]\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return usageCode(err)
+	}
+
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return exitUsage
+	}
+
+	source := flags.Arg(0)
+	info, err := os.Stat(source)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCode(err)
+	}
+	if !info.IsDir() {
+		fmt.Fprintf(os.Stderr, "%v: not a directory\n", source)
+		return exitUsage
+	}
+
+	// The directory is optional, so only split at the last ':' if the whole argument is no existing image.
+	image, dir := flags.Arg(1), ""
+	if _, err := os.Stat(image); err != nil {
+		if separator := strings.LastIndex(image, ":"); separator >= 0 {
+			image, dir = image[:separator], image[separator+1:]
+		}
+	}
+
+	dir = path.Clean("/" + dir)[1:]
+	if dir == "" {
+		dir = "."
+	}
+
+	file, err := os.OpenFile(image, os.O_RDWR, 0)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCode(err)
+	}
+	defer file.Close()
+
+	fs, err := gofat.New(file)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCode(err)
+	}
+
+	if err := putEntry(fs, source, dir, true); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCode(err)
+	}
+
+	return exitOK
+}
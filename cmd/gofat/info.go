@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/aligator/gofat"
+)
+
+// imageInfo is the geometry of an image as printed by info.
+type imageInfo struct {
+	Type              gofat.FATType `json:"type"`
+	Label             string        `json:"label"`
+	Serial            uint32        `json:"serial"`
+	BytesPerSector    uint16        `json:"bytesPerSector"`
+	SectorsPerCluster uint8         `json:"sectorsPerCluster"`
+	FatCount          uint8         `json:"fatCount"`
+	FatSize           uint32        `json:"fatSize"`
+	TotalClusters     uint32        `json:"totalClusters"`
+	FreeClusters      uint32        `json:"freeClusters"`
+	RootCluster       uint32        `json:"rootCluster,omitempty"`
+}
+
+// info prints the FAT type, the label, the serial number and the geometry of an image.
+// If the image could not be read, the exit code classifies the error.
+func info(args []string) int {
+	flags := flag.NewFlagSet("info", flag.ContinueOnError)
+	asJSON := flags.Bool("json", false, "print the information as JSON")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s info [flags] image\n\nFlags:\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return usageCode(err)
+	}
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return exitUsage
+	}
+
+	file, err := openImageFile(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCode(err)
+	}
+	defer file.Close()
+
+	fs, err := gofat.New(file)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCode(err)
+	}
+
+	free, err := fs.FreeClusters()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCode(err)
+	}
+
+	geometry := fs.Info()
+	result := imageInfo{
+		Type:              fs.FSType(),
+		Label:             fs.Label(),
+		Serial:            fs.VolumeID(),
+		BytesPerSector:    geometry.BytesPerSector,
+		SectorsPerCluster: geometry.SectorsPerCluster,
+		FatCount:          geometry.FatCount,
+		FatSize:           geometry.FatSize,
+		TotalClusters:     geometry.ClusterCount,
+		FreeClusters:      free,
+		RootCluster:       fs.RootCluster(),
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(result)
+	} else {
+		err = printInfo(result)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCode(err)
+	}
+	return exitOK
+}
+
+// printInfo prints the information in a human readable form.
+func printInfo(info imageInfo) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Type:\t%v\n", info.Type)
+	fmt.Fprintf(w, "Label:\t%v\n", info.Label)
+	fmt.Fprintf(w, "Serial:\t%04X-%04X\n", info.Serial>>16, info.Serial&0xFFFF)
+	fmt.Fprintf(w, "Bytes per sector:\t%d\n", info.BytesPerSector)
+	fmt.Fprintf(w, "Sectors per cluster:\t%d\n", info.SectorsPerCluster)
+	fmt.Fprintf(w, "FATs:\t%d\n", info.FatCount)
+	fmt.Fprintf(w, "FAT size:\t%d sectors\n", info.FatSize)
+	fmt.Fprintf(w, "Total clusters:\t%d\n", info.TotalClusters)
+	fmt.Fprintf(w, "Free clusters:\t%d\n", info.FreeClusters)
+	if info.RootCluster != 0 {
+		fmt.Fprintf(w, "Root cluster:\t%d\n", info.RootCluster)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/aligator/gofat"
+)
+
+// label prints the volume label of an image or changes it if a new label is given.
+// An empty new label results in "NO NAME".
+// If the label could not be read or changed, the exit code classifies the error.
+func label(args []string) int {
+	flags := flag.NewFlagSet("label", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s label image [newlabel]\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return usageCode(err)
+	}
+
+	if flags.NArg() != 1 && flags.NArg() != 2 {
+		flags.Usage()
+		return exitUsage
+	}
+
+	mode := os.O_RDONLY
+	if flags.NArg() == 2 {
+		mode = os.O_RDWR
+	}
+
+	file, err := os.OpenFile(flags.Arg(0), mode, 0)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCode(err)
+	}
+	defer file.Close()
+
+	fs, err := gofat.New(file)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCode(err)
+	}
+
+	if flags.NArg() == 2 {
+		if err := fs.SetLabel(flags.Arg(1)); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitCode(err)
+		}
+	}
+
+	fmt.Println(fs.Label())
+	return exitOK
+}
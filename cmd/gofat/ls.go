@@ -0,0 +1,132 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/aligator/gofat"
+)
+
+// ls lists a directory of an image in the order of its entries, or a single file.
+// With -l it prints the attributes, the size, the modification time and the short name in front of each name.
+// With -mdir the listing matches the output of mdir from mtools, so scripts comparing such listings keep working.
+// If the image or the path could not be read, the exit code classifies the error.
+func ls(args []string) int {
+	flags := flag.NewFlagSet("ls", flag.ContinueOnError)
+	long := flags.Bool("l", false, "print the attributes (DRHSA), size, modification time and short name of each entry")
+	mdir := flags.Bool("mdir", false, "print the listing in the format of mdir from mtools")
+	all := flags.Bool("a", false, "also list hidden entries (only with -mdir)")
+	recursive := flags.Bool("s", false, "also list all subdirectories (only with -mdir)")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s ls [flags] image [path]\n\nFlags:\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return usageCode(err)
+	}
+
+	if flags.NArg() != 1 && flags.NArg() != 2 {
+		flags.Usage()
+		return exitUsage
+	}
+
+	name := "."
+	if flags.NArg() == 2 {
+		name = strings.TrimPrefix(path.Clean("/"+flags.Arg(1)), "/")
+		if name == "" {
+			name = "."
+		}
+	}
+
+	file, err := openImageFile(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCode(err)
+	}
+	defer file.Close()
+
+	fs, err := gofat.New(file)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCode(err)
+	}
+
+	if *mdir {
+		if err := fs.WriteMdir(os.Stdout, name, gofat.MdirOptions{All: *all, Recursive: *recursive}); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitCode(err)
+		}
+		return exitOK
+	}
+
+	info, err := fs.Stat(name)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCode(err)
+	}
+
+	entries := []os.FileInfo{info}
+	if info.IsDir() {
+		dir, err := fs.Open(name)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitCode(err)
+		}
+		entries, err = dir.Readdir(-1)
+		_ = dir.Close()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitCode(err)
+		}
+	}
+
+	for _, entry := range entries {
+		if *long {
+			fmt.Println(lsLong(entry))
+		} else {
+			fmt.Println(entry.Name())
+		}
+	}
+	return exitOK
+}
+
+// lsLong formats an entry like "D---A  <DIR>  2021-01-20 21:59:42  DONOTE~1     DoNotEdit_tests".
+func lsLong(info os.FileInfo) string {
+	var attributes byte
+	shortName := info.Name()
+	if fatInfo, ok := info.(gofat.FileInfo); ok {
+		attributes = fatInfo.Entry().Attribute
+		shortName = fatInfo.Entry().ShortName()
+	}
+
+	flags := []byte("-----")
+	for i, attribute := range []struct {
+		flag byte
+		char byte
+	}{
+		{gofat.AttrDirectory, 'D'},
+		{gofat.AttrReadOnly, 'R'},
+		{gofat.AttrHidden, 'H'},
+		{gofat.AttrSystem, 'S'},
+		{gofat.AttrArchive, 'A'},
+	} {
+		if attributes&attribute.flag != 0 {
+			flags[i] = attribute.char
+		}
+	}
+
+	size := fmt.Sprint(info.Size())
+	if info.IsDir() {
+		size = "<DIR>"
+	}
+
+	modTime := "-"
+	if !info.ModTime().IsZero() {
+		modTime = info.ModTime().Format("2006-01-02 15:04:05")
+	}
+
+	return fmt.Sprintf("%s %10s  %-19s  %-12s %s", flags, size, modTime, shortName, info.Name())
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+// command is a subcommand of gofat.
+type command struct {
+	name        string
+	description string
+	run         func(args []string) int
+	// args tells the shell completion how to complete the arguments.
+	args argStyle
+}
+
+var commands = []command{
+	{name: "fsck", description: "check images for inconsistencies", run: fsck},
+	{name: "verify", description: "read all files of an image and print their SHA-256 digests", run: verify},
+	{name: "info", description: "print the type, label and geometry of an image", run: info},
+	{name: "stats", description: "summarize the space used by each file extension", run: stats, args: imageArgs},
+	{name: "ls", description: "list a directory of an image", run: ls, args: imageArgs},
+	{name: "tree", description: "render the directory hierarchy of an image", run: tree, args: imageArgs},
+	{name: "diff", description: "compare the files and directories of two images", run: diff},
+	{name: "shell", description: "explore an image interactively with cd, ls, cat, get and put", run: interactiveShell},
+	{name: "cat", description: "stream files of an image to stdout", run: cat, args: imageArgs},
+	{name: "cp", description: "copy files and directories out of images", run: cp, args: imagePathArgs},
+	{name: "put", description: "copy files and directories of the host into an image", run: put, args: imagePathArgs},
+	{name: "import", description: "copy the content of a host directory into an image with its times", run: importTree},
+	{name: "rm", description: "remove files and directories from an image", run: rm, args: imagePathArgs},
+	{name: "mkdir", description: "create directories in an image", run: mkdir, args: imagePathArgs},
+	{name: "mv", description: "rename or move files and directories inside an image", run: mv, args: imagePathArgs},
+	{name: "undelete", description: "list deleted entries of an image and restore them", run: undelete},
+	{name: "extract", description: "copy all files of an image into a directory", run: extract},
+	{name: "export", description: "stream an image or a subtree of it as tar or zip archive", run: export, args: imageArgs},
+	{name: "map", description: "render the allocation map and cluster chains as DOT or HTML", run: clusterMap, args: imageArgs},
+	{name: "hexdump", description: "dump raw sectors or clusters of an image", run: hexdump},
+	{name: "fatdump", description: "print the FAT entries of an image with their meaning", run: fatdump},
+	{name: "mkfs", description: "format an image with a new FAT filesystem", run: mkfs},
+	{name: "label", description: "print or change the volume label of an image", run: label},
+	{name: "apply", description: "populate an image as described by a spec file", run: apply},
+	{name: "webdav", description: "serve an image read-only over WebDAV", run: webdavCommand},
+	{name: "nbd", description: "serve an image read-only as network block device", run: nbd},
+	{name: "9p", description: "serve an image read-only over 9P", run: ninep},
+	{name: "sftp", description: "serve an image read-only over SFTP on stdin and stdout", run: sftp},
+	{name: "completion", description: "print the shell completion script for bash, zsh or fish", run: completion, args: shellArgs},
+}
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s <command> [arguments]\n\nCommands:\n", os.Args[0])
+	for _, cmd := range commands {
+		fmt.Fprintf(flag.CommandLine.Output(), "  %-10s %s\n", cmd.name, cmd.description)
+	}
+
+	fmt.Fprintf(flag.CommandLine.Output(), "\nExit codes:\n")
+	for _, code := range exitCodes {
+		fmt.Fprintf(flag.CommandLine.Output(), "  %-10d %s\n", code.code, code.description)
+	}
+}
+
+// main is the gofat command line tool to work with FAT images.
+func main() {
+	flag.CommandLine.Init(os.Args[0], flag.ContinueOnError)
+	flag.Usage = usage
+	if err := flag.CommandLine.Parse(os.Args[1:]); err != nil {
+		os.Exit(usageCode(err))
+	}
+
+	if flag.NArg() < 1 {
+		usage()
+		os.Exit(exitUsage)
+	}
+
+	// The completion scripts call the hidden __complete command, which is no part of the commands as it uses them.
+	if flag.Arg(0) == completeCommand {
+		os.Exit(complete(flag.Args()[1:]))
+	}
+
+	for _, cmd := range commands {
+		if cmd.name == flag.Arg(0) {
+			os.Exit(cmd.run(flag.Args()[1:]))
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "unknown command '%v'\n", flag.Arg(0))
+	usage()
+	os.Exit(exitUsage)
+}
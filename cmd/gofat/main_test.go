@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/aligator/gofat"
+	"github.com/spf13/afero"
+)
+
+// testingContent is the content of the files created by testingFs.
+var testingContent = map[string][]byte{
+	"README.txt":   []byte("hello gofat\n"),
+	"docs/big.bin": bytes.Repeat([]byte("0123456789abcdef"), 1000),
+}
+
+// testingFs formats a small in-memory FAT16 image with the files of testingContent.
+func testingFs(t testing.TB) *gofat.Fs {
+	image, err := afero.NewMemMapFs().Create("image")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := gofat.Format(image, gofat.FormatOptions{Size: 16 * 1024 * 1024, Label: "TESTING"}); err != nil {
+		t.Fatal(err)
+	}
+
+	fs, err := gofat.New(image)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Mkdir("docs", 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range testingContent {
+		if err := afero.WriteFile(fs, name, data, 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return fs
+}
+
+// testingImage formats an empty in-memory image with the given size.
+func testingImage(t testing.TB, size int64) afero.File {
+	image, err := afero.NewMemMapFs().Create("image")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := gofat.Format(image, gofat.FormatOptions{Size: size}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := image.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	return image
+}
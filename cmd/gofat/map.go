@@ -0,0 +1,319 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/aligator/gofat"
+	"github.com/spf13/afero"
+)
+
+// maxCells is the maximum count of cells in the HTML heatmap. Bigger images combine several clusters into one cell.
+const maxCells = 4096
+
+// fileColors are used to highlight the chains of the selected files in the HTML heatmap.
+var fileColors = []template.CSS{"#e6194b", "#3cb44b", "#4363d8", "#f58231", "#911eb4", "#42d4f4", "#f032e6", "#9a6324"}
+
+// run is a part of a cluster chain with consecutive clusters.
+type run struct {
+	first uint32
+	last  uint32
+}
+
+// String returns the cluster range of the run.
+func (r run) String() string {
+	if r.first == r.last {
+		return fmt.Sprint(r.first)
+	}
+	return fmt.Sprintf("%d-%d", r.first, r.last)
+}
+
+// chain is the cluster chain of one file.
+type chain struct {
+	path     string
+	clusters []uint32
+}
+
+// runs splits the chain into runs of consecutive clusters. Each run is one fragment of the file.
+func (c chain) runs() []run {
+	var runs []run
+	for _, cluster := range c.clusters {
+		if len(runs) > 0 && runs[len(runs)-1].last+1 == cluster {
+			runs[len(runs)-1].last = cluster
+			continue
+		}
+		runs = append(runs, run{first: cluster, last: cluster})
+	}
+	return runs
+}
+
+// clusterMap renders the allocation map and the cluster chains of the given files of an image.
+// If the image could not be read, the exit code classifies the error.
+func clusterMap(args []string) int {
+	flags := flag.NewFlagSet("map", flag.ContinueOnError)
+	format := flags.String("format", "html", "output format, either dot (Graphviz) or html (standalone heatmap)")
+	output := flags.String("o", "", "write the output into this file instead of stdout")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s map [flags] image [path...]\n\n"+
+			"Shows the chains of the given files and directories or of all files if no path is given.\n\nFlags:\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return usageCode(err)
+	}
+
+	if flags.NArg() < 1 || (*format != "dot" && *format != "html") {
+		flags.Usage()
+		return exitUsage
+	}
+
+	file, err := openImageFile(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCode(err)
+	}
+	defer file.Close()
+
+	fs, err := gofat.New(file)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCode(err)
+	}
+
+	chains, err := readChains(fs, flags.Args()[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCode(err)
+	}
+
+	clusters, err := fs.ClusterMap()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCode(err)
+	}
+
+	var out io.Writer = os.Stdout
+	if *output != "" {
+		outFile, err := os.Create(*output)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitCode(err)
+		}
+		defer outFile.Close()
+		out = outFile
+	}
+
+	buffered := bufio.NewWriter(out)
+	if *format == "dot" {
+		err = writeDot(buffered, fs, clusters, chains)
+	} else {
+		err = writeHTML(buffered, fs, clusters, chains)
+	}
+	if err == nil {
+		err = buffered.Flush()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCode(err)
+	}
+
+	return exitOK
+}
+
+// readChains returns the cluster chains of the given paths. If there are no paths, all files are used.
+func readChains(fs *gofat.Fs, paths []string) ([]chain, error) {
+	if len(paths) == 0 {
+		err := afero.Walk(fs, ".", func(name string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !info.IsDir() {
+				paths = append(paths, name)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	chains := make([]chain, 0, len(paths))
+	for _, name := range paths {
+		// Accept the paths with or without leading slash, as the image root is always the base.
+		name = strings.TrimLeft(name, "/")
+		if name == "" {
+			name = "."
+		}
+
+		clusters, err := fs.ClusterChain(name)
+		if err != nil {
+			return nil, err
+		}
+		chains = append(chains, chain{path: name, clusters: clusters})
+	}
+
+	return chains, nil
+}
+
+// dotQuote quotes the string as Graphviz ID. Escapes like \n are kept, FAT names cannot contain backslashes.
+func dotQuote(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
+
+// writeDot writes the allocation map as a record of runs of clusters with the same state and
+// each chain as a cluster subgraph with one node per run of consecutive clusters.
+func writeDot(w io.Writer, fs *gofat.Fs, clusters []gofat.ClusterState, chains []chain) error {
+	var runs []string
+	for start := 0; start < len(clusters); {
+		end := start
+		for end+1 < len(clusters) && clusters[end+1] == clusters[start] {
+			end++
+		}
+		runs = append(runs, fmt.Sprintf("%v\\n%v", clusters[start], run{first: uint32(start + 2), last: uint32(end + 2)}))
+		start = end + 1
+	}
+
+	fmt.Fprintf(w, "digraph fat {\n\trankdir=LR;\n\tnode [shape=box];\n\tlabel=%v;\n",
+		dotQuote(fmt.Sprintf("%v %v, %d clusters", fs.Label(), fs.FSType(), len(clusters))))
+	fmt.Fprintf(w, "\tallocation [shape=record, label=%v];\n", dotQuote(strings.Join(runs, "|")))
+
+	for i, c := range chains {
+		runs := c.runs()
+		fmt.Fprintf(w, "\tsubgraph cluster_%d {\n\t\tlabel=%v;\n", i,
+			dotQuote(fmt.Sprintf("%v (%d clusters, %d fragments)", c.path, len(c.clusters), len(runs))))
+		for j, r := range runs {
+			fmt.Fprintf(w, "\t\tc%d_%d [label=%v];\n", i, j, dotQuote(r.String()))
+			if j > 0 {
+				fmt.Fprintf(w, "\t\tc%d_%d -> c%d_%d;\n", i, j-1, i, j)
+			}
+		}
+		fmt.Fprintln(w, "\t}")
+	}
+
+	_, err := fmt.Fprintln(w, "}")
+	return err
+}
+
+// cell is one square of the HTML heatmap.
+type cell struct {
+	Color template.CSS
+	Title string
+}
+
+// legend describes one highlighted chain of the HTML heatmap.
+type legend struct {
+	Color     template.CSS
+	Path      string
+	Clusters  int
+	Fragments int
+}
+
+var htmlTemplate = template.Must(template.New("map").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; }
+.map { display: flex; flex-wrap: wrap; max-width: 1024px; }
+.map div { width: 14px; height: 14px; margin: 1px; }
+.swatch { display: inline-block; width: 12px; height: 12px; }
+td { padding: 2px 8px; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p>{{.ClusterCount}} clusters, {{.PerCell}} per cell. Darker cells are fuller, red ones contain bad clusters.</p>
+<div class="map">{{range .Cells}}<div style="background: {{.Color}}" title="{{.Title}}"></div>{{end}}</div>
+{{if .Legend}}<table>
+<tr><th></th><th>Path</th><th>Clusters</th><th>Fragments</th></tr>
+{{range .Legend}}<tr><td>{{if .Color}}<span class="swatch" style="background: {{.Color}}"></span>{{end}}</td><td>{{.Path}}</td><td>{{.Clusters}}</td><td>{{.Fragments}}</td></tr>
+{{end}}</table>{{end}}
+</body>
+</html>
+`))
+
+// writeHTML writes a standalone HTML page showing the allocation map as heatmap.
+// The chains of the first files are highlighted in their own color.
+func writeHTML(w io.Writer, fs *gofat.Fs, clusters []gofat.ClusterState, chains []chain) error {
+	perCell := (len(clusters) + maxCells - 1) / maxCells
+	if perCell < 1 {
+		perCell = 1
+	}
+
+	owner := make(map[uint32]int)
+	var legends []legend
+	for i, c := range chains {
+		var color template.CSS
+		if i < len(fileColors) {
+			color = fileColors[i]
+			for _, cluster := range c.clusters {
+				owner[cluster] = i
+			}
+		}
+		legends = append(legends, legend{Color: color, Path: c.path, Clusters: len(c.clusters), Fragments: len(c.runs())})
+	}
+
+	var cells []cell
+	for start := 0; start < len(clusters); start += perCell {
+		end := start + perCell
+		if end > len(clusters) {
+			end = len(clusters)
+		}
+
+		used, bad := 0, false
+		var files []string
+		seen := make(map[int]bool)
+		for i := start; i < end; i++ {
+			switch clusters[i] {
+			case gofat.ClusterUsed:
+				used++
+			case gofat.ClusterBad:
+				bad = true
+			}
+
+			if file, ok := owner[uint32(i+2)]; ok && !seen[file] {
+				seen[file] = true
+				files = append(files, chains[file].path)
+			}
+		}
+
+		r := run{first: uint32(start + 2), last: uint32(end + 1)}
+		title := fmt.Sprintf("clusters %v: %d%% used", r, used*100/(end-start))
+		color := template.CSS(fmt.Sprintf("hsl(210, 60%%, %d%%)", 95-used*65/(end-start)))
+		switch {
+		case bad:
+			color = "#ff0000"
+			title += ", bad"
+		case len(files) > 0:
+			for i := start; i < end; i++ {
+				if file, ok := owner[uint32(i+2)]; ok {
+					color = fileColors[file]
+					break
+				}
+			}
+			title += "\n" + strings.Join(files, "\n")
+		}
+
+		cells = append(cells, cell{Color: color, Title: title})
+	}
+
+	return htmlTemplate.Execute(w, struct {
+		Title        string
+		ClusterCount int
+		PerCell      int
+		Cells        []cell
+		Legend       []legend
+	}{
+		Title:        fmt.Sprintf("%v %v", fs.Label(), fs.FSType()),
+		ClusterCount: len(clusters),
+		PerCell:      perCell,
+		Cells:        cells,
+		Legend:       legends,
+	})
+}
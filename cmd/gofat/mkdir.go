@@ -0,0 +1,70 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/aligator/gofat"
+)
+
+// mkdir creates directories in images. With -p missing parents are created as well and existing directories are
+// no error.
+// If a directory could not be created, the exit code classifies the last failure.
+func mkdir(args []string) int {
+	flags := flag.NewFlagSet("mkdir", flag.ContinueOnError)
+	parents := flags.Bool("p", false, "create missing parent directories and ignore existing ones")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s mkdir [flags] image:path...\n\nFlags:\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return usageCode(err)
+	}
+
+	if flags.NArg() < 1 {
+		flags.Usage()
+		return exitUsage
+	}
+
+	images := make(map[string]*gofat.Fs)
+	code := exitOK
+	for _, target := range flags.Args() {
+		separator := strings.LastIndex(target, ":")
+		if separator < 0 {
+			fmt.Fprintf(os.Stderr, "%v: the path has to be written as image:path\n", target)
+			return exitUsage
+		}
+
+		fs, ok := images[target[:separator]]
+		if !ok {
+			file, err := os.OpenFile(target[:separator], os.O_RDWR, 0)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return exitCode(err)
+			}
+			defer file.Close()
+
+			fs, err = gofat.New(file)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return exitCode(err)
+			}
+			images[target[:separator]] = fs
+		}
+
+		var err error
+		if *parents {
+			err = fs.MkdirAll(target[separator+1:], 0755)
+		} else {
+			err = fs.Mkdir(target[separator+1:], 0755)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v: %v\n", target, err)
+			code = exitCode(err)
+		}
+	}
+
+	return code
+}
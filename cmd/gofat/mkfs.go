@@ -0,0 +1,73 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/aligator/gofat"
+)
+
+// mkfs formats an image or a device with a new FAT filesystem.
+// If the image could not be formatted, the exit code classifies the error.
+func mkfs(args []string) int {
+	flags := flag.NewFlagSet("mkfs", flag.ContinueOnError)
+	size := flags.String("size", "", "create the image with this size (e.g. 64M), otherwise the size of the existing image or device is used")
+	fsType := flags.String("type", "", "FAT type, either FAT12, FAT16 or FAT32 (chosen by size if not set)")
+	label := flags.String("label", "", "volume label with up to 11 characters")
+	sectorsPerCluster := flags.Uint("cluster", 0, "sectors per cluster (chosen by size if not set)")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s mkfs [flags] image\n\nFlags:\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return usageCode(err)
+	}
+
+	if flags.NArg() != 1 || *sectorsPerCluster > 128 {
+		flags.Usage()
+		return exitUsage
+	}
+
+	opts := gofat.FormatOptions{
+		FSType:            gofat.FATType(strings.ToUpper(*fsType)),
+		Label:             *label,
+		SectorsPerCluster: uint8(*sectorsPerCluster),
+	}
+
+	// Parse the size before the image gets truncated.
+	mode := os.O_RDWR
+	if *size != "" {
+		var err error
+		opts.Size, err = parseSize(*size)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitUsage
+		}
+		mode |= os.O_CREATE | os.O_TRUNC
+	}
+
+	file, err := os.OpenFile(flags.Arg(0), mode, 0666)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCode(err)
+	}
+	defer file.Close()
+
+	if err := gofat.Format(file, opts); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCode(err)
+	}
+
+	fs, err := gofat.New(file)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCode(err)
+	}
+
+	info := fs.Info()
+	fmt.Printf("formatted %v as %v volume '%v' with %d clusters of %d bytes\n", flags.Arg(0), fs.FSType(), fs.Label(),
+		info.ClusterCount, int(info.SectorsPerCluster)*int(info.BytesPerSector))
+	return exitOK
+}
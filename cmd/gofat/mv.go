@@ -0,0 +1,79 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/aligator/gofat"
+)
+
+// mv renames or moves an entry inside an image without copying its content.
+// If the new path is an existing directory, the entry is moved into it.
+// If the entry could not be moved, the exit code classifies the error (e.g. exitNotFound or exitExists).
+func mv(args []string) int {
+	flags := flag.NewFlagSet("mv", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s mv image:old image:new\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return usageCode(err)
+	}
+
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return exitUsage
+	}
+
+	var images [2]string
+	var paths [2]string
+	for i, target := range flags.Args() {
+		separator := strings.LastIndex(target, ":")
+		if separator < 0 {
+			fmt.Fprintf(os.Stderr, "%v: the path has to be written as image:path\n", target)
+			return exitUsage
+		}
+		images[i] = target[:separator]
+		paths[i] = path.Clean("/" + target[separator+1:])[1:]
+		if paths[i] == "" {
+			paths[i] = "."
+		}
+	}
+
+	if images[0] != images[1] {
+		fmt.Fprintln(os.Stderr, "entries can only be moved inside the same image")
+		return exitUsage
+	}
+
+	file, err := os.OpenFile(images[0], os.O_RDWR, 0)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCode(err)
+	}
+	defer file.Close()
+
+	fs, err := gofat.New(file)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCode(err)
+	}
+
+	if err := moveEntry(fs, paths[0], paths[1]); err != nil {
+		fmt.Fprintf(os.Stderr, "%v: %v\n", flags.Arg(0), err)
+		return exitCode(err)
+	}
+	return exitOK
+}
+
+// moveEntry renames oldname to newname. If newname is an existing directory other than oldname itself, the entry
+// is moved into it, keeping its name.
+func moveEntry(fs *gofat.Fs, oldname string, newname string) error {
+	if info, err := fs.Stat(newname); err == nil && info.IsDir() && !strings.EqualFold(oldname, newname) {
+		newname = path.Join(newname, path.Base(oldname))
+	}
+
+	return fs.Rename(oldname, newname)
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+
+	"github.com/aligator/gofat"
+)
+
+// Constants of the NBD protocol, see https://github.com/NetworkBlockDevice/nbd/blob/master/doc/proto.md.
+const (
+	nbdMagic        = 0x4e42444d41474943 // "NBDMAGIC"
+	nbdOptionMagic  = 0x49484156454f5054 // "IHAVEOPT"
+	nbdReplyMagic   = 0x3e889045565a9
+	nbdRequestMagic = 0x25609513
+	nbdSimpleMagic  = 0x67446698
+
+	nbdFlagFixedNewstyle = 1 << 0
+	nbdFlagNoZeroes      = 1 << 1
+
+	nbdFlagHasFlags     = 1 << 0
+	nbdFlagReadOnly     = 1 << 1
+	nbdFlagSendFlush    = 1 << 2
+	nbdFlagCanMultiConn = 1 << 8
+
+	nbdOptExportName = 1
+	nbdOptAbort      = 2
+	nbdOptList       = 3
+	nbdOptInfo       = 6
+	nbdOptGo         = 7
+
+	nbdRepAck      = 1
+	nbdRepServer   = 2
+	nbdRepInfo     = 3
+	nbdRepErrUnsup = 1<<31 | 1
+
+	nbdInfoExport = 0
+
+	nbdCmdRead  = 0
+	nbdCmdWrite = 1
+	nbdCmdDisc  = 2
+	nbdCmdFlush = 3
+	nbdCmdTrim  = 4
+
+	nbdEPERM  = 1
+	nbdEIO    = 5
+	nbdEINVAL = 22
+)
+
+// nbdMaxLength is the maximum length of a read request, as recommended by the NBD protocol. Longer requests are
+// rejected, so that a client cannot make the server allocate a buffer as big as the image.
+const nbdMaxLength = 32 * 1024 * 1024
+
+// nbdTransmissionFlags are sent for the export. The export is read-only, so several connections are safe.
+const nbdTransmissionFlags = nbdFlagHasFlags | nbdFlagReadOnly | nbdFlagSendFlush | nbdFlagCanMultiConn
+
+// nbd serves an image read-only as network block device, so that big images can be inspected remotely
+// (e.g. with nbd-client or qemu-nbd) without copying them.
+// The sectors are read through the sector cache of gofat, which keeps the FATs and directories in memory.
+// If the image could not be opened or the server failed, the exit code classifies the error.
+func nbd(args []string) int {
+	flags := flag.NewFlagSet("nbd", flag.ContinueOnError)
+	addr := flags.String("addr", "localhost:10809", "the address to listen on")
+	cacheSize := flags.Int("cache", 0, "the count of sectors to cache (default gofat.DefaultCacheSize)")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s nbd [flags] image\n\nFlags:\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return usageCode(err)
+	}
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return exitUsage
+	}
+
+	file, err := openImageFile(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCode(err)
+	}
+	defer file.Close()
+
+	fs, err := gofat.NewWithOptions(file, gofat.Options{CacheSize: *cacheSize})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCode(err)
+	}
+
+	listener, err := net.Listen("tcp", *addr)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCode(err)
+	}
+	defer listener.Close()
+
+	raw := fs.RawReader()
+	fmt.Printf("Serving '%v' (%d bytes) read-only on nbd://%v\n", fs.Label(), raw.Size(), *addr)
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitCode(err)
+		}
+
+		go func() {
+			defer conn.Close()
+			if err := serveNBD(conn, raw); err != nil && !errors.Is(err, io.EOF) {
+				fmt.Fprintf(os.Stderr, "%v: %v\n", conn.RemoteAddr(), err)
+			}
+		}()
+	}
+}
+
+// nbdConn is a connection of a client using the fixed newstyle handshake.
+type nbdConn struct {
+	r   *bufio.Reader
+	w   *bufio.Writer
+	raw *gofat.RawReader
+	// noZeroes omits the padding after NBD_OPT_EXPORT_NAME.
+	noZeroes bool
+}
+
+// serveNBD negotiates the export with the client and answers its requests until it disconnects.
+func serveNBD(conn net.Conn, raw *gofat.RawReader) error {
+	c := &nbdConn{r: bufio.NewReader(conn), w: bufio.NewWriter(conn), raw: raw}
+
+	if err := c.write(uint64(nbdMagic), uint64(nbdOptionMagic), uint16(nbdFlagFixedNewstyle|nbdFlagNoZeroes)); err != nil {
+		return err
+	}
+
+	var clientFlags uint32
+	if err := binary.Read(c.r, binary.BigEndian, &clientFlags); err != nil {
+		return err
+	}
+	if clientFlags&^(nbdFlagFixedNewstyle|nbdFlagNoZeroes) != 0 {
+		return fmt.Errorf("unsupported client flags %#x", clientFlags)
+	}
+	c.noZeroes = clientFlags&nbdFlagNoZeroes != 0
+
+	transmit, err := c.negotiate()
+	if err != nil || !transmit {
+		return err
+	}
+	return c.transmit()
+}
+
+// negotiate handles the options of the client. It returns true if the transmission phase starts.
+func (c *nbdConn) negotiate() (bool, error) {
+	for {
+		var header struct {
+			Magic  uint64
+			Option uint32
+			Length uint32
+		}
+		if err := binary.Read(c.r, binary.BigEndian, &header); err != nil {
+			return false, err
+		}
+		if header.Magic != nbdOptionMagic {
+			return false, fmt.Errorf("invalid option magic %#x", header.Magic)
+		}
+		if header.Length > 4096 {
+			return false, fmt.Errorf("option %d is too long", header.Option)
+		}
+
+		data := make([]byte, header.Length)
+		if _, err := io.ReadFull(c.r, data); err != nil {
+			return false, err
+		}
+
+		// There is only one export, so all export names are accepted.
+		switch header.Option {
+		case nbdOptExportName:
+			if err := c.write(uint64(c.raw.Size()), uint16(nbdTransmissionFlags)); err != nil {
+				return false, err
+			}
+			if !c.noZeroes {
+				if err := c.write(make([]byte, 124)); err != nil {
+					return false, err
+				}
+			}
+			return true, nil
+		case nbdOptAbort:
+			return false, c.reply(header.Option, nbdRepAck, nil)
+		case nbdOptList:
+			if err := c.reply(header.Option, nbdRepServer, []byte{0, 0, 0, 0}); err != nil {
+				return false, err
+			}
+			if err := c.reply(header.Option, nbdRepAck, nil); err != nil {
+				return false, err
+			}
+		case nbdOptInfo, nbdOptGo:
+			info := make([]byte, 12)
+			binary.BigEndian.PutUint16(info[0:], nbdInfoExport)
+			binary.BigEndian.PutUint64(info[2:], uint64(c.raw.Size()))
+			binary.BigEndian.PutUint16(info[10:], nbdTransmissionFlags)
+			if err := c.reply(header.Option, nbdRepInfo, info); err != nil {
+				return false, err
+			}
+			if err := c.reply(header.Option, nbdRepAck, nil); err != nil {
+				return false, err
+			}
+			if header.Option == nbdOptGo {
+				return true, nil
+			}
+		default:
+			if err := c.reply(header.Option, nbdRepErrUnsup, nil); err != nil {
+				return false, err
+			}
+		}
+	}
+}
+
+// transmit answers the requests of the client until it disconnects.
+func (c *nbdConn) transmit() error {
+	buffer := make([]byte, 0, 128*1024)
+	for {
+		var request struct {
+			Magic  uint32
+			Flags  uint16
+			Type   uint16
+			Handle uint64
+			Offset uint64
+			Length uint32
+		}
+		if err := binary.Read(c.r, binary.BigEndian, &request); err != nil {
+			return err
+		}
+		if request.Magic != nbdRequestMagic {
+			return fmt.Errorf("invalid request magic %#x", request.Magic)
+		}
+
+		var errno uint32
+		var data []byte
+		switch request.Type {
+		case nbdCmdRead:
+			if request.Length > nbdMaxLength || request.Offset+uint64(request.Length) > uint64(c.raw.Size()) {
+				errno = nbdEINVAL
+				break
+			}
+			if cap(buffer) < int(request.Length) {
+				buffer = make([]byte, request.Length)
+			}
+			data = buffer[:request.Length]
+			if _, err := c.raw.ReadAt(data, int64(request.Offset)); err != nil {
+				fmt.Fprintf(os.Stderr, "reading %d bytes at %d failed: %v\n", request.Length, request.Offset, err)
+				errno, data = nbdEIO, nil
+			}
+		case nbdCmdWrite:
+			// The data of the write has to be consumed, even though it is rejected.
+			if _, err := io.CopyN(io.Discard, c.r, int64(request.Length)); err != nil {
+				return err
+			}
+			errno = nbdEPERM
+		case nbdCmdTrim:
+			errno = nbdEPERM
+		case nbdCmdFlush:
+			// Nothing is ever written.
+		case nbdCmdDisc:
+			return c.w.Flush()
+		default:
+			errno = nbdEINVAL
+		}
+
+		if err := c.write(uint32(nbdSimpleMagic), errno, request.Handle, data); err != nil {
+			return err
+		}
+	}
+}
+
+// reply sends the reply to an option.
+func (c *nbdConn) reply(option uint32, replyType uint32, data []byte) error {
+	return c.write(uint64(nbdReplyMagic), option, replyType, uint32(len(data)), data)
+}
+
+// write sends all values in network byte order and flushes them.
+func (c *nbdConn) write(values ...interface{}) error {
+	for _, value := range values {
+		if err := binary.Write(c.w, binary.BigEndian, value); err != nil {
+			return err
+		}
+	}
+	return c.w.Flush()
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/aligator/gofat"
+)
+
+// nbdClient talks to serveNBD over a net.Pipe.
+type nbdClient struct {
+	t    *testing.T
+	conn net.Conn
+	raw  *gofat.RawReader
+	// errs receives the result of serveNBD after the server stopped.
+	errs chan error
+}
+
+func newNBDClient(t *testing.T) *nbdClient {
+	// The image is bigger than nbdMaxLength, so that the limit of the length can be tested.
+	fs, err := gofat.New(testingImage(t, 2*nbdMaxLength))
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw := fs.RawReader()
+	client, server := net.Pipe()
+
+	c := &nbdClient{t: t, conn: client, raw: raw, errs: make(chan error, 1)}
+	go func() {
+		err := serveNBD(server, raw)
+		_ = server.Close()
+		c.errs <- err
+	}()
+	t.Cleanup(func() { _ = client.Close() })
+	return c
+}
+
+// send writes all values in network byte order.
+func (c *nbdClient) send(values ...interface{}) {
+	c.t.Helper()
+	for _, value := range values {
+		if err := binary.Write(c.conn, binary.BigEndian, value); err != nil {
+			c.t.Fatal(err)
+		}
+	}
+}
+
+// receive reads all values in network byte order.
+func (c *nbdClient) receive(values ...interface{}) {
+	c.t.Helper()
+	for _, value := range values {
+		if err := binary.Read(c.conn, binary.BigEndian, value); err != nil {
+			c.t.Fatal(err)
+		}
+	}
+}
+
+// handshake does the fixed newstyle handshake and starts the transmission with NBD_OPT_GO.
+// It returns the size and the transmission flags of the export.
+func (c *nbdClient) handshake() (uint64, uint16) {
+	c.t.Helper()
+
+	var magic, optionMagic uint64
+	var serverFlags uint16
+	c.receive(&magic, &optionMagic, &serverFlags)
+	if magic != nbdMagic || optionMagic != nbdOptionMagic {
+		c.t.Fatalf("server sent the magic %#x %#x, want %#x %#x", magic, optionMagic, nbdMagic, nbdOptionMagic)
+	}
+	if serverFlags&nbdFlagFixedNewstyle == 0 {
+		c.t.Fatalf("server flags %#x do not contain the fixed newstyle flag", serverFlags)
+	}
+	c.send(uint32(nbdFlagFixedNewstyle | nbdFlagNoZeroes))
+
+	// An empty export name and no requested information.
+	c.send(uint64(nbdOptionMagic), uint32(nbdOptGo), uint32(6), uint32(0), uint16(0))
+
+	var size uint64
+	var flags uint16
+	for _, want := range []uint32{nbdRepInfo, nbdRepAck} {
+		var replyMagic uint64
+		var option, replyType, length uint32
+		c.receive(&replyMagic, &option, &replyType, &length)
+		if replyMagic != nbdReplyMagic || option != nbdOptGo || replyType != want {
+			c.t.Fatalf("reply = %#x %d %#x, want %#x %d %#x", replyMagic, option, replyType, nbdReplyMagic, nbdOptGo, want)
+		}
+
+		data := make([]byte, length)
+		c.receive(data)
+		if replyType == nbdRepInfo {
+			if infoType := binary.BigEndian.Uint16(data); infoType != nbdInfoExport || length != 12 {
+				c.t.Fatalf("info has the type %d and %d bytes, want %d and 12 bytes", infoType, length, nbdInfoExport)
+			}
+			size = binary.BigEndian.Uint64(data[2:])
+			flags = binary.BigEndian.Uint16(data[10:])
+		}
+	}
+
+	return size, flags
+}
+
+// request sends a request of the transmission phase and returns the error of the reply.
+// For reads, the data of the reply is returned as well.
+func (c *nbdClient) request(cmd uint16, offset uint64, length uint32, data []byte) (uint32, []byte) {
+	c.t.Helper()
+	c.send(uint32(nbdRequestMagic), uint16(0), cmd, uint64(42), offset, length)
+	if len(data) > 0 {
+		c.send(data)
+	}
+
+	var magic, errno uint32
+	var handle uint64
+	c.receive(&magic, &errno, &handle)
+	if magic != nbdSimpleMagic || handle != 42 {
+		c.t.Fatalf("reply = %#x with handle %d, want %#x with handle 42", magic, handle, nbdSimpleMagic)
+	}
+
+	if cmd != nbdCmdRead || errno != 0 {
+		return errno, nil
+	}
+	reply := make([]byte, length)
+	c.receive(reply)
+	return errno, reply
+}
+
+func Test_serveNBD(t *testing.T) {
+	c := newNBDClient(t)
+
+	size, flags := c.handshake()
+	if size != uint64(c.raw.Size()) {
+		t.Errorf("export has %d bytes, want %d", size, c.raw.Size())
+	}
+	if flags&nbdFlagReadOnly == 0 {
+		t.Errorf("transmission flags %#x do not contain the read only flag", flags)
+	}
+
+	// The two sectors behind the boot sector.
+	want := make([]byte, 1024)
+	if _, err := c.raw.ReadAt(want, 512); err != nil {
+		t.Fatal(err)
+	}
+	errno, got := c.request(nbdCmdRead, 512, 1024, nil)
+	if errno != 0 || !bytes.Equal(got, want) {
+		t.Errorf("read = %d and %d bytes, want 0 and the image content", errno, len(got))
+	}
+
+	if errno, _ := c.request(nbdCmdRead, size-512, 1024, nil); errno != nbdEINVAL {
+		t.Errorf("read behind the end = %d, want %d", errno, nbdEINVAL)
+	}
+	if errno, _ := c.request(nbdCmdRead, 0, nbdMaxLength+512, nil); errno != nbdEINVAL {
+		t.Errorf("read longer than %d bytes = %d, want %d", nbdMaxLength, errno, nbdEINVAL)
+	}
+
+	// The data of the rejected write must be consumed, so the next request still works.
+	if errno, _ := c.request(nbdCmdWrite, 0, 512, make([]byte, 512)); errno != nbdEPERM {
+		t.Errorf("write = %d, want %d", errno, nbdEPERM)
+	}
+	if errno, got := c.request(nbdCmdRead, 512, 1024, nil); errno != 0 || !bytes.Equal(got, want) {
+		t.Errorf("read after the write = %d and %d bytes, want 0 and the unchanged image content", errno, len(got))
+	}
+
+	c.send(uint32(nbdRequestMagic), uint16(0), uint16(nbdCmdDisc), uint64(43), uint64(0), uint32(0))
+	if err := <-c.errs; err != nil {
+		t.Errorf("serveNBD() error = %v, want nil after the disconnect", err)
+	}
+	if _, err := c.conn.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("reading after the disconnect error = %v, want %v", err, io.EOF)
+	}
+}
@@ -0,0 +1,695 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net"
+	"os"
+	"path"
+	"strings"
+	"syscall"
+
+	"github.com/aligator/gofat"
+	"github.com/spf13/afero"
+)
+
+// Message types of 9P2000 and 9P2000.L, see http://man.cat-v.org/plan_9/5/intro and
+// https://github.com/chaos/diod/blob/master/protocol.md. Each reply has the type of the request + 1.
+const (
+	p9Tlerror    = 6
+	p9Tstatfs    = 8
+	p9Tlopen     = 12
+	p9Tgetattr   = 24
+	p9Txattrwalk = 30
+	p9Treaddir   = 40
+	p9Tversion   = 100
+	p9Tauth      = 102
+	p9Tattach    = 104
+	p9Terror     = 106
+	p9Tflush     = 108
+	p9Twalk      = 110
+	p9Topen      = 112
+	p9Tread      = 116
+	p9Tclunk     = 120
+	p9Tstat      = 124
+)
+
+const (
+	p9Version  = "9P2000"
+	p9VersionL = "9P2000.L"
+
+	// p9MaxSize is the biggest message size accepted.
+	p9MaxSize = 128 * 1024
+	// p9HeaderSize is the size of size[4] type[1] tag[2].
+	p9HeaderSize = 7
+	// p9ReadOverhead is the size of the header of Rread and Rreaddir: header + count[4].
+	p9ReadOverhead = p9HeaderSize + 4
+
+	p9QTDir  = 0x80
+	p9QTFile = 0x00
+	p9DMDir  = 0x80000000
+
+	// The access mode of Topen and Tlopen and the flags which request truncation.
+	p9OAccess = 0x3
+	p9OWrite  = 0x1
+	p9ORdwr   = 0x2
+	p9OTrunc  = 0x10
+	p9LTrunc  = 0x200
+
+	// Values of Rgetattr.
+	p9GetattrBasic = 0x7ff
+	p9ModeDir      = 0040000
+	p9ModeFile     = 0100000
+)
+
+// ninep serves an image read-only over 9P, so that it can be mounted natively on Plan 9, Linux (v9fs) and WSL
+// without FUSE, e.g. with: mount -t 9p -o trans=tcp,port=5640,ro 127.0.0.1 /mnt
+// Both 9P2000 and 9P2000.L are supported. If the image could not be opened or the server failed,
+// the exit code classifies the error.
+func ninep(args []string) int {
+	flags := flag.NewFlagSet("9p", flag.ContinueOnError)
+	addr := flags.String("addr", "localhost:5640", "the address to listen on")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s 9p [flags] image\n\nFlags:\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return usageCode(err)
+	}
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return exitUsage
+	}
+
+	file, err := openImageFile(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCode(err)
+	}
+	defer file.Close()
+
+	fs, err := gofat.New(file)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCode(err)
+	}
+
+	listener, err := net.Listen("tcp", *addr)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCode(err)
+	}
+	defer listener.Close()
+
+	fmt.Printf("Serving '%v' read-only over 9P on %v\n", fs.Label(), *addr)
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitCode(err)
+		}
+
+		go func() {
+			defer conn.Close()
+			s := &p9Server{fs: fs, size: fs.RawReader().Size(), conn: conn, msize: p9MaxSize, fids: make(map[uint32]*p9Fid)}
+			if err := s.serve(); err != nil && !errors.Is(err, io.EOF) {
+				fmt.Fprintf(os.Stderr, "%v: %v\n", conn.RemoteAddr(), err)
+			}
+		}()
+	}
+}
+
+// p9Error is an error which is sent to the client.
+type p9Error struct {
+	errno syscall.Errno
+}
+
+func (e p9Error) Error() string {
+	return e.errno.Error()
+}
+
+// p9Errno converts an error of the filesystem into the error sent to the client.
+func p9Errno(err error) p9Error {
+	var p9Err p9Error
+	switch {
+	case errors.As(err, &p9Err):
+		return p9Err
+	case errors.Is(err, os.ErrNotExist):
+		return p9Error{syscall.ENOENT}
+	case errors.Is(err, syscall.ENOTDIR):
+		return p9Error{syscall.ENOTDIR}
+	default:
+		return p9Error{syscall.EIO}
+	}
+}
+
+// p9Fid is a file of the client.
+type p9Fid struct {
+	path string
+	info os.FileInfo
+	// file is set after the fid was opened.
+	file afero.File
+	// entries are the encoded entries of an opened directory read with Tread, offsets their start offsets.
+	entries [][]byte
+	offsets []uint64
+	// children are the entries of an opened directory read with Treaddir.
+	children []os.FileInfo
+}
+
+// p9Server handles the connection of one client. The requests are answered one after another.
+type p9Server struct {
+	fs    afero.Fs
+	size  int64
+	conn  net.Conn
+	msize uint32
+	// dotL is true if 9P2000.L was negotiated.
+	dotL bool
+	fids map[uint32]*p9Fid
+}
+
+func (s *p9Server) serve() error {
+	header := make([]byte, p9HeaderSize)
+	for {
+		if _, err := io.ReadFull(s.conn, header); err != nil {
+			return err
+		}
+
+		size := binary.LittleEndian.Uint32(header)
+		if size < p9HeaderSize || size > s.msize {
+			return fmt.Errorf("invalid message size %d", size)
+		}
+
+		body := make([]byte, size-p9HeaderSize)
+		if _, err := io.ReadFull(s.conn, body); err != nil {
+			return err
+		}
+
+		msgType := header[4]
+		tag := binary.LittleEndian.Uint16(header[5:])
+		reply, err := s.handle(msgType, &p9Decoder{data: body})
+		if err != nil {
+			var p9Err p9Error
+			if !errors.As(err, &p9Err) {
+				return err
+			}
+
+			reply = &p9Encoder{}
+			if s.dotL {
+				msgType = p9Tlerror
+				reply.u32(uint32(p9Err.errno))
+			} else {
+				msgType = p9Terror
+				reply.str(p9Err.Error())
+			}
+		}
+
+		if err := s.send(msgType+1, tag, reply.data); err != nil {
+			return err
+		}
+	}
+}
+
+// send writes a reply.
+func (s *p9Server) send(msgType uint8, tag uint16, body []byte) error {
+	message := make([]byte, p9HeaderSize, p9HeaderSize+len(body))
+	binary.LittleEndian.PutUint32(message, uint32(p9HeaderSize+len(body)))
+	message[4] = msgType
+	binary.LittleEndian.PutUint16(message[5:], tag)
+	_, err := s.conn.Write(append(message, body...))
+	return err
+}
+
+// handle answers a request. Errors which are not a p9Error end the connection.
+func (s *p9Server) handle(msgType uint8, d *p9Decoder) (*p9Encoder, error) {
+	reply := &p9Encoder{}
+
+	switch msgType {
+	case p9Tversion:
+		msize, version := d.u32(), d.str()
+		if d.err != nil {
+			return nil, d.err
+		}
+		if msize < s.msize {
+			s.msize = msize
+		}
+
+		// All fids are released by a new version.
+		s.fids = make(map[uint32]*p9Fid)
+		switch version {
+		case p9VersionL:
+			s.dotL = true
+		case p9Version:
+			s.dotL = false
+		default:
+			version = "unknown"
+		}
+		reply.u32(s.msize)
+		reply.str(version)
+		return reply, nil
+
+	case p9Tauth:
+		return nil, p9Error{syscall.EOPNOTSUPP}
+
+	case p9Tattach:
+		fid := d.u32()
+		if d.err != nil {
+			return nil, d.err
+		}
+		info, err := s.fs.Stat(".")
+		if err != nil {
+			return nil, p9Errno(err)
+		}
+		s.fids[fid] = &p9Fid{path: ".", info: info}
+		reply.qid(".", info)
+		return reply, nil
+
+	case p9Tflush:
+		// Requests are answered in order, so the flushed one is already done.
+		return reply, nil
+
+	case p9Twalk:
+		return s.walk(d, reply)
+
+	case p9Topen, p9Tlopen:
+		fid, mode := d.u32(), uint32(0)
+		if msgType == p9Topen {
+			mode = uint32(d.u8())
+		} else {
+			mode = d.u32()
+		}
+		if d.err != nil {
+			return nil, d.err
+		}
+		if access := mode & p9OAccess; access == p9OWrite || access == p9ORdwr || (msgType == p9Topen && mode&p9OTrunc != 0) || (msgType == p9Tlopen && mode&p9LTrunc != 0) {
+			return nil, p9Error{syscall.EROFS}
+		}
+
+		f, err := s.fid(fid)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.open(f); err != nil {
+			return nil, err
+		}
+		reply.qid(f.path, f.info)
+		reply.u32(s.msize - p9ReadOverhead)
+		return reply, nil
+
+	case p9Tread:
+		fid, offset, count := d.u32(), d.u64(), d.u32()
+		if d.err != nil {
+			return nil, d.err
+		}
+		f, err := s.fid(fid)
+		if err != nil {
+			return nil, err
+		}
+		data, err := s.read(f, offset, s.limit(count))
+		if err != nil {
+			return nil, err
+		}
+		reply.u32(uint32(len(data)))
+		reply.bytes(data)
+		return reply, nil
+
+	case p9Treaddir:
+		fid, offset, count := d.u32(), d.u64(), d.u32()
+		if d.err != nil {
+			return nil, d.err
+		}
+		f, err := s.fid(fid)
+		if err != nil {
+			return nil, err
+		}
+		if f.file == nil || !f.info.IsDir() {
+			return nil, p9Error{syscall.EBADF}
+		}
+
+		entries := &p9Encoder{}
+		count = s.limit(count)
+		for i := offset; i < uint64(len(f.children)); i++ {
+			child := f.children[i]
+			entry := &p9Encoder{}
+			entry.qid(path.Join(f.path, child.Name()), child)
+			entry.u64(i + 1)
+			entry.u8(p9DirentType(child))
+			entry.str(child.Name())
+			if len(entries.data)+len(entry.data) > int(count) {
+				break
+			}
+			entries.bytes(entry.data)
+		}
+		reply.u32(uint32(len(entries.data)))
+		reply.bytes(entries.data)
+		return reply, nil
+
+	case p9Tclunk:
+		fid := d.u32()
+		if d.err != nil {
+			return nil, d.err
+		}
+		f, err := s.fid(fid)
+		if err != nil {
+			return nil, err
+		}
+		if f.file != nil {
+			_ = f.file.Close()
+		}
+		delete(s.fids, fid)
+		return reply, nil
+
+	case p9Tstat:
+		f, err := s.fid(d.u32())
+		if err != nil {
+			return nil, err
+		}
+		stat := p9Stat(f.path, f.info)
+		reply.u16(uint16(len(stat)))
+		reply.bytes(stat)
+		return reply, nil
+
+	case p9Tgetattr:
+		f, err := s.fid(d.u32())
+		if err != nil {
+			return nil, err
+		}
+		mode, size, nlink := uint32(p9ModeFile|0444), uint64(f.info.Size()), uint64(1)
+		if f.info.IsDir() {
+			mode, size, nlink = p9ModeDir|0555, 0, 2
+		}
+		mtime := f.info.ModTime()
+
+		reply.u64(p9GetattrBasic)
+		reply.qid(f.path, f.info)
+		reply.u32(mode)
+		reply.u32(0) // uid
+		reply.u32(0) // gid
+		reply.u64(nlink)
+		reply.u64(0) // rdev
+		reply.u64(size)
+		reply.u64(512)                // blksize
+		reply.u64((size + 511) / 512) // blocks
+		for i := 0; i < 3; i++ {
+			// atime, mtime and ctime
+			reply.u64(uint64(mtime.Unix()))
+			reply.u64(uint64(mtime.Nanosecond()))
+		}
+		for i := 0; i < 4; i++ {
+			// btime, gen and data_version are not reported.
+			reply.u64(0)
+		}
+		return reply, nil
+
+	case p9Tstatfs:
+		if _, err := s.fid(d.u32()); err != nil {
+			return nil, err
+		}
+		reply.u32(0x01021997) // V9FS_MAGIC
+		reply.u32(512)
+		reply.u64(uint64(s.size / 512))
+		reply.u64(0) // free blocks, nothing can be written
+		reply.u64(0) // available blocks
+		reply.u64(0) // files
+		reply.u64(0) // free files
+		reply.u64(0) // fsid
+		reply.u32(255)
+		return reply, nil
+
+	case p9Txattrwalk:
+		return nil, p9Error{syscall.EOPNOTSUPP}
+
+	default:
+		// Everything else changes the filesystem or is not supported.
+		return nil, p9Error{syscall.EROFS}
+	}
+}
+
+// walk answers Twalk. The newfid is only created if all names were found.
+func (s *p9Server) walk(d *p9Decoder, reply *p9Encoder) (*p9Encoder, error) {
+	fid, newFid, count := d.u32(), d.u32(), d.u16()
+	names := make([]string, count)
+	for i := range names {
+		names[i] = d.str()
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	f, err := s.fid(fid)
+	if err != nil {
+		return nil, err
+	}
+	if _, exists := s.fids[newFid]; exists && newFid != fid {
+		return nil, p9Error{syscall.EBADF}
+	}
+
+	current, info := f.path, f.info
+	reply.u16(0)
+	walked := 0
+	for _, name := range names {
+		next := current
+		switch {
+		case name == "" || strings.Contains(name, "/"):
+			next = ""
+		case name == "..":
+			next = path.Dir(current)
+		case name != ".":
+			next = path.Join(current, name)
+		}
+
+		var nextInfo os.FileInfo
+		var err error = p9Error{syscall.ENOENT}
+		if next != "" {
+			nextInfo, err = s.fs.Stat(next)
+		}
+		if err != nil {
+			if walked == 0 {
+				return nil, p9Errno(err)
+			}
+			break
+		}
+
+		current, info = next, nextInfo
+		reply.qid(current, info)
+		walked++
+	}
+	binary.LittleEndian.PutUint16(reply.data, uint16(walked))
+
+	if walked == len(names) {
+		s.fids[newFid] = &p9Fid{path: current, info: info}
+	}
+	return reply, nil
+}
+
+// fid returns the file of the fid.
+func (s *p9Server) fid(fid uint32) (*p9Fid, error) {
+	f, ok := s.fids[fid]
+	if !ok {
+		return nil, p9Error{syscall.EBADF}
+	}
+	return f, nil
+}
+
+// limit reduces the count of bytes to read so that the reply fits into a message.
+func (s *p9Server) limit(count uint32) uint32 {
+	if max := s.msize - p9ReadOverhead; count > max {
+		return max
+	}
+	return count
+}
+
+// open opens the file of the fid. Directories are read completely.
+func (s *p9Server) open(f *p9Fid) error {
+	if f.file != nil {
+		return p9Error{syscall.EBADF}
+	}
+
+	file, err := s.fs.Open(f.path)
+	if err != nil {
+		return p9Errno(err)
+	}
+
+	if f.info.IsDir() {
+		children, err := file.Readdir(-1)
+		if err != nil {
+			_ = file.Close()
+			return p9Errno(err)
+		}
+
+		f.children = children
+		var offset uint64
+		for _, child := range children {
+			stat := p9Stat(path.Join(f.path, child.Name()), child)
+			f.entries = append(f.entries, stat)
+			f.offsets = append(f.offsets, offset)
+			offset += uint64(len(stat))
+		}
+	}
+
+	f.file = file
+	return nil
+}
+
+// read reads from an opened file. Directories return whole stat entries as defined by 9P2000.
+func (s *p9Server) read(f *p9Fid, offset uint64, count uint32) ([]byte, error) {
+	if f.file == nil {
+		return nil, p9Error{syscall.EBADF}
+	}
+
+	if !f.info.IsDir() {
+		data := make([]byte, count)
+		n, err := f.file.ReadAt(data, int64(offset))
+		if err != nil && err != io.EOF {
+			return nil, p9Errno(err)
+		}
+		return data[:n], nil
+	}
+
+	// The offset has to be the start of an entry.
+	first := len(f.entries)
+	for i, start := range f.offsets {
+		if start == offset {
+			first = i
+			break
+		}
+	}
+
+	var data []byte
+	for _, entry := range f.entries[first:] {
+		if len(data)+len(entry) > int(count) {
+			break
+		}
+		data = append(data, entry...)
+	}
+	return data, nil
+}
+
+// p9Path returns the unique path of the qid of a file. FAT has no inode numbers, so it is a hash of the path.
+func p9Path(name string) uint64 {
+	if name == "." {
+		return 0
+	}
+	hash := fnv.New64a()
+	_, _ = hash.Write([]byte(name))
+	return hash.Sum64()
+}
+
+// p9DirentType returns the type of a directory entry of Rreaddir (DT_DIR or DT_REG).
+func p9DirentType(info os.FileInfo) uint8 {
+	if info.IsDir() {
+		return 4
+	}
+	return 8
+}
+
+// p9Stat encodes the stat structure of 9P2000 without the leading size.
+func p9Stat(name string, info os.FileInfo) []byte {
+	stat := &p9Encoder{}
+	stat.u16(0) // size, set below
+	stat.u16(0) // type
+	stat.u32(0) // dev
+	stat.qid(name, info)
+
+	mode, size := uint32(0444), uint64(info.Size())
+	if info.IsDir() {
+		mode, size = p9DMDir|0555, 0
+	}
+	stat.u32(mode)
+	stat.u32(uint32(info.ModTime().Unix())) // atime
+	stat.u32(uint32(info.ModTime().Unix())) // mtime
+	stat.u64(size)
+	if name == "." {
+		stat.str("/")
+	} else {
+		stat.str(info.Name())
+	}
+	stat.str("gofat") // uid
+	stat.str("gofat") // gid
+	stat.str("gofat") // muid
+
+	binary.LittleEndian.PutUint16(stat.data, uint16(len(stat.data)-2))
+	return stat.data
+}
+
+// p9Encoder builds a message body in the byte order of 9P.
+type p9Encoder struct {
+	data []byte
+}
+
+func (e *p9Encoder) u8(v uint8) {
+	e.data = append(e.data, v)
+}
+
+func (e *p9Encoder) u16(v uint16) {
+	e.data = append(e.data, byte(v), byte(v>>8))
+}
+
+func (e *p9Encoder) u32(v uint32) {
+	e.data = append(e.data, byte(v), byte(v>>8), byte(v>>16), byte(v>>24))
+}
+
+func (e *p9Encoder) u64(v uint64) {
+	e.u32(uint32(v))
+	e.u32(uint32(v >> 32))
+}
+
+func (e *p9Encoder) str(v string) {
+	e.u16(uint16(len(v)))
+	e.data = append(e.data, v...)
+}
+
+func (e *p9Encoder) bytes(v []byte) {
+	e.data = append(e.data, v...)
+}
+
+// qid encodes the qid of the file.
+func (e *p9Encoder) qid(name string, info os.FileInfo) {
+	if info.IsDir() {
+		e.u8(p9QTDir)
+	} else {
+		e.u8(p9QTFile)
+	}
+	e.u32(0) // version
+	e.u64(p9Path(name))
+}
+
+// p9Decoder reads a message body. After the first error all values are 0 and err is set.
+type p9Decoder struct {
+	data []byte
+	err  error
+}
+
+func (d *p9Decoder) take(n int) []byte {
+	if d.err != nil || len(d.data) < n {
+		d.err = errors.New("message too short")
+		return make([]byte, n)
+	}
+	value := d.data[:n]
+	d.data = d.data[n:]
+	return value
+}
+
+func (d *p9Decoder) u8() uint8 {
+	return d.take(1)[0]
+}
+
+func (d *p9Decoder) u16() uint16 {
+	return binary.LittleEndian.Uint16(d.take(2))
+}
+
+func (d *p9Decoder) u32() uint32 {
+	return binary.LittleEndian.Uint32(d.take(4))
+}
+
+func (d *p9Decoder) u64() uint64 {
+	return binary.LittleEndian.Uint64(d.take(8))
+}
+
+func (d *p9Decoder) str() string {
+	return string(d.take(int(d.u16())))
+}
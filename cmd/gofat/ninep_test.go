@@ -0,0 +1,355 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// p9Client sends requests to a p9Server over a net.Pipe.
+type p9Client struct {
+	t    *testing.T
+	conn net.Conn
+	// errs receives the result of serve after the server stopped.
+	errs chan error
+}
+
+func newP9Client(t *testing.T) *p9Client {
+	fs := testingFs(t)
+	client, server := net.Pipe()
+	s := &p9Server{fs: fs, size: fs.RawReader().Size(), conn: server, msize: p9MaxSize, fids: make(map[uint32]*p9Fid)}
+
+	c := &p9Client{t: t, conn: client, errs: make(chan error, 1)}
+	go func() {
+		err := s.serve()
+		_ = server.Close()
+		c.errs <- err
+	}()
+	t.Cleanup(func() { _ = client.Close() })
+	return c
+}
+
+// send writes a raw message.
+func (c *p9Client) send(msgType uint8, body []byte) {
+	c.t.Helper()
+	message := &p9Encoder{}
+	message.u32(uint32(p9HeaderSize + len(body)))
+	message.u8(msgType)
+	message.u16(1) // tag
+	message.bytes(body)
+	if _, err := c.conn.Write(message.data); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// rpc sends a request and returns the type and the body of the reply.
+func (c *p9Client) rpc(msgType uint8, body *p9Encoder) (uint8, *p9Decoder) {
+	c.t.Helper()
+	c.send(msgType, body.data)
+
+	header := make([]byte, p9HeaderSize)
+	if _, err := io.ReadFull(c.conn, header); err != nil {
+		c.t.Fatal(err)
+	}
+	reply := make([]byte, binary.LittleEndian.Uint32(header)-p9HeaderSize)
+	if _, err := io.ReadFull(c.conn, reply); err != nil {
+		c.t.Fatal(err)
+	}
+	if tag := binary.LittleEndian.Uint16(header[5:]); tag != 1 {
+		c.t.Fatalf("reply has the tag %d, want 1", tag)
+	}
+	return header[4], &p9Decoder{data: reply}
+}
+
+// call sends a request which has to succeed and returns the body of the reply.
+func (c *p9Client) call(msgType uint8, body *p9Encoder) *p9Decoder {
+	c.t.Helper()
+	replyType, reply := c.rpc(msgType, body)
+	switch replyType {
+	case msgType + 1:
+		return reply
+	case p9Terror + 1:
+		c.t.Fatalf("request %d failed with %v", msgType, reply.str())
+	case p9Tlerror + 1:
+		c.t.Fatalf("request %d failed with %v", msgType, syscall.Errno(reply.u32()))
+	}
+	c.t.Fatalf("request %d got the reply %d", msgType, replyType)
+	return nil
+}
+
+// fail sends a request which has to fail and returns the error.
+func (c *p9Client) fail(msgType uint8, body *p9Encoder) syscall.Errno {
+	c.t.Helper()
+	replyType, reply := c.rpc(msgType, body)
+	switch replyType {
+	case p9Terror + 1:
+		message := reply.str()
+		for errno := syscall.Errno(1); errno < 256; errno++ {
+			if errno.Error() == message {
+				return errno
+			}
+		}
+		c.t.Fatalf("request %d failed with the unknown error %v", msgType, message)
+	case p9Tlerror + 1:
+		return syscall.Errno(reply.u32())
+	}
+	c.t.Fatalf("request %d got the reply %d instead of an error", msgType, replyType)
+	return 0
+}
+
+func (c *p9Client) version(msize uint32, version string) (uint32, string) {
+	c.t.Helper()
+	request := &p9Encoder{}
+	request.u32(msize)
+	request.str(version)
+	reply := c.call(p9Tversion, request)
+	return reply.u32(), reply.str()
+}
+
+func (c *p9Client) attach(fid uint32) {
+	c.t.Helper()
+	request := &p9Encoder{}
+	request.u32(fid)
+	request.u32(^uint32(0)) // afid
+	request.str("user")
+	request.str("")
+	c.call(p9Tattach, request)
+}
+
+func p9Walk(fid, newFid uint32, names ...string) *p9Encoder {
+	request := &p9Encoder{}
+	request.u32(fid)
+	request.u32(newFid)
+	request.u16(uint16(len(names)))
+	for _, name := range names {
+		request.str(name)
+	}
+	return request
+}
+
+func p9Fids(fid uint32) *p9Encoder {
+	request := &p9Encoder{}
+	request.u32(fid)
+	return request
+}
+
+func p9Open(fid uint32, mode uint8) *p9Encoder {
+	request := p9Fids(fid)
+	request.u8(mode)
+	return request
+}
+
+func p9Read(fid uint32, offset uint64, count uint32) *p9Encoder {
+	request := p9Fids(fid)
+	request.u64(offset)
+	request.u32(count)
+	return request
+}
+
+func TestP9Server(t *testing.T) {
+	c := newP9Client(t)
+
+	msize, version := c.version(8192, p9Version)
+	if msize != 8192 || version != p9Version {
+		t.Fatalf("Rversion = %v %v, want 8192 %v", msize, version, p9Version)
+	}
+	c.attach(0)
+
+	// Read a file.
+	reply := c.call(p9Twalk, p9Walk(0, 1, "docs", "big.bin"))
+	if count := reply.u16(); count != 2 {
+		t.Fatalf("Rwalk returned %d qids, want 2", count)
+	}
+	if qidType := reply.u8(); qidType != p9QTDir {
+		t.Errorf("the qid of docs has the type %#x, want %#x", qidType, p9QTDir)
+	}
+
+	reply = c.call(p9Topen, p9Open(1, 0))
+	if qidType := reply.u8(); qidType != p9QTFile {
+		t.Errorf("the qid of big.bin has the type %#x, want %#x", qidType, p9QTFile)
+	}
+	reply.u32()
+	reply.u64()
+	if iounit := reply.u32(); iounit != 8192-p9ReadOverhead {
+		t.Errorf("Ropen iounit = %d, want %d", iounit, 8192-p9ReadOverhead)
+	}
+
+	want := testingContent["docs/big.bin"]
+	var got []byte
+	for {
+		// The count is bigger than the msize, so it has to be limited.
+		reply = c.call(p9Tread, p9Read(1, uint64(len(got)), 100000))
+		count := reply.u32()
+		if count > 8192-p9ReadOverhead {
+			t.Fatalf("Rread returned %d bytes which do not fit into the msize", count)
+		}
+		if count == 0 {
+			break
+		}
+		got = append(got, reply.take(int(count))...)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("Tread returned %d bytes which differ from the %d bytes of the file", len(got), len(want))
+	}
+
+	// Read the stat entries of a directory.
+	reply = c.call(p9Twalk, p9Walk(0, 2))
+	if count := reply.u16(); count != 0 {
+		t.Fatalf("Rwalk without names returned %d qids, want 0", count)
+	}
+	c.call(p9Topen, p9Open(2, 0))
+	reply = c.call(p9Tread, p9Read(2, 0, 8192))
+	var names []string
+	for entries := (&p9Decoder{data: reply.take(int(reply.u32()))}); len(entries.data) > 0; {
+		stat := &p9Decoder{data: entries.take(int(entries.u16()))}
+		stat.take(2 + 4 + 13 + 4 + 4 + 4 + 8) // type, dev, qid, mode, atime, mtime and length
+		names = append(names, stat.str())
+	}
+	sort.Strings(names)
+	if strings.Join(names, " ") != "README.txt docs" {
+		t.Errorf("Tread of the root returned %v, want [README.txt docs]", names)
+	}
+
+	// Clunk releases the fid.
+	c.call(p9Tclunk, p9Fids(1))
+	if errno := c.fail(p9Tread, p9Read(1, 0, 10)); errno != syscall.EBADF {
+		t.Errorf("Tread of a clunked fid failed with %v, want %v", errno, syscall.EBADF)
+	}
+}
+
+func TestP9Server_errors(t *testing.T) {
+	c := newP9Client(t)
+	c.version(p9MaxSize, p9Version)
+	c.attach(0)
+
+	if errno := c.fail(p9Twalk, p9Walk(0, 1, "missing")); errno != syscall.ENOENT {
+		t.Errorf("Twalk to a missing file failed with %v, want %v", errno, syscall.ENOENT)
+	}
+
+	// A partial walk returns the found qids but does not create the fid.
+	reply := c.call(p9Twalk, p9Walk(0, 1, "docs", "missing"))
+	if count := reply.u16(); count != 1 {
+		t.Errorf("Rwalk of a partial walk returned %d qids, want 1", count)
+	}
+	if errno := c.fail(p9Topen, p9Open(1, 0)); errno != syscall.EBADF {
+		t.Errorf("Topen of the fid of a partial walk failed with %v, want %v", errno, syscall.EBADF)
+	}
+
+	c.call(p9Twalk, p9Walk(0, 1, "README.txt"))
+	for _, mode := range []uint8{p9OWrite, p9ORdwr, p9OTrunc} {
+		if errno := c.fail(p9Topen, p9Open(1, mode)); errno != syscall.EROFS {
+			t.Errorf("Topen with the mode %#x failed with %v, want %v", mode, errno, syscall.EROFS)
+		}
+	}
+	if errno := c.fail(p9Tread, p9Read(1, 0, 10)); errno != syscall.EBADF {
+		t.Errorf("Tread of an unopened fid failed with %v, want %v", errno, syscall.EBADF)
+	}
+
+	if errno := c.fail(p9Tauth, &p9Encoder{}); errno != syscall.EOPNOTSUPP {
+		t.Errorf("Tauth failed with %v, want %v", errno, syscall.EOPNOTSUPP)
+	}
+	// Twrite
+	if errno := c.fail(118, p9Fids(1)); errno != syscall.EROFS {
+		t.Errorf("Twrite failed with %v, want %v", errno, syscall.EROFS)
+	}
+}
+
+func TestP9Server_9P2000L(t *testing.T) {
+	c := newP9Client(t)
+	if _, version := c.version(p9MaxSize, p9VersionL); version != p9VersionL {
+		t.Fatalf("Rversion = %v, want %v", version, p9VersionL)
+	}
+	c.attach(0)
+	c.call(p9Twalk, p9Walk(0, 1))
+
+	lopen := p9Fids(1)
+	lopen.u32(0)
+	c.call(p9Tlopen, lopen)
+
+	readdir := p9Read(1, 0, 8192)
+	reply := c.call(p9Treaddir, readdir)
+	var names []string
+	for entries := (&p9Decoder{data: reply.take(int(reply.u32()))}); len(entries.data) > 0; {
+		entries.take(13 + 8 + 1) // qid, offset and type
+		names = append(names, entries.str())
+	}
+	sort.Strings(names)
+	if strings.Join(names, " ") != "README.txt docs" {
+		t.Errorf("Treaddir of the root returned %v, want [README.txt docs]", names)
+	}
+
+	// 9P2000.L reports errors as errno with Rlerror.
+	c.call(p9Twalk, p9Walk(0, 2, "README.txt"))
+	lopen = p9Fids(2)
+	lopen.u32(p9LTrunc)
+	if errno := c.fail(p9Tlopen, lopen); errno != syscall.EROFS {
+		t.Errorf("Tlopen with O_TRUNC failed with %v, want %v", errno, syscall.EROFS)
+	}
+}
+
+func TestP9Server_version(t *testing.T) {
+	c := newP9Client(t)
+
+	// The msize is never increased above the limit of the server.
+	if msize, _ := c.version(10*p9MaxSize, p9Version); msize != p9MaxSize {
+		t.Errorf("Rversion msize = %d, want %d", msize, p9MaxSize)
+	}
+	if _, version := c.version(p9MaxSize, "9P2000.u"); version != "unknown" {
+		t.Errorf("Rversion for an unsupported version = %v, want unknown", version)
+	}
+}
+
+func TestP9Server_malformed(t *testing.T) {
+	tests := []struct {
+		name string
+		// send writes the malformed message after Tversion negotiated an msize of 512.
+		send    func(c *p9Client)
+		wantErr string
+	}{
+		{
+			name: "size smaller than the header",
+			send: func(c *p9Client) {
+				_, _ = c.conn.Write([]byte{3, 0, 0, 0, p9Tclunk, 1, 0})
+			},
+			wantErr: "invalid message size 3",
+		},
+		{
+			name: "size bigger than the msize",
+			send: func(c *p9Client) {
+				_, _ = c.conn.Write([]byte{0x01, 0x02, 0, 0, p9Twalk, 1, 0})
+			},
+			wantErr: "invalid message size 513",
+		},
+		{
+			name: "truncated body",
+			send: func(c *p9Client) {
+				c.send(p9Tattach, []byte{0, 0})
+			},
+			wantErr: "message too short",
+		},
+		{
+			name: "string longer than the message",
+			send: func(c *p9Client) {
+				c.send(p9Twalk, []byte{0, 0, 0, 0, 1, 0, 0, 0, 1, 0, 0xff, 0, 'a'})
+			},
+			wantErr: "message too short",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newP9Client(t)
+			c.version(512, p9Version)
+			c.attach(0)
+
+			tt.send(c)
+			if err := <-c.errs; err == nil || err.Error() != tt.wantErr {
+				t.Errorf("serve() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// progressInterval limits how often the progress line is redrawn.
+const progressInterval = 100 * time.Millisecond
+
+// progressLine shows the combined progress of several parts (e.g. images or files) as one line which is redrawn
+// in place. It is safe for concurrent use.
+type progressLine struct {
+	lock sync.Mutex
+	out  io.Writer
+	// total is the known total of all parts. If it is 0, the sum of the totals reported so far is used.
+	total int64
+	done  map[string]int64
+	// totals contains the total reported by each part.
+	totals map[string]int64
+	last   time.Time
+}
+
+// newProgressLine creates a progressLine writing to out. See progressLine.total for the meaning of total.
+func newProgressLine(out io.Writer, total int64) *progressLine {
+	return &progressLine{
+		out:    out,
+		total:  total,
+		done:   make(map[string]int64),
+		totals: make(map[string]int64),
+	}
+}
+
+// report returns a func which can be used as gofat.Options.Progress for the given part.
+func (p *progressLine) report(part string) func(done, total int64) {
+	return func(done, total int64) {
+		p.lock.Lock()
+		defer p.lock.Unlock()
+
+		p.done[part] = done
+		p.totals[part] = total
+		if time.Since(p.last) >= progressInterval {
+			p.print()
+		}
+	}
+}
+
+// finish draws the line a last time and ends it.
+func (p *progressLine) finish() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.print()
+	fmt.Fprintln(p.out)
+}
+
+// print redraws the line. The lock has to be held.
+func (p *progressLine) print() {
+	var done, total int64
+	for part, d := range p.done {
+		done += d
+		total += p.totals[part]
+	}
+	if p.total > 0 {
+		total = p.total
+	}
+
+	percent := int64(100)
+	if total > 0 {
+		percent = done * 100 / total
+	}
+
+	fmt.Fprintf(p.out, "\r%3d%% (%v of %v)   ", percent, formatSize(done), formatSize(total))
+	p.last = time.Now()
+}
+
+// formatSize formats a count of bytes using binary units.
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aligator/gofat"
+)
+
+// put copies files and directories of the host into a directory of an image.
+// Directories are copied with all their content, missing directories in the image are created and long names get
+// their LFN entries. Existing files are replaced.
+// If a source could not be copied, the exit code classifies the last failure.
+func put(args []string) int {
+	flags := flag.NewFlagSet("put", flag.ContinueOnError)
+	preserve := flags.Bool("p", false, "preserve the modification times")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s put [flags] source... image:dir\n\nFlags:\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return usageCode(err)
+	}
+
+	if flags.NArg() < 2 {
+		flags.Usage()
+		return exitUsage
+	}
+
+	destination := flags.Arg(flags.NArg() - 1)
+	separator := strings.LastIndex(destination, ":")
+	if separator < 0 {
+		fmt.Fprintf(os.Stderr, "%v: the destination has to be written as image:dir\n", destination)
+		return exitUsage
+	}
+
+	file, err := os.OpenFile(destination[:separator], os.O_RDWR, 0)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCode(err)
+	}
+	defer file.Close()
+
+	fs, err := gofat.New(file)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCode(err)
+	}
+
+	dir := path.Clean("/" + destination[separator+1:])[1:]
+	if dir == "" {
+		dir = "."
+	} else if err := fs.MkdirAll(dir, 0755); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCode(err)
+	}
+
+	code := exitOK
+	for _, source := range flags.Args()[:flags.NArg()-1] {
+		target := path.Join(dir, filepath.Base(source))
+		if err := putEntry(fs, source, target, *preserve); err != nil {
+			fmt.Fprintf(os.Stderr, "%v: %v\n", source, err)
+			code = exitCode(err)
+		}
+	}
+
+	return code
+}
+
+// putEntry copies a file or a directory with all its content from the host to the target in the image.
+// Entries which are neither files nor directories, like symlinks, are skipped.
+func putEntry(fs *gofat.Fs, source string, target string, preserve bool) error {
+	// The times of the directories are set at the end, as copying their content changes them.
+	var dirs []string
+	var times []time.Time
+	err := filepath.Walk(source, func(current string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relative, err := filepath.Rel(source, current)
+		if err != nil {
+			return err
+		}
+		name := path.Join(target, filepath.ToSlash(relative))
+
+		switch {
+		case info.IsDir():
+			dirs = append(dirs, name)
+			times = append(times, info.ModTime())
+			return fs.MkdirAll(name, 0755)
+		case !info.Mode().IsRegular():
+			fmt.Fprintf(os.Stderr, "%v: skipped as it is no regular file\n", current)
+			return nil
+		}
+
+		if err := putFile(fs, current, name, info.Mode()); err != nil {
+			return err
+		}
+		if preserve {
+			return fs.Chtimes(name, info.ModTime(), info.ModTime())
+		}
+		return nil
+	})
+	if err != nil || !preserve {
+		return err
+	}
+
+	for i := len(dirs) - 1; i >= 0; i-- {
+		// The root directory has no times.
+		if dirs[i] == "." {
+			continue
+		}
+		if err := fs.Chtimes(dirs[i], times[i], times[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// putFile copies a single file from the host into the image.
+// Like files created by OpenFile, it is marked as read only if the mode has no write permission for the owner.
+func putFile(fs *gofat.Fs, source string, name string, mode os.FileMode) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := fs.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode.Perm())
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(out, in)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
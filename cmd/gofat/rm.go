@@ -0,0 +1,102 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/aligator/gofat"
+)
+
+// rm removes files or, with -r, directory trees from images.
+// A path is written as 'image:path' and may contain wildcards, just like the sources of cp.
+// If a path could not be removed, the exit code classifies the last failure (e.g. exitNotFound without -f).
+func rm(args []string) int {
+	flags := flag.NewFlagSet("rm", flag.ContinueOnError)
+	recursive := flags.Bool("r", false, "remove directories with everything they contain")
+	force := flags.Bool("f", false, "ignore paths which do not exist")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s rm [flags] image:path...\n\nFlags:\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return usageCode(err)
+	}
+
+	if flags.NArg() < 1 {
+		flags.Usage()
+		return exitUsage
+	}
+
+	images := make(map[string]*gofat.Fs)
+	code := exitOK
+	for _, target := range flags.Args() {
+		separator := strings.LastIndex(target, ":")
+		if separator < 0 {
+			fmt.Fprintf(os.Stderr, "%v: the path has to be written as image:path\n", target)
+			return exitUsage
+		}
+
+		fs, ok := images[target[:separator]]
+		if !ok {
+			file, err := os.OpenFile(target[:separator], os.O_RDWR, 0)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return exitCode(err)
+			}
+			defer file.Close()
+
+			fs, err = gofat.New(file)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return exitCode(err)
+			}
+			images[target[:separator]] = fs
+		}
+
+		names, err := expandSource(fs, target[separator+1:])
+		if err != nil {
+			if !*force {
+				fmt.Fprintf(os.Stderr, "%v: %v\n", target, err)
+				code = exitCode(err)
+			}
+			continue
+		}
+
+		for _, name := range names {
+			err := removeEntry(fs, name, *recursive)
+			if *force && errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%v: %v\n", target, err)
+				code = exitCode(err)
+			}
+		}
+	}
+
+	return code
+}
+
+// removeEntry removes a file or, if recursive is set, a directory with everything it contains.
+// The root directory is never removed.
+func removeEntry(fs *gofat.Fs, name string, recursive bool) error {
+	if name == "." {
+		return errors.New("the root directory cannot be removed")
+	}
+
+	info, err := fs.Stat(name)
+	if err != nil {
+		return err
+	}
+
+	if !info.IsDir() {
+		return fs.Remove(name)
+	}
+	if !recursive {
+		return errors.New("is a directory (use -r to remove it)")
+	}
+	return fs.RemoveAll(name)
+}
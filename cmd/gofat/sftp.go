@@ -0,0 +1,485 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/aligator/gofat"
+	"github.com/spf13/afero"
+)
+
+// Packet types of SFTP version 3, see https://tools.ietf.org/html/draft-ietf-secsh-filexfer-02.
+const (
+	sftpInit     = 1
+	sftpVersion  = 2
+	sftpOpen     = 3
+	sftpClose    = 4
+	sftpRead     = 5
+	sftpLstat    = 7
+	sftpFstat    = 8
+	sftpOpendir  = 11
+	sftpReaddir  = 12
+	sftpRealpath = 16
+	sftpStat     = 17
+	sftpReadlink = 19
+	sftpExtended = 200
+
+	sftpStatus = 101
+	sftpHandle = 102
+	sftpData   = 103
+	sftpName   = 104
+	sftpAttrs  = 105
+)
+
+// Status codes of SSH_FXP_STATUS.
+const (
+	sftpOK               = 0
+	sftpEOF              = 1
+	sftpNoSuchFile       = 2
+	sftpPermissionDenied = 3
+	sftpFailure          = 4
+	sftpBadMessage       = 5
+	sftpOpUnsupported    = 8
+)
+
+const (
+	sftpProtocolVersion = 3
+
+	// sftpMaxPacket is the biggest packet accepted, the same limit as used by OpenSSH.
+	sftpMaxPacket = 256 * 1024
+	// sftpMaxRead is the biggest count of bytes returned by one read.
+	sftpMaxRead = 64 * 1024
+	// sftpReaddirCount is the count of entries returned by one readdir.
+	sftpReaddirCount = 100
+
+	// The open flags which would change the file.
+	sftpOpenWrite = 0x02 | 0x04 | 0x08 | 0x10 | 0x20
+
+	// The flags and file types of the attributes.
+	sftpAttrSize        = 0x1
+	sftpAttrPermissions = 0x4
+	sftpAttrACModTime   = 0x8
+	sftpModeDir         = 0040000
+	sftpModeFile        = 0100000
+)
+
+// sftp serves an image read-only over SFTP on stdin and stdout, just like the sftp-server of OpenSSH does it.
+// sshd provides the SSH transport, so standard clients can extract files from device images remotely, e.g. with
+// "Subsystem gofat /usr/local/bin/gofat sftp /dev/sdb1" in the sshd_config and "sftp -s gofat host".
+// If the image could not be opened or the connection failed, the exit code classifies the error.
+func sftp(args []string) int {
+	flags := flag.NewFlagSet("sftp", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s sftp image\n\n"+
+			"Speaks SFTP on stdin and stdout, e.g. as sshd subsystem or with: sftp -D '%s sftp image'\n", os.Args[0], os.Args[0])
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return usageCode(err)
+	}
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return exitUsage
+	}
+
+	file, err := os.Open(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCode(err)
+	}
+	defer file.Close()
+
+	fs, err := gofat.New(file)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCode(err)
+	}
+
+	s := &sftpServer{
+		fs:      fs,
+		r:       bufio.NewReader(os.Stdin),
+		w:       bufio.NewWriter(os.Stdout),
+		handles: make(map[string]*sftpFile),
+	}
+	if err := s.serve(); err != nil && !errors.Is(err, io.EOF) {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCode(err)
+	}
+	return exitOK
+}
+
+// sftpFile is an opened file or directory of the client.
+type sftpFile struct {
+	file afero.File
+	// dir is true for directories opened with SSH_FXP_OPENDIR.
+	dir bool
+}
+
+// sftpServer answers the requests of one client one after another.
+type sftpServer struct {
+	fs      afero.Fs
+	r       *bufio.Reader
+	w       *bufio.Writer
+	handles map[string]*sftpFile
+	// next is the number of the next handle.
+	next int
+}
+
+func (s *sftpServer) serve() error {
+	defer func() {
+		for _, f := range s.handles {
+			_ = f.file.Close()
+		}
+	}()
+
+	header := make([]byte, 5)
+	for {
+		if _, err := io.ReadFull(s.r, header); err != nil {
+			return err
+		}
+
+		length := binary.BigEndian.Uint32(header)
+		if length < 1 || length > sftpMaxPacket {
+			return fmt.Errorf("invalid packet length %d", length)
+		}
+
+		body := make([]byte, length-1)
+		if _, err := io.ReadFull(s.r, body); err != nil {
+			return err
+		}
+
+		packetType := header[4]
+		d := &sftpDecoder{data: body}
+		if packetType == sftpInit {
+			reply := &sftpEncoder{}
+			reply.u8(sftpVersion)
+			reply.u32(sftpProtocolVersion)
+			if err := s.send(reply); err != nil {
+				return err
+			}
+			continue
+		}
+
+		id := d.u32()
+		if d.err != nil {
+			return d.err
+		}
+		reply := &sftpEncoder{}
+		if err := s.handle(packetType, id, d, reply); err != nil {
+			reply = &sftpEncoder{}
+			reply.status(id, sftpStatusCode(err), err.Error())
+		}
+		if err := s.send(reply); err != nil {
+			return err
+		}
+	}
+}
+
+// sftpError is an error which is sent to the client with the given status code.
+type sftpError struct {
+	code    uint32
+	message string
+}
+
+func (e sftpError) Error() string {
+	return e.message
+}
+
+var (
+	errSftpReadOnly    = sftpError{sftpPermissionDenied, "the image is served read-only"}
+	errSftpUnsupported = sftpError{sftpOpUnsupported, "operation unsupported"}
+	errSftpBadHandle   = sftpError{sftpFailure, "invalid handle"}
+	errSftpBadMessage  = sftpError{sftpBadMessage, "bad message"}
+)
+
+// sftpStatusCode converts an error of the filesystem into the status code sent to the client.
+func sftpStatusCode(err error) uint32 {
+	var sftpErr sftpError
+	switch {
+	case errors.As(err, &sftpErr):
+		return sftpErr.code
+	case errors.Is(err, os.ErrNotExist):
+		return sftpNoSuchFile
+	case errors.Is(err, io.EOF):
+		return sftpEOF
+	default:
+		return sftpFailure
+	}
+}
+
+// handle answers a request. Requests which would change the image and unknown requests are rejected.
+func (s *sftpServer) handle(packetType uint8, id uint32, d *sftpDecoder, reply *sftpEncoder) error {
+	switch packetType {
+	case sftpRealpath:
+		name := sftpPath(d.str())
+		if d.err != nil {
+			return errSftpBadMessage
+		}
+		if name == "." {
+			name = ""
+		}
+		reply.u8(sftpName)
+		reply.u32(id)
+		reply.u32(1)
+		reply.str("/" + name)
+		reply.str("/" + name)
+		reply.u32(0) // no attributes
+		return nil
+
+	case sftpStat, sftpLstat:
+		name := sftpPath(d.str())
+		if d.err != nil {
+			return errSftpBadMessage
+		}
+		info, err := s.fs.Stat(name)
+		if err != nil {
+			return err
+		}
+		reply.u8(sftpAttrs)
+		reply.u32(id)
+		reply.attrs(info)
+		return nil
+
+	case sftpFstat:
+		f, err := s.handleOf(d.str(), false)
+		if err != nil {
+			return err
+		}
+		info, err := f.file.Stat()
+		if err != nil {
+			return err
+		}
+		reply.u8(sftpAttrs)
+		reply.u32(id)
+		reply.attrs(info)
+		return nil
+
+	case sftpOpen, sftpOpendir:
+		name := sftpPath(d.str())
+		if packetType == sftpOpen && d.u32()&sftpOpenWrite != 0 {
+			return errSftpReadOnly
+		}
+		if d.err != nil {
+			return errSftpBadMessage
+		}
+
+		file, err := s.fs.Open(name)
+		if err != nil {
+			return err
+		}
+		info, err := file.Stat()
+		if err != nil {
+			_ = file.Close()
+			return err
+		}
+		if info.IsDir() != (packetType == sftpOpendir) {
+			_ = file.Close()
+			if info.IsDir() {
+				return sftpError{sftpFailure, name + " is a directory"}
+			}
+			return sftpError{sftpFailure, name + " is not a directory"}
+		}
+
+		handle := strconv.Itoa(s.next)
+		s.next++
+		s.handles[handle] = &sftpFile{file: file, dir: info.IsDir()}
+		reply.u8(sftpHandle)
+		reply.u32(id)
+		reply.str(handle)
+		return nil
+
+	case sftpRead:
+		f, err := s.handleOf(d.str(), false)
+		offset, length := d.u64(), d.u32()
+		if d.err != nil {
+			return errSftpBadMessage
+		}
+		if err != nil {
+			return err
+		}
+		if length > sftpMaxRead {
+			length = sftpMaxRead
+		}
+
+		data := make([]byte, length)
+		n, err := f.file.ReadAt(data, int64(offset))
+		if n == 0 && err != nil {
+			return err
+		}
+		reply.u8(sftpData)
+		reply.u32(id)
+		reply.str(string(data[:n]))
+		return nil
+
+	case sftpReaddir:
+		f, err := s.handleOf(d.str(), true)
+		if err != nil {
+			return err
+		}
+		children, err := f.file.Readdir(sftpReaddirCount)
+		if len(children) == 0 {
+			if err == nil {
+				err = io.EOF
+			}
+			return err
+		}
+		reply.u8(sftpName)
+		reply.u32(id)
+		reply.u32(uint32(len(children)))
+		for _, child := range children {
+			reply.str(child.Name())
+			reply.str(sftpLongName(child))
+			reply.attrs(child)
+		}
+		return nil
+
+	case sftpClose:
+		handle := d.str()
+		f, err := s.handleOf(handle, false)
+		if err != nil {
+			return err
+		}
+		delete(s.handles, handle)
+		if err := f.file.Close(); err != nil {
+			return err
+		}
+		reply.status(id, sftpOK, "")
+		return nil
+
+	case sftpReadlink, sftpExtended:
+		// FAT has no links and no extensions are supported.
+		return errSftpUnsupported
+
+	default:
+		// Everything else changes the filesystem.
+		return errSftpReadOnly
+	}
+}
+
+// handleOf returns the opened file of the handle. dir tells if it has to be a directory.
+func (s *sftpServer) handleOf(handle string, dir bool) (*sftpFile, error) {
+	f, ok := s.handles[handle]
+	if !ok || dir && !f.dir {
+		return nil, errSftpBadHandle
+	}
+	return f, nil
+}
+
+// send writes the packet with its length.
+func (s *sftpServer) send(reply *sftpEncoder) error {
+	var length [4]byte
+	binary.BigEndian.PutUint32(length[:], uint32(len(reply.data)))
+	if _, err := s.w.Write(length[:]); err != nil {
+		return err
+	}
+	if _, err := s.w.Write(reply.data); err != nil {
+		return err
+	}
+	return s.w.Flush()
+}
+
+// sftpPath converts a path of the client into a path of the image. Relative paths start at the root.
+func sftpPath(name string) string {
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	if name == "" {
+		return "."
+	}
+	return name
+}
+
+// sftpLongName formats the entry like "ls -l" does it, which is shown by most clients.
+func sftpLongName(info os.FileInfo) string {
+	mode := "-r--r--r--"
+	if info.IsDir() {
+		mode = "dr-xr-xr-x"
+	}
+	return fmt.Sprintf("%s    1 gofat    gofat    %8d %s %s", mode, info.Size(), info.ModTime().Format("Jan _2 15:04"), info.Name())
+}
+
+// sftpEncoder builds a packet in the byte order of SFTP.
+type sftpEncoder struct {
+	data []byte
+}
+
+func (e *sftpEncoder) u8(v uint8) {
+	e.data = append(e.data, v)
+}
+
+func (e *sftpEncoder) u32(v uint32) {
+	e.data = append(e.data, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func (e *sftpEncoder) u64(v uint64) {
+	e.u32(uint32(v >> 32))
+	e.u32(uint32(v))
+}
+
+func (e *sftpEncoder) str(v string) {
+	e.u32(uint32(len(v)))
+	e.data = append(e.data, v...)
+}
+
+// status encodes an SSH_FXP_STATUS packet.
+func (e *sftpEncoder) status(id uint32, code uint32, message string) {
+	e.u8(sftpStatus)
+	e.u32(id)
+	e.u32(code)
+	e.str(message)
+	e.str("en")
+}
+
+// attrs encodes the attributes of the file. Everything is read-only.
+func (e *sftpEncoder) attrs(info os.FileInfo) {
+	e.u32(sftpAttrSize | sftpAttrPermissions | sftpAttrACModTime)
+	if info.IsDir() {
+		e.u64(0)
+		e.u32(sftpModeDir | 0555)
+	} else {
+		e.u64(uint64(info.Size()))
+		e.u32(sftpModeFile | 0444)
+	}
+	e.u32(uint32(info.ModTime().Unix())) // atime
+	e.u32(uint32(info.ModTime().Unix())) // mtime
+}
+
+// sftpDecoder reads a packet. After the first error all values are 0 and err is set.
+type sftpDecoder struct {
+	data []byte
+	err  error
+}
+
+func (d *sftpDecoder) take(n int) []byte {
+	if d.err != nil || n < 0 || len(d.data) < n {
+		d.err = errors.New("packet too short")
+		return make([]byte, 8)
+	}
+	value := d.data[:n]
+	d.data = d.data[n:]
+	return value
+}
+
+func (d *sftpDecoder) u32() uint32 {
+	return binary.BigEndian.Uint32(d.take(4))
+}
+
+func (d *sftpDecoder) u64() uint64 {
+	return binary.BigEndian.Uint64(d.take(8))
+}
+
+func (d *sftpDecoder) str() string {
+	length := d.u32()
+	if d.err != nil || length > uint32(len(d.data)) {
+		d.err = errors.New("packet too short")
+		return ""
+	}
+	return string(d.take(int(length)))
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// sftpClient sends packets to an sftpServer over a net.Pipe.
+type sftpClient struct {
+	t    *testing.T
+	conn net.Conn
+	// id is the id of the last request.
+	id uint32
+	// errs receives the result of serve after the server stopped.
+	errs chan error
+}
+
+func newSftpClient(t *testing.T) *sftpClient {
+	client, server := net.Pipe()
+	s := &sftpServer{
+		fs:      testingFs(t),
+		r:       bufio.NewReader(server),
+		w:       bufio.NewWriter(server),
+		handles: make(map[string]*sftpFile),
+	}
+
+	c := &sftpClient{t: t, conn: client, errs: make(chan error, 1)}
+	go func() {
+		err := s.serve()
+		_ = server.Close()
+		c.errs <- err
+	}()
+	t.Cleanup(func() { _ = client.Close() })
+	return c
+}
+
+// send writes a raw packet.
+func (c *sftpClient) send(packetType uint8, body []byte) {
+	c.t.Helper()
+	packet := &sftpEncoder{}
+	packet.u32(uint32(1 + len(body)))
+	packet.u8(packetType)
+	packet.data = append(packet.data, body...)
+	if _, err := c.conn.Write(packet.data); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// receive reads a packet and returns its type and body.
+func (c *sftpClient) receive() (uint8, *sftpDecoder) {
+	c.t.Helper()
+	var length [4]byte
+	if _, err := io.ReadFull(c.conn, length[:]); err != nil {
+		c.t.Fatal(err)
+	}
+	packet := make([]byte, binary.BigEndian.Uint32(length[:]))
+	if _, err := io.ReadFull(c.conn, packet); err != nil {
+		c.t.Fatal(err)
+	}
+	return packet[0], &sftpDecoder{data: packet[1:]}
+}
+
+// request sends a request with a new id followed by the fields, which are strings, uint32 or uint64 values.
+// It returns the type and the body of the reply after the id.
+func (c *sftpClient) request(packetType uint8, fields ...interface{}) (uint8, *sftpDecoder) {
+	c.t.Helper()
+	c.id++
+	body := &sftpEncoder{}
+	body.u32(c.id)
+	for _, field := range fields {
+		switch field := field.(type) {
+		case string:
+			body.str(field)
+		case uint32:
+			body.u32(field)
+		case uint64:
+			body.u64(field)
+		default:
+			c.t.Fatalf("unsupported field %T", field)
+		}
+	}
+	c.send(packetType, body.data)
+
+	replyType, reply := c.receive()
+	if id := reply.u32(); id != c.id {
+		c.t.Fatalf("reply has the id %d, want %d", id, c.id)
+	}
+	return replyType, reply
+}
+
+// call sends a request which has to be answered with the reply type.
+func (c *sftpClient) call(replyType uint8, packetType uint8, fields ...interface{}) *sftpDecoder {
+	c.t.Helper()
+	gotType, reply := c.request(packetType, fields...)
+	if gotType == sftpStatus && replyType != sftpStatus {
+		code, message := reply.u32(), reply.str()
+		c.t.Fatalf("request %d failed with status %d: %v", packetType, code, message)
+	}
+	if gotType != replyType {
+		c.t.Fatalf("request %d got the reply %d, want %d", packetType, gotType, replyType)
+	}
+	return reply
+}
+
+// status sends a request which has to be answered with a status and returns the status code.
+func (c *sftpClient) status(packetType uint8, fields ...interface{}) uint32 {
+	c.t.Helper()
+	return c.call(sftpStatus, packetType, fields...).u32()
+}
+
+func (c *sftpClient) init() {
+	c.t.Helper()
+	body := &sftpEncoder{}
+	body.u32(sftpProtocolVersion)
+	c.send(sftpInit, body.data)
+
+	replyType, reply := c.receive()
+	if replyType != sftpVersion {
+		c.t.Fatalf("SSH_FXP_INIT got the reply %d, want %d", replyType, sftpVersion)
+	}
+	if version := reply.u32(); version != sftpProtocolVersion {
+		c.t.Fatalf("SSH_FXP_VERSION = %d, want %d", version, sftpProtocolVersion)
+	}
+}
+
+// sftpAttrsOf decodes the size and the permissions of the attributes.
+func sftpAttrsOf(d *sftpDecoder) (flags uint32, size uint64, permissions uint32) {
+	flags, size, permissions = d.u32(), d.u64(), d.u32()
+	d.u32() // atime
+	d.u32() // mtime
+	return flags, size, permissions
+}
+
+func TestSftpServer(t *testing.T) {
+	c := newSftpClient(t)
+	c.init()
+
+	for name, want := range map[string]string{".": "/", "docs/../docs/": "/docs", "/../README.txt": "/README.txt"} {
+		reply := c.call(sftpName, sftpRealpath, name)
+		if count := reply.u32(); count != 1 {
+			t.Fatalf("SSH_FXP_REALPATH returned %d names, want 1", count)
+		}
+		if got := reply.str(); got != want {
+			t.Errorf("SSH_FXP_REALPATH %v = %v, want %v", name, got, want)
+		}
+	}
+
+	flags, size, permissions := sftpAttrsOf(c.call(sftpAttrs, sftpStat, "/docs/big.bin"))
+	if flags != sftpAttrSize|sftpAttrPermissions|sftpAttrACModTime || size != 16000 || permissions != sftpModeFile|0444 {
+		t.Errorf("SSH_FXP_STAT = %#x %d %o, want %#x 16000 %o", flags, size, permissions,
+			sftpAttrSize|sftpAttrPermissions|sftpAttrACModTime, sftpModeFile|0444)
+	}
+	if _, _, permissions := sftpAttrsOf(c.call(sftpAttrs, sftpLstat, "docs")); permissions != sftpModeDir|0555 {
+		t.Errorf("SSH_FXP_LSTAT of a directory has the permissions %o, want %o", permissions, sftpModeDir|0555)
+	}
+	if code := c.status(sftpStat, "/missing"); code != sftpNoSuchFile {
+		t.Errorf("SSH_FXP_STAT of a missing file = %d, want %d", code, sftpNoSuchFile)
+	}
+
+	// Read a file.
+	handle := c.call(sftpHandle, sftpOpen, "/docs/big.bin", uint32(0x01), uint32(0)).str()
+	if _, size, _ := sftpAttrsOf(c.call(sftpAttrs, sftpFstat, handle)); size != 16000 {
+		t.Errorf("SSH_FXP_FSTAT size = %d, want 16000", size)
+	}
+
+	var got []byte
+	for {
+		replyType, reply := c.request(sftpRead, handle, uint64(len(got)), uint32(4096))
+		if replyType == sftpStatus {
+			if code := reply.u32(); code != sftpEOF {
+				t.Fatalf("SSH_FXP_READ failed with status %d", code)
+			}
+			break
+		}
+		data := reply.str()
+		if len(data) > 4096 {
+			t.Fatalf("SSH_FXP_READ returned %d bytes, want at most 4096", len(data))
+		}
+		got = append(got, data...)
+	}
+	if !bytes.Equal(got, testingContent["docs/big.bin"]) {
+		t.Errorf("SSH_FXP_READ returned %d bytes which differ from the %d bytes of the file", len(got), len(testingContent["docs/big.bin"]))
+	}
+
+	// Reads are limited to sftpMaxRead.
+	if data := c.call(sftpData, sftpRead, handle, uint64(0), uint32(1024*1024)).str(); len(data) != 16000 {
+		t.Errorf("SSH_FXP_READ of 1 MiB returned %d bytes, want 16000", len(data))
+	}
+
+	if code := c.status(sftpClose, handle); code != sftpOK {
+		t.Errorf("SSH_FXP_CLOSE = %d, want %d", code, sftpOK)
+	}
+	if code := c.status(sftpRead, handle, uint64(0), uint32(10)); code != sftpFailure {
+		t.Errorf("SSH_FXP_READ of a closed handle = %d, want %d", code, sftpFailure)
+	}
+
+	// Read a directory.
+	handle = c.call(sftpHandle, sftpOpendir, "/").str()
+	reply := c.call(sftpName, sftpReaddir, handle)
+	var names []string
+	for count := reply.u32(); count > 0; count-- {
+		name, longName := reply.str(), reply.str()
+		_, _, permissions := sftpAttrsOf(reply)
+		if name == "docs" && (!strings.HasPrefix(longName, "dr-xr-xr-x") || permissions != sftpModeDir|0555) {
+			t.Errorf("SSH_FXP_READDIR returned %q with the permissions %o for a directory", longName, permissions)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if strings.Join(names, " ") != "README.txt docs" {
+		t.Errorf("SSH_FXP_READDIR of the root returned %v, want [README.txt docs]", names)
+	}
+	if code := c.status(sftpReaddir, handle); code != sftpEOF {
+		t.Errorf("SSH_FXP_READDIR after the last entry = %d, want %d", code, sftpEOF)
+	}
+
+	// Files and directories have to be opened with the matching request.
+	if code := c.status(sftpOpen, "/docs", uint32(0x01), uint32(0)); code != sftpFailure {
+		t.Errorf("SSH_FXP_OPEN of a directory = %d, want %d", code, sftpFailure)
+	}
+	if code := c.status(sftpOpendir, "/README.txt"); code != sftpFailure {
+		t.Errorf("SSH_FXP_OPENDIR of a file = %d, want %d", code, sftpFailure)
+	}
+	if code := c.status(sftpOpen, "/missing", uint32(0x01), uint32(0)); code != sftpNoSuchFile {
+		t.Errorf("SSH_FXP_OPEN of a missing file = %d, want %d", code, sftpNoSuchFile)
+	}
+}
+
+func TestSftpServer_readOnly(t *testing.T) {
+	c := newSftpClient(t)
+	c.init()
+
+	// The flags SSH_FXF_WRITE, SSH_FXF_APPEND, SSH_FXF_CREAT, SSH_FXF_TRUNC and SSH_FXF_EXCL.
+	for _, flags := range []uint32{0x02, 0x01 | 0x04, 0x08, 0x01 | 0x10, 0x20} {
+		if code := c.status(sftpOpen, "/README.txt", flags, uint32(0)); code != sftpPermissionDenied {
+			t.Errorf("SSH_FXP_OPEN with the flags %#x = %d, want %d", flags, code, sftpPermissionDenied)
+		}
+	}
+
+	tests := []struct {
+		name       string
+		packetType uint8
+		fields     []interface{}
+		wantCode   uint32
+	}{
+		{name: "SSH_FXP_WRITE", packetType: 6, fields: []interface{}{"0", uint64(0), "data"}, wantCode: sftpPermissionDenied},
+		{name: "SSH_FXP_SETSTAT", packetType: 9, fields: []interface{}{"/README.txt", uint32(0)}, wantCode: sftpPermissionDenied},
+		{name: "SSH_FXP_FSETSTAT", packetType: 10, fields: []interface{}{"0", uint32(0)}, wantCode: sftpPermissionDenied},
+		{name: "SSH_FXP_REMOVE", packetType: 13, fields: []interface{}{"/README.txt"}, wantCode: sftpPermissionDenied},
+		{name: "SSH_FXP_MKDIR", packetType: 14, fields: []interface{}{"/new", uint32(0)}, wantCode: sftpPermissionDenied},
+		{name: "SSH_FXP_RMDIR", packetType: 15, fields: []interface{}{"/docs"}, wantCode: sftpPermissionDenied},
+		{name: "SSH_FXP_RENAME", packetType: 18, fields: []interface{}{"/README.txt", "/moved"}, wantCode: sftpPermissionDenied},
+		{name: "SSH_FXP_SYMLINK", packetType: 20, fields: []interface{}{"/link", "/README.txt"}, wantCode: sftpPermissionDenied},
+		{name: "SSH_FXP_READLINK", packetType: sftpReadlink, fields: []interface{}{"/README.txt"}, wantCode: sftpOpUnsupported},
+		{name: "SSH_FXP_EXTENDED", packetType: sftpExtended, fields: []interface{}{"statvfs@openssh.com", "/"}, wantCode: sftpOpUnsupported},
+	}
+	for _, tt := range tests {
+		if code := c.status(tt.packetType, tt.fields...); code != tt.wantCode {
+			t.Errorf("%v = %d, want %d", tt.name, code, tt.wantCode)
+		}
+	}
+
+	if data := c.call(sftpData, sftpRead, c.call(sftpHandle, sftpOpen, "/README.txt", uint32(0x01), uint32(0)).str(), uint64(0), uint32(100)).str(); data != string(testingContent["README.txt"]) {
+		t.Errorf("the file was changed to %q", data)
+	}
+}
+
+func TestSftpServer_malformed(t *testing.T) {
+	// A request without the fields after the id is answered with SSH_FX_BAD_MESSAGE.
+	c := newSftpClient(t)
+	c.init()
+	for _, packetType := range []uint8{sftpRealpath, sftpStat, sftpOpen, sftpRead} {
+		if code := c.status(packetType); code != sftpBadMessage {
+			t.Errorf("request %d without fields = %d, want %d", packetType, code, sftpBadMessage)
+		}
+	}
+	// A string longer than the packet.
+	if code := c.status(sftpStat, uint32(1000), "/"); code != sftpBadMessage {
+		t.Errorf("SSH_FXP_STAT with a too long string = %d, want %d", code, sftpBadMessage)
+	}
+
+	tests := []struct {
+		name    string
+		send    func(c *sftpClient)
+		wantErr string
+	}{
+		{
+			name: "empty packet",
+			send: func(c *sftpClient) {
+				_, _ = c.conn.Write([]byte{0, 0, 0, 0, sftpStat})
+			},
+			wantErr: "invalid packet length 0",
+		},
+		{
+			name: "oversized packet",
+			send: func(c *sftpClient) {
+				length := &sftpEncoder{}
+				length.u32(sftpMaxPacket + 1)
+				_, _ = c.conn.Write(append(length.data, sftpStat))
+			},
+			wantErr: fmt.Sprintf("invalid packet length %d", sftpMaxPacket+1),
+		},
+		{
+			name: "packet without id",
+			send: func(c *sftpClient) {
+				c.send(sftpStat, []byte{0, 0})
+			},
+			wantErr: "packet too short",
+		},
+		{
+			name: "truncated packet",
+			send: func(c *sftpClient) {
+				_, _ = c.conn.Write([]byte{0, 0, 0, 100, sftpStat, 0, 0, 0, 1})
+				_ = c.conn.Close()
+			},
+			wantErr: io.ErrUnexpectedEOF.Error(),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newSftpClient(t)
+			c.init()
+
+			tt.send(c)
+			if err := <-c.errs; err == nil || err.Error() != tt.wantErr {
+				t.Errorf("serve() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
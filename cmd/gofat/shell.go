@@ -0,0 +1,358 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/aligator/gofat"
+)
+
+// shellCommand is a command of the interactive shell.
+type shellCommand struct {
+	name        string
+	usage       string
+	description string
+	run         func(sh *shell, args []string) error
+}
+
+// shellCommands contains all commands of the interactive shell in the order they are listed by help.
+// It is filled in init as help refers to it.
+var shellCommands []shellCommand
+
+func init() {
+	shellCommands = []shellCommand{
+		{name: "cd", usage: "cd [dir]", description: "change the current directory (to the root without a dir)", run: (*shell).cd},
+		{name: "pwd", usage: "pwd", description: "print the current directory", run: (*shell).pwd},
+		{name: "ls", usage: "ls [-l] [path]", description: "list a directory or show a file", run: (*shell).ls},
+		{name: "cat", usage: "cat path...", description: "print the content of files", run: (*shell).cat},
+		{name: "stat", usage: "stat path...", description: "print all details of the entries", run: (*shell).stat},
+		{name: "get", usage: "get path [host-path]", description: "copy a file from the image to the host", run: (*shell).get},
+		{name: "put", usage: "put host-path [path]", description: "copy a file or directory from the host into the image", run: (*shell).put},
+		{name: "help", usage: "help", description: "list the commands", run: (*shell).help},
+		{name: "exit", usage: "exit", description: "leave the shell (like quit and Ctrl+D)"},
+	}
+}
+
+// errShellUsage is returned by the shell commands if they are called with wrong arguments.
+var errShellUsage = errors.New("wrong arguments")
+
+// shell keeps the state of the interactive shell.
+type shell struct {
+	fs  *gofat.Fs
+	out io.Writer
+	// dir is the current directory. It is "." for the root.
+	dir string
+}
+
+// interactiveShell opens an image and reads commands from stdin until exit or the end of the input, similar to
+// mtools or debugfs. The image is opened read only if it is not writable.
+// Failing commands print their error and the shell continues. If the image could not be opened, the exit code
+// classifies the error.
+func interactiveShell(args []string) int {
+	flags := flag.NewFlagSet("shell", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s shell image\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return usageCode(err)
+	}
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return exitUsage
+	}
+
+	file, err := os.OpenFile(flags.Arg(0), os.O_RDWR, 0)
+	if os.IsPermission(err) {
+		fmt.Fprintf(os.Stderr, "%v: opened read only\n", flags.Arg(0))
+		file, err = os.Open(flags.Arg(0))
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCode(err)
+	}
+	defer file.Close()
+
+	fs, err := gofat.New(file)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCode(err)
+	}
+
+	sh := &shell{fs: fs, out: os.Stdout, dir: "."}
+	scanner := bufio.NewScanner(os.Stdin)
+	for {
+		fmt.Fprintf(sh.out, "gofat:/%v> ", strings.TrimPrefix(sh.dir, "."))
+		if !scanner.Scan() {
+			fmt.Fprintln(sh.out)
+			break
+		}
+
+		words, err := splitWords(scanner.Text())
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			continue
+		}
+		if len(words) == 0 {
+			continue
+		}
+		if words[0] == "exit" || words[0] == "quit" {
+			break
+		}
+
+		if err := sh.exec(words[0], words[1:]); err != nil {
+			fmt.Fprintf(os.Stderr, "%v: %v\n", words[0], err)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCode(err)
+	}
+	return exitOK
+}
+
+// exec runs a single command.
+func (sh *shell) exec(name string, args []string) error {
+	for _, command := range shellCommands {
+		if command.name != name || command.run == nil {
+			continue
+		}
+
+		err := command.run(sh, args)
+		if errors.Is(err, errShellUsage) {
+			return fmt.Errorf("usage: %v", command.usage)
+		}
+		return err
+	}
+
+	return fmt.Errorf("unknown command, see help")
+}
+
+// resolve returns the path inside the image for a path relative to the current directory or starting with a slash.
+func (sh *shell) resolve(name string) string {
+	if !strings.HasPrefix(name, "/") {
+		name = path.Join("/", sh.dir, name)
+	}
+
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	if name == "" {
+		return "."
+	}
+	return name
+}
+
+func (sh *shell) cd(args []string) error {
+	if len(args) > 1 {
+		return errShellUsage
+	}
+
+	dir := "."
+	if len(args) == 1 {
+		dir = sh.resolve(args[0])
+	}
+
+	info, err := sh.fs.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%v: not a directory", dir)
+	}
+
+	sh.dir = dir
+	return nil
+}
+
+func (sh *shell) pwd(args []string) error {
+	if len(args) != 0 {
+		return errShellUsage
+	}
+
+	_, err := fmt.Fprintf(sh.out, "/%v\n", strings.TrimPrefix(sh.dir, "."))
+	return err
+}
+
+func (sh *shell) ls(args []string) error {
+	long := len(args) > 0 && args[0] == "-l"
+	if long {
+		args = args[1:]
+	}
+	if len(args) > 1 {
+		return errShellUsage
+	}
+
+	name := sh.dir
+	if len(args) == 1 {
+		name = sh.resolve(args[0])
+	}
+
+	info, err := sh.fs.Stat(name)
+	if err != nil {
+		return err
+	}
+
+	entries := []os.FileInfo{info}
+	if info.IsDir() {
+		dir, err := sh.fs.Open(name)
+		if err != nil {
+			return err
+		}
+		entries, err = dir.Readdir(-1)
+		_ = dir.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, entry := range entries {
+		if long {
+			fmt.Fprintln(sh.out, lsLong(entry))
+		} else {
+			fmt.Fprintln(sh.out, entry.Name())
+		}
+	}
+	return nil
+}
+
+func (sh *shell) cat(args []string) error {
+	if len(args) == 0 {
+		return errShellUsage
+	}
+
+	for _, name := range args {
+		if err := catFile(sh.fs, sh.resolve(name), sh.out); err != nil {
+			return fmt.Errorf("%v: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func (sh *shell) stat(args []string) error {
+	if len(args) == 0 {
+		return errShellUsage
+	}
+
+	for _, name := range args {
+		info, err := sh.fs.Stat(sh.resolve(name))
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(sh.out, "Name:        %v\n", info.Name())
+		fmt.Fprintf(sh.out, "Size:        %d\n", info.Size())
+		fmt.Fprintf(sh.out, "Mode:        %v\n", info.Mode())
+		fmt.Fprintf(sh.out, "Modified:    %v\n", info.ModTime().Format("2006-01-02 15:04:05"))
+		if fatInfo, ok := info.(gofat.FileInfo); ok {
+			entry := fatInfo.Entry()
+			fmt.Fprintf(sh.out, "Created:     %v\n", fatInfo.CreateTime().Format("2006-01-02 15:04:05.00"))
+			fmt.Fprintf(sh.out, "Accessed:    %v\n", fatInfo.AccessDate().Format("2006-01-02"))
+			fmt.Fprintf(sh.out, "Short name:  %v\n", entry.ShortName())
+			fmt.Fprintf(sh.out, "Attributes:  %v\n", strings.Fields(lsLong(info))[0])
+			fmt.Fprintf(sh.out, "Cluster:     %d\n", entry.FirstCluster())
+		}
+	}
+	return nil
+}
+
+func (sh *shell) get(args []string) error {
+	if len(args) != 1 && len(args) != 2 {
+		return errShellUsage
+	}
+
+	name := sh.resolve(args[0])
+	target := path.Base(name)
+	if len(args) == 2 {
+		target = args[1]
+		if info, err := os.Stat(target); err == nil && info.IsDir() {
+			target = filepath.Join(target, path.Base(name))
+		}
+	}
+
+	info, err := sh.fs.Stat(name)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("%v: is a directory", name)
+	}
+
+	_, err = extractFile(sh.fs, name, target, "")
+	return err
+}
+
+func (sh *shell) put(args []string) error {
+	if len(args) != 1 && len(args) != 2 {
+		return errShellUsage
+	}
+
+	target := path.Join(sh.dir, filepath.Base(args[0]))
+	if len(args) == 2 {
+		target = sh.resolve(args[1])
+		if info, err := sh.fs.Stat(target); err == nil && info.IsDir() {
+			target = path.Join(target, filepath.Base(args[0]))
+		}
+	}
+
+	return putEntry(sh.fs, args[0], target, false)
+}
+
+func (sh *shell) help(args []string) error {
+	for _, command := range shellCommands {
+		fmt.Fprintf(sh.out, "  %-22s %v\n", command.usage, command.description)
+	}
+	return nil
+}
+
+// splitWords splits a command line at spaces. Spaces inside of single or double quotes and spaces escaped by a
+// backslash are kept, e.g. for names like "My Documents".
+func splitWords(line string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	var quote rune
+	escaped := false
+
+	for _, c := range line {
+		switch {
+		case escaped:
+			word.WriteRune(c)
+			escaped = false
+		case c == '\\' && quote != '\'':
+			escaped = true
+			inWord = true
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote != 0:
+			word.WriteRune(c)
+		case c == '"' || c == '\'':
+			quote = c
+			inWord = true
+		case c == ' ' || c == '\t':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(c)
+			inWord = true
+		}
+	}
+
+	if quote != 0 || escaped {
+		return nil, fmt.Errorf("unterminated quote or escape")
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/aligator/gofat"
+)
+
+// stats prints the count, the size and the allocated size of the files of an image grouped by their extension,
+// with the extensions using the most space first.
+// If the image or the path could not be read, the exit code classifies the error.
+func stats(args []string) int {
+	flags := flag.NewFlagSet("stats", flag.ContinueOnError)
+	asJSON := flags.Bool("json", false, "print the statistics as JSON")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s stats [flags] image [path]\n\nFlags:\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return usageCode(err)
+	}
+
+	if flags.NArg() != 1 && flags.NArg() != 2 {
+		flags.Usage()
+		return exitUsage
+	}
+
+	name := "."
+	if flags.NArg() == 2 {
+		name = strings.TrimPrefix(path.Clean("/"+flags.Arg(1)), "/")
+		if name == "" {
+			name = "."
+		}
+	}
+
+	file, err := openImageFile(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCode(err)
+	}
+	defer file.Close()
+
+	fs, err := gofat.New(file)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCode(err)
+	}
+
+	extensions, err := fs.UsageByExtension(name)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCode(err)
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(extensions)
+	} else {
+		err = printStats(extensions)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCode(err)
+	}
+	return exitOK
+}
+
+// printStats prints the usage of each extension as a table with a share of the allocated size and a total line.
+func printStats(extensions []gofat.ExtensionUsage) error {
+	var total gofat.ExtensionUsage
+	for _, usage := range extensions {
+		total.Files += usage.Files
+		total.Size += usage.Size
+		total.Allocated += usage.Allocated
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "EXTENSION\tFILES\tSIZE\tALLOCATED\tSHARE")
+	for _, usage := range extensions {
+		extension := usage.Extension
+		if extension == "" {
+			extension = "(none)"
+		}
+
+		share := 0.0
+		if total.Allocated > 0 {
+			share = float64(usage.Allocated) * 100 / float64(total.Allocated)
+		}
+		fmt.Fprintf(w, "%v\t%d\t%d\t%d\t%.1f%%\n", extension, usage.Files, usage.Size, usage.Allocated, share)
+	}
+	fmt.Fprintf(w, "total\t%d\t%d\t%d\n", total.Files, total.Size, total.Allocated)
+	return w.Flush()
+}
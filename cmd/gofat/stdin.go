@@ -0,0 +1,56 @@
+package main
+
+import (
+	"io"
+	"os"
+)
+
+// stdinImage is the image argument to read the image from stdin, e.g. "curl ... | gofat ls - docs".
+const stdinImage = "-"
+
+// imageFile is an image opened read only by openImageFile.
+type imageFile interface {
+	io.ReadSeeker
+	io.ReaderAt
+	io.Closer
+}
+
+// openImageFile opens the image read only. If the name is "-", the image is read from stdin.
+// gofat has to seek inside of the image, so stdin is used directly only if it is a regular file (e.g. "< image.img").
+// Otherwise it is spooled into a temporary file first, which is removed again on Close. This way even big images
+// piped into the command are never loaded into memory.
+func openImageFile(name string) (imageFile, error) {
+	if name != stdinImage {
+		return os.Open(name)
+	}
+
+	if info, err := os.Stdin.Stat(); err == nil && info.Mode().IsRegular() {
+		return os.Stdin, nil
+	}
+
+	spool, err := os.CreateTemp("", "gofat-*.img")
+	if err != nil {
+		return nil, err
+	}
+
+	file := spooledImage{spool}
+	if _, err := io.Copy(spool, os.Stdin); err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	return file, nil
+}
+
+// spooledImage is the temporary file containing the image read from stdin.
+type spooledImage struct {
+	*os.File
+}
+
+// Close closes and removes the temporary file.
+func (s spooledImage) Close() error {
+	err := s.File.Close()
+	if removeErr := os.Remove(s.File.Name()); err == nil {
+		err = removeErr
+	}
+	return err
+}
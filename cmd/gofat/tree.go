@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/aligator/gofat"
+)
+
+// treeCounts are the counts of directories and files printed by tree.
+type treeCounts struct {
+	dirs  int
+	files int
+}
+
+// tree renders the directory hierarchy of an image, in the order of the entries.
+// If the image or the path could not be read, the exit code classifies the error.
+func tree(args []string) int {
+	flags := flag.NewFlagSet("tree", flag.ContinueOnError)
+	sizes := flags.Bool("s", false, "print the size of each file")
+	depth := flags.Int("L", 0, "descend at most this many directories deep (0 means no limit)")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s tree [flags] image [path]\n\nFlags:\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return usageCode(err)
+	}
+
+	if flags.NArg() != 1 && flags.NArg() != 2 || *depth < 0 {
+		flags.Usage()
+		return exitUsage
+	}
+
+	name := "."
+	if flags.NArg() == 2 {
+		name = strings.TrimPrefix(path.Clean("/"+flags.Arg(1)), "/")
+		if name == "" {
+			name = "."
+		}
+	}
+
+	file, err := openImageFile(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCode(err)
+	}
+	defer file.Close()
+
+	fs, err := gofat.New(file)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCode(err)
+	}
+
+	info, err := fs.Stat(name)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCode(err)
+	}
+	if !info.IsDir() {
+		fmt.Fprintf(os.Stderr, "%v: not a directory\n", name)
+		return exitUsage
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	fmt.Fprintln(out, name)
+
+	var counts treeCounts
+	err = printTree(out, fs, name, "", 1, *depth, *sizes, &counts)
+	fmt.Fprintf(out, "\n%v, %v\n", plural(counts.dirs, "directory", "directories"), plural(counts.files, "file", "files"))
+	if flushErr := out.Flush(); err == nil {
+		err = flushErr
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCode(err)
+	}
+	return exitOK
+}
+
+// printTree prints the entries of the directory with the lines of its parents as indent and descends into the
+// subdirectories up to the max depth (0 means no limit).
+func printTree(w io.Writer, fs *gofat.Fs, dir string, indent string, depth int, maxDepth int, sizes bool, counts *treeCounts) error {
+	entries, _, err := fs.ListPage(dir, "", 0)
+	if err != nil {
+		return err
+	}
+
+	for i, entry := range entries {
+		branch, childIndent := "├── ", "│   "
+		if i == len(entries)-1 {
+			branch, childIndent = "└── ", "    "
+		}
+
+		size := ""
+		if sizes && !entry.IsDir() {
+			size = fmt.Sprintf("[%10d]  ", entry.Size())
+		}
+		fmt.Fprintf(w, "%v%v%v%v\n", indent, branch, size, entry.Name())
+
+		if !entry.IsDir() {
+			counts.files++
+			continue
+		}
+
+		counts.dirs++
+		if maxDepth == 0 || depth < maxDepth {
+			err := printTree(w, fs, path.Join(dir, entry.Name()), indent+childIndent, depth+1, maxDepth, sizes, counts)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// plural returns the count with the singular or plural noun.
+func plural(count int, singular string, plural string) string {
+	if count == 1 {
+		return fmt.Sprintf("%d %v", count, singular)
+	}
+	return fmt.Sprintf("%d %v", count, plural)
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/aligator/gofat"
+)
+
+// undelete lists the deleted entries of an image and restores the matching files into a host directory with -o.
+// A pattern without a slash is matched against the names, otherwise against the whole paths. Like FAT itself, the
+// pattern ignores the case.
+// It exits with exitFailure if a matching file could not be recovered. If the image could not be read, the exit
+// code classifies the error.
+func undelete(args []string) int {
+	flags := flag.NewFlagSet("undelete", flag.ContinueOnError)
+	output := flags.String("o", "", "restore the matching files into this directory instead of listing them")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s undelete [flags] image [pattern]\n\nFlags:\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return usageCode(err)
+	}
+
+	if flags.NArg() != 1 && flags.NArg() != 2 {
+		flags.Usage()
+		return exitUsage
+	}
+
+	pattern := "*"
+	if flags.NArg() == 2 {
+		pattern = strings.TrimPrefix(flags.Arg(1), "/")
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		fmt.Fprintf(os.Stderr, "%v: %v\n", pattern, err)
+		return exitUsage
+	}
+
+	file, err := openImageFile(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCode(err)
+	}
+	defer file.Close()
+
+	fs, err := gofat.New(file)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCode(err)
+	}
+
+	deleted, err := fs.Deleted(".")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCode(err)
+	}
+
+	code := exitOK
+	for _, entry := range deleted {
+		name := entry.Path
+		if !strings.Contains(pattern, "/") {
+			name = path.Base(entry.Path)
+		}
+		if ok, _ := path.Match(strings.ToUpper(pattern), strings.ToUpper(name)); !ok {
+			continue
+		}
+
+		if *output == "" {
+			fmt.Println(undeleteLine(entry))
+			continue
+		}
+
+		if entry.Attribute&gofat.AttrDirectory != 0 {
+			continue
+		}
+
+		if err := restoreDeleted(fs, entry, *output); err != nil {
+			fmt.Fprintf(os.Stderr, "%v: %v\n", entry.Path, err)
+			code = exitFailure
+			continue
+		}
+		fmt.Println(entry.Path)
+	}
+
+	return code
+}
+
+// undeleteLine formats a deleted entry like "recoverable        1024  2021-01-20 21:59:42  docs/readme.txt".
+func undeleteLine(entry gofat.DeletedEntry) string {
+	state := "recoverable"
+	if !entry.Recoverable {
+		state = "overwritten"
+	}
+
+	info := entry.FileInfo()
+	size := fmt.Sprint(info.Size())
+	if info.IsDir() {
+		size = "<DIR>"
+	}
+
+	modTime := "-"
+	if !info.ModTime().IsZero() {
+		modTime = info.ModTime().Format("2006-01-02 15:04:05")
+	}
+
+	return fmt.Sprintf("%-11s %10s  %-19s  %s", state, size, modTime, entry.Path)
+}
+
+// restoreDeleted writes the recovered data of the deleted file below the output directory with its modification time.
+func restoreDeleted(fs *gofat.Fs, entry gofat.DeletedEntry, output string) error {
+	data, err := fs.ReadDeleted(entry)
+	if err != nil {
+		return err
+	}
+
+	target := filepath.Join(output, filepath.FromSlash(entry.Path))
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(target, data, 0644); err != nil {
+		return err
+	}
+
+	modTime := entry.FileInfo().ModTime()
+	return os.Chtimes(target, modTime, modTime)
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+
+	"github.com/aligator/gofat"
+	"github.com/spf13/afero"
+)
+
+// verify reads every file and directory of an image completely, e.g. to validate an image after a transfer.
+// Unreadable entries and cluster chains which do not match the size of their file are printed as problems on
+// stderr. With -sum the SHA-256 digest of each file is printed in the manifest format of extract -verify.
+// It exits with exitCorrupt if problems were found. If the image could not be opened, the exit code classifies the
+// error.
+func verify(args []string) int {
+	flags := flag.NewFlagSet("verify", flag.ContinueOnError)
+	sum := flags.Bool("sum", false, "print the SHA-256 digest of each file like sha256sum")
+	quiet := flags.Bool("q", false, "do not print the summary")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s verify [flags] image\n\nFlags:\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return usageCode(err)
+	}
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return exitUsage
+	}
+
+	file, err := openImageFile(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCode(err)
+	}
+	defer file.Close()
+
+	fs, err := gofat.New(file)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCode(err)
+	}
+
+	var files, problems int
+	var bytes int64
+	err = afero.Walk(fs, ".", func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			// Report unreadable directories but go on with the rest of the image.
+			fmt.Fprintf(os.Stderr, "%v: unreadable: %v\n", name, err)
+			problems++
+			return nil
+		}
+
+		if problem := verifyChain(fs, name, info); problem != "" {
+			fmt.Fprintf(os.Stderr, "%v: %v\n", name, problem)
+			problems++
+			return nil
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		var digest hash.Hash
+		if *sum {
+			digest = sha256.New()
+		}
+		n, err := verifyFile(fs, name, digest)
+		bytes += n
+		files++
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v: unreadable: %v\n", name, err)
+			problems++
+			return nil
+		}
+
+		if digest != nil {
+			fmt.Printf("%v  %v\n", hex.EncodeToString(digest.Sum(nil)), name)
+		}
+		return nil
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCode(err)
+	}
+
+	if !*quiet {
+		fmt.Fprintf(os.Stderr, "%d files with %d bytes read, %d problems found\n", files, bytes, problems)
+	}
+	if problems > 0 {
+		return exitCorrupt
+	}
+	return exitOK
+}
+
+// verifyChain checks that the cluster chain of the entry ends with an end of chain marker and, for files, that it
+// has exactly the clusters needed for the size. It returns an empty string if the chain is valid.
+func verifyChain(fs *gofat.Fs, name string, info os.FileInfo) string {
+	chain, err := fs.ClusterChain(name)
+	if err != nil {
+		return fmt.Sprintf("broken cluster chain: %v", err)
+	}
+	if len(chain) == 0 {
+		if !info.IsDir() && info.Size() > 0 {
+			return fmt.Sprintf("the file has a size of %d bytes but no clusters", info.Size())
+		}
+		return ""
+	}
+
+	last, err := fs.FatEntries(chain[len(chain)-1], 1)
+	if err != nil {
+		return fmt.Sprintf("broken cluster chain: %v", err)
+	}
+	if last[0].Kind != gofat.FatEOF {
+		return fmt.Sprintf("the cluster chain ends with the %v cluster %d instead of EOF", last[0], last[0].Cluster)
+	}
+
+	if info.IsDir() {
+		return ""
+	}
+
+	fsInfo := fs.Info()
+	clusterSize := int64(fsInfo.SectorsPerCluster) * int64(fsInfo.BytesPerSector)
+	if needed := (info.Size() + clusterSize - 1) / clusterSize; needed != int64(len(chain)) {
+		return fmt.Sprintf("the file needs %d clusters for %d bytes but its chain has %d", needed, info.Size(), len(chain))
+	}
+	return ""
+}
+
+// verifyFile reads the whole file and writes it into the digest if it is not nil.
+// It returns the count of bytes read.
+func verifyFile(fs *gofat.Fs, name string, digest hash.Hash) (int64, error) {
+	file, err := fs.Open(name)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	var w io.Writer = io.Discard
+	if digest != nil {
+		w = digest
+	}
+	return io.Copy(w, file)
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/aligator/gofat"
+	"golang.org/x/net/webdav"
+)
+
+// davMethods are the methods supported by the read-only WebDAV server.
+const davMethods = "OPTIONS, GET, HEAD, PROPFIND"
+
+// webdavCommand exposes an image read-only over WebDAV, so that it can be browsed with the file manager of any OS
+// without mounting it.
+// The protocol is handled by golang.org/x/net/webdav. Only the read-only subset of WebDAV class 1 is offered:
+// all methods which change something are rejected.
+// If the image could not be opened or the server failed, the exit code classifies the error.
+func webdavCommand(args []string) int {
+	flags := flag.NewFlagSet("webdav", flag.ContinueOnError)
+	addr := flags.String("addr", "localhost:8080", "the address to listen on")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s webdav [flags] image\n\nFlags:\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return usageCode(err)
+	}
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return exitUsage
+	}
+
+	file, err := openImageFile(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCode(err)
+	}
+	defer file.Close()
+
+	fs, err := gofat.New(file)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCode(err)
+	}
+
+	fmt.Printf("Serving '%v' read-only on http://%v/\n", fs.Label(), *addr)
+	err = http.ListenAndServe(*addr, newDavHandler(gofat.GoFs{Fs: fs}))
+	fmt.Fprintln(os.Stderr, err)
+	return exitCode(err)
+}
+
+// davHandler serves a filesystem read-only over WebDAV.
+// It rejects the methods which change something before they reach the webdav.Handler and answers OPTIONS itself,
+// as the webdav.Handler would announce them. GET and HEAD are handled by an http.FileServer, which also lists
+// directories for browsers.
+type davHandler struct {
+	dav   *webdav.Handler
+	files http.Handler
+}
+
+func newDavHandler(fs gofat.GoFs) *davHandler {
+	return &davHandler{
+		dav: &webdav.Handler{
+			FileSystem: davFileSystem{fs: fs},
+			// Locking is not offered, but the webdav.Handler needs a LockSystem.
+			LockSystem: webdav.NewMemLS(),
+		},
+		files: http.FileServer(http.FS(fs)),
+	}
+}
+
+func (h *davHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodOptions:
+		w.Header().Set("Allow", davMethods)
+		w.Header().Set("DAV", "1")
+		w.Header().Set("MS-Author-Via", "DAV")
+	case http.MethodGet, http.MethodHead:
+		h.files.ServeHTTP(w, r)
+	case "PROPFIND":
+		h.dav.ServeHTTP(w, r)
+	default:
+		w.Header().Set("Allow", davMethods)
+		http.Error(w, "the image is served read-only", http.StatusMethodNotAllowed)
+	}
+}
+
+// davPath converts the path of a request into a path of the filesystem.
+func davPath(name string) string {
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	if name == "" {
+		return "."
+	}
+	return name
+}
+
+// davError converts the errors of gofat into the errors of the os package, as the webdav.Handler checks them
+// with os.IsNotExist which does not unwrap errors.
+func davError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, os.ErrNotExist):
+		return os.ErrNotExist
+	case errors.Is(err, os.ErrPermission):
+		return os.ErrPermission
+	}
+	return err
+}
+
+// davFileSystem adapts a GoFs to webdav.FileSystem. All methods which change something fail with
+// os.ErrPermission.
+type davFileSystem struct {
+	fs gofat.GoFs
+}
+
+var _ webdav.FileSystem = davFileSystem{}
+
+func (d davFileSystem) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	return os.ErrPermission
+}
+
+func (d davFileSystem) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND) != 0 {
+		return nil, os.ErrPermission
+	}
+
+	file, err := d.fs.Open(davPath(name))
+	if err != nil {
+		return nil, davError(err)
+	}
+	return davFile{file.(gofat.GoFile)}, nil
+}
+
+func (d davFileSystem) RemoveAll(ctx context.Context, name string) error {
+	return os.ErrPermission
+}
+
+func (d davFileSystem) Rename(ctx context.Context, oldName, newName string) error {
+	return os.ErrPermission
+}
+
+func (d davFileSystem) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	info, err := d.fs.Stat(davPath(name))
+	return info, davError(err)
+}
+
+// davFile is a file opened by the davFileSystem. It cannot be written.
+type davFile struct {
+	gofat.GoFile
+}
+
+var _ webdav.File = davFile{}
+
+func (f davFile) Write(p []byte) (int, error) {
+	return 0, os.ErrPermission
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/aligator/gofat"
+)
+
+func TestDavHandler(t *testing.T) {
+	fs := testingFs(t)
+	server := httptest.NewServer(newDavHandler(gofat.GoFs{Fs: fs}))
+	defer server.Close()
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		depth      string
+		body       string
+		wantStatus int
+		// wantBody has to be contained in the body of the response.
+		wantBody []string
+	}{
+		{name: "list the root", method: "PROPFIND", path: "/", depth: "1", wantStatus: http.StatusMultiStatus,
+			wantBody: []string{"<D:href>/</D:href>", "<D:href>/README.txt</D:href>", "<D:href>/docs/</D:href>", "<D:collection"}},
+		{name: "properties of a file", method: "PROPFIND", path: "/docs/big.bin", depth: "0", wantStatus: http.StatusMultiStatus,
+			wantBody: []string{"<D:getcontentlength>16000</D:getcontentlength>"}},
+		{name: "properties of a missing file", method: "PROPFIND", path: "/missing", depth: "0", wantStatus: http.StatusNotFound},
+		{name: "get a file", method: http.MethodGet, path: "/README.txt", wantStatus: http.StatusOK, wantBody: []string{"hello gofat\n"}},
+		{name: "list a directory", method: http.MethodGet, path: "/docs/", wantStatus: http.StatusOK, wantBody: []string{"big.bin"}},
+		{name: "put", method: http.MethodPut, path: "/README.txt", body: "changed", wantStatus: http.StatusMethodNotAllowed},
+		{name: "delete", method: http.MethodDelete, path: "/README.txt", wantStatus: http.StatusMethodNotAllowed},
+		{name: "mkcol", method: "MKCOL", path: "/new", wantStatus: http.StatusMethodNotAllowed},
+		{name: "move", method: "MOVE", path: "/README.txt", wantStatus: http.StatusMethodNotAllowed},
+		{name: "lock", method: "LOCK", path: "/README.txt", wantStatus: http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request, err := http.NewRequest(tt.method, server.URL+tt.path, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.depth != "" {
+				request.Header.Set("Depth", tt.depth)
+			}
+
+			response, err := http.DefaultClient.Do(request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer response.Body.Close()
+			body, err := io.ReadAll(response.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if response.StatusCode != tt.wantStatus {
+				t.Fatalf("%v %v = %v, want %v", tt.method, tt.path, response.StatusCode, tt.wantStatus)
+			}
+			for _, want := range tt.wantBody {
+				if !bytes.Contains(body, []byte(want)) {
+					t.Errorf("%v %v returned %s, want it to contain %v", tt.method, tt.path, body, want)
+				}
+			}
+		})
+	}
+
+	data, err := gofat.GoFs{Fs: fs}.ReadFile("README.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, testingContent["README.txt"]) {
+		t.Errorf("the file was changed to %q", data)
+	}
+}
+
+func TestDavHandler_options(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	newDavHandler(gofat.GoFs{Fs: testingFs(t)}).ServeHTTP(recorder, httptest.NewRequest(http.MethodOptions, "/", nil))
+
+	if allow := recorder.Header().Get("Allow"); allow != davMethods {
+		t.Errorf("Allow = %v, want %v", allow, davMethods)
+	}
+	if dav := recorder.Header().Get("DAV"); dav != "1" {
+		t.Errorf("DAV = %v, want 1", dav)
+	}
+}
+
+func TestDavFileSystem_readOnly(t *testing.T) {
+	fs := davFileSystem{fs: gofat.GoFs{Fs: testingFs(t)}}
+	ctx := context.Background()
+
+	if _, err := fs.OpenFile(ctx, "/README.txt", os.O_RDWR, 0); !errors.Is(err, os.ErrPermission) {
+		t.Errorf("OpenFile() for writing error = %v, want %v", err, os.ErrPermission)
+	}
+	if err := fs.Mkdir(ctx, "/new", 0755); !errors.Is(err, os.ErrPermission) {
+		t.Errorf("Mkdir() error = %v, want %v", err, os.ErrPermission)
+	}
+	if err := fs.RemoveAll(ctx, "/docs"); !errors.Is(err, os.ErrPermission) {
+		t.Errorf("RemoveAll() error = %v, want %v", err, os.ErrPermission)
+	}
+	if err := fs.Rename(ctx, "/README.txt", "/moved"); !errors.Is(err, os.ErrPermission) {
+		t.Errorf("Rename() error = %v, want %v", err, os.ErrPermission)
+	}
+	if _, err := fs.Stat(ctx, "/missing"); !os.IsNotExist(err) {
+		t.Errorf("Stat() error = %v, want os.IsNotExist", err)
+	}
+
+	file, err := fs.OpenFile(ctx, "/README.txt", os.O_RDONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if _, err := file.Write([]byte("changed")); !errors.Is(err, os.ErrPermission) {
+		t.Errorf("Write() error = %v, want %v", err, os.ErrPermission)
+	}
+}
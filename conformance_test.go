@@ -0,0 +1,164 @@
+package gofat
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// fsckTool returns the path of an installed fsck for FAT filesystems or an empty string.
+func fsckTool() string {
+	for _, name := range []string{"fsck.fat", "fsck.vfat", "dosfsck"} {
+		if path, err := exec.LookPath(name); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// TestConformance_VolumeOnly checks that images without any files, which only carry a label and a volume ID,
+// are valid. If fsck.fat (dosfstools) is installed, it has to accept them as well.
+// Run only this target with: go test -run Conformance
+func TestConformance_VolumeOnly(t *testing.T) {
+	const mib = 1024 * 1024
+
+	tests := []struct {
+		name      string
+		opts      FormatOptions
+		label     string
+		volumeID  uint32
+		wantLabel string
+		wantEntry []string
+	}{
+		{
+			name:      "FAT16 without label",
+			opts:      FormatOptions{Size: 16 * mib, VolumeID: 0x12345678},
+			volumeID:  0x12345678,
+			wantLabel: "NO NAME",
+		},
+		{
+			name:      "FAT16 with label",
+			opts:      FormatOptions{Size: 16 * mib, Label: "boot", VolumeID: 0xCAFEBABE},
+			volumeID:  0xCAFEBABE,
+			wantLabel: "BOOT",
+			wantEntry: []string{"BOOT"},
+		},
+		{
+			name:      "FAT16 label and volume ID set later",
+			opts:      FormatOptions{Size: 16 * mib},
+			label:     "data",
+			volumeID:  0x0BADF00D,
+			wantLabel: "DATA",
+			wantEntry: []string{"DATA"},
+		},
+		{
+			name:      "FAT12 with label",
+			opts:      FormatOptions{Size: 1440 * 1024, Label: "floppy", VolumeID: 0x1440},
+			volumeID:  0x1440,
+			wantLabel: "FLOPPY",
+			wantEntry: []string{"FLOPPY"},
+		},
+		{
+			name:      "FAT12 label and volume ID set later",
+			opts:      FormatOptions{Size: 4 * mib},
+			label:     "data",
+			volumeID:  0x0BADF00D,
+			wantLabel: "DATA",
+			wantEntry: []string{"DATA"},
+		},
+		{
+			name:      "FAT32 without label",
+			opts:      FormatOptions{Size: 128 * mib, FSType: FAT32, VolumeID: 0x1},
+			volumeID:  0x1,
+			wantLabel: "NO NAME",
+		},
+		{
+			name:      "FAT32 with label",
+			opts:      FormatOptions{Size: 128 * mib, FSType: FAT32, Label: "VOLUME", VolumeID: 0xDEADBEEF},
+			volumeID:  0xDEADBEEF,
+			wantLabel: "VOLUME",
+			wantEntry: []string{"VOLUME"},
+		},
+		{
+			name:      "FAT32 label and volume ID set later",
+			opts:      FormatOptions{Size: 128 * mib, FSType: FAT32, Label: "OLD"},
+			label:     "new",
+			volumeID:  0xFFFFFFFF,
+			wantLabel: "NEW",
+			wantEntry: []string{"NEW"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			image := testingImage(t)
+			if err := Format(image, tt.opts); err != nil {
+				t.Fatalf("Format() error = %v", err)
+			}
+
+			if tt.label != "" || tt.opts.VolumeID == 0 {
+				fs := testingNew(t, image)
+				if tt.label != "" {
+					if err := fs.SetLabel(tt.label); err != nil {
+						t.Fatalf("Fs.SetLabel() error = %v", err)
+					}
+				}
+				if err := fs.SetVolumeID(tt.volumeID); err != nil {
+					t.Fatalf("Fs.SetVolumeID() error = %v", err)
+				}
+			}
+
+			fs := testingNew(t, image)
+			if got := fs.Label(); got != tt.wantLabel {
+				t.Errorf("Fs.Label() = %v, want %v", got, tt.wantLabel)
+			}
+			if got := fs.VolumeID(); got != tt.volumeID {
+				t.Errorf("Fs.VolumeID() = %#x, want %#x", got, tt.volumeID)
+			}
+			if got := labelEntries(t, fs); !equalStrings(got, tt.wantEntry) {
+				t.Errorf("label entries = %v, want %v", got, tt.wantEntry)
+			}
+			if got := readDirNames(t, fs, "."); len(got) != 0 {
+				t.Errorf("root directory = %v, want no entries", got)
+			}
+
+			report, err := fs.Check()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !report.OK() || report.Files != 0 {
+				t.Errorf("Fs.Check() = %+v, want an empty filesystem without findings", report)
+			}
+
+			if got := image.data[510:512]; !bytes.Equal(got, []byte{0x55, 0xAA}) {
+				t.Errorf("boot sector signature = %x, want 55aa", got)
+			}
+			if tt.opts.FSType == FAT32 {
+				backup := int(fs.info.fat32Specific.BkBootSector) * 512
+				if !bytes.Equal(image.data[:512], image.data[backup:backup+512]) {
+					t.Errorf("backup boot sector differs from the boot sector")
+				}
+			}
+
+			tool := fsckTool()
+			if tool == "" {
+				t.Skip("fsck.fat is not installed")
+			}
+
+			file := filepath.Join(t.TempDir(), "image.img")
+			if err := ioutil.WriteFile(file, image.data, 0666); err != nil {
+				t.Fatal(err)
+			}
+			output, err := exec.Command(tool, "-n", "-v", file).CombinedOutput()
+			if err != nil {
+				t.Errorf("%v -n -v error = %v, output:\n%s", tool, err, output)
+			}
+
+			// fsck must not have changed anything.
+			if got, err := ioutil.ReadFile(file); err != nil || !bytes.Equal(got, image.data) {
+				t.Errorf("%v changed the image, error = %v", tool, err)
+			}
+		})
+	}
+}
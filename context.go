@@ -0,0 +1,49 @@
+package gofat
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/aligator/gofat/checkpoint"
+)
+
+// WithContext returns a copy of the filesystem which stops reading from the underlying reader as soon as the
+// context is canceled or its deadline is exceeded. The operation then returns the error of the context,
+// which can be checked using errors.Is (e.g. errors.Is(err, context.Canceled)).
+// This allows to cancel or time-bound long operations like reading big files or scanning large directories
+// on slow readers (e.g. network block devices).
+//
+// Files opened through the copy use the context for all their reads.
+// Operations which modify the filesystem only check the context before they start. Once started they are
+// always finished, so that a cancellation never leaves the filesystem in an inconsistent state.
+//
+// The copy shares the reader, the caches, the Info and all locks with the original filesystem, so both can be used
+// at the same time and changes made through one of them are seen by the other.
+func (f *Fs) WithContext(ctx context.Context) *Fs {
+	if ctx == nil {
+		panic("nil context")
+	}
+
+	fs := *f
+	fs.ctx = ctx
+	fs.mutating = 0
+	return &fs
+}
+
+// Context returns the context of the filesystem. It is context.Background() if WithContext was not used.
+func (f *Fs) Context() context.Context {
+	if f.ctx == nil {
+		return context.Background()
+	}
+	return f.ctx
+}
+
+// canceled returns the error of the context if it is done.
+// It returns nil while a modifying operation is running, see WithContext.
+func (f *Fs) canceled() error {
+	if f.ctx == nil || atomic.LoadInt32(&f.mutating) != 0 {
+		return nil
+	}
+
+	return checkpoint.From(f.ctx.Err())
+}
@@ -0,0 +1,148 @@
+package gofat
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+func TestFs_WithContext(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	expired, cancelExpired := context.WithTimeout(context.Background(), -time.Second)
+	defer cancelExpired()
+
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		wantErr error
+	}{
+		{name: "background", ctx: context.Background(), wantErr: nil},
+		{name: "canceled", ctx: canceled, wantErr: context.Canceled},
+		{name: "deadline exceeded", ctx: expired, wantErr: context.DeadlineExceeded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs, err := NewWithOptions(testFileReader(fat16), Options{CacheSize: 1, IndexSize: -1})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ctxFs := fs.WithContext(tt.ctx)
+			if ctxFs.Context() != tt.ctx {
+				t.Errorf("Fs.Context() = %v, want %v", ctxFs.Context(), tt.ctx)
+			}
+
+			_, err = ctxFs.Stat("DoNotEdit_tests/README.md")
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil) != (err == nil) {
+				t.Errorf("Fs.Stat() error = %v, want %v", err, tt.wantErr)
+			}
+
+			// The original filesystem is not affected.
+			if _, err := fs.Stat("DoNotEdit_tests/README.md"); err != nil {
+				t.Errorf("Fs.Stat() of the original filesystem error = %v", err)
+			}
+		})
+	}
+}
+
+func TestFs_WithContext_readFile(t *testing.T) {
+	fs, err := NewWithOptions(testFileReader(fat16), Options{CacheSize: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	file, err := fs.WithContext(ctx).Open("DoNotEdit_tests/README.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buffer := make([]byte, fs.info.BytesPerSector)
+	if _, err := io.ReadFull(file, buffer); err != nil {
+		t.Fatal(err)
+	}
+
+	// The next sector is not cached, so reading it has to stop.
+	cancel()
+	if _, err := io.ReadFull(file, buffer); !errors.Is(err, context.Canceled) {
+		t.Errorf("File.Read() after canceling error = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestFs_WithContext_mutate(t *testing.T) {
+	image := &hookedImage{testImage: testingImage(t)}
+	if err := Format(image, FormatOptions{Size: 32 * 1024 * 1024}); err != nil {
+		t.Fatal(err)
+	}
+	fs, err := NewWithOptions(image, Options{CacheSize: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A canceled context prevents the modification.
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := fs.WithContext(canceled).Mkdir("canceled", 0777); !errors.Is(err, context.Canceled) {
+		t.Errorf("Fs.Mkdir() error = %v, want %v", err, context.Canceled)
+	}
+
+	// Canceling while the modification already runs does not interrupt it.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	image.hook = cancel
+	if err := fs.WithContext(ctx).Mkdir("started", 0777); err != nil {
+		t.Errorf("Fs.Mkdir() error = %v", err)
+	}
+	if ctx.Err() == nil {
+		t.Fatal("the context was not canceled while creating the directory")
+	}
+
+	if got := readDirNames(t, fs, "."); len(got) != 1 || got[0] != "started" {
+		t.Errorf("the root contains %v, want only 'started'", got)
+	}
+	if report, err := fs.Check(); err != nil || !report.OK() {
+		t.Errorf("Fs.Check() = %v, %v", report, err)
+	}
+}
+
+func TestFs_WithContext_sharesInfo(t *testing.T) {
+	fs := testingFormat(t, FormatOptions{Size: 32 * 1024 * 1024, Label: "OLD"})
+	ctxFs := fs.WithContext(context.Background())
+
+	if err := ctxFs.SetLabel("NEW"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ctxFs.SetVolumeID(0x12345678); err != nil {
+		t.Fatal(err)
+	}
+	if got := fs.Label(); got != "NEW" {
+		t.Errorf("Fs.Label() of the original = %v, want NEW", got)
+	}
+	if got := fs.VolumeID(); got != 0x12345678 {
+		t.Errorf("Fs.VolumeID() of the original = %#x, want 0x12345678", got)
+	}
+
+	// The original must not allocate clusters behind the end of the shrunk filesystem.
+	if err := ctxFs.Shrink(24 * 1024 * 1024); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := fs.Info(), ctxFs.Info(); got != want {
+		t.Errorf("Fs.Info() of the original = %+v, want %+v", got, want)
+	}
+	if got := int64(fs.Info().TotalSectorCount) * int64(fs.Info().BytesPerSector); got != 24*1024*1024 {
+		t.Errorf("the original has a size of %d bytes, want %d", got, 24*1024*1024)
+	}
+
+	if err := afero.WriteFile(fs, "file", testData(20*1024*1024), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if report, err := fs.Check(); err != nil || !report.OK() {
+		t.Errorf("Fs.Check() = %+v, %v", report, err)
+	}
+}
@@ -0,0 +1,332 @@
+package gofat
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"syscall"
+
+	"github.com/aligator/gofat/checkpoint"
+)
+
+// CopyFile copies the file src to dst inside of the filesystem.
+// The data is copied cluster by cluster directly from sector to sector, so no File and no small reads are involved.
+// The copy gets the attributes and timestamps of src.
+// If dst is an existing file, it is replaced. Neither src nor dst may be a directory.
+func (f *Fs) CopyFile(src, dst string) error {
+	srcPath, err := cleanPath(src)
+	if err != nil {
+		return checkpoint.Wrap(err, ErrWriteFilesystem)
+	}
+
+	dstPath, err := cleanPath(dst)
+	if err != nil {
+		return checkpoint.Wrap(err, ErrWriteFilesystem)
+	}
+
+	err = f.mutate(Mutation{Op: OpCopy, Path: srcPath, Target: dstPath}, func() error {
+		return f.copyFile(srcPath, dstPath)
+	})
+	return checkpoint.Wrap(err, ErrWriteFilesystem)
+}
+
+// copyFile copies the file at srcPath to dstPath, see CopyFile.
+func (f *Fs) copyFile(srcPath, dstPath string) error {
+	srcRef, err := f.resolve(srcPath)
+	if err != nil {
+		return err
+	}
+	if srcRef.isDir() {
+		return checkpoint.From(syscall.EISDIR)
+	}
+
+	parent, name, err := f.resolveParent(dstPath)
+	if err != nil {
+		return err
+	}
+
+	existing, err := f.resolve(dstPath)
+	replace := err == nil
+	if replace {
+		if existing.isDir() {
+			return checkpoint.From(syscall.EISDIR)
+		}
+		if existing.dirCluster == srcRef.dirCluster && existing.index == srcRef.index {
+			return checkpoint.From(fmt.Errorf("%w: cannot copy '%v' onto itself", ErrInvalidPath, srcPath))
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	// Copy the data before touching dst, so that a failing copy (e.g. as the filesystem is full) leaves it as it was.
+	cluster, err := f.cloneData(f, srcRef.EntryHeader.firstCluster(), int64(srcRef.FileSize))
+	if err != nil {
+		return err
+	}
+
+	if replace {
+		err = f.removeEntry(existing)
+		if err != nil {
+			_ = f.freeChain(cluster)
+			return err
+		}
+	}
+
+	header := srcRef.EntryHeader
+	header.Name = [11]byte{}
+	header.setFirstCluster(cluster)
+	_, err = f.addDirEntry(f.entryDirCluster(parent), name, header)
+	if err != nil {
+		_ = f.freeChain(cluster)
+		return err
+	}
+
+	return nil
+}
+
+// CollisionPolicy decides what CopyTree does with entries whose name already exists in the target directory.
+type CollisionPolicy int
+
+const (
+	// CollisionFail stops copying with an error matching os.ErrExist.
+	CollisionFail CollisionPolicy = iota
+	// CollisionSkip keeps the existing entry and skips the copied one including all of its content.
+	CollisionSkip
+	// CollisionReplace replaces existing files. Existing directories are merged with the copied ones.
+	CollisionReplace
+	// CollisionRename gives the copy a free name by adding a number, e.g. "file (2).txt".
+	CollisionRename
+)
+
+// CopyOptions configure CopyTree.
+type CopyOptions struct {
+	// Collision decides what happens with names which already exist in the target.
+	// Names may also collide if the source compares names differently than the target (see Options.MatchName),
+	// e.g. "a.txt" and "A.TXT" of a case-sensitive source are the same name for a default target.
+	Collision CollisionPolicy
+
+	// Move removes the source entries after everything was copied, so the source has to be writable.
+	// Skipped entries and the directories containing them are kept.
+	Move bool
+}
+
+// CopyTree copies the file or directory src of this filesystem to the path dst of the target filesystem,
+// including the whole content of directories. The filesystems may have a different FAT type and cluster size.
+// Timestamps and attributes are preserved, the short names are generated by the target.
+//
+// The parent directory of dst has to exist. If src is the root directory, its content is copied into the
+// directory dst, which is created if it does not exist.
+// The target must not be this filesystem, use CopyFile or Rename for that.
+// The source is not locked while copying, so it should not be modified meanwhile.
+// If copying fails, the entries copied so far are kept in the target and nothing is removed from the source.
+func (f *Fs) CopyTree(target *Fs, src, dst string, opts CopyOptions) error {
+	srcPath, err := cleanPath(src)
+	if err != nil {
+		return checkpoint.Wrap(err, ErrWriteFilesystem)
+	}
+
+	dstPath, err := cleanPath(dst)
+	if err != nil {
+		return checkpoint.Wrap(err, ErrWriteFilesystem)
+	}
+
+	if target.writeLock == f.writeLock {
+		return checkpoint.Wrap(fmt.Errorf("%w: cannot copy a tree into the same filesystem", ErrInvalidPath), ErrWriteFilesystem)
+	}
+
+	c := &treeCopy{
+		src:       f,
+		dst:       target,
+		collision: opts.Collision,
+	}
+
+	err = target.mutate(Mutation{Op: OpCopy, Path: srcPath, Target: dstPath}, func() error {
+		return c.copyPath(srcPath, dstPath)
+	})
+	if err != nil {
+		return checkpoint.Wrap(err, ErrWriteFilesystem)
+	}
+
+	if opts.Move {
+		err = f.mutate(Mutation{Op: OpRemove, Path: srcPath}, c.removeCopied)
+	}
+	return checkpoint.Wrap(err, ErrWriteFilesystem)
+}
+
+// treeCopy holds the state of a running CopyTree.
+type treeCopy struct {
+	src       *Fs
+	dst       *Fs
+	collision CollisionPolicy
+	// copied contains the source paths of all copied entries. Directories come before their content.
+	copied []string
+}
+
+// copyPath copies the entry at srcPath to dstPath.
+func (c *treeCopy) copyPath(srcPath, dstPath string) error {
+	ref, err := c.src.resolve(srcPath)
+	if err != nil {
+		return err
+	}
+
+	if !ref.isRoot() {
+		parent, name, err := c.dst.resolveParent(dstPath)
+		if err != nil {
+			return err
+		}
+		return c.copyEntry(ref, srcPath, c.dst.entryDirCluster(parent), name)
+	}
+
+	dir, err := c.dst.resolve(dstPath)
+	if errors.Is(err, os.ErrNotExist) {
+		var parent entryRef
+		var name string
+		parent, name, err = c.dst.resolveParent(dstPath)
+		if err != nil {
+			return err
+		}
+		dir, err = c.dst.mkdirAt(c.dst.entryDirCluster(parent), name, newEntryHeader(AttrDirectory, c.dst.clock.Now()))
+	}
+	if err != nil {
+		return err
+	}
+	if !dir.isDir() {
+		return checkpoint.Wrap(syscall.ENOTDIR, fmt.Errorf("%w: %v", ErrInvalidPath, dstPath))
+	}
+
+	return c.copyDir(ref, srcPath, c.dst.entryDirCluster(dir))
+}
+
+// copyDir copies the content of the source directory into the target directory starting at dirCluster.
+func (c *treeCopy) copyDir(dir entryRef, srcPath string, dirCluster fatEntry) error {
+	refs, err := c.src.readDirRefs(c.src.entryDirCluster(dir))
+	if err != nil {
+		return err
+	}
+
+	for _, ref := range refs {
+		name := ref.FileInfo().Name()
+		err = c.copyEntry(ref, path.Join(srcPath, name), dirCluster, name)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// copyEntry copies the source entry with the given name into the target directory starting at dirCluster.
+func (c *treeCopy) copyEntry(ref entryRef, srcPath string, dirCluster fatEntry, name string) error {
+	existing, found, err := c.dst.lookupEntry(dirCluster, name)
+	if err != nil {
+		return err
+	}
+
+	replace := false
+	if found {
+		switch c.collision {
+		case CollisionSkip:
+			return nil
+		case CollisionReplace:
+			if existing.isDir() != ref.isDir() {
+				if existing.isDir() {
+					return checkpoint.Wrap(syscall.EISDIR, fmt.Errorf("%w: %v", ErrInvalidPath, srcPath))
+				}
+				return checkpoint.Wrap(syscall.ENOTDIR, fmt.Errorf("%w: %v", ErrInvalidPath, srcPath))
+			}
+
+			if existing.isDir() {
+				c.copied = append(c.copied, srcPath)
+				return c.copyDir(ref, srcPath, existing.firstCluster())
+			}
+			replace = true
+		case CollisionRename:
+			name, err = c.dst.freeName(dirCluster, name)
+			if err != nil {
+				return err
+			}
+		default:
+			return checkpoint.From(fmt.Errorf("%w: %v", os.ErrExist, srcPath))
+		}
+	}
+
+	header := ref.EntryHeader
+	header.Name = [11]byte{}
+	header.setFirstCluster(0)
+
+	if ref.isDir() {
+		newRef, err := c.dst.mkdirAt(dirCluster, name, header)
+		if err != nil {
+			return err
+		}
+
+		c.copied = append(c.copied, srcPath)
+		return c.copyDir(ref, srcPath, newRef.firstCluster())
+	}
+
+	cluster, err := c.src.cloneData(c.dst, ref.firstCluster(), int64(ref.FileSize))
+	if err != nil {
+		return checkpoint.Wrap(err, fmt.Errorf("%w: %v", ErrReadFilesystemFile, srcPath))
+	}
+
+	if replace {
+		err = c.dst.removeEntry(existing)
+		if err != nil {
+			_ = c.dst.freeChain(cluster)
+			return err
+		}
+	}
+
+	header.setFirstCluster(cluster)
+	_, err = c.dst.addDirEntry(dirCluster, name, header)
+	if err != nil {
+		_ = c.dst.freeChain(cluster)
+		return err
+	}
+
+	c.copied = append(c.copied, srcPath)
+	return nil
+}
+
+// removeCopied removes all copied entries from the source. Directories which still contain skipped entries are kept.
+func (c *treeCopy) removeCopied() error {
+	for i := len(c.copied) - 1; i >= 0; i-- {
+		ref, err := c.src.resolve(c.copied[i])
+		if err != nil {
+			return err
+		}
+
+		err = c.src.removeEntry(ref)
+		if errors.Is(err, syscall.ENOTEMPTY) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// freeName returns the name with the lowest number added, e.g. "file (2).txt", which does not exist yet
+// in the directory starting at dirCluster.
+func (f *Fs) freeName(dirCluster fatEntry, name string) (string, error) {
+	ext := path.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	if base == "" {
+		base, ext = name, ""
+	}
+
+	for i := 2; ; i++ {
+		candidate := fmt.Sprintf("%v (%d)%v", base, i, ext)
+		_, found, err := f.lookupEntry(dirCluster, candidate)
+		if err != nil {
+			return "", err
+		}
+		if !found {
+			return candidate, nil
+		}
+	}
+}
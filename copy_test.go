@@ -0,0 +1,349 @@
+package gofat
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path"
+	"syscall"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestFs_CopyFile(t *testing.T) {
+	data := testData(10000)
+
+	tests := []struct {
+		name    string
+		src     string
+		dst     string
+		want    []byte
+		wantErr error
+	}{
+		{
+			name: "into another directory",
+			src:  "file.txt",
+			dst:  "dir/A long copied name.txt",
+			want: data,
+		},
+		{
+			name: "empty file",
+			src:  "empty.txt",
+			dst:  "copy.txt",
+			want: []byte{},
+		},
+		{
+			name: "replace a file",
+			src:  "file.txt",
+			dst:  "dir/existing.txt",
+			want: data,
+		},
+		{
+			name:    "missing source",
+			src:     "missing.txt",
+			dst:     "copy.txt",
+			wantErr: os.ErrNotExist,
+		},
+		{
+			name:    "missing target directory",
+			src:     "file.txt",
+			dst:     "missing/copy.txt",
+			wantErr: os.ErrNotExist,
+		},
+		{
+			name:    "source is a directory",
+			src:     "dir",
+			dst:     "copy",
+			wantErr: syscall.EISDIR,
+		},
+		{
+			name:    "target is a directory",
+			src:     "file.txt",
+			dst:     "dir",
+			wantErr: syscall.EISDIR,
+		},
+		{
+			name:    "onto itself",
+			src:     "file.txt",
+			dst:     "FILE.TXT",
+			wantErr: ErrInvalidPath,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := testingFormat(t, FormatOptions{Size: 16 * 1024 * 1024})
+			if err := fs.Mkdir("dir", 0777); err != nil {
+				t.Fatal(err)
+			}
+			if err := afero.WriteFile(fs, "file.txt", data, 0666); err != nil {
+				t.Fatal(err)
+			}
+			if err := afero.WriteFile(fs, "empty.txt", nil, 0666); err != nil {
+				t.Fatal(err)
+			}
+			if err := afero.WriteFile(fs, "dir/existing.txt", testData(50000), 0666); err != nil {
+				t.Fatal(err)
+			}
+
+			err := fs.CopyFile(tt.src, tt.dst)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) || !errors.Is(err, ErrWriteFilesystem) {
+					t.Fatalf("Fs.CopyFile() error = %v, want %v", err, tt.wantErr)
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("Fs.CopyFile() error = %v", err)
+				}
+
+				got, err := afero.ReadFile(fs, tt.dst)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(got, tt.want) {
+					t.Errorf("Fs.CopyFile() copied %v bytes, want %v bytes", len(got), len(tt.want))
+				}
+
+				srcInfo, err := fs.Stat(tt.src)
+				if err != nil {
+					t.Fatal(err)
+				}
+				dstInfo, err := fs.Stat(tt.dst)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if entryMetadata(srcInfo) != entryMetadata(dstInfo) {
+					t.Errorf("Fs.CopyFile() entry = %+v, want %+v", entryMetadata(dstInfo), entryMetadata(srcInfo))
+				}
+			}
+
+			// The source is untouched and no clusters are lost or shared.
+			if got, err := afero.ReadFile(fs, "file.txt"); err != nil || !bytes.Equal(got, data) {
+				t.Errorf("Fs.CopyFile() changed the source: %v", err)
+			}
+			report, err := fs.Check()
+			if err != nil {
+				t.Fatalf("Fs.Check() error = %v", err)
+			}
+			if len(report.Findings) > 0 {
+				t.Errorf("Fs.Check() findings = %v, want none", report.Findings)
+			}
+		})
+	}
+}
+
+func TestFs_CopyFileReadOnly(t *testing.T) {
+	fs := testingNew(t, testingReadOnly(t, fat16))
+
+	err := fs.CopyFile("DoNotEdit_tests/README.md", "copy.md")
+	if !errors.Is(err, ErrReadOnlyFilesystem) {
+		t.Errorf("Fs.CopyFile() error = %v, want %v", err, ErrReadOnlyFilesystem)
+	}
+}
+
+func TestFs_CopyTree(t *testing.T) {
+	data := testData(20000)
+
+	// The source compares names case-sensitively, so "long name.txt" and "LONG NAME.TXT" collide only in the target.
+	source := func(t *testing.T) *Fs {
+		image := testingImage(t)
+		if err := Format(image, FormatOptions{Size: 16 * 1024 * 1024}); err != nil {
+			t.Fatal(err)
+		}
+		fs, err := NewWithOptions(image, Options{MatchName: func(entryName, name string) bool {
+			return entryName == name
+		}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := fs.MkdirAll("docs/sub", 0777); err != nil {
+			t.Fatal(err)
+		}
+		// The order of the entries matters for collisions, so they are written in a fixed order.
+		files := []struct {
+			name    string
+			content []byte
+		}{
+			{"docs/long name.txt", []byte("lower")},
+			{"docs/LONG NAME.TXT", []byte("upper")},
+			{"docs/sub/deep.bin", data},
+			{"top.txt", []byte("top")},
+		}
+		for _, file := range files {
+			if err := afero.WriteFile(fs, file.name, file.content, 0666); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return fs
+	}
+
+	tests := []struct {
+		name string
+		src  string
+		dst  string
+		opts CopyOptions
+		// existing files in the target.
+		existing map[string]string
+		want     map[string]string
+		// wantSource tells which source paths exist afterwards.
+		wantSource map[string]bool
+		wantErr    error
+	}{
+		{
+			name:    "fail on collision",
+			src:     "docs",
+			dst:     "copy",
+			wantErr: os.ErrExist,
+		},
+		{
+			name: "skip",
+			src:  "docs",
+			dst:  "copy",
+			opts: CopyOptions{Collision: CollisionSkip},
+			want: map[string]string{
+				"copy/long name.txt": "lower",
+				"copy/sub/deep.bin":  string(data),
+			},
+		},
+		{
+			name: "rename",
+			src:  "docs",
+			dst:  "copy",
+			opts: CopyOptions{Collision: CollisionRename},
+			want: map[string]string{
+				"copy/long name.txt":     "lower",
+				"copy/LONG NAME (2).TXT": "upper",
+			},
+		},
+		{
+			name:     "replace and merge",
+			src:      "docs",
+			dst:      "docs",
+			opts:     CopyOptions{Collision: CollisionReplace},
+			existing: map[string]string{"docs/old.txt": "old", "docs/long name.txt": "old"},
+			want: map[string]string{
+				"docs/long name.txt": "upper",
+				"docs/old.txt":       "old",
+				"docs/sub/deep.bin":  string(data),
+			},
+		},
+		{
+			name: "root into a new directory",
+			src:  ".",
+			dst:  "backup",
+			opts: CopyOptions{Collision: CollisionRename},
+			want: map[string]string{
+				"backup/top.txt":                "top",
+				"backup/docs/LONG NAME (2).TXT": "upper",
+			},
+		},
+		{
+			name:     "single file replaces",
+			src:      "top.txt",
+			dst:      "top.txt",
+			opts:     CopyOptions{Collision: CollisionReplace},
+			existing: map[string]string{"top.txt": "old"},
+			want:     map[string]string{"top.txt": "top"},
+		},
+		{
+			name: "move keeps skipped entries",
+			src:  "docs",
+			dst:  "copy",
+			opts: CopyOptions{Collision: CollisionSkip, Move: true},
+			want: map[string]string{"copy/long name.txt": "lower"},
+			wantSource: map[string]bool{
+				"docs/long name.txt": false,
+				"docs/LONG NAME.TXT": true,
+				"docs/sub":           false,
+				"top.txt":            true,
+			},
+		},
+		{
+			name:    "missing target parent",
+			src:     "top.txt",
+			dst:     "missing/top.txt",
+			wantErr: os.ErrNotExist,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := source(t)
+			dst := testingFormat(t, FormatOptions{Size: 128 * 1024 * 1024, FSType: FAT32})
+			for name, content := range tt.existing {
+				if err := dst.MkdirAll(path.Dir(name), 0777); err != nil {
+					t.Fatal(err)
+				}
+				if err := afero.WriteFile(dst, name, []byte(content), 0666); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err := src.CopyTree(dst, tt.src, tt.dst, tt.opts)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Fs.CopyTree() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Fs.CopyTree() error = %v", err)
+			}
+
+			for name, want := range tt.want {
+				got, err := afero.ReadFile(dst, name)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(got) != want {
+					t.Errorf("%v contains %v bytes, want %v bytes", name, len(got), len(want))
+				}
+			}
+
+			for name, want := range tt.wantSource {
+				if _, err := src.Stat(name); (err == nil) != want {
+					t.Errorf("source %v exists = %v, want %v", name, err == nil, want)
+				}
+			}
+
+			for _, fs := range []*Fs{src, dst} {
+				report, err := fs.Check()
+				if err != nil {
+					t.Fatalf("Fs.Check() error = %v", err)
+				}
+				if !report.OK() {
+					t.Errorf("Fs.Check() findings = %v, want none", report.Findings)
+				}
+			}
+		})
+	}
+}
+
+func TestFs_CopyTreeMetadata(t *testing.T) {
+	src := testingNew(t, testingReadOnly(t, fat16))
+	dst := testingFormat(t, FormatOptions{Size: 128 * 1024 * 1024, FSType: FAT32})
+
+	if err := src.CopyTree(dst, "DoNotEdit_tests", "tests", CopyOptions{}); err != nil {
+		t.Fatalf("Fs.CopyTree() error = %v", err)
+	}
+
+	for _, name := range []string{"", "/README.md", "/HelloWorldThisIsALoongFileName.txt"} {
+		srcInfo, err := src.Stat("DoNotEdit_tests" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dstInfo, err := dst.Stat("tests" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if entryMetadata(srcInfo) != entryMetadata(dstInfo) {
+			t.Errorf("Fs.CopyTree() entry of %v = %+v, want %+v", name, entryMetadata(dstInfo), entryMetadata(srcInfo))
+		}
+	}
+
+	err := dst.CopyTree(dst.WithContext(context.Background()), "tests", "again", CopyOptions{})
+	if !errors.Is(err, ErrInvalidPath) {
+		t.Errorf("Fs.CopyTree() into the same filesystem error = %v, want %v", err, ErrInvalidPath)
+	}
+}
@@ -58,3 +58,36 @@ func ParseTime(input uint16) time.Time {
 
 	return result
 }
+
+// FormatDate is the inverse of ParseDate. It converts the date of the given time into a FAT date stamp.
+// The time is converted to UTC first, as ParseDate also returns UTC.
+//
+// As FAT can only represent the years 1980 to 2107, earlier dates are clamped to 01/01/1980 and
+// later dates to 12/31/2107.
+func FormatDate(t time.Time) uint16 {
+	t = t.UTC()
+
+	if t.Year() < 1980 {
+		return 1<<5 | 1
+	}
+	if t.Year() > 2107 {
+		return 127<<9 | 12<<5 | 31
+	}
+
+	return uint16(t.Year()-1980)<<9 | uint16(t.Month())<<5 | uint16(t.Day())
+}
+
+// FormatTime is the inverse of ParseTime. It converts the time of the given time into a FAT time stamp.
+// The time is converted to UTC first, as ParseTime also returns UTC.
+//
+// As FAT only has a granularity of 2 seconds, odd seconds are rounded down.
+func FormatTime(t time.Time) uint16 {
+	t = t.UTC()
+	return uint16(t.Hour())<<11 | uint16(t.Minute())<<5 | uint16(t.Second()/2)
+}
+
+// formatTimeTenth returns the value for the CreateTimeTenth field which adds the
+// lost second and the 10 ms units to the 2 second granularity of FormatTime.
+func formatTimeTenth(t time.Time) byte {
+	return byte((t.Second()%2)*100 + t.Nanosecond()/int(10*time.Millisecond))
+}
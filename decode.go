@@ -0,0 +1,86 @@
+package gofat
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// These decoders replace binary.Read for the structures which are parsed very often,
+// as binary.Read uses reflection and allocates for each call.
+// The results are the same as with binary.Read using binary.LittleEndian.
+
+// entrySize is the size of one directory entry (EntryHeader or LongFilenameEntry).
+const entrySize = 32
+
+// bpbSize is the size of the BPB including the FAT specific data.
+const bpbSize = 90
+
+// errShortBuffer is returned if the data is too short for the structure.
+var errShortBuffer = errors.New("buffer too short")
+
+// decodeEntryHeader decodes the first 32 bytes of the data. The data has to be at least 32 bytes long.
+func decodeEntryHeader(data []byte) EntryHeader {
+	_ = data[entrySize-1] // Bounds check hint to the compiler.
+
+	var entry EntryHeader
+	copy(entry.Name[:], data[0:11])
+	entry.Attribute = data[11]
+	entry.NTReserved = data[12]
+	entry.CreateTimeTenth = data[13]
+	entry.CreateTime = binary.LittleEndian.Uint16(data[14:16])
+	entry.CreateDate = binary.LittleEndian.Uint16(data[16:18])
+	entry.LastAccessDate = binary.LittleEndian.Uint16(data[18:20])
+	entry.FirstClusterHI = binary.LittleEndian.Uint16(data[20:22])
+	entry.WriteTime = binary.LittleEndian.Uint16(data[22:24])
+	entry.WriteDate = binary.LittleEndian.Uint16(data[24:26])
+	entry.FirstClusterLO = binary.LittleEndian.Uint16(data[26:28])
+	entry.FileSize = binary.LittleEndian.Uint32(data[28:32])
+	return entry
+}
+
+// decodeLongFilenameEntry decodes the first 32 bytes of the data. The data has to be at least 32 bytes long.
+func decodeLongFilenameEntry(data []byte) LongFilenameEntry {
+	_ = data[entrySize-1] // Bounds check hint to the compiler.
+
+	var entry LongFilenameEntry
+	entry.Sequence = data[0]
+	for i := range entry.First {
+		entry.First[i] = binary.LittleEndian.Uint16(data[1+i*2:])
+	}
+	entry.Attribute = data[11]
+	entry.EntryType = data[12]
+	entry.Checksum = data[13]
+	for i := range entry.Second {
+		entry.Second[i] = binary.LittleEndian.Uint16(data[14+i*2:])
+	}
+	copy(entry.Zero[:], data[26:28])
+	for i := range entry.Third {
+		entry.Third[i] = binary.LittleEndian.Uint16(data[28+i*2:])
+	}
+	return entry
+}
+
+// decodeBPB decodes the BPB at the beginning of the data.
+func decodeBPB(data []byte) (BPB, error) {
+	if len(data) < bpbSize {
+		return BPB{}, errShortBuffer
+	}
+
+	var bpb BPB
+	copy(bpb.BSJumpBoot[:], data[0:3])
+	copy(bpb.BSOEMName[:], data[3:11])
+	bpb.BytesPerSector = binary.LittleEndian.Uint16(data[11:13])
+	bpb.SectorsPerCluster = data[13]
+	bpb.ReservedSectorCount = binary.LittleEndian.Uint16(data[14:16])
+	bpb.NumFATs = data[16]
+	bpb.RootEntryCount = binary.LittleEndian.Uint16(data[17:19])
+	bpb.TotalSectors16 = binary.LittleEndian.Uint16(data[19:21])
+	bpb.Media = data[21]
+	bpb.FATSize16 = binary.LittleEndian.Uint16(data[22:24])
+	bpb.SectorsPerTrack = binary.LittleEndian.Uint16(data[24:26])
+	bpb.NumberOfHeads = binary.LittleEndian.Uint16(data[26:28])
+	bpb.HiddenSectors = binary.LittleEndian.Uint32(data[28:32])
+	bpb.TotalSectors32 = binary.LittleEndian.Uint32(data[32:36])
+	copy(bpb.FATSpecificData[:], data[36:bpbSize])
+	return bpb, nil
+}
@@ -0,0 +1,51 @@
+package gofat
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"testing/quick"
+)
+
+// The decoders have to return exactly the same as binary.Read for any data.
+
+func Test_decodeEntryHeader(t *testing.T) {
+	if err := quick.Check(func(data [entrySize]byte) bool {
+		var want EntryHeader
+		if err := binary.Read(bytes.NewReader(data[:]), binary.LittleEndian, &want); err != nil {
+			t.Fatal(err)
+		}
+		return decodeEntryHeader(data[:]) == want
+	}, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_decodeLongFilenameEntry(t *testing.T) {
+	if err := quick.Check(func(data [entrySize]byte) bool {
+		var want LongFilenameEntry
+		if err := binary.Read(bytes.NewReader(data[:]), binary.LittleEndian, &want); err != nil {
+			t.Fatal(err)
+		}
+		return decodeLongFilenameEntry(data[:]) == want
+	}, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_decodeBPB(t *testing.T) {
+	if err := quick.Check(func(data [bpbSize]byte) bool {
+		var want BPB
+		if err := binary.Read(bytes.NewReader(data[:]), binary.LittleEndian, &want); err != nil {
+			t.Fatal(err)
+		}
+		got, err := decodeBPB(data[:])
+		return err == nil && got == want
+	}, nil); err != nil {
+		t.Error(err)
+	}
+
+	if _, err := decodeBPB(make([]byte, bpbSize-1)); err == nil {
+		t.Errorf("decodeBPB() with a too short buffer expected an error")
+	}
+}
@@ -0,0 +1,479 @@
+package gofat
+
+import (
+	"errors"
+	"io"
+	"path"
+	"sort"
+	"sync"
+
+	"github.com/aligator/gofat/checkpoint"
+)
+
+// errNegativeOffset is returned when seeking in front of the start of a DryRunDevice.
+var errNegativeOffset = errors.New("negative offset")
+
+// dryRunBlockSize is the granularity in which a DryRunDevice keeps the written data.
+const dryRunBlockSize = 512
+
+// WrittenRange is a part of a device which was written.
+type WrittenRange struct {
+	Offset int64 `json:"offset"`
+	Length int64 `json:"length"`
+}
+
+// DryRunDevice wraps a device and keeps all writes in memory instead of passing them to the device.
+// Reads return the written data, so everything behaves as if the writes were applied, but the device is never
+// changed. Options.DryRun uses it to preview modifications. It can also be passed to Format to preview formatting.
+// It is safe for concurrent use.
+type DryRunDevice struct {
+	lock   sync.Mutex
+	device io.ReadSeeker
+	// deviceSize is the size of the device. Everything behind it reads as zeros.
+	deviceSize int64
+	// size is the size including the writes behind the end of the device.
+	size int64
+	pos  int64
+	// blocks contains all written blocks by their index.
+	blocks map[int64][]byte
+}
+
+// NewDryRunDevice wraps the device. It does not need to implement io.Writer.
+func NewDryRunDevice(device io.ReadSeeker) (*DryRunDevice, error) {
+	size, err := device.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, checkpoint.From(err)
+	}
+
+	return &DryRunDevice{
+		device:     device,
+		deviceSize: size,
+		size:       size,
+		blocks:     make(map[int64][]byte),
+	}, nil
+}
+
+// Read reads from the current position, see io.Reader.
+func (d *DryRunDevice) Read(p []byte) (int, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	n, err := d.readAt(p, d.pos)
+	d.pos += int64(n)
+	return n, err
+}
+
+// ReadAt reads at the offset, see io.ReaderAt.
+func (d *DryRunDevice) ReadAt(p []byte, off int64) (int, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	return d.readAt(p, off)
+}
+
+// Write records the data at the current position, see io.Writer.
+func (d *DryRunDevice) Write(p []byte) (int, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	n, err := d.writeAt(p, d.pos)
+	d.pos += int64(n)
+	return n, err
+}
+
+// WriteAt records the data at the offset, see io.WriterAt.
+func (d *DryRunDevice) WriteAt(p []byte, off int64) (int, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	return d.writeAt(p, off)
+}
+
+// Seek sets the position of the next Read or Write, see io.Seeker.
+func (d *DryRunDevice) Seek(offset int64, whence int) (int64, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	switch whence {
+	case io.SeekCurrent:
+		offset += d.pos
+	case io.SeekEnd:
+		offset += d.size
+	}
+	if offset < 0 {
+		return 0, checkpoint.From(errNegativeOffset)
+	}
+
+	d.pos = offset
+	return offset, nil
+}
+
+// Written returns the written parts of the device in ascending order. Adjacent parts are merged.
+// The offsets and lengths are multiples of 512 bytes.
+func (d *DryRunDevice) Written() []WrittenRange {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	indexes := make([]int64, 0, len(d.blocks))
+	for index := range d.blocks {
+		indexes = append(indexes, index)
+	}
+	sort.Slice(indexes, func(i, j int) bool {
+		return indexes[i] < indexes[j]
+	})
+
+	var ranges []WrittenRange
+	for _, index := range indexes {
+		offset := index * dryRunBlockSize
+		if last := len(ranges) - 1; last >= 0 && ranges[last].Offset+ranges[last].Length == offset {
+			ranges[last].Length += dryRunBlockSize
+			continue
+		}
+		ranges = append(ranges, WrittenRange{Offset: offset, Length: dryRunBlockSize})
+	}
+	return ranges
+}
+
+// readAt reads the written blocks from memory and everything else from the device. The lock has to be held.
+func (d *DryRunDevice) readAt(p []byte, off int64) (int, error) {
+	if off >= d.size {
+		return 0, io.EOF
+	}
+
+	var eof error
+	if rest := d.size - off; int64(len(p)) > rest {
+		p = p[:rest]
+		eof = io.EOF
+	}
+
+	for n := 0; n < len(p); {
+		pos := off + int64(n)
+		index := pos / dryRunBlockSize
+		inBlock := int(pos % dryRunBlockSize)
+
+		if block, ok := d.blocks[index]; ok {
+			n += copy(p[n:], block[inBlock:])
+			continue
+		}
+
+		// Read all following blocks which were not written at once.
+		end := n + dryRunBlockSize - inBlock
+		for end < len(p) {
+			if _, ok := d.blocks[(off+int64(end))/dryRunBlockSize]; ok {
+				break
+			}
+			end += dryRunBlockSize
+		}
+		if end > len(p) {
+			end = len(p)
+		}
+
+		err := d.readDevice(p[n:end], pos)
+		if err != nil {
+			return n, err
+		}
+		n = end
+	}
+
+	return len(p), eof
+}
+
+// writeAt records the data. Partly written blocks are completed with the data of the device.
+// The lock has to be held.
+func (d *DryRunDevice) writeAt(p []byte, off int64) (int, error) {
+	for n := 0; n < len(p); {
+		pos := off + int64(n)
+		index := pos / dryRunBlockSize
+
+		block, ok := d.blocks[index]
+		if !ok {
+			block = make([]byte, dryRunBlockSize)
+			err := d.readDevice(block, index*dryRunBlockSize)
+			if err != nil {
+				return n, err
+			}
+			d.blocks[index] = block
+		}
+
+		n += copy(block[pos%dryRunBlockSize:], p[n:])
+	}
+
+	if end := off + int64(len(p)); end > d.size {
+		d.size = end
+	}
+	return len(p), nil
+}
+
+// readDevice reads the original data of the device. Everything behind its end reads as zeros.
+// The lock has to be held.
+func (d *DryRunDevice) readDevice(p []byte, off int64) error {
+	for i := range p {
+		p[i] = 0
+	}
+
+	if off >= d.deviceSize {
+		return nil
+	}
+	if rest := d.deviceSize - off; int64(len(p)) > rest {
+		p = p[:rest]
+	}
+
+	if readerAt, ok := d.device.(io.ReaderAt); ok {
+		_, err := readerAt.ReadAt(p, off)
+		if err == io.EOF {
+			err = nil
+		}
+		return checkpoint.From(err)
+	}
+
+	_, err := d.device.Seek(off, io.SeekStart)
+	if err == nil {
+		_, err = io.ReadFull(d.device, p)
+	}
+	return checkpoint.From(err)
+}
+
+// original returns a reader for the original content of the device without the recorded writes.
+func (d *DryRunDevice) original() io.ReadSeeker {
+	return &originalReader{device: d}
+}
+
+// originalReader reads the original content of the device of a DryRunDevice.
+type originalReader struct {
+	device *DryRunDevice
+	pos    int64
+}
+
+func (r *originalReader) Read(p []byte) (int, error) {
+	n, err := r.ReadAt(p, r.pos)
+	r.pos += int64(n)
+	return n, err
+}
+
+func (r *originalReader) ReadAt(p []byte, off int64) (int, error) {
+	r.device.lock.Lock()
+	defer r.device.lock.Unlock()
+
+	if off >= r.device.deviceSize {
+		return 0, io.EOF
+	}
+
+	var eof error
+	if rest := r.device.deviceSize - off; int64(len(p)) > rest {
+		p = p[:rest]
+		eof = io.EOF
+	}
+
+	err := r.device.readDevice(p, off)
+	if err != nil {
+		return 0, err
+	}
+	return len(p), eof
+}
+
+func (r *originalReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += r.pos
+	case io.SeekEnd:
+		offset += r.device.deviceSize
+	}
+	if offset < 0 {
+		return 0, checkpoint.From(errNegativeOffset)
+	}
+
+	r.pos = offset
+	return offset, nil
+}
+
+// ChangeKind is the kind of a Change.
+type ChangeKind string
+
+const (
+	// ChangeCreated is a file or directory which would be created.
+	ChangeCreated ChangeKind = "created"
+	// ChangeRemoved is a file or directory which would be removed.
+	ChangeRemoved ChangeKind = "removed"
+	// ChangeModified is a file whose content or entry would change or a directory whose entry would change.
+	ChangeModified ChangeKind = "modified"
+)
+
+// Change is a path which would be changed by a dry run.
+type Change struct {
+	Kind ChangeKind `json:"kind"`
+	Path string     `json:"path"`
+}
+
+// Changes are the mutations of the current session and, for a dry run, their effects, see Fs.Changes.
+type Changes struct {
+	// Journal contains all mutations in the order they were done.
+	Journal []Mutation `json:"journal"`
+
+	// The following fields are only set for a dry run, see Options.DryRun.
+
+	// Paths which would be changed, sorted by path.
+	Paths []Change `json:"paths"`
+	// Sectors which would be written.
+	Sectors []uint32 `json:"sectors"`
+	// Clusters of the data region which would be written.
+	Clusters []uint32 `json:"clusters"`
+	// Allocated are the clusters which would be marked as used in the FAT.
+	Allocated []uint32 `json:"allocated"`
+	// Freed are the clusters which would be marked as free in the FAT.
+	Freed []uint32 `json:"freed"`
+}
+
+// Changes returns the journal of all mutations since the filesystem was opened, e.g. to report what a build
+// altered. Copies of the filesystem (e.g. by WithContext) share the journal.
+// If the filesystem was opened with Options.DryRun, it also returns what the writes recorded so far would change.
+// These paths are found by comparing the directory trees with and without the writes.
+func (f *Fs) Changes() (Changes, error) {
+	// Block all changes while reading the journal and comparing.
+	f.writeLock.Lock()
+	defer f.writeLock.Unlock()
+
+	changes := Changes{
+		Journal: f.journal.list(),
+	}
+	if f.dryRun == nil {
+		return changes, nil
+	}
+
+	original, err := NewWithOptions(f.dryRun.original(), Options{SkipChecks: true, MatchName: f.matchName})
+	if err != nil {
+		return Changes{}, checkpoint.Wrap(err, ErrOpenFilesystem)
+	}
+
+	changes.Sectors = []uint32{}
+	changes.Clusters = []uint32{}
+	changes.Allocated = []uint32{}
+	changes.Freed = []uint32{}
+
+	bytesPerSector := int64(f.info.BytesPerSector)
+	written := make(map[fatEntry]bool)
+	for _, part := range f.dryRun.Written() {
+		for sector := part.Offset / bytesPerSector; sector < (part.Offset+part.Length+bytesPerSector-1)/bytesPerSector; sector++ {
+			// Sectors bigger than the parts may contain several of them.
+			if last := len(changes.Sectors) - 1; last >= 0 && changes.Sectors[last] == uint32(sector) {
+				continue
+			}
+			changes.Sectors = append(changes.Sectors, uint32(sector))
+
+			if uint32(sector) >= f.info.FirstDataSector {
+				cluster := fatEntry((uint32(sector)-f.info.FirstDataSector)/uint32(f.info.SectorsPerCluster) + 2)
+				if !written[cluster] {
+					written[cluster] = true
+					changes.Clusters = append(changes.Clusters, cluster.Value())
+				}
+			}
+		}
+	}
+
+	err = f.diffFat(original, changes.Sectors, &changes)
+	if err != nil {
+		return Changes{}, err
+	}
+
+	before := make(map[string]entryRef)
+	err = original.collectEntries(0, "", before)
+	if err != nil {
+		return Changes{}, err
+	}
+	after := make(map[string]entryRef)
+	err = f.collectEntries(0, "", after)
+	if err != nil {
+		return Changes{}, err
+	}
+
+	changes.Paths = []Change{}
+	for name, ref := range after {
+		old, ok := before[name]
+		switch {
+		case !ok:
+			changes.Paths = append(changes.Paths, Change{Kind: ChangeCreated, Path: name})
+		case old.EntryHeader != ref.EntryHeader:
+			changes.Paths = append(changes.Paths, Change{Kind: ChangeModified, Path: name})
+		case !ref.isDir():
+			chain, err := f.clusterChain(ref.firstCluster())
+			if err != nil {
+				return Changes{}, err
+			}
+			for _, cluster := range chain {
+				if written[cluster] {
+					changes.Paths = append(changes.Paths, Change{Kind: ChangeModified, Path: name})
+					break
+				}
+			}
+		}
+	}
+	for name := range before {
+		if _, ok := after[name]; !ok {
+			changes.Paths = append(changes.Paths, Change{Kind: ChangeRemoved, Path: name})
+		}
+	}
+	sort.Slice(changes.Paths, func(i, j int) bool {
+		return changes.Paths[i].Path < changes.Paths[j].Path
+	})
+
+	return changes, nil
+}
+
+// diffFat adds the clusters to the changes whose entries in the first FAT differ from the original.
+// Only the written sectors are compared.
+func (f *Fs) diffFat(original *Fs, sectors []uint32, changes *Changes) error {
+	firstFatSector := uint32(f.info.ReservedSectorCount)
+	entriesPerSector := uint32(f.info.BytesPerSector) / uint32(f.fatEntrySize())
+
+	for _, sector := range sectors {
+		if sector < firstFatSector || sector >= firstFatSector+f.info.FatSize {
+			continue
+		}
+
+		first := fatEntry((sector - firstFatSector) * entriesPerSector)
+		for cluster := first; cluster < first+fatEntry(entriesPerSector); cluster++ {
+			if cluster < 2 || cluster.Value() >= f.info.ClusterCount+2 {
+				continue
+			}
+
+			before, err := original.getFatEntry(cluster)
+			if err != nil {
+				return err
+			}
+			after, err := f.getFatEntry(cluster)
+			if err != nil {
+				return err
+			}
+
+			switch {
+			case before.IsFree() && !after.IsFree():
+				changes.Allocated = append(changes.Allocated, cluster.Value())
+			case !before.IsFree() && after.IsFree():
+				changes.Freed = append(changes.Freed, cluster.Value())
+			}
+		}
+	}
+
+	return nil
+}
+
+// collectEntries adds all entries below the directory starting at dirCluster to the entries by their path.
+func (f *Fs) collectEntries(dirCluster fatEntry, dir string, entries map[string]entryRef) error {
+	refs, err := f.readDirRefs(dirCluster)
+	if err != nil {
+		return err
+	}
+
+	for _, ref := range refs {
+		name := path.Join(dir, ref.FileInfo().Name())
+		entries[name] = ref
+
+		if ref.isDir() {
+			err = f.collectEntries(ref.firstCluster(), name, entries)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,172 @@
+package gofat
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+// readOnlyDevice hides all methods except Read and Seek.
+type readOnlyDevice struct {
+	io.ReadSeeker
+}
+
+func TestDryRunDevice(t *testing.T) {
+	tests := []struct {
+		name        string
+		writes      []WrittenRange
+		wantWritten []WrittenRange
+		wantSize    int64
+	}{
+		{
+			name:        "inside of a block",
+			writes:      []WrittenRange{{Offset: 10, Length: 5}},
+			wantWritten: []WrittenRange{{Offset: 0, Length: 512}},
+			wantSize:    4096,
+		},
+		{
+			name:        "across blocks",
+			writes:      []WrittenRange{{Offset: 500, Length: 600}, {Offset: 2048, Length: 512}},
+			wantWritten: []WrittenRange{{Offset: 0, Length: 1536}, {Offset: 2048, Length: 512}},
+			wantSize:    4096,
+		},
+		{
+			name:        "behind the end",
+			writes:      []WrittenRange{{Offset: 5000, Length: 1}},
+			wantWritten: []WrittenRange{{Offset: 4608, Length: 512}},
+			wantSize:    5001,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original := testData(4096)
+			device, err := NewDryRunDevice(readOnlyDevice{bytes.NewReader(original)})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// want is the content as if the writes were applied.
+			want := append([]byte(nil), original...)
+			for i, write := range tt.writes {
+				data := bytes.Repeat([]byte{byte(i + 1)}, int(write.Length))
+				if _, err := device.Seek(write.Offset, io.SeekStart); err != nil {
+					t.Fatal(err)
+				}
+				if _, err := device.Write(data); err != nil {
+					t.Fatalf("DryRunDevice.Write() error = %v", err)
+				}
+
+				if end := write.Offset + write.Length; end > int64(len(want)) {
+					want = append(want, make([]byte, end-int64(len(want)))...)
+				}
+				copy(want[write.Offset:], data)
+			}
+
+			size, err := device.Seek(0, io.SeekEnd)
+			if err != nil || size != tt.wantSize {
+				t.Errorf("DryRunDevice.Seek() = %v, %v, want %v", size, err, tt.wantSize)
+			}
+
+			got := make([]byte, len(want)+10)
+			n, err := device.ReadAt(got, 0)
+			if n != len(want) || err != io.EOF || !bytes.Equal(got[:n], want) {
+				t.Errorf("DryRunDevice.ReadAt() = %v, %v, want %v bytes with the writes applied", n, err, len(want))
+			}
+
+			if got := device.Written(); !reflect.DeepEqual(got, tt.wantWritten) {
+				t.Errorf("DryRunDevice.Written() = %v, want %v", got, tt.wantWritten)
+			}
+			if !bytes.Equal(original, testData(4096)) {
+				t.Errorf("the device was changed")
+			}
+		})
+	}
+}
+
+func TestDryRunDevice_Format(t *testing.T) {
+	original := make([]byte, 16*1024*1024)
+	device, err := NewDryRunDevice(bytes.NewReader(original))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Format(device, FormatOptions{Label: "PREVIEW"}); err != nil {
+		t.Fatalf("Format() error = %v", err)
+	}
+
+	fs := testingNew(t, device)
+	if fs.Label() != "PREVIEW" || len(device.Written()) == 0 {
+		t.Errorf("Format() into a DryRunDevice: label %v, written %v", fs.Label(), device.Written())
+	}
+	if !bytes.Equal(original, make([]byte, len(original))) {
+		t.Errorf("Format() changed the device")
+	}
+}
+
+func TestFs_DryRun(t *testing.T) {
+	image, err := io.ReadAll(testFileReader(fat16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	original := append([]byte(nil), image...)
+
+	fs, err := NewWithOptions(readOnlyDevice{bytes.NewReader(image)}, Options{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := fs.MkdirAll("new", 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := afero.WriteFile(fs, "new/file.txt", testData(5000), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Remove("README.md"); err != nil {
+		t.Fatal(err)
+	}
+	file, err := fs.OpenFile("go/main.go", 2, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := file.WriteAt([]byte("//"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := file.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The dry run behaves as if everything was written.
+	if got := readDirNames(t, fs, "."); !reflect.DeepEqual(got, []string{"DoNotEdit_tests", "go", "new"}) {
+		t.Errorf("the dry run contains %v", got)
+	}
+
+	changes, err := fs.Changes()
+	if err != nil {
+		t.Fatalf("Fs.Changes() error = %v", err)
+	}
+
+	want := []Change{
+		{Kind: ChangeRemoved, Path: "README.md"},
+		{Kind: ChangeModified, Path: "go/main.go"},
+		{Kind: ChangeCreated, Path: "new"},
+		{Kind: ChangeCreated, Path: "new/file.txt"},
+	}
+	if !reflect.DeepEqual(changes.Paths, want) {
+		t.Errorf("Fs.Changes() paths = %v, want %v", changes.Paths, want)
+	}
+	// The README used 6 clusters which are freed. The new directory and file need at least 2 clusters.
+	if len(changes.Freed) != 6 || len(changes.Allocated) < 2 || len(changes.Sectors) == 0 || len(changes.Clusters) == 0 {
+		t.Errorf("Fs.Changes() = %+v", changes)
+	}
+
+	if !bytes.Equal(image, original) {
+		t.Errorf("the dry run changed the image")
+	}
+
+	if got, err := testingNew(t, testingReadOnly(t, fat16)).Changes(); err != nil || got.Paths != nil || len(got.Journal) != 0 {
+		t.Errorf("Fs.Changes() without dry run = %+v, %v, want no changes", got, err)
+	}
+}
@@ -0,0 +1,113 @@
+package gofat
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/aligator/gofat/checkpoint"
+)
+
+// fatEntrySize returns the count of bytes holding one FAT entry.
+// The 12 bit entries of FAT12 share these 2 bytes with their neighbours.
+func (f *Fs) fatEntrySize() uint32 {
+	if f.info.FSType == FAT32 {
+		return 4
+	}
+	return 2
+}
+
+// fatOffset returns the offset of the FAT entry of the cluster in bytes from the start of the FAT.
+func (f *Fs) fatOffset(cluster fatEntry) uint32 {
+	switch f.info.FSType {
+	case FAT12:
+		return cluster.Value() + cluster.Value()/2
+	case FAT16:
+		return cluster.Value() * 2
+	default:
+		return cluster.Value() * 4
+	}
+}
+
+// memoryFat keeps the whole first FAT in memory, see Options.FatInMemory and Fs.Freeze.
+// It is shared by all copies of a Fs. A nil memoryFat is never loaded.
+type memoryFat struct {
+	lock sync.RWMutex
+	// data is nil if the FAT is not loaded.
+	data []byte
+}
+
+// set replaces the data of the FAT. A nil data unloads it.
+func (m *memoryFat) set(data []byte) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.data = data
+}
+
+// loaded returns true if the FAT is in memory.
+func (m *memoryFat) loaded() bool {
+	if m == nil {
+		return false
+	}
+
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	return m.data != nil
+}
+
+// loadFat reads the whole first FAT into memory.
+// After that getFatEntry does not need to read any sectors.
+// The FAT is kept, so its buffer is not taken from f.buffers.
+func (f *Fs) loadFat() error {
+	data := make([]byte, int(f.info.FatSize)*int(f.info.BytesPerSector))
+	if err := f.readSectorsInto(uint32(f.info.ReservedSectorCount), data); err != nil {
+		return checkpoint.Wrap(err, ErrReadFat)
+	}
+
+	f.fat.set(data)
+	return nil
+}
+
+// readFat returns a copy of the FAT entry at the given offset from the in-memory FAT.
+// It returns false if the FAT is not in memory.
+func (f *Fs) readFat(fatOffset uint32) ([]byte, bool, error) {
+	if f.fat == nil {
+		return nil, false, nil
+	}
+
+	f.fat.lock.RLock()
+	defer f.fat.lock.RUnlock()
+
+	if f.fat.data == nil {
+		return nil, false, nil
+	}
+
+	size := f.fatEntrySize()
+	if fatOffset+size > uint32(len(f.fat.data)) {
+		return nil, false, checkpoint.From(fmt.Errorf("%w: offset %d is outside of the FAT", ErrReadFat, fatOffset))
+	}
+
+	entry := make([]byte, size)
+	copy(entry, f.fat.data[fatOffset:])
+	return entry, true, nil
+}
+
+// updateFat copies the new FAT entry into the in-memory FAT if it is loaded.
+func (f *Fs) updateFat(fatOffset uint32, entry []byte) {
+	if f.fat == nil {
+		return
+	}
+
+	f.fat.lock.Lock()
+	defer f.fat.lock.Unlock()
+
+	// FAT12 entries are updated byte by byte, so the entry may be shorter.
+	size := f.fatEntrySize()
+	if uint32(len(entry)) < size {
+		size = uint32(len(entry))
+	}
+	if f.fat.data == nil || fatOffset+size > uint32(len(f.fat.data)) {
+		return
+	}
+
+	copy(f.fat.data[fatOffset:fatOffset+size], entry)
+}
@@ -0,0 +1,157 @@
+package gofat
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestOptions_FatInMemory(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+	}{
+		{name: "FAT32", file: fat32},
+		{name: "FAT16", file: fat16},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := testingNew(t, testFileReader(tt.file))
+			inMemory, err := NewWithOptions(testFileReader(tt.file), Options{FatInMemory: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(inMemory.fat.data) != int(inMemory.info.FatSize)*int(inMemory.info.BytesPerSector) {
+				t.Errorf("len(fat) = %v, want %v", len(inMemory.fat.data), int(inMemory.info.FatSize)*int(inMemory.info.BytesPerSector))
+			}
+
+			for cluster := fatEntry(0); cluster < 200; cluster++ {
+				want, err := fs.getFatEntry(cluster)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				got, err := inMemory.getFatEntry(cluster)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if got != want {
+					t.Errorf("getFatEntry(%v) = %v, want %v", cluster, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestOptions_FatInMemoryWrite(t *testing.T) {
+	image := testingImage(t)
+	if err := Format(image, FormatOptions{Size: 32 * 1024 * 1024}); err != nil {
+		t.Fatal(err)
+	}
+
+	fs, err := NewWithOptions(image, Options{FatInMemory: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := testData(int(fs.clusterSize())*4 + 1)
+	if err := afero.WriteFile(fs, "file", data, 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	// The FAT on the disk has to contain the same chain.
+	fs = testingNew(t, image)
+
+	got, err := afero.ReadFile(fs, "file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("ReadFile() returned other data than written")
+	}
+}
+
+func TestFs_fat12Entries(t *testing.T) {
+	image := testingImage(t)
+	if err := Format(image, FormatOptions{Size: 1440 * 1024}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The 12 bit entries share their bytes and some of them continue in the next sector, e.g. the one of cluster 341.
+	value := func(cluster fatEntry, round int) fatEntry {
+		return fatEntry(2 + (cluster.Value()*37+uint32(round))%0xFE0)
+	}
+
+	options := []Options{{}, {FatInMemory: true}}
+	for round, writeOpts := range options {
+		fs, err := NewWithOptions(image, writeOpts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fs.FSType() != FAT12 {
+			t.Fatalf("Fs.FSType() = %v, want %v", fs.FSType(), FAT12)
+		}
+
+		for cluster := fatEntry(2); cluster.Value() < fs.info.ClusterCount+2; cluster++ {
+			if err := fs.setFatEntry(cluster, value(cluster, round)); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		for _, readOpts := range options {
+			fs, err := NewWithOptions(image, readOpts)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for cluster := fatEntry(2); cluster.Value() < fs.info.ClusterCount+2; cluster++ {
+				got, err := fs.getFatEntry(cluster)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if want := value(cluster, round); got != want {
+					t.Fatalf("written with %+v, read with %+v: getFatEntry(%v) = %#x, want %#x", writeOpts, readOpts, cluster, got, want)
+				}
+			}
+		}
+	}
+
+	// The special values are extended to the ones of FAT32 and 0xFF0 is read as EOF.
+	fs := testingNew(t, image)
+	tests := []struct {
+		value fatEntry
+		want  fatEntry
+		kind  FatEntryKind
+	}{
+		{value: 0, want: 0, kind: FatFree},
+		{value: eocMarker, want: 0x0FFFFFFF, kind: FatEOF},
+		{value: 0x0FFFFFF8, want: 0x0FFFFFF8, kind: FatEOF},
+		{value: 0x0FFFFFF7, want: 0x0FFFFFF7, kind: FatBad},
+		{value: 0xFF0, want: eocMarker, kind: FatEOF},
+		{value: 0xFEF, want: 0xFEF, kind: FatNext},
+	}
+	for _, tt := range tests {
+		if err := fs.setFatEntry(341, tt.value); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := fs.getFatEntry(341)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("getFatEntry() after setFatEntry(%#x) = %#x, want %#x", tt.value, got, tt.want)
+		}
+
+		entries, err := fs.FatEntries(341, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if entries[0].Kind != tt.kind || entries[0].Value > 0xFFF {
+			t.Errorf("FatEntries() after setFatEntry(%#x) = %+v, want a 12 bit %v entry", tt.value, entries[0], tt.kind)
+		}
+	}
+}
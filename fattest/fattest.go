@@ -0,0 +1,257 @@
+// Package fattest provides helpers to test code which works with FAT images, e.g. whether it recovers from
+// failing storage.
+// It does not depend on gofat, so it can be used by the tests of gofat itself.
+package fattest
+
+import (
+	"errors"
+	"io"
+	"sync"
+)
+
+// ErrInjected is returned by a FaultyDevice for an injected fault if no other error was given.
+var ErrInjected = errors.New("injected fault")
+
+// Op selects the accesses a fault applies to.
+type Op int
+
+const (
+	// Read applies the fault to Read and ReadAt.
+	Read Op = 1 << iota
+	// Write applies the fault to Write and WriteAt.
+	Write
+	// ReadWrite applies the fault to all accesses.
+	ReadWrite = Read | Write
+)
+
+// fault is a failure injected into a FaultyDevice.
+type fault struct {
+	op  Op
+	err error
+	// start and end are the first and the last byte + 1 which fail.
+	start, end int64
+	// after fails the access once this count of bytes was transferred by accesses of op. It is -1 if unused.
+	after int64
+	// once removes the fault after it was triggered the first time.
+	once bool
+}
+
+// FaultyDevice wraps a device and lets chosen reads and writes fail, either at chosen sectors or after a count of
+// transferred bytes.
+// An access which reaches a fault transfers all bytes in front of it and then returns the error, like a real device
+// which fails in the middle of a request.
+// It is safe for concurrent use.
+type FaultyDevice struct {
+	lock       sync.Mutex
+	device     io.ReadWriteSeeker
+	sectorSize int64
+	pos        int64
+	faults     []*fault
+	// read and written count the transferred bytes.
+	read, written int64
+}
+
+// NewFaultyDevice wraps the device. The sectorSize is used to convert sector numbers into offsets,
+// usually it is 512.
+func NewFaultyDevice(device io.ReadWriteSeeker, sectorSize int) *FaultyDevice {
+	return &FaultyDevice{
+		device:     device,
+		sectorSize: int64(sectorSize),
+	}
+}
+
+// FailSector lets all accesses of op to the sector fail with err.
+// If err is nil, ErrInjected is used.
+func (d *FaultyDevice) FailSector(op Op, sector int64, err error) {
+	d.addFault(&fault{op: op, err: err, start: sector * d.sectorSize, end: (sector + 1) * d.sectorSize, after: -1})
+}
+
+// FailSectorOnce lets only the next access of op to the sector fail with err, e.g. to test retries.
+// If err is nil, ErrInjected is used.
+func (d *FaultyDevice) FailSectorOnce(op Op, sector int64, err error) {
+	d.addFault(&fault{op: op, err: err, start: sector * d.sectorSize, end: (sector + 1) * d.sectorSize, after: -1, once: true})
+}
+
+// FailAfter lets all accesses of op fail with err once n more bytes were transferred by them.
+// For ReadWrite the read and written bytes are counted together.
+// If err is nil, ErrInjected is used.
+func (d *FaultyDevice) FailAfter(op Op, n int64, err error) {
+	d.lock.Lock()
+	after := n
+	if op&Read != 0 {
+		after += d.read
+	}
+	if op&Write != 0 {
+		after += d.written
+	}
+	d.lock.Unlock()
+
+	d.addFault(&fault{op: op, err: err, after: after})
+}
+
+// Heal removes all faults.
+func (d *FaultyDevice) Heal() {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.faults = nil
+}
+
+// Transferred returns the count of bytes read and written so far.
+func (d *FaultyDevice) Transferred() (read, written int64) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	return d.read, d.written
+}
+
+func (d *FaultyDevice) addFault(f *fault) {
+	if f.err == nil {
+		f.err = ErrInjected
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.faults = append(d.faults, f)
+}
+
+// Read reads from the current position, see io.Reader.
+func (d *FaultyDevice) Read(p []byte) (int, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	n, err := d.access(Read, p, d.pos)
+	d.pos += int64(n)
+	return n, err
+}
+
+// ReadAt reads at the offset, see io.ReaderAt.
+func (d *FaultyDevice) ReadAt(p []byte, off int64) (int, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	n, err := d.access(Read, p, off)
+	if err == nil && n < len(p) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// Write writes at the current position, see io.Writer.
+func (d *FaultyDevice) Write(p []byte) (int, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	n, err := d.access(Write, p, d.pos)
+	d.pos += int64(n)
+	return n, err
+}
+
+// WriteAt writes at the offset, see io.WriterAt.
+func (d *FaultyDevice) WriteAt(p []byte, off int64) (int, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	return d.access(Write, p, off)
+}
+
+// Seek sets the position, see io.Seeker.
+func (d *FaultyDevice) Seek(offset int64, whence int) (int64, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	switch whence {
+	case io.SeekCurrent:
+		offset += d.pos
+	case io.SeekEnd:
+		size, err := d.device.Seek(0, io.SeekEnd)
+		if err != nil {
+			return d.pos, err
+		}
+		offset += size
+	}
+
+	if offset < 0 {
+		return d.pos, errors.New("negative offset")
+	}
+
+	d.pos = offset
+	return offset, nil
+}
+
+// access transfers the bytes in front of the first fault and returns the error of the fault.
+func (d *FaultyDevice) access(op Op, p []byte, off int64) (int, error) {
+	limit := int64(len(p))
+	var triggered *fault
+	for _, f := range d.faults {
+		if f.op&op == 0 {
+			continue
+		}
+
+		var at int64 = -1
+		if f.after >= 0 {
+			var done int64
+			if f.op&Read != 0 {
+				done += d.read
+			}
+			if f.op&Write != 0 {
+				done += d.written
+			}
+			if done+limit > f.after {
+				at = f.after - done
+				if at < 0 {
+					at = 0
+				}
+			}
+		} else if f.start < off+limit && f.end > off {
+			at = f.start - off
+			if at < 0 {
+				at = 0
+			}
+		}
+
+		if at >= 0 && (triggered == nil || at < limit) {
+			limit, triggered = at, f
+		}
+	}
+
+	n, err := d.transfer(op, p[:limit], off)
+	if err != nil || triggered == nil {
+		return n, err
+	}
+
+	if triggered.once {
+		for i, f := range d.faults {
+			if f == triggered {
+				d.faults = append(d.faults[:i], d.faults[i+1:]...)
+				break
+			}
+		}
+	}
+	return n, triggered.err
+}
+
+// transfer reads or writes the data at the offset of the device.
+func (d *FaultyDevice) transfer(op Op, p []byte, off int64) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	if _, err := d.device.Seek(off, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	if op == Write {
+		n, err := d.device.Write(p)
+		d.written += int64(n)
+		return n, err
+	}
+
+	n, err := io.ReadFull(d.device, p)
+	d.read += int64(n)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return n, err
+}
@@ -0,0 +1,161 @@
+package fattest
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+// memDevice is a simple in-memory device.
+type memDevice struct {
+	data []byte
+	pos  int64
+}
+
+func (m *memDevice) Read(p []byte) (int, error) {
+	if m.pos >= int64(len(m.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, m.data[m.pos:])
+	m.pos += int64(n)
+	return n, nil
+}
+
+func (m *memDevice) Write(p []byte) (int, error) {
+	if end := m.pos + int64(len(p)); end > int64(len(m.data)) {
+		m.data = append(m.data, make([]byte, end-int64(len(m.data)))...)
+	}
+	n := copy(m.data[m.pos:], p)
+	m.pos += int64(n)
+	return n, nil
+}
+
+func (m *memDevice) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += m.pos
+	case io.SeekEnd:
+		offset += int64(len(m.data))
+	}
+	m.pos = offset
+	return offset, nil
+}
+
+func TestFaultyDevice(t *testing.T) {
+	errCustom := errors.New("custom")
+
+	type access struct {
+		op     Op
+		offset int64
+		length int
+		wantN  int
+		// wantErr is the expected error, nil means no error.
+		wantErr error
+	}
+
+	tests := []struct {
+		name     string
+		inject   func(d *FaultyDevice)
+		accesses []access
+	}{
+		{
+			name:   "no faults",
+			inject: func(d *FaultyDevice) {},
+			accesses: []access{
+				{op: Read, offset: 0, length: 2048, wantN: 2048},
+				{op: Write, offset: 512, length: 512, wantN: 512},
+			},
+		},
+		{
+			name: "failing sector",
+			inject: func(d *FaultyDevice) {
+				d.FailSector(Read, 2, nil)
+			},
+			accesses: []access{
+				{op: Read, offset: 0, length: 1024, wantN: 1024},
+				{op: Read, offset: 512, length: 1024, wantN: 512, wantErr: ErrInjected},
+				{op: Read, offset: 1100, length: 10, wantN: 0, wantErr: ErrInjected},
+				{op: Write, offset: 1024, length: 512, wantN: 512},
+				{op: Read, offset: 1024, length: 512, wantN: 0, wantErr: ErrInjected},
+			},
+		},
+		{
+			name: "failing sector once",
+			inject: func(d *FaultyDevice) {
+				d.FailSectorOnce(Write, 1, errCustom)
+			},
+			accesses: []access{
+				{op: Read, offset: 512, length: 512, wantN: 512},
+				{op: Write, offset: 0, length: 1024, wantN: 512, wantErr: errCustom},
+				{op: Write, offset: 0, length: 1024, wantN: 1024},
+			},
+		},
+		{
+			name: "failing after bytes",
+			inject: func(d *FaultyDevice) {
+				d.FailAfter(ReadWrite, 1000, nil)
+			},
+			accesses: []access{
+				{op: Read, offset: 0, length: 600, wantN: 600},
+				{op: Write, offset: 0, length: 600, wantN: 400, wantErr: ErrInjected},
+				{op: Read, offset: 0, length: 1, wantN: 0, wantErr: ErrInjected},
+			},
+		},
+		{
+			name: "healed",
+			inject: func(d *FaultyDevice) {
+				d.FailSector(ReadWrite, 0, nil)
+				d.FailAfter(Read, 0, nil)
+				d.Heal()
+			},
+			accesses: []access{
+				{op: Read, offset: 0, length: 512, wantN: 512},
+				{op: Write, offset: 0, length: 512, wantN: 512},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			memory := &memDevice{data: bytes.Repeat([]byte{0xAA}, 4096)}
+			d := NewFaultyDevice(memory, 512)
+			tt.inject(d)
+
+			for i, a := range tt.accesses {
+				var n int
+				var err error
+				p := make([]byte, a.length)
+				if a.op == Read {
+					n, err = d.ReadAt(p, a.offset)
+				} else {
+					n, err = d.WriteAt(bytes.Repeat([]byte{0x55}, a.length), a.offset)
+				}
+
+				if n != a.wantN || !errors.Is(err, a.wantErr) || (err != nil) != (a.wantErr != nil) {
+					t.Errorf("access %d: got %d, %v, want %d, %v", i, n, err, a.wantN, a.wantErr)
+				}
+			}
+		})
+	}
+}
+
+func TestFaultyDevice_Read(t *testing.T) {
+	memory := &memDevice{data: bytes.Repeat([]byte{0xAA}, 1024)}
+	d := NewFaultyDevice(memory, 512)
+	d.FailSector(Read, 1, nil)
+
+	p := make([]byte, 1024)
+	n, err := d.Read(p)
+	if n != 512 || !errors.Is(err, ErrInjected) {
+		t.Fatalf("FaultyDevice.Read() = %d, %v, want 512, %v", n, err, ErrInjected)
+	}
+
+	// The position only moves by the transferred bytes.
+	if pos, _ := d.Seek(0, io.SeekCurrent); pos != 512 {
+		t.Errorf("FaultyDevice.Seek() = %d, want 512", pos)
+	}
+
+	if read, written := d.Transferred(); read != 512 || written != 0 {
+		t.Errorf("FaultyDevice.Transferred() = %d, %d, want 512, 0", read, written)
+	}
+}
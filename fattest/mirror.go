@@ -0,0 +1,669 @@
+package fattest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+// ErrMismatch is returned by MirrorFs.Verify if the filesystem does not agree with the reference.
+var ErrMismatch = errors.New("the filesystem differs from the reference")
+
+// Mismatch is a difference between the filesystem and the reference found by a MirrorFs.
+type Mismatch struct {
+	// Op is the call which found the difference, e.g. "Write" or "Verify".
+	Op   string
+	Path string
+	// Got is the result of the filesystem and Want the result of the reference.
+	Got, Want string
+}
+
+func (m Mismatch) String() string {
+	return fmt.Sprintf("%v %v: got %v, want %v", m.Op, m.Path, m.Got, m.Want)
+}
+
+// MirrorFs applies every call to the filesystem under test and to a reference afero.MemMapFs and records each
+// difference of their results. Verify compares the whole trees afterwards, so bugs of the write path are found
+// automatically by just running the usual operations through a MirrorFs.
+//
+// Only the content is compared: the names, the sizes, the data and whether calls fail. The modes, times and owners are
+// passed to both but not compared, as FAT stores them differently. The reference compares names case sensitive,
+// so a test should always use the same case for a path and only names which are valid on FAT.
+// It is safe for concurrent use if the filesystem under test is.
+type MirrorFs struct {
+	fs  afero.Fs
+	ref strictFs
+
+	lock       sync.Mutex
+	mismatches []Mismatch
+}
+
+// NewMirrorFs wraps the filesystem under test. Its current content is copied into the reference first.
+func NewMirrorFs(fs afero.Fs) (*MirrorFs, error) {
+	ref := afero.NewMemMapFs()
+	err := afero.Walk(fs, ".", func(name string, info os.FileInfo, err error) error {
+		if err != nil || name == "." {
+			return err
+		}
+
+		if info.IsDir() {
+			return ref.Mkdir(name, 0777)
+		}
+
+		data, err := afero.ReadFile(fs, name)
+		if err != nil {
+			return err
+		}
+		return afero.WriteFile(ref, name, data, 0666)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &MirrorFs{fs: fs, ref: strictFs{ref}}, nil
+}
+
+// Mismatches returns the differences found so far by the calls, in the order they were found.
+func (m *MirrorFs) Mismatches() []Mismatch {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return append([]Mismatch(nil), m.mismatches...)
+}
+
+// Verify compares the whole trees of the filesystem and the reference.
+// It returns an error wrapping ErrMismatch which lists all differences, including the ones found by the calls before.
+func (m *MirrorFs) Verify() error {
+	got, err := readTree(m.fs)
+	if err != nil {
+		return err
+	}
+	want, err := readTree(m.ref)
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(got)+len(want))
+	for name := range got {
+		names = append(names, name)
+	}
+	for name := range want {
+		if _, ok := got[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		g, inGot := got[name]
+		w, inWant := want[name]
+		switch {
+		case !inGot:
+			m.mismatch("Verify", name, "missing", w.String())
+		case !inWant:
+			m.mismatch("Verify", name, g.String(), "missing")
+		case g.dir != w.dir || len(g.data) != len(w.data):
+			m.mismatch("Verify", name, g.String(), w.String())
+		case !bytes.Equal(g.data, w.data):
+			m.mismatch("Verify", name, "other content", "same content")
+		}
+	}
+
+	mismatches := m.Mismatches()
+	if len(mismatches) == 0 {
+		return nil
+	}
+
+	lines := make([]string, len(mismatches))
+	for i, mismatch := range mismatches {
+		lines[i] = mismatch.String()
+	}
+	return fmt.Errorf("%w: %d differences:\n%v", ErrMismatch, len(lines), strings.Join(lines, "\n"))
+}
+
+// treeEntry is a file or directory read by readTree.
+type treeEntry struct {
+	dir  bool
+	data []byte
+}
+
+func (e treeEntry) String() string {
+	if e.dir {
+		return "directory"
+	}
+	return fmt.Sprintf("file of %d bytes", len(e.data))
+}
+
+// readTree reads all entries of the filesystem by their path.
+func readTree(fs afero.Fs) (map[string]treeEntry, error) {
+	tree := make(map[string]treeEntry)
+	err := afero.Walk(fs, ".", func(name string, info os.FileInfo, err error) error {
+		if err != nil || name == "." {
+			return err
+		}
+
+		if info.IsDir() {
+			tree[name] = treeEntry{dir: true}
+			return nil
+		}
+
+		data, err := afero.ReadFile(fs, name)
+		tree[name] = treeEntry{data: data}
+		return err
+	})
+	return tree, err
+}
+
+// mismatch records a difference.
+func (m *MirrorFs) mismatch(op, name, got, want string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.mismatches = append(m.mismatches, Mismatch{Op: op, Path: name, Got: got, Want: want})
+}
+
+// compareErr records a difference if only one of the calls failed or only one of them did not find the path.
+func (m *MirrorFs) compareErr(op, name string, err, refErr error) {
+	if (err == nil) != (refErr == nil) || errors.Is(err, os.ErrNotExist) != errors.Is(refErr, os.ErrNotExist) {
+		m.mismatch(op, name, errString(err), errString(refErr))
+	}
+}
+
+func errString(err error) string {
+	if err == nil {
+		return "success"
+	}
+	return fmt.Sprintf("error '%v'", err)
+}
+
+func (m *MirrorFs) Name() string {
+	return "MirrorFs(" + m.fs.Name() + ")"
+}
+
+func (m *MirrorFs) Create(name string) (afero.File, error) {
+	return m.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+func (m *MirrorFs) Mkdir(name string, perm os.FileMode) error {
+	err := m.fs.Mkdir(name, perm)
+	m.compareErr("Mkdir", name, err, m.ref.Mkdir(name, perm))
+	return err
+}
+
+func (m *MirrorFs) MkdirAll(name string, perm os.FileMode) error {
+	err := m.fs.MkdirAll(name, perm)
+	m.compareErr("MkdirAll", name, err, m.ref.MkdirAll(name, perm))
+	return err
+}
+
+func (m *MirrorFs) Open(name string) (afero.File, error) {
+	return m.OpenFile(name, os.O_RDONLY, 0)
+}
+
+func (m *MirrorFs) OpenFile(name string, flag int, perm os.FileMode) (afero.File, error) {
+	file, err := m.fs.OpenFile(name, flag, perm)
+	ref, refErr := m.ref.OpenFile(name, flag, perm)
+	m.compareErr("OpenFile", name, err, refErr)
+
+	if err != nil {
+		if refErr == nil {
+			_ = ref.Close()
+		}
+		return nil, err
+	}
+	if refErr != nil {
+		// Keep the file usable, but there is nothing to compare with anymore.
+		ref = nil
+	}
+	return &mirrorFile{mirror: m, name: name, file: file, ref: ref}, nil
+}
+
+func (m *MirrorFs) Remove(name string) error {
+	err := m.fs.Remove(name)
+	m.compareErr("Remove", name, err, m.ref.Remove(name))
+	return err
+}
+
+func (m *MirrorFs) RemoveAll(name string) error {
+	err := m.fs.RemoveAll(name)
+	m.compareErr("RemoveAll", name, err, m.ref.RemoveAll(name))
+	return err
+}
+
+func (m *MirrorFs) Rename(oldname, newname string) error {
+	err := m.fs.Rename(oldname, newname)
+	m.compareErr("Rename", oldname+" -> "+newname, err, m.ref.Rename(oldname, newname))
+	return err
+}
+
+func (m *MirrorFs) Stat(name string) (os.FileInfo, error) {
+	info, err := m.fs.Stat(name)
+	refInfo, refErr := m.ref.Stat(name)
+	m.compareErr("Stat", name, err, refErr)
+	if err == nil && refErr == nil {
+		m.compareInfo("Stat", name, info, refInfo)
+	}
+	return info, err
+}
+
+// compareInfo records a difference if the types or, for files, the sizes differ.
+func (m *MirrorFs) compareInfo(op, name string, info, refInfo os.FileInfo) {
+	if got, want := describe(info), describe(refInfo); got != want {
+		m.mismatch(op, name, got, want)
+	}
+}
+
+// describe returns the type and the size of a file.
+func describe(info os.FileInfo) string {
+	if info.IsDir() {
+		return "directory"
+	}
+	return fmt.Sprintf("file of %d bytes", info.Size())
+}
+
+// Chmod changes the mode of both but does not compare the results.
+func (m *MirrorFs) Chmod(name string, mode os.FileMode) error {
+	_ = m.ref.Chmod(name, mode)
+	return m.fs.Chmod(name, mode)
+}
+
+// Chown changes the owner of both but does not compare the results.
+func (m *MirrorFs) Chown(name string, uid, gid int) error {
+	_ = m.ref.Chown(name, uid, gid)
+	return m.fs.Chown(name, uid, gid)
+}
+
+// Chtimes changes the times of both but does not compare the results.
+func (m *MirrorFs) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	_ = m.ref.Chtimes(name, atime, mtime)
+	return m.fs.Chtimes(name, atime, mtime)
+}
+
+// mirrorFile is a file opened through a MirrorFs.
+type mirrorFile struct {
+	mirror *MirrorFs
+	// name is the path used to open the file.
+	name string
+	file afero.File
+	// ref is nil if only the filesystem could open the file.
+	ref afero.File
+}
+
+func (f *mirrorFile) Name() string {
+	return f.file.Name()
+}
+
+func (f *mirrorFile) Close() error {
+	err := f.file.Close()
+	if f.ref != nil {
+		f.mirror.compareErr("Close", f.name, err, f.ref.Close())
+	}
+	return err
+}
+
+// compareRead reads the same count of bytes from the reference as were read into data.
+// Short reads are fine, as long as the bytes are the same.
+func (f *mirrorFile) compareRead(op string, data []byte, err error, read func([]byte) (int, error)) {
+	if f.ref == nil {
+		return
+	}
+
+	switch {
+	case len(data) > 0:
+		refData := make([]byte, len(data))
+		refN, _ := io.ReadFull(readerFunc(read), refData)
+		if refN != len(data) {
+			f.mirror.mismatch(op, f.name, fmt.Sprintf("%d bytes", len(data)), fmt.Sprintf("%d bytes", refN))
+		} else if !bytes.Equal(data, refData) {
+			f.mirror.mismatch(op, f.name, "other data", "same data")
+		}
+	case err == io.EOF:
+		if refN, _ := read(make([]byte, 1)); refN > 0 {
+			f.mirror.mismatch(op, f.name, "end of file", "more data")
+		}
+	case err != nil:
+		_, refErr := read(make([]byte, 1))
+		f.mirror.compareErr(op, f.name, err, refErr)
+	}
+}
+
+// readerFunc turns a read function into an io.Reader.
+type readerFunc func([]byte) (int, error)
+
+func (r readerFunc) Read(p []byte) (int, error) {
+	return r(p)
+}
+
+func (f *mirrorFile) Read(p []byte) (int, error) {
+	n, err := f.file.Read(p)
+	f.compareRead("Read", p[:n], err, func(b []byte) (int, error) {
+		return f.ref.Read(b)
+	})
+	return n, err
+}
+
+func (f *mirrorFile) ReadAt(p []byte, off int64) (int, error) {
+	n, err := f.file.ReadAt(p, off)
+	if f.ref != nil {
+		// ReadAt may not read less without an error, so the counts have to match exactly.
+		refData := make([]byte, len(p))
+		refN, refErr := f.ref.ReadAt(refData, off)
+		switch {
+		case n != refN:
+			f.mirror.mismatch("ReadAt", f.name, fmt.Sprintf("%d bytes", n), fmt.Sprintf("%d bytes", refN))
+		case !bytes.Equal(p[:n], refData[:n]):
+			f.mirror.mismatch("ReadAt", f.name, "other data", "same data")
+		case err != io.EOF || refErr != io.EOF:
+			f.mirror.compareErr("ReadAt", f.name, err, refErr)
+		}
+	}
+	return n, err
+}
+
+// compareWrite records a difference if the counts of written bytes or the errors differ.
+func (f *mirrorFile) compareWrite(op string, n int, err error, refN int, refErr error) {
+	if n != refN {
+		f.mirror.mismatch(op, f.name, fmt.Sprintf("%d bytes", n), fmt.Sprintf("%d bytes", refN))
+		return
+	}
+	f.mirror.compareErr(op, f.name, err, refErr)
+}
+
+func (f *mirrorFile) Write(p []byte) (int, error) {
+	n, err := f.file.Write(p)
+	if f.ref != nil {
+		refN, refErr := f.ref.Write(p)
+		f.compareWrite("Write", n, err, refN, refErr)
+	}
+	return n, err
+}
+
+func (f *mirrorFile) WriteAt(p []byte, off int64) (int, error) {
+	n, err := f.file.WriteAt(p, off)
+	if f.ref != nil {
+		refN, refErr := f.ref.WriteAt(p, off)
+		f.compareWrite("WriteAt", n, err, refN, refErr)
+	}
+	return n, err
+}
+
+func (f *mirrorFile) WriteString(s string) (int, error) {
+	return f.Write([]byte(s))
+}
+
+func (f *mirrorFile) Seek(offset int64, whence int) (int64, error) {
+	pos, err := f.file.Seek(offset, whence)
+	if f.ref != nil {
+		refPos, refErr := f.ref.Seek(offset, whence)
+		if err == nil && refErr == nil && pos != refPos {
+			f.mirror.mismatch("Seek", f.name, fmt.Sprintf("offset %d", pos), fmt.Sprintf("offset %d", refPos))
+		} else {
+			f.mirror.compareErr("Seek", f.name, err, refErr)
+		}
+	}
+	return pos, err
+}
+
+func (f *mirrorFile) Readdir(count int) ([]os.FileInfo, error) {
+	infos, err := f.file.Readdir(count)
+	if f.ref != nil {
+		refInfos, refErr := f.ref.Readdir(count)
+		names := make([]string, len(infos))
+		for i, info := range infos {
+			names[i] = info.Name()
+		}
+		refNames := make([]string, len(refInfos))
+		for i, info := range refInfos {
+			refNames[i] = info.Name()
+		}
+		f.compareNames("Readdir", count, names, err, refNames, refErr)
+	}
+	return infos, err
+}
+
+func (f *mirrorFile) Readdirnames(count int) ([]string, error) {
+	names, err := f.file.Readdirnames(count)
+	if f.ref != nil {
+		refNames, refErr := f.ref.Readdirnames(count)
+		f.compareNames("Readdirnames", count, names, err, refNames, refErr)
+	}
+	return names, err
+}
+
+// compareNames records a difference of the listed entries. As the order of the entries differs,
+// only the counts can be compared for partial listings.
+func (f *mirrorFile) compareNames(op string, count int, names []string, err error, refNames []string, refErr error) {
+	if count > 0 {
+		if len(names) != len(refNames) {
+			f.mirror.mismatch(op, f.name, fmt.Sprintf("%d entries", len(names)), fmt.Sprintf("%d entries", len(refNames)))
+		}
+		return
+	}
+
+	f.mirror.compareErr(op, f.name, err, refErr)
+	names = append([]string(nil), names...)
+	sort.Strings(names)
+	sort.Strings(refNames)
+	if got, want := strings.Join(names, ", "), strings.Join(refNames, ", "); got != want {
+		f.mirror.mismatch(op, f.name, "["+got+"]", "["+want+"]")
+	}
+}
+
+func (f *mirrorFile) Stat() (os.FileInfo, error) {
+	info, err := f.file.Stat()
+	if f.ref != nil {
+		refInfo, refErr := f.ref.Stat()
+		f.mirror.compareErr("File.Stat", f.name, err, refErr)
+		if err == nil && refErr == nil {
+			f.mirror.compareInfo("File.Stat", f.name, info, refInfo)
+		}
+	}
+	return info, err
+}
+
+func (f *mirrorFile) Sync() error {
+	err := f.file.Sync()
+	if f.ref != nil {
+		f.mirror.compareErr("Sync", f.name, err, f.ref.Sync())
+	}
+	return err
+}
+
+func (f *mirrorFile) Truncate(size int64) error {
+	err := f.file.Truncate(size)
+	if f.ref != nil {
+		f.mirror.compareErr("Truncate", f.name, err, f.ref.Truncate(size))
+	}
+	return err
+}
+
+// strictFs adds the checks of real filesystems which the afero.MemMapFs does not do:
+// parents have to exist, only empty directories can be removed and renaming a directory moves its content.
+// Its files are fixed by strictFile.
+type strictFs struct {
+	afero.Fs
+}
+
+// checkParent fails if the parent directory of the path does not exist.
+func (s strictFs) checkParent(op, name string) error {
+	parent := path.Dir(path.Clean(name))
+	if parent == "." || parent == "/" {
+		return nil
+	}
+
+	info, err := s.Fs.Stat(parent)
+	if err != nil {
+		return &os.PathError{Op: op, Path: name, Err: os.ErrNotExist}
+	}
+	if !info.IsDir() {
+		return &os.PathError{Op: op, Path: name, Err: syscall.ENOTDIR}
+	}
+	return nil
+}
+
+func (s strictFs) Create(name string) (afero.File, error) {
+	return s.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+func (s strictFs) OpenFile(name string, flag int, perm os.FileMode) (afero.File, error) {
+	if flag&os.O_CREATE != 0 {
+		_, err := s.Fs.Stat(name)
+		if err == nil && flag&os.O_EXCL != 0 {
+			return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrExist}
+		}
+		if err != nil {
+			if err := s.checkParent("open", name); err != nil {
+				return nil, err
+			}
+		}
+	}
+	file, err := s.Fs.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return &strictFile{File: file, append: flag&os.O_APPEND != 0}, nil
+}
+
+func (s strictFs) Mkdir(name string, perm os.FileMode) error {
+	if _, err := s.Fs.Stat(name); err == nil {
+		return &os.PathError{Op: "mkdir", Path: name, Err: os.ErrExist}
+	}
+	if err := s.checkParent("mkdir", name); err != nil {
+		return err
+	}
+	return s.Fs.Mkdir(name, perm)
+}
+
+func (s strictFs) MkdirAll(name string, perm os.FileMode) error {
+	current := ""
+	for _, part := range strings.Split(path.Clean(name), "/") {
+		current = path.Join(current, part)
+		info, err := s.Fs.Stat(current)
+		if err != nil {
+			if err := s.Fs.Mkdir(current, perm); err != nil {
+				return err
+			}
+		} else if !info.IsDir() {
+			return &os.PathError{Op: "mkdir", Path: name, Err: syscall.ENOTDIR}
+		}
+	}
+	return nil
+}
+
+func (s strictFs) Remove(name string) error {
+	if names, err := afero.ReadDir(s.Fs, name); err == nil && len(names) > 0 {
+		return &os.PathError{Op: "remove", Path: name, Err: syscall.ENOTEMPTY}
+	}
+	return s.Fs.Remove(name)
+}
+
+func (s strictFs) Rename(oldname, newname string) error {
+	info, err := s.Fs.Stat(oldname)
+	if err != nil {
+		return err
+	}
+	oldname, newname = path.Clean(oldname), path.Clean(newname)
+	if oldname == newname {
+		return nil
+	}
+	if info.IsDir() && strings.HasPrefix(newname, oldname+"/") {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: syscall.EINVAL}
+	}
+	if err := s.checkParent("rename", newname); err != nil {
+		return err
+	}
+
+	// Like os.Rename an existing file is replaced by a file and an empty directory by a directory.
+	if target, err := s.Fs.Stat(newname); err == nil {
+		switch {
+		case target.IsDir() && !info.IsDir():
+			return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: syscall.EISDIR}
+		case !target.IsDir() && info.IsDir():
+			return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: syscall.ENOTDIR}
+		}
+		if err := s.Remove(newname); err != nil {
+			return err
+		}
+	}
+
+	if !info.IsDir() {
+		return s.Fs.Rename(oldname, newname)
+	}
+
+	// Move the content one by one, as the MemMapFs only renames the directory itself.
+	names, err := afero.ReadDir(s.Fs, oldname)
+	if err != nil {
+		return err
+	}
+	if err := s.Fs.Mkdir(newname, info.Mode().Perm()); err != nil {
+		return err
+	}
+	for _, child := range names {
+		if err := s.Rename(path.Join(oldname, child.Name()), path.Join(newname, child.Name())); err != nil {
+			return err
+		}
+	}
+	return s.Fs.Remove(oldname)
+}
+
+// strictFile fixes the writes of the afero.MemMapFs: writing behind the end drops the existing data,
+// WriteAt moves the offset and O_APPEND only applies to the first write.
+type strictFile struct {
+	afero.File
+	append bool
+}
+
+// grow fills the file with zeros up to the offset, so that the MemMapFs keeps the data when writing there.
+func (f *strictFile) grow(offset int64) error {
+	info, err := f.File.Stat()
+	if err != nil {
+		return err
+	}
+	if offset > info.Size() {
+		return f.File.Truncate(offset)
+	}
+	return nil
+}
+
+func (f *strictFile) Write(p []byte) (int, error) {
+	whence := io.SeekCurrent
+	if f.append {
+		whence = io.SeekEnd
+	}
+	offset, err := f.File.Seek(0, whence)
+	if err != nil {
+		return 0, err
+	}
+	if err := f.grow(offset); err != nil {
+		return 0, err
+	}
+	return f.File.Write(p)
+}
+
+func (f *strictFile) WriteAt(p []byte, off int64) (int, error) {
+	offset, err := f.File.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	if err := f.grow(off); err != nil {
+		return 0, err
+	}
+
+	n, err := f.File.WriteAt(p, off)
+	if _, seekErr := f.File.Seek(offset, io.SeekStart); err == nil {
+		err = seekErr
+	}
+	return n, err
+}
+
+func (f *strictFile) WriteString(s string) (int, error) {
+	return f.Write([]byte(s))
+}
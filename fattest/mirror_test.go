@@ -0,0 +1,146 @@
+package fattest
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+// lossyFs loses the last byte of every write, like a buggy write path.
+type lossyFs struct {
+	afero.Fs
+}
+
+func (l lossyFs) OpenFile(name string, flag int, perm os.FileMode) (afero.File, error) {
+	file, err := l.Fs.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return lossyFile{file}, nil
+}
+
+func (l lossyFs) Create(name string) (afero.File, error) {
+	return l.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+type lossyFile struct {
+	afero.File
+}
+
+func (l lossyFile) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if _, err := l.File.Write(p[:len(p)-1]); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func TestMirrorFs(t *testing.T) {
+	tests := []struct {
+		name string
+		fs   func(t *testing.T) afero.Fs
+		ops  func(t *testing.T, fs afero.Fs)
+		// want contains the parts which have to be in the error of Verify. Without any, Verify has to succeed.
+		want []string
+	}{
+		{
+			name: "consistent filesystem",
+			fs: func(t *testing.T) afero.Fs {
+				return afero.NewBasePathFs(afero.NewOsFs(), t.TempDir())
+			},
+			ops: func(t *testing.T, fs afero.Fs) {
+				_ = fs.MkdirAll("a/b", 0777)
+				_ = afero.WriteFile(fs, "a/b/file.txt", []byte("hello world"), 0666)
+				_ = fs.Rename("a/b", "c")
+				_ = fs.Remove("a")
+				_ = fs.Remove("c")
+				_, _ = fs.Create("missing/file.txt")
+				_, _ = fs.Stat("c/file.txt")
+
+				file, err := fs.OpenFile("c/file.txt", os.O_RDWR, 0)
+				if err != nil {
+					t.Fatal(err)
+				}
+				_, _ = file.WriteAt([]byte("HELLO"), 0)
+				_, _ = file.Seek(6, io.SeekStart)
+				_, _ = io.ReadAll(file)
+				_ = file.Truncate(5)
+				_, _ = file.Readdirnames(-1)
+				_ = file.Close()
+
+				dir, err := fs.Open("c")
+				if err != nil {
+					t.Fatal(err)
+				}
+				_, _ = dir.Readdir(-1)
+				_ = dir.Close()
+			},
+		},
+		{
+			name: "lost writes",
+			fs: func(t *testing.T) afero.Fs {
+				return lossyFs{afero.NewMemMapFs()}
+			},
+			ops: func(t *testing.T, fs afero.Fs) {
+				_ = afero.WriteFile(fs, "file.txt", []byte("hello world"), 0666)
+				_, _ = afero.ReadFile(fs, "file.txt")
+			},
+			want: []string{
+				"Stat file.txt: got file of 10 bytes, want file of 11 bytes",
+				"Verify file.txt: got file of 10 bytes, want file of 11 bytes",
+			},
+		},
+		{
+			name: "lax filesystem",
+			fs: func(t *testing.T) afero.Fs {
+				return afero.NewMemMapFs()
+			},
+			ops: func(t *testing.T, fs afero.Fs) {
+				_ = afero.WriteFile(fs, "dir/file.txt", []byte("x"), 0666)
+				_ = fs.Mkdir("empty", 0777)
+				_ = afero.WriteFile(fs, "empty/file.txt", []byte("y"), 0666)
+				_ = fs.Remove("empty")
+			},
+			want: []string{
+				"OpenFile dir/file.txt: got success, want error",
+				"Remove empty: got success, want error",
+				"Verify dir: got directory, want missing",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := tt.fs(t)
+			_ = afero.WriteFile(fs, "existing.txt", []byte("before"), 0666)
+
+			mirror, err := NewMirrorFs(fs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.ops(t, mirror)
+
+			err = mirror.Verify()
+			if len(tt.want) == 0 {
+				if err != nil {
+					t.Errorf("MirrorFs.Verify() error = %v", err)
+				}
+				return
+			}
+
+			if !errors.Is(err, ErrMismatch) {
+				t.Fatalf("MirrorFs.Verify() error = %v, want %v", err, ErrMismatch)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("MirrorFs.Verify() error = %v, want it to contain %v", err, want)
+				}
+			}
+		})
+	}
+}
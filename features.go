@@ -0,0 +1,55 @@
+package gofat
+
+// Feature is a capability which may or may not be supported by this build of GoFAT.
+type Feature string
+
+const (
+	// FeatureRead is reading files and directories.
+	FeatureRead Feature = "read"
+	// FeatureWrite is creating, writing, renaming and removing files and directories.
+	FeatureWrite Feature = "write"
+	// FeatureFormat is creating new filesystems using Format and Clone.
+	FeatureFormat Feature = "format"
+	// FeatureCheck is checking filesystems for inconsistencies using Fs.Check.
+	FeatureCheck Feature = "check"
+	// FeatureFAT12 is support for FAT12 filesystems.
+	FeatureFAT12 Feature = "fat12"
+	// FeatureFAT16 is support for FAT16 filesystems.
+	FeatureFAT16 Feature = "fat16"
+	// FeatureFAT32 is support for FAT32 filesystems.
+	FeatureFAT32 Feature = "fat32"
+	// FeatureExFAT is support for exFAT filesystems.
+	FeatureExFAT Feature = "exfat"
+	// FeatureFUSE is mounting filesystems using FUSE.
+	FeatureFUSE Feature = "fuse"
+)
+
+// supportedFeatures contains all known features and whether they are supported.
+var supportedFeatures = map[Feature]bool{
+	FeatureRead:   true,
+	FeatureWrite:  true,
+	FeatureFormat: true,
+	FeatureCheck:  true,
+	FeatureFAT12:  true,
+	FeatureFAT16:  true,
+	FeatureFAT32:  true,
+	FeatureExFAT:  false,
+	FeatureFUSE:   false,
+}
+
+// Features reports all known features and whether they are supported by this build.
+// It allows tools to check for a capability up front instead of failing in the middle of an operation.
+// The returned map may be modified by the caller.
+func Features() map[Feature]bool {
+	features := make(map[Feature]bool, len(supportedFeatures))
+	for feature, supported := range supportedFeatures {
+		features[feature] = supported
+	}
+	return features
+}
+
+// Supports returns true if the feature is supported by this build.
+// Unknown features are not supported.
+func Supports(feature Feature) bool {
+	return supportedFeatures[feature]
+}
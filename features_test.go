@@ -0,0 +1,39 @@
+package gofat
+
+import "testing"
+
+func TestFeatures(t *testing.T) {
+	features := Features()
+	for _, feature := range []Feature{FeatureRead, FeatureWrite, FeatureFAT16, FeatureFAT32, FeatureFAT12, FeatureExFAT} {
+		if _, ok := features[feature]; !ok {
+			t.Errorf("Features() does not report %v", feature)
+		}
+	}
+
+	// Changing the result must not change the supported features.
+	features[FeatureExFAT] = true
+	if Supports(FeatureExFAT) {
+		t.Errorf("Supports(%v) = true after modifying the result of Features()", FeatureExFAT)
+	}
+}
+
+func TestSupports(t *testing.T) {
+	tests := []struct {
+		feature Feature
+		want    bool
+	}{
+		{feature: FeatureRead, want: true},
+		{feature: FeatureWrite, want: true},
+		{feature: FeatureFAT32, want: true},
+		{feature: FeatureFAT12, want: true},
+		{feature: FeatureFUSE, want: false},
+		{feature: "unknown", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.feature), func(t *testing.T) {
+			if got := Supports(tt.feature); got != tt.want {
+				t.Errorf("Supports() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
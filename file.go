@@ -7,15 +7,17 @@ import (
 	"io"
 	"os"
 	"syscall"
+	"time"
 
 	"github.com/spf13/afero"
 )
 
 // These errors may occur while processing a file.
 var (
-	ErrReadFile = errors.New("could not read file completely")
-	ErrSeekFile = errors.New("could not seek inside of the file")
-	ErrReadDir  = errors.New("could not read the directory")
+	ErrReadFile  = errors.New("could not read file completely")
+	ErrSeekFile  = errors.New("could not seek inside of the file")
+	ErrReadDir   = errors.New("could not read the directory")
+	ErrWriteFile = errors.New("could not write file completely")
 )
 
 // fatFileFs provides all methods needed from a fat filesystem for File.
@@ -23,9 +25,19 @@ var (
 // Generated mock using mockgen:
 //  mockgen -source=file.go -destination=file_mock.go -package gofat
 type fatFileFs interface {
-	readFileAt(cluster fatEntry, fileSize int64, offset int64, readSize int64) ([]byte, error)
+	readFileAt(cluster fatEntry, index *clusterIndex, fileSize int64, offset int64, readSize int64) ([]byte, error)
+	releaseBuffer(buffer []byte)
+	clusterSize() int64
 	readRoot() ([]ExtendedEntryHeader, error)
 	readDir(cluster fatEntry) ([]ExtendedEntryHeader, error)
+	writeFileAt(path string, cluster fatEntry, fileSize int64, offset int64, data []byte) (fatEntry, error)
+	writeFileChainAt(path string, cluster fatEntry, chain []fatEntry, fileSize int64, offset int64, data []byte) ([]fatEntry, error)
+	truncateFile(path string, cluster fatEntry, fileSize int64, size int64) (fatEntry, error)
+	reserveFile(path string, cluster fatEntry, size int64) ([]fatEntry, error)
+	updateEntry(op MutationOp, path string, dirCluster fatEntry, index int, entry EntryHeader) error
+	sync() error
+	reportProgress(done int64, total int64)
+	now() time.Time
 }
 
 type File struct {
@@ -40,9 +52,33 @@ type File struct {
 	firstCluster fatEntry
 	stat         os.FileInfo
 	offset       int64
+
+	// dirCluster and entryIndex locate the entry of the file inside of its parent directory.
+	// They are needed to update the entry after writing.
+	dirCluster fatEntry
+	entryIndex int
+
+	// flag contains the flags the file was opened with (e.g. os.O_RDWR).
+	flag int
+
+	// dirEntries contains the entries of a directory after the first Readdir and dirPos is the index of the next
+	// entry to return. This way the directory is read only once and not for each call.
+	dirEntries []ExtendedEntryHeader
+	dirPos     int
+
+	// chain caches the cluster chain of the file to allow fast random access.
+	// It is filled on the first read and is safe for concurrent use, so ReadAt does not change the File itself.
+	chain clusterIndex
+
+	// handle is the entry in the registry of open files, see Options.TrackOpenFiles. It may be nil.
+	handle *fileHandle
+
+	// modes maps the entries to the modes of their FileInfos, see Options.FileMode. It may be nil.
+	modes *modeMapper
 }
 
 func (f *File) Close() error {
+	f.handle.untrack(f)
 	f.fs = nil
 	f.path = ""
 	f.isDirectory = false
@@ -52,6 +88,12 @@ func (f *File) Close() error {
 	f.firstCluster = 0
 	f.stat = nil
 	f.offset = 0
+	f.dirCluster = 0
+	f.entryIndex = 0
+	f.flag = 0
+	f.dirEntries = nil
+	f.dirPos = 0
+	f.chain.reset()
 
 	return nil
 }
@@ -67,21 +109,22 @@ func (f *File) Read(p []byte) (n int, err error) {
 	}
 
 	offset := f.offset
-	data, err := f.fs.readFileAt(f.firstCluster, f.stat.Size(), offset, int64(len(p)))
+	data, err := f.fs.readFileAt(f.firstCluster, &f.chain, f.stat.Size(), offset, int64(len(p)))
 
 	if data != nil {
 		copy(p, data)
+		f.fs.releaseBuffer(data)
 	}
 
 	// Seek even if an error occurred, errors from reading are used even if seek also errors.
 	_, seekErr := f.Seek(int64(len(data)), io.SeekCurrent)
 
 	if err != nil {
-		return len(data), checkpoint.Wrap(err, ErrReadFile)
+		return len(data), checkpoint.Wrap(err, fmt.Errorf("%w: %v", ErrReadFile, f.path))
 	}
 
 	if seekErr != nil {
-		return len(data), checkpoint.Wrap(seekErr, ErrReadFile)
+		return len(data), checkpoint.Wrap(seekErr, fmt.Errorf("%w: %v", ErrReadFile, f.path))
 	}
 
 	return len(data), nil
@@ -98,22 +141,62 @@ func (f *File) ReadAt(p []byte, off int64) (n int, err error) {
 	}
 
 	size := len(p)
-	data, err := f.fs.readFileAt(f.firstCluster, f.stat.Size(), off, int64(size))
+	data, err := f.fs.readFileAt(f.firstCluster, &f.chain, f.stat.Size(), off, int64(size))
 
 	if data != nil {
 		copy(p, data)
+		f.fs.releaseBuffer(data)
 	}
 
 	if err != nil {
-		return len(data), checkpoint.Wrap(err, ErrReadFile)
+		return len(data), checkpoint.Wrap(err, fmt.Errorf("%w: %v", ErrReadFile, f.path))
 	}
 
 	if len(data) < size {
-		return len(data), checkpoint.Wrap(err, ErrReadFile)
+		return len(data), checkpoint.Wrap(err, fmt.Errorf("%w: %v", ErrReadFile, f.path))
 	}
 	return len(data), nil
 }
 
+// WriteTo writes the rest of the file starting at the current offset to the writer and moves the offset behind it.
+// It reads one cluster at a time, so io.Copy does not need to split the file into many small reads.
+func (f *File) WriteTo(w io.Writer) (n int64, err error) {
+	chunkSize := f.fs.clusterSize()
+	total := f.stat.Size() - f.offset
+
+	for f.offset < f.stat.Size() {
+		// Read up to the end of the current cluster, so that each read uses exactly one cluster.
+		size := chunkSize - f.offset%chunkSize
+		if rest := f.stat.Size() - f.offset; rest < size {
+			size = rest
+		}
+
+		data, err := f.fs.readFileAt(f.firstCluster, &f.chain, f.stat.Size(), f.offset, size)
+		if err == nil && len(data) == 0 {
+			err = io.ErrUnexpectedEOF
+		}
+
+		written, writeErr := w.Write(data)
+		f.fs.releaseBuffer(data)
+		n += int64(written)
+		f.offset += int64(written)
+
+		if err != nil {
+			return n, checkpoint.Wrap(err, fmt.Errorf("%w: %v", ErrReadFile, f.path))
+		}
+		if writeErr != nil {
+			return n, checkpoint.From(writeErr)
+		}
+		if written < len(data) {
+			return n, checkpoint.From(io.ErrShortWrite)
+		}
+
+		f.fs.reportProgress(n, total)
+	}
+
+	return n, nil
+}
+
 // Seek jumps to a specific offset in the file. This affects all Read operation except ReadAt.
 // May return a syscall.EINVAL error if the whence value is invalid.
 // May return an afero.ErrOutOfRange error if the offset is out of range.
@@ -133,67 +216,338 @@ func (f *File) Seek(offset int64, whence int) (int64, error) {
 	}
 
 	f.offset = offset
+
+	// Like os.File, seeking a directory restarts reading its entries.
+	if f.isDirectory {
+		f.dirEntries = nil
+		f.dirPos = 0
+	}
 	return offset, nil
 }
 
+// Write writes the data at the current offset and moves the offset behind the written data.
+// If the file was opened with os.O_APPEND, the data is always written to the end of the file.
 func (f *File) Write(p []byte) (n int, err error) {
-	panic("implement me")
+	offset := f.offset
+	if f.flag&os.O_APPEND != 0 && f.stat != nil {
+		offset = f.stat.Size()
+	}
+
+	n, err = f.write(p, offset)
+	if n > 0 {
+		f.offset = offset + int64(n)
+	}
+
+	return n, err
+}
+
+// readFromClusters is the count of clusters ReadFrom writes at once.
+const readFromClusters = 16
+
+// ReadFrom writes all data from the reader at the current offset and moves the offset behind the written data.
+// If the size of the reader is known (e.g. for *os.File or *bytes.Reader) all clusters are allocated up front.
+// The data is written in chunks of whole clusters, so io.Copy into a file does not need many small writes.
+// The cluster chain is kept between the chunks, so it is only followed once.
+func (f *File) ReadFrom(r io.Reader) (n int64, err error) {
+	if err := f.checkWritable(); err != nil {
+		return 0, checkpoint.Wrap(err, ErrWriteFile)
+	}
+
+	offset := f.offset
+	if f.flag&os.O_APPEND != 0 {
+		offset = f.stat.Size()
+	}
+
+	// chain is nil until it is known, then writeFileChainAt reads it once.
+	var chain []fatEntry
+	reserved := false
+	if size, ok := remainingSize(r); ok && size > 0 && offset+size <= 0xFFFFFFFF {
+		chain, err = f.fs.reserveFile(f.path, f.firstCluster, offset+size)
+		if err != nil {
+			return 0, checkpoint.Wrap(err, ErrWriteFile)
+		}
+
+		// A new chain has to be saved in the entry right away, otherwise its clusters would be lost on errors.
+		if chain[0] != f.firstCluster {
+			if err := f.updateEntry(OpWrite, chain[0], f.stat.Size()); err != nil {
+				return 0, checkpoint.Wrap(err, ErrWriteFile)
+			}
+		}
+		reserved = true
+	}
+
+	clusterSize := f.fs.clusterSize()
+	buffer := make([]byte, clusterSize*readFromClusters)
+
+	// The first chunk only fills the current cluster, so that all following writes start at a cluster.
+	chunk := buffer[:int64(len(buffer))-offset%clusterSize]
+	for {
+		read, readErr := io.ReadFull(r, chunk)
+		if read > 0 {
+			chain, err = f.writeChunk(chain, chunk[:read], offset)
+			if err != nil {
+				return n, err
+			}
+			n += int64(read)
+			offset += int64(read)
+			f.offset = offset
+		}
+
+		if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+			break
+		}
+		if readErr != nil {
+			err = checkpoint.Wrap(readErr, ErrWriteFile)
+			break
+		}
+
+		chunk = buffer
+	}
+
+	// Give back the clusters which were reserved but not needed because the reader returned less data.
+	if reserved {
+		cluster, truncateErr := f.fs.truncateFile(f.path, f.firstCluster, f.stat.Size(), f.stat.Size())
+		if truncateErr == nil && cluster != f.firstCluster {
+			truncateErr = f.updateEntry(OpTruncate, cluster, f.stat.Size())
+		}
+		if err == nil && truncateErr != nil {
+			err = checkpoint.Wrap(truncateErr, ErrWriteFile)
+		}
+	}
+
+	return n, err
 }
 
+// writeChunk writes p at the offset into the file with the given chain like write does.
+// It returns the (maybe grown) chain.
+func (f *File) writeChunk(chain []fatEntry, p []byte, off int64) ([]fatEntry, error) {
+	// FAT uses 32 bit for the file size.
+	if off+int64(len(p)) > 0xFFFFFFFF {
+		return chain, checkpoint.Wrap(syscall.EFBIG, ErrWriteFile)
+	}
+
+	chain, err := f.fs.writeFileChainAt(f.path, f.firstCluster, chain, f.stat.Size(), off, p)
+	if err != nil {
+		return chain, checkpoint.Wrap(err, ErrWriteFile)
+	}
+
+	size := f.stat.Size()
+	if off+int64(len(p)) > size {
+		size = off + int64(len(p))
+	}
+
+	err = f.updateEntry(OpWrite, chain[0], size)
+	if err != nil {
+		return chain, checkpoint.Wrap(err, ErrWriteFile)
+	}
+
+	return chain, nil
+}
+
+// remainingSize returns the count of bytes left in the reader if it can be determined without reading.
+func remainingSize(r io.Reader) (int64, bool) {
+	switch r := r.(type) {
+	case interface{ Len() int }:
+		// E.g. bytes.Reader, bytes.Buffer and strings.Reader.
+		return int64(r.Len()), true
+	case interface {
+		io.Seeker
+		Stat() (os.FileInfo, error)
+	}:
+		// E.g. os.File and afero.File.
+		info, err := r.Stat()
+		if err != nil || !info.Mode().IsRegular() {
+			return 0, false
+		}
+
+		offset, err := r.Seek(0, io.SeekCurrent)
+		if err != nil || offset > info.Size() {
+			return 0, false
+		}
+		return info.Size() - offset, true
+	}
+
+	return 0, false
+}
+
+// WriteAt writes the data at the given offset. The offset of the file is not changed.
+// It is not allowed for files opened with os.O_APPEND.
 func (f *File) WriteAt(p []byte, off int64) (n int, err error) {
-	panic("implement me")
+	if f.flag&os.O_APPEND != 0 {
+		return 0, checkpoint.Wrap(syscall.EINVAL, fmt.Errorf("%w: WriteAt is not allowed in append mode", ErrWriteFile))
+	}
+
+	if off < 0 {
+		return 0, checkpoint.Wrap(syscall.EINVAL, fmt.Errorf("%w: negative offset %v", ErrWriteFile, off))
+	}
+
+	return f.write(p, off)
+}
+
+// checkWritable returns an error if the file cannot be written.
+func (f *File) checkWritable() error {
+	if f.fs == nil {
+		return os.ErrClosed
+	}
+
+	if f.isDirectory {
+		return syscall.EISDIR
+	}
+
+	if f.flag&(os.O_WRONLY|os.O_RDWR) == 0 {
+		return syscall.EBADF
+	}
+
+	return nil
+}
+
+// write writes the data at the given offset and updates the entry of the file afterwards.
+func (f *File) write(p []byte, off int64) (int, error) {
+	if err := f.checkWritable(); err != nil {
+		return 0, checkpoint.Wrap(err, ErrWriteFile)
+	}
+
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	// FAT uses 32 bit for the file size.
+	if off+int64(len(p)) > 0xFFFFFFFF {
+		return 0, checkpoint.Wrap(syscall.EFBIG, ErrWriteFile)
+	}
+
+	cluster, err := f.fs.writeFileAt(f.path, f.firstCluster, f.stat.Size(), off, p)
+	if err != nil {
+		return 0, checkpoint.Wrap(err, ErrWriteFile)
+	}
+
+	size := f.stat.Size()
+	if off+int64(len(p)) > size {
+		size = off + int64(len(p))
+	}
+
+	err = f.updateEntry(OpWrite, cluster, size)
+	if err != nil {
+		return 0, checkpoint.Wrap(err, ErrWriteFile)
+	}
+
+	return len(p), nil
+}
+
+// updateEntry saves the first cluster, the size and the modification time into the entry of the file.
+// The op is the operation which needs the update.
+func (f *File) updateEntry(op MutationOp, cluster fatEntry, size int64) error {
+	entry, ok := f.stat.Sys().(ExtendedEntryHeader)
+	if !ok {
+		return checkpoint.From(fmt.Errorf("%w: the file has no directory entry", ErrNotSupported))
+	}
+
+	now := f.fs.now()
+	entry.setFirstCluster(cluster)
+	entry.FileSize = uint32(size)
+	entry.WriteDate = FormatDate(now)
+	entry.WriteTime = FormatTime(now)
+	entry.LastAccessDate = FormatDate(now)
+	entry.Attribute |= AttrArchive
+
+	err := f.fs.updateEntry(op, f.path, f.dirCluster, f.entryIndex, entry.EntryHeader)
+	if err != nil {
+		return err
+	}
+
+	f.firstCluster = cluster
+	f.stat = f.modes.fileInfo(&entry)
+	// The chain may have changed.
+	f.chain.reset()
+	return nil
 }
 
 func (f *File) Name() string {
 	return f.stat.Name()
 }
 
+// DirEntry is an entry of a directory returned by File.ReaddirExtended.
+type DirEntry struct {
+	os.FileInfo
+	// Header is the raw directory entry together with the long filename.
+	Header ExtendedEntryHeader
+}
+
 // Readdir reads the contents of a directory.
 // May return syscall.ENOTDIR if the current File is no directory.
 func (f *File) Readdir(count int) ([]os.FileInfo, error) {
-	if !f.isDirectory {
-		return nil, checkpoint.Wrap(syscall.ENOTDIR, ErrReadDir)
+	content, err := f.readdir(count)
+	if content == nil {
+		return nil, err
 	}
 
-	var content []ExtendedEntryHeader
-	var err error
-	if f.path == "" {
-		content, err = f.fs.readRoot()
-	} else {
-		content, err = f.fs.readDir(f.firstCluster)
+	result := make([]os.FileInfo, len(content))
+	for i := range content {
+		result[i] = f.modes.fileInfo(&content[i])
 	}
 
-	if err != nil {
-		return nil, checkpoint.Wrap(err, ErrReadDir)
+	return result, err
+}
+
+// ReaddirExtended works like Readdir but returns the raw directory entries together with the FileInfo,
+// e.g. to get the first cluster or the attributes without a type assertion of FileInfo.Sys for every entry.
+func (f *File) ReaddirExtended(count int) ([]DirEntry, error) {
+	content, err := f.readdir(count)
+	if content == nil {
+		return nil, err
 	}
 
-	end := len(content)
+	result := make([]DirEntry, len(content))
+	for i := range content {
+		result[i] = DirEntry{
+			FileInfo: f.modes.fileInfo(&content[i]),
+			Header:   content[i],
+		}
+	}
+
+	return result, err
+}
 
-	if int64(len(content)) < f.offset+int64(count) {
-		count = len(content) - int(f.offset)
-		err = io.EOF
+// readdir returns the next count entries of the directory. See Readdir for the meaning of count.
+func (f *File) readdir(count int) ([]ExtendedEntryHeader, error) {
+	if !f.isDirectory {
+		return nil, checkpoint.Wrap(syscall.ENOTDIR, fmt.Errorf("%w: %v", ErrReadDir, f.path))
 	}
 
-	if count >= 0 {
-		end = int(f.offset) + count
+	// The directory is read only once. Later calls continue with the remaining entries.
+	if f.dirEntries == nil {
+		var content []ExtendedEntryHeader
+		var err error
+		if f.path == "" {
+			content, err = f.fs.readRoot()
+		} else {
+			content, err = f.fs.readDir(f.firstCluster)
+		}
+
+		if err != nil {
+			return nil, checkpoint.Wrap(err, fmt.Errorf("%w: %v", ErrReadDir, f.path))
+		}
+
+		f.dirEntries = append(make([]ExtendedEntryHeader, 0, len(content)), content...)
 	}
 
-	// TODO: Maybe support the count param directly in readDir to avoid reading too much.
-	//       (Not sure if that's easy and worth it)
-	content = content[f.offset:end]
+	remaining := f.dirEntries[f.dirPos:]
 
-	if count > 0 {
-		f.offset += int64(count)
-	} else if count < 0 {
-		f.offset = int64(end)
+	// Like os.File, a count <= 0 returns all remaining entries without io.EOF.
+	if count <= 0 {
+		f.dirPos = len(f.dirEntries)
+		return remaining, nil
 	}
 
-	result := make([]os.FileInfo, len(content))
-	for i := range content {
-		result[i] = content[i].FileInfo()
+	if len(remaining) == 0 {
+		return remaining, io.EOF
 	}
 
-	return result, err
+	if count > len(remaining) {
+		count = len(remaining)
+	}
+	f.dirPos += count
+	return remaining[:count], nil
 }
 
 func (f *File) Readdirnames(count int) ([]string, error) {
@@ -214,12 +568,31 @@ func (f *File) Stat() (os.FileInfo, error) {
 	return f.stat, nil
 }
 
+// Sync flushes the underlying reader of the filesystem if it supports it.
 func (f *File) Sync() error {
-	panic("implement me")
+	if f.fs == nil {
+		return os.ErrClosed
+	}
+
+	return f.fs.sync()
 }
 
+// Truncate changes the size of the file. If it gets bigger, the new part is filled with zeros.
 func (f *File) Truncate(size int64) error {
-	panic("implement me")
+	if err := f.checkWritable(); err != nil {
+		return checkpoint.Wrap(err, ErrWriteFile)
+	}
+
+	if size < 0 || size > 0xFFFFFFFF {
+		return checkpoint.Wrap(syscall.EINVAL, fmt.Errorf("%w: invalid size %v", ErrWriteFile, size))
+	}
+
+	cluster, err := f.fs.truncateFile(f.path, f.firstCluster, f.stat.Size(), size)
+	if err != nil {
+		return checkpoint.Wrap(err, ErrWriteFile)
+	}
+
+	return checkpoint.Wrap(f.updateEntry(OpTruncate, cluster, size), ErrWriteFile)
 }
 
 func (f *File) WriteString(s string) (ret int, err error) {
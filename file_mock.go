@@ -6,6 +6,7 @@ package gofat
 
 import (
 	reflect "reflect"
+	time "time"
 
 	gomock "github.com/golang/mock/gomock"
 )
@@ -33,6 +34,34 @@ func (m *MockfatFileFs) EXPECT() *MockfatFileFsMockRecorder {
 	return m.recorder
 }
 
+// clusterSize mocks base method.
+func (m *MockfatFileFs) clusterSize() int64 {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "clusterSize")
+	ret0, _ := ret[0].(int64)
+	return ret0
+}
+
+// clusterSize indicates an expected call of clusterSize.
+func (mr *MockfatFileFsMockRecorder) clusterSize() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "clusterSize", reflect.TypeOf((*MockfatFileFs)(nil).clusterSize))
+}
+
+// now mocks base method.
+func (m *MockfatFileFs) now() time.Time {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "now")
+	ret0, _ := ret[0].(time.Time)
+	return ret0
+}
+
+// now indicates an expected call of now.
+func (mr *MockfatFileFsMockRecorder) now() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "now", reflect.TypeOf((*MockfatFileFs)(nil).now))
+}
+
 // readDir mocks base method.
 func (m *MockfatFileFs) readDir(cluster fatEntry) ([]ExtendedEntryHeader, error) {
 	m.ctrl.T.Helper()
@@ -49,18 +78,18 @@ func (mr *MockfatFileFsMockRecorder) readDir(cluster interface{}) *gomock.Call {
 }
 
 // readFileAt mocks base method.
-func (m *MockfatFileFs) readFileAt(cluster fatEntry, fileSize, offset, readSize int64) ([]byte, error) {
+func (m *MockfatFileFs) readFileAt(cluster fatEntry, index *clusterIndex, fileSize, offset, readSize int64) ([]byte, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "readFileAt", cluster, fileSize, offset, readSize)
+	ret := m.ctrl.Call(m, "readFileAt", cluster, index, fileSize, offset, readSize)
 	ret0, _ := ret[0].([]byte)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // readFileAt indicates an expected call of readFileAt.
-func (mr *MockfatFileFsMockRecorder) readFileAt(cluster, fileSize, offset, readSize interface{}) *gomock.Call {
+func (mr *MockfatFileFsMockRecorder) readFileAt(cluster, index, fileSize, offset, readSize interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "readFileAt", reflect.TypeOf((*MockfatFileFs)(nil).readFileAt), cluster, fileSize, offset, readSize)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "readFileAt", reflect.TypeOf((*MockfatFileFs)(nil).readFileAt), cluster, index, fileSize, offset, readSize)
 }
 
 // readRoot mocks base method.
@@ -77,3 +106,115 @@ func (mr *MockfatFileFsMockRecorder) readRoot() *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "readRoot", reflect.TypeOf((*MockfatFileFs)(nil).readRoot))
 }
+
+// releaseBuffer mocks base method.
+func (m *MockfatFileFs) releaseBuffer(buffer []byte) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "releaseBuffer", buffer)
+}
+
+// releaseBuffer indicates an expected call of releaseBuffer.
+func (mr *MockfatFileFsMockRecorder) releaseBuffer(buffer interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "releaseBuffer", reflect.TypeOf((*MockfatFileFs)(nil).releaseBuffer), buffer)
+}
+
+// reportProgress mocks base method.
+func (m *MockfatFileFs) reportProgress(done, total int64) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "reportProgress", done, total)
+}
+
+// reportProgress indicates an expected call of reportProgress.
+func (mr *MockfatFileFsMockRecorder) reportProgress(done, total interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "reportProgress", reflect.TypeOf((*MockfatFileFs)(nil).reportProgress), done, total)
+}
+
+// reserveFile mocks base method.
+func (m *MockfatFileFs) reserveFile(path string, cluster fatEntry, size int64) ([]fatEntry, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "reserveFile", path, cluster, size)
+	ret0, _ := ret[0].([]fatEntry)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// reserveFile indicates an expected call of reserveFile.
+func (mr *MockfatFileFsMockRecorder) reserveFile(path, cluster, size interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "reserveFile", reflect.TypeOf((*MockfatFileFs)(nil).reserveFile), path, cluster, size)
+}
+
+// sync mocks base method.
+func (m *MockfatFileFs) sync() error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "sync")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// sync indicates an expected call of sync.
+func (mr *MockfatFileFsMockRecorder) sync() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "sync", reflect.TypeOf((*MockfatFileFs)(nil).sync))
+}
+
+// truncateFile mocks base method.
+func (m *MockfatFileFs) truncateFile(path string, cluster fatEntry, fileSize, size int64) (fatEntry, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "truncateFile", path, cluster, fileSize, size)
+	ret0, _ := ret[0].(fatEntry)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// truncateFile indicates an expected call of truncateFile.
+func (mr *MockfatFileFsMockRecorder) truncateFile(path, cluster, fileSize, size interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "truncateFile", reflect.TypeOf((*MockfatFileFs)(nil).truncateFile), path, cluster, fileSize, size)
+}
+
+// updateEntry mocks base method.
+func (m *MockfatFileFs) updateEntry(op MutationOp, path string, dirCluster fatEntry, index int, entry EntryHeader) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "updateEntry", op, path, dirCluster, index, entry)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// updateEntry indicates an expected call of updateEntry.
+func (mr *MockfatFileFsMockRecorder) updateEntry(op, path, dirCluster, index, entry interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "updateEntry", reflect.TypeOf((*MockfatFileFs)(nil).updateEntry), op, path, dirCluster, index, entry)
+}
+
+// writeFileAt mocks base method.
+func (m *MockfatFileFs) writeFileAt(path string, cluster fatEntry, fileSize, offset int64, data []byte) (fatEntry, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "writeFileAt", path, cluster, fileSize, offset, data)
+	ret0, _ := ret[0].(fatEntry)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// writeFileAt indicates an expected call of writeFileAt.
+func (mr *MockfatFileFsMockRecorder) writeFileAt(path, cluster, fileSize, offset, data interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "writeFileAt", reflect.TypeOf((*MockfatFileFs)(nil).writeFileAt), path, cluster, fileSize, offset, data)
+}
+
+// writeFileChainAt mocks base method.
+func (m *MockfatFileFs) writeFileChainAt(path string, cluster fatEntry, chain []fatEntry, fileSize, offset int64, data []byte) ([]fatEntry, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "writeFileChainAt", path, cluster, chain, fileSize, offset, data)
+	ret0, _ := ret[0].([]fatEntry)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// writeFileChainAt indicates an expected call of writeFileChainAt.
+func (mr *MockfatFileFsMockRecorder) writeFileChainAt(path, cluster, chain, fileSize, offset, data interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "writeFileChainAt", reflect.TypeOf((*MockfatFileFs)(nil).writeFileChainAt), path, cluster, chain, fileSize, offset, data)
+}
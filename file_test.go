@@ -1,15 +1,19 @@
 package gofat
 
 import (
+	"bytes"
 	"errors"
 	"io"
 	"os"
 	"reflect"
+	"sync"
 	"syscall"
 	"testing"
+	"testing/iotest"
 	"time"
 
 	"github.com/golang/mock/gomock"
+	"github.com/spf13/afero"
 )
 
 // fileTestFields is essentially a copy of the File struct used to fill the
@@ -63,7 +67,7 @@ func TestFile_Close(t *testing.T) {
 		},
 	}
 
-	fEmpty := File{}
+	fEmpty := &File{}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -82,8 +86,8 @@ func TestFile_Close(t *testing.T) {
 				t.Errorf("File.Close() error = %v, wantErr %v", err, tt.wantErr)
 			}
 
-			if !tt.wantErr && *f != fEmpty {
-				t.Errorf("File.Close() did not reset all fields: File = %v want = %v", *f, fEmpty)
+			if !tt.wantErr && !reflect.DeepEqual(f, fEmpty) {
+				t.Errorf("File.Close() did not reset all fields: File = %+v want = %+v", f, fEmpty)
 			}
 		})
 	}
@@ -176,9 +180,12 @@ func TestFile_Read(t *testing.T) {
 			mockCtrl := gomock.NewController(t)
 			mockFs := NewMockfatFileFs(mockCtrl)
 			mockFs.EXPECT().
-				readFileAt(tt.fields.firstCluster, tt.fields.stat.Size(), tt.fields.offset, int64(len(tt.args.p))).
+				readFileAt(tt.fields.firstCluster, gomock.Any(), tt.fields.stat.Size(), tt.fields.offset, int64(len(tt.args.p))).
 				MaxTimes(1).
 				Return(tt.mockData.readAtResult, tt.mockData.readAtError)
+			mockFs.EXPECT().
+				releaseBuffer(tt.mockData.readAtResult).
+				MaxTimes(1)
 
 			f := &File{
 				fs:           mockFs,
@@ -281,9 +288,12 @@ func TestFile_ReadAt(t *testing.T) {
 			mockCtrl := gomock.NewController(t)
 			mockFs := NewMockfatFileFs(mockCtrl)
 			mockFs.EXPECT().
-				readFileAt(tt.fields.firstCluster, tt.fields.stat.Size(), tt.args.off, int64(len(tt.args.p))).
+				readFileAt(tt.fields.firstCluster, gomock.Any(), tt.fields.stat.Size(), tt.args.off, int64(len(tt.args.p))).
 				MaxTimes(1).
 				Return(tt.mockData.readAtResult, tt.mockData.readAtError)
+			mockFs.EXPECT().
+				releaseBuffer(tt.mockData.readAtResult).
+				MaxTimes(1)
 
 			f := &File{
 				fs:           mockFs,
@@ -522,9 +532,9 @@ func TestFile_Readdir(t *testing.T) {
 				readRootError: nil,
 			},
 			want: []os.FileInfo{
-				entryHeaderFileInfo{ExtendedEntryHeader{ExtendedName: "1"}},
-				entryHeaderFileInfo{ExtendedEntryHeader{ExtendedName: "2"}},
-				entryHeaderFileInfo{ExtendedEntryHeader{ExtendedName: "3"}},
+				entryHeaderFileInfo{entry: ExtendedEntryHeader{ExtendedName: "1"}, mode: 0444},
+				entryHeaderFileInfo{entry: ExtendedEntryHeader{ExtendedName: "2"}, mode: 0444},
+				entryHeaderFileInfo{entry: ExtendedEntryHeader{ExtendedName: "3"}, mode: 0444},
 			},
 			wantErr: nil,
 		},
@@ -547,9 +557,9 @@ func TestFile_Readdir(t *testing.T) {
 				readRootError: nil,
 			},
 			want: []os.FileInfo{
-				entryHeaderFileInfo{ExtendedEntryHeader{ExtendedName: "1"}},
-				entryHeaderFileInfo{ExtendedEntryHeader{ExtendedName: "2"}},
-				entryHeaderFileInfo{ExtendedEntryHeader{ExtendedName: "3"}},
+				entryHeaderFileInfo{entry: ExtendedEntryHeader{ExtendedName: "1"}, mode: 0444},
+				entryHeaderFileInfo{entry: ExtendedEntryHeader{ExtendedName: "2"}, mode: 0444},
+				entryHeaderFileInfo{entry: ExtendedEntryHeader{ExtendedName: "3"}, mode: 0444},
 			},
 			wantErr: nil,
 		},
@@ -572,8 +582,8 @@ func TestFile_Readdir(t *testing.T) {
 				readRootError: nil,
 			},
 			want: []os.FileInfo{
-				entryHeaderFileInfo{ExtendedEntryHeader{ExtendedName: "1"}},
-				entryHeaderFileInfo{ExtendedEntryHeader{ExtendedName: "2"}},
+				entryHeaderFileInfo{entry: ExtendedEntryHeader{ExtendedName: "1"}, mode: 0444},
+				entryHeaderFileInfo{entry: ExtendedEntryHeader{ExtendedName: "2"}, mode: 0444},
 			},
 			wantErr: nil,
 		},
@@ -636,6 +646,82 @@ func TestFile_Readdir(t *testing.T) {
 	}
 }
 
+func TestFile_ReaddirPaging(t *testing.T) {
+	type call struct {
+		// seek restarts the listing before the Readdir.
+		seek    bool
+		count   int
+		wantLen int
+		wantErr error
+	}
+	tests := []struct {
+		name      string
+		calls     []call
+		wantReads int
+	}{
+		{
+			name: "pages until io.EOF",
+			calls: []call{
+				{count: 2, wantLen: 2},
+				{count: 2, wantLen: 1},
+				{count: 2, wantLen: 0, wantErr: io.EOF},
+				{count: 2, wantLen: 0, wantErr: io.EOF},
+			},
+			wantReads: 1,
+		},
+		{
+			name: "all remaining entries",
+			calls: []call{
+				{count: 1, wantLen: 1},
+				{count: -1, wantLen: 2},
+				{count: 0, wantLen: 0},
+			},
+			wantReads: 1,
+		},
+		{
+			name: "seek restarts",
+			calls: []call{
+				{count: -1, wantLen: 3},
+				{seek: true, count: 5, wantLen: 3},
+			},
+			wantReads: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			mockFs := NewMockfatFileFs(mockCtrl)
+			mockFs.EXPECT().
+				readDir(fatEntry(3)).
+				Times(tt.wantReads).
+				Return([]ExtendedEntryHeader{{ExtendedName: "1"}, {ExtendedName: "2"}, {ExtendedName: "3"}}, nil)
+
+			f := &File{
+				fs:           mockFs,
+				path:         "test",
+				isDirectory:  true,
+				firstCluster: 3,
+				stat:         fakeFileInfo{},
+			}
+
+			for i, call := range tt.calls {
+				if call.seek {
+					if _, err := f.Seek(0, io.SeekStart); err != nil {
+						t.Fatal(err)
+					}
+				}
+
+				got, err := f.Readdir(call.count)
+				if err != call.wantErr || len(got) != call.wantLen {
+					t.Errorf("File.Readdir() call %v = %v entries, %v, want %v entries, %v", i, len(got), err, call.wantLen, call.wantErr)
+				}
+			}
+
+			mockCtrl.Finish()
+		})
+	}
+}
+
 func TestFile_Readdirnames(t *testing.T) {
 	type args struct {
 		count int
@@ -910,3 +996,354 @@ func TestFile_WriteString(t *testing.T) {
 		})
 	}
 }
+
+func TestFile_WriteTo(t *testing.T) {
+	t.Run("reads cluster by cluster", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		mockFs := NewMockfatFileFs(mockCtrl)
+		mockFs.EXPECT().clusterSize().Return(int64(4)).AnyTimes()
+		gomock.InOrder(
+			mockFs.EXPECT().readFileAt(fatEntry(3), gomock.Any(), int64(10), int64(1), int64(3)).Return([]byte("ell"), nil),
+			mockFs.EXPECT().reportProgress(int64(3), int64(9)),
+			mockFs.EXPECT().readFileAt(fatEntry(3), gomock.Any(), int64(10), int64(4), int64(4)).Return([]byte("o Wo"), nil),
+			mockFs.EXPECT().reportProgress(int64(7), int64(9)),
+			mockFs.EXPECT().readFileAt(fatEntry(3), gomock.Any(), int64(10), int64(8), int64(2)).Return([]byte("rl"), nil),
+			mockFs.EXPECT().reportProgress(int64(9), int64(9)),
+		)
+		mockFs.EXPECT().releaseBuffer(gomock.Any()).Times(3)
+
+		f := &File{
+			fs:           mockFs,
+			firstCluster: 3,
+			stat:         fakeFileInfo{fileSize: 10},
+			offset:       1,
+		}
+
+		var buffer bytes.Buffer
+		n, err := f.WriteTo(&buffer)
+		mockCtrl.Finish()
+
+		if err != nil {
+			t.Fatalf("File.WriteTo() error = %v", err)
+		}
+		if n != 9 || buffer.String() != "ello Worl" {
+			t.Errorf("File.WriteTo() = %v, %q, want %v, %q", n, buffer.String(), 9, "ello Worl")
+		}
+		if f.offset != 10 {
+			t.Errorf("File.WriteTo() moved the offset to %v, want %v", f.offset, 10)
+		}
+	})
+
+	t.Run("error while reading", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		mockFs := NewMockfatFileFs(mockCtrl)
+		mockFs.EXPECT().clusterSize().Return(int64(4)).AnyTimes()
+		mockFs.EXPECT().readFileAt(fatEntry(3), gomock.Any(), int64(10), int64(0), int64(4)).Return([]byte("He"), fileTestsError)
+		mockFs.EXPECT().releaseBuffer([]byte("He"))
+
+		f := &File{
+			fs:           mockFs,
+			firstCluster: 3,
+			stat:         fakeFileInfo{fileSize: 10},
+		}
+
+		var buffer bytes.Buffer
+		n, err := f.WriteTo(&buffer)
+		mockCtrl.Finish()
+
+		if !errors.Is(err, fileTestsError) {
+			t.Errorf("File.WriteTo() error = %v, wantErr %v", err, fileTestsError)
+		}
+		if n != 2 || f.offset != 2 {
+			t.Errorf("File.WriteTo() = %v with offset %v, want 2 with offset 2", n, f.offset)
+		}
+	})
+
+	t.Run("copy from an image", func(t *testing.T) {
+		var progress []int64
+		fs, err := NewWithOptions(testFileReader(fat32), Options{Progress: func(done, total int64) {
+			progress = append(progress, done, total)
+		}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := afero.ReadFile(fs, "README.md")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		file, err := fs.Open("README.md")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+
+		var buffer bytes.Buffer
+		// io.Copy uses WriteTo if it is available.
+		if _, err := io.Copy(&buffer, file); err != nil {
+			t.Fatalf("io.Copy() error = %v", err)
+		}
+		if !bytes.Equal(buffer.Bytes(), want) {
+			t.Errorf("io.Copy() copied %v bytes, want %v bytes", buffer.Len(), len(want))
+		}
+
+		// README.md uses 3 clusters, each one is reported.
+		if len(progress) != 6 || progress[4] != int64(len(want)) || progress[5] != int64(len(want)) {
+			t.Errorf("the progress was reported as %v, want 3 times up to %v", progress, len(want))
+		}
+	})
+}
+
+// lyingReader claims to contain more data than it actually returns.
+type lyingReader struct {
+	io.Reader
+	len int
+}
+
+func (r lyingReader) Len() int {
+	return r.len
+}
+
+func TestFile_ReadFrom(t *testing.T) {
+	data := testData(100000)
+
+	tests := []struct {
+		name     string
+		existing []byte
+		seek     int64
+		reader   io.Reader
+		want     []byte
+		wantErr  error
+	}{
+		{
+			name:   "known size",
+			reader: bytes.NewReader(data),
+			want:   data,
+		},
+		{
+			name:   "unknown size",
+			reader: io.MultiReader(bytes.NewReader(data)),
+			want:   data,
+		},
+		{
+			name:   "size smaller than announced",
+			reader: lyingReader{Reader: bytes.NewReader(data[:3000]), len: len(data)},
+			want:   data[:3000],
+		},
+		{
+			name:     "in the middle of an existing file",
+			existing: data[:5000],
+			seek:     1000,
+			reader:   bytes.NewReader(data[:10000]),
+			want:     append(append([]byte{}, data[:1000]...), data[:10000]...),
+		},
+		{
+			name:    "error while reading",
+			reader:  io.MultiReader(bytes.NewReader(data[:3000]), iotest.ErrReader(fileTestsError)),
+			want:    data[:3000],
+			wantErr: fileTestsError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := testingFormat(t, FormatOptions{Size: 32 * 1024 * 1024})
+			if err := afero.WriteFile(fs, "file", tt.existing, 0666); err != nil {
+				t.Fatal(err)
+			}
+
+			file, err := fs.OpenFile("file", os.O_RDWR, 0666)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := file.Seek(tt.seek, io.SeekStart); err != nil {
+				t.Fatal(err)
+			}
+
+			// io.Copy would prefer the WriteTo of the readers, so ReadFrom is called directly.
+			n, err := file.(*File).ReadFrom(tt.reader)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("File.ReadFrom() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if want := int64(len(tt.want)) - tt.seek; n != want {
+				t.Errorf("File.ReadFrom() = %v, want %v", n, want)
+			}
+			if err := file.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := afero.ReadFile(fs, "file")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("file contains %v bytes, want %v bytes", len(got), len(tt.want))
+			}
+
+			// No reserved clusters may be left.
+			report, err := fs.Check()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !report.OK() {
+				t.Errorf("Fs.Check() = %+v, want no findings", report.Findings)
+			}
+		})
+	}
+}
+
+func TestFile_ReadFromFollowsChainOnce(t *testing.T) {
+	tests := []struct {
+		name   string
+		reader func(data []byte) io.Reader
+	}{
+		{name: "known size", reader: func(data []byte) io.Reader { return bytes.NewReader(data) }},
+		{name: "unknown size", reader: func(data []byte) io.Reader { return io.MultiReader(bytes.NewReader(data)) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := testingFormat(t, FormatOptions{Size: 32 * 1024 * 1024})
+			clusters := 2000
+			data := testData(int(fs.clusterSize()) * clusters)
+
+			file, err := fs.Create("file")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			fs.ResetStats()
+			if _, err := file.(*File).ReadFrom(tt.reader(data)); err != nil {
+				t.Fatal(err)
+			}
+			// Allocating needs about one lookup per cluster. Following the chain again for each chunk would need
+			// about clusters²/32.
+			if lookups := fs.Stats().FatLookups; lookups > uint64(4*clusters) {
+				t.Errorf("File.ReadFrom() looked up %d FAT entries, want at most %d", lookups, 4*clusters)
+			}
+			if err := file.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := afero.ReadFile(fs, "file")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Errorf("file contains %v bytes, want %v bytes", len(got), len(data))
+			}
+		})
+	}
+}
+
+func TestFile_ReadAt_concurrent(t *testing.T) {
+	tests := []struct {
+		name   string
+		reader io.ReadSeeker
+	}{
+		{name: "io.ReaderAt", reader: testFileReader(fat32)},
+		{name: "only io.ReadSeeker", reader: struct{ io.ReadSeeker }{testFileReader(fat32)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs, err := NewWithOptions(tt.reader, Options{CacheSize: 2})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want, err := afero.ReadFile(fs, "README.md")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			file, err := fs.Open("README.md")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer file.Close()
+
+			// All goroutines share the same handle as allowed by io.ReaderAt.
+			var wg sync.WaitGroup
+			for i := 0; i < 8; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+
+					buffer := make([]byte, 37)
+					for offset := int64(i); offset+int64(len(buffer)) <= int64(len(want)); offset += 101 {
+						if _, err := file.ReadAt(buffer, offset); err != nil {
+							t.Errorf("File.ReadAt(%v) error = %v", offset, err)
+							return
+						}
+						if !bytes.Equal(buffer, want[offset:offset+int64(len(buffer))]) {
+							t.Errorf("File.ReadAt(%v) returned wrong data", offset)
+							return
+						}
+					}
+				}(i)
+			}
+			wg.Wait()
+		})
+	}
+}
+
+func TestFile_ReaddirExtended(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		count   int
+		want    map[string]uint32
+		wantErr error
+	}{
+		{
+			name:  "all entries",
+			path:  "DoNotEdit_tests",
+			count: -1,
+			want: map[string]uint32{
+				"HelloWorldThisIsALoongFileName.txt": 0,
+				"README.md":                          6,
+			},
+		},
+		{
+			name:  "with count",
+			path:  "go",
+			count: 1,
+			want: map[string]uint32{
+				"main.go": 5,
+			},
+		},
+		{
+			name:    "no dir",
+			path:    "README.md",
+			count:   -1,
+			wantErr: syscall.ENOTDIR,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := testingNew(t, testFileReader(fat16))
+			file, err := fs.Open(tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer file.Close()
+
+			got, err := file.(*File).ReaddirExtended(tt.count)
+			if !errors.Is(err, tt.wantErr) || (err != nil) != (tt.wantErr != nil) {
+				t.Fatalf("File.ReaddirExtended() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			clusters := make(map[string]uint32)
+			for _, entry := range got {
+				if entry.Sys() != entry.Header {
+					t.Errorf("File.ReaddirExtended() header of %v = %v, want %v", entry.Name(), entry.Header, entry.Sys())
+				}
+				clusters[entry.Name()] = entry.Header.FirstCluster()
+			}
+			if !reflect.DeepEqual(clusters, tt.want) {
+				t.Errorf("File.ReaddirExtended() = %v, want %v", clusters, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,597 @@
+package gofat
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/aligator/gofat/checkpoint"
+)
+
+// These errors may occur while formatting a filesystem.
+var (
+	ErrFormat          = errors.New("could not format the filesystem")
+	ErrInvalidGeometry = errors.New("invalid filesystem geometry")
+	ErrInvalidBoot     = errors.New("invalid boot sector values")
+)
+
+// FormatOptions configure the filesystem created by Format.
+type FormatOptions struct {
+	// Size of the filesystem in bytes. If it is 0, the current size of the target is used.
+	Size int64
+
+	// FSType is the FAT type to create.
+	// If it is empty, FAT32 is used for volumes of at least 512 MiB, FAT12 for volumes which are too small for FAT16
+	// (below 8400 sectors of 512 bytes) and FAT16 for all others.
+	FSType FATType
+
+	// Label is the volume label with up to 11 characters. It is converted to upper case.
+	Label string
+
+	// VolumeID is the serial number of the volume. If it is 0, it is generated from the current time.
+	VolumeID uint32
+
+	// Clock provides the time used for the volume ID and the label entry. If it is nil, the system time is used.
+	Clock Clock
+
+	// BytesPerSector has to be 512, 1024, 2048 or 4096. Defaults to 512.
+	BytesPerSector uint16
+
+	// SectorsPerCluster has to be a power of two and the resulting clusters must not be bigger than 32 KiB.
+	// If it is 0, it is chosen based on the size of the volume.
+	SectorsPerCluster uint8
+
+	// The following values are written into the boot sector as they are.
+	// Some devices expect exact values there, all of them have sensible defaults.
+
+	// OEMName is the name of the system which formatted the volume with up to 8 characters.
+	// Defaults to "MSWIN4.1" which is the value most compatible with other drivers.
+	OEMName string
+
+	// JumpBoot contains the jump instruction to the boot code. It has to be either EB ?? 90 or E9 ?? ??.
+	// If it is all zero, EB 3C 90 is used for FAT12 and FAT16 and EB 58 90 for FAT32.
+	JumpBoot [3]byte
+
+	// ReservedSectors is the count of sectors in front of the first FAT. It has to be at least 8 for FAT32,
+	// as the FSInfo and the backup of the boot sector are stored there.
+	// If it is 0, 1 is used for FAT12 and FAT16 and 32 for FAT32.
+	ReservedSectors uint16
+
+	// FATCount is the count of copies of the FAT. If it is 0, 2 copies are created.
+	FATCount uint8
+
+	// HiddenSectors is the count of sectors in front of the partition containing the volume.
+	HiddenSectors uint32
+}
+
+// geometry contains all calculated values needed to lay out a new filesystem.
+type geometry struct {
+	fsType            FATType
+	bytesPerSector    uint16
+	sectorsPerCluster uint8
+	reservedSectors   uint16
+	fatCount          uint8
+	rootEntryCount    uint16
+	totalSectors      uint32
+	fatSize           uint32
+	clusterCount      uint32
+}
+
+func (g geometry) rootDirSectors() uint32 {
+	return (uint32(g.rootEntryCount)*32 + uint32(g.bytesPerSector) - 1) / uint32(g.bytesPerSector)
+}
+
+// firstDataSector returns the first sector after the reserved sectors, the FATs and the root directory.
+func (g geometry) firstDataSector() uint32 {
+	return uint32(g.reservedSectors) + uint32(g.fatCount)*g.fatSize + g.rootDirSectors()
+}
+
+// clusterSizeLimit is a row of the cluster size tables of the FAT specification.
+type clusterSizeLimit struct {
+	// maxSize is the biggest volume size in bytes the row applies to.
+	maxSize int64
+	// clusterSize is the recommended size of the clusters in bytes.
+	// 0 means that the FAT type should not be used for volumes of this size.
+	clusterSize int64
+}
+
+// The recommended cluster sizes from the Microsoft FAT specification.
+// The specification lists them in sectors of 512 bytes.
+// It has no table for FAT12, so the smallest cluster size is used which keeps the cluster count below 4085.
+var (
+	fat12ClusterSizes = []clusterSizeLimit{
+		{maxSize: 4084 * 512, clusterSize: 512},
+		{maxSize: 4084 * 1024, clusterSize: 1024},
+		{maxSize: 4084 * 2048, clusterSize: 2048},
+		{maxSize: 4084 * 4096, clusterSize: 4096},
+		{maxSize: 4084 * 8192, clusterSize: 8192},
+		{maxSize: 4084 * 16384, clusterSize: 16384},
+		{maxSize: 4084 * 32768, clusterSize: 32768},
+		{maxSize: math.MaxInt64, clusterSize: 0},
+	}
+	fat16ClusterSizes = []clusterSizeLimit{
+		{maxSize: 8400 * 512, clusterSize: 0},
+		{maxSize: 32680 * 512, clusterSize: 1024},
+		{maxSize: 262144 * 512, clusterSize: 2048},
+		{maxSize: 524288 * 512, clusterSize: 4096},
+		{maxSize: 1048576 * 512, clusterSize: 8192},
+		{maxSize: 2097152 * 512, clusterSize: 16384},
+		{maxSize: 4194304 * 512, clusterSize: 32768},
+		{maxSize: math.MaxInt64, clusterSize: 0},
+	}
+	fat32ClusterSizes = []clusterSizeLimit{
+		{maxSize: 66600 * 512, clusterSize: 0},
+		{maxSize: 532480 * 512, clusterSize: 512},
+		{maxSize: 16777216 * 512, clusterSize: 4096},
+		{maxSize: 33554432 * 512, clusterSize: 8192},
+		{maxSize: 67108864 * 512, clusterSize: 16384},
+		{maxSize: math.MaxInt64, clusterSize: 32768},
+	}
+)
+
+// RecommendedSectorsPerCluster returns the SectorsPerCluster recommended by the Microsoft FAT specification
+// for a volume of the given size in bytes. A bytesPerSector of 0 means 512.
+// It returns an ErrInvalidGeometry error if the FAT type should not be used for a volume of that size
+// and an ErrNotSupported error for unknown FAT types.
+// Format uses it if no SectorsPerCluster are given.
+func RecommendedSectorsPerCluster(fsType FATType, size int64, bytesPerSector uint16) (uint8, error) {
+	if bytesPerSector == 0 {
+		bytesPerSector = 512
+	}
+
+	var table []clusterSizeLimit
+	switch fsType {
+	case FAT12:
+		table = fat12ClusterSizes
+	case FAT16:
+		table = fat16ClusterSizes
+	case FAT32:
+		table = fat32ClusterSizes
+	default:
+		return 0, checkpoint.From(fmt.Errorf("%w: cluster sizes for %v", ErrNotSupported, fsType))
+	}
+
+	for _, row := range table {
+		if size > row.maxSize {
+			continue
+		}
+
+		if row.clusterSize == 0 {
+			return 0, checkpoint.From(fmt.Errorf("%w: the size %d is not suitable for %v", ErrInvalidGeometry, size, fsType))
+		}
+
+		// Big sectors may already be bigger than the recommended cluster.
+		if row.clusterSize <= int64(bytesPerSector) {
+			return 1, nil
+		}
+		return uint8(row.clusterSize / int64(bytesPerSector)), nil
+	}
+
+	// Not reachable as the last row covers all sizes.
+	return 0, checkpoint.From(fmt.Errorf("%w: the size %d is not suitable for %v", ErrInvalidGeometry, size, fsType))
+}
+
+// calculateGeometry calculates the layout of a new filesystem for the given options.
+// The options have to contain a size.
+func calculateGeometry(opts FormatOptions) (geometry, error) {
+	g := geometry{
+		fsType:         opts.FSType,
+		bytesPerSector: opts.BytesPerSector,
+		fatCount:       opts.FATCount,
+	}
+
+	if g.fatCount == 0 {
+		g.fatCount = 2
+	}
+
+	if g.bytesPerSector == 0 {
+		g.bytesPerSector = 512
+	}
+
+	if g.bytesPerSector != 512 && g.bytesPerSector != 1024 && g.bytesPerSector != 2048 && g.bytesPerSector != 4096 {
+		return geometry{}, checkpoint.From(fmt.Errorf("%w: invalid sector size %d", ErrInvalidGeometry, g.bytesPerSector))
+	}
+
+	if opts.Size/int64(g.bytesPerSector) > 0xFFFFFFFF {
+		return geometry{}, checkpoint.From(fmt.Errorf("%w: the size %d is too big", ErrInvalidGeometry, opts.Size))
+	}
+	g.totalSectors = uint32(opts.Size / int64(g.bytesPerSector))
+
+	if g.fsType == "" {
+		switch {
+		case opts.Size >= 512*1024*1024:
+			g.fsType = FAT32
+		case opts.Size <= fat16ClusterSizes[0].maxSize:
+			g.fsType = FAT12
+		default:
+			g.fsType = FAT16
+		}
+	}
+
+	var entrySize uint32
+	switch g.fsType {
+	case FAT12:
+		g.reservedSectors = 1
+		g.rootEntryCount = 512
+	case FAT16:
+		g.reservedSectors = 1
+		g.rootEntryCount = 512
+		entrySize = 2
+	case FAT32:
+		g.reservedSectors = 32
+		entrySize = 4
+	default:
+		return geometry{}, checkpoint.From(fmt.Errorf("%w: formatting %v", ErrNotSupported, g.fsType))
+	}
+
+	if opts.ReservedSectors != 0 {
+		// FAT32 needs the sectors 0 to 7 for the boot sector, the FSInfo and their backups.
+		if g.fsType == FAT32 && opts.ReservedSectors < 8 {
+			return geometry{}, checkpoint.From(fmt.Errorf("%w: %v needs at least 8 reserved sectors but got %d", ErrInvalidGeometry, g.fsType, opts.ReservedSectors))
+		}
+		g.reservedSectors = opts.ReservedSectors
+	}
+
+	autoSectorsPerCluster := opts.SectorsPerCluster == 0
+	g.sectorsPerCluster = opts.SectorsPerCluster
+	if autoSectorsPerCluster {
+		recommended, err := RecommendedSectorsPerCluster(g.fsType, opts.Size, g.bytesPerSector)
+		if err != nil {
+			return geometry{}, err
+		}
+		g.sectorsPerCluster = recommended
+	}
+
+	for {
+		if g.sectorsPerCluster == 0 || g.sectorsPerCluster&(g.sectorsPerCluster-1) != 0 || uint32(g.bytesPerSector)*uint32(g.sectorsPerCluster) > 32*1024 {
+			return geometry{}, checkpoint.From(fmt.Errorf("%w: invalid sectors per cluster %d", ErrInvalidGeometry, g.sectorsPerCluster))
+		}
+
+		// See the FAT specification for this calculation.
+		// It may result in a slightly too big FAT but never in a too small one.
+		rootDirSectors := g.rootDirSectors()
+		if g.totalSectors <= uint32(g.reservedSectors)+rootDirSectors {
+			return geometry{}, checkpoint.From(fmt.Errorf("%w: the size %d is too small", ErrInvalidGeometry, opts.Size))
+		}
+
+		tmp1 := g.totalSectors - (uint32(g.reservedSectors) + rootDirSectors)
+		if g.fsType == FAT12 {
+			g.fatSize = fat12Size(tmp1, g.bytesPerSector, g.sectorsPerCluster, g.fatCount)
+		} else {
+			tmp2 := (uint32(g.bytesPerSector)/entrySize)*uint32(g.sectorsPerCluster) + uint32(g.fatCount)
+			g.fatSize = (tmp1 + tmp2 - 1) / tmp2
+		}
+
+		if g.totalSectors <= g.firstDataSector() {
+			return geometry{}, checkpoint.From(fmt.Errorf("%w: the size %d is too small", ErrInvalidGeometry, opts.Size))
+		}
+		g.clusterCount = (g.totalSectors - g.firstDataSector()) / uint32(g.sectorsPerCluster)
+
+		// FAT12 and FAT16 only support a limited count of clusters. Automatically use bigger clusters if possible.
+		if (g.fsType == FAT12 && g.clusterCount >= 4085 || g.fsType == FAT16 && g.clusterCount >= 65525) && autoSectorsPerCluster && uint32(g.bytesPerSector)*uint32(g.sectorsPerCluster) < 32*1024 {
+			g.sectorsPerCluster *= 2
+			continue
+		}
+		break
+	}
+
+	switch {
+	case g.clusterCount == 0,
+		g.fsType == FAT16 && g.clusterCount < 4085:
+		return geometry{}, checkpoint.From(fmt.Errorf("%w: the size %d is too small for %v", ErrInvalidGeometry, opts.Size, g.fsType))
+	case g.fsType == FAT12 && g.clusterCount >= 4085,
+		g.fsType == FAT16 && g.clusterCount >= 65525:
+		return geometry{}, checkpoint.From(fmt.Errorf("%w: the size %d is too big for %v", ErrInvalidGeometry, opts.Size, g.fsType))
+	case g.fsType == FAT32 && g.clusterCount < 65525:
+		return geometry{}, checkpoint.From(fmt.Errorf("%w: the size %d is too small for %v", ErrInvalidGeometry, opts.Size, g.fsType))
+	case g.fsType == FAT32 && g.clusterCount > 0x0FFFFFF5:
+		return geometry{}, checkpoint.From(fmt.Errorf("%w: the size %d is too big for %v", ErrInvalidGeometry, opts.Size, g.fsType))
+	}
+
+	return g, nil
+}
+
+// fat12Size returns the count of sectors needed by one FAT12 FAT for the given count of sectors behind the
+// reserved sectors and the root directory.
+// The calculation of the specification does not cover the 1.5 bytes of a FAT12 entry, so the FAT is grown until
+// the entries of all clusters fit.
+func fat12Size(sectors uint32, bytesPerSector uint16, sectorsPerCluster uint8, fatCount uint8) uint32 {
+	fatSize := uint32(1)
+	for uint32(fatCount)*fatSize < sectors {
+		clusters := (sectors - uint32(fatCount)*fatSize) / uint32(sectorsPerCluster)
+		// The entries of the clusters 0 and 1 are reserved.
+		fatBytes := ((clusters+2)*3 + 1) / 2
+		needed := (fatBytes + uint32(bytesPerSector) - 1) / uint32(bytesPerSector)
+		if needed <= fatSize {
+			break
+		}
+		fatSize = needed
+	}
+	return fatSize
+}
+
+// formatLabel converts the label into the 11 byte form used by FAT.
+// An empty label results in "NO NAME".
+func formatLabel(label string) ([11]byte, error) {
+	result := [11]byte{' ', ' ', ' ', ' ', ' ', ' ', ' ', ' ', ' ', ' ', ' '}
+
+	if label == "" {
+		copy(result[:], "NO NAME")
+		return result, nil
+	}
+
+	label = strings.ToUpper(label)
+	if len(label) > 11 {
+		return result, fmt.Errorf("%w: the label '%v' is longer than 11 characters", ErrInvalidPath, label)
+	}
+
+	for i := 0; i < len(label); i++ {
+		if label[i] != ' ' && !isShortNameChar(label[i]) {
+			return result, fmt.Errorf("%w: the label '%v' contains invalid characters", ErrInvalidPath, label)
+		}
+		result[i] = label[i]
+	}
+
+	return result, nil
+}
+
+// formatOEMName converts the OEM name into the 8 byte form used by FAT.
+// An empty name results in "MSWIN4.1".
+func formatOEMName(name string) ([8]byte, error) {
+	result := [8]byte{' ', ' ', ' ', ' ', ' ', ' ', ' ', ' '}
+
+	if name == "" {
+		copy(result[:], "MSWIN4.1")
+		return result, nil
+	}
+
+	if len(name) > 8 {
+		return result, fmt.Errorf("%w: the OEM name '%v' is longer than 8 characters", ErrInvalidBoot, name)
+	}
+
+	for i := 0; i < len(name); i++ {
+		if name[i] < 0x20 || name[i] > 0x7E {
+			return result, fmt.Errorf("%w: the OEM name '%v' contains invalid characters", ErrInvalidBoot, name)
+		}
+		result[i] = name[i]
+	}
+
+	return result, nil
+}
+
+// jumpBoot returns the jump instruction to use for the given FAT type.
+func jumpBoot(jump [3]byte, fsType FATType) ([3]byte, error) {
+	if jump == [3]byte{} {
+		if fsType == FAT32 {
+			return [3]byte{0xEB, 0x58, 0x90}, nil
+		}
+		return [3]byte{0xEB, 0x3C, 0x90}, nil
+	}
+
+	// The same check is done by New.
+	if !(jump[0] == 0xEB && jump[2] == 0x90) && jump[0] != 0xE9 {
+		return jump, fmt.Errorf("%w: invalid jump instruction % X", ErrInvalidBoot, jump)
+	}
+
+	return jump, nil
+}
+
+// writeAt writes the data to the given position.
+func writeAt(writer io.WriteSeeker, offset int64, data []byte) error {
+	_, err := writer.Seek(offset, io.SeekStart)
+	if err != nil {
+		return err
+	}
+
+	_, err = writer.Write(data)
+	return err
+}
+
+// Format creates a new empty FAT filesystem on the writer.
+// Note that only the reserved sectors, the FATs and the root directory are overwritten.
+// The old content of the data region is not cleared.
+func Format(writer io.WriteSeeker, opts FormatOptions) error {
+	size, err := writer.Seek(0, io.SeekEnd)
+	if err != nil {
+		return checkpoint.Wrap(err, ErrFormat)
+	}
+
+	if opts.Size == 0 {
+		opts.Size = size
+	}
+
+	g, err := calculateGeometry(opts)
+	if err != nil {
+		return checkpoint.Wrap(err, ErrFormat)
+	}
+
+	label, err := formatLabel(opts.Label)
+	if err != nil {
+		return checkpoint.Wrap(err, ErrFormat)
+	}
+
+	oemName, err := formatOEMName(opts.OEMName)
+	if err != nil {
+		return checkpoint.Wrap(err, ErrFormat)
+	}
+
+	jump, err := jumpBoot(opts.JumpBoot, g.fsType)
+	if err != nil {
+		return checkpoint.Wrap(err, ErrFormat)
+	}
+
+	now := clockOrSystem(opts.Clock).Now()
+	volumeID := opts.VolumeID
+	if volumeID == 0 {
+		volumeID = uint32(now.Unix()) ^ uint32(now.Nanosecond())
+	}
+
+	bytesPerSector := int64(g.bytesPerSector)
+
+	// Make sure the target is big enough.
+	if size < int64(g.totalSectors)*bytesPerSector {
+		err = writeAt(writer, int64(g.totalSectors)*bytesPerSector-1, []byte{0})
+		if err != nil {
+			return checkpoint.Wrap(err, ErrFormat)
+		}
+	}
+
+	// Clear everything in front of the data region and for FAT32 also the root directory cluster.
+	clearSectors := int64(g.firstDataSector())
+	if g.fsType == FAT32 {
+		clearSectors += int64(g.sectorsPerCluster)
+	}
+
+	zeros := make([]byte, 64*1024)
+	for offset := int64(0); offset < clearSectors*bytesPerSector; offset += int64(len(zeros)) {
+		chunk := zeros
+		if rest := clearSectors*bytesPerSector - offset; rest < int64(len(chunk)) {
+			chunk = chunk[:rest]
+		}
+
+		err = writeAt(writer, offset, chunk)
+		if err != nil {
+			return checkpoint.Wrap(err, ErrFormat)
+		}
+	}
+
+	bpb := BPB{
+		BSJumpBoot:          jump,
+		BSOEMName:           oemName,
+		BytesPerSector:      g.bytesPerSector,
+		SectorsPerCluster:   g.sectorsPerCluster,
+		ReservedSectorCount: g.reservedSectors,
+		NumFATs:             g.fatCount,
+		RootEntryCount:      g.rootEntryCount,
+		Media:               0xF8,
+		SectorsPerTrack:     32,
+		NumberOfHeads:       64,
+		HiddenSectors:       opts.HiddenSectors,
+	}
+
+	if g.totalSectors < 0x10000 && g.fsType != FAT32 {
+		bpb.TotalSectors16 = uint16(g.totalSectors)
+	} else {
+		bpb.TotalSectors32 = g.totalSectors
+	}
+
+	specific := bytes.NewBuffer(make([]byte, 0, 54))
+	if g.fsType == FAT32 {
+		err = binary.Write(specific, binary.LittleEndian, FAT32SpecificData{
+			FatSize:          g.fatSize,
+			RootCluster:      2,
+			FSInfo:           1,
+			BkBootSector:     6,
+			BSDriveNumber:    0x80,
+			BSBootSignature:  0x29,
+			BSVolumeID:       volumeID,
+			BSVolumeLabel:    label,
+			BSFileSystemType: [8]byte{'F', 'A', 'T', '3', '2', ' ', ' ', ' '},
+		})
+	} else {
+		fileSystemType := [8]byte{'F', 'A', 'T', '1', '6', ' ', ' ', ' '}
+		if g.fsType == FAT12 {
+			fileSystemType[4] = '2'
+		}
+
+		bpb.FATSize16 = uint16(g.fatSize)
+		err = binary.Write(specific, binary.LittleEndian, FAT16SpecificData{
+			BSDriveNumber:    0x80,
+			BSBootSignature:  0x29,
+			BSVolumeId:       volumeID,
+			BSVolumeLabel:    label,
+			BSFileSystemType: fileSystemType,
+		})
+	}
+	if err != nil {
+		return checkpoint.Wrap(err, ErrFormat)
+	}
+	copy(bpb.FATSpecificData[:], specific.Bytes())
+
+	bootSector := bytes.NewBuffer(make([]byte, 0, bytesPerSector))
+	err = binary.Write(bootSector, binary.LittleEndian, bpb)
+	if err != nil {
+		return checkpoint.Wrap(err, ErrFormat)
+	}
+
+	boot := make([]byte, bytesPerSector)
+	copy(boot, bootSector.Bytes())
+	boot[510] = 0x55
+	boot[511] = 0xAA
+
+	err = writeAt(writer, 0, boot)
+	if err != nil {
+		return checkpoint.Wrap(err, ErrFormat)
+	}
+
+	// Initialize the first FAT entries. The first one contains the media value, the second one is end of chain.
+	// For FAT32 the third one is the end of the root directory chain.
+	fatStart := make([]byte, 12)
+	switch g.fsType {
+	case FAT32:
+		binary.LittleEndian.PutUint32(fatStart[0:4], 0x0FFFFF00|uint32(bpb.Media))
+		binary.LittleEndian.PutUint32(fatStart[4:8], 0x0FFFFFFF)
+		binary.LittleEndian.PutUint32(fatStart[8:12], 0x0FFFFFFF)
+	case FAT12:
+		// The two 12 bit entries 0xF00|media and 0xFFF share 3 bytes.
+		fatStart = []byte{bpb.Media, 0xFF, 0xFF}
+	default:
+		binary.LittleEndian.PutUint16(fatStart[0:2], 0xFF00|uint16(bpb.Media))
+		binary.LittleEndian.PutUint16(fatStart[2:4], 0xFFFF)
+		fatStart = fatStart[:4]
+	}
+
+	for i := uint32(0); i < uint32(g.fatCount); i++ {
+		err = writeAt(writer, int64(uint32(g.reservedSectors)+i*g.fatSize)*bytesPerSector, fatStart)
+		if err != nil {
+			return checkpoint.Wrap(err, ErrFormat)
+		}
+	}
+
+	if g.fsType == FAT32 {
+		fsInfo := bytes.NewBuffer(make([]byte, 0, 512))
+		err = binary.Write(fsInfo, binary.LittleEndian, FSInfo{
+			LeadSignature:   0x41615252,
+			StructSignature: 0x61417272,
+			FreeCount:       g.clusterCount - 1,
+			NextFree:        3,
+			TrailSignature:  0xAA550000,
+		})
+		if err != nil {
+			return checkpoint.Wrap(err, ErrFormat)
+		}
+
+		// Write the FSInfo and the backups of the boot sector and the FSInfo.
+		for _, sector := range []struct {
+			num  int64
+			data []byte
+		}{{1, fsInfo.Bytes()}, {6, boot}, {7, fsInfo.Bytes()}} {
+			err = writeAt(writer, sector.num*bytesPerSector, sector.data)
+			if err != nil {
+				return checkpoint.Wrap(err, ErrFormat)
+			}
+		}
+	}
+
+	// Add the volume label also as entry to the root directory.
+	if opts.Label != "" {
+		header := newEntryHeader(AttrVolumeId, now)
+		header.Name = label
+		header.CreateTimeTenth = 0
+		header.CreateTime = 0
+		header.CreateDate = 0
+		header.LastAccessDate = 0
+
+		rootSector := int64(uint32(g.reservedSectors) + uint32(g.fatCount)*g.fatSize)
+		err = writeAt(writer, rootSector*bytesPerSector, encodeEntry(header))
+		if err != nil {
+			return checkpoint.Wrap(err, ErrFormat)
+		}
+	}
+
+	return nil
+}
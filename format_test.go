@@ -0,0 +1,446 @@
+package gofat
+
+import (
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+// testImage is a simple in-memory image.
+// It is used instead of afero.MemMapFs files as they copy the whole rest of the file on each write.
+type testImage struct {
+	data   []byte
+	offset int64
+}
+
+func (i *testImage) Read(p []byte) (int, error) {
+	if i.offset >= int64(len(i.data)) {
+		return 0, io.EOF
+	}
+
+	n := copy(p, i.data[i.offset:])
+	i.offset += int64(n)
+	return n, nil
+}
+
+func (i *testImage) Write(p []byte) (int, error) {
+	if end := i.offset + int64(len(p)); end > int64(len(i.data)) {
+		i.data = append(i.data, make([]byte, end-int64(len(i.data)))...)
+	}
+
+	n := copy(i.data[i.offset:], p)
+	i.offset += int64(n)
+	return n, nil
+}
+
+func (i *testImage) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += i.offset
+	case io.SeekEnd:
+		offset += int64(len(i.data))
+	}
+
+	if offset < 0 {
+		return i.offset, errors.New("negative offset")
+	}
+
+	i.offset = offset
+	return offset, nil
+}
+
+func (i *testImage) Truncate(size int64) error {
+	if size < int64(len(i.data)) {
+		i.data = i.data[:size]
+		return nil
+	}
+
+	i.data = append(i.data, make([]byte, size-int64(len(i.data)))...)
+	return nil
+}
+
+// testingImage creates a new empty in-memory image.
+func testingImage(t testing.TB) *testImage {
+	return &testImage{}
+}
+
+// testingFormat formats a new in-memory image with the given options and opens it.
+func testingFormat(t testing.TB, opts FormatOptions) *Fs {
+	image := testingImage(t)
+	if err := Format(image, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	fs, err := New(image)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fs
+}
+
+func TestFormat(t *testing.T) {
+	const mib = 1024 * 1024
+
+	tests := []struct {
+		name        string
+		opts        FormatOptions
+		wantType    FATType
+		wantLabel   string
+		wantCluster int64
+		wantErr     error
+	}{
+		{
+			name:      "FAT16 by size",
+			opts:      FormatOptions{Size: 32 * mib},
+			wantType:  FAT16,
+			wantLabel: "NO NAME",
+		},
+		{
+			name:      "FAT32 by size",
+			opts:      FormatOptions{Size: 512 * mib, Label: "gofat"},
+			wantType:  FAT32,
+			wantLabel: "GOFAT",
+		},
+		{
+			name:        "FAT32 forced on a small volume",
+			opts:        FormatOptions{Size: 128 * mib, FSType: FAT32, SectorsPerCluster: 2},
+			wantType:    FAT32,
+			wantLabel:   "NO NAME",
+			wantCluster: 1024,
+		},
+		{
+			name:      "FAT12 by size",
+			opts:      FormatOptions{Size: 4 * mib, Label: "small"},
+			wantType:  FAT12,
+			wantLabel: "SMALL",
+		},
+		{
+			name:        "FAT12 floppy",
+			opts:        FormatOptions{Size: 1440 * 1024, FSType: FAT12},
+			wantType:    FAT12,
+			wantLabel:   "NO NAME",
+			wantCluster: 512,
+		},
+		{
+			name:    "too big for FAT12",
+			opts:    FormatOptions{Size: 128 * mib, FSType: FAT12},
+			wantErr: ErrInvalidGeometry,
+		},
+		{
+			name:    "too many clusters for FAT12",
+			opts:    FormatOptions{Size: 4 * mib, FSType: FAT12, SectorsPerCluster: 1},
+			wantErr: ErrInvalidGeometry,
+		},
+		{
+			name:    "too small for FAT32",
+			opts:    FormatOptions{Size: 16 * mib, FSType: FAT32},
+			wantErr: ErrInvalidGeometry,
+		},
+		{
+			name:    "invalid sectors per cluster",
+			opts:    FormatOptions{Size: 32 * mib, SectorsPerCluster: 3},
+			wantErr: ErrInvalidGeometry,
+		},
+		{
+			name:    "label too long",
+			opts:    FormatOptions{Size: 32 * mib, Label: "a very long label"},
+			wantErr: ErrInvalidPath,
+		},
+		{
+			name:    "OEM name too long",
+			opts:    FormatOptions{Size: 32 * mib, OEMName: "TOO LONG!"},
+			wantErr: ErrInvalidBoot,
+		},
+		{
+			name:    "invalid jump instruction",
+			opts:    FormatOptions{Size: 32 * mib, JumpBoot: [3]byte{0xEB, 0x3C, 0x00}},
+			wantErr: ErrInvalidBoot,
+		},
+		{
+			name:    "too few reserved sectors for FAT32",
+			opts:    FormatOptions{Size: 128 * mib, FSType: FAT32, ReservedSectors: 7},
+			wantErr: ErrInvalidGeometry,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			image := testingImage(t)
+			err := Format(image, tt.opts)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("Format() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Format() error = %v", err)
+			}
+
+			size, err := image.Seek(0, io.SeekEnd)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if size != tt.opts.Size {
+				t.Errorf("Format() size = %v, want %v", size, tt.opts.Size)
+			}
+
+			fs, err := New(image)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+
+			if fs.FSType() != tt.wantType {
+				t.Errorf("Fs.FSType() = %v, want %v", fs.FSType(), tt.wantType)
+			}
+			if fs.Label() != tt.wantLabel {
+				t.Errorf("Fs.Label() = %v, want %v", fs.Label(), tt.wantLabel)
+			}
+			if tt.wantCluster != 0 && fs.clusterSize() != tt.wantCluster {
+				t.Errorf("Fs.clusterSize() = %v, want %v", fs.clusterSize(), tt.wantCluster)
+			}
+
+			files, err := afero.ReadDir(fs, ".")
+			if err != nil {
+				t.Fatalf("ReadDir() error = %v", err)
+			}
+			if len(files) != 0 {
+				t.Errorf("ReadDir() = %v, want an empty root", files)
+			}
+		})
+	}
+}
+
+func TestFormat_bootSector(t *testing.T) {
+	const mib = 1024 * 1024
+
+	tests := []struct {
+		name string
+		opts FormatOptions
+		want BPB
+	}{
+		{
+			name: "FAT16 defaults",
+			opts: FormatOptions{Size: 32 * mib},
+			want: BPB{
+				BSJumpBoot:          [3]byte{0xEB, 0x3C, 0x90},
+				BSOEMName:           [8]byte{'M', 'S', 'W', 'I', 'N', '4', '.', '1'},
+				ReservedSectorCount: 1,
+				NumFATs:             2,
+			},
+		},
+		{
+			name: "FAT12 defaults",
+			opts: FormatOptions{Size: 2 * mib},
+			want: BPB{
+				BSJumpBoot:          [3]byte{0xEB, 0x3C, 0x90},
+				BSOEMName:           [8]byte{'M', 'S', 'W', 'I', 'N', '4', '.', '1'},
+				ReservedSectorCount: 1,
+				NumFATs:             2,
+			},
+		},
+		{
+			name: "FAT32 defaults",
+			opts: FormatOptions{Size: 128 * mib, FSType: FAT32},
+			want: BPB{
+				BSJumpBoot:          [3]byte{0xEB, 0x58, 0x90},
+				BSOEMName:           [8]byte{'M', 'S', 'W', 'I', 'N', '4', '.', '1'},
+				ReservedSectorCount: 32,
+				NumFATs:             2,
+			},
+		},
+		{
+			name: "FAT16 custom",
+			opts: FormatOptions{Size: 32 * mib, OEMName: "mkfs", JumpBoot: [3]byte{0xE9, 0x00, 0x01}, ReservedSectors: 4, FATCount: 1, HiddenSectors: 2048},
+			want: BPB{
+				BSJumpBoot:          [3]byte{0xE9, 0x00, 0x01},
+				BSOEMName:           [8]byte{'m', 'k', 'f', 's', ' ', ' ', ' ', ' '},
+				ReservedSectorCount: 4,
+				NumFATs:             1,
+				HiddenSectors:       2048,
+			},
+		},
+		{
+			name: "FAT32 custom",
+			opts: FormatOptions{Size: 128 * mib, FSType: FAT32, OEMName: "BOOTROM", ReservedSectors: 8, FATCount: 3, HiddenSectors: 63},
+			want: BPB{
+				BSJumpBoot:          [3]byte{0xEB, 0x58, 0x90},
+				BSOEMName:           [8]byte{'B', 'O', 'O', 'T', 'R', 'O', 'M', ' '},
+				ReservedSectorCount: 8,
+				NumFATs:             3,
+				HiddenSectors:       63,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			image := testingImage(t)
+			if err := Format(image, tt.opts); err != nil {
+				t.Fatalf("Format() error = %v", err)
+			}
+
+			bpb, err := decodeBPB(image.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := BPB{
+				BSJumpBoot:          bpb.BSJumpBoot,
+				BSOEMName:           bpb.BSOEMName,
+				ReservedSectorCount: bpb.ReservedSectorCount,
+				NumFATs:             bpb.NumFATs,
+				HiddenSectors:       bpb.HiddenSectors,
+			}
+			if got != tt.want {
+				t.Errorf("Format() boot sector = %+v, want %+v", got, tt.want)
+			}
+
+			// The filesystem has to be usable with these values.
+			fs, err := New(image)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			if err := afero.WriteFile(fs, "file", testData(10000), 0666); err != nil {
+				t.Fatal(err)
+			}
+			report, err := fs.Check()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !report.OK() {
+				t.Errorf("Fs.Check() = %+v, want no findings", report.Findings)
+			}
+		})
+	}
+}
+
+func TestRecommendedSectorsPerCluster(t *testing.T) {
+	const mib = 1024 * 1024
+
+	tests := []struct {
+		name           string
+		fsType         FATType
+		size           int64
+		bytesPerSector uint16
+		want           uint8
+		wantErr        error
+	}{
+		{name: "FAT16 too small", fsType: FAT16, size: 4 * mib, wantErr: ErrInvalidGeometry},
+		{name: "FAT16 16 MiB", fsType: FAT16, size: 32680 * 512, want: 2},
+		{name: "FAT16 64 MiB", fsType: FAT16, size: 64 * mib, want: 4},
+		{name: "FAT16 2 GiB", fsType: FAT16, size: 2048 * mib, want: 64},
+		{name: "FAT16 too big", fsType: FAT16, size: 2049 * mib, wantErr: ErrInvalidGeometry},
+		{name: "FAT32 too small", fsType: FAT32, size: 32 * mib, wantErr: ErrInvalidGeometry},
+		{name: "FAT32 260 MiB", fsType: FAT32, size: 260 * mib, want: 1},
+		{name: "FAT32 1 GiB", fsType: FAT32, size: 1024 * mib, want: 8},
+		{name: "FAT32 1 GiB with 4096 byte sectors", fsType: FAT32, size: 1024 * mib, bytesPerSector: 4096, want: 1},
+		{name: "FAT32 64 GiB", fsType: FAT32, size: 64 * 1024 * mib, want: 64},
+		{name: "FAT12 1.44 MB floppy", fsType: FAT12, size: 1440 * 1024, want: 1},
+		{name: "FAT12 4 MiB", fsType: FAT12, size: 4 * mib, want: 4},
+		{name: "FAT12 too big", fsType: FAT12, size: 128 * mib, wantErr: ErrInvalidGeometry},
+		{name: "unknown type", fsType: "exFAT", size: mib, wantErr: ErrNotSupported},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := RecommendedSectorsPerCluster(tt.fsType, tt.size, tt.bytesPerSector)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("RecommendedSectorsPerCluster() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("RecommendedSectorsPerCluster() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_calculateGeometry(t *testing.T) {
+	const mib = 1024 * 1024
+
+	tests := []struct {
+		name    string
+		opts    FormatOptions
+		want    geometry
+		wantErr bool
+	}{
+		{
+			name: "FAT16 64 MiB",
+			opts: FormatOptions{Size: 64 * mib},
+			want: geometry{
+				fsType:            FAT16,
+				bytesPerSector:    512,
+				sectorsPerCluster: 4,
+				reservedSectors:   1,
+				fatCount:          2,
+				rootEntryCount:    512,
+				totalSectors:      131072,
+				fatSize:           128,
+				clusterCount:      32695,
+			},
+		},
+		{
+			name: "FAT32 1 GiB",
+			opts: FormatOptions{Size: 1024 * mib},
+			want: geometry{
+				fsType:            FAT32,
+				bytesPerSector:    512,
+				sectorsPerCluster: 8,
+				reservedSectors:   32,
+				fatCount:          2,
+				rootEntryCount:    0,
+				totalSectors:      2097152,
+				fatSize:           2044,
+				clusterCount:      261629,
+			},
+		},
+		{
+			// The specification recommends single sector clusters for small FAT32 volumes.
+			name: "FAT32 128 MiB",
+			opts: FormatOptions{Size: 128 * mib, FSType: FAT32},
+			want: geometry{
+				fsType:            FAT32,
+				bytesPerSector:    512,
+				sectorsPerCluster: 1,
+				reservedSectors:   32,
+				fatCount:          2,
+				rootEntryCount:    0,
+				totalSectors:      262144,
+				fatSize:           2017,
+				clusterCount:      258078,
+			},
+		},
+		{
+			// The FAT of the well known 1.44 MB floppy has 9 sectors with 1.5 bytes per entry.
+			name: "FAT12 1.44 MB floppy",
+			opts: FormatOptions{Size: 1440 * 1024},
+			want: geometry{
+				fsType:            FAT12,
+				bytesPerSector:    512,
+				sectorsPerCluster: 1,
+				reservedSectors:   1,
+				fatCount:          2,
+				rootEntryCount:    512,
+				totalSectors:      2880,
+				fatSize:           9,
+				clusterCount:      2829,
+			},
+		},
+		{
+			name:    "invalid sector size",
+			opts:    FormatOptions{Size: 64 * mib, BytesPerSector: 100},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := calculateGeometry(tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("calculateGeometry() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("calculateGeometry() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
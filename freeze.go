@@ -0,0 +1,81 @@
+package gofat
+
+import (
+	"fmt"
+
+	"github.com/aligator/gofat/checkpoint"
+)
+
+// freezeState is shared by all copies of a Fs. It is guarded by the writeLock.
+type freezeState struct {
+	frozen bool
+}
+
+// isFrozen returns true if the filesystem is frozen. A nil freezeState is never frozen.
+func (s *freezeState) isFrozen() bool {
+	return s != nil && s.frozen
+}
+
+// Freeze flushes all pending changes and switches the filesystem to a read-only fast path until Thaw is called.
+// It is meant for devices which write occasionally in bursts but read constantly.
+//
+// While frozen, all operations which modify the filesystem fail with ErrReadOnlyFilesystem, also writes to files
+// which are already open. As nothing can change, the whole FAT is kept in memory (like Options.FatInMemory does)
+// and cached directories are not invalidated anymore.
+// Freezing a frozen filesystem does nothing.
+func (f *Fs) Freeze() error {
+	f.writeLock.Lock()
+	defer f.writeLock.Unlock()
+
+	if f.freeze.isFrozen() {
+		return nil
+	}
+
+	if f.writer != nil {
+		if err := f.flushFSInfo(); err != nil {
+			return checkpoint.Wrap(err, ErrWriteFilesystem)
+		}
+		if err := f.sync(); err != nil {
+			return checkpoint.Wrap(err, ErrWriteFilesystem)
+		}
+	}
+
+	if !f.fat.loaded() {
+		if err := f.loadFat(); err != nil {
+			return err
+		}
+	}
+
+	f.freeze.frozen = true
+	return nil
+}
+
+// Thaw allows modifications again after Freeze.
+// The FAT is only kept in memory if Options.FatInMemory is set.
+// Thawing a filesystem which is not frozen does nothing.
+func (f *Fs) Thaw() error {
+	f.writeLock.Lock()
+	defer f.writeLock.Unlock()
+
+	if !f.freeze.isFrozen() {
+		return nil
+	}
+
+	if !f.fatInMemory {
+		f.fat.set(nil)
+	}
+
+	f.freeze.frozen = false
+	return nil
+}
+
+// Frozen returns true while the filesystem is frozen, see Freeze.
+func (f *Fs) Frozen() bool {
+	f.writeLock.Lock()
+	defer f.writeLock.Unlock()
+
+	return f.freeze.isFrozen()
+}
+
+// errFrozen is returned by modifying operations while the filesystem is frozen.
+var errFrozen = fmt.Errorf("%w: the filesystem is frozen", ErrReadOnlyFilesystem)
@@ -0,0 +1,98 @@
+package gofat
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestFs_Freeze(t *testing.T) {
+	tests := []struct {
+		name        string
+		fatInMemory bool
+	}{
+		{name: "FAT on disk", fatInMemory: false},
+		{name: "FAT in memory", fatInMemory: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			image := testingImage(t)
+			if err := Format(image, FormatOptions{Size: 128 * 1024 * 1024, FSType: FAT32}); err != nil {
+				t.Fatal(err)
+			}
+			fs, err := NewWithOptions(image, Options{FatInMemory: tt.fatInMemory})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			data := testData(int(fs.clusterSize()) * 3)
+			file, err := fs.OpenFile("log", os.O_RDWR|os.O_CREATE, 0666)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := file.Write(data); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := fs.Freeze(); err != nil {
+				t.Fatalf("Fs.Freeze() error = %v", err)
+			}
+			if !fs.Frozen() || !fs.fat.loaded() {
+				t.Errorf("Fs.Freeze() did not freeze the filesystem or load the FAT")
+			}
+			if fs.alloc.dirty {
+				t.Errorf("Fs.Freeze() did not flush the FSInfo")
+			}
+			if err := fs.Freeze(); err != nil {
+				t.Errorf("Fs.Freeze() of a frozen filesystem error = %v", err)
+			}
+
+			// All modifications fail, also through copies and already opened files.
+			if _, err := file.Write(data); !errors.Is(err, ErrReadOnlyFilesystem) {
+				t.Errorf("File.Write() while frozen error = %v, want %v", err, ErrReadOnlyFilesystem)
+			}
+			if err := fs.WithContext(context.Background()).Mkdir("dir", 0777); !errors.Is(err, ErrReadOnlyFilesystem) {
+				t.Errorf("Fs.Mkdir() while frozen error = %v, want %v", err, ErrReadOnlyFilesystem)
+			}
+
+			got, err := afero.ReadFile(fs, "log")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != string(data) {
+				t.Errorf("reading while frozen returned wrong data")
+			}
+
+			if err := fs.Thaw(); err != nil {
+				t.Fatalf("Fs.Thaw() error = %v", err)
+			}
+			if fs.Frozen() || fs.fat.loaded() != tt.fatInMemory {
+				t.Errorf("Fs.Thaw() left frozen = %v, FAT loaded = %v", fs.Frozen(), fs.fat.loaded())
+			}
+
+			if _, err := file.Write(data); err != nil {
+				t.Errorf("File.Write() after thawing error = %v", err)
+			}
+			if report, err := fs.Check(); err != nil || !report.OK() {
+				t.Errorf("Fs.Check() = %v, %v", report, err)
+			}
+		})
+	}
+}
+
+func TestFs_Freeze_readOnly(t *testing.T) {
+	fs := testingNew(t, testingReadOnly(t, fat16))
+
+	if err := fs.Freeze(); err != nil {
+		t.Fatalf("Fs.Freeze() of a read only filesystem error = %v", err)
+	}
+	if _, err := fs.Stat("DoNotEdit_tests/README.md"); err != nil {
+		t.Errorf("Fs.Stat() while frozen error = %v", err)
+	}
+	if err := fs.Thaw(); err != nil {
+		t.Errorf("Fs.Thaw() error = %v", err)
+	}
+}
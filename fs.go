@@ -2,6 +2,7 @@ package gofat
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
 	"errors"
 	"fmt"
@@ -12,6 +13,7 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -48,6 +50,11 @@ var (
 	ErrInitializeFilesystem = errors.New("initialize the filesystem")
 	ErrFetchingSector       = errors.New("could not fetch a new sector")
 	ErrReadFat              = errors.New("could not read FAT sector")
+	ErrWriteFat             = errors.New("could not write FAT sector")
+	ErrWriteFilesystem      = errors.New("could not write to the filesystem")
+	ErrReadOnlyFilesystem   = errors.New("the filesystem is read only")
+	ErrFilesystemFull       = errors.New("no free cluster left on the filesystem")
+	ErrDirectoryFull        = errors.New("no free entry left in the directory")
 )
 
 // Info contains all information about the whole filesystem.
@@ -60,6 +67,7 @@ type Info struct {
 	TotalSectorCount    uint32
 	ReservedSectorCount uint16
 	BytesPerSector      uint16
+	ClusterCount        uint32
 	Label               string
 	fat32Specific       FAT32SpecificData
 	fat16Specific       FAT16SpecificData
@@ -72,368 +80,507 @@ type Sector struct {
 }
 
 type Fs struct {
-	lock        sync.Mutex
-	reader      io.ReadSeeker
-	info        Info
-	sectorCache Sector
+	// lock guards the position of the reader, so it has to be held for each Seek followed by a Read or Write.
+	// The sectorCache has its own locks, reads through the readerAt do not need it.
+	// It is a pointer so that copies of the Fs (e.g. by WithContext) still share it as they also share the reader.
+	lock *sync.Mutex
+	// writeLock serializes all operations which modify the filesystem.
+	writeLock *sync.Mutex
+	reader    io.ReadSeeker
+	// readerAt is the same as the reader but as io.ReaderAt. It is nil if the reader does not support it.
+	// It allows reading sectors without holding the lock.
+	readerAt io.ReaderAt
+	// writer is the same as the reader but as io.Writer. It is nil if the reader does not support writing.
+	writer io.Writer
+	// info is shared by all copies of the Fs, so that changes of the label or the geometry (e.g. by Shrink) are
+	// seen by all of them. It is only modified while holding the writeLock.
+	info        *Info
+	sectorCache *shardedCache
+	// sectorPool provides the buffers for the sectorCache. It is nil if no buffers are reused.
+	sectorPool *sectorPool
+	alloc      *allocation
+	// buffers provides the buffers of reads spanning several sectors. It is nil if no buffers are reused.
+	buffers *bufferPool
+	// sortEntries keeps directories sorted, see Options.SortEntries.
+	sortEntries bool
+	// fat contains the whole first FAT if Options.FatInMemory is set or the filesystem is frozen.
+	fat *memoryFat
+	// fatInMemory keeps the fat loaded when the filesystem is thawed, see Options.FatInMemory.
+	fatInMemory bool
+	// freeze is shared by all copies of the Fs, see Fs.Freeze.
+	freeze *freezeState
+	// dirIndex speeds up resolving paths. It is nil if the index is disabled.
+	dirIndex *dirIndex
+	// chains keeps the cluster chains used without an open File. It is shared by all copies of the Fs.
+	chains *chainCache
+	// matchName overrides the default name comparison, see Options.MatchName.
+	matchName func(entryName, name string) bool
+	// ctx cancels reading from the reader, see WithContext. It is nil if no context is used.
+	ctx context.Context
+	// mutating is 1 while a modifying operation runs, so that it is not interrupted by the ctx.
+	mutating int32
+	// progress is called by long-running operations, see Options.Progress. It may be nil.
+	progress func(done, total int64)
+	// logger receives debug messages, see Options.Logger. It may be nil.
+	logger Logger
+	// tracer is called after each access to the storage, see Options.Tracer. It may be nil.
+	tracer Tracer
+	// clock provides the time for new timestamps, see Options.Clock.
+	clock Clock
+	// recorder records the sector I/O, see Options.Record. It is nil if nothing is recorded.
+	recorder *recorder
+	// names interns the decoded long names. It is shared by all copies of the Fs.
+	names *nameInterner
+	// handles tracks the open files, see Options.TrackOpenFiles. It is nil if nothing is tracked.
+	handles *handleRegistry
+	// dryRun records all writes instead of changing the reader, see Options.DryRun. It is nil if it is not used.
+	dryRun *DryRunDevice
+	// stats counts the work done, see Fs.Stats.
+	stats *statistics
+	// journal records all mutations, see Fs.Changes.
+	journal *journal
+	// modes maps the entries to the modes of their FileInfos, see Options.FileMode. It may be nil.
+	modes *modeMapper
+	// shortcuts reports shortcuts as symlinks, see Options.ResolveShortcuts.
+	shortcuts bool
 }
 
-// New opens a FAT filesystem from the given reader.
-func New(reader io.ReadSeeker) (*Fs, error) {
-	fs := &Fs{
-		reader: reader,
+// Options configure how a filesystem is opened.
+type Options struct {
+	// SkipChecks skips some filesystem validations, see NewSkipChecks.
+	SkipChecks bool
+
+	// CacheSize is the count of sectors which are kept in memory.
+	// A bigger cache avoids reading the same FAT and directory sectors again and again.
+	// If it is 0, DefaultCacheSize is used.
+	CacheSize int
+
+	// SortEntries keeps the entries of each directory sorted by name when new entries are added.
+	// Each insert rewrites the whole directory. Some embedded firmware needs this to find files.
+	SortEntries bool
+
+	// FatInMemory loads the whole FAT into memory when the filesystem is opened.
+	// Following a cluster chain then needs no sector reads at all.
+	// The memory needed is the size of one FAT (e.g. about 1 MiB for 1 GiB FAT32 volumes with 4 KiB clusters).
+	FatInMemory bool
+
+	// IndexSize is the count of directories for which an index of the entry names is kept in memory.
+	// Opening paths in indexed directories does not need to scan the whole directory again.
+	// If it is 0, DefaultIndexSize is used. A negative size disables the index.
+	IndexSize int
+
+	// MatchName overrides how the name of a directory entry is compared with a name from a path
+	// (e.g. to replicate the behavior of a specific firmware). It is also used to detect existing names when
+	// creating entries.
+	// If it is nil, the names are compared case-insensitively like FAT does it.
+	// Setting it disables the index as the index only works for case-insensitive names.
+	MatchName func(entryName, name string) bool
+
+	// Progress is called by long-running operations with the count of bytes processed so far and the total count,
+	// so that command line tools can show the progress on big images. It is used by File.WriteTo (and so by
+	// io.Copy from a file) and by Check, which counts the bytes of the FATs it reads.
+	// It is called from the goroutine running the operation. It may be nil.
+	Progress func(done, total int64)
+
+	// Logger receives debug messages about the mounted filesystem, ignored validation problems, retried reads and
+	// the findings of Check. If it is nil, nothing is logged.
+	Logger Logger
+
+	// Tracer is called after each sector fetch, FAT lookup and directory parse with its duration,
+	// e.g. to record tracing spans. It may be nil.
+	Tracer Tracer
+
+	// DryRun keeps all writes in memory instead of writing them to the reader, which does not even need to
+	// implement io.Writer then. Everything behaves as if the writes were applied, so the effect of modifications
+	// can be previewed using Fs.Changes before applying them for real.
+	DryRun bool
+
+	// Clock provides the time for all timestamps written into the filesystem.
+	// If it is nil, the system time is used.
+	Clock Clock
+
+	// Record receives every sector read and write with its order, offset and data as JSON lines,
+	// so that problems reported by users can be reproduced offline using ReadRecord and NewReplayDevice.
+	// The recording contains the data of all accessed sectors. It may be nil.
+	Record io.Writer
+
+	// TrackOpenFiles keeps a registry of all open Files with their path, the time and the call stack of opening them,
+	// so that long-running servers can find handles which are never closed using Fs.OpenFiles and Fs.Leaks.
+	TrackOpenFiles bool
+
+	// MaxOpenFiles is the count of Files which may be open at once. OpenFile fails with ErrTooManyOpenFiles if it
+	// is reached. Setting it also enables TrackOpenFiles. If it is 0, there is no limit.
+	MaxOpenFiles int
+
+	// FileMode maps the entries to the permissions returned by FileInfo.Mode, as FAT has no permissions but some
+	// tools refuse files without any (e.g. tar or HTTP servers checking whether a file is readable).
+	// If the filesystem is read only, all write permissions are removed. os.ModeDir is always set for directories.
+	// If it is nil, DefaultFileMode is used.
+	FileMode func(header EntryHeader) os.FileMode
+
+	// ResolveShortcuts reports Windows shortcuts (.lnk files and folder shortcuts) as read only symlinks,
+	// see Fs.LstatIfPossible. Otherwise all symlink methods fail with ErrNoSymlink.
+	ResolveShortcuts bool
+}
+
+// newFs creates an uninitialized Fs for the given reader.
+func newFs(reader io.ReadSeeker, opts Options) *Fs {
+	writer, _ := reader.(io.Writer)
+
+	cacheSize := opts.CacheSize
+	if cacheSize == 0 {
+		cacheSize = DefaultCacheSize
 	}
 
-	err := fs.initialize(false)
-	if err != nil {
-		return nil, checkpoint.Wrap(err, ErrOpenFilesystem)
+	var index *dirIndex
+	if opts.IndexSize >= 0 && opts.MatchName == nil {
+		indexSize := opts.IndexSize
+		if indexSize == 0 {
+			indexSize = DefaultIndexSize
+		}
+		index = newDirIndex(indexSize)
 	}
-	return fs, nil
+
+	pool := &sectorPool{}
+
+	readerAt, _ := reader.(io.ReaderAt)
+
+	return &Fs{
+		lock:        &sync.Mutex{},
+		writeLock:   &sync.Mutex{},
+		reader:      reader,
+		readerAt:    readerAt,
+		writer:      writer,
+		info:        &Info{},
+		sectorCache: newShardedCache(cacheSize, pool.put),
+		sectorPool:  pool,
+		buffers:     &bufferPool{},
+		sortEntries: opts.SortEntries,
+		dirIndex:    index,
+		chains:      &chainCache{},
+		matchName:   opts.MatchName,
+		progress:    opts.Progress,
+		logger:      opts.Logger,
+		tracer:      opts.Tracer,
+		clock:       clockOrSystem(opts.Clock),
+		recorder:    newRecorder(opts.Record),
+		names:       newNameInterner(),
+		handles:     newHandleRegistry(opts),
+		fat:         &memoryFat{},
+		fatInMemory: opts.FatInMemory,
+		freeze:      &freezeState{},
+		stats:       &statistics{},
+		journal:     &journal{},
+		modes:       newModeMapper(opts.FileMode, writer == nil),
+		shortcuts:   opts.ResolveShortcuts,
+		alloc: &allocation{
+			freeCount: unknownFreeCount,
+		},
+	}
+}
+
+// New opens a FAT filesystem from the given reader.
+// If the reader also implements io.Writer, the filesystem is writable.
+func New(reader io.ReadSeeker) (*Fs, error) {
+	return NewWithOptions(reader, Options{})
 }
 
 // NewSkipChecks opens a FAT filesystem from the given reader just like New but
 // it skips some filesystem validations which may allow you to open not perfectly standard FAT filesystems.
 // Use with caution!
 func NewSkipChecks(reader io.ReadSeeker) (*Fs, error) {
-	fs := &Fs{
-		reader: reader,
+	return NewWithOptions(reader, Options{SkipChecks: true})
+}
+
+// NewWithOptions opens a FAT filesystem from the given reader using the given options.
+func NewWithOptions(reader io.ReadSeeker, opts Options) (*Fs, error) {
+	var dryRun *DryRunDevice
+	if opts.DryRun {
+		var err error
+		dryRun, err = NewDryRunDevice(reader)
+		if err != nil {
+			return nil, checkpoint.Wrap(err, ErrOpenFilesystem)
+		}
+		reader = dryRun
 	}
 
-	err := fs.initialize(true)
+	fs := newFs(reader, opts)
+	fs.dryRun = dryRun
+
+	err := fs.initialize(opts.SkipChecks)
 	if err != nil {
 		return nil, checkpoint.Wrap(err, ErrOpenFilesystem)
 	}
-	return fs, err
+
+	if opts.FatInMemory {
+		err = fs.loadFat()
+		if err != nil {
+			return nil, checkpoint.Wrap(err, ErrOpenFilesystem)
+		}
+	}
+
+	fs.debug("mounted filesystem",
+		"type", fs.info.FSType,
+		"label", fs.Label(),
+		"bytesPerSector", fs.info.BytesPerSector,
+		"sectorsPerCluster", fs.info.SectorsPerCluster,
+		"clusters", fs.info.ClusterCount,
+		"fats", fs.info.FatCount,
+		"readOnly", fs.writer == nil,
+	)
+
+	return fs, nil
 }
 
 // readFileAt reads a file which starts at the given cluster but it skips
 // the first bytes so that is starts reading at the given offset.
-// It only returns max the requested amount of bytes.
+// It only returns max the requested amount of bytes and only reads the sectors containing them.
+// The index caches the resolved cluster chain between calls so that seeking inside of big files does not need to
+// follow the whole chain again. It may be nil.
 // A fileSize of < 0 indicates that it is unknown and therefore it reads until the end of the last sector.
 // If readSize is <= 0 it returns the whole file.
 // If readSize is > fileSize it also just returns the whole file but also io.EOF as error.
 // If an error occurs all bytes read until then and the error is returned. io.EOF is ignored in that case.
-func (f *Fs) readFileAt(cluster fatEntry, fileSize int64, offset int64, readSize int64) ([]byte, error) {
-	// finalize returns the data sliced to either the readSize, the fileSize or 'as it is'.
-	// It may return io.EOF if readSize + offset > fileSize.
-	// Use it before any return in readFileAt.
-	finalize := func(result []byte, err error) ([]byte, error) {
-		if fileSize < 0 {
-			fileSize = int64(len(result)) + offset
-		}
-
-		if err == nil && readSize > fileSize-offset {
-			err = io.EOF
-			readSize = fileSize - offset
-		}
-
-		// The file was not as long as it should be.
-		if err == nil && int64(len(result)) < fileSize-offset && int64(len(result)) < readSize {
-			err = io.ErrUnexpectedEOF
-		}
-
-		// Return at most the readSize as requested.
-		// A readSize of <= 0 means to return till EOF.
-		if readSize > 0 && int64(len(result)) > readSize {
-			return result[:readSize], checkpoint.Wrap(err, ErrReadFilesystemFile)
-		}
-
-		// Return the whole file
-		if int64(len(result)) > fileSize {
-			return result[:fileSize], checkpoint.Wrap(err, ErrReadFilesystemFile)
-		}
+func (f *Fs) readFileAt(cluster fatEntry, index *clusterIndex, fileSize int64, offset int64, readSize int64) ([]byte, error) {
+	reader := f.newChainReader(cluster, index, fileSize, offset)
 
-		// Else just return the result.
-		return result, checkpoint.Wrap(err, ErrReadFilesystemFile)
+	// Without any size, just read until the end of the chain.
+	if fileSize < 0 && readSize <= 0 {
+		data, err := io.ReadAll(reader)
+		return data, err
 	}
 
-	data := make([]byte, 0)
-
-	clusterNumber := 0
-	currentCluster := cluster
-
-	// Find the cluster to start.
-	// We still have to load the cluster number chain.
-	for {
-		if int64(clusterNumber)*int64(f.info.SectorsPerCluster)*int64(f.info.BytesPerSector) <= offset &&
-			int64(clusterNumber+1)*int64(f.info.SectorsPerCluster)*int64(f.info.BytesPerSector) >= offset {
-			break
-		}
-
-		nextCluster, err := f.getFatEntry(currentCluster)
-		if err != nil {
-			return finalize(data, err)
+	var eof error
+	size := readSize
+	if fileSize >= 0 && (size <= 0 || size > fileSize-offset) {
+		if size > 0 {
+			eof = io.EOF
 		}
-
-		if !nextCluster.ReadAsNextCluster() {
-			return finalize(data, nil)
-		}
-
-		currentCluster = nextCluster
-		clusterNumber++
+		size = max64(fileSize-offset, 0)
 	}
 
-	// offsetRest contains the offset which is needed for the actual first sector.
-	// First the clusters which we already ignored get removed from the offset to initialize the offsetRest.
-	offsetRest := offset - (int64(clusterNumber) * int64(f.info.SectorsPerCluster) * int64(f.info.BytesPerSector))
+	data := f.buffers.get(int(size))
+	n, err := io.ReadFull(reader, data)
+	data = data[:n]
 
-	// Calculate the sectors to skip for the first sector.
-	skip := uint8(offsetRest / int64(f.info.BytesPerSector))
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		// The reader only reaches the end before the size if the size of the file is unknown.
+		// Otherwise it reports a too short chain by itself.
+		return data, io.EOF
+	}
+	if err != nil && !(eof != nil && errors.Is(err, io.ErrUnexpectedEOF)) {
+		return data, err
+	}
 
-	// Calculate the final offsetRest by removing these skipped sectors also from the offsetRest.
-	// The result is the value we have to ignore when reading the first sector.
-	offsetRest -= int64(f.info.BytesPerSector) * int64(skip)
+	// Reading over the end of the file is reported as io.EOF even if the chain is too short.
+	return data, eof
+}
 
-	// Read the clusters.
-	for {
-		firstSectorOfCluster := ((currentCluster.Value() - 2) * uint32(f.info.SectorsPerCluster)) + f.info.FirstDataSector
+// entryHeaders returns the entries without their positions.
+func entryHeaders(refs []entryRef) []ExtendedEntryHeader {
+	directory := make([]ExtendedEntryHeader, len(refs))
+	for i, ref := range refs {
+		directory[i] = ref.ExtendedEntryHeader
+	}
 
-		// Read the sectors of the cluster, skip the first ones if needed
-		for i := skip; i < f.info.SectorsPerCluster; i++ {
-			sector, err := f.fetch(firstSectorOfCluster + uint32(i))
-			if err != nil {
-				return finalize(data, err)
-			}
+	return directory
+}
 
-			newData := make([]byte, f.info.BytesPerSector)
-			err = binary.Read(bytes.NewReader(sector.buffer), binary.LittleEndian, &newData)
-			if err != nil {
-				return finalize(nil, err)
-			}
+// parseDirRefs works like parseDir but also returns the position of each entry inside of the directory.
+// The dirCluster of the results is not set.
+func (f *Fs) parseDirRefs(data []byte) ([]entryRef, error) {
+	parser := newDirParser(f.names)
+	parser.parse(data)
+	return parser.directory, nil
+}
 
-			// Trim the first bytes based on the offsetRest if it is the first read.
-			if len(data) == 0 {
-				data = append(data, newData[offsetRest:]...)
-				continue
-			}
+// dirParser interprets the slots of a directory one after another, so that a directory
+// can be parsed while it is read without buffering all of its data.
+type dirParser struct {
+	longFilename          []LongFilenameEntry
+	lastLongFilenameIndex int
+
+	// next is the index of the next slot to parse.
+	next int
+	// directory contains all entries parsed until now.
+	directory []entryRef
+
+	// names interns the long names. It may be nil.
+	names *nameInterner
+	// nameBuffer is reused to decode the long names.
+	nameBuffer []byte
+}
 
-			data = append(data, newData...)
-		}
+func newDirParser(names *nameInterner) *dirParser {
+	return &dirParser{
+		lastLongFilenameIndex: -1,
+		directory:             make([]entryRef, 0),
+		names:                 names,
+	}
+}
 
-		skip = 0
+func (p *dirParser) resetLongFilename(i int) {
+	p.longFilename = nil
+	p.lastLongFilenameIndex = i
+}
 
-		// Stop when the size needed is reached.
-		if readSize > int64(0) && int64(clusterNumber+1)*int64(f.info.SectorsPerCluster)*int64(f.info.BytesPerSector) >= offset+readSize {
-			break
+// parse interprets the next slots of the directory.
+// It returns false if the end of the directory has been reached, so that the following data does not need to be read.
+func (p *dirParser) parse(data []byte) bool {
+	for offset := 0; offset+entrySize <= len(data); offset += entrySize {
+		if !p.parseSlot(data[offset : offset+entrySize]) {
+			return false
 		}
+	}
+	return true
+}
 
-		nextCluster, err := f.getFatEntry(currentCluster)
-		if err != nil {
-			return finalize(data, err)
-		}
+// parseSlot interprets a single slot. It returns false if the slot marks the end of the directory.
+func (p *dirParser) parseSlot(data []byte) bool {
+	i := p.next
+	p.next++
 
-		if !nextCluster.ReadAsNextCluster() {
-			// The file was not as long as it should be.
-			if err == nil && int64(len(data)) < fileSize-offset {
-				return finalize(data, io.ErrUnexpectedEOF)
-			}
-			break
-		}
+	entry := decodeEntryHeader(data)
 
-		currentCluster = nextCluster
-		clusterNumber++
+	// Check the first byte of the name as it may contain special values.
+	// End of FAT
+	if entry.Name[0] == 0x00 {
+		return false
 	}
 
-	return finalize(data, nil)
-}
-
-// parseDir reads and interprets a directory-file. It returns a slice of ExtendedEntryHeader,
-// one for each file in the directory. It may return an error if it cannot be parsed.
-func (f *Fs) parseDir(data []byte) ([]ExtendedEntryHeader, error) {
-	entries := make([]EntryHeader, len(data)/32)
-
-	err := binary.Read(bytes.NewReader(data), binary.LittleEndian, &entries)
-	if err != nil {
-		return nil, checkpoint.Wrap(err, ErrReadFilesystemDir)
+	// Dot-entry (e.g. .. or .) Note that 0x2E is actually a '.'.
+	if entry.Name[0] == 0x2E {
+		// For now just ignore them. Don't know if we need them for something but
+		// afero.Walk cannot cope with it for now.
+		return true
 	}
 
-	var longFilename []LongFilenameEntry
-	var lastLongFilenameIndex = -1
+	// Deleted Entry
+	if entry.Name[0] == 0xE5 {
+		return true
+	}
 
-	resetLongFilename := func(i int) {
-		longFilename = nil
-		lastLongFilenameIndex = i
+	// Initial character is actually 0xE5
+	if entry.Name[0] == 0x05 {
+		entry.Name[0] = 0xE5
 	}
 
-	// Convert to fatFiles and filter empty entries.
-	directory := make([]ExtendedEntryHeader, 0)
-	for i, entry := range entries {
-		// Check the first byte of the name as it may contain special values.
-		// End of FAT
-		if entry.Name[0] == 0x00 {
-			break
-		}
+	// Save extended file name parts.
+	if entry.Attribute&AttrLongName == AttrLongName {
+		// Parse the same bytes again as LongFilenameEntry.
+		longFilenameEntry := decodeLongFilenameEntry(data)
 
-		// Dot-entry (e.g. .. or .) Note that 0x2E is actually a '.'.
-		if entry.Name[0] == 0x2E {
-			// For now just ignore them. Don't know if we need them for something but
-			// afero.Walk cannot cope with it for now.
-			continue
+		// Ignore deleted entry.
+		if longFilenameEntry.Sequence == 0xE5 {
+			return true
 		}
 
-		// Deleted Entry
-		if entry.Name[0] == 0xE5 {
-			continue
+		// If the 0x40 bit of the sequence is set, it means that this is the beginning of a long filename.
+		// Therefore we need to reset everything before.
+		if longFilenameEntry.Sequence&0x40 == 0x40 {
+			p.resetLongFilename(i - 1)
 		}
 
-		// Initial character is actually 0xE5
-		if entry.Name[0] == 0x05 {
-			entry.Name[0] = 0xE5
+		if p.lastLongFilenameIndex+1 != i {
+			// All long filename parts have to be directly after each other.
+			// So reset if there is a hole.
+			p.resetLongFilename(i)
+			return true
 		}
 
-		// Save extended file name parts.
-		if entry.Attribute&AttrLongName == AttrLongName {
-			// First get the bytes again but only for this one entry.
-			entryBytes := data[i*32 : (i+1)*32]
-
-			// Then parse it as LongFilenameEntry.
-			longFilenameEntry := LongFilenameEntry{}
-			err = binary.Read(bytes.NewReader(entryBytes), binary.LittleEndian, &longFilenameEntry)
-			if err != nil {
-				return nil, checkpoint.Wrap(err, ErrReadFilesystemDir)
-			}
-
-			// Ignore deleted entry.
-			if longFilenameEntry.Sequence == 0xE5 {
-				continue
-			}
-
-			// If the 0x40 bit of the sequence is set, it means that this is the beginning of a long filename.
-			// Therefore we need to reset everything before.
-			if longFilenameEntry.Sequence&0x40 == 0x40 {
-				resetLongFilename(i - 1)
-			}
-
-			if lastLongFilenameIndex+1 != i {
-				// All long filename parts have to be directly after each other.
-				// So reset if there is a hole.
-				resetLongFilename(i)
-				continue
-			}
+		p.longFilename = append(p.longFilename, longFilenameEntry)
+		p.lastLongFilenameIndex = i
+		return true
+	}
 
-			longFilename = append(longFilename, longFilenameEntry)
-			lastLongFilenameIndex = i
-			continue
-		}
+	// Filter out not displayed entries.
+	if entry.Attribute&AttrVolumeId == AttrVolumeId {
+		return true
+	}
 
-		// Filter out not displayed entries.
-		if entry.Attribute&AttrVolumeId == AttrVolumeId {
-			continue
+	newEntry := entryRef{
+		ExtendedEntryHeader: ExtendedEntryHeader{EntryHeader: entry},
+		index:               i,
+	}
+	// If the longFilename exists and the last longFilename part was the directly previous entry.
+	if p.longFilename != nil && p.lastLongFilenameIndex+1 == i {
+		// Calculate the checksum for the entry.
+		// Note that it has to be calculated from the name as it is stored (e.g. with 0x05 instead of 0xE5).
+		storedName := newEntry.Name
+		if storedName[0] == 0xE5 {
+			storedName[0] = 0x05
 		}
-
-		newEntry := ExtendedEntryHeader{EntryHeader: entry}
-		// If the longFilename exists and the last longFilename part was the directly previous entry.
-		if longFilename != nil && lastLongFilenameIndex+1 == i {
-			// Calculate the checksum for the entry.
-			var checksum byte = 0
-			for i := 0; i < 11; i++ {
-				checksum = (((checksum & 1) << 7) | ((checksum & 0xfe) >> 1)) + newEntry.Name[i]
+		checksum := shortNameChecksum(storedName)
+
+		var chars []uint16
+		var valid = true
+
+		// Run through the filename parts in reverse order.
+		// Check the checksum and sequence numbers for each entry.
+		// If everything is valid, save the full long name.
+		sequenceNumber := 0
+		for longFilenameIndex := len(p.longFilename) - 1; longFilenameIndex >= 0; longFilenameIndex-- {
+			sequenceNumber++
+
+			current := p.longFilename[longFilenameIndex]
+			// If any checksum is wrong, the long filename is corrupt.
+			if current.Checksum != checksum {
+				valid = false
+				break
 			}
 
-			var chars []uint16
-			var valid = true
-
-			// Run through the filename parts in reverse order.
-			// Check the checksum and sequence numbers for each entry.
-			// If everything is valid, save the full long name.
-			sequenceNumber := 0
-			for longFilenameIndex := len(longFilename) - 1; longFilenameIndex >= 0; longFilenameIndex-- {
-				sequenceNumber++
-
-				current := longFilename[longFilenameIndex]
-				// If any checksum is wrong, the long filename is corrupt.
-				if current.Checksum != checksum {
-					valid = false
-					break
-				}
-
-				// If any sequence number is invalid, the long filename is corrupt.
-				// A correct long filename looks like this:
-				//  <proceeding files...>
-				//  <slot #3, id = 0x43, characters = "h is long">
-				//  <slot #2, id = 0x02, characters = "xtension whic">
-				//  <slot #1, id = 0x01, characters = "My Big File.E">
-				//  <directory entry, name = "MYBIGFIL.EXT">
-				// (the 0x40 bit is already checked above)
-				if current.Sequence&0b0001111 != byte(sequenceNumber) {
-					valid = false
-					break
-				}
-
-				chars = append(chars, current.First[:]...)
-				chars = append(chars, current.Second[:]...)
-				chars = append(chars, current.Third[:]...)
+			// If any sequence number is invalid, the long filename is corrupt.
+			// A correct long filename looks like this:
+			//  <proceeding files...>
+			//  <slot #3, id = 0x43, characters = "h is long">
+			//  <slot #2, id = 0x02, characters = "xtension whic">
+			//  <slot #1, id = 0x01, characters = "My Big File.E">
+			//  <directory entry, name = "MYBIGFIL.EXT">
+			// (the 0x40 bit is already checked above)
+			if current.Sequence&0b0001111 != byte(sequenceNumber) {
+				valid = false
+				break
 			}
 
-			if valid {
-				for _, char := range chars {
-					if char == 0 {
-						break
-					}
-					// TODO: Not sure if fmt.Sprintf() in combination with rune() decodes the char correctly in all cases.
-					// 		 Note for this:  Each Unicode character takes either two or four bytes, UTF-16LE encoded.
-					newEntry.ExtendedName += fmt.Sprintf("%c", rune(char))
-				}
-			}
+			chars = append(chars, current.First[:]...)
+			chars = append(chars, current.Second[:]...)
+			chars = append(chars, current.Third[:]...)
 		}
-		directory = append(directory, newEntry)
 
-		// Reset long filename for next file.
-		resetLongFilename(i)
+		if valid {
+			newEntry.lfnCount = len(p.longFilename)
+			newEntry.ExtendedName, p.nameBuffer = p.names.decodeLongName(chars, p.nameBuffer)
+		}
 	}
+	p.directory = append(p.directory, newEntry)
 
-	return directory, nil
+	// Reset long filename for next file.
+	p.resetLongFilename(i)
+	return true
 }
 
-func (f *Fs) readDirAtSector(sectorNum uint32) ([]ExtendedEntryHeader, error) {
-	rootDirSectorsCount := uint32(((f.info.RootEntryCount * 32) + (f.info.BytesPerSector - 1)) / f.info.BytesPerSector)
-
-	data := make([]byte, 0)
-
-	for i := uint32(0); i < rootDirSectorsCount; i++ {
-		sector, err := f.fetch(sectorNum + i)
-		if err != nil {
-			return nil, checkpoint.Wrap(err, ErrReadFilesystemDir)
-		}
-
-		newData := make([]byte, f.info.BytesPerSector)
-		err = binary.Read(bytes.NewReader(sector.buffer), binary.LittleEndian, &newData)
-		if err != nil {
-			return nil, checkpoint.Wrap(err, ErrReadFilesystemDir)
-		}
-
-		data = append(data, newData...)
-	}
-
-	return f.parseDir(data)
+// releaseBuffer gives a buffer returned by readFileAt back, so that it can be reused by the next read.
+func (f *Fs) releaseBuffer(buffer []byte) {
+	f.buffers.put(buffer)
 }
 
+// readDir reads the directory starting at the given cluster.
 func (f *Fs) readDir(cluster fatEntry) ([]ExtendedEntryHeader, error) {
-	data, err := f.readFileAt(cluster, -1, 0, 0)
+	refs, err := f.readDirRefs(cluster)
 	if err != nil {
-		return nil, checkpoint.Wrap(err, ErrReadFilesystemDir)
+		return nil, err
 	}
 
-	return f.parseDir(data)
+	f.dirIndex.list(cluster, refs)
+
+	return entryHeaders(refs), nil
 }
 
 // readRoot either reads the root directory either from the specific root sector if the type is < FAT32 or
 // from the first root cluster if the type is FAT32.
 func (f *Fs) readRoot() ([]ExtendedEntryHeader, error) {
-	if f.info.FSType == FAT12 {
-		checkpoint.From(ErrNotSupported)
-	}
-
-	var root []ExtendedEntryHeader
-	var err error
-	switch f.info.FSType {
-	case FAT16:
-		firstRootSector := uint32(f.info.ReservedSectorCount) + (uint32(f.info.FatCount) * f.info.FatSize)
-		root, err = f.readDirAtSector(firstRootSector)
-	case FAT32:
-		root, err = f.readDir(f.info.fat32Specific.RootCluster)
-	}
-
+	// A dirCluster of 0 references the root directory for all FAT types.
+	root, err := f.readDir(0)
 	return root, checkpoint.Wrap(err, ErrReadFilesystemDir)
 }
 
@@ -452,57 +599,66 @@ func (f *Fs) initialize(skipChecks bool) error {
 	f.info.BytesPerSector = 512
 
 	// Read sec0
-	// Set to a sector unequal 0 to avoid using empty buffer in fetch.
-	f.sectorCache.current = 0xFFFFFFFF
+	f.sectorCache.clear()
+	f.dirIndex.clear()
+	f.chains.clear()
 	sector, err := f.fetch(0)
 	if err != nil {
 		return err
 	}
 
 	// Read sector as BPB
-	bpb := BPB{}
-	err = binary.Read(bytes.NewReader(sector.buffer), binary.LittleEndian, &bpb)
+	bpb, err := decodeBPB(sector.buffer)
 	if err != nil {
 		return checkpoint.Wrap(err, fmt.Errorf("%w: parsing the bpb sector failed", ErrInitializeFilesystem))
 	}
 
-	if !skipChecks {
-		// Check if it is really a FAT filesystem.
-		// Check for valid jump instructions
-		if !(bpb.BSJumpBoot[0] == 0xEB && bpb.BSJumpBoot[2] == 0x90) && !(bpb.BSJumpBoot[0] == 0xE9) {
-			return checkpoint.From(fmt.Errorf("%w: no valid jump instructions at the beginning", ErrInitializeFilesystem))
-		}
+	// Check if it is really a FAT filesystem.
+	// If the checks are skipped, the problems are only logged.
+	var problems []string
 
-		// Load the sector size and use it for all following sector reads.
-		// Also FAT only supports 512, 1024, 2048 and 4096
-		if bpb.BytesPerSector != 512 && bpb.BytesPerSector != 1024 && bpb.BytesPerSector != 2048 && bpb.BytesPerSector != 4096 {
-			return checkpoint.From(fmt.Errorf("%w: invalid sector size", ErrInitializeFilesystem))
-		}
+	// Check for valid jump instructions
+	if !(bpb.BSJumpBoot[0] == 0xEB && bpb.BSJumpBoot[2] == 0x90) && !(bpb.BSJumpBoot[0] == 0xE9) {
+		problems = append(problems, "no valid jump instructions at the beginning")
+	}
 
-		// Sectors per cluster has to be a power of two and greater than 0.
-		// Also the whole cluster size should not be more than 32K.
-		if bpb.SectorsPerCluster%2 != 0 || bpb.SectorsPerCluster == 0 || (bpb.BytesPerSector*uint16(bpb.SectorsPerCluster)) > (32*1024) {
-			return checkpoint.From(fmt.Errorf("%w: invalid sectors per cluster", ErrInitializeFilesystem))
-		}
+	// Load the sector size and use it for all following sector reads.
+	// Also FAT only supports 512, 1024, 2048 and 4096
+	if bpb.BytesPerSector != 512 && bpb.BytesPerSector != 1024 && bpb.BytesPerSector != 2048 && bpb.BytesPerSector != 4096 {
+		problems = append(problems, "invalid sector size")
+	}
 
-		// The reserved sector count should not be 0.
-		// Note: for FAT12 and FAT16 it is typically 1 for FAT32 it is typically 32.
-		if bpb.ReservedSectorCount == 0 {
-			return checkpoint.From(fmt.Errorf("%w: invalid reserved sector count", ErrInitializeFilesystem))
-		}
+	// Sectors per cluster has to be a power of two and greater than 0.
+	// Also the whole cluster size should not be more than 32K.
+	spc := bpb.SectorsPerCluster
+	if spc == 0 || spc&(spc-1) != 0 || uint32(bpb.BytesPerSector)*uint32(spc) > 32*1024 {
+		problems = append(problems, "invalid sectors per cluster")
+	}
 
-		if bpb.NumFATs < 1 {
-			return checkpoint.From(fmt.Errorf("%w: invalid FAT count", ErrInitializeFilesystem))
-		}
+	// The reserved sector count should not be 0.
+	// Note: for FAT12 and FAT16 it is typically 1 for FAT32 it is typically 32.
+	if bpb.ReservedSectorCount == 0 {
+		problems = append(problems, "invalid reserved sector count")
+	}
 
-		if bpb.Media != 0xF0 &&
-			!(bpb.Media >= 0xF8 && bpb.Media <= 0xFF) {
-			return checkpoint.From(fmt.Errorf("%w: invalid media value", ErrInitializeFilesystem))
-		}
+	if bpb.NumFATs < 1 {
+		problems = append(problems, "invalid FAT count")
+	}
 
-		if sector.buffer[510] != 0x55 || sector.buffer[511] != 0xAA {
-			return checkpoint.From(fmt.Errorf("%w: invalid signature at offset 510 / 511", ErrInitializeFilesystem))
+	if bpb.Media != 0xF0 &&
+		!(bpb.Media >= 0xF8 && bpb.Media <= 0xFF) {
+		problems = append(problems, "invalid media value")
+	}
+
+	if sector.buffer[510] != 0x55 || sector.buffer[511] != 0xAA {
+		problems = append(problems, "invalid signature at offset 510 / 511")
+	}
+
+	for _, problem := range problems {
+		if !skipChecks {
+			return checkpoint.From(fmt.Errorf("%w: %v", ErrInitializeFilesystem, problem))
 		}
+		f.debug("ignoring an invalid boot sector", "problem", problem)
 	}
 
 	var totalSectors, dataSectors, countOfClusters uint32
@@ -527,13 +683,17 @@ func (f *Fs) initialize(skipChecks bool) error {
 		totalSectors = bpb.TotalSectors32
 	}
 
-	dataSectors = totalSectors - (uint32(bpb.ReservedSectorCount) + uint32(bpb.NumFATs)) + rootDirSectors
+	metaSectors := uint32(bpb.ReservedSectorCount) + (uint32(bpb.NumFATs) * f.info.FatSize) + rootDirSectors
+	if bpb.SectorsPerCluster == 0 || totalSectors <= metaSectors {
+		return checkpoint.From(fmt.Errorf("%w: invalid sector counts", ErrInitializeFilesystem))
+	}
+
+	dataSectors = totalSectors - metaSectors
 	countOfClusters = dataSectors / uint32(bpb.SectorsPerCluster)
 
 	// Now the correct type can be determined based on the cluster count.
 	if countOfClusters < 4085 {
-		// For now do not support FAT12 as its a bit more complicated.
-		return checkpoint.From(fmt.Errorf("%w: FAT12 is not supported", ErrNotSupported))
+		f.info.FSType = FAT12
 	} else if countOfClusters < 65525 {
 		f.info.FSType = FAT16
 	} else {
@@ -547,6 +707,8 @@ func (f *Fs) initialize(skipChecks bool) error {
 
 	// Now all needed data can be saved. See FAT spec for details.
 	f.info.BytesPerSector = bpb.BytesPerSector
+	// The cached sector 0 may have the wrong size.
+	f.sectorCache.clear()
 	if bpb.TotalSectors16 != 0 {
 		f.info.TotalSectorCount = uint32(bpb.TotalSectors16)
 	} else {
@@ -558,9 +720,15 @@ func (f *Fs) initialize(skipChecks bool) error {
 	f.info.FirstDataSector = uint32(bpb.ReservedSectorCount) + (uint32(bpb.NumFATs) * f.info.FatSize) + rootDirSectors
 	f.info.FatCount = bpb.NumFATs
 	f.info.RootEntryCount = bpb.RootEntryCount
+	f.info.ClusterCount = countOfClusters
 
 	if f.info.FSType == FAT32 {
 		f.info.Label = string(f.info.fat32Specific.BSVolumeLabel[:])
+
+		err = f.readFSInfo()
+		if err != nil {
+			return err
+		}
 	} else {
 		err = binary.Read(bytes.NewReader(bpb.FATSpecificData[:]), binary.LittleEndian, &f.info.fat16Specific)
 		if err != nil {
@@ -573,34 +741,151 @@ func (f *Fs) initialize(skipChecks bool) error {
 	return nil
 }
 
+// readFSInfo loads the allocation hints from the FAT32 FSInfo sector.
+// If the sector is missing or invalid, the values are treated as unknown.
+func (f *Fs) readFSInfo() error {
+	if f.info.fat32Specific.FSInfo == 0 || f.info.fat32Specific.FSInfo == 0xFFFF {
+		return nil
+	}
+
+	sector, err := f.fetch(uint32(f.info.fat32Specific.FSInfo))
+	if err != nil {
+		return checkpoint.Wrap(err, fmt.Errorf("%w: reading the FSInfo sector failed", ErrInitializeFilesystem))
+	}
+
+	fsInfo := FSInfo{}
+	err = binary.Read(bytes.NewReader(sector.buffer), binary.LittleEndian, &fsInfo)
+	if err != nil {
+		return checkpoint.Wrap(err, fmt.Errorf("%w: parsing the FSInfo sector failed", ErrInitializeFilesystem))
+	}
+
+	if fsInfo.LeadSignature != 0x41615252 || fsInfo.StructSignature != 0x61417272 || fsInfo.TrailSignature != 0xAA550000 {
+		f.debug("ignoring the FSInfo sector with invalid signatures", "sector", f.info.fat32Specific.FSInfo)
+		return nil
+	}
+
+	if fsInfo.FreeCount <= f.info.ClusterCount {
+		f.alloc.freeCount = fsInfo.FreeCount
+	} else if fsInfo.FreeCount != unknownFreeCount {
+		f.debug("ignoring the invalid free cluster count of the FSInfo sector", "freeCount", fsInfo.FreeCount, "clusters", f.info.ClusterCount)
+	}
+	f.alloc.nextFree = fsInfo.NextFree
+
+	return nil
+}
+
 // fetch loads a specific single sector of the filesystem.
+// The returned buffer is a copy which may be kept and modified by the caller.
+// Prefer readSector if the data is only needed for a short time.
 func (f *Fs) fetch(sectorNum uint32) (Sector, error) {
-	f.lock.Lock()
-	defer f.lock.Unlock()
+	var sector Sector
+	err := f.readSector(sectorNum, func(buffer []byte) {
+		sector = Sector{
+			current: sectorNum,
+			buffer:  append([]byte(nil), buffer...),
+		}
+	})
+	return sector, err
+}
 
-	sector := Sector{
-		buffer: make([]byte, f.info.BytesPerSector),
+// readSector calls read with the content of the sector while holding the lock of its cache shard.
+// The buffer belongs to the sector cache, so it must not be modified or used after read returns.
+// Sectors which are not cached are read without holding the shard lock, so that concurrent reads only wait for
+// each other while accessing the same shard. If the reader implements io.ReaderAt, no other lock is needed at all.
+func (f *Fs) readSector(sectorNum uint32, read func(buffer []byte)) error {
+	shard := f.sectorCache.shard(sectorNum)
+
+	shard.lock.Lock()
+	if sector, ok := shard.cache.get(sectorNum); ok {
+		read(sector.buffer)
+		shard.lock.Unlock()
+		atomic.AddUint64(&f.stats.cacheHits, 1)
+		return nil
 	}
+	generation := shard.cache.generation
+	shard.lock.Unlock()
+	atomic.AddUint64(&f.stats.cacheMisses, 1)
 
-	// Only load it once.
-	if sectorNum == f.sectorCache.current {
-		return f.sectorCache, nil
+	if err := f.canceled(); err != nil {
+		return err
 	}
 
-	// Seek to and Read the new sectorNum.
-	_, err := f.reader.Seek(int64(sectorNum)*int64(f.info.BytesPerSector), io.SeekStart)
+	buffer, err := f.loadSector(sectorNum)
 	if err != nil {
-		return Sector{}, checkpoint.Wrap(err, fmt.Errorf("%w: sector %d", ErrFetchingSector, sectorNum))
+		return err
+	}
+
+	shard.lock.Lock()
+	defer shard.lock.Unlock()
+
+	// Another read may have loaded the sector in the meantime.
+	if sector, ok := shard.cache.get(sectorNum); ok {
+		f.sectorPool.put(buffer)
+		read(sector.buffer)
+		return nil
+	}
+
+	read(buffer)
+
+	// If anything was written while reading, the sector may be outdated and must not be cached.
+	if shard.cache.generation != generation {
+		f.sectorPool.put(buffer)
+		return nil
 	}
 
-	_, err = f.reader.Read(sector.buffer)
+	shard.cache.put(Sector{current: sectorNum, buffer: buffer})
+	return nil
+}
+
+// loadSector reads the sector from the reader into a buffer of the sectorPool.
+// The lock is only held if the reader does not implement io.ReaderAt.
+func (f *Fs) loadSector(sectorNum uint32) ([]byte, error) {
+	start := f.traceStart()
+	buffer := f.sectorPool.get(int(f.info.BytesPerSector))
+	offset := int64(sectorNum) * int64(f.info.BytesPerSector)
+
+	var err error
+	if f.readerAt != nil {
+		var n int
+		n, err = f.readerAt.ReadAt(buffer, offset)
+		if err == io.EOF && n == len(buffer) {
+			err = nil
+		}
+	} else {
+		f.lock.Lock()
+		// Seek to and Read the new sectorNum.
+		_, err = f.reader.Seek(offset, io.SeekStart)
+		if err == nil {
+			var n int
+			n, err = f.reader.Read(buffer)
+
+			// A Read may return less than requested without an error, so read the rest.
+			for err == nil && n < len(buffer) {
+				f.debug("retrying a short sector read", "sector", sectorNum, "read", n, "size", len(buffer))
+
+				var read int
+				read, err = f.reader.Read(buffer[n:])
+				n += read
+				if read == 0 && err == nil {
+					err = io.ErrNoProgress
+				}
+			}
+			if err == io.EOF && n == len(buffer) {
+				err = nil
+			}
+		}
+		f.lock.Unlock()
+	}
+
+	f.traceSectorFetch(sectorNum, 1, start, err)
+	f.record(RecordRead, sectorNum, buffer, len(buffer), err)
 	if err != nil {
-		return Sector{}, checkpoint.Wrap(err, fmt.Errorf("%w: sector %d", ErrFetchingSector, sectorNum))
+		f.sectorPool.put(buffer)
+		return nil, checkpoint.Wrap(err, fmt.Errorf("%w: sector %d", ErrFetchingSector, sectorNum))
 	}
 
-	sector.current = sectorNum
-	f.sectorCache = sector
-	return sector, nil
+	f.stats.read(1, len(buffer))
+	return buffer, nil
 }
 
 type fatEntry uint32
@@ -628,7 +913,7 @@ func (e fatEntry) IsNextCluster() bool {
 }
 
 // IsReservedSometimes is a special value which may occur in rare cases. Should be treated as a DataCluster.
-// TODO: For FAT12 a special case exists -> 0xFF0 should be read as EOF. This is not implemented yet.
+// On FAT12 the value 0xFF0 is read as EOF instead, see getFatEntry.
 // Use ReadAsNextCluster to check for all DataCluster-like values.
 func (e fatEntry) IsReservedSometimes() bool {
 	masked := e & 0x0FFFFFFF
@@ -659,12 +944,6 @@ func (e fatEntry) IsEOF() bool {
 // as normal data clusters.
 // Use this tho check if it should be read as a normal data cluster.
 func (e fatEntry) ReadAsNextCluster() bool {
-	// TODO: e.IsReservedSometimes(): MS-DOS/PC DOS 3.3 and higher treats a value of 0xFF0[nb 11][13] on FAT12 (but not on FAT16 or FAT32)
-	//       volumes as additional end-of-chain marker similar to 0xFF8-0xFFF.[13] For compatibility with MS-DOS/PC DOS,
-	//       file systems should avoid to use data cluster 0xFF0 in cluster chains on FAT12 volumes (that is, treat it
-	//       as a reserved cluster similar to 0xFF7). (NB. The correspondence of the low byte of the cluster number with
-	//       the FAT ID and media descriptor values is the reason, why these cluster values are reserved.)
-
 	return e.IsNextCluster() || e.IsReservedSometimes() || e.IsReserved() || e.IsBad()
 }
 
@@ -677,30 +956,67 @@ func (e fatEntry) ReadAsEOF() bool {
 }
 
 // getFatEntry returns the next fat entry for the given cluster.
+// The special values of FAT12 and FAT16 are extended to the ones of FAT32 (e.g. 0xFFF7 -> 0x0FFFFFF7).
+// MS-DOS 3.3 and higher treat the value 0xFF0 of FAT12 as an additional end of chain marker, so it is read as EOF.
 func (f *Fs) getFatEntry(cluster fatEntry) (fatEntry, error) {
-	if f.info.FSType == FAT12 {
-		return 0, checkpoint.From(ErrNotSupported)
-	}
-
-	var fatOffset uint32
-	switch f.info.FSType {
-	case FAT16:
-		fatOffset = cluster.Value() * 2
-	case FAT32:
-		fatOffset = cluster.Value() * 4
-	}
+	start := f.traceStart()
+	entry, err := f.lookupFatEntry(cluster)
+	f.traceFatLookup(cluster, start, err)
+	return entry, err
+}
 
-	fatSectorNumber := uint32(f.info.ReservedSectorCount) + (fatOffset / uint32(f.info.BytesPerSector))
-	fatEntryOffset := fatOffset % uint32(f.info.BytesPerSector)
+// lookupFatEntry reads the FAT entry of the cluster, see getFatEntry.
+func (f *Fs) lookupFatEntry(cluster fatEntry) (fatEntry, error) {
+	atomic.AddUint64(&f.stats.fatLookups, 1)
 
-	sector, err := f.fetch(fatSectorNumber)
+	fatOffset := f.fatOffset(cluster)
+	buffer, inMemory, err := f.readFat(fatOffset)
 	if err != nil {
-		return 0, checkpoint.Wrap(err, ErrReadFat)
+		return 0, checkpoint.Wrap(err, fmt.Errorf("%w: entry of cluster %d", ErrReadFat, cluster))
+	}
+	if !inMemory {
+		fatSectorNumber := uint32(f.info.ReservedSectorCount) + (fatOffset / uint32(f.info.BytesPerSector))
+		fatEntryOffset := fatOffset % uint32(f.info.BytesPerSector)
+
+		var entry [4]byte
+		err = f.readSector(fatSectorNumber, func(sector []byte) {
+			copy(entry[:], sector[fatEntryOffset:])
+		})
+		if err != nil {
+			return 0, checkpoint.Wrap(err, fmt.Errorf("%w: entry of cluster %d", ErrReadFat, cluster))
+		}
+
+		// A FAT12 entry may continue in the next sector.
+		if f.info.FSType == FAT12 && fatEntryOffset == uint32(f.info.BytesPerSector)-1 {
+			err = f.readSector(fatSectorNumber+1, func(sector []byte) {
+				entry[1] = sector[0]
+			})
+			if err != nil {
+				return 0, checkpoint.Wrap(err, fmt.Errorf("%w: entry of cluster %d", ErrReadFat, cluster))
+			}
+		}
+		buffer = entry[:]
 	}
 
 	switch f.info.FSType {
+	case FAT12:
+		fat12ClusterEntryValue := binary.LittleEndian.Uint16(buffer[0:2])
+		if cluster.Value()%2 == 1 {
+			fat12ClusterEntryValue >>= 4
+		} else {
+			fat12ClusterEntryValue &= 0x0FFF
+		}
+
+		switch {
+		case fat12ClusterEntryValue == 0xFF0:
+			return eocMarker, nil
+		case fat12ClusterEntryValue > 0xFF0:
+			return fatEntry(uint32(fat12ClusterEntryValue) | 0x0FFFF000), nil
+		}
+
+		return fatEntry(fat12ClusterEntryValue), nil
 	case FAT16:
-		fat16ClusterEntryValue := binary.LittleEndian.Uint16(sector.buffer[fatEntryOffset : fatEntryOffset+2])
+		fat16ClusterEntryValue := binary.LittleEndian.Uint16(buffer[0:2])
 
 		// convert the special values to FAT32 special values (e.g. 0xFF -> 0x0FFFFFFF)
 		if fat16ClusterEntryValue >= 0xFFF0 && fat16ClusterEntryValue <= 0xFFFF {
@@ -709,17 +1025,13 @@ func (f *Fs) getFatEntry(cluster fatEntry) (fatEntry, error) {
 
 		return fatEntry(fat16ClusterEntryValue), nil
 	case FAT32:
-		fat32ClusterEntryValue := binary.LittleEndian.Uint32(sector.buffer[fatEntryOffset:fatEntryOffset+4]) & 0x0FFFFFFF
+		fat32ClusterEntryValue := binary.LittleEndian.Uint32(buffer[0:4]) & 0x0FFFFFFF
 		return fatEntry(fat32ClusterEntryValue), nil
 	}
 
 	return 0, checkpoint.From(ErrNotSupported)
 }
 
-func (f *Fs) store() error {
-	panic("implement me")
-}
-
 func (f *Fs) Label() string {
 	// TODO: There may be a label entry in the root folder. Check how that should be handled.
 	return strings.TrimRight(f.info.Label, " ")
@@ -729,21 +1041,76 @@ func (f *Fs) FSType() FATType {
 	return f.info.FSType
 }
 
+// Info returns the geometry of the filesystem as read from the boot sector.
+func (f *Fs) Info() Info {
+	return *f.info
+}
+
+// RootCluster returns the first cluster of the root directory. It is 0 for FAT16, which stores the root directory
+// in a fixed region before the data clusters.
+func (f *Fs) RootCluster() uint32 {
+	if f.info.FSType != FAT32 {
+		return 0
+	}
+	return f.info.fat32Specific.RootCluster.Value()
+}
+
 func (f *Fs) Create(name string) (afero.File, error) {
-	panic("implement me")
+	return f.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
 }
 
+// Mkdir creates a new directory. The perm is ignored as FAT has no permissions for directories.
 func (f *Fs) Mkdir(name string, perm os.FileMode) error {
-	panic("implement me")
+	path, err := cleanPath(name)
+	if err != nil {
+		return checkpoint.Wrap(err, ErrWriteFilesystem)
+	}
+
+	err = f.mutate(Mutation{Op: OpMkdir, Path: path}, func() error {
+		_, err := f.mkdir(path, newEntryHeader(AttrDirectory, f.clock.Now()))
+		return err
+	})
+	return checkpoint.Wrap(err, ErrWriteFilesystem)
 }
 
+// MkdirAll creates a directory and all missing parents.
 func (f *Fs) MkdirAll(path string, perm os.FileMode) error {
-	panic("implement me")
+	path, err := cleanPath(path)
+	if err != nil {
+		return checkpoint.Wrap(err, ErrWriteFilesystem)
+	}
+
+	err = f.mutate(Mutation{Op: OpMkdir, Path: path}, func() error {
+		parts := strings.Split(path, "/")
+		for i := range parts {
+			current := strings.Join(parts[:i+1], "/")
+
+			ref, err := f.resolve(current)
+			if err == nil {
+				if !ref.isDir() {
+					return checkpoint.Wrap(syscall.ENOTDIR, fmt.Errorf("%w: %v", ErrInvalidPath, current))
+				}
+				continue
+			}
+
+			if !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+
+			_, err = f.mkdir(current, newEntryHeader(AttrDirectory, f.clock.Now()))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return checkpoint.Wrap(err, ErrWriteFilesystem)
 }
 
-func (f *Fs) Open(path string) (afero.File, error) {
+// cleanPath validates the path and converts it into the form used internally which is "" for the root.
+func cleanPath(path string) (string, error) {
 	if !fs.ValidPath(path) {
-		return nil, checkpoint.Wrap(ErrInvalidPath, ErrOpenFilesystem)
+		return "", checkpoint.From(ErrInvalidPath)
 	}
 	path = filepath.ToSlash(path)
 
@@ -751,117 +1118,450 @@ func (f *Fs) Open(path string) (afero.File, error) {
 		path = ""
 	}
 
-	// For root just return a fake-file.
+	// Remove suffix-slash.
+	return strings.TrimSuffix(path, "/"), nil
+}
+
+// matchName compares two names the way FAT does it.
+// Note: FAT is not case sensitive.
+func matchName(entryName, name string) bool {
+	return strings.ToUpper(strings.Trim(entryName, " ")) == strings.ToUpper(name)
+}
+
+// match compares the names using Options.MatchName or matchName if it is not set.
+func (f *Fs) match(entryName, name string) bool {
+	if f.matchName != nil {
+		return f.matchName(entryName, name)
+	}
+	return matchName(entryName, name)
+}
+
+// resolve searches the entry for the given path. The path has to be cleaned by cleanPath.
+// For the root directory a fake entry is returned.
+func (f *Fs) resolve(path string) (entryRef, error) {
+	current := rootRef()
+
+	// For root just return the fake-entry.
 	if path == "" {
-		fakeEntry := ExtendedEntryHeader{
-			EntryHeader: EntryHeader{
-				Name:      [11]byte{' ', ' ', ' ', ' ', ' ', ' ', ' ', ' ', ' ', ' ', ' '},
-				Attribute: AttrDirectory,
-			},
+		return current, nil
+	}
+
+	dirParts := strings.Split(path, "/")
+
+	// Go through the path until the last pathPart and then use the contents of that folder as result.
+	for _, pathPart := range dirParts {
+		if pathPart == "" {
+			continue
+		}
+
+		if !current.isDir() {
+			return entryRef{}, checkpoint.From(syscall.ENOTDIR)
+		}
+
+		entry, found, err := f.lookupEntry(f.entryDirCluster(current), pathPart)
+		if err != nil {
+			return entryRef{}, err
+		}
+
+		if !found {
+			return entryRef{}, checkpoint.From(fmt.Errorf("%w: no matching path found: ***/%v/***", os.ErrNotExist, pathPart))
 		}
 
+		current = entry
+	}
+
+	return current, nil
+}
+
+// newFile creates a File for the given entry.
+func (f *Fs) newFile(path string, ref entryRef, flag int) *File {
+	// The root directory has no entry.
+	if ref.isRoot() {
 		return &File{
 			fs:          f,
 			path:        path,
 			isDirectory: true,
-			stat:        fakeEntry.FileInfo(),
-		}, nil
+			stat:        f.modes.fileInfo(&ref.ExtendedEntryHeader),
+			modes:       f.modes,
+			flag:        flag,
+		}
 	}
 
-	// Remove suffix-slash.
-	path = strings.TrimSuffix(path, "/")
-	dirParts := strings.Split(path, "/")
+	return &File{
+		fs:           f,
+		path:         path,
+		isDirectory:  ref.isDir(),
+		isReadOnly:   ref.Attribute&AttrReadOnly == AttrReadOnly,
+		isHidden:     ref.Attribute&AttrHidden == AttrHidden,
+		isSystem:     ref.Attribute&AttrSystem == AttrSystem,
+		firstCluster: ref.firstCluster(),
+		stat:         f.modes.fileInfo(&ref.ExtendedEntryHeader),
+		modes:        f.modes,
+		dirCluster:   ref.dirCluster,
+		entryIndex:   ref.index,
+		flag:         flag,
+	}
+}
+
+func (f *Fs) Open(path string) (afero.File, error) {
+	return f.OpenFile(path, os.O_RDONLY, 0)
+}
 
-	content, err := f.readRoot()
+// OpenFile opens the file with the given flags.
+// If a file gets created, it is marked as read only if the perm does not contain write permissions for the owner.
+func (f *Fs) OpenFile(name string, flag int, perm os.FileMode) (afero.File, error) {
+	path, err := cleanPath(name)
 	if err != nil {
 		return nil, checkpoint.Wrap(err, ErrOpenFilesystem)
 	}
 
-	// Go through the path until the last pathPart and then use the contents of that folder as result.
-pathLoop:
-	for i, pathPart := range dirParts {
-		if pathPart == "" {
-			continue
+	handle, err := f.handles.acquire(path, time.Now())
+	if err != nil {
+		return nil, checkpoint.Wrap(err, ErrOpenFilesystem)
+	}
+
+	file, err := f.openFile(path, flag, perm)
+	if err != nil {
+		handle.release(false)
+		return nil, checkpoint.Wrap(err, ErrOpenFilesystem)
+	}
+
+	handle.track(file)
+	return file, nil
+}
+
+// openFile works like OpenFile for a cleaned path.
+func (f *Fs) openFile(path string, flag int, perm os.FileMode) (*File, error) {
+	// Just reading does not need the write lock.
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND) == 0 {
+		ref, err := f.resolve(path)
+		if err != nil {
+			return nil, err
 		}
 
-		for _, entry := range content {
-			fileInfo := entry.FileInfo()
-			// Note: FAT is not case sensitive.
-			if strings.ToUpper(strings.Trim(fileInfo.Name(), " ")) == strings.ToUpper(pathPart) {
-				// If it is the last one return it as a File.
-				if i == len(dirParts)-1 {
-					return &File{
-						fs:           f,
-						path:         path,
-						isDirectory:  fileInfo.IsDir(),
-						isReadOnly:   entry.Attribute&AttrReadOnly == AttrReadOnly,
-						isHidden:     entry.Attribute&AttrHidden == AttrHidden,
-						isSystem:     entry.Attribute&AttrSystem == AttrSystem,
-						firstCluster: fatEntry(uint32(entry.FirstClusterHI)<<16 | uint32(entry.FirstClusterLO)),
-						stat:         entry.FileInfo(),
-					}, nil
-				}
+		return f.newFile(path, ref, flag), nil
+	}
 
-				// Else try to go deeper.
-				if !fileInfo.IsDir() {
-					return nil, checkpoint.Wrap(syscall.ENOTDIR, ErrOpenFilesystem)
-				}
+	var file *File
+	err := f.mutate(Mutation{Op: OpCreate, Path: path}, func() error {
+		ref, err := f.resolve(path)
+		if errors.Is(err, os.ErrNotExist) && flag&os.O_CREATE != 0 {
+			header := newEntryHeader(AttrArchive, f.clock.Now())
+			if perm&0200 == 0 {
+				header.Attribute |= AttrReadOnly
+			}
 
-				content, err = f.readDir(fatEntry(uint32(entry.FirstClusterHI)<<16 | uint32(entry.FirstClusterLO)))
-				if err != nil {
-					return nil, checkpoint.Wrap(err, ErrOpenFilesystem)
-				}
+			ref, err = f.createEntry(path, header)
+			if err != nil {
+				return err
+			}
+		} else if err != nil {
+			return err
+		} else if flag&os.O_CREATE != 0 && flag&os.O_EXCL != 0 {
+			return checkpoint.From(syscall.EEXIST)
+		} else if ref.isDir() && flag&(os.O_WRONLY|os.O_RDWR|os.O_TRUNC) != 0 {
+			return checkpoint.From(syscall.EISDIR)
+		} else if ref.Attribute&AttrReadOnly == AttrReadOnly && flag&(os.O_WRONLY|os.O_RDWR|os.O_TRUNC) != 0 {
+			return checkpoint.From(syscall.EACCES)
+		}
+
+		if flag&os.O_TRUNC != 0 && !ref.isDir() && (ref.FileSize > 0 || ref.firstCluster() != 0) {
+			f.journal.retype(OpTruncate)
+			cluster, err := f.truncateChain(ref.firstCluster(), int64(ref.FileSize), 0)
+			if err != nil {
+				return err
+			}
 
-				continue pathLoop
+			ref.setFirstCluster(cluster)
+			ref.FileSize = 0
+			err = f.writeDirEntry(ref.dirCluster, ref.index, ref.EntryHeader)
+			if err != nil {
+				return err
 			}
 		}
-		return nil, checkpoint.Wrap(ErrOpenFilesystem, errors.New("no matching path found: ***/"+pathPart+"/***"))
-	}
 
-	return nil, checkpoint.Wrap(ErrOpenFilesystem, errors.New("path doesn't exist: "+path))
-}
+		file = f.newFile(path, ref, flag)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
 
-func (f *Fs) OpenFile(name string, flag int, perm os.FileMode) (afero.File, error) {
-	// TODO: implement flag and perm
-	return f.Open(name)
+	return file, nil
 }
 
+// Remove removes a file or an empty directory.
 func (f *Fs) Remove(name string) error {
-	panic("implement me")
+	path, err := cleanPath(name)
+	if err != nil {
+		return checkpoint.Wrap(err, ErrWriteFilesystem)
+	}
+
+	err = f.mutate(Mutation{Op: OpRemove, Path: path}, func() error {
+		ref, err := f.resolve(path)
+		if err != nil {
+			return err
+		}
+
+		return f.removeEntry(ref)
+	})
+	return checkpoint.Wrap(err, ErrWriteFilesystem)
 }
 
+// RemoveAll removes a file or a directory with everything it contains.
+// It returns nil if the path does not exist.
 func (f *Fs) RemoveAll(path string) error {
-	panic("implement me")
+	path, err := cleanPath(path)
+	if err != nil {
+		return checkpoint.Wrap(err, ErrWriteFilesystem)
+	}
+
+	err = f.mutate(Mutation{Op: OpRemove, Path: path}, func() error {
+		ref, err := f.resolve(path)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		return f.removeAll(ref)
+	})
+	return checkpoint.Wrap(err, ErrWriteFilesystem)
 }
 
+// Rename moves a file or directory. An existing file at newname is replaced.
 func (f *Fs) Rename(oldname, newname string) error {
-	panic("implement me")
+	oldPath, err := cleanPath(oldname)
+	if err != nil {
+		return checkpoint.Wrap(err, ErrWriteFilesystem)
+	}
+
+	newPath, err := cleanPath(newname)
+	if err != nil {
+		return checkpoint.Wrap(err, ErrWriteFilesystem)
+	}
+
+	err = f.mutate(Mutation{Op: OpRename, Path: oldPath, Target: newPath}, func() error {
+		return f.rename(oldPath, newPath)
+	})
+	return checkpoint.Wrap(err, ErrWriteFilesystem)
+}
+
+// Stat returns the FileInfo of the path. It does not open a file, so it does not count for Options.MaxOpenFiles.
+func (f *Fs) Stat(name string) (os.FileInfo, error) {
+	path, err := cleanPath(name)
+	if err == nil {
+		var ref entryRef
+		ref, err = f.resolve(path)
+		if err == nil {
+			return f.modes.fileInfo(&ref.ExtendedEntryHeader), nil
+		}
+	}
+
+	return nil, checkpoint.Wrap(checkpoint.Wrap(err, ErrOpenFilesystem), errors.New("path doesn't exist: "+name))
 }
 
-func (f *Fs) Stat(path string) (os.FileInfo, error) {
-	file, err := f.Open(path)
+// Exists reports whether the path exists. Unlike afero.Exists it does not open the file,
+// and it stops as soon as a part of the path is missing or no directory.
+func (f *Fs) Exists(name string) (bool, error) {
+	path, err := cleanPath(name)
 	if err != nil {
-		return nil, checkpoint.From(errors.New("path doesn't exist: " + path))
+		return false, checkpoint.Wrap(err, ErrOpenFilesystem)
 	}
-	defer func() {
-		_ = file.Close()
-	}()
 
-	return file.Stat()
+	_, err = f.resolve(path)
+	if errors.Is(err, os.ErrNotExist) || errors.Is(err, syscall.ENOTDIR) {
+		return false, nil
+	}
+	if err != nil {
+		return false, checkpoint.Wrap(err, ErrOpenFilesystem)
+	}
+
+	return true, nil
+}
+
+// IsDir reports whether the path is a directory without opening it.
+// Like afero.IsDir it returns an error satisfying errors.Is(err, os.ErrNotExist) if the path does not exist.
+func (f *Fs) IsDir(name string) (bool, error) {
+	path, err := cleanPath(name)
+	if err != nil {
+		return false, checkpoint.Wrap(err, ErrOpenFilesystem)
+	}
+
+	ref, err := f.resolve(path)
+	if err != nil {
+		return false, checkpoint.Wrap(err, ErrOpenFilesystem)
+	}
+
+	return ref.isDir(), nil
 }
 
 func (f *Fs) Name() string {
 	return "FAT"
 }
 
+// updateEntryAt resolves the entry at the given path and saves it after applying the update.
+// The root directory cannot be updated as it has no entry.
+func (f *Fs) updateEntryAt(name string, update func(header *EntryHeader)) error {
+	path, err := cleanPath(name)
+	if err != nil {
+		return checkpoint.Wrap(err, ErrWriteFilesystem)
+	}
+
+	err = f.mutate(Mutation{Op: OpChange, Path: path}, func() error {
+		ref, err := f.resolve(path)
+		if err != nil {
+			return err
+		}
+
+		if ref.isRoot() {
+			return checkpoint.From(fmt.Errorf("%w: the root directory has no entry", ErrNotSupported))
+		}
+
+		update(&ref.EntryHeader)
+		return f.writeDirEntry(ref.dirCluster, ref.index, ref.EntryHeader)
+	})
+	return checkpoint.Wrap(err, ErrWriteFilesystem)
+}
+
+// Chmod sets the read only attribute if the mode contains no write permission for the owner.
+// All other bits are ignored as FAT does not support them.
 func (f *Fs) Chmod(name string, mode os.FileMode) error {
-	panic("implement me")
+	return f.updateEntryAt(name, func(header *EntryHeader) {
+		if mode&0200 == 0 {
+			header.Attribute |= AttrReadOnly
+		} else {
+			header.Attribute &^= AttrReadOnly
+		}
+	})
 }
 
+// Chown is not supported as FAT has no owners.
 func (f *Fs) Chown(name string, uid, gid int) error {
-	panic("implement me")
+	return checkpoint.From(ErrNotSupported)
 }
 
+// Chtimes changes the access and modification time.
+// Note that FAT only stores the date of the last access.
 func (f *Fs) Chtimes(name string, atime time.Time, mtime time.Time) error {
-	panic("implement me")
+	return f.updateEntryAt(name, func(header *EntryHeader) {
+		header.LastAccessDate = FormatDate(atime)
+		header.WriteDate = FormatDate(mtime)
+		header.WriteTime = FormatTime(mtime)
+	})
+}
+
+// SetNTReserved sets the reserved byte of the entry at the given path.
+// GoFAT keeps the byte as it is when changing an entry, so it can be used to
+// restore vendor specific flags. It can be read using FileInfo.NTReserved.
+func (f *Fs) SetNTReserved(name string, value byte) error {
+	return f.updateEntryAt(name, func(header *EntryHeader) {
+		header.NTReserved = value
+	})
+}
+
+// SetAttributes sets the read only, hidden, system and archive attributes of the entry at the given path,
+// e.g. AttrHidden|AttrSystem. The other attributes describe the type of the entry and are kept as they are.
+func (f *Fs) SetAttributes(name string, attributes byte) error {
+	const changeable = AttrReadOnly | AttrHidden | AttrSystem | AttrArchive
+	return f.updateEntryAt(name, func(header *EntryHeader) {
+		header.Attribute = header.Attribute&^changeable | attributes&changeable
+	})
+}
+
+// reportProgress passes the progress of a long-running operation to the Progress option if it is set.
+func (f *Fs) reportProgress(done, total int64) {
+	if f.progress != nil {
+		f.progress(done, total)
+	}
+}
+
+// sync flushes the underlying reader if it supports it (e.g. os.File).
+func (f *Fs) sync() error {
+	syncer, ok := f.reader.(interface{ Sync() error })
+	if !ok {
+		return nil
+	}
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return checkpoint.From(syncer.Sync())
+}
+
+// writeFileAt writes the data into the file starting at the given cluster.
+// See writeChainAt for details.
+func (f *Fs) writeFileAt(path string, cluster fatEntry, fileSize int64, offset int64, data []byte) (fatEntry, error) {
+	result := cluster
+	err := f.mutate(Mutation{Op: OpWrite, Path: path}, func() error {
+		var err error
+		result, err = f.writeChainAt(cluster, fileSize, offset, data)
+		return err
+	})
+	return result, err
+}
+
+// writeFileChainAt writes the data into the file with the given chain, so that writing a file in many parts does
+// not have to follow its chain from the start each time. If the chain is nil, the chain starting at the given
+// cluster is used. Missing clusters are allocated. See writeChainAt for details.
+// It returns the (maybe grown) chain of the file.
+func (f *Fs) writeFileChainAt(path string, cluster fatEntry, chain []fatEntry, fileSize int64, offset int64, data []byte) ([]fatEntry, error) {
+	err := f.mutate(Mutation{Op: OpWrite, Path: path}, func() error {
+		var err error
+		if chain == nil {
+			chain, err = f.clusterChain(cluster)
+			if err != nil {
+				return err
+			}
+		}
+
+		chain, err = f.growChain(chain, offset+int64(len(data)))
+		if err != nil {
+			return err
+		}
+
+		return f.writeClusters(chain, fileSize, offset, data)
+	})
+	return chain, err
+}
+
+// reserveFile allocates the clusters needed for size bytes for the file starting at the given cluster.
+// See reserveChain for details.
+func (f *Fs) reserveFile(path string, cluster fatEntry, size int64) ([]fatEntry, error) {
+	var result []fatEntry
+	err := f.mutate(Mutation{Op: OpWrite, Path: path}, func() error {
+		var err error
+		result, err = f.reserveChain(cluster, size)
+		return err
+	})
+	return result, err
+}
+
+// truncateFile changes the size of the file starting at the given cluster.
+// See truncateChain for details.
+func (f *Fs) truncateFile(path string, cluster fatEntry, fileSize int64, size int64) (fatEntry, error) {
+	result := cluster
+	err := f.mutate(Mutation{Op: OpTruncate, Path: path}, func() error {
+		var err error
+		result, err = f.truncateChain(cluster, fileSize, size)
+		return err
+	})
+	return result, err
+}
+
+// updateEntry overwrites the short entry at the given slot index of the directory.
+// The op is the operation of the file which needs the update.
+func (f *Fs) updateEntry(op MutationOp, path string, dirCluster fatEntry, index int, entry EntryHeader) error {
+	return f.mutate(Mutation{Op: op, Path: path}, func() error {
+		ref, err := f.refreshRef(entryRef{
+			ExtendedEntryHeader: ExtendedEntryHeader{EntryHeader: entry},
+			dirCluster:          dirCluster,
+			index:               index,
+		})
+		if err != nil {
+			return err
+		}
+
+		return f.writeDirEntry(dirCluster, ref.index, entry)
+	})
 }
@@ -9,20 +9,24 @@ import (
 	"reflect"
 	"strings"
 	"sync"
+	"syscall"
 	"testing"
 	"testing/quick"
 	"time"
 
+	"github.com/aligator/gofat/fattest"
 	"github.com/spf13/afero"
 )
 
 const testFolderInImages = "DoNotEdit_tests"
 
 const (
-	fat32                         = "./testdata/fat32.img"
-	fat16                         = "./testdata/fat16.img"
-	fat32InvalidSectorsPerCluster = "./testdata/fat32-invalid-sectors-per-cluster.img"
-	fat16InvalidFiles             = "./testdata/fat16-invalid-files.img"
+	fat32 = "./testdata/fat32.img"
+	fat16 = "./testdata/fat16.img"
+	// fat32OneSectorPerCluster uses one sector per cluster. Its file name is from the time when New only accepted
+	// at least two sectors per cluster, but it is a valid image.
+	fat32OneSectorPerCluster = "./testdata/fat32-invalid-sectors-per-cluster.img"
+	fat16InvalidFiles        = "./testdata/fat16-invalid-files.img"
 )
 
 func testFileReader(file string) io.ReadSeeker {
@@ -44,6 +48,17 @@ func testingNew(t testing.TB, reader io.ReadSeeker) *Fs {
 	return fs
 }
 
+// testingSectorsPerCluster returns a small formatted image with the given sectors per cluster in the BPB.
+func testingSectorsPerCluster(t testing.TB, sectorsPerCluster byte) io.ReadSeeker {
+	image := testingImage(t)
+	if err := Format(image, FormatOptions{Size: 16 * 1024 * 1024}); err != nil {
+		t.Fatal(err)
+	}
+	image.data[13] = sectorsPerCluster
+	image.offset = 0
+	return image
+}
+
 func TestNew(t *testing.T) {
 	type args struct {
 		reader io.ReadSeeker
@@ -81,9 +96,18 @@ func TestNew(t *testing.T) {
 			wantErr:    true,
 		},
 		{
-			name: "fat32 invalid sectors per cluster test image",
+			// One sector per cluster is a valid power of two.
+			name: "fat32 test image with one sector per cluster",
 			args: args{
-				reader: testFileReader(fat32InvalidSectorsPerCluster),
+				reader: testFileReader(fat32OneSectorPerCluster),
+			},
+			wantNotNil: true,
+			wantErr:    false,
+		},
+		{
+			name: "sectors per cluster not a power of two",
+			args: args{
+				reader: testingSectorsPerCluster(t, 3),
 			},
 			wantNotNil: false,
 			wantErr:    true,
@@ -138,9 +162,17 @@ func TestNewSkipChecks(t *testing.T) {
 			wantErr:    true,
 		},
 		{
-			name: "fat32 invalid sectors per cluster test image",
+			name: "fat32 test image with one sector per cluster",
+			args: args{
+				reader: testFileReader(fat32OneSectorPerCluster),
+			},
+			wantNotNil: true,
+			wantErr:    false,
+		},
+		{
+			name: "sectors per cluster not a power of two",
 			args: args{
-				reader: testFileReader(fat32InvalidSectorsPerCluster),
+				reader: testingSectorsPerCluster(t, 3),
 			},
 			wantNotNil: true,
 			wantErr:    false,
@@ -553,7 +585,7 @@ func TestFs_Label(t *testing.T) {
 	type fields struct {
 		reader      io.ReadSeeker
 		info        Info
-		sectorCache Sector
+		sectorCache *shardedCache
 	}
 	tests := []struct {
 		name   string
@@ -573,9 +605,9 @@ func TestFs_Label(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			fs := &Fs{
-				lock:        sync.Mutex{},
+				lock:        &sync.Mutex{},
 				reader:      tt.fields.reader,
-				info:        tt.fields.info,
+				info:        &tt.fields.info,
 				sectorCache: tt.fields.sectorCache,
 			}
 			if got := fs.Label(); got != tt.want {
@@ -589,7 +621,7 @@ func TestFs_FSType(t *testing.T) {
 	type fields struct {
 		reader      io.ReadSeeker
 		info        Info
-		sectorCache Sector
+		sectorCache *shardedCache
 	}
 	tests := []struct {
 		name   string
@@ -627,9 +659,9 @@ func TestFs_FSType(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			fs := &Fs{
-				lock:        sync.Mutex{},
+				lock:        &sync.Mutex{},
 				reader:      tt.fields.reader,
-				info:        tt.fields.info,
+				info:        &tt.fields.info,
 				sectorCache: tt.fields.sectorCache,
 			}
 			if got := fs.FSType(); got != tt.want {
@@ -643,7 +675,7 @@ func TestFs_Create(t *testing.T) {
 	type fields struct {
 		reader      io.ReadSeeker
 		info        Info
-		sectorCache Sector
+		sectorCache *shardedCache
 	}
 	type args struct {
 		name string
@@ -660,9 +692,9 @@ func TestFs_Create(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			fs := &Fs{
-				lock:        sync.Mutex{},
+				lock:        &sync.Mutex{},
 				reader:      tt.fields.reader,
-				info:        tt.fields.info,
+				info:        &tt.fields.info,
 				sectorCache: tt.fields.sectorCache,
 			}
 			got, err := fs.Create(tt.args.name)
@@ -681,7 +713,7 @@ func TestFs_Mkdir(t *testing.T) {
 	type fields struct {
 		reader      io.ReadSeeker
 		info        Info
-		sectorCache Sector
+		sectorCache *shardedCache
 	}
 	type args struct {
 		name string
@@ -698,9 +730,9 @@ func TestFs_Mkdir(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			fs := &Fs{
-				lock:        sync.Mutex{},
+				lock:        &sync.Mutex{},
 				reader:      tt.fields.reader,
-				info:        tt.fields.info,
+				info:        &tt.fields.info,
 				sectorCache: tt.fields.sectorCache,
 			}
 			if err := fs.Mkdir(tt.args.name, tt.args.perm); (err != nil) != tt.wantErr {
@@ -714,7 +746,7 @@ func TestFs_MkdirAll(t *testing.T) {
 	type fields struct {
 		reader      io.ReadSeeker
 		info        Info
-		sectorCache Sector
+		sectorCache *shardedCache
 	}
 	type args struct {
 		path string
@@ -731,9 +763,9 @@ func TestFs_MkdirAll(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			fs := &Fs{
-				lock:        sync.Mutex{},
+				lock:        &sync.Mutex{},
 				reader:      tt.fields.reader,
-				info:        tt.fields.info,
+				info:        &tt.fields.info,
 				sectorCache: tt.fields.sectorCache,
 			}
 			if err := fs.MkdirAll(tt.args.path, tt.args.perm); (err != nil) != tt.wantErr {
@@ -783,6 +815,8 @@ func TestFs_Open(t *testing.T) {
 		firstCluster: 52,
 		stat:         fakeFolderEntry.FileInfo(),
 		offset:       0,
+		dirCluster:   0,
+		entryIndex:   10,
 	}
 
 	fakeFileEntry := ExtendedEntryHeader{
@@ -812,6 +846,8 @@ func TestFs_Open(t *testing.T) {
 		firstCluster: 53,
 		stat:         fakeFileEntry.FileInfo(),
 		offset:       0,
+		dirCluster:   52,
+		entryIndex:   7,
 	}
 
 	fakeFolderEntryFAT16 := ExtendedEntryHeader{
@@ -841,6 +877,8 @@ func TestFs_Open(t *testing.T) {
 		firstCluster: 4,
 		stat:         fakeFolderEntryFAT16.FileInfo(),
 		offset:       0,
+		dirCluster:   0,
+		entryIndex:   6,
 	}
 
 	fakeFileEntryFAT16 := ExtendedEntryHeader{
@@ -870,6 +908,8 @@ func TestFs_Open(t *testing.T) {
 		firstCluster: 6,
 		stat:         fakeFileEntryFAT16.FileInfo(),
 		offset:       0,
+		dirCluster:   4,
+		entryIndex:   7,
 	}
 
 	type args struct {
@@ -976,6 +1016,7 @@ func TestFs_Open(t *testing.T) {
 			// Set the fs.
 			if tt.want != nil {
 				tt.want.fs = tt.fs
+				tt.want.modes = tt.fs.modes
 			}
 
 			got, err := tt.fs.Open(tt.args.path)
@@ -999,7 +1040,7 @@ func TestFs_OpenFile(t *testing.T) {
 	type fields struct {
 		reader      io.ReadSeeker
 		info        Info
-		sectorCache Sector
+		sectorCache *shardedCache
 	}
 	type args struct {
 		name string
@@ -1018,9 +1059,9 @@ func TestFs_OpenFile(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			fs := &Fs{
-				lock:        sync.Mutex{},
+				lock:        &sync.Mutex{},
 				reader:      tt.fields.reader,
-				info:        tt.fields.info,
+				info:        &tt.fields.info,
 				sectorCache: tt.fields.sectorCache,
 			}
 			got, err := fs.OpenFile(tt.args.name, tt.args.flag, tt.args.perm)
@@ -1039,7 +1080,7 @@ func TestFs_Remove(t *testing.T) {
 	type fields struct {
 		reader      io.ReadSeeker
 		info        Info
-		sectorCache Sector
+		sectorCache *shardedCache
 	}
 	type args struct {
 		name string
@@ -1055,9 +1096,9 @@ func TestFs_Remove(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			fs := &Fs{
-				lock:        sync.Mutex{},
+				lock:        &sync.Mutex{},
 				reader:      tt.fields.reader,
-				info:        tt.fields.info,
+				info:        &tt.fields.info,
 				sectorCache: tt.fields.sectorCache,
 			}
 			if err := fs.Remove(tt.args.name); (err != nil) != tt.wantErr {
@@ -1071,7 +1112,7 @@ func TestFs_RemoveAll(t *testing.T) {
 	type fields struct {
 		reader      io.ReadSeeker
 		info        Info
-		sectorCache Sector
+		sectorCache *shardedCache
 	}
 	type args struct {
 		path string
@@ -1087,9 +1128,9 @@ func TestFs_RemoveAll(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			fs := &Fs{
-				lock:        sync.Mutex{},
+				lock:        &sync.Mutex{},
 				reader:      tt.fields.reader,
-				info:        tt.fields.info,
+				info:        &tt.fields.info,
 				sectorCache: tt.fields.sectorCache,
 			}
 			if err := fs.RemoveAll(tt.args.path); (err != nil) != tt.wantErr {
@@ -1103,7 +1144,7 @@ func TestFs_Rename(t *testing.T) {
 	type fields struct {
 		reader      io.ReadSeeker
 		info        Info
-		sectorCache Sector
+		sectorCache *shardedCache
 	}
 	type args struct {
 		oldname string
@@ -1120,9 +1161,9 @@ func TestFs_Rename(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			fs := &Fs{
-				lock:        sync.Mutex{},
+				lock:        &sync.Mutex{},
 				reader:      tt.fields.reader,
-				info:        tt.fields.info,
+				info:        &tt.fields.info,
 				sectorCache: tt.fields.sectorCache,
 			}
 			if err := fs.Rename(tt.args.oldname, tt.args.newname); (err != nil) != tt.wantErr {
@@ -1137,6 +1178,66 @@ func TestFs_Stat(t *testing.T) {
 	// So it's mostly tested already.
 }
 
+func TestFs_Exists(t *testing.T) {
+	tests := []struct {
+		name       string
+		path       string
+		want       bool
+		wantDir    bool
+		wantDirErr error
+		wantErr    error
+	}{
+		{
+			name:    "root",
+			path:    ".",
+			want:    true,
+			wantDir: true,
+		},
+		{
+			name:    "directory",
+			path:    "DoNotEdit_tests",
+			want:    true,
+			wantDir: true,
+		},
+		{
+			name: "file",
+			path: "go/main.go",
+			want: true,
+		},
+		{
+			name:       "missing",
+			path:       "go/missing.go",
+			wantDirErr: os.ErrNotExist,
+		},
+		{
+			name:       "below a file",
+			path:       "README.md/file",
+			wantDirErr: syscall.ENOTDIR,
+		},
+		{
+			name:       "invalid path",
+			path:       "/README.md",
+			wantErr:    ErrInvalidPath,
+			wantDirErr: ErrInvalidPath,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := testingNew(t, testFileReader(fat16))
+
+			got, err := fs.Exists(tt.path)
+			if !errors.Is(err, tt.wantErr) || (err != nil) != (tt.wantErr != nil) || got != tt.want {
+				t.Errorf("Fs.Exists() = %v, %v, want %v, %v", got, err, tt.want, tt.wantErr)
+			}
+
+			got, err = fs.IsDir(tt.path)
+			if !errors.Is(err, tt.wantDirErr) || (err != nil) != (tt.wantDirErr != nil) || got != tt.wantDir {
+				t.Errorf("Fs.IsDir() = %v, %v, want %v, %v", got, err, tt.wantDir, tt.wantDirErr)
+			}
+		})
+	}
+}
+
 func TestFs_Name(t *testing.T) {
 	tests := []struct {
 		name string
@@ -1161,7 +1262,7 @@ func TestFs_Chmod(t *testing.T) {
 	type fields struct {
 		reader      io.ReadSeeker
 		info        Info
-		sectorCache Sector
+		sectorCache *shardedCache
 	}
 	type args struct {
 		name string
@@ -1178,9 +1279,9 @@ func TestFs_Chmod(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			fs := &Fs{
-				lock:        sync.Mutex{},
+				lock:        &sync.Mutex{},
 				reader:      tt.fields.reader,
-				info:        tt.fields.info,
+				info:        &tt.fields.info,
 				sectorCache: tt.fields.sectorCache,
 			}
 			if err := fs.Chmod(tt.args.name, tt.args.mode); (err != nil) != tt.wantErr {
@@ -1194,7 +1295,7 @@ func TestFs_Chown(t *testing.T) {
 	type fields struct {
 		reader      io.ReadSeeker
 		info        Info
-		sectorCache Sector
+		sectorCache *shardedCache
 	}
 	type args struct {
 		name string
@@ -1212,9 +1313,9 @@ func TestFs_Chown(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			fs := &Fs{
-				lock:        sync.Mutex{},
+				lock:        &sync.Mutex{},
 				reader:      tt.fields.reader,
-				info:        tt.fields.info,
+				info:        &tt.fields.info,
 				sectorCache: tt.fields.sectorCache,
 			}
 			if err := fs.Chown(tt.args.name, tt.args.uid, tt.args.gid); (err != nil) != tt.wantErr {
@@ -1228,7 +1329,7 @@ func TestFs_Chtimes(t *testing.T) {
 	type fields struct {
 		reader      io.ReadSeeker
 		info        Info
-		sectorCache Sector
+		sectorCache *shardedCache
 	}
 	type args struct {
 		name  string
@@ -1246,9 +1347,9 @@ func TestFs_Chtimes(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			fs := &Fs{
-				lock:        sync.Mutex{},
+				lock:        &sync.Mutex{},
 				reader:      tt.fields.reader,
-				info:        tt.fields.info,
+				info:        &tt.fields.info,
 				sectorCache: tt.fields.sectorCache,
 			}
 			if err := fs.Chtimes(tt.args.name, tt.args.atime, tt.args.mtime); (err != nil) != tt.wantErr {
@@ -1372,7 +1473,7 @@ func TestFs_readFile(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			fs := tt.fs
-			got, err := fs.readFileAt(tt.args.cluster, tt.args.fileSize, tt.args.offset, tt.args.readSize)
+			got, err := fs.readFileAt(tt.args.cluster, nil, tt.args.fileSize, tt.args.offset, tt.args.readSize)
 			if !errors.Is(err, tt.wantErr) {
 				t.Errorf("readFileAt() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -1383,3 +1484,157 @@ func TestFs_readFile(t *testing.T) {
 		})
 	}
 }
+
+func TestFs_readErrorContext(t *testing.T) {
+	fs := testingNew(t, testFileReader(fat16))
+
+	file, err := fs.Open("README.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Let the second cluster of the file fail.
+	first := file.(*File).firstCluster
+	second, _, err := fs.clusterAt(first, &clusterIndex{}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sector := fs.firstSectorOfCluster(second)
+
+	device := fattest.NewFaultyDevice(testingCopy(t, fat16), int(fs.info.BytesPerSector))
+	device.FailSector(fattest.Read, int64(sector), nil)
+	fs = testingNew(t, device)
+
+	_, err = afero.ReadFile(fs, "README.md")
+	if !errors.Is(err, ErrReadFile) || !errors.Is(err, ErrFetchingSector) {
+		t.Fatalf("ReadFile() error = %v, want %v and %v", err, ErrReadFile, ErrFetchingSector)
+	}
+
+	for _, want := range []string{
+		"README.md",
+		fmt.Sprintf("sector %d", sector),
+		fmt.Sprintf("cluster %d of the chain starting at cluster %d", second, first),
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("ReadFile() error = %v, want it to contain %q", err, want)
+		}
+	}
+}
+
+func TestFs_faultRecovery(t *testing.T) {
+	tests := []struct {
+		name string
+		// inject adds the faults. The sector is the first sector of README.md.
+		inject func(device *fattest.FaultyDevice, sector int64)
+		// run is called until it succeeds, but at most twice.
+		run        func(fs *Fs) error
+		wantFailed bool
+		wantErrs   int
+	}{
+		{
+			name: "failed reads are not cached",
+			inject: func(device *fattest.FaultyDevice, sector int64) {
+				device.FailSectorOnce(fattest.Read, sector, nil)
+			},
+			run: func(fs *Fs) error {
+				data, err := afero.ReadFile(fs, "README.md")
+				if err == nil && len(data) != 10513 {
+					return fmt.Errorf("read %d bytes, want 10513", len(data))
+				}
+				return err
+			},
+			wantErrs: 1,
+		},
+		{
+			name: "failed write",
+			inject: func(device *fattest.FaultyDevice, sector int64) {
+				device.FailAfter(fattest.Write, 512, nil)
+			},
+			run: func(fs *Fs) error {
+				return afero.WriteFile(fs, "new.txt", testData(5000), 0666)
+			},
+			wantFailed: true,
+			wantErrs:   2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			device := fattest.NewFaultyDevice(testingCopy(t, fat16), 512)
+			fs := testingNew(t, device)
+
+			info, err := fs.Stat("README.md")
+			if err != nil {
+				t.Fatal(err)
+			}
+			first := info.Sys().(ExtendedEntryHeader).FirstCluster()
+			tt.inject(device, int64(fs.firstSectorOfCluster(fatEntry(first))))
+
+			errs := 0
+			for i := 0; i < 2; i++ {
+				err := tt.run(fs)
+				if err == nil {
+					break
+				}
+				if !errors.Is(err, fattest.ErrInjected) {
+					t.Fatalf("error = %v, want %v", err, fattest.ErrInjected)
+				}
+				errs++
+			}
+			if errs != tt.wantErrs {
+				t.Errorf("failed %d times, want %d", errs, tt.wantErrs)
+			}
+
+			changes, err := fs.Changes()
+			if err != nil {
+				t.Fatal(err)
+			}
+			failed := false
+			for _, mutation := range changes.Journal {
+				failed = failed || mutation.Failed
+			}
+			if failed != tt.wantFailed {
+				t.Errorf("Fs.Changes() = %+v, want failed mutations %v", changes.Journal, tt.wantFailed)
+			}
+
+			// After the device works again, the filesystem must be usable.
+			device.Heal()
+			if err := tt.run(fs); err != nil {
+				t.Errorf("error after healing the device = %v", err)
+			}
+		})
+	}
+}
+
+func TestOptions_MatchName(t *testing.T) {
+	caseSensitive := func(entryName, name string) bool {
+		return strings.TrimRight(entryName, " ") == name
+	}
+
+	fs, err := NewWithOptions(testFileReader(fat32), Options{MatchName: caseSensitive})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fs.dirIndex != nil {
+		t.Errorf("the index is used together with a custom MatchName")
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		wantErr bool
+	}{
+		{name: "same case", path: "README.md", wantErr: false},
+		{name: "other case", path: "readme.md", wantErr: true},
+		{name: "nested same case", path: testFolderInImages + "/README.md", wantErr: false},
+		{name: "nested other case", path: strings.ToLower(testFolderInImages) + "/README.md", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := fs.Stat(tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Fs.Stat() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,309 @@
+package gofat
+
+import (
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/aligator/gofat/checkpoint"
+)
+
+// globMatch reports whether the name matches the pattern of path.Match.
+// Like FAT it ignores the case, except if Options.MatchName is set which may compare case sensitive.
+func (f *Fs) globMatch(pattern, name string) bool {
+	if f.matchName == nil {
+		pattern, name = strings.ToUpper(pattern), strings.ToUpper(name)
+	}
+
+	// The pattern is validated before, so there is no error.
+	matched, _ := path.Match(pattern, name)
+	return matched
+}
+
+// glob returns the paths of all entries matching the pattern, see GoFs.Glob.
+func (f *Fs) glob(pattern string) ([]string, error) {
+	// Check the whole pattern first, as invalid parts may not be reached otherwise.
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, checkpoint.From(err)
+	}
+
+	if pattern == "." {
+		return []string{"."}, nil
+	}
+	if !validPattern(pattern) {
+		return nil, nil
+	}
+
+	// paths contains the matches of the parts processed so far with their entries.
+	paths := []string{""}
+	refs := []entryRef{rootRef()}
+
+	for _, part := range strings.Split(pattern, "/") {
+		var nextPaths []string
+		var nextRefs []entryRef
+
+		for i, dir := range refs {
+			if !dir.isDir() {
+				continue
+			}
+
+			var matches []entryRef
+			if !hasMeta(part) {
+				ref, found, err := f.lookupEntry(f.entryDirCluster(dir), part)
+				if err != nil {
+					return nil, err
+				}
+				if found {
+					matches = append(matches, ref)
+				}
+			} else {
+				children, err := f.readDirRefs(f.entryDirCluster(dir))
+				if err != nil {
+					return nil, err
+				}
+
+				for _, child := range children {
+					if f.globMatch(part, child.FileInfo().Name()) {
+						matches = append(matches, child)
+					}
+				}
+			}
+
+			for _, match := range matches {
+				nextPaths = append(nextPaths, path.Join(paths[i], match.FileInfo().Name()))
+				nextRefs = append(nextRefs, match)
+			}
+		}
+
+		paths, refs = nextPaths, nextRefs
+	}
+
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// validPattern reports whether the pattern can match any valid path, see fs.ValidPath.
+// The meta characters are allowed as they may match valid names.
+func validPattern(pattern string) bool {
+	for _, part := range strings.Split(pattern, "/") {
+		if part == "" || part == "." || part == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+// hasMeta reports whether the part of a pattern contains any of the meta characters of path.Match.
+func hasMeta(part string) bool {
+	return strings.ContainsAny(part, `*?[\`)
+}
+
+// Glob returns the paths of all files and directories matching the pattern, sorted by name.
+// Besides the syntax of path.Match it supports the extensions commonly used in packaging manifests:
+//   - "**" as a whole part of the path matches any count of directories including none,
+//     e.g. "firmware/**/*.bin" matches "firmware/a.bin" and "firmware/x/y/b.bin".
+//     At the end of the pattern it matches everything below the directory and the directory itself,
+//     e.g. "firmware/**" matches "firmware" and all files and directories in it.
+//   - "{a,b}" matches any of the comma separated alternatives, which may contain meta characters and other
+//     alternatives, e.g. "*.{bin,hex}" or "{boot,kernel{,-debug}}.img".
+//
+// Like FAT it ignores the case, except if Options.MatchName is set. Each directory is read at most once.
+// GoFs.Glob implements fs.GlobFS instead, which only supports the syntax of path.Match.
+func (f *Fs) Glob(pattern string) ([]string, error) {
+	patterns, err := expandBraces(pattern)
+	if err != nil {
+		return nil, checkpoint.From(err)
+	}
+
+	// Check all patterns first, as invalid parts may not be reached otherwise.
+	for _, expanded := range patterns {
+		if _, err := path.Match(expanded, ""); err != nil {
+			return nil, checkpoint.From(err)
+		}
+	}
+
+	g := &globber{
+		fs:        f,
+		dirs:      make(map[fatEntry][]entryRef),
+		descended: make(map[globStep]bool),
+		matches:   make(map[string]bool),
+	}
+	for _, expanded := range patterns {
+		if expanded == "." {
+			g.matches["."] = true
+			continue
+		}
+		if !validPattern(expanded) {
+			continue
+		}
+
+		if err := g.match(strings.Split(expanded, "/"), 0, "", rootRef()); err != nil {
+			return nil, err
+		}
+	}
+
+	paths := make([]string, 0, len(g.matches))
+	for match := range g.matches {
+		paths = append(paths, match)
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// globber matches the parts of a pattern against the directories, see Fs.Glob.
+type globber struct {
+	fs *Fs
+	// dirs caches the directories read so far by their first cluster.
+	dirs map[fatEntry][]entryRef
+	// descended marks the directories "**" already descended into for a part of the pattern.
+	// It avoids matching the same directories several times and stops at loops in corrupt filesystems.
+	descended map[globStep]bool
+	matches   map[string]bool
+}
+
+// globStep is a directory together with the index of the pattern part matched against its entries.
+type globStep struct {
+	dirCluster fatEntry
+	part       int
+}
+
+// children returns the entries of the directory, which is read only the first time.
+func (g *globber) children(dir entryRef) ([]entryRef, error) {
+	dirCluster := g.fs.entryDirCluster(dir)
+	if refs, ok := g.dirs[dirCluster]; ok {
+		return refs, nil
+	}
+
+	refs, err := g.fs.readDirRefs(dirCluster)
+	if err != nil {
+		return nil, err
+	}
+	g.dirs[dirCluster] = refs
+	return refs, nil
+}
+
+// match adds the paths below the directory at dirPath which match the parts of the pattern starting at index.
+func (g *globber) match(parts []string, index int, dirPath string, dir entryRef) error {
+	if index == len(parts) {
+		// The root directory only matches the pattern ".".
+		if dirPath != "" {
+			g.matches[dirPath] = true
+		}
+		return nil
+	}
+
+	part := parts[index]
+	if part == "**" {
+		step := globStep{dirCluster: g.fs.entryDirCluster(dir), part: index}
+		if g.descended[step] {
+			return nil
+		}
+		g.descended[step] = true
+
+		if err := g.match(parts, index+1, dirPath, dir); err != nil {
+			return err
+		}
+
+		children, err := g.children(dir)
+		if err != nil {
+			return err
+		}
+		for _, child := range children {
+			childPath := path.Join(dirPath, child.FileInfo().Name())
+			if child.isDir() {
+				if err := g.match(parts, index, childPath, child); err != nil {
+					return err
+				}
+			} else if index+1 == len(parts) {
+				// At the end of the pattern "**" matches the files as well.
+				g.matches[childPath] = true
+			}
+		}
+		return nil
+	}
+
+	var matches []entryRef
+	if !hasMeta(part) {
+		ref, found, err := g.fs.lookupEntry(g.fs.entryDirCluster(dir), part)
+		if err != nil {
+			return err
+		}
+		if found {
+			matches = append(matches, ref)
+		}
+	} else {
+		children, err := g.children(dir)
+		if err != nil {
+			return err
+		}
+
+		for _, child := range children {
+			if g.fs.globMatch(part, child.FileInfo().Name()) {
+				matches = append(matches, child)
+			}
+		}
+	}
+
+	for _, match := range matches {
+		matchPath := path.Join(dirPath, match.FileInfo().Name())
+		if index+1 == len(parts) {
+			g.matches[matchPath] = true
+		} else if match.isDir() {
+			if err := g.match(parts, index+1, matchPath, match); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// expandBraces returns the patterns resulting from all combinations of the alternatives in the {a,b} groups.
+// Groups may be nested. Escaped braces and commas as well as single closing braces are normal characters.
+func expandBraces(pattern string) ([]string, error) {
+	start := -1
+	depth := 0
+	var commas []int
+
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			i++
+		case '{':
+			if depth == 0 {
+				start = i
+				commas = nil
+			}
+			depth++
+		case ',':
+			if depth == 1 {
+				commas = append(commas, i)
+			}
+		case '}':
+			if depth == 0 {
+				continue
+			}
+
+			depth--
+			if depth > 0 {
+				continue
+			}
+
+			// Expand the first group. The alternatives together with the rest are expanded recursively.
+			bounds := append(append([]int{start}, commas...), i)
+			var patterns []string
+			for j := 0; j+1 < len(bounds); j++ {
+				expanded, err := expandBraces(pattern[:start] + pattern[bounds[j]+1:bounds[j+1]] + pattern[i+1:])
+				if err != nil {
+					return nil, err
+				}
+				patterns = append(patterns, expanded...)
+			}
+			return patterns, nil
+		}
+	}
+
+	if depth > 0 {
+		return nil, path.ErrBadPattern
+	}
+	return []string{pattern}, nil
+}
@@ -0,0 +1,139 @@
+package gofat
+
+import (
+	"errors"
+	"path"
+	"reflect"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestFs_Glob(t *testing.T) {
+	fs := testingFormat(t, FormatOptions{Size: 32 * 1024 * 1024})
+	for _, name := range []string{
+		"firmware/boot.bin",
+		"firmware/boot.hex",
+		"firmware/kernel.img",
+		"firmware/kernel-debug.img",
+		"firmware/overlays/a.bin",
+		"firmware/overlays/deep/b.BIN",
+		"docs/readme.txt",
+		"top.bin",
+	} {
+		if err := fs.MkdirAll(path.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := afero.WriteFile(fs, name, []byte(name), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		pattern string
+		want    []string
+		wantErr error
+	}{
+		{
+			name:    "path.Match syntax",
+			pattern: "firmware/*.bin",
+			want:    []string{"firmware/boot.bin"},
+		},
+		{
+			name:    "double star",
+			pattern: "**/*.bin",
+			want:    []string{"firmware/boot.bin", "firmware/overlays/a.bin", "firmware/overlays/deep/b.BIN", "top.bin"},
+		},
+		{
+			name:    "double star in the middle",
+			pattern: "firmware/**/deep/*",
+			want:    []string{"firmware/overlays/deep/b.BIN"},
+		},
+		{
+			name:    "double star at the end",
+			pattern: "firmware/overlays/**",
+			want:    []string{"firmware/overlays", "firmware/overlays/a.bin", "firmware/overlays/deep", "firmware/overlays/deep/b.BIN"},
+		},
+		{
+			name:    "several double stars",
+			pattern: "**/**/a.bin",
+			want:    []string{"firmware/overlays/a.bin"},
+		},
+		{
+			name:    "braces",
+			pattern: "firmware/*.{bin,hex}",
+			want:    []string{"firmware/boot.bin", "firmware/boot.hex"},
+		},
+		{
+			name:    "nested braces",
+			pattern: "firmware/kernel{,-debug}.img",
+			want:    []string{"firmware/kernel-debug.img", "firmware/kernel.img"},
+		},
+		{
+			name:    "braces with slashes and double stars",
+			pattern: "{docs/*,**/deep/*}",
+			want:    []string{"docs/readme.txt", "firmware/overlays/deep/b.BIN"},
+		},
+		{
+			name:    "overlapping alternatives",
+			pattern: "{firmware/boot.*,**/boot.bin}",
+			want:    []string{"firmware/boot.bin", "firmware/boot.hex"},
+		},
+		{
+			name:    "root",
+			pattern: ".",
+			want:    []string{"."},
+		},
+		{
+			name:    "no match",
+			pattern: "**/*.c",
+			want:    []string{},
+		},
+		{
+			name:    "unclosed brace",
+			pattern: "firmware/{a,b",
+			wantErr: path.ErrBadPattern,
+		},
+		{
+			name:    "bad pattern",
+			pattern: "{a,[}",
+			wantErr: path.ErrBadPattern,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := fs.Glob(tt.pattern)
+			if !errors.Is(err, tt.wantErr) || (err != nil) != (tt.wantErr != nil) {
+				t.Fatalf("Fs.Glob() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Fs.Glob() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_expandBraces(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    []string
+	}{
+		{pattern: "a", want: []string{"a"}},
+		{pattern: "{a,b}{1,2}", want: []string{"a1", "a2", "b1", "b2"}},
+		{pattern: "x{a,b{c,d}}y", want: []string{"xay", "xbcy", "xbdy"}},
+		{pattern: `\{a,b}`, want: []string{`\{a,b}`}},
+		{pattern: "a}b", want: []string{"a}b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			got, err := expandBraces(tt.pattern)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expandBraces() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
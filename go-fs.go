@@ -2,8 +2,12 @@ package gofat
 
 import (
 	"errors"
+	"fmt"
 	"io"
 	"io/fs"
+	"syscall"
+
+	"github.com/aligator/gofat/checkpoint"
 )
 
 type GoDirEntry struct {
@@ -19,10 +23,20 @@ func (g GoDirEntry) Info() (fs.FileInfo, error) {
 	return g.FileInfo, nil
 }
 
+// GoFile is a file or directory opened by GoFs.Open.
+// All state of a GoFile (its offset and the position of ReadDir) belongs to the handle, everything else is shared
+// through the Fs. So different GoFiles can be used concurrently, e.g. by http.FileServer serving several requests.
+// Like os.File, a single GoFile must not be used by several goroutines at once, except for ReadAt.
 type GoFile struct {
 	*File
 }
 
+var (
+	_ fs.ReadDirFile = GoFile{}
+	_ io.ReadSeeker  = GoFile{}
+	_ io.ReaderAt    = GoFile{}
+)
+
 func (g GoFile) Stat() (fs.FileInfo, error) {
 	return g.File.Stat()
 }
@@ -47,10 +61,18 @@ func (g GoFile) ReadDir(n int) ([]fs.DirEntry, error) {
 }
 
 // GoFs just wraps the afero FAT implementation to be compatible with fs.FS.
+// It only holds a pointer to the Fs, so copies of a GoFs and the Fs itself share the caches, the locks and the
+// state of the filesystem. It is safe for concurrent use, see GoFile.
 type GoFs struct {
-	Fs
+	*Fs
 }
 
+var (
+	_ fs.StatFS     = GoFs{}
+	_ fs.ReadFileFS = GoFs{}
+	_ fs.GlobFS     = GoFs{}
+)
+
 // NewGoFS opens a FAT filesystem from the given reader as fs.FS compatible filesystem.
 func NewGoFS(reader io.ReadSeeker) (*GoFs, error) {
 	fs, err := New(reader)
@@ -58,7 +80,7 @@ func NewGoFS(reader io.ReadSeeker) (*GoFs, error) {
 		return nil, err
 	}
 
-	return &GoFs{*fs}, nil
+	return &GoFs{fs}, nil
 }
 
 // NewGoFSSkipChecks opens a FAT filesystem from the given reader as fs.FS compatible filesystem just like NewGoFs but
@@ -70,7 +92,7 @@ func NewGoFSSkipChecks(reader io.ReadSeeker) (*GoFs, error) {
 		return nil, err
 	}
 
-	return &GoFs{*fs}, nil
+	return &GoFs{fs}, nil
 }
 
 func (g GoFs) Open(name string) (fs.File, error) {
@@ -86,3 +108,50 @@ func (g GoFs) Open(name string) (fs.File, error) {
 
 	return GoFile{f}, nil
 }
+
+// Stat returns the info of the named file or directory directly from its directory entry, without opening it.
+func (g GoFs) Stat(name string) (fs.FileInfo, error) {
+	path, err := cleanPath(name)
+	if err != nil {
+		return nil, checkpoint.Wrap(err, ErrOpenFilesystem)
+	}
+
+	ref, err := g.resolve(path)
+	if err != nil {
+		return nil, checkpoint.Wrap(err, ErrOpenFilesystem)
+	}
+
+	return g.modes.fileInfo(&ref.ExtendedEntryHeader), nil
+}
+
+// Glob returns the paths of all files and directories matching the pattern, see fs.Glob for the syntax.
+// Unlike fs.Glob, names are matched case insensitive like FAT does it, except if Options.MatchName is used.
+// Each directory is read only once and parts without meta characters are looked up directly.
+func (g GoFs) Glob(pattern string) ([]string, error) {
+	return g.glob(pattern)
+}
+
+// ReadFile reads the whole file in one pass. As the size is already known from the directory entry,
+// exactly one buffer gets allocated.
+func (g GoFs) ReadFile(name string) ([]byte, error) {
+	path, err := cleanPath(name)
+	if err != nil {
+		return nil, checkpoint.Wrap(err, ErrReadFile)
+	}
+
+	ref, err := g.resolve(path)
+	if err != nil {
+		return nil, checkpoint.Wrap(err, ErrReadFile)
+	}
+
+	if ref.isDir() {
+		return nil, checkpoint.Wrap(syscall.EISDIR, fmt.Errorf("%w: %v", ErrReadFile, path))
+	}
+
+	data, err := g.readFileAt(ref.firstCluster(), nil, int64(ref.FileSize), 0, 0)
+	if err != nil {
+		return nil, checkpoint.Wrap(err, fmt.Errorf("%w: %v", ErrReadFile, path))
+	}
+
+	return data, nil
+}
@@ -1,17 +1,148 @@
 package gofat
 
 import (
+	"bytes"
+	"errors"
 	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"reflect"
 	"strings"
+	"sync"
+	"syscall"
 	"testing"
 	"testing/fstest"
+
+	"github.com/spf13/afero"
 )
 
-func TestGoFS(t *testing.T) {
-	gofs := GoFs{*testingNew(t, testFileReader(fat32))}
-	if err := fstest.TestFS(gofs, "DoNotEdit_tests/HelloWorldThisIsALoongFileName.txt", "DoNotEdit_tests/README.md"); err != nil {
+// testingGoFSImage formats a new in-memory image with the options, opens it with the Options and creates the files
+// with their paths as content.
+func testingGoFSImage(t *testing.T, formatOpts FormatOptions, opts Options, files []string) *Fs {
+	image := testingImage(t)
+	if err := Format(image, formatOpts); err != nil {
+		t.Fatal(err)
+	}
+
+	fs, err := NewWithOptions(image, opts)
+	if err != nil {
 		t.Fatal(err)
 	}
+
+	for _, name := range files {
+		if strings.HasSuffix(name, "/") {
+			if err := fs.MkdirAll(strings.TrimSuffix(name, "/"), 0755); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+
+		if err := fs.MkdirAll(path.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := afero.WriteFile(fs, name, []byte(name), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return fs
+}
+
+// TestGoFS checks all supported variants of FAT images with fstest.TestFS.
+// New features must keep it passing, which is checked by the CI.
+func TestGoFS(t *testing.T) {
+	// fstest expects Glob to be case sensitive like path.Match, so the FAT-aware matching has to be disabled.
+	opts := Options{MatchName: func(entryName, name string) bool {
+		return strings.TrimRight(entryName, " ") == name
+	}}
+	const mib = 1024 * 1024
+	unicodeFiles := []string{
+		"Grüße/日本語のファイル名.txt",
+		"Grüße/emoji 😀.txt",
+		"a b c/.hidden",
+		"a b c/deep/er/than/the/others/file",
+		"UPPER.TXT",
+		"lower.txt",
+		"A Long Name With Spaces And A Long Extension.extension",
+		"empty dir/",
+	}
+
+	tests := []struct {
+		name     string
+		fs       func(t *testing.T) *Fs
+		expected []string
+	}{
+		{
+			name: "FAT32 fixture",
+			fs: func(t *testing.T) *Fs {
+				fs, err := NewWithOptions(testFileReader(fat32), opts)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return fs
+			},
+			expected: []string{"DoNotEdit_tests/HelloWorldThisIsALoongFileName.txt", "DoNotEdit_tests/README.md"},
+		},
+		{
+			name: "FAT16 fixture",
+			fs: func(t *testing.T) *Fs {
+				fs, err := NewWithOptions(testFileReader(fat16), opts)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return fs
+			},
+			expected: []string{"DoNotEdit_tests/HelloWorldThisIsALoongFileName.txt", "DoNotEdit_tests/README.md"},
+		},
+		{
+			name: "FAT16 with unicode and long names",
+			fs: func(t *testing.T) *Fs {
+				return testingGoFSImage(t, FormatOptions{Size: 16 * mib}, opts, unicodeFiles)
+			},
+			expected: unicodeFiles,
+		},
+		{
+			name: "FAT32 with unicode and long names",
+			fs: func(t *testing.T) *Fs {
+				return testingGoFSImage(t, FormatOptions{Size: 128 * mib, FSType: FAT32}, opts, unicodeFiles)
+			},
+			expected: unicodeFiles,
+		},
+		{
+			name: "FAT12 with unicode and long names",
+			fs: func(t *testing.T) *Fs {
+				return testingGoFSImage(t, FormatOptions{Size: 1440 * 1024}, opts, unicodeFiles)
+			},
+			expected: unicodeFiles,
+		},
+		{
+			name: "empty FAT12",
+			fs: func(t *testing.T) *Fs {
+				return testingGoFSImage(t, FormatOptions{Size: 1440 * 1024}, opts, nil)
+			},
+		},
+		{
+			name: "empty FAT16",
+			fs: func(t *testing.T) *Fs {
+				return testingGoFSImage(t, FormatOptions{Size: 16 * mib}, opts, nil)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var expected []string
+			for _, name := range tt.expected {
+				expected = append(expected, strings.TrimSuffix(name, "/"))
+			}
+
+			gofs := GoFs{tt.fs(t)}
+			if err := fstest.TestFS(gofs, expected...); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
 }
 
 func TestNewGoFS(t *testing.T) {
@@ -51,9 +182,18 @@ func TestNewGoFS(t *testing.T) {
 			wantErr:    true,
 		},
 		{
-			name: "fat32 invalid sectors per cluster test image",
+			// One sector per cluster is a valid power of two.
+			name: "fat32 test image with one sector per cluster",
 			args: args{
-				reader: testFileReader(fat32InvalidSectorsPerCluster),
+				reader: testFileReader(fat32OneSectorPerCluster),
+			},
+			wantNotNil: true,
+			wantErr:    false,
+		},
+		{
+			name: "sectors per cluster not a power of two",
+			args: args{
+				reader: testingSectorsPerCluster(t, 3),
 			},
 			wantNotNil: false,
 			wantErr:    true,
@@ -108,9 +248,17 @@ func TestNewGoFSSkipChecks(t *testing.T) {
 			wantErr:    true,
 		},
 		{
-			name: "fat32 invalid sectors per cluster test image",
+			name: "fat32 test image with one sector per cluster",
+			args: args{
+				reader: testFileReader(fat32OneSectorPerCluster),
+			},
+			wantNotNil: true,
+			wantErr:    false,
+		},
+		{
+			name: "sectors per cluster not a power of two",
 			args: args{
-				reader: testFileReader(fat32InvalidSectorsPerCluster),
+				reader: testingSectorsPerCluster(t, 3),
 			},
 			wantNotNil: true,
 			wantErr:    false,
@@ -129,3 +277,243 @@ func TestNewGoFSSkipChecks(t *testing.T) {
 		})
 	}
 }
+
+func TestGoFs_ReadFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		wantLen int
+		wantErr error
+	}{
+		{
+			name:    "file",
+			path:    "DoNotEdit_tests/README.md",
+			wantLen: 10513,
+		},
+		{
+			name:    "empty file",
+			path:    "DoNotEdit_tests/HelloWorldThisIsALoongFileName.txt",
+			wantLen: 0,
+		},
+		{
+			name:    "directory",
+			path:    "DoNotEdit_tests",
+			wantErr: syscall.EISDIR,
+		},
+		{
+			name:    "not existing",
+			path:    "missing.txt",
+			wantErr: os.ErrNotExist,
+		},
+		{
+			name:    "invalid path",
+			path:    "/README.md",
+			wantErr: ErrInvalidPath,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gofs := GoFs{testingNew(t, testFileReader(fat16))}
+			got, err := gofs.ReadFile(tt.path)
+			if !errors.Is(err, tt.wantErr) || (err != nil) != (tt.wantErr != nil) {
+				t.Fatalf("GoFs.ReadFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			want, err := afero.ReadFile(gofs.Fs, tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != tt.wantLen || !bytes.Equal(got, want) {
+				t.Errorf("GoFs.ReadFile() = %v bytes, want %v bytes equal to afero.ReadFile", len(got), tt.wantLen)
+			}
+		})
+	}
+}
+
+func TestGoFs_Stat(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		wantName string
+		wantSize int64
+		wantDir  bool
+		wantErr  error
+	}{
+		{
+			name:     "root",
+			path:     ".",
+			wantName: "",
+			wantDir:  true,
+		},
+		{
+			name:     "directory",
+			path:     "DoNotEdit_tests",
+			wantName: "DoNotEdit_tests",
+			wantDir:  true,
+		},
+		{
+			name:     "file",
+			path:     "go/main.go",
+			wantName: "main.go",
+			wantSize: 76,
+		},
+		{
+			name:    "not existing",
+			path:    "go/missing.go",
+			wantErr: os.ErrNotExist,
+		},
+		{
+			name:    "invalid path",
+			path:    "go/",
+			wantErr: ErrInvalidPath,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gofs := GoFs{testingNew(t, testFileReader(fat16))}
+			got, err := gofs.Stat(tt.path)
+			if !errors.Is(err, tt.wantErr) || (err != nil) != (tt.wantErr != nil) {
+				t.Fatalf("GoFs.Stat() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			if got.Name() != tt.wantName || got.Size() != tt.wantSize || got.IsDir() != tt.wantDir {
+				t.Errorf("GoFs.Stat() = %v, %v, %v, want %v, %v, %v", got.Name(), got.Size(), got.IsDir(), tt.wantName, tt.wantSize, tt.wantDir)
+			}
+		})
+	}
+}
+
+func TestGoFs_Glob(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		want    []string
+		wantErr error
+	}{
+		{
+			name:    "all in root",
+			pattern: "*",
+			want:    []string{"DoNotEdit_tests", "README.md", "go"},
+		},
+		{
+			name:    "case insensitive",
+			pattern: "*/*.MD",
+			want:    []string{"DoNotEdit_tests/README.md"},
+		},
+		{
+			name:    "without meta characters",
+			pattern: "GO/MAIN.GO",
+			want:    []string{"go/main.go"},
+		},
+		{
+			name:    "character class",
+			pattern: "[a-z]*/[h]*",
+			want:    []string{"DoNotEdit_tests/HelloWorldThisIsALoongFileName.txt"},
+		},
+		{
+			name:    "no match",
+			pattern: "go/*.c",
+		},
+		{
+			name:    "below a file",
+			pattern: "README.md/*",
+		},
+		{
+			name:    "invalid path",
+			pattern: "/go/*",
+		},
+		{
+			name:    "bad pattern",
+			pattern: "go/[",
+			wantErr: path.ErrBadPattern,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gofs := GoFs{testingNew(t, testFileReader(fat16))}
+			got, err := gofs.Glob(tt.pattern)
+			if !errors.Is(err, tt.wantErr) || (err != nil) != (tt.wantErr != nil) {
+				t.Fatalf("GoFs.Glob() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GoFs.Glob() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGoFs_concurrentHandles(t *testing.T) {
+	tests := []struct {
+		name   string
+		reader io.ReadSeeker
+	}{
+		{name: "io.ReaderAt", reader: testFileReader(fat16)},
+		{name: "only io.ReadSeeker", reader: struct{ io.ReadSeeker }{testFileReader(fat16)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fatFs, err := NewWithOptions(tt.reader, Options{CacheSize: 2})
+			if err != nil {
+				t.Fatal(err)
+			}
+			gofs := GoFs{fatFs}
+
+			names := []string{"README.md", "DoNotEdit_tests/README.md", "go/main.go"}
+			want := make(map[string][]byte)
+			for _, name := range names {
+				if want[name], err = afero.ReadFile(fatFs, name); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			server := httptest.NewServer(http.FileServer(http.FS(gofs)))
+			defer server.Close()
+
+			// Each goroutine uses its own handles, partly through http.FileServer which seeks to detect the type.
+			var wg sync.WaitGroup
+			for i := 0; i < 8; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+
+					for j := 0; j < 10; j++ {
+						name := names[(i+j)%len(names)]
+						var got []byte
+						var err error
+						if i%2 == 0 {
+							got, err = fs.ReadFile(struct{ fs.FS }{gofs}, name)
+						} else {
+							var response *http.Response
+							response, err = http.Get(server.URL + "/" + name)
+							if err == nil {
+								got, err = io.ReadAll(response.Body)
+								_ = response.Body.Close()
+							}
+						}
+
+						if err != nil {
+							t.Errorf("reading %v error = %v", name, err)
+							return
+						}
+						if !bytes.Equal(got, want[name]) {
+							t.Errorf("reading %v returned wrong data", name)
+							return
+						}
+
+						if _, err := fs.ReadDir(gofs, path.Dir(name)); err != nil {
+							t.Errorf("fs.ReadDir(%v) error = %v", path.Dir(name), err)
+							return
+						}
+					}
+				}(i)
+			}
+			wg.Wait()
+		})
+	}
+}
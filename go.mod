@@ -5,4 +5,6 @@ go 1.16
 require (
 	github.com/golang/mock v1.4.4
 	github.com/spf13/afero v1.5.1
+	golang.org/x/net v0.0.0-20210405180319-a5a99cb37ef4
+	gopkg.in/yaml.v3 v3.0.1
 )
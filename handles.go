@@ -0,0 +1,170 @@
+package gofat
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aligator/gofat/checkpoint"
+)
+
+// ErrTooManyOpenFiles is returned by OpenFile if Options.MaxOpenFiles files are open already.
+var ErrTooManyOpenFiles = errors.New("too many open files")
+
+// OpenHandle describes a File which was opened through the filesystem, see Fs.OpenFiles and Fs.Leaks.
+type OpenHandle struct {
+	Path   string
+	Opened time.Time
+	// Stack is the call stack of the code which opened the file.
+	Stack string
+}
+
+// handleRegistry tracks the open Files, see Options.TrackOpenFiles. It is shared by all copies of the Fs.
+type handleRegistry struct {
+	lock sync.Mutex
+	// max is the count of files which may be open at once. It is 0 if there is no limit.
+	max   int
+	next  uint64
+	open  map[uint64]*OpenHandle
+	leaks []OpenHandle
+}
+
+func newHandleRegistry(opts Options) *handleRegistry {
+	if !opts.TrackOpenFiles && opts.MaxOpenFiles <= 0 {
+		return nil
+	}
+
+	max := opts.MaxOpenFiles
+	if max < 0 {
+		max = 0
+	}
+	return &handleRegistry{max: max, open: make(map[uint64]*OpenHandle)}
+}
+
+// fileHandle is the entry of an open File in the registry.
+type fileHandle struct {
+	registry *handleRegistry
+	id       uint64
+}
+
+// acquire registers a file which is about to be opened.
+// It fails with ErrTooManyOpenFiles if the limit is reached.
+func (r *handleRegistry) acquire(path string, opened time.Time) (*fileHandle, error) {
+	if r == nil {
+		return nil, nil
+	}
+
+	// Skip runtime.Callers, acquire and OpenFile, so that the stack starts at the caller of OpenFile.
+	stack := make([]uintptr, 32)
+	stack = stack[:runtime.Callers(3, stack)]
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.max > 0 && len(r.open) >= r.max {
+		return nil, checkpoint.From(fmt.Errorf("%w: %d files are open", ErrTooManyOpenFiles, len(r.open)))
+	}
+
+	r.next++
+	r.open[r.next] = &OpenHandle{Path: path, Opened: opened, Stack: formatStack(stack)}
+	return &fileHandle{registry: r, id: r.next}, nil
+}
+
+// track watches the file, so that it is reported by Fs.Leaks if it is garbage collected without being closed.
+func (h *fileHandle) track(file *File) {
+	if h == nil {
+		return
+	}
+
+	file.handle = h
+	runtime.SetFinalizer(file, func(file *File) {
+		file.handle.release(true)
+	})
+}
+
+// untrack removes the closed file from the open files.
+func (h *fileHandle) untrack(file *File) {
+	if h == nil {
+		return
+	}
+
+	h.release(false)
+	runtime.SetFinalizer(file, nil)
+	file.handle = nil
+}
+
+// release removes the file from the open files. leaked marks it as never closed.
+func (h *fileHandle) release(leaked bool) {
+	if h == nil {
+		return
+	}
+
+	r := h.registry
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	handle, ok := r.open[h.id]
+	if !ok {
+		return
+	}
+	delete(r.open, h.id)
+	if leaked {
+		r.leaks = append(r.leaks, *handle)
+	}
+}
+
+// formatStack returns the function and the position of each frame.
+func formatStack(stack []uintptr) string {
+	var result string
+	frames := runtime.CallersFrames(stack)
+	for {
+		frame, more := frames.Next()
+		result += fmt.Sprintf("%s\n\t%s:%d\n", frame.Function, frame.File, frame.Line)
+		if !more {
+			return result
+		}
+	}
+}
+
+// OpenFiles returns the files which are currently open, the oldest first.
+// It returns nil if neither Options.TrackOpenFiles nor Options.MaxOpenFiles is set.
+func (f *Fs) OpenFiles() []OpenHandle {
+	r := f.handles
+	if r == nil {
+		return nil
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	ids := make([]uint64, 0, len(r.open))
+	for id := range r.open {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	open := make([]OpenHandle, len(ids))
+	for i, id := range ids {
+		open[i] = *r.open[id]
+	}
+	return open
+}
+
+// Leaks returns the files which were garbage collected without being closed, in the order they were found.
+// They do not count as open anymore. As the garbage collector decides when files are collected, long-running
+// servers should check the Leaks from time to time; OpenFiles shows the files which are still referenced.
+// It returns nil if neither Options.TrackOpenFiles nor Options.MaxOpenFiles is set.
+func (f *Fs) Leaks() []OpenHandle {
+	r := f.handles
+	if r == nil {
+		return nil
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return append([]OpenHandle(nil), r.leaks...)
+}
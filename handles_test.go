@@ -0,0 +1,143 @@
+package gofat
+
+import (
+	"errors"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+func TestFs_OpenFiles(t *testing.T) {
+	fs, err := NewWithOptions(testFileReader(fat16), Options{TrackOpenFiles: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	readme, err := fs.Open("README.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	main, err := fs.Open("go/main.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Open("missing"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("Fs.Open() error = %v, want %v", err, os.ErrNotExist)
+	}
+
+	open := fs.OpenFiles()
+	if len(open) != 2 || open[0].Path != "README.md" || open[1].Path != "go/main.go" {
+		t.Fatalf("Fs.OpenFiles() = %v, want README.md and go/main.go", open)
+	}
+	if !strings.Contains(open[0].Stack, "TestFs_OpenFiles") || open[0].Opened.IsZero() {
+		t.Errorf("Fs.OpenFiles() = %v, want the time and the stack of the test", open[0])
+	}
+
+	if err := readme.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if open := fs.OpenFiles(); len(open) != 1 || open[0].Path != "go/main.go" {
+		t.Errorf("Fs.OpenFiles() after Close = %v, want go/main.go", open)
+	}
+
+	// Closing twice does not change anything.
+	_ = readme.Close()
+	_ = main.Close()
+	if open := fs.OpenFiles(); len(open) != 0 {
+		t.Errorf("Fs.OpenFiles() after closing all files = %v, want none", open)
+	}
+}
+
+func TestOptions_MaxOpenFiles(t *testing.T) {
+	fs, err := NewWithOptions(testingCopy(t, fat16), Options{MaxOpenFiles: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Helpers which open files internally have to close them again.
+	if _, err := afero.ReadFile(fs, "README.md"); err != nil {
+		t.Fatal(err)
+	}
+	if err := afero.Walk(fs, ".", func(string, os.FileInfo, error) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := fs.Open("README.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Create("new.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := fs.Open("go/main.go"); !errors.Is(err, ErrTooManyOpenFiles) {
+		t.Errorf("Fs.Open() of a third file error = %v, want %v", err, ErrTooManyOpenFiles)
+	}
+	if _, err := fs.Create("other.txt"); !errors.Is(err, ErrTooManyOpenFiles) {
+		t.Errorf("Fs.Create() of a third file error = %v, want %v", err, ErrTooManyOpenFiles)
+	}
+	if exists, _ := fs.Exists("other.txt"); exists {
+		t.Errorf("Fs.Create() created the file although too many files are open")
+	}
+	if _, err := fs.Stat("go/main.go"); err != nil {
+		t.Errorf("Fs.Stat() while too many files are open error = %v", err)
+	}
+
+	_ = first.Close()
+	if _, err := fs.Open("go/main.go"); err != nil {
+		t.Errorf("Fs.Open() after closing a file error = %v", err)
+	}
+}
+
+func TestFs_Leaks(t *testing.T) {
+	fs, err := NewWithOptions(testFileReader(fat16), Options{TrackOpenFiles: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	func() {
+		if _, err := fs.Open("go/main.go"); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	closed, err := fs.Open("README.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = closed.Close()
+
+	// The finalizers run in their own goroutine after the garbage collection.
+	var leaks []OpenHandle
+	for i := 0; i < 100 && len(leaks) == 0; i++ {
+		runtime.GC()
+		time.Sleep(time.Millisecond)
+		leaks = fs.Leaks()
+	}
+
+	if len(leaks) != 1 || leaks[0].Path != "go/main.go" || !strings.Contains(leaks[0].Stack, "TestFs_Leaks") {
+		t.Fatalf("Fs.Leaks() = %v, want go/main.go opened by the test", leaks)
+	}
+	if open := fs.OpenFiles(); len(open) != 0 {
+		t.Errorf("Fs.OpenFiles() = %v, want the leaked file to be removed", open)
+	}
+}
+
+func TestFs_OpenFilesDisabled(t *testing.T) {
+	fs := testingNew(t, testFileReader(fat16))
+	file, err := fs.Open("README.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	if open := fs.OpenFiles(); open != nil {
+		t.Errorf("Fs.OpenFiles() = %v, want nil without tracking", open)
+	}
+	if leaks := fs.Leaks(); leaks != nil {
+		t.Errorf("Fs.Leaks() = %v, want nil without tracking", leaks)
+	}
+}
@@ -0,0 +1,86 @@
+package gofat
+
+import (
+	"fmt"
+	"io"
+	"syscall"
+
+	"github.com/aligator/gofat/checkpoint"
+)
+
+// Head returns the first n bytes of the file at the given path, or the whole file if it is smaller,
+// e.g. to detect the file type or to show a preview.
+// Only the clusters containing these bytes are read, the rest of the cluster chain is never followed.
+// It returns an empty slice if n <= 0.
+func (f *Fs) Head(name string, n int64) ([]byte, error) {
+	path, err := cleanPath(name)
+	if err != nil {
+		return nil, checkpoint.Wrap(err, ErrReadFile)
+	}
+
+	ref, err := f.resolve(path)
+	if err != nil {
+		return nil, checkpoint.Wrap(err, ErrReadFile)
+	}
+
+	if ref.isDir() {
+		return nil, checkpoint.Wrap(syscall.EISDIR, fmt.Errorf("%w: %v", ErrReadFile, path))
+	}
+
+	size := int64(ref.FileSize)
+	if n < size {
+		size = n
+	}
+	if size <= 0 {
+		// readFileAt would read the whole file.
+		return []byte{}, nil
+	}
+
+	data, err := f.readFileAt(ref.firstCluster(), nil, int64(ref.FileSize), 0, size)
+	if err != nil && err != io.EOF {
+		return nil, checkpoint.Wrap(err, fmt.Errorf("%w: %v", ErrReadFile, path))
+	}
+
+	return data, nil
+}
+
+// Tail returns the last n bytes of the file at the given path, or the whole file if it is smaller,
+// e.g. to show the newest lines of a log file.
+// Only the FAT is followed to find the cluster containing the start of these bytes,
+// the data of all clusters in front of it is never read. The chain is cached until the filesystem changes,
+// so following calls for the same file do not need to follow the FAT again.
+// It returns an empty slice if n <= 0.
+func (f *Fs) Tail(name string, n int64) ([]byte, error) {
+	path, err := cleanPath(name)
+	if err != nil {
+		return nil, checkpoint.Wrap(err, ErrReadFile)
+	}
+
+	ref, err := f.resolve(path)
+	if err != nil {
+		return nil, checkpoint.Wrap(err, ErrReadFile)
+	}
+
+	if ref.isDir() {
+		return nil, checkpoint.Wrap(syscall.EISDIR, fmt.Errorf("%w: %v", ErrReadFile, path))
+	}
+
+	fileSize := int64(ref.FileSize)
+	size := fileSize
+	if n < size {
+		size = n
+	}
+	if size <= 0 {
+		// readFileAt would read the whole file.
+		return []byte{}, nil
+	}
+
+	// The cached index makes seeking to the tail a lookup if the chain was already followed before.
+	first := ref.firstCluster()
+	data, err := f.readFileAt(first, f.chains.index(first), fileSize, fileSize-size, size)
+	if err != nil && err != io.EOF {
+		return nil, checkpoint.Wrap(err, fmt.Errorf("%w: %v", ErrReadFile, path))
+	}
+
+	return data, nil
+}
@@ -0,0 +1,150 @@
+package gofat
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestFs_Head(t *testing.T) {
+	fs := testingFormat(t, FormatOptions{Size: 32 * 1024 * 1024})
+	clusterSize := int64(fs.clusterSize())
+	data := testData(int(clusterSize) * 100)
+	if err := afero.WriteFile(fs, "big", data, 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Mkdir("dir", 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		path string
+		n    int64
+		want []byte
+		// wantLookups is the maximum count of FAT lookups, which shows that the chain is not followed to its end.
+		wantLookups uint64
+		wantErr     error
+	}{
+		{name: "first cluster", path: "big", n: 16, want: data[:16], wantLookups: 0},
+		{name: "two clusters", path: "big", n: clusterSize + 1, want: data[:clusterSize+1], wantLookups: 1},
+		{name: "more than the file", path: "big", n: int64(len(data)) * 2, want: data, wantLookups: 100},
+		{name: "nothing", path: "big", n: 0, want: []byte{}},
+		{name: "directory", path: "dir", n: 16, wantErr: syscall.EISDIR},
+		{name: "missing", path: "missing", n: 16, wantErr: os.ErrNotExist},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs.ResetStats()
+			got, err := fs.Head(tt.path, tt.n)
+			if !errors.Is(err, tt.wantErr) || (err != nil) != (tt.wantErr != nil) {
+				t.Fatalf("Fs.Head() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("Fs.Head() returned %d bytes, want %d", len(got), len(tt.want))
+			}
+			if lookups := fs.Stats().FatLookups; lookups > tt.wantLookups {
+				t.Errorf("Fs.Head() looked up %d FAT entries, want at most %d", lookups, tt.wantLookups)
+			}
+		})
+	}
+}
+
+func TestFs_Tail(t *testing.T) {
+	fs := testingFormat(t, FormatOptions{Size: 32 * 1024 * 1024})
+	clusterSize := int64(fs.clusterSize())
+	data := testData(int(clusterSize) * 100)
+	if err := afero.WriteFile(fs, "big", data, 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Mkdir("dir", 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		path string
+		n    int64
+		want []byte
+		// wantSectors is the maximum count of sectors fetched, which shows that the data in front of the tail is skipped.
+		wantSectors uint64
+		wantErr     error
+	}{
+		{name: "last cluster", path: "big", n: 16, want: data[len(data)-16:], wantSectors: 2},
+		{name: "two clusters", path: "big", n: clusterSize + 1, want: data[int64(len(data))-clusterSize-1:], wantSectors: 8},
+		{name: "more than the file", path: "big", n: int64(len(data)) * 2, want: data, wantSectors: 400},
+		{name: "nothing", path: "big", n: 0, want: []byte{}},
+		{name: "directory", path: "dir", n: 16, wantErr: syscall.EISDIR},
+		{name: "missing", path: "missing", n: 16, wantErr: os.ErrNotExist},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs.ResetStats()
+			got, err := fs.Tail(tt.path, tt.n)
+			if !errors.Is(err, tt.wantErr) || (err != nil) != (tt.wantErr != nil) {
+				t.Fatalf("Fs.Tail() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("Fs.Tail() returned %d bytes, want %d", len(got), len(tt.want))
+			}
+			if sectors := fs.Stats().SectorsFetched; sectors > tt.wantSectors {
+				t.Errorf("Fs.Tail() read %d sectors, want at most %d", sectors, tt.wantSectors)
+			}
+		})
+	}
+}
+
+func TestFs_TailCachesChain(t *testing.T) {
+	fs := testingFormat(t, FormatOptions{Size: 32 * 1024 * 1024})
+	clusterSize := int64(fs.clusterSize())
+	data := testData(int(clusterSize) * 100)
+	if err := afero.WriteFile(fs, "log", data, 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	// The first call has to follow the whole chain once.
+	fs.ResetStats()
+	if _, err := fs.Tail("log", 16); err != nil {
+		t.Fatal(err)
+	}
+	if lookups := fs.Stats().FatLookups; lookups > 100 {
+		t.Errorf("first Fs.Tail() looked up %d FAT entries, want at most %d", lookups, 100)
+	}
+
+	fs.ResetStats()
+	got, err := fs.Tail("log", 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data[len(data)-16:]) {
+		t.Errorf("Fs.Tail() = %v, want %v", got, data[len(data)-16:])
+	}
+	if lookups := fs.Stats().FatLookups; lookups != 0 {
+		t.Errorf("second Fs.Tail() looked up %d FAT entries, want 0", lookups)
+	}
+
+	// Appending changes the chain, so the cached one must not be used anymore.
+	file, err := fs.OpenFile("log", os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	appended := bytes.Repeat([]byte{'x'}, int(clusterSize))
+	if _, err := file.Write(appended); err != nil {
+		t.Fatal(err)
+	}
+	if err := file.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err = fs.Tail("log", 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, appended[:16]) {
+		t.Errorf("Fs.Tail() after appending = %v, want %v", got, appended[:16])
+	}
+}
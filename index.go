@@ -0,0 +1,163 @@
+package gofat
+
+import (
+	"strings"
+	"sync"
+)
+
+// DefaultIndexSize is the count of directories which are indexed if no other size is configured.
+const DefaultIndexSize = 64
+
+// listedSize is the count of listed directories which are kept until one of their entries is looked up.
+const listedSize = 8
+
+// dirIndex maps the case-folded names of the entries of recently used directories to their entries.
+// It allows resolving paths without scanning big directories again and again.
+// All changes of the filesystem drop the whole index, so it never contains outdated entries.
+// It is safe for concurrent use.
+type dirIndex struct {
+	lock sync.Mutex
+	size int
+	// dirs contains the entries by name for each indexed directory, identified by its first cluster.
+	dirs map[fatEntry]map[string]entryRef
+	// listed contains the entries of recently listed directories. Listings are often followed by a Stat or Open
+	// of most entries (e.g. by afero.Walk), so the first lookup moves them into the index instead of reading
+	// the directory again.
+	listed map[fatEntry][]entryRef
+}
+
+// newDirIndex creates an index which holds up to size directories. A size < 1 is treated as 1.
+func newDirIndex(size int) *dirIndex {
+	if size < 1 {
+		size = 1
+	}
+
+	return &dirIndex{
+		size:   size,
+		dirs:   make(map[fatEntry]map[string]entryRef),
+		listed: make(map[fatEntry][]entryRef),
+	}
+}
+
+// indexName converts the name into the key used by the index.
+// It has to match the same names as matchName.
+func indexName(name string) string {
+	return strings.ToUpper(strings.Trim(name, " "))
+}
+
+// lookup returns the entry with the given name inside of the directory.
+// indexed is false if the directory is not part of the index.
+func (i *dirIndex) lookup(dirCluster fatEntry, name string) (ref entryRef, found bool, indexed bool) {
+	if i == nil {
+		return entryRef{}, false, false
+	}
+
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	entries, indexed := i.dirs[dirCluster]
+	if !indexed {
+		refs, listed := i.listed[dirCluster]
+		if !listed {
+			return entryRef{}, false, false
+		}
+
+		delete(i.listed, dirCluster)
+		entries = i.addLocked(dirCluster, refs)
+	}
+
+	ref, found = entries[strings.ToUpper(name)]
+	return ref, found, true
+}
+
+// add indexes the entries of the directory.
+// If the index is full, it gets dropped completely to keep it simple.
+func (i *dirIndex) add(dirCluster fatEntry, refs []entryRef) {
+	if i == nil {
+		return
+	}
+
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	i.addLocked(dirCluster, refs)
+}
+
+// addLocked works like add and returns the indexed entries. The lock has to be held.
+func (i *dirIndex) addLocked(dirCluster fatEntry, refs []entryRef) map[string]entryRef {
+	entries := make(map[string]entryRef, len(refs))
+	for _, ref := range refs {
+		// Keep the first matching entry, just like a linear search would do.
+		name := indexName(ref.FileInfo().Name())
+		if _, ok := entries[name]; !ok {
+			entries[name] = ref
+		}
+	}
+
+	if len(i.dirs) >= i.size {
+		i.dirs = make(map[fatEntry]map[string]entryRef)
+	}
+
+	i.dirs[dirCluster] = entries
+	return entries
+}
+
+// list remembers the entries of a listed directory until one of them is looked up, see dirIndex.listed.
+// Indexed directories are not remembered again.
+func (i *dirIndex) list(dirCluster fatEntry, refs []entryRef) {
+	if i == nil {
+		return
+	}
+
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	if _, indexed := i.dirs[dirCluster]; indexed {
+		return
+	}
+
+	if len(i.listed) >= listedSize {
+		i.listed = make(map[fatEntry][]entryRef)
+	}
+	i.listed[dirCluster] = refs
+}
+
+// clear drops the whole index.
+func (i *dirIndex) clear() {
+	if i == nil {
+		return
+	}
+
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	if len(i.dirs) > 0 {
+		i.dirs = make(map[fatEntry]map[string]entryRef)
+	}
+	if len(i.listed) > 0 {
+		i.listed = make(map[fatEntry][]entryRef)
+	}
+}
+
+// lookupEntry searches the entry with the given name inside of the directory starting at dirCluster.
+// The directory is read and indexed only if it is not indexed yet.
+func (f *Fs) lookupEntry(dirCluster fatEntry, name string) (entryRef, bool, error) {
+	if ref, found, indexed := f.dirIndex.lookup(dirCluster, name); indexed {
+		return ref, found, nil
+	}
+
+	refs, err := f.readDirRefs(dirCluster)
+	if err != nil {
+		return entryRef{}, false, err
+	}
+
+	f.dirIndex.add(dirCluster, refs)
+
+	for _, ref := range refs {
+		if f.match(ref.FileInfo().Name(), name) {
+			return ref, true, nil
+		}
+	}
+
+	return entryRef{}, false, nil
+}
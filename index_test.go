@@ -0,0 +1,141 @@
+package gofat
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestFs_lookupEntry(t *testing.T) {
+	// Use a sector cache of size 1, so that only the index can avoid reading the directory again.
+	stat := func(indexSize int) int {
+		reader := &countingReader{ReadSeeker: testFileReader(fat32)}
+		fs, err := NewWithOptions(reader, Options{CacheSize: 1, IndexSize: indexSize})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := fs.Stat("README.md"); err != nil {
+			t.Fatal(err)
+		}
+
+		reader.reads = 0
+		if _, err := fs.Stat("readme.MD"); err != nil {
+			t.Fatal(err)
+		}
+		return reader.reads
+	}
+
+	if reads := stat(0); reads != 0 {
+		t.Errorf("Stat() with index needed %v reads, want 0", reads)
+	}
+	if reads := stat(-1); reads == 0 {
+		t.Errorf("Stat() without index needed no reads")
+	}
+}
+
+func TestFs_lookupEntryAfterWrite(t *testing.T) {
+	fs := testingFormat(t, FormatOptions{Size: 32 * 1024 * 1024})
+
+	// Index the root directory while the file does not exist.
+	if _, err := fs.Stat("file"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("Stat() error = %v, want %v", err, os.ErrNotExist)
+	}
+
+	if _, err := fs.Create("file"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Stat("FILE"); err != nil {
+		t.Errorf("Stat() after create error = %v", err)
+	}
+
+	if err := fs.Remove("file"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Stat("file"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Stat() after remove error = %v, want %v", err, os.ErrNotExist)
+	}
+}
+
+func TestFs_WalkReadsOnce(t *testing.T) {
+	counter := dirParseCounter{testTracer: newTestTracer(), parsed: make(map[uint32]int)}
+	fs, err := NewWithOptions(testFileReader(fat16), Options{Tracer: counter})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// afero.Walk lists each directory and then stats all of its entries.
+	dirs := 0
+	err = afero.Walk(fs, ".", func(path string, info os.FileInfo, err error) error {
+		if info != nil && info.IsDir() {
+			dirs++
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(counter.parsed) != dirs {
+		t.Errorf("afero.Walk() read the directories %v, want all %v directories", counter.parsed, dirs)
+	}
+	for cluster, count := range counter.parsed {
+		if count != 1 {
+			t.Errorf("afero.Walk() read the directory at cluster %v %v times, want once", cluster, count)
+		}
+	}
+}
+
+func Test_dirIndex(t *testing.T) {
+	index := newDirIndex(2)
+
+	ref := entryRef{ExtendedEntryHeader: ExtendedEntryHeader{ExtendedName: "Some File.txt"}}
+	index.add(5, []entryRef{ref})
+
+	if got, found, indexed := index.lookup(5, "some file.TXT"); !found || !indexed || got.ExtendedName != ref.ExtendedName {
+		t.Errorf("dirIndex.lookup() = %v, %v, %v, want the entry", got, found, indexed)
+	}
+	if _, found, indexed := index.lookup(5, "other"); found || !indexed {
+		t.Errorf("dirIndex.lookup() of a missing name = %v, %v, want false, true", found, indexed)
+	}
+	if _, _, indexed := index.lookup(6, "some file.txt"); indexed {
+		t.Errorf("dirIndex.lookup() of another directory reports it as indexed")
+	}
+
+	// A full index gets dropped.
+	index.add(6, nil)
+	index.add(7, nil)
+	if _, _, indexed := index.lookup(5, "some file.txt"); indexed {
+		t.Errorf("dirIndex.lookup() still contains a directory of the full index")
+	}
+	if _, _, indexed := index.lookup(7, "some file.txt"); !indexed {
+		t.Errorf("dirIndex.lookup() does not contain the last added directory")
+	}
+
+	// A listed directory gets indexed by the first lookup.
+	index.list(8, []entryRef{ref})
+	if got, found, indexed := index.lookup(8, "SOME FILE.TXT"); !found || !indexed || got.ExtendedName != ref.ExtendedName {
+		t.Errorf("dirIndex.lookup() of a listed directory = %v, %v, %v, want the entry", got, found, indexed)
+	}
+	if _, ok := index.listed[8]; ok {
+		t.Errorf("dirIndex.lookup() kept the listing of an indexed directory")
+	}
+
+	index.list(9, []entryRef{ref})
+	index.clear()
+	if _, _, indexed := index.lookup(8, "some file.txt"); indexed {
+		t.Errorf("dirIndex.lookup() still contains a directory after clear")
+	}
+	if _, _, indexed := index.lookup(9, "some file.txt"); indexed {
+		t.Errorf("dirIndex.lookup() still contains a listed directory after clear")
+	}
+
+	// A nil index indexes nothing.
+	var disabled *dirIndex
+	disabled.add(5, []entryRef{ref})
+	if _, _, indexed := disabled.lookup(5, "some file.txt"); indexed {
+		t.Errorf("nil dirIndex.lookup() reports a directory as indexed")
+	}
+}
@@ -0,0 +1,71 @@
+package gofat
+
+import (
+	"sync"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// internSize is the count of distinct names which are interned before the interner starts over.
+const internSize = 64 * 1024
+
+// nameInterner deduplicates the long names decoded while parsing directories.
+// Big images repeat the same names (e.g. extensions, "src" or ".git") a lot, so sharing the strings keeps
+// the heap small if many entries are kept, e.g. by the index or by Walk.
+// It is shared by all copies of the Fs and safe for concurrent use.
+type nameInterner struct {
+	lock  sync.Mutex
+	names map[string]string
+}
+
+func newNameInterner() *nameInterner {
+	return &nameInterner{names: make(map[string]string)}
+}
+
+// intern returns the string for the UTF-8 encoded name. Known names are returned without allocating.
+// If the interner is full, it gets dropped completely to keep it simple.
+func (n *nameInterner) intern(name []byte) string {
+	if n == nil {
+		return string(name)
+	}
+
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	if s, ok := n.names[string(name)]; ok {
+		return s
+	}
+
+	if len(n.names) >= internSize {
+		n.names = make(map[string]string)
+	}
+
+	s := string(name)
+	n.names[s] = s
+	return s
+}
+
+// decodeLongName converts the UTF-16 characters of a long filename into a string.
+// The name ends at the first 0 character. Surrogate pairs are combined, single surrogates are replaced with
+// utf8.RuneError.
+func (n *nameInterner) decodeLongName(chars []uint16, buffer []byte) (string, []byte) {
+	buffer = buffer[:0]
+	var encoded [utf8.UTFMax]byte
+	for i := 0; i < len(chars) && chars[i] != 0; i++ {
+		char := rune(chars[i])
+		if utf16.IsSurrogate(char) {
+			char = utf8.RuneError
+			if i+1 < len(chars) {
+				if decoded := utf16.DecodeRune(rune(chars[i]), rune(chars[i+1])); decoded != utf8.RuneError {
+					char = decoded
+					i++
+				}
+			}
+		}
+
+		size := utf8.EncodeRune(encoded[:], char)
+		buffer = append(buffer, encoded[:size]...)
+	}
+
+	return n.intern(buffer), buffer
+}
@@ -0,0 +1,71 @@
+package gofat
+
+import (
+	"testing"
+	"unicode/utf16"
+)
+
+func Test_nameInterner_decodeLongName(t *testing.T) {
+	tests := []struct {
+		name  string
+		chars []uint16
+		want  string
+	}{
+		{name: "ascii", chars: utf16.Encode([]rune("Some File.txt")), want: "Some File.txt"},
+		{name: "ends at 0", chars: append(utf16.Encode([]rune("a.go")), 0, 0xFFFF, 0xFFFF), want: "a.go"},
+		{name: "non ascii", chars: utf16.Encode([]rune("Grüße€")), want: "Grüße€"},
+		{name: "surrogate pair", chars: []uint16{'x', 0xD83D, 0xDE00}, want: "x😀"},
+		{name: "single surrogates", chars: []uint16{'x', 0xDE00, 0xD83D, 'y', 0xD83D}, want: "x��y�"},
+		{name: "empty", chars: []uint16{0}, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, n := range []*nameInterner{newNameInterner(), nil} {
+				if got, _ := n.decodeLongName(tt.chars, nil); got != tt.want {
+					t.Errorf("nameInterner.decodeLongName() = %q, want %q", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func Test_nameInterner_intern(t *testing.T) {
+	n := newNameInterner()
+	name := []byte("index.html")
+	n.intern(name)
+
+	// Known names are shared instead of allocated again.
+	if allocs := testing.AllocsPerRun(100, func() { n.intern(name) }); allocs != 0 {
+		t.Errorf("nameInterner.intern() of a known name allocated %v times, want 0", allocs)
+	}
+	if got := n.intern([]byte("other")); got != "other" {
+		t.Errorf("nameInterner.intern() = %q, want %q", got, "other")
+	}
+
+	// A full interner gets dropped.
+	for i := 0; len(n.names) < internSize; i++ {
+		n.intern([]byte{byte(i), byte(i >> 8), byte(i >> 16)})
+	}
+	n.intern([]byte("new"))
+	if len(n.names) != 1 {
+		t.Errorf("full nameInterner contains %v names after intern(), want 1", len(n.names))
+	}
+}
+
+func TestFs_internedNames(t *testing.T) {
+	fs := testingNew(t, testFileReader(fat16))
+	readRoot := func() {
+		if _, err := fs.readDir(0); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	readRoot()
+	interned := testing.AllocsPerRun(10, readRoot)
+	fs.names = nil
+	notInterned := testing.AllocsPerRun(10, readRoot)
+
+	if interned >= notInterned {
+		t.Errorf("Fs.readDir() allocated %v times with interned names, want less than %v", interned, notInterned)
+	}
+}
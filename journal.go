@@ -0,0 +1,159 @@
+package gofat
+
+import "sort"
+
+// MutationOp is the kind of operation of a Mutation.
+type MutationOp string
+
+const (
+	// OpCreate creates a file.
+	OpCreate MutationOp = "create"
+	// OpMkdir creates a directory.
+	OpMkdir MutationOp = "mkdir"
+	// OpWrite writes into a file.
+	OpWrite MutationOp = "write"
+	// OpTruncate changes the size of a file.
+	OpTruncate MutationOp = "truncate"
+	// OpRemove removes a file or directory.
+	OpRemove MutationOp = "remove"
+	// OpRename moves a file or directory to the Target.
+	OpRename MutationOp = "rename"
+	// OpChange changes the attributes or times of a file or directory.
+	OpChange MutationOp = "change"
+	// OpCopy copies a file or directory to the Target.
+	OpCopy MutationOp = "copy"
+	// OpLabel changes the label or the volume ID of the filesystem.
+	OpLabel MutationOp = "label"
+	// OpShrink shrinks the filesystem.
+	OpShrink MutationOp = "shrink"
+	// OpSanitize wipes deleted entries, free clusters and slack space.
+	OpSanitize MutationOp = "sanitize"
+)
+
+// Mutation is one modifying operation recorded in the journal, see Fs.Changes.
+type Mutation struct {
+	Op MutationOp `json:"op"`
+	// Path which was changed. It is empty for operations on the whole filesystem.
+	Path string `json:"path,omitempty"`
+	// Target is the destination of OpRename and OpCopy.
+	Target string `json:"target,omitempty"`
+	// Clusters of the data region which were written or whose FAT entries were changed, sorted ascending.
+	Clusters []uint32 `json:"clusters"`
+	// Failed is true if the operation returned an error after it already changed something.
+	Failed bool `json:"failed,omitempty"`
+}
+
+// journal records all mutations of a filesystem. It is shared by all copies of the Fs.
+// It is only accessed while holding the writeLock.
+type journal struct {
+	mutations []Mutation
+	// running is the mutation which is currently running.
+	running Mutation
+	// touched collects the clusters changed by the running mutation. It is nil if no mutation runs.
+	touched map[uint32]bool
+	// written is true if the running mutation wrote anything.
+	written bool
+}
+
+// begin starts collecting the changes of the mutation.
+func (j *journal) begin(mutation Mutation) {
+	if j == nil {
+		return
+	}
+
+	j.running = mutation
+	j.touched = make(map[uint32]bool)
+	j.written = false
+}
+
+// retype changes the operation of the running mutation, if it turns out to be a different one than expected.
+func (j *journal) retype(op MutationOp) {
+	if j == nil {
+		return
+	}
+
+	j.running.Op = op
+}
+
+// touch marks the cluster as changed by the running mutation.
+func (j *journal) touch(cluster uint32) {
+	if j == nil || j.touched == nil {
+		return
+	}
+
+	j.touched[cluster] = true
+}
+
+// write notes that the running mutation wrote something.
+func (j *journal) write() {
+	if j == nil || j.touched == nil {
+		return
+	}
+
+	j.written = true
+}
+
+// end records the running mutation if it wrote anything.
+// Consecutive mutations with the same operation and paths are merged, e.g. the many writes of a single copy.
+func (j *journal) end(err error) {
+	if j == nil {
+		return
+	}
+
+	mutation, touched, written := j.running, j.touched, j.written
+	j.touched = nil
+	if !written {
+		return
+	}
+
+	mutation.Failed = err != nil
+	if last := len(j.mutations) - 1; last >= 0 {
+		previous := &j.mutations[last]
+		if previous.Op == mutation.Op && previous.Path == mutation.Path && previous.Target == mutation.Target && !previous.Failed {
+			for _, cluster := range previous.Clusters {
+				touched[cluster] = true
+			}
+			j.mutations = j.mutations[:last]
+		}
+	}
+
+	mutation.Clusters = make([]uint32, 0, len(touched))
+	for cluster := range touched {
+		mutation.Clusters = append(mutation.Clusters, cluster)
+	}
+	sort.Slice(mutation.Clusters, func(i, j int) bool {
+		return mutation.Clusters[i] < mutation.Clusters[j]
+	})
+
+	j.mutations = append(j.mutations, mutation)
+}
+
+// list returns a copy of all recorded mutations.
+func (j *journal) list() []Mutation {
+	if j == nil {
+		return []Mutation{}
+	}
+
+	mutations := make([]Mutation, len(j.mutations))
+	copy(mutations, j.mutations)
+	return mutations
+}
+
+// touchSectors marks the clusters containing the written sectors as changed by the running mutation.
+func (f *Fs) touchSectors(sector uint32, count uint32) {
+	f.journal.write()
+	if count == 0 || sector+count <= f.info.FirstDataSector {
+		return
+	}
+
+	if sector < f.info.FirstDataSector {
+		count -= f.info.FirstDataSector - sector
+		sector = f.info.FirstDataSector
+	}
+
+	first := (sector-f.info.FirstDataSector)/uint32(f.info.SectorsPerCluster) + 2
+	last := (sector+count-1-f.info.FirstDataSector)/uint32(f.info.SectorsPerCluster) + 2
+	for cluster := first; cluster <= last; cluster++ {
+		f.journal.touch(cluster)
+	}
+}
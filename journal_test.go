@@ -0,0 +1,133 @@
+package gofat
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+func TestFs_Changes(t *testing.T) {
+	tests := []struct {
+		name string
+		do   func(fs *Fs) error
+		want []Mutation
+	}{
+		{
+			name: "mkdir",
+			do: func(fs *Fs) error {
+				return fs.MkdirAll("new/sub", 0777)
+			},
+			want: []Mutation{
+				{Op: OpMkdir, Path: "new/sub", Clusters: []uint32{2, 7}},
+			},
+		},
+		{
+			name: "write a new file in several writes",
+			do: func(fs *Fs) error {
+				file, err := fs.Create("go/new.txt")
+				if err != nil {
+					return err
+				}
+				defer file.Close()
+
+				if _, err := file.Write(testData(2048)); err != nil {
+					return err
+				}
+				_, err = file.Write(testData(2048))
+				return err
+			},
+			want: []Mutation{
+				{Op: OpCreate, Path: "go/new.txt", Clusters: []uint32{3}},
+				{Op: OpWrite, Path: "go/new.txt", Clusters: []uint32{2, 3, 7}},
+			},
+		},
+		{
+			name: "create an existing file",
+			do: func(fs *Fs) error {
+				_, err := fs.Create("DoNotEdit_tests/README.md")
+				return err
+			},
+			want: []Mutation{
+				{Op: OpTruncate, Path: "DoNotEdit_tests/README.md", Clusters: []uint32{4, 6, 8, 9, 10, 11, 12}},
+			},
+		},
+		{
+			name: "rename and change",
+			do: func(fs *Fs) error {
+				if err := fs.Rename("README.md", "go/README.md"); err != nil {
+					return err
+				}
+				return fs.Chtimes("go/README.md", time.Now(), time.Now())
+			},
+			want: []Mutation{
+				{Op: OpRename, Path: "README.md", Target: "go/README.md", Clusters: []uint32{3}},
+				{Op: OpChange, Path: "go/README.md", Clusters: []uint32{3}},
+			},
+		},
+		{
+			name: "remove and label",
+			do: func(fs *Fs) error {
+				if err := fs.Remove("go/main.go"); err != nil {
+					return err
+				}
+				return fs.SetLabel("CHANGED")
+			},
+			want: []Mutation{
+				{Op: OpRemove, Path: "go/main.go", Clusters: []uint32{3, 5}},
+				{Op: OpLabel, Clusters: []uint32{}},
+			},
+		},
+		{
+			name: "nothing written",
+			do: func(fs *Fs) error {
+				file, err := fs.OpenFile("README.md", os.O_RDWR, 0)
+				if err != nil {
+					return err
+				}
+				if err := file.Close(); err != nil {
+					return err
+				}
+
+				// Failing operations which did not change anything are not recorded.
+				_ = fs.Remove("missing.txt")
+				return nil
+			},
+			want: []Mutation{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := testingNew(t, testingCopy(t, fat16))
+			if err := tt.do(fs); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := fs.Changes()
+			if err != nil {
+				t.Fatalf("Fs.Changes() error = %v", err)
+			}
+			if !reflect.DeepEqual(got.Journal, tt.want) {
+				t.Errorf("Fs.Changes() journal = %+v, want %+v", got.Journal, tt.want)
+			}
+		})
+	}
+}
+
+func TestFs_ChangesShared(t *testing.T) {
+	fs := testingNew(t, testingCopy(t, fat16))
+	if err := afero.WriteFile(fs.WithContext(context.Background()), "new.txt", testData(10), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := fs.Changes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Journal) != 2 || got.Journal[0].Op != OpCreate || got.Journal[1].Op != OpWrite {
+		t.Errorf("Fs.Changes() journal = %+v, want the create and write of the copy", got.Journal)
+	}
+}
@@ -0,0 +1,131 @@
+package gofat
+
+import (
+	"encoding/binary"
+
+	"github.com/aligator/gofat/checkpoint"
+)
+
+// Offsets of the volume label and the volume ID inside of the boot sector.
+const (
+	fat16LabelOffset    = 43
+	fat32LabelOffset    = 71
+	fat16VolumeIDOffset = 39
+	fat32VolumeIDOffset = 67
+)
+
+// VolumeID returns the serial number of the volume.
+func (f *Fs) VolumeID() uint32 {
+	if f.info.FSType == FAT32 {
+		return f.info.fat32Specific.BSVolumeID
+	}
+	return f.info.fat16Specific.BSVolumeId
+}
+
+// SetVolumeID changes the serial number of the volume in the boot sector (and its FAT32 backup).
+func (f *Fs) SetVolumeID(id uint32) error {
+	err := f.mutate(Mutation{Op: OpLabel}, func() error {
+		offset := fat16VolumeIDOffset
+		if f.info.FSType == FAT32 {
+			offset = fat32VolumeIDOffset
+		}
+
+		err := f.updateBootSectors(func(buffer []byte) {
+			binary.LittleEndian.PutUint32(buffer[offset:], id)
+		})
+		if err != nil {
+			return err
+		}
+
+		f.info.fat16Specific.BSVolumeId = id
+		f.info.fat32Specific.BSVolumeID = id
+		return nil
+	})
+	return checkpoint.Wrap(err, ErrWriteFilesystem)
+}
+
+// SetLabel changes the volume label in the boot sector (and its FAT32 backup) and in the label entry of the
+// root directory. Like Format, it converts the label to upper case and an empty label results in "NO NAME".
+// If the root directory has no label entry and no free slot for it, only the boot sector is changed.
+func (f *Fs) SetLabel(label string) error {
+	name, err := formatLabel(label)
+	if err != nil {
+		return checkpoint.Wrap(checkpoint.From(err), ErrWriteFilesystem)
+	}
+
+	err = f.mutate(Mutation{Op: OpLabel}, func() error {
+		offset := fat16LabelOffset
+		if f.info.FSType == FAT32 {
+			offset = fat32LabelOffset
+		}
+
+		err := f.updateBootSectors(func(buffer []byte) {
+			copy(buffer[offset:], name[:])
+		})
+		if err != nil {
+			return err
+		}
+
+		f.info.Label = string(name[:])
+		f.info.fat16Specific.BSVolumeLabel = name
+		f.info.fat32Specific.BSVolumeLabel = name
+
+		return f.setLabelEntry(name, label == "")
+	})
+	return checkpoint.Wrap(err, ErrWriteFilesystem)
+}
+
+// setLabelEntry writes the name into the volume label entry of the root directory.
+// If remove is set, the entry is removed instead. A missing entry is added into the first free slot.
+func (f *Fs) setLabelEntry(name [11]byte, remove bool) error {
+	data, sectors, err := f.readDirSlots(0)
+	if err != nil {
+		return err
+	}
+
+	free := -1
+	for i := 0; i < len(data)/entrySize; i++ {
+		slot := data[i*entrySize : (i+1)*entrySize]
+		if slot[0] == 0x00 {
+			if free < 0 {
+				free = i
+			}
+			break
+		}
+
+		if slot[0] == 0xE5 {
+			if free < 0 {
+				free = i
+			}
+			continue
+		}
+
+		attribute := slot[11]
+		if attribute&AttrLongName != AttrLongName && attribute&AttrVolumeId == AttrVolumeId {
+			if remove {
+				return f.writeDirSlots(sectors, i, []byte{0xE5})
+			}
+			return f.writeDirSlots(sectors, i, name[:])
+		}
+	}
+
+	if remove || free < 0 {
+		return nil
+	}
+
+	header := newEntryHeader(AttrVolumeId, f.clock.Now())
+	header.Name = name
+	header.CreateTimeTenth = 0
+	header.CreateTime = 0
+	header.CreateDate = 0
+	header.LastAccessDate = 0
+	slots := encodeEntry(header)
+
+	// If the entry replaces the end marker, the slot after it must be an end marker again.
+	next := (free + 1) * entrySize
+	if data[free*entrySize] == 0x00 && next < len(data) && data[next] != 0x00 {
+		slots = append(slots, make([]byte, entrySize)...)
+	}
+
+	return f.writeDirSlots(sectors, free, slots)
+}
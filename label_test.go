@@ -0,0 +1,108 @@
+package gofat
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+// labelEntries returns the names of all volume label entries in the root directory.
+func labelEntries(t *testing.T, fs *Fs) []string {
+	data, _, err := fs.readDirSlots(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var labels []string
+	for i := 0; i < len(data)/entrySize && data[i*entrySize] != 0x00; i++ {
+		slot := data[i*entrySize : (i+1)*entrySize]
+		if slot[0] != 0xE5 && slot[11]&AttrLongName != AttrLongName && slot[11]&AttrVolumeId == AttrVolumeId {
+			labels = append(labels, string(bytes.TrimRight(slot[:11], " ")))
+		}
+	}
+	return labels
+}
+
+func TestFs_SetLabel(t *testing.T) {
+	tests := []struct {
+		name      string
+		opts      FormatOptions
+		label     string
+		wantLabel string
+		wantEntry []string
+		wantErr   error
+	}{
+		{
+			name:      "add to FAT16",
+			opts:      FormatOptions{Size: 16 * 1024 * 1024},
+			label:     "boot",
+			wantLabel: "BOOT",
+			wantEntry: []string{"BOOT"},
+		},
+		{
+			name:      "change on FAT32",
+			opts:      FormatOptions{Size: 128 * 1024 * 1024, FSType: FAT32, Label: "OLD"},
+			label:     "New Label",
+			wantLabel: "NEW LABEL",
+			wantEntry: []string{"NEW LABEL"},
+		},
+		{
+			name:      "remove",
+			opts:      FormatOptions{Size: 16 * 1024 * 1024, Label: "OLD"},
+			label:     "",
+			wantLabel: "NO NAME",
+		},
+		{
+			name:    "too long",
+			opts:    FormatOptions{Size: 16 * 1024 * 1024},
+			label:   "a very long label",
+			wantErr: ErrInvalidPath,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			image := testingImage(t)
+			if err := Format(image, tt.opts); err != nil {
+				t.Fatal(err)
+			}
+			fs := testingNew(t, image)
+
+			// A file behind the label entry must stay intact.
+			if err := afero.WriteFile(fs, "file.txt", []byte("data"), 0666); err != nil {
+				t.Fatal(err)
+			}
+
+			err := fs.SetLabel(tt.label)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Fs.SetLabel() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+
+			// The label has to survive opening the filesystem again.
+			reopened := testingNew(t, image)
+			if got := reopened.Label(); got != tt.wantLabel {
+				t.Errorf("Fs.Label() = %v, want %v", got, tt.wantLabel)
+			}
+			if got := labelEntries(t, reopened); !equalStrings(got, tt.wantEntry) {
+				t.Errorf("label entries = %v, want %v", got, tt.wantEntry)
+			}
+			if got, err := afero.ReadFile(reopened, "file.txt"); err != nil || string(got) != "data" {
+				t.Errorf("afero.ReadFile() = %q, %v, want %q", got, err, "data")
+			}
+
+			if tt.opts.FSType == FAT32 {
+				backup, err := reopened.fetch(uint32(reopened.info.fat32Specific.BkBootSector))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := string(bytes.TrimRight(backup.buffer[fat32LabelOffset:fat32LabelOffset+11], " ")); got != tt.wantLabel {
+					t.Errorf("backup boot sector label = %v, want %v", got, tt.wantLabel)
+				}
+			}
+		})
+	}
+}
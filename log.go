@@ -0,0 +1,16 @@
+package gofat
+
+// Logger receives debug messages, e.g. the details of a mounted filesystem, ignored validation problems,
+// retried reads and the findings of Check.
+// The arguments after the message are alternating keys and values like log/slog uses them,
+// so a *slog.Logger can be used directly.
+type Logger interface {
+	Debug(msg string, args ...interface{})
+}
+
+// debug logs the message if a Logger is set.
+func (f *Fs) debug(msg string, args ...interface{}) {
+	if f.logger != nil {
+		f.logger.Debug(msg, args...)
+	}
+}
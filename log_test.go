@@ -0,0 +1,136 @@
+package gofat
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+// testLogger records the messages it receives.
+type testLogger struct {
+	lock     sync.Mutex
+	messages []string
+}
+
+func (l *testLogger) Debug(msg string, args ...interface{}) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.messages = append(l.messages, msg)
+}
+
+func (l *testLogger) logged(msg string) bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	for _, message := range l.messages {
+		if message == msg {
+			return true
+		}
+	}
+	return false
+}
+
+// shortReader returns at most max bytes per Read. It does not implement io.ReaderAt.
+type shortReader struct {
+	reader io.ReadSeeker
+	max    int
+}
+
+func (r shortReader) Read(p []byte) (int, error) {
+	if len(p) > r.max {
+		p = p[:r.max]
+	}
+	return r.reader.Read(p)
+}
+
+func (r shortReader) Seek(offset int64, whence int) (int64, error) {
+	return r.reader.Seek(offset, whence)
+}
+
+func TestFs_Logger(t *testing.T) {
+	invalidSignature := func(t *testing.T) io.ReadSeeker {
+		data, err := io.ReadAll(testFileReader(fat16))
+		if err != nil {
+			t.Fatal(err)
+		}
+		data[510] = 0
+		return bytes.NewReader(data)
+	}
+
+	tests := []struct {
+		name       string
+		reader     func(t *testing.T) io.ReadSeeker
+		skipChecks bool
+		want       []string
+	}{
+		{
+			name:   "mount",
+			reader: func(t *testing.T) io.ReadSeeker { return testingReadOnly(t, fat32) },
+			want:   []string{"mounted filesystem"},
+		},
+		{
+			name:       "ignored boot sector problem",
+			reader:     invalidSignature,
+			skipChecks: true,
+			want:       []string{"ignoring an invalid boot sector", "mounted filesystem"},
+		},
+		{
+			name: "short reads",
+			reader: func(t *testing.T) io.ReadSeeker {
+				return shortReader{reader: testingReadOnly(t, fat16), max: 100}
+			},
+			want: []string{"retrying a short sector read", "mounted filesystem"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := &testLogger{}
+			fs, err := NewWithOptions(tt.reader(t), Options{SkipChecks: tt.skipChecks, Logger: logger})
+			if err != nil {
+				t.Fatalf("NewWithOptions() error = %v", err)
+			}
+
+			// Reading works as without the logger.
+			got, err := afero.ReadFile(fs, "DoNotEdit_tests/README.md")
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := afero.ReadFile(testingNew(t, testingReadOnly(t, fat16)), "DoNotEdit_tests/README.md")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("afero.ReadFile() = %q, want %q", got, want)
+			}
+
+			for _, msg := range tt.want {
+				if !logger.logged(msg) {
+					t.Errorf("the logger did not receive %q, got %q", msg, logger.messages)
+				}
+			}
+		})
+	}
+}
+
+func TestFs_LoggerCheck(t *testing.T) {
+	fs := testingFormat(t, FormatOptions{Size: 16 * 1024 * 1024})
+	logger := &testLogger{}
+	fs.logger = logger
+
+	err := fs.mutate(Mutation{}, func() error {
+		return fs.setFatEntry(20, eocMarker)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := fs.Check()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.OK() || !logger.logged("check found a problem") {
+		t.Errorf("Fs.Check() findings = %v, logged %q", report.Findings, logger.messages)
+	}
+}
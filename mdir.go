@@ -0,0 +1,202 @@
+package gofat
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/aligator/gofat/checkpoint"
+)
+
+// MdirOptions configure WriteMdir.
+type MdirOptions struct {
+	// All also lists hidden entries like "mdir -a".
+	All bool
+	// Recursive lists all subdirectories after their parent like "mdir -s".
+	Recursive bool
+}
+
+// mdirEntry is a slot listed by WriteMdir.
+type mdirEntry struct {
+	header EntryHeader
+	// longName is empty if the entry has no long filename.
+	longName string
+}
+
+// WriteMdir writes the listing of the directory in the format of mdir from mtools, so that scripts comparing mdir
+// listings of an image can use gofat instead. Like mdir, the entries are listed in the order of their slots
+// including the "." and ".." entries of subdirectories, with the short name, the size, the raw modification time
+// and the long name. The image is shown as drive ":" as done by "mdir -i image ::".
+// Short names are written as they are stored, so characters above 0x7F are not converted from the OEM code page.
+func (f *Fs) WriteMdir(w io.Writer, dir string, opts MdirOptions) error {
+	dirPath, err := cleanPath(dir)
+	if err != nil {
+		return checkpoint.Wrap(err, ErrReadDir)
+	}
+
+	ref, err := f.resolve(dirPath)
+	if err != nil {
+		return checkpoint.Wrap(err, ErrReadDir)
+	}
+	if !ref.isDir() {
+		return checkpoint.Wrap(syscall.ENOTDIR, fmt.Errorf("%w: %v", ErrReadDir, dirPath))
+	}
+
+	out := bufio.NewWriter(w)
+	if label := f.Label(); label != "" && label != "NO NAME" {
+		fmt.Fprintf(out, " Volume in drive : is %s\n", label)
+	} else {
+		fmt.Fprintf(out, " Volume in drive : has no label\n")
+	}
+	fmt.Fprintf(out, " Volume Serial Number is %04X-%04X\n", f.VolumeID()>>16, f.VolumeID()&0xFFFF)
+
+	var totalFiles int
+	var totalBytes int64
+	if err := f.writeMdirDir(out, dirPath, f.entryDirCluster(ref), opts, &totalFiles, &totalBytes); err != nil {
+		return checkpoint.Wrap(err, ErrReadDir)
+	}
+
+	if opts.Recursive {
+		fmt.Fprintf(out, "\nTotal files listed:\n")
+		writeMdirSummary(out, totalFiles, totalBytes)
+	}
+
+	free, err := f.FreeClusters()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "                  %s bytes free\n\n", mdirNumber(int64(free)*f.clusterSize(), 15))
+
+	return checkpoint.From(out.Flush())
+}
+
+// writeMdirDir writes the block of a single directory and, if recursive, of its subdirectories.
+func (f *Fs) writeMdirDir(out io.Writer, dirPath string, dirCluster fatEntry, opts MdirOptions, totalFiles *int, totalBytes *int64) error {
+	entries, subdirs, err := f.mdirEntries(dirCluster, dirPath, opts)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "Directory for ::/%s\n\n", dirPath)
+
+	var bytes int64
+	for _, entry := range entries {
+		name := strings.TrimRight(string(entry.header.Name[:8]), " ")
+		ext := strings.TrimRight(string(entry.header.Name[8:]), " ")
+		fmt.Fprintf(out, "%-8s %-3s ", name, ext)
+
+		if entry.header.Attribute&AttrDirectory == AttrDirectory {
+			fmt.Fprint(out, "<DIR>    ")
+		} else {
+			fmt.Fprintf(out, " %s", mdirNumber(int64(entry.header.FileSize), 8))
+			bytes += int64(entry.header.FileSize)
+		}
+
+		date, time := entry.header.WriteDate, entry.header.WriteTime
+		fmt.Fprintf(out, " %04d-%02d-%02d  %2d:%02d ", 1980+int(date>>9), (date>>5)&0x0F, date&0x1F, time>>11, (time>>5)&0x3F)
+		if entry.longName != "" {
+			fmt.Fprintf(out, " %s", entry.longName)
+		}
+		fmt.Fprintln(out)
+	}
+
+	writeMdirSummary(out, len(entries), bytes)
+	*totalFiles += len(entries)
+	*totalBytes += bytes
+
+	if !opts.Recursive {
+		return nil
+	}
+
+	for _, subdir := range subdirs {
+		fmt.Fprintln(out)
+		err := f.writeMdirDir(out, path.Join(dirPath, subdir.FileInfo().Name()), subdir.firstCluster(), opts, totalFiles, totalBytes)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mdirEntries returns the listed entries of the directory in the order of their slots and its subdirectories.
+// The dot entries are not returned by the dirParser, so they are decoded from the slots directly.
+func (f *Fs) mdirEntries(dirCluster fatEntry, dirPath string, opts MdirOptions) ([]mdirEntry, []entryRef, error) {
+	data, _, err := f.readDirSlots(dirCluster)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	refs, err := f.parseDirRefs(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var entries []mdirEntry
+	var subdirs []entryRef
+	for i, next := 0, 0; i < len(data)/entrySize; i++ {
+		slot := data[i*entrySize : (i+1)*entrySize]
+		if slot[0] == 0x00 {
+			break
+		}
+
+		if slot[0] == '.' && slot[11]&AttrLongName != AttrLongName {
+			entries = append(entries, mdirEntry{header: decodeEntryHeader(slot)})
+			continue
+		}
+
+		if next >= len(refs) || refs[next].index != i {
+			continue
+		}
+		ref := refs[next]
+		next++
+
+		if ref.Attribute&AttrHidden == AttrHidden && !opts.All {
+			continue
+		}
+
+		entry := mdirEntry{header: ref.EntryHeader}
+		if ref.lfnCount > 0 {
+			entry.longName = ref.ExtendedName
+		}
+		entries = append(entries, entry)
+
+		if ref.isDir() {
+			subdirs = append(subdirs, ref)
+		}
+	}
+
+	return entries, subdirs, nil
+}
+
+// writeMdirSummary writes the count of entries and the sum of their sizes like mdir.
+func writeMdirSummary(out io.Writer, files int, bytes int64) {
+	if files == 0 {
+		fmt.Fprintln(out, "No files")
+		return
+	}
+
+	plural := "s"
+	if files == 1 {
+		plural = " "
+	}
+	fmt.Fprintf(out, "      %3d file%s       %s bytes\n", files, plural, mdirNumber(bytes, 13))
+}
+
+// mdirNumber formats the number right aligned with groups of three digits separated by spaces, e.g. "  1 234".
+func mdirNumber(number int64, width int) string {
+	digits := strconv.FormatInt(number, 10)
+
+	var grouped strings.Builder
+	for i, digit := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			grouped.WriteByte(' ')
+		}
+		grouped.WriteRune(digit)
+	}
+
+	return fmt.Sprintf("%*s", width, grouped.String())
+}
@@ -0,0 +1,124 @@
+package gofat
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+func TestFs_WriteMdir(t *testing.T) {
+	image := testingImage(t)
+	if err := Format(image, FormatOptions{Size: 16 * 1024 * 1024, Label: "TEST", VolumeID: 0x1234ABCD}); err != nil {
+		t.Fatal(err)
+	}
+	fs, err := NewWithOptions(image, Options{Clock: FixedClock(time.Date(2021, 1, 2, 15, 4, 6, 0, time.UTC))})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := afero.WriteFile(fs, "config.txt", testData(1234), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.MkdirAll("boot/overlays", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := afero.WriteFile(fs, "boot/Some long name.dtbo", testData(10), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := afero.WriteFile(fs, "hidden.txt", nil, 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.SetAttributes("hidden.txt", AttrHidden|AttrArchive); err != nil {
+		t.Fatal(err)
+	}
+
+	free, err := fs.FreeClusters()
+	if err != nil {
+		t.Fatal(err)
+	}
+	freeLine := "                  " + mdirNumber(int64(free)*fs.clusterSize(), 15) + " bytes free\n\n"
+
+	tests := []struct {
+		name string
+		dir  string
+		opts MdirOptions
+		want []string
+	}{
+		{
+			name: "root",
+			dir:  ".",
+			want: []string{
+				" Volume in drive : is TEST",
+				" Volume Serial Number is 1234-ABCD",
+				"Directory for ::/",
+				"",
+				"CONFIG   TXT     1 234 2021-01-02  15:04  config.txt",
+				"BOOT         <DIR>     2021-01-02  15:04  boot",
+				"        2 files               1 234 bytes",
+			},
+		},
+		{
+			name: "recursive with hidden entries",
+			dir:  "boot",
+			opts: MdirOptions{All: true, Recursive: true},
+			want: []string{
+				" Volume in drive : is TEST",
+				" Volume Serial Number is 1234-ABCD",
+				"Directory for ::/boot",
+				"",
+				".            <DIR>     2021-01-02  15:04 ",
+				"..           <DIR>     2021-01-02  15:04 ",
+				"OVERLAYS     <DIR>     2021-01-02  15:04  overlays",
+				"SOMELO~1 DTB        10 2021-01-02  15:04  Some long name.dtbo",
+				"        4 files                  10 bytes",
+				"",
+				"Directory for ::/boot/overlays",
+				"",
+				".            <DIR>     2021-01-02  15:04 ",
+				"..           <DIR>     2021-01-02  15:04 ",
+				"        2 files                   0 bytes",
+				"",
+				"Total files listed:",
+				"        6 files                  10 bytes",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buffer bytes.Buffer
+			if err := fs.WriteMdir(&buffer, tt.dir, tt.opts); err != nil {
+				t.Fatalf("Fs.WriteMdir() error = %v", err)
+			}
+
+			want := strings.Join(tt.want, "\n") + "\n" + freeLine
+			if got := buffer.String(); got != want {
+				t.Errorf("Fs.WriteMdir() =\n%q\nwant\n%q", got, want)
+			}
+		})
+	}
+
+	if err := fs.WriteMdir(&bytes.Buffer{}, "config.txt", MdirOptions{}); err == nil {
+		t.Errorf("Fs.WriteMdir() of a file succeeded")
+	}
+}
+
+func Test_mdirNumber(t *testing.T) {
+	tests := []struct {
+		number int64
+		width  int
+		want   string
+	}{
+		{number: 0, width: 8, want: "       0"},
+		{number: 999, width: 8, want: "     999"},
+		{number: 1234, width: 8, want: "   1 234"},
+		{number: 16584704, width: 15, want: "     16 584 704"},
+	}
+	for _, tt := range tests {
+		if got := mdirNumber(tt.number, tt.width); got != tt.want {
+			t.Errorf("mdirNumber(%v, %v) = %q, want %q", tt.number, tt.width, got, tt.want)
+		}
+	}
+}
@@ -75,3 +75,25 @@ type ExtendedEntryHeader struct {
 	EntryHeader
 	ExtendedName string
 }
+
+// FirstCluster returns the first cluster of the file or directory. It is 0 for empty files.
+func (h EntryHeader) FirstCluster() uint32 {
+	return h.firstCluster().Value()
+}
+
+// ShortName returns the 8.3 name as it is stored in the entry (e.g. "README.MD"), even if the entry has a long name.
+func (h EntryHeader) ShortName() string {
+	return shortNameString(h.Name)
+}
+
+// FSInfo is the FAT32 specific FSInfo sector which caches the free cluster count and a hint
+// where to search for the next free cluster.
+type FSInfo struct {
+	LeadSignature   uint32
+	Reserved1       [480]byte
+	StructSignature uint32
+	FreeCount       uint32
+	NextFree        uint32
+	Reserved2       [12]byte
+	TrailSignature  uint32
+}
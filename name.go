@@ -0,0 +1,241 @@
+package gofat
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf16"
+)
+
+// longFilenameChars is the count of UTF-16 characters which fit into one long filename entry.
+const longFilenameChars = 13
+
+// maxLongFilenameLength is the maximum count of UTF-16 characters a long filename may have.
+const maxLongFilenameLength = 255
+
+// shortNameSpecialChars contains all characters besides A-Z and 0-9 which are allowed in short names.
+const shortNameSpecialChars = "$%'-_@~`!(){}^#&"
+
+// longNameInvalidChars contains all characters which are not allowed in long filenames.
+const longNameInvalidChars = "\"*/:<>?\\|"
+
+// shortNameChecksum calculates the checksum of a short name which is stored in each long filename entry
+// belonging to that short name.
+func shortNameChecksum(name [11]byte) byte {
+	var checksum byte = 0
+	for i := 0; i < 11; i++ {
+		checksum = (((checksum & 1) << 7) | ((checksum & 0xfe) >> 1)) + name[i]
+	}
+	return checksum
+}
+
+// shortNameString returns the name as it is displayed if only the short name is used (e.g. "README.MD").
+func shortNameString(name [11]byte) string {
+	base := strings.TrimRight(string(name[:8]), " ")
+	ext := strings.TrimRight(string(name[8:11]), " ")
+
+	if ext != "" {
+		return base + "." + ext
+	}
+	return base
+}
+
+// shortNameViolation returns why the short name breaks the rules for short names, e.g. because of a space inside of
+// the name or a lowercase character. It returns an empty string if the name is valid.
+// Characters above 0x7F are not checked, as they depend on the OEM code page.
+func shortNameViolation(name [11]byte) string {
+	if name[0] == ' ' {
+		return "starts with a space"
+	}
+
+	for _, part := range [][]byte{name[:8], name[8:]} {
+		trimmed := strings.TrimRight(string(part), " ")
+		if strings.IndexByte(trimmed, ' ') >= 0 {
+			return "contains a space"
+		}
+
+		for i := 0; i < len(trimmed); i++ {
+			if c := trimmed[i]; c < 0x80 && !isShortNameChar(c) {
+				return fmt.Sprintf("contains the invalid character %q", c)
+			}
+		}
+	}
+
+	return ""
+}
+
+func isShortNameChar(c byte) bool {
+	return (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || strings.IndexByte(shortNameSpecialChars, c) >= 0
+}
+
+// validateName checks if the given name can be used as name for a new directory entry.
+func validateName(name string) error {
+	if name == "" || name == "." || name == ".." {
+		return fmt.Errorf("%w: '%v' is no valid name", ErrInvalidPath, name)
+	}
+
+	if len(utf16.Encode([]rune(name))) > maxLongFilenameLength {
+		return fmt.Errorf("%w: '%v' is too long", ErrInvalidPath, name)
+	}
+
+	for _, c := range name {
+		if c < 0x20 || strings.ContainsRune(longNameInvalidChars, c) {
+			return fmt.Errorf("%w: '%v' contains invalid characters", ErrInvalidPath, name)
+		}
+	}
+
+	return nil
+}
+
+// exactShortName returns the short name for the given name if it can be stored as short name without any loss.
+// This is only the case if it is already upper case, fits into the 8.3 format and only contains valid characters.
+func exactShortName(name string) ([11]byte, bool) {
+	result := [11]byte{' ', ' ', ' ', ' ', ' ', ' ', ' ', ' ', ' ', ' ', ' '}
+
+	base := name
+	ext := ""
+	if dot := strings.LastIndexByte(name, '.'); dot >= 0 {
+		base = name[:dot]
+		ext = name[dot+1:]
+	}
+
+	if len(base) == 0 || len(base) > 8 || len(ext) > 3 || (ext == "" && strings.HasSuffix(name, ".")) {
+		return result, false
+	}
+
+	for i := 0; i < len(base); i++ {
+		if !isShortNameChar(base[i]) {
+			return result, false
+		}
+		result[i] = base[i]
+	}
+
+	for i := 0; i < len(ext); i++ {
+		if !isShortNameChar(ext[i]) {
+			return result, false
+		}
+		result[8+i] = ext[i]
+	}
+
+	// 0xE5 is never a valid character as it would mark the entry as deleted.
+	// As only ASCII characters are accepted, this cannot happen here.
+	return result, true
+}
+
+// generateShortName creates a unique short name for the given long name.
+// It follows the basis-name generation algorithm from the FAT specification:
+// All invalid characters are replaced by '_', spaces and leading dots get removed and the result is split into
+// max 8 characters for the name and max 3 characters for the extension.
+// If this is lossy a numeric tail (e.g. "~1") is added.
+// exists is called to check if a short name is already in use.
+func generateShortName(name string, exists func([11]byte) bool) ([11]byte, error) {
+	if shortName, ok := exactShortName(name); ok && !exists(shortName) {
+		return shortName, nil
+	}
+
+	convert := func(part string) (string, bool) {
+		lossy := false
+		var result strings.Builder
+		for _, c := range strings.ToUpper(part) {
+			if c == ' ' || c == '.' {
+				lossy = true
+				continue
+			}
+
+			if c > 0x7F || !isShortNameChar(byte(c)) {
+				lossy = true
+				result.WriteByte('_')
+				continue
+			}
+
+			result.WriteRune(c)
+		}
+		return result.String(), lossy
+	}
+
+	trimmed := strings.TrimLeft(name, ".")
+	base := trimmed
+	ext := ""
+	if dot := strings.LastIndexByte(trimmed, '.'); dot >= 0 {
+		base = trimmed[:dot]
+		ext = trimmed[dot+1:]
+	}
+
+	base, baseLossy := convert(base)
+	ext, extLossy := convert(ext)
+	lossy := baseLossy || extLossy || len(base) > 8 || len(ext) > 3 || len(trimmed) != len(name)
+
+	if len(ext) > 3 {
+		ext = ext[:3]
+	}
+
+	if base == "" {
+		base = "_"
+	}
+
+	build := func(base string) [11]byte {
+		result := [11]byte{' ', ' ', ' ', ' ', ' ', ' ', ' ', ' ', ' ', ' ', ' '}
+		copy(result[:8], base)
+		copy(result[8:], ext)
+		return result
+	}
+
+	if !lossy && len(base) <= 8 {
+		if shortName := build(base); !exists(shortName) {
+			return shortName, nil
+		}
+	}
+
+	// Add the numeric tail "~n" and shorten the base name so that it still fits into 8 characters.
+	for n := 1; n < 1000000; n++ {
+		tail := fmt.Sprintf("~%d", n)
+		tailBase := base
+		if len(tailBase)+len(tail) > 8 {
+			tailBase = tailBase[:8-len(tail)]
+		}
+
+		if shortName := build(tailBase + tail); !exists(shortName) {
+			return shortName, nil
+		}
+	}
+
+	return [11]byte{}, fmt.Errorf("%w: no unique short name found for '%v'", ErrInvalidPath, name)
+}
+
+// longFilenameEntries creates the long filename entries for the given name.
+// They are returned in the order they have to be stored in the directory, directly followed by the short entry.
+func longFilenameEntries(name string, checksum byte) []LongFilenameEntry {
+	chars := utf16.Encode([]rune(name))
+
+	count := (len(chars) + longFilenameChars - 1) / longFilenameChars
+
+	// The name is terminated by 0x0000 and the rest is filled with 0xFFFF.
+	if len(chars)%longFilenameChars != 0 {
+		chars = append(chars, 0x0000)
+	}
+	for len(chars)%longFilenameChars != 0 {
+		chars = append(chars, 0xFFFF)
+	}
+
+	entries := make([]LongFilenameEntry, count)
+	for i := 0; i < count; i++ {
+		part := chars[i*longFilenameChars : (i+1)*longFilenameChars]
+
+		entry := LongFilenameEntry{
+			Sequence:  byte(i + 1),
+			Attribute: AttrLongName,
+			Checksum:  checksum,
+		}
+		copy(entry.First[:], part[0:5])
+		copy(entry.Second[:], part[5:11])
+		copy(entry.Third[:], part[11:13])
+
+		// The last part is the first one in the directory and is marked by 0x40.
+		if i == count-1 {
+			entry.Sequence |= 0x40
+		}
+
+		entries[count-1-i] = entry
+	}
+
+	return entries
+}
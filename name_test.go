@@ -0,0 +1,177 @@
+package gofat
+
+import (
+	"strings"
+	"testing"
+)
+
+func shortName(name string) [11]byte {
+	var result [11]byte
+	copy(result[:], name)
+	return result
+}
+
+func Test_generateShortName(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		existing []string
+		want     string
+	}{
+		{
+			name:  "already a short name",
+			input: "README.MD",
+			want:  "README  MD ",
+		},
+		{
+			name:  "lower case",
+			input: "readme.md",
+			want:  "README  MD ",
+		},
+		{
+			name:  "long name",
+			input: "HelloWorldThisIsALoongFileName.txt",
+			want:  "HELLOW~1TXT",
+		},
+		{
+			name:     "long name with existing tail",
+			input:    "HelloWorldThisIsALoongFileName.txt",
+			existing: []string{"HELLOW~1TXT"},
+			want:     "HELLOW~2TXT",
+		},
+		{
+			name:  "invalid characters and spaces",
+			input: "a b+c.txt",
+			want:  "AB_C~1  TXT",
+		},
+		{
+			name:  "leading dot",
+			input: ".hidden",
+			want:  "HIDDEN~1   ",
+		},
+		{
+			name:     "existing short name",
+			input:    "main.go",
+			existing: []string{"MAIN    GO "},
+			want:     "MAIN~1  GO ",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exists := func(name [11]byte) bool {
+				for _, existing := range tt.existing {
+					if shortName(existing) == name {
+						return true
+					}
+				}
+				return false
+			}
+
+			got, err := generateShortName(tt.input, exists)
+			if err != nil {
+				t.Errorf("generateShortName() error = %v", err)
+				return
+			}
+			if got != shortName(tt.want) {
+				t.Errorf("generateShortName() = %q, want %q", got[:], tt.want)
+			}
+		})
+	}
+}
+
+func Test_validateName(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		wantErr bool
+	}{
+		{name: "simple", input: "file.txt"},
+		{name: "unicode", input: "Grüße.txt"},
+		{name: "empty", input: "", wantErr: true},
+		{name: "dot", input: ".", wantErr: true},
+		{name: "dot dot", input: "..", wantErr: true},
+		{name: "invalid character", input: "a?b", wantErr: true},
+		{name: "control character", input: "a\tb", wantErr: true},
+		{name: "too long", input: strings.Repeat("a", 256), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateName(tt.input); (err != nil) != tt.wantErr {
+				t.Errorf("validateName() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_shortNameViolation(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{name: "valid", input: "HELLOW~1TXT"},
+		{name: "without extension", input: "README     "},
+		{name: "special characters", input: "A$B_(1)~1  "},
+		{name: "OEM character", input: "GR\x9aSSE  TXT"},
+		{name: "leading space", input: " README MD ", want: "starts with a space"},
+		{name: "space inside", input: "LONG FI~TXT", want: "contains a space"},
+		{name: "space inside of the extension", input: "README  M D", want: "contains a space"},
+		{name: "lower case", input: "readme  MD ", want: "contains the invalid character 'r'"},
+		{name: "path separator", input: "A/B     TXT", want: "contains the invalid character '/'"},
+		{name: "control character", input: "A\x01B     ", want: "contains the invalid character '\\x01'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := shortNameViolation(shortName(tt.input)); got != tt.want {
+				t.Errorf("shortNameViolation() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_longFilenameEntries(t *testing.T) {
+	entries := longFilenameEntries("HelloWorldThisIsALoongFileName.txt", 0x42)
+	if len(entries) != 3 {
+		t.Fatalf("longFilenameEntries() = %v entries, want 3", len(entries))
+	}
+
+	wantSequences := []byte{0x43, 0x02, 0x01}
+	for i, entry := range entries {
+		if entry.Sequence != wantSequences[i] {
+			t.Errorf("entry %v: Sequence = %#x, want %#x", i, entry.Sequence, wantSequences[i])
+		}
+		if entry.Checksum != 0x42 {
+			t.Errorf("entry %v: Checksum = %#x, want 0x42", i, entry.Checksum)
+		}
+		if entry.Attribute != AttrLongName {
+			t.Errorf("entry %v: Attribute = %#x, want %#x", i, entry.Attribute, AttrLongName)
+		}
+	}
+
+	// The name has 34 characters, so the last entry contains 8 characters, the terminator and the padding.
+	last := entries[0]
+	if last.Second[3] != 0x0000 || last.Second[4] != 0xFFFF || last.Third[1] != 0xFFFF {
+		t.Errorf("last entry is not terminated and padded correctly: %v", last)
+	}
+}
+
+func TestEntryHeader_ShortName(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		want string
+	}{
+		{name: "with extension", raw: "README  MD ", want: "README.MD"},
+		{name: "generated", raw: "HELLOW~1TXT", want: "HELLOW~1.TXT"},
+		{name: "without extension", raw: "GO         ", want: "GO"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var h EntryHeader
+			copy(h.Name[:], tt.raw)
+			if got := h.ShortName(); got != tt.want {
+				t.Errorf("EntryHeader.ShortName() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
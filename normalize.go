@@ -0,0 +1,113 @@
+package gofat
+
+import (
+	"time"
+
+	"github.com/aligator/gofat/checkpoint"
+)
+
+// NormalizeTimes sets the creation, modification and access times of the entry at root and of everything below it
+// to t, so that images with the same content get the same bytes, e.g. before signing or hashing them.
+// The "." and ".." entries of the directories, the volume label and even deleted entries are changed as well,
+// as their timestamps would still differ otherwise.
+// Like FormatDate, dates before 1980 and after 2107 are clamped.
+func (f *Fs) NormalizeTimes(root string, t time.Time) error {
+	path, err := cleanPath(root)
+	if err != nil {
+		return checkpoint.Wrap(err, ErrWriteFilesystem)
+	}
+
+	err = f.mutate(Mutation{Op: OpChange, Path: path}, func() error {
+		ref, err := f.resolve(path)
+		if err != nil {
+			return err
+		}
+
+		// The root directory has no entry.
+		if !ref.isRoot() {
+			header := ref.EntryHeader
+			header.setTimes(t)
+			if err := f.writeDirEntry(ref.dirCluster, ref.index, header); err != nil {
+				return err
+			}
+		}
+
+		if !ref.isDir() {
+			return nil
+		}
+		return f.normalizeDirTimes(f.entryDirCluster(ref), t)
+	})
+	return checkpoint.Wrap(err, ErrWriteFilesystem)
+}
+
+// setTimes sets all timestamps of the entry to t.
+func (h *EntryHeader) setTimes(t time.Time) {
+	h.CreateTimeTenth = formatTimeTenth(t)
+	h.CreateTime = FormatTime(t)
+	h.CreateDate = FormatDate(t)
+	h.LastAccessDate = FormatDate(t)
+	h.WriteTime = FormatTime(t)
+	h.WriteDate = FormatDate(t)
+}
+
+// normalizeDirTimes sets the timestamps of all entries in the directory starting at dirCluster and in all of its
+// subdirectories to t. Only the sectors which actually change are written.
+func (f *Fs) normalizeDirTimes(dirCluster fatEntry, t time.Time) error {
+	data, sectors, err := f.readDirSlots(dirCluster)
+	if err != nil {
+		return err
+	}
+
+	refs, err := f.parseDirRefs(data)
+	if err != nil {
+		return err
+	}
+
+	sectorSize := int(f.info.BytesPerSector)
+	changed := make(map[int]bool)
+	for i := 0; i < len(data)/32; i++ {
+		slot := data[i*32 : (i+1)*32]
+		if slot[0] == 0x00 {
+			break
+		}
+		if slot[11]&AttrLongName == AttrLongName {
+			continue
+		}
+
+		header := decodeEntryHeader(slot)
+		header.setTimes(t)
+
+		// Only copy the timestamps (DIR_CrtTimeTenth to DIR_WrtDate), so that the rest of the slot stays exactly as it is.
+		encoded := encodeEntry(header)
+		if string(slot[13:26]) != string(encoded[13:26]) {
+			copy(slot[13:26], encoded[13:26])
+			changed[i*32/sectorSize] = true
+		}
+	}
+
+	for i, sectorNum := range sectors {
+		if !changed[i] {
+			continue
+		}
+
+		sector := data[i*sectorSize : (i+1)*sectorSize]
+		err := f.modifySector(sectorNum, func(buffer []byte) {
+			copy(buffer, sector)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, ref := range refs {
+		if !ref.isDir() {
+			continue
+		}
+
+		if err := f.normalizeDirTimes(ref.firstCluster(), t); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,134 @@
+package gofat
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+// testingTimedImage creates the same small filesystem, but with all timestamps set by a clock at now.
+func testingTimedImage(t *testing.T, now time.Time) (*Fs, *testImage) {
+	image := testingImage(t)
+	clock := FixedClock(now)
+	if err := Format(image, FormatOptions{Size: 16 * 1024 * 1024, Label: "data", VolumeID: 1, Clock: clock}); err != nil {
+		t.Fatal(err)
+	}
+
+	fs, err := NewWithOptions(image, Options{Clock: clock})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := fs.MkdirAll("a/A long directory name", 0777); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"root.txt", "a/file.txt", "a/A long directory name/A long file name.data"} {
+		if err := afero.WriteFile(fs, name, testData(3000), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := fs.Remove("root.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	return fs, image
+}
+
+func TestFs_NormalizeTimes(t *testing.T) {
+	normalized := time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+	first, firstImage := testingTimedImage(t, time.Date(2021, time.March, 4, 5, 6, 7, 0, time.UTC))
+	second, secondImage := testingTimedImage(t, time.Date(2022, time.August, 9, 10, 11, 12, 130000000, time.UTC))
+	if bytes.Equal(firstImage.data, secondImage.data) {
+		t.Fatal("the images are already equal")
+	}
+
+	for _, fs := range []*Fs{first, second} {
+		if err := fs.NormalizeTimes(".", normalized); err != nil {
+			t.Fatalf("Fs.NormalizeTimes() error = %v", err)
+		}
+	}
+
+	if !bytes.Equal(firstImage.data, secondImage.data) {
+		t.Errorf("Fs.NormalizeTimes() did not result in the same images")
+	}
+
+	err := afero.Walk(first, ".", func(path string, info os.FileInfo, err error) error {
+		if err != nil || path == "." {
+			return err
+		}
+
+		fatInfo := info.(FileInfo)
+		if !info.ModTime().Equal(normalized) || !fatInfo.CreateTime().Equal(normalized) || !fatInfo.AccessDate().Equal(normalized) {
+			t.Errorf("%v has the times %v, %v and %v, want %v", path, info.ModTime(), fatInfo.CreateTime(), fatInfo.AccessDate(), normalized)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report, err := first.Check(); err != nil || !report.OK() {
+		t.Errorf("Fs.Check() = %v, %v", report.Findings, err)
+	}
+}
+
+func TestFs_NormalizeTimesPath(t *testing.T) {
+	created := time.Date(2021, time.March, 4, 5, 6, 8, 0, time.UTC)
+	normalized := time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		path    string
+		want    map[string]time.Time
+		wantErr error
+	}{
+		{
+			name: "directory",
+			path: "a/A long directory name",
+			want: map[string]time.Time{
+				"a":                       created,
+				"a/file.txt":              created,
+				"a/A long directory name": normalized,
+				"a/A long directory name/A long file name.data": normalized,
+			},
+		},
+		{
+			name: "file",
+			path: "a/file.txt",
+			want: map[string]time.Time{
+				"a":                       created,
+				"a/file.txt":              normalized,
+				"a/A long directory name": created,
+			},
+		},
+		{
+			name:    "missing",
+			path:    "a/missing",
+			wantErr: os.ErrNotExist,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs, _ := testingTimedImage(t, created)
+
+			err := fs.NormalizeTimes(tt.path, normalized)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Fs.NormalizeTimes() error = %v, want %v", err, tt.wantErr)
+			}
+
+			for path, want := range tt.want {
+				info, err := fs.Stat(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !info.ModTime().Equal(want) {
+					t.Errorf("%v has the time %v, want %v", path, info.ModTime(), want)
+				}
+			}
+		})
+	}
+}
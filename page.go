@@ -0,0 +1,85 @@
+package gofat
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+
+	"github.com/aligator/gofat/checkpoint"
+)
+
+// ErrInvalidCursor is returned by ListPage if the cursor cannot be decoded.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// ListPage returns up to n entries of the directory at the given path, starting at the cursor.
+// An empty cursor starts at the beginning. If n <= 0, all remaining entries are returned.
+//
+// The returned cursor can be passed to the next call to continue the listing. It is empty if there are no
+// more entries. As the cursor only contains the position inside of the directory, it can also be used with another
+// Fs instance for the same filesystem (e.g. in stateless HTTP APIs).
+// Entries added or removed between two calls may or may not be part of the listing.
+func (f *Fs) ListPage(path string, cursor string, n int) ([]os.FileInfo, string, error) {
+	start, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, "", checkpoint.Wrap(err, ErrReadFilesystemDir)
+	}
+
+	cleaned, err := cleanPath(path)
+	if err != nil {
+		return nil, "", checkpoint.Wrap(err, ErrReadFilesystemDir)
+	}
+
+	dir, err := f.resolve(cleaned)
+	if err != nil {
+		return nil, "", checkpoint.Wrap(err, ErrReadFilesystemDir)
+	}
+
+	if !dir.isDir() {
+		return nil, "", checkpoint.Wrap(syscall.ENOTDIR, ErrReadFilesystemDir)
+	}
+
+	refs, err := f.readDirRefs(f.entryDirCluster(dir))
+	if err != nil {
+		return nil, "", checkpoint.Wrap(err, ErrReadFilesystemDir)
+	}
+
+	var page []os.FileInfo
+	for i, ref := range refs {
+		// Entries are identified by their first slot, so that the long filename slots belong to it.
+		if ref.index-ref.lfnCount < start {
+			continue
+		}
+
+		if n > 0 && len(page) == n {
+			return page, encodeCursor(refs[i-1].index + 1), nil
+		}
+
+		page = append(page, f.modes.fileInfo(&ref.ExtendedEntryHeader))
+	}
+
+	return page, "", nil
+}
+
+// encodeCursor converts the slot index into an opaque cursor.
+func encodeCursor(slot int) string {
+	buffer := make([]byte, 4)
+	binary.BigEndian.PutUint32(buffer, uint32(slot))
+	return base64.RawURLEncoding.EncodeToString(buffer)
+}
+
+// decodeCursor returns the slot index encoded in the cursor. An empty cursor is slot 0.
+func decodeCursor(cursor string) (int, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+
+	buffer, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || len(buffer) != 4 {
+		return 0, checkpoint.From(fmt.Errorf("%w: '%v'", ErrInvalidCursor, cursor))
+	}
+
+	return int(binary.BigEndian.Uint32(buffer)), nil
+}
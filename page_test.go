@@ -0,0 +1,85 @@
+package gofat
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestFs_ListPage(t *testing.T) {
+	all, _, err := testingNew(t, testFileReader(fat32)).ListPage(".", "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want []string
+	for _, info := range all {
+		want = append(want, info.Name())
+	}
+	if len(want) != 3 {
+		t.Fatalf("ListPage() = %v, want 3 entries", want)
+	}
+
+	tests := []struct {
+		name     string
+		pageSize int
+		want     [][]string
+	}{
+		{
+			name:     "pages of 1",
+			pageSize: 1,
+			want:     [][]string{want[:1], want[1:2], want[2:]},
+		},
+		{
+			name:     "pages of 2",
+			pageSize: 2,
+			want:     [][]string{want[:2], want[2:]},
+		},
+		{
+			name:     "exactly one page",
+			pageSize: 3,
+			want:     [][]string{want},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got [][]string
+			cursor := ""
+			for {
+				// Use a new Fs for each page.
+				page, next, err := testingNew(t, testFileReader(fat32)).ListPage(".", cursor, tt.pageSize)
+				if err != nil {
+					t.Fatalf("Fs.ListPage() error = %v", err)
+				}
+
+				var names []string
+				for _, info := range page {
+					names = append(names, info.Name())
+				}
+				got = append(got, names)
+
+				if next == "" {
+					break
+				}
+				cursor = next
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Fs.ListPage() pages = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFs_ListPageErrors(t *testing.T) {
+	fs := testingNew(t, testFileReader(fat32))
+
+	if _, _, err := fs.ListPage(".", "not a cursor!", 1); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("Fs.ListPage() error = %v, want %v", err, ErrInvalidCursor)
+	}
+	if _, _, err := fs.ListPage("README.md", "", 1); err == nil {
+		t.Errorf("Fs.ListPage() on a file expected an error")
+	}
+	if _, _, err := fs.ListPage("not existing", "", 1); err == nil {
+		t.Errorf("Fs.ListPage() on a missing path expected an error")
+	}
+}
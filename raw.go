@@ -0,0 +1,93 @@
+package gofat
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/aligator/gofat/checkpoint"
+)
+
+// RawReader reads the whole image sector by sector through the sector cache of a filesystem,
+// e.g. to serve it as block device. See Fs.RawReader.
+type RawReader struct {
+	fs *Fs
+}
+
+// RawReader returns a reader for the raw image.
+// The boot sector, the FATs and the FAT16 root directory are read through the sector cache, so they are shared
+// with the filesystem and stay cached. Sectors of the data region are taken from the cache if they are in it
+// (e.g. directories), but are not added, so reading big files does not evict the filesystem structures.
+// Changes made through the filesystem are visible immediately.
+func (f *Fs) RawReader() *RawReader {
+	return &RawReader{fs: f}
+}
+
+// Size returns the size of the image in bytes as given by the boot sector.
+func (r *RawReader) Size() int64 {
+	return int64(r.fs.info.TotalSectorCount) * int64(r.fs.info.BytesPerSector)
+}
+
+// ReadAt reads the image at the offset, see io.ReaderAt.
+// It is safe for concurrent use.
+func (r *RawReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, checkpoint.From(fmt.Errorf("%w: negative offset %d", ErrReadFilesystemFile, off))
+	}
+
+	size := r.Size()
+	if off >= size {
+		return 0, io.EOF
+	}
+
+	var missing error
+	if off+int64(len(p)) > size {
+		p = p[:size-off]
+		missing = io.EOF
+	}
+
+	bytesPerSector := int64(r.fs.info.BytesPerSector)
+	n := 0
+	for n < len(p) {
+		pos := off + int64(n)
+		sectorNum := uint32(pos / bytesPerSector)
+		start := pos % bytesPerSector
+
+		err := r.readSector(sectorNum, func(buffer []byte) {
+			n += copy(p[n:], buffer[start:])
+		})
+		if err != nil {
+			return n, err
+		}
+	}
+
+	return n, missing
+}
+
+// readSector calls read with the content of the sector. Data sectors are not added to the cache.
+func (r *RawReader) readSector(sectorNum uint32, read func(buffer []byte)) error {
+	f := r.fs
+	if sectorNum < f.info.FirstDataSector {
+		return f.readSector(sectorNum, read)
+	}
+
+	shard := f.sectorCache.shard(sectorNum)
+	shard.lock.Lock()
+	if sector, ok := shard.cache.get(sectorNum); ok {
+		read(sector.buffer)
+		shard.lock.Unlock()
+		return nil
+	}
+	shard.lock.Unlock()
+
+	if err := f.canceled(); err != nil {
+		return err
+	}
+
+	buffer, err := f.loadSector(sectorNum)
+	if err != nil {
+		return err
+	}
+	read(buffer)
+	f.sectorPool.put(buffer)
+	return nil
+}
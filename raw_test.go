@@ -0,0 +1,76 @@
+package gofat
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+func TestRawReader_ReadAt(t *testing.T) {
+	image, err := ioutil.ReadFile(fat16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs := testingNew(t, bytes.NewReader(image))
+	size := fs.RawReader().Size()
+
+	tests := []struct {
+		name    string
+		offset  int64
+		length  int
+		wantN   int
+		wantErr error
+	}{
+		{name: "boot sector", offset: 0, length: 512, wantN: 512},
+		{name: "across sectors", offset: 300, length: 2000, wantN: 2000},
+		{name: "data region", offset: int64(fs.info.FirstDataSector)*512 + 17, length: 5000, wantN: 5000},
+		{name: "end of the image", offset: size - 100, length: 200, wantN: 100, wantErr: io.EOF},
+		{name: "behind the image", offset: size, length: 10, wantN: 0, wantErr: io.EOF},
+		{name: "negative offset", offset: -1, length: 10, wantN: 0, wantErr: ErrReadFilesystemFile},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := make([]byte, tt.length)
+			n, err := fs.RawReader().ReadAt(p, tt.offset)
+			if n != tt.wantN || !errors.Is(err, tt.wantErr) || (err != nil) != (tt.wantErr != nil) {
+				t.Fatalf("RawReader.ReadAt() = %d, %v, want %d, %v", n, err, tt.wantN, tt.wantErr)
+			}
+			if n > 0 && !bytes.Equal(p[:n], image[tt.offset:tt.offset+int64(n)]) {
+				t.Errorf("RawReader.ReadAt() returned other data than the image contains")
+			}
+		})
+	}
+}
+
+func TestRawReader_cache(t *testing.T) {
+	fs := testingNew(t, testFileReader(fat16))
+	raw := fs.RawReader()
+	p := make([]byte, 512)
+
+	tests := []struct {
+		name        string
+		sector      uint32
+		wantHits    uint64
+		wantFetched uint64
+	}{
+		{name: "FAT sectors are cached", sector: uint32(fs.info.ReservedSectorCount) + fs.info.FatSize - 1, wantHits: 1, wantFetched: 1},
+		{name: "data sectors are not cached", sector: fs.info.FirstDataSector + 100, wantHits: 0, wantFetched: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs.ResetStats()
+			for i := 0; i < 2; i++ {
+				if _, err := raw.ReadAt(p, int64(tt.sector)*512); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			stats := fs.Stats()
+			if stats.CacheHits != tt.wantHits || stats.SectorsFetched != tt.wantFetched {
+				t.Errorf("Fs.Stats() = %+v, want %d hits and %d fetched sectors", stats, tt.wantHits, tt.wantFetched)
+			}
+		})
+	}
+}
@@ -0,0 +1,223 @@
+package gofat
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/aligator/gofat/checkpoint"
+)
+
+// ErrInvalidRecord is returned if a recording of the sector I/O cannot be replayed.
+var ErrInvalidRecord = errors.New("invalid I/O recording")
+
+// RecordOp is the kind of access of a RecordEvent.
+type RecordOp string
+
+const (
+	// RecordRead is a read of sectors.
+	RecordRead RecordOp = "read"
+	// RecordWrite is a write of sectors.
+	RecordWrite RecordOp = "write"
+)
+
+// RecordEvent is one access to the sectors of the device, see Options.Record.
+type RecordEvent struct {
+	// Seq numbers the events in the order in which they happened, starting at 1.
+	Seq uint64   `json:"seq"`
+	Op  RecordOp `json:"op"`
+	// Sector is the first accessed sector. Offset and Length are in bytes.
+	Sector uint32 `json:"sector"`
+	Offset int64  `json:"offset"`
+	Length int    `json:"length"`
+	// Data is the read or written data. It is empty for failed reads.
+	Data []byte `json:"data,omitempty"`
+	// Error is the error of the access, if it failed.
+	Error string `json:"error,omitempty"`
+}
+
+// recorder writes the events as JSON lines. It is shared by all copies of the Fs.
+type recorder struct {
+	lock    sync.Mutex
+	encoder *json.Encoder
+	seq     uint64
+	// err is the first error of writing the recording. Nothing is recorded after it.
+	err error
+}
+
+func newRecorder(w io.Writer) *recorder {
+	if w == nil {
+		return nil
+	}
+	return &recorder{encoder: json.NewEncoder(w)}
+}
+
+// record writes an event for the access of the sectors starting at sectorNum.
+func (f *Fs) record(op RecordOp, sectorNum uint32, data []byte, length int, err error) {
+	r := f.recorder
+	if r == nil {
+		return
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.err != nil {
+		return
+	}
+
+	r.seq++
+	event := RecordEvent{
+		Seq:    r.seq,
+		Op:     op,
+		Sector: sectorNum,
+		Offset: int64(sectorNum) * int64(f.info.BytesPerSector),
+		Length: length,
+		Data:   data,
+	}
+	if err != nil {
+		event.Error = err.Error()
+		if op == RecordRead {
+			event.Data = nil
+		}
+	}
+
+	r.err = r.encoder.Encode(event)
+	if r.err != nil {
+		f.debug("recording the sector I/O failed, stopped recording", "error", r.err)
+	}
+}
+
+// ReadRecord reads all events of a recording written by Options.Record.
+func ReadRecord(r io.Reader) ([]RecordEvent, error) {
+	var events []RecordEvent
+	decoder := json.NewDecoder(bufio.NewReader(r))
+	for {
+		var event RecordEvent
+		err := decoder.Decode(&event)
+		if err == io.EOF {
+			return events, nil
+		}
+		if err != nil {
+			return nil, checkpoint.Wrap(err, fmt.Errorf("%w: event %d", ErrInvalidRecord, len(events)+1))
+		}
+		events = append(events, event)
+	}
+}
+
+// ReplayDevice is an in-memory device which is reconstructed from a recording of the sector I/O, e.g. one a user
+// sent for a corruption which cannot be reproduced otherwise.
+// Initially it contains the image as it was before the recording: every sector which was read before it was written
+// has the recorded content, all other sectors are zero. The recorded writes can then be applied step by step
+// with Apply, to find the write which broke the filesystem (e.g. by running Check after each one).
+// All writes are kept in memory, like a DryRunDevice does it.
+type ReplayDevice struct {
+	*DryRunDevice
+	writes  []RecordEvent
+	applied int
+}
+
+// NewReplayDevice reconstructs the image from the events.
+func NewReplayDevice(events []RecordEvent) (*ReplayDevice, error) {
+	var size int64
+	written := make(map[int64]bool)
+	initial := make(map[int64][]byte)
+	var writes []RecordEvent
+
+	for _, event := range events {
+		if event.Offset%dryRunBlockSize != 0 || event.Length%dryRunBlockSize != 0 {
+			return nil, checkpoint.From(fmt.Errorf("%w: event %d is not aligned to %d bytes", ErrInvalidRecord, event.Seq, dryRunBlockSize))
+		}
+		if event.Error == "" && len(event.Data) != event.Length {
+			return nil, checkpoint.From(fmt.Errorf("%w: event %d has %d bytes of data instead of %d", ErrInvalidRecord, event.Seq, len(event.Data), event.Length))
+		}
+
+		if end := event.Offset + int64(event.Length); end > size {
+			size = end
+		}
+
+		first := event.Offset / dryRunBlockSize
+		switch {
+		case event.Op == RecordWrite && event.Error == "":
+			writes = append(writes, event)
+			for i := 0; i < event.Length/dryRunBlockSize; i++ {
+				written[first+int64(i)] = true
+			}
+		case event.Op == RecordRead && event.Error == "":
+			for i := 0; i < event.Length/dryRunBlockSize; i++ {
+				index := first + int64(i)
+				if _, ok := initial[index]; !ok && !written[index] {
+					initial[index] = event.Data[i*dryRunBlockSize : (i+1)*dryRunBlockSize]
+				}
+			}
+		}
+	}
+
+	// The boot sector knows the real size of the image.
+	if boot, ok := initial[0]; ok {
+		if bpb, err := decodeBPB(boot); err == nil {
+			total := int64(bpb.TotalSectors16)
+			if total == 0 {
+				total = int64(bpb.TotalSectors32)
+			}
+			if total*int64(bpb.BytesPerSector) > size {
+				size = total * int64(bpb.BytesPerSector)
+			}
+		}
+	}
+
+	base, err := NewDryRunDevice(io.NewSectionReader(zeroReader{}, 0, size))
+	if err != nil {
+		return nil, err
+	}
+	for index, data := range initial {
+		base.blocks[index] = data
+	}
+
+	device, err := NewDryRunDevice(base)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ReplayDevice{DryRunDevice: device, writes: writes}, nil
+}
+
+// Writes returns the count of successful writes in the recording.
+func (d *ReplayDevice) Writes() int {
+	return len(d.writes)
+}
+
+// Applied returns the count of recorded writes which were applied so far.
+func (d *ReplayDevice) Applied() int {
+	return d.applied
+}
+
+// Apply writes the next n recorded writes into the device and returns the last applied event.
+// A filesystem opened on the device caches sectors, so it has to be opened again to see the changes.
+func (d *ReplayDevice) Apply(n int) (RecordEvent, error) {
+	if n <= 0 || d.applied+n > len(d.writes) {
+		return RecordEvent{}, checkpoint.From(fmt.Errorf("%w: cannot apply %d of the %d remaining writes", ErrInvalidRecord, n, len(d.writes)-d.applied))
+	}
+
+	var event RecordEvent
+	for _, event = range d.writes[d.applied : d.applied+n] {
+		if _, err := d.WriteAt(event.Data, event.Offset); err != nil {
+			return event, err
+		}
+		d.applied++
+	}
+	return event, nil
+}
+
+// zeroReader reads only zeros.
+type zeroReader struct{}
+
+func (zeroReader) ReadAt(p []byte, off int64) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
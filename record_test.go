@@ -0,0 +1,146 @@
+package gofat
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+// recordSession opens a copy of the fat16 image with a recording, runs modify and returns the recorded events
+// and the image afterwards.
+func recordSession(t *testing.T, modify func(fs *Fs) error) ([]RecordEvent, *testImage) {
+	image := testingCopy(t, fat16)
+	var recording bytes.Buffer
+	fs, err := NewWithOptions(image, Options{Record: &recording})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := modify(fs); err != nil {
+		t.Fatal(err)
+	}
+
+	events, err := ReadRecord(&recording)
+	if err != nil {
+		t.Fatalf("ReadRecord() error = %v", err)
+	}
+	return events, image
+}
+
+func TestOptions_Record(t *testing.T) {
+	events, image := recordSession(t, func(fs *Fs) error {
+		if _, err := afero.ReadFile(fs, "go/main.go"); err != nil {
+			return err
+		}
+		return afero.WriteFile(fs, "new.txt", testData(3000), 0666)
+	})
+
+	if len(events) == 0 || events[0].Op != RecordRead || events[0].Sector != 0 {
+		t.Fatalf("ReadRecord() = %d events, want the boot sector to be read first", len(events))
+	}
+
+	writes := 0
+	for i, event := range events {
+		if event.Seq != uint64(i+1) {
+			t.Errorf("event %d has Seq %d", i, event.Seq)
+		}
+		if event.Offset != int64(event.Sector)*512 || len(event.Data) != event.Length {
+			t.Errorf("event %d = sector %d, offset %d, length %d with %d bytes of data",
+				i, event.Sector, event.Offset, event.Length, len(event.Data))
+		}
+		if event.Op == RecordWrite {
+			writes++
+		}
+	}
+	if writes == 0 {
+		t.Errorf("ReadRecord() contains no writes")
+	}
+
+	// Applying all recorded writes to the original image results in the modified image.
+	original, err := os.ReadFile(fat16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, event := range events {
+		if event.Op == RecordWrite {
+			copy(original[event.Offset:], event.Data)
+		}
+	}
+	if !bytes.Equal(original, image.data) {
+		t.Errorf("the recorded writes do not result in the modified image")
+	}
+}
+
+func TestReplayDevice(t *testing.T) {
+	events, _ := recordSession(t, func(fs *Fs) error {
+		if err := fs.Mkdir("dir", 0777); err != nil {
+			return err
+		}
+		return afero.WriteFile(fs, "dir/new.txt", testData(3000), 0666)
+	})
+
+	device, err := NewReplayDevice(events)
+	if err != nil {
+		t.Fatalf("NewReplayDevice() error = %v", err)
+	}
+
+	tests := []struct {
+		name string
+		// apply is the count of writes to apply before checking the files. -1 applies all remaining ones.
+		apply       int
+		wantDir     bool
+		wantFile    bool
+		wantApplied int
+	}{
+		{name: "initial image", apply: 0, wantDir: false, wantFile: false},
+		{name: "all writes", apply: -1, wantDir: true, wantFile: true, wantApplied: device.Writes()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.apply < 0 {
+				tt.apply = device.Writes() - device.Applied()
+			}
+			if tt.apply > 0 {
+				if _, err := device.Apply(tt.apply); err != nil {
+					t.Fatalf("ReplayDevice.Apply() error = %v", err)
+				}
+			}
+			if got := device.Applied(); got != tt.wantApplied {
+				t.Errorf("ReplayDevice.Applied() = %d, want %d", got, tt.wantApplied)
+			}
+
+			fs := testingNew(t, device)
+			if got, _ := fs.Exists("dir"); got != tt.wantDir {
+				t.Errorf("Fs.Exists(dir) = %v, want %v", got, tt.wantDir)
+			}
+			data, err := afero.ReadFile(fs, "dir/new.txt")
+			if (err == nil) != tt.wantFile || tt.wantFile && !bytes.Equal(data, testData(3000)) {
+				t.Errorf("afero.ReadFile() = %d bytes, %v, want the file %v", len(data), err, tt.wantFile)
+			}
+		})
+	}
+
+	if _, err := device.Apply(1); !errors.Is(err, ErrInvalidRecord) {
+		t.Errorf("ReplayDevice.Apply() after the last write error = %v, want %v", err, ErrInvalidRecord)
+	}
+}
+
+func TestNewReplayDevice_invalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		events []RecordEvent
+	}{
+		{name: "unaligned offset", events: []RecordEvent{{Seq: 1, Op: RecordRead, Offset: 100, Length: 512, Data: make([]byte, 512)}}},
+		{name: "missing data", events: []RecordEvent{{Seq: 1, Op: RecordWrite, Offset: 512, Length: 512}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewReplayDevice(tt.events); !errors.Is(err, ErrInvalidRecord) {
+				t.Errorf("NewReplayDevice() error = %v, want %v", err, ErrInvalidRecord)
+			}
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package gofat
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/aligator/gofat/checkpoint"
+)
+
+// These errors may occur while looking up a volume in a Registry.
+var (
+	ErrUnknownVolume   = errors.New("no volume matches")
+	ErrAmbiguousVolume = errors.New("several volumes match")
+)
+
+// Volume is a filesystem added to a Registry.
+type Volume struct {
+	// Name identifies the volume, e.g. the path of its image. It is unique inside of the Registry.
+	Name string
+	Fs   *Fs
+}
+
+// Registry keeps many opened filesystems and finds them by their volume label or serial number, e.g. for test farms
+// juggling many device images at once.
+// The labels and serial numbers are read on each lookup, so changes using SetLabel or SetVolumeID are found
+// immediately. It is safe for concurrent use.
+type Registry struct {
+	lock    sync.RWMutex
+	opts    Options
+	volumes []Volume
+}
+
+// NewRegistry creates an empty Registry. Open uses the options for all filesystems.
+func NewRegistry(opts Options) *Registry {
+	return &Registry{opts: opts}
+}
+
+// Open opens the filesystem of the reader and adds it with the given name, see Add.
+func (r *Registry) Open(name string, reader io.ReadSeeker) (*Fs, error) {
+	fs, err := NewWithOptions(reader, r.opts)
+	if err != nil {
+		return nil, checkpoint.Wrap(err, fmt.Errorf("%w: %v", ErrOpenFilesystem, name))
+	}
+
+	if err := r.Add(name, fs); err != nil {
+		return nil, err
+	}
+	return fs, nil
+}
+
+// Add adds an already opened filesystem with the given name.
+// It fails with ErrAmbiguousVolume if the name is already used.
+func (r *Registry) Add(name string, fs *Fs) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	for _, volume := range r.volumes {
+		if volume.Name == name {
+			return checkpoint.From(fmt.Errorf("%w: the name %v is already used", ErrAmbiguousVolume, name))
+		}
+	}
+
+	r.volumes = append(r.volumes, Volume{Name: name, Fs: fs})
+	return nil
+}
+
+// Remove removes the volume with the given name. It returns false if there is none.
+// The reader of the filesystem is not closed.
+func (r *Registry) Remove(name string) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	for i, volume := range r.volumes {
+		if volume.Name == name {
+			r.volumes = append(r.volumes[:i], r.volumes[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Volumes returns all volumes in the order they were added.
+func (r *Registry) Volumes() []Volume {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	return append([]Volume(nil), r.volumes...)
+}
+
+// Get returns the filesystem added with the given name.
+func (r *Registry) Get(name string) (*Fs, error) {
+	return r.find(name, func(volume Volume) bool {
+		return volume.Name == name
+	})
+}
+
+// ByLabel returns the filesystem with the given volume label. Like FAT itself, the label is compared case
+// insensitive and trailing spaces are ignored.
+// It fails with ErrUnknownVolume if no volume has the label and with ErrAmbiguousVolume if several volumes have it
+// (e.g. "NO NAME").
+func (r *Registry) ByLabel(label string) (*Fs, error) {
+	label = strings.TrimRight(label, " ")
+	return r.find(label, func(volume Volume) bool {
+		return strings.EqualFold(volume.Fs.Label(), label)
+	})
+}
+
+// BySerial returns the filesystem with the given serial number (see Fs.VolumeID).
+// It fails with ErrUnknownVolume if no volume has the serial number and with ErrAmbiguousVolume if several volumes
+// have it (e.g. images cloned without a new serial number).
+func (r *Registry) BySerial(id uint32) (*Fs, error) {
+	return r.find(fmt.Sprintf("%04X-%04X", id>>16, id&0xFFFF), func(volume Volume) bool {
+		return volume.Fs.VolumeID() == id
+	})
+}
+
+// Lookup returns the filesystem by a serial number written like "1234-ABCD" (as shown by Windows and blkid), by its
+// label or by its name, in this order.
+func (r *Registry) Lookup(key string) (*Fs, error) {
+	var high, low uint32
+	if len(key) == 9 {
+		if n, _ := fmt.Sscanf(key, "%04X-%04X", &high, &low); n == 2 {
+			if fs, err := r.BySerial(high<<16 | low); !errors.Is(err, ErrUnknownVolume) {
+				return fs, err
+			}
+		}
+	}
+
+	if fs, err := r.ByLabel(key); !errors.Is(err, ErrUnknownVolume) {
+		return fs, err
+	}
+
+	return r.Get(key)
+}
+
+// find returns the filesystem of the only volume matching.
+func (r *Registry) find(key string, matches func(volume Volume) bool) (*Fs, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	var found []string
+	var fs *Fs
+	for _, volume := range r.volumes {
+		if matches(volume) {
+			found = append(found, volume.Name)
+			fs = volume.Fs
+		}
+	}
+
+	switch len(found) {
+	case 0:
+		return nil, checkpoint.From(fmt.Errorf("%w: %v", ErrUnknownVolume, key))
+	case 1:
+		return fs, nil
+	default:
+		return nil, checkpoint.From(fmt.Errorf("%w: %v (%v)", ErrAmbiguousVolume, key, strings.Join(found, ", ")))
+	}
+}
@@ -0,0 +1,80 @@
+package gofat
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	registry := NewRegistry(Options{})
+	volumes := []struct {
+		name string
+		opts FormatOptions
+	}{
+		{name: "boot.img", opts: FormatOptions{Size: 16 * 1024 * 1024, Label: "BOOT", VolumeID: 0x1234ABCD}},
+		{name: "data.img", opts: FormatOptions{Size: 16 * 1024 * 1024, Label: "DATA", VolumeID: 0x00000042}},
+		{name: "copy.img", opts: FormatOptions{Size: 16 * 1024 * 1024, Label: "DATA", VolumeID: 0x00000043}},
+	}
+	filesystems := make(map[string]*Fs)
+	for _, volume := range volumes {
+		image := testingImage(t)
+		if err := Format(image, volume.opts); err != nil {
+			t.Fatal(err)
+		}
+
+		fs, err := registry.Open(volume.name, image)
+		if err != nil {
+			t.Fatal(err)
+		}
+		filesystems[volume.name] = fs
+	}
+
+	if err := registry.Add("boot.img", filesystems["data.img"]); !errors.Is(err, ErrAmbiguousVolume) {
+		t.Errorf("Registry.Add() of an existing name error = %v, want %v", err, ErrAmbiguousVolume)
+	}
+
+	tests := []struct {
+		name    string
+		lookup  func() (*Fs, error)
+		want    string
+		wantErr error
+	}{
+		{name: "label", lookup: func() (*Fs, error) { return registry.ByLabel("boot") }, want: "boot.img"},
+		{name: "ambiguous label", lookup: func() (*Fs, error) { return registry.ByLabel("DATA") }, wantErr: ErrAmbiguousVolume},
+		{name: "unknown label", lookup: func() (*Fs, error) { return registry.ByLabel("OTHER") }, wantErr: ErrUnknownVolume},
+		{name: "serial", lookup: func() (*Fs, error) { return registry.BySerial(0x42) }, want: "data.img"},
+		{name: "unknown serial", lookup: func() (*Fs, error) { return registry.BySerial(1) }, wantErr: ErrUnknownVolume},
+		{name: "name", lookup: func() (*Fs, error) { return registry.Get("copy.img") }, want: "copy.img"},
+		{name: "lookup serial", lookup: func() (*Fs, error) { return registry.Lookup("1234-abcd") }, want: "boot.img"},
+		{name: "lookup label", lookup: func() (*Fs, error) { return registry.Lookup("Boot") }, want: "boot.img"},
+		{name: "lookup name", lookup: func() (*Fs, error) { return registry.Lookup("data.img") }, want: "data.img"},
+		{name: "lookup ambiguous", lookup: func() (*Fs, error) { return registry.Lookup("DATA") }, wantErr: ErrAmbiguousVolume},
+		{name: "lookup unknown", lookup: func() (*Fs, error) { return registry.Lookup("0000-0001") }, wantErr: ErrUnknownVolume},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.lookup()
+			if !errors.Is(err, tt.wantErr) || (err != nil) != (tt.wantErr != nil) {
+				t.Fatalf("lookup error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && got != filesystems[tt.want] {
+				t.Errorf("lookup returned the wrong filesystem, want %v", tt.want)
+			}
+		})
+	}
+
+	// Changed labels are found immediately.
+	if err := filesystems["copy.img"].SetLabel("COPY"); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := registry.ByLabel("DATA"); err != nil || got != filesystems["data.img"] {
+		t.Errorf("Registry.ByLabel() after changing the label = %v, %v, want data.img", got, err)
+	}
+
+	if !registry.Remove("boot.img") || registry.Remove("boot.img") {
+		t.Errorf("Registry.Remove() did not remove the volume exactly once")
+	}
+	if got := len(registry.Volumes()); got != 2 {
+		t.Errorf("len(Registry.Volumes()) = %v, want 2", got)
+	}
+}
@@ -0,0 +1,177 @@
+package gofat
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/aligator/gofat/checkpoint"
+)
+
+// PlanRoot checks which of the new entries fit into the root directory if they are created in the given order.
+// The root directory of FAT16 has a fixed count of slots (see Info.RootEntryCount) and long names need several
+// of them. Importers can use it to detect ahead of time that a tree does not fit and put the overflow into a
+// subdirectory, instead of failing midway. On FAT32 all names fit.
+// Names which already exist in the root directory and duplicates are ignored.
+func (f *Fs) PlanRoot(names []string) (fit []string, overflow []string, err error) {
+	return f.planRoot(names, false)
+}
+
+// planRoot works like PlanRoot. If label is set, a slot for the volume label entry is reserved first, if there is
+// none yet, as SetLabel adds it.
+func (f *Fs) planRoot(names []string, label bool) (fit []string, overflow []string, err error) {
+	if f.info.FSType == FAT32 {
+		return names, nil, nil
+	}
+
+	data, _, err := f.readDirSlots(0)
+	if err != nil {
+		return nil, nil, checkpoint.Wrap(err, ErrReadFilesystemDir)
+	}
+
+	refs, err := f.parseDirRefs(data)
+	if err != nil {
+		return nil, nil, checkpoint.Wrap(err, ErrReadFilesystemDir)
+	}
+
+	// Like addDirEntry all slots after the first end marker are free.
+	free := make([]bool, len(data)/32)
+	end := false
+	for i := range free {
+		end = end || data[i*32] == 0x00
+		free[i] = end || data[i*32] == 0xE5
+
+		attribute := data[i*32+11]
+		if !free[i] && attribute&AttrLongName != AttrLongName && attribute&AttrVolumeId == AttrVolumeId {
+			label = false
+		}
+	}
+
+	if label {
+		for i := range free {
+			if free[i] {
+				free[i] = false
+				break
+			}
+		}
+	}
+
+	shortNames := make(map[[11]byte]bool)
+	for _, ref := range refs {
+		shortNames[ref.Name] = true
+	}
+
+	var planned []string
+	for _, name := range names {
+		if err := validateName(name); err != nil {
+			return nil, nil, checkpoint.Wrap(err, fmt.Errorf("%w: %v", ErrInvalidPath, name))
+		}
+		if f.rootContains(refs, planned, name) {
+			continue
+		}
+		planned = append(planned, name)
+
+		// The slots are searched the same way as in addDirEntry: the first run of enough free slots is used.
+		needed := 1
+		shortName, exact := exactShortName(name)
+		if !exact || shortNames[shortName] {
+			needed += len(longFilenameEntries(name, 0))
+		}
+		shortNames[shortName] = true
+
+		start := -1
+		for i, run := 0, 0; i < len(free) && start < 0; i++ {
+			run++
+			if !free[i] {
+				run = 0
+			}
+			if run == needed {
+				start = i - needed + 1
+			}
+		}
+
+		if start < 0 {
+			overflow = append(overflow, name)
+			continue
+		}
+
+		for i := start; i < start+needed; i++ {
+			free[i] = false
+		}
+		fit = append(fit, name)
+	}
+
+	return fit, overflow, nil
+}
+
+// rootContains reports whether the name already exists in the root directory or was already planned.
+func (f *Fs) rootContains(refs []entryRef, planned []string, name string) bool {
+	for _, ref := range refs {
+		if f.match(ref.FileInfo().Name(), name) || f.match(shortNameString(ref.Name), name) {
+			return true
+		}
+	}
+	for _, other := range planned {
+		if f.match(other, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// rootLayout moves the paths of entries which do not fit into the root directory into the overflow directory.
+type rootLayout struct {
+	match    func(entryName, name string) bool
+	overflow []string
+	dir      string
+}
+
+// planRootLayout plans where the new root entries are created. If all fit, the layout keeps all paths.
+// Otherwise the entries which do not fit are moved into dir, which is created in the root first.
+// If dir is empty, an error wrapping ErrDirectoryFull suggests to use one.
+// If label is set, the volume label entry is added first, see planRoot.
+func (f *Fs) planRootLayout(names []string, dir string, label bool) (rootLayout, error) {
+	layout := rootLayout{match: f.match, dir: dir}
+
+	fit, overflow, err := f.planRoot(names, label)
+	if err != nil || len(overflow) == 0 {
+		return layout, err
+	}
+
+	if dir == "" {
+		return layout, checkpoint.From(fmt.Errorf("%w: %d of the %d new entries do not fit into the root directory which can hold %d entries, put them into a subdirectory",
+			ErrDirectoryFull, len(overflow), len(fit)+len(overflow), f.info.RootEntryCount))
+	}
+
+	// The overflow directory is created first, so it needs a slot as well.
+	if _, err := f.resolve(dir); errors.Is(err, os.ErrNotExist) {
+		names = append([]string{dir}, names...)
+	} else if err != nil {
+		return layout, err
+	}
+
+	_, overflow, err = f.planRoot(names, label)
+	if err != nil {
+		return layout, err
+	}
+	for _, name := range overflow {
+		if f.match(name, dir) {
+			return layout, checkpoint.From(fmt.Errorf("%w: the root directory has no free entry left for '%v'", ErrDirectoryFull, dir))
+		}
+	}
+
+	layout.overflow = overflow
+	return layout, nil
+}
+
+// place returns the path at which the entry with the given cleaned path is created.
+func (l rootLayout) place(name string) string {
+	first := strings.SplitN(name, "/", 2)[0]
+	for _, overflow := range l.overflow {
+		if name != "" && l.match(overflow, first) {
+			return l.dir + "/" + name
+		}
+	}
+	return name
+}
@@ -0,0 +1,118 @@
+package gofat
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// testingNames returns count names built from the format, e.g. "F%03d.TXT".
+func testingNames(format string, count int) []string {
+	names := make([]string, count)
+	for i := range names {
+		names[i] = fmt.Sprintf(format, i)
+	}
+	return names
+}
+
+func TestFs_PlanRoot(t *testing.T) {
+	tests := []struct {
+		name         string
+		fs           func(t *testing.T) *Fs
+		names        []string
+		wantFit      int
+		wantOverflow int
+		wantErr      error
+	}{
+		{
+			name: "all fit",
+			fs: func(t *testing.T) *Fs {
+				return testingNew(t, testFileReader(fat16))
+			},
+			names:   []string{"A.TXT", "a long name.txt"},
+			wantFit: 2,
+		},
+		{
+			name: "existing and duplicates are ignored",
+			fs: func(t *testing.T) *Fs {
+				return testingNew(t, testFileReader(fat16))
+			},
+			names:   []string{"readme.md", "new.txt", "NEW.TXT"},
+			wantFit: 1,
+		},
+		{
+			name: "too many short names",
+			fs: func(t *testing.T) *Fs {
+				return testingFormat(t, FormatOptions{Size: 16 * 1024 * 1024, FSType: FAT16})
+			},
+			names:        testingNames("F%03d.TXT", 600),
+			wantFit:      512,
+			wantOverflow: 88,
+		},
+		{
+			name: "long names need more slots",
+			fs: func(t *testing.T) *Fs {
+				return testingFormat(t, FormatOptions{Size: 16 * 1024 * 1024, FSType: FAT16})
+			},
+			// Each name needs two long filename slots and the short entry.
+			names:        testingNames("a long file name %03d", 200),
+			wantFit:      170,
+			wantOverflow: 30,
+		},
+		{
+			name: "FAT32 has no limit",
+			fs: func(t *testing.T) *Fs {
+				return testingNew(t, testFileReader(fat32))
+			},
+			names:   testingNames("F%03d.TXT", 600),
+			wantFit: 600,
+		},
+		{
+			name: "invalid name",
+			fs: func(t *testing.T) *Fs {
+				return testingNew(t, testFileReader(fat16))
+			},
+			names:   []string{"a/b"},
+			wantErr: ErrInvalidPath,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fit, overflow, err := tt.fs(t).PlanRoot(tt.names)
+			if !errors.Is(err, tt.wantErr) || (err != nil) != (tt.wantErr != nil) {
+				t.Fatalf("Fs.PlanRoot() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(fit) != tt.wantFit || len(overflow) != tt.wantOverflow {
+				t.Errorf("Fs.PlanRoot() = %v fit, %v overflow, want %v, %v", len(fit), len(overflow), tt.wantFit, tt.wantOverflow)
+			}
+		})
+	}
+}
+
+func TestFs_ApplyRootOverflow(t *testing.T) {
+	spec := Spec{Label: "OVERFLOW"}
+	for _, name := range testingNames("F%03d.TXT", 600) {
+		spec.Entries = append(spec.Entries, SpecEntry{Path: name, Content: "x"})
+	}
+
+	fs := testingFormat(t, FormatOptions{Size: 16 * 1024 * 1024, FSType: FAT16})
+	err := fs.Apply(spec, nil)
+	if !errors.Is(err, ErrDirectoryFull) {
+		t.Fatalf("Fs.Apply() error = %v, want %v", err, ErrDirectoryFull)
+	}
+	if names := readDirNames(t, fs, "."); len(names) != 0 || fs.Label() == "OVERFLOW" {
+		t.Fatalf("Fs.Apply() changed the filesystem before failing: %v", names)
+	}
+
+	spec.RootOverflow = "more"
+	if err := fs.Apply(spec, nil); err != nil {
+		t.Fatalf("Fs.Apply() error = %v", err)
+	}
+
+	// The label needs one slot and the overflow directory two, as "more" needs a long filename.
+	root := readDirNames(t, fs, ".")
+	more := readDirNames(t, fs, "more")
+	if len(root) != 510 || len(more) != 91 || more[len(more)-1] != "F599.TXT" {
+		t.Errorf("Fs.Apply() created %v entries in the root and %v in the overflow directory", len(root), len(more))
+	}
+}
@@ -0,0 +1,155 @@
+package gofat
+
+import "github.com/aligator/gofat/checkpoint"
+
+// Sanitize removes the remains of deleted data, so that an image can be shared without leaking it.
+// The slots of deleted entries (including their long filename slots) are zeroed except for the deletion marker,
+// as well as all slots behind the end marker of each directory. The slack space behind the end of each file in its
+// last cluster, clusters of a chain which are behind the size of its file and all free clusters are zeroed, too.
+// The content of the files, their entries and the FAT stay as they are.
+func (f *Fs) Sanitize() error {
+	err := f.mutate(Mutation{Op: OpSanitize}, func() error {
+		if err := f.sanitizeDir(0); err != nil {
+			return err
+		}
+
+		return f.zeroFreeClusters()
+	})
+	return checkpoint.Wrap(err, ErrWriteFilesystem)
+}
+
+// sanitizeDir wipes the deleted and unused slots of the directory starting at dirCluster, clears the slack space of
+// its files and descends into its subdirectories. Only the sectors which actually change are written.
+func (f *Fs) sanitizeDir(dirCluster fatEntry) error {
+	data, sectors, err := f.readDirSlots(dirCluster)
+	if err != nil {
+		return err
+	}
+
+	sectorSize := int(f.info.BytesPerSector)
+	changed := make(map[int]bool)
+	end := false
+	for i := 0; i < len(data)/entrySize; i++ {
+		slot := data[i*entrySize : (i+1)*entrySize]
+
+		// Everything behind the end marker is unused, even if it still contains old slots.
+		keep := 0
+		if !end && slot[0] == 0x00 {
+			end = true
+		} else if !end && slot[0] == 0xE5 {
+			keep = 1
+		} else if !end {
+			continue
+		}
+
+		for j := keep; j < len(slot); j++ {
+			if slot[j] != 0 {
+				slot[j] = 0
+				changed[i*entrySize/sectorSize] = true
+			}
+		}
+	}
+
+	for i, sectorNum := range sectors {
+		if !changed[i] {
+			continue
+		}
+
+		sector := data[i*sectorSize : (i+1)*sectorSize]
+		err := f.modifySector(sectorNum, func(buffer []byte) {
+			copy(buffer, sector)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	refs, err := f.parseDirRefs(data)
+	if err != nil {
+		return err
+	}
+
+	for _, ref := range refs {
+		if ref.firstCluster() == 0 {
+			continue
+		}
+
+		if ref.isDir() {
+			err = f.sanitizeDir(ref.firstCluster())
+		} else {
+			err = f.clearSlack(ref.firstCluster(), int64(ref.FileSize))
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// clearSlack zeroes everything in the chain starting at cluster which is behind the given size.
+func (f *Fs) clearSlack(cluster fatEntry, size int64) error {
+	chain, err := f.clusterChain(cluster)
+	if err != nil {
+		return err
+	}
+
+	clusterSize := f.clusterSize()
+	sectorSize := int64(f.info.BytesPerSector)
+	for i, cluster := range chain {
+		start := size - int64(i)*clusterSize
+		if start >= clusterSize {
+			continue
+		}
+
+		if start <= 0 {
+			if err := f.zeroCluster(cluster); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// Clear the rest of the sector containing the end of the file and then all following sectors.
+		sectorNum := f.firstSectorOfCluster(cluster) + uint32(start/sectorSize)
+		if inSector := start % sectorSize; inSector != 0 {
+			err := f.modifySector(sectorNum, func(buffer []byte) {
+				for j := inSector; j < sectorSize; j++ {
+					buffer[j] = 0
+				}
+			})
+			if err != nil {
+				return err
+			}
+			sectorNum++
+		}
+
+		rest := f.firstSectorOfCluster(cluster) + uint32(f.info.SectorsPerCluster) - sectorNum
+		if rest > 0 {
+			if err := f.storeSectors(sectorNum, make([]byte, int64(rest)*sectorSize)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// zeroFreeClusters overwrites all free clusters with zeros.
+func (f *Fs) zeroFreeClusters() error {
+	for cluster := fatEntry(2); cluster < fatEntry(f.info.ClusterCount)+2; cluster++ {
+		entry, err := f.getFatEntry(cluster)
+		if err != nil {
+			return checkpoint.Wrap(err, ErrReadFat)
+		}
+
+		if !entry.IsFree() {
+			continue
+		}
+
+		if err := f.zeroCluster(cluster); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,81 @@
+package gofat
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestFs_Sanitize(t *testing.T) {
+	image := testingImage(t)
+	if err := Format(image, FormatOptions{Size: 32 * 1024 * 1024}); err != nil {
+		t.Fatal(err)
+	}
+	fs, err := New(image)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	marker := []byte("ECRET")
+	secret := bytes.Repeat([]byte("SECRET"), 1000)
+	if err := fs.Mkdir("dir", 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"secret.txt", "dir/secret-with-long-name.txt", "truncated.txt", "dir/kept.txt"} {
+		if err := afero.WriteFile(fs, name, append([]byte("hello"), secret...), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Removed files leave their entries and data, truncated files leave the data behind their end.
+	if err := fs.Remove("secret.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Remove("dir/secret-with-long-name.txt"); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"truncated.txt", "dir/kept.txt"} {
+		file, err := fs.OpenFile(name, os.O_WRONLY, 0666)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := file.Truncate(5); err != nil {
+			t.Fatal(err)
+		}
+		if err := file.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if !bytes.Contains(image.data, marker) {
+		t.Fatal("the image does not contain the secret before sanitizing it")
+	}
+
+	if err := fs.Sanitize(); err != nil {
+		t.Fatalf("Fs.Sanitize() error = %v", err)
+	}
+
+	if i := bytes.Index(image.data, marker); i >= 0 {
+		t.Errorf("Fs.Sanitize() left the secret at offset %d", i)
+	}
+
+	for _, name := range []string{"truncated.txt", "dir/kept.txt"} {
+		data, err := afero.ReadFile(fs, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != "hello" {
+			t.Errorf("%v contains %q after Fs.Sanitize(), want %q", name, data, "hello")
+		}
+	}
+
+	report, err := fs.Check()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.OK() {
+		t.Errorf("Fs.Sanitize() broke the filesystem: %v", report.Findings)
+	}
+}
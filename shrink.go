@@ -0,0 +1,332 @@
+package gofat
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/aligator/gofat/checkpoint"
+)
+
+// ErrShrink may occur while shrinking a filesystem.
+var ErrShrink = errors.New("could not shrink the filesystem")
+
+// truncater is implemented by readers which can change their size (e.g. *os.File).
+type truncater interface {
+	Truncate(size int64) error
+}
+
+// Shrink reduces the size of the filesystem to newSize bytes.
+// All clusters above the new boundary are moved into free clusters below it, the FAT entries behind the boundary
+// are cleared and the sector count in the boot sector (and its backup) is updated.
+// If the reader supports Truncate (e.g. *os.File) it is truncated to the new size afterwards.
+//
+// The FAT itself keeps its size, so the data region does not have to be moved. This wastes a few sectors but
+// allows to shrink without rewriting all data.
+// The new size has to keep the FAT type, e.g. a FAT32 filesystem cannot be shrunk below 65525 clusters.
+// Use Clone to convert it into a smaller filesystem of another type.
+func (f *Fs) Shrink(newSize int64) error {
+	err := f.mutate(Mutation{Op: OpShrink}, func() error {
+		return f.shrink(newSize)
+	})
+	if err != nil {
+		return checkpoint.Wrap(err, ErrShrink)
+	}
+
+	if t, ok := f.reader.(truncater); ok {
+		err = t.Truncate(int64(f.info.TotalSectorCount) * int64(f.info.BytesPerSector))
+		if err != nil {
+			return checkpoint.Wrap(err, ErrShrink)
+		}
+	}
+
+	return nil
+}
+
+func (f *Fs) shrink(newSize int64) error {
+	totalSectors := newSize / int64(f.info.BytesPerSector)
+	if totalSectors >= int64(f.info.TotalSectorCount) {
+		return checkpoint.From(fmt.Errorf("%w: the new size %d is not smaller than the current size", ErrInvalidGeometry, newSize))
+	}
+
+	if totalSectors <= int64(f.info.FirstDataSector) {
+		return checkpoint.From(fmt.Errorf("%w: the size %d is too small", ErrInvalidGeometry, newSize))
+	}
+
+	clusterCount := (uint32(totalSectors) - f.info.FirstDataSector) / uint32(f.info.SectorsPerCluster)
+	switch {
+	case clusterCount == 0,
+		f.info.FSType == FAT16 && clusterCount < 4085,
+		f.info.FSType == FAT32 && clusterCount < 65525:
+		return checkpoint.From(fmt.Errorf("%w: the size %d is too small for %v", ErrInvalidGeometry, newSize, f.info.FSType))
+	}
+
+	// All clusters below limit stay in place.
+	limit := fatEntry(clusterCount + 2)
+
+	// Check if all used clusters fit below the boundary before changing anything.
+	var free, moving uint32
+	for cluster := fatEntry(2); cluster.Value() < f.info.ClusterCount+2; cluster++ {
+		entry, err := f.getFatEntry(cluster)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case cluster < limit && entry.IsFree():
+			free++
+		case cluster >= limit && !entry.IsFree() && !entry.IsBad():
+			moving++
+		}
+	}
+	if moving > free {
+		return checkpoint.From(fmt.Errorf("%w: %d clusters have to be moved but only %d are free", ErrFilesystemFull, moving, free))
+	}
+
+	r := relocator{fs: f, limit: limit, next: 2}
+
+	if f.info.FSType == FAT32 {
+		root, err := r.relocateChain(f.info.fat32Specific.RootCluster)
+		if err != nil {
+			return err
+		}
+
+		if root != f.info.fat32Specific.RootCluster {
+			err = f.updateBootSectors(func(buffer []byte) {
+				// BPB_RootClus
+				binary.LittleEndian.PutUint32(buffer[44:48], root.Value())
+			})
+			if err != nil {
+				return err
+			}
+			f.info.fat32Specific.RootCluster = root
+		}
+	}
+
+	err := r.relocateDir(0)
+	if err != nil {
+		return err
+	}
+
+	// Clear everything behind the boundary. This also drops lost chains which were not referenced by any entry.
+	for cluster := limit; cluster.Value() < f.info.ClusterCount+2; cluster++ {
+		entry, err := f.getFatEntry(cluster)
+		if err != nil {
+			return err
+		}
+
+		if !entry.IsFree() {
+			err = f.setFatEntry(cluster, 0)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	err = f.updateBootSectors(func(buffer []byte) {
+		// Use BPB_TotSec16 only if the value fits and the filesystem is not FAT32.
+		if totalSectors < 0x10000 && f.info.FSType != FAT32 {
+			binary.LittleEndian.PutUint16(buffer[19:21], uint16(totalSectors))
+			binary.LittleEndian.PutUint32(buffer[32:36], 0)
+		} else {
+			binary.LittleEndian.PutUint16(buffer[19:21], 0)
+			binary.LittleEndian.PutUint32(buffer[32:36], uint32(totalSectors))
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	f.info.TotalSectorCount = uint32(totalSectors)
+	f.info.ClusterCount = clusterCount
+
+	// Lost chains behind the boundary were dropped, so the free count has to be counted again.
+	free = 0
+	for cluster := fatEntry(2); cluster < limit; cluster++ {
+		entry, err := f.getFatEntry(cluster)
+		if err != nil {
+			return err
+		}
+
+		if entry.IsFree() {
+			free++
+		}
+	}
+
+	f.alloc.freeCount = free
+	f.alloc.nextFree = 2
+	f.alloc.dirty = true
+
+	return nil
+}
+
+// updateBootSectors applies the modification to the boot sector and, for FAT32, also to the backup boot sector.
+func (f *Fs) updateBootSectors(modify func(buffer []byte)) error {
+	err := f.modifySector(0, modify)
+	if err != nil {
+		return err
+	}
+
+	backup := f.info.fat32Specific.BkBootSector
+	if f.info.FSType == FAT32 && backup != 0 && backup != 0xFFFF {
+		return f.modifySector(uint32(backup), modify)
+	}
+
+	return nil
+}
+
+// relocator moves all clusters at or above limit into free clusters below it.
+type relocator struct {
+	fs    *Fs
+	limit fatEntry
+	// next is the cluster where the search for the next free cluster starts.
+	next fatEntry
+}
+
+// freeCluster returns the next free cluster below the limit.
+func (r *relocator) freeCluster() (fatEntry, error) {
+	for ; r.next < r.limit; r.next++ {
+		entry, err := r.fs.getFatEntry(r.next)
+		if err != nil {
+			return 0, err
+		}
+
+		if entry.IsFree() {
+			r.next++
+			return r.next - 1, nil
+		}
+	}
+
+	return 0, checkpoint.From(ErrFilesystemFull)
+}
+
+// relocateChain moves all clusters of the chain which are at or above the limit and returns the new first cluster.
+// The data is copied before the chain gets relinked, so an interruption leaves the old chain intact.
+func (r *relocator) relocateChain(first fatEntry) (fatEntry, error) {
+	chain, err := r.fs.clusterChain(first)
+	if err != nil || len(chain) == 0 {
+		return first, err
+	}
+
+	newChain := make([]fatEntry, len(chain))
+	var moved []fatEntry
+	for i, cluster := range chain {
+		newChain[i] = cluster
+		if cluster < r.limit {
+			continue
+		}
+
+		target, err := r.freeCluster()
+		if err != nil {
+			return first, err
+		}
+
+		// Reserve the cluster immediately.
+		err = r.fs.setFatEntry(target, eocMarker)
+		if err != nil {
+			return first, err
+		}
+
+		data, err := r.fs.readSectors(r.fs.firstSectorOfCluster(cluster), uint32(r.fs.info.SectorsPerCluster))
+		if err != nil {
+			return first, err
+		}
+
+		err = r.fs.storeSectors(r.fs.firstSectorOfCluster(target), data)
+		r.fs.buffers.put(data)
+		if err != nil {
+			return first, err
+		}
+
+		newChain[i] = target
+		moved = append(moved, cluster)
+	}
+
+	if len(moved) == 0 {
+		return first, nil
+	}
+
+	// Link the new chain from the end, so that each cluster points to an already valid successor.
+	for i := len(newChain) - 1; i >= 0; i-- {
+		next := eocMarker
+		if i < len(newChain)-1 {
+			next = newChain[i+1]
+		}
+
+		err = r.fs.setFatEntry(newChain[i], next)
+		if err != nil {
+			return first, err
+		}
+	}
+
+	for _, cluster := range moved {
+		err = r.fs.setFatEntry(cluster, 0)
+		if err != nil {
+			return first, err
+		}
+	}
+
+	return newChain[0], nil
+}
+
+// relocateDir relocates all entries of the directory starting at dirCluster (0 for the root directory)
+// and updates the entries to the new first clusters.
+func (r *relocator) relocateDir(dirCluster fatEntry) error {
+	refs, err := r.fs.readDirRefs(dirCluster)
+	if err != nil {
+		return err
+	}
+
+	for _, ref := range refs {
+		cluster, err := r.relocateChain(ref.firstCluster())
+		if err != nil {
+			return err
+		}
+
+		if cluster != ref.firstCluster() {
+			header := ref.EntryHeader
+			header.setFirstCluster(cluster)
+			err = r.fs.writeDirEntry(dirCluster, ref.index, header)
+			if err != nil {
+				return err
+			}
+		}
+
+		if !ref.isDir() || cluster == 0 {
+			continue
+		}
+
+		err = r.fixDotEntries(cluster, dirCluster)
+		if err != nil {
+			return err
+		}
+
+		err = r.relocateDir(cluster)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// fixDotEntries sets the clusters of the "." and ".." entries of the directory starting at cluster.
+func (r *relocator) fixDotEntries(cluster, parent fatEntry) error {
+	sectors, err := r.fs.dirSectors(cluster)
+	if err != nil {
+		return err
+	}
+
+	return r.fs.modifySector(sectors[0], func(buffer []byte) {
+		for i, target := range []fatEntry{cluster, parent} {
+			slot := buffer[i*32 : (i+1)*32]
+			if slot[0] != '.' {
+				continue
+			}
+
+			// DIR_FstClusHI and DIR_FstClusLO
+			binary.LittleEndian.PutUint16(slot[20:22], uint16(target.Value()>>16))
+			binary.LittleEndian.PutUint16(slot[26:28], uint16(target.Value()&0xFFFF))
+		}
+	})
+}
@@ -0,0 +1,114 @@
+package gofat
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestFs_Shrink(t *testing.T) {
+	const mib = 1024 * 1024
+
+	tests := []struct {
+		name    string
+		opts    FormatOptions
+		newSize int64
+		// nextFree moves the allocation behind the new boundary.
+		nextFree uint32
+		wantErr  error
+	}{
+		{
+			name:     "FAT16",
+			opts:     FormatOptions{Size: 64 * mib},
+			newSize:  24 * mib,
+			nextFree: 30000,
+		},
+		{
+			name:     "FAT32",
+			opts:     FormatOptions{Size: 128 * mib, FSType: FAT32, SectorsPerCluster: 2},
+			newSize:  80 * mib,
+			nextFree: 120000,
+		},
+		{
+			name:    "not smaller",
+			opts:    FormatOptions{Size: 64 * mib},
+			newSize: 64 * mib,
+			wantErr: ErrInvalidGeometry,
+		},
+		{
+			name:    "too small for FAT32",
+			opts:    FormatOptions{Size: 128 * mib, FSType: FAT32, SectorsPerCluster: 2},
+			newSize: 32 * mib,
+			wantErr: ErrInvalidGeometry,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			image := testingImage(t)
+			if err := Format(image, tt.opts); err != nil {
+				t.Fatal(err)
+			}
+			fs := testingNew(t, image)
+
+			fs.alloc.nextFree = tt.nextFree
+			data := testData(int(fs.clusterSize())*3 + 5)
+			if err := fs.MkdirAll("dir/sub", 0777); err != nil {
+				t.Fatal(err)
+			}
+			if err := afero.WriteFile(fs, "dir/sub/A long file name.txt", data, 0666); err != nil {
+				t.Fatal(err)
+			}
+			if err := afero.WriteFile(fs, "file.txt", data[:10], 0666); err != nil {
+				t.Fatal(err)
+			}
+
+			err := fs.Shrink(tt.newSize)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("Fs.Shrink() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Fs.Shrink() error = %v", err)
+			}
+
+			size, err := image.Seek(0, io.SeekEnd)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if size != tt.newSize {
+				t.Errorf("image size = %v, want %v", size, tt.newSize)
+			}
+
+			// Reopen the image to make sure everything got persisted.
+			fs = testingNew(t, image)
+			if got := int64(fs.info.TotalSectorCount) * int64(fs.info.BytesPerSector); got != tt.newSize {
+				t.Errorf("filesystem size = %v, want %v", got, tt.newSize)
+			}
+
+			got, err := afero.ReadFile(fs, "dir/sub/A long file name.txt")
+			if err != nil {
+				t.Fatalf("ReadFile() error = %v", err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Errorf("ReadFile() returned other data than written")
+			}
+
+			if got, _ := afero.ReadFile(fs, "file.txt"); !bytes.Equal(got, data[:10]) {
+				t.Errorf("ReadFile() = %v, want %v", got, data[:10])
+			}
+
+			// The moved directories must still be usable.
+			if err := afero.WriteFile(fs, "dir/sub/new.txt", data, 0666); err != nil {
+				t.Errorf("WriteFile() after Shrink error = %v", err)
+			}
+			if err := fs.RemoveAll("dir"); err != nil {
+				t.Errorf("RemoveAll() after Shrink error = %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package gofat
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/aligator/gofat/checkpoint"
+)
+
+// sortDir rewrites the directory starting at dirCluster so that all entries are sorted by name.
+// The "." and ".." entries and volume labels stay in front of all other entries. Deleted slots are removed.
+// It returns the new slot index of the entry with the given short name or -1 if it does not exist.
+func (f *Fs) sortDir(dirCluster fatEntry, shortName [11]byte) (int, error) {
+	data, sectors, err := f.readDirSlots(dirCluster)
+	if err != nil {
+		return -1, err
+	}
+
+	refs, err := f.parseDirRefs(data)
+	if err != nil {
+		return -1, err
+	}
+
+	sorted := make([]byte, 0, len(data))
+
+	// Keep all special entries which are not returned by parseDirRefs.
+	for i := 0; i < len(data)/32; i++ {
+		slot := data[i*32 : (i+1)*32]
+		if slot[0] == 0x00 {
+			break
+		}
+
+		attribute := slot[11]
+		if slot[0] == '.' || (slot[0] != 0xE5 && attribute&AttrLongName != AttrLongName && attribute&AttrVolumeId == AttrVolumeId) {
+			sorted = append(sorted, slot...)
+		}
+	}
+
+	sort.SliceStable(refs, func(i, j int) bool {
+		return strings.ToUpper(refs[i].FileInfo().Name()) < strings.ToUpper(refs[j].FileInfo().Name())
+	})
+
+	index := -1
+	for _, ref := range refs {
+		start := sorted
+		sorted = append(sorted, data[(ref.index-ref.lfnCount)*32:(ref.index+1)*32]...)
+
+		if ref.Name == shortName {
+			index = len(start)/32 + ref.lfnCount
+		}
+	}
+
+	// Everything behind the entries is free.
+	sorted = append(sorted, make([]byte, len(data)-len(sorted))...)
+
+	err = f.writeDirSlots(sectors, 0, sorted)
+	if err != nil {
+		return -1, err
+	}
+
+	return index, nil
+}
+
+// refreshRef returns the entry with its current position inside of its directory.
+// This is needed if the entries of the directory may have been moved since the ref was read (e.g. by sortDir).
+// The entry is identified by its short name which is unique inside of a directory.
+func (f *Fs) refreshRef(ref entryRef) (entryRef, error) {
+	if !f.sortEntries || ref.isRoot() {
+		return ref, nil
+	}
+
+	refs, err := f.readDirRefs(ref.dirCluster)
+	if err != nil {
+		return entryRef{}, err
+	}
+
+	for _, current := range refs {
+		if current.Name == ref.Name {
+			return current, nil
+		}
+	}
+
+	return entryRef{}, checkpoint.Wrap(os.ErrNotExist, fmt.Errorf("%w: the entry '%v' does not exist anymore", ErrInvalidPath, shortNameString(ref.Name)))
+}
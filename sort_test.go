@@ -0,0 +1,103 @@
+package gofat
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestFs_SortEntries(t *testing.T) {
+	image := testingImage(t)
+	if err := Format(image, FormatOptions{Size: 32 * 1024 * 1024, Label: "SORTED"}); err != nil {
+		t.Fatal(err)
+	}
+
+	fs, err := NewWithOptions(image, Options{SortEntries: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Keep a file open while other entries are added in front of it.
+	file, err := fs.Create("z.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"b.txt", "A long file name.txt", "C"} {
+		if err := afero.WriteFile(fs, name, []byte(name), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := fs.Mkdir("dir", 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := afero.WriteFile(fs, "dir/y", nil, 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := afero.WriteFile(fs, "dir/x", nil, 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Remove("b.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Rename("C", "0"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := file.WriteString("content"); err != nil {
+		t.Fatalf("WriteString() error = %v", err)
+	}
+	if err := file.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		dir  fatEntry
+		want []string
+	}{
+		{
+			name: "root",
+			dir:  0,
+			want: []string{"0", "A long file name.txt", "dir", "z.txt"},
+		},
+		{
+			name: "subdirectory",
+			dir: func() fatEntry {
+				ref, err := fs.resolve("dir")
+				if err != nil {
+					t.Fatal(err)
+				}
+				return ref.firstCluster()
+			}(),
+			want: []string{"x", "y"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			refs, err := fs.readDirRefs(tt.dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			for _, ref := range refs {
+				got = append(got, ref.FileInfo().Name())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("directory order = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if got, _ := afero.ReadFile(fs, "z.txt"); string(got) != "content" {
+		t.Errorf("ReadFile() = %q, want %q", got, "content")
+	}
+	if got, _ := afero.ReadFile(fs, "0"); string(got) != "C" {
+		t.Errorf("ReadFile() = %q, want %q", got, "C")
+	}
+	if fs.Label() != "SORTED" {
+		t.Errorf("Fs.Label() = %v, want SORTED", fs.Label())
+	}
+}
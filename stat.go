@@ -6,12 +6,86 @@ import (
 	"time"
 )
 
+// FileInfo is implemented by all os.FileInfo values returned by GoFAT.
+// It provides the FAT specific timestamps which do not fit into os.FileInfo.
+//
+//	info, err := fs.Stat("file")
+//	...
+//	created := info.(gofat.FileInfo).CreateTime()
+type FileInfo interface {
+	os.FileInfo
+
+	// CreateTime returns the creation time including the CreateTimeTenth field which adds 10 ms units
+	// to the 2 second granularity.
+	// It returns time.Time{} if the creation date is not set or invalid.
+	CreateTime() time.Time
+
+	// AccessDate returns the date of the last access. FAT does not store the time of it.
+	// It returns time.Time{} if the date is not set or invalid.
+	AccessDate() time.Time
+
+	// Entry returns the raw directory entry, e.g. to access the timestamps exactly as they are stored.
+	Entry() EntryHeader
+
+	// NTReserved returns the reserved byte of the entry. Windows stores the case of short names in it
+	// and some vendors use it for their own flags.
+	NTReserved() byte
+}
+
+// FileInfo returns the FileInfo of the entry with the permissions of DefaultFileMode.
+// The FileInfos returned by an Fs use Options.FileMode instead.
 func (h *ExtendedEntryHeader) FileInfo() os.FileInfo {
-	return entryHeaderFileInfo{*h}
+	return (*modeMapper)(nil).fileInfo(h)
+}
+
+// DefaultFileMode maps the entries to the permissions returned by FileInfo.Mode if Options.FileMode is nil:
+// 0555 for directories and 0444 for files. As they have no write permissions, entries with the read only
+// attribute look the same. Use Options.FileMode to report writable permissions.
+func DefaultFileMode(header EntryHeader) os.FileMode {
+	if header.Attribute&AttrDirectory == AttrDirectory {
+		return 0555
+	}
+	return 0444
+}
+
+// modeMapper maps the entries to the modes of their FileInfos, see Options.FileMode.
+// A nil modeMapper uses DefaultFileMode.
+type modeMapper struct {
+	mapping func(header EntryHeader) os.FileMode
+	// readOnly removes all write permissions as the filesystem cannot be written.
+	readOnly bool
+}
+
+func newModeMapper(mapping func(header EntryHeader) os.FileMode, readOnly bool) *modeMapper {
+	if mapping == nil {
+		mapping = DefaultFileMode
+	}
+	return &modeMapper{mapping: mapping, readOnly: readOnly}
+}
+
+// fileInfo returns the FileInfo of the entry with the mapped mode.
+func (m *modeMapper) fileInfo(h *ExtendedEntryHeader) os.FileInfo {
+	var mode os.FileMode
+	if m == nil {
+		mode = DefaultFileMode(h.EntryHeader)
+	} else {
+		mode = m.mapping(h.EntryHeader)
+		if m.readOnly {
+			mode &^= 0222
+		}
+	}
+
+	// Only the permissions can be mapped, the type always matches the entry.
+	mode &= os.ModePerm
+	if h.Attribute&AttrDirectory == AttrDirectory {
+		mode |= os.ModeDir
+	}
+	return entryHeaderFileInfo{entry: *h, mode: mode}
 }
 
 type entryHeaderFileInfo struct {
 	entry ExtendedEntryHeader
+	mode  os.FileMode
 }
 
 func (e entryHeaderFileInfo) Name() string {
@@ -34,10 +108,7 @@ func (e entryHeaderFileInfo) Size() int64 {
 }
 
 func (e entryHeaderFileInfo) Mode() os.FileMode {
-	if e.IsDir() {
-		return os.ModeDir
-	}
-	return 0
+	return e.mode
 }
 
 func (e entryHeaderFileInfo) ModTime() time.Time {
@@ -53,6 +124,35 @@ func (e entryHeaderFileInfo) ModTime() time.Time {
 	return time.Date(writeDate.Year(), writeDate.Month(), writeDate.Day(), writeTime.Hour(), writeTime.Minute(), writeTime.Second(), 0, time.UTC)
 }
 
+func (e entryHeaderFileInfo) CreateTime() time.Time {
+	createDate := ParseDate(e.entry.CreateDate)
+	createTime := ParseTime(e.entry.CreateTime)
+
+	if createDate.IsZero() {
+		return time.Time{}
+	}
+
+	// CreateTimeTenth has a valid range of 0-199, which are 0-1990 ms.
+	tenth := time.Duration(e.entry.CreateTimeTenth) * 10 * time.Millisecond
+	if e.entry.CreateTimeTenth > 199 {
+		tenth = 0
+	}
+
+	return time.Date(createDate.Year(), createDate.Month(), createDate.Day(), createTime.Hour(), createTime.Minute(), createTime.Second(), 0, time.UTC).Add(tenth)
+}
+
+func (e entryHeaderFileInfo) AccessDate() time.Time {
+	return ParseDate(e.entry.LastAccessDate)
+}
+
+func (e entryHeaderFileInfo) Entry() EntryHeader {
+	return e.entry.EntryHeader
+}
+
+func (e entryHeaderFileInfo) NTReserved() byte {
+	return e.entry.NTReserved
+}
+
 func (e entryHeaderFileInfo) IsDir() bool {
 	return e.entry.Attribute&0x10 == 0x10
 }
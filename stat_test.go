@@ -1,6 +1,7 @@
 package gofat
 
 import (
+	"io"
 	"os"
 	"reflect"
 	"testing"
@@ -54,6 +55,7 @@ func TestExtendedEntryHeader_FileInfo(t *testing.T) {
 					},
 					ExtendedName: "huhu",
 				},
+				mode: os.ModeDir | 0555,
 			},
 		},
 	}
@@ -196,45 +198,116 @@ func Test_entryHeaderFileInfo_Size(t *testing.T) {
 	}
 }
 
-func Test_entryHeaderFileInfo_Mode(t *testing.T) {
-	type fields struct {
-		entry ExtendedEntryHeader
+func Test_modeMapper_fileInfo(t *testing.T) {
+	executable := func(header EntryHeader) os.FileMode {
+		// The type bits are ignored.
+		return os.ModeSymlink | 0777
 	}
+
 	tests := []struct {
 		name   string
-		fields fields
+		mapper *modeMapper
+		entry  EntryHeader
 		want   os.FileMode
 	}{
-		{
-			name: "No directory",
-			fields: fields{
-				entry: ExtendedEntryHeader{
-					EntryHeader: EntryHeader{
-						Attribute: 0,
-					},
-				},
-			},
-			want: 0,
-		},
-		{
-			name: "Directory",
-			fields: fields{
-				entry: ExtendedEntryHeader{
-					EntryHeader: EntryHeader{
-						Attribute: AttrDirectory,
-					},
-				},
-			},
-			want: os.ModeDir,
-		},
+		{name: "File", entry: EntryHeader{Attribute: AttrArchive}, want: 0444},
+		{name: "Directory", entry: EntryHeader{Attribute: AttrDirectory}, want: os.ModeDir | 0555},
+		{name: "Read only file", entry: EntryHeader{Attribute: AttrReadOnly}, want: 0444},
+		{name: "Read only directory", entry: EntryHeader{Attribute: AttrDirectory | AttrReadOnly}, want: os.ModeDir | 0555},
+		{name: "Read only filesystem", mapper: newModeMapper(nil, true), entry: EntryHeader{}, want: 0444},
+		{name: "Writable filesystem", mapper: newModeMapper(nil, false), entry: EntryHeader{Attribute: AttrDirectory}, want: os.ModeDir | 0555},
+		{name: "Custom mapping", mapper: newModeMapper(executable, false), entry: EntryHeader{}, want: 0777},
+		{name: "Custom mapping of a directory", mapper: newModeMapper(executable, false), entry: EntryHeader{Attribute: AttrDirectory}, want: os.ModeDir | 0777},
+		{name: "Custom mapping on a read only filesystem", mapper: newModeMapper(executable, true), entry: EntryHeader{}, want: 0555},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			e := entryHeaderFileInfo{
-				entry: tt.fields.entry,
+			if got := tt.mapper.fileInfo(&ExtendedEntryHeader{EntryHeader: tt.entry}).Mode(); got != tt.want {
+				t.Errorf("modeMapper.fileInfo().Mode() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOptions_FileMode(t *testing.T) {
+	readOnly := testingNew(t, struct{ io.ReadSeeker }{testFileReader(fat16)})
+	writable, err := NewWithOptions(testingCopy(t, fat16), Options{FileMode: func(header EntryHeader) os.FileMode {
+		return 0600
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		fs   *Fs
+		want os.FileMode
+	}{
+		{name: "read only", fs: readOnly, want: 0444},
+		{name: "custom mapping", fs: writable, want: 0600},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// All ways to get a FileInfo use the mapping.
+			var infos []os.FileInfo
+			info, err := tt.fs.Stat("go/main.go")
+			if err != nil {
+				t.Fatal(err)
+			}
+			infos = append(infos, info)
+
+			file, err := tt.fs.Open("go/main.go")
+			if err != nil {
+				t.Fatal(err)
 			}
-			if got := e.Mode(); got != tt.want {
-				t.Errorf("entryHeaderFileInfo.Mode() = %v, want %v", got, tt.want)
+			defer file.Close()
+			info, err = file.Stat()
+			if err != nil {
+				t.Fatal(err)
+			}
+			infos = append(infos, info)
+
+			dir, err := tt.fs.Open("go")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer dir.Close()
+			listed, err := dir.Readdir(-1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			infos = append(infos, listed...)
+
+			listed, err = tt.fs.StatAll([]string{"go/main.go"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			infos = append(infos, listed...)
+
+			listed, _, err = tt.fs.ListPage("go", "", 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			infos = append(infos, listed...)
+
+			info, err = GoFs{tt.fs}.Stat("go/main.go")
+			if err != nil {
+				t.Fatal(err)
+			}
+			infos = append(infos, info)
+
+			for i, info := range infos {
+				if info.Mode() != tt.want {
+					t.Errorf("FileInfo %d of %v has the mode %v, want %v", i, info.Name(), info.Mode(), tt.want)
+				}
+			}
+
+			root, err := tt.fs.Stat(".")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !root.Mode().IsDir() || root.Mode().Perm() == 0 {
+				t.Errorf("the root directory has the mode %v, want a directory with permissions", root.Mode())
 			}
 		})
 	}
@@ -405,6 +478,64 @@ func Test_entryHeaderFileInfo_ModTime(t *testing.T) {
 	}
 }
 
+func Test_entryHeaderFileInfo_CreateTime(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry EntryHeader
+		want  time.Time
+	}{
+		{
+			name:  "without tenth",
+			entry: EntryHeader{CreateTime: 41936, CreateDate: 20890},
+			want:  time.Date(2020, 12, 26, 20, 30, 32, 0, time.UTC),
+		},
+		{
+			name:  "with the odd second and 10 ms units",
+			entry: EntryHeader{CreateTimeTenth: 157, CreateTime: 41936, CreateDate: 20890},
+			want:  time.Date(2020, 12, 26, 20, 30, 33, int(570*time.Millisecond), time.UTC),
+		},
+		{
+			name:  "an invalid tenth is ignored",
+			entry: EntryHeader{CreateTimeTenth: 200, CreateTime: 41936, CreateDate: 20890},
+			want:  time.Date(2020, 12, 26, 20, 30, 32, 0, time.UTC),
+		},
+		{
+			name:  "a zero create date results in time.Time.IsZero() == true",
+			entry: EntryHeader{CreateTimeTenth: 10, CreateTime: 41936},
+			want:  time.Time{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := entryHeaderFileInfo{entry: ExtendedEntryHeader{EntryHeader: tt.entry}}
+			if got := e.CreateTime(); !got.Equal(tt.want) {
+				t.Errorf("entryHeaderFileInfo.CreateTime() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_entryHeaderFileInfo_AccessDate(t *testing.T) {
+	e := entryHeaderFileInfo{entry: ExtendedEntryHeader{EntryHeader: EntryHeader{LastAccessDate: 20890}}}
+	if got, want := e.AccessDate(), time.Date(2020, 12, 26, 0, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("entryHeaderFileInfo.AccessDate() = %v, want %v", got, want)
+	}
+}
+
+func Test_entryHeaderFileInfo_Entry(t *testing.T) {
+	entry := EntryHeader{Name: [11]byte{'A'}, CreateTimeTenth: 123, CreateTime: 1, WriteTime: 3, NTReserved: 0x18}
+
+	var info os.FileInfo = entryHeaderFileInfo{entry: ExtendedEntryHeader{EntryHeader: entry, ExtendedName: "a"}}
+	fatInfo, ok := info.(FileInfo)
+	if !ok {
+		t.Fatalf("entryHeaderFileInfo does not implement FileInfo")
+	}
+
+	if got := fatInfo.Entry(); got != entry {
+		t.Errorf("entryHeaderFileInfo.Entry() = %v, want %v", got, entry)
+	}
+}
+
 func Test_entryHeaderFileInfo_IsDir(t *testing.T) {
 	type fields struct {
 		entry ExtendedEntryHeader
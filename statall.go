@@ -0,0 +1,100 @@
+package gofat
+
+import (
+	"os"
+	"path"
+	"strings"
+
+	"github.com/aligator/gofat/checkpoint"
+)
+
+// StatAll returns the FileInfo of each of the paths in the same order. It is nil if the path does not exist.
+// The paths are grouped by their parent directories, so each directory is read only once, which is much faster
+// than calling Stat for each path, e.g. to compare many paths against a manifest.
+// An error is only returned if a path is invalid or a directory cannot be read.
+func (f *Fs) StatAll(paths []string) ([]os.FileInfo, error) {
+	s := &batchStat{
+		fs:       f,
+		dirs:     make(map[fatEntry][]entryRef),
+		resolved: map[string]*entryRef{"": refPointer(rootRef())},
+	}
+
+	infos := make([]os.FileInfo, len(paths))
+	for i, name := range paths {
+		cleaned, err := cleanPath(name)
+		if err != nil {
+			return nil, checkpoint.Wrap(err, ErrOpenFilesystem)
+		}
+
+		ref, err := s.resolve(cleaned)
+		if err != nil {
+			return nil, checkpoint.Wrap(err, ErrOpenFilesystem)
+		}
+
+		if ref != nil {
+			infos[i] = f.modes.fileInfo(&ref.ExtendedEntryHeader)
+		}
+	}
+
+	return infos, nil
+}
+
+// batchStat caches the directories and resolved paths of a StatAll.
+type batchStat struct {
+	fs *Fs
+	// dirs contains the entries of all directories read so far by their cluster.
+	dirs map[fatEntry][]entryRef
+	// resolved contains the entries of all paths resolved so far. They are nil if the path does not exist.
+	resolved map[string]*entryRef
+}
+
+// resolve returns the entry of the cleaned path or nil if it does not exist.
+func (s *batchStat) resolve(cleaned string) (*entryRef, error) {
+	if ref, ok := s.resolved[cleaned]; ok {
+		return ref, nil
+	}
+
+	parentPath, name := path.Split(cleaned)
+	parent, err := s.resolve(strings.TrimSuffix(parentPath, "/"))
+	if err != nil {
+		return nil, err
+	}
+
+	var ref *entryRef
+	if parent != nil && parent.isDir() {
+		ref, err = s.lookup(*parent, name)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	s.resolved[cleaned] = ref
+	return ref, nil
+}
+
+// lookup searches the entry with the given name inside of the directory. Each directory is read only once.
+func (s *batchStat) lookup(dir entryRef, name string) (*entryRef, error) {
+	dirCluster := s.fs.entryDirCluster(dir)
+	refs, ok := s.dirs[dirCluster]
+	if !ok {
+		var err error
+		refs, err = s.fs.readDirRefs(dirCluster)
+		if err != nil {
+			return nil, err
+		}
+		s.dirs[dirCluster] = refs
+	}
+
+	for _, ref := range refs {
+		if s.fs.match(ref.FileInfo().Name(), name) {
+			return refPointer(ref), nil
+		}
+	}
+
+	return nil, nil
+}
+
+// refPointer returns a pointer to a copy of the entry.
+func refPointer(ref entryRef) *entryRef {
+	return &ref
+}
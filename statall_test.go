@@ -0,0 +1,94 @@
+package gofat
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestFs_StatAll(t *testing.T) {
+	tests := []struct {
+		name      string
+		paths     []string
+		want      []string
+		wantReads uint64
+		wantErr   error
+	}{
+		{
+			name:  "mixed paths",
+			paths: []string{"go/main.go", "README.md", "go/missing.go", "DoNotEdit_tests/README.md", "go", "."},
+			want:  []string{"main.go", "README.md", "<nil>", "README.md", "go", ""},
+		},
+		{
+			name:  "case insensitive",
+			paths: []string{"GO/MAIN.GO"},
+			want:  []string{"main.go"},
+		},
+		{
+			name:  "below missing and files",
+			paths: []string{"missing/file", "README.md/file"},
+			want:  []string{"<nil>", "<nil>"},
+		},
+		{
+			name:    "invalid path",
+			paths:   []string{"go", "/go"},
+			wantErr: ErrInvalidPath,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := testingNew(t, testFileReader(fat16))
+			got, err := fs.StatAll(tt.paths)
+			if !errors.Is(err, tt.wantErr) || (err != nil) != (tt.wantErr != nil) {
+				t.Fatalf("Fs.StatAll() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			names := make([]string, len(got))
+			for i, info := range got {
+				names[i] = "<nil>"
+				if info != nil {
+					names[i] = info.Name()
+				}
+			}
+			if !reflect.DeepEqual(names, tt.want) {
+				t.Errorf("Fs.StatAll() = %v, want %v", names, tt.want)
+			}
+		})
+	}
+}
+
+// dirParseCounter counts how often each directory is parsed.
+type dirParseCounter struct {
+	*testTracer
+	parsed map[uint32]int
+}
+
+func (c dirParseCounter) DirParse(cluster uint32, sectors []uint32, trace Trace) {
+	c.parsed[cluster]++
+}
+
+func TestFs_StatAllReadsOnce(t *testing.T) {
+	counter := dirParseCounter{testTracer: newTestTracer(), parsed: make(map[uint32]int)}
+	fs, err := NewWithOptions(testFileReader(fat16), Options{IndexSize: -1, Tracer: counter})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = fs.StatAll([]string{"go/main.go", "go/a", "go/b", "DoNotEdit_tests/README.md", "DoNotEdit_tests/c", "README.md"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The root, go and DoNotEdit_tests.
+	if len(counter.parsed) != 3 {
+		t.Errorf("Fs.StatAll() read the directories %v, want the root, go and DoNotEdit_tests", counter.parsed)
+	}
+	for cluster, count := range counter.parsed {
+		if count != 1 {
+			t.Errorf("Fs.StatAll() read the directory at cluster %v %v times, want once", cluster, count)
+		}
+	}
+}
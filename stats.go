@@ -0,0 +1,75 @@
+package gofat
+
+import "sync/atomic"
+
+// Stats contains counters about the work done by a filesystem, e.g. to measure the effect of the cache size.
+// They count from the moment the filesystem was opened or the last call of Fs.ResetStats.
+type Stats struct {
+	// SectorsFetched is the count of sectors read from the reader.
+	SectorsFetched uint64
+	// BytesRead is the count of bytes read from the reader.
+	BytesRead uint64
+	// SectorsWritten is the count of sectors written to the reader.
+	SectorsWritten uint64
+	// BytesWritten is the count of bytes written to the reader.
+	BytesWritten uint64
+	// CacheHits is the count of sector reads which were served by the sector cache.
+	CacheHits uint64
+	// CacheMisses is the count of sector reads which needed to read the sector from the reader.
+	CacheMisses uint64
+	// FatLookups is the count of FAT entries which were looked up, e.g. while following cluster chains.
+	FatLookups uint64
+}
+
+// statistics holds the counters of a filesystem. It is shared by all copies of the Fs.
+// All fields are only accessed atomically.
+type statistics struct {
+	sectorsFetched uint64
+	bytesRead      uint64
+	sectorsWritten uint64
+	bytesWritten   uint64
+	cacheHits      uint64
+	cacheMisses    uint64
+	fatLookups     uint64
+}
+
+// read counts the given count of sectors read from the reader.
+func (s *statistics) read(sectors uint64, bytes int) {
+	atomic.AddUint64(&s.sectorsFetched, sectors)
+	atomic.AddUint64(&s.bytesRead, uint64(bytes))
+}
+
+// written counts the given count of sectors written to the reader.
+func (s *statistics) written(sectors uint64, bytes int) {
+	atomic.AddUint64(&s.sectorsWritten, sectors)
+	atomic.AddUint64(&s.bytesWritten, uint64(bytes))
+}
+
+// Stats returns the current counters of the filesystem.
+// Copies of the filesystem (e.g. by WithContext) share the counters.
+func (f *Fs) Stats() Stats {
+	return Stats{
+		SectorsFetched: atomic.LoadUint64(&f.stats.sectorsFetched),
+		BytesRead:      atomic.LoadUint64(&f.stats.bytesRead),
+		SectorsWritten: atomic.LoadUint64(&f.stats.sectorsWritten),
+		BytesWritten:   atomic.LoadUint64(&f.stats.bytesWritten),
+		CacheHits:      atomic.LoadUint64(&f.stats.cacheHits),
+		CacheMisses:    atomic.LoadUint64(&f.stats.cacheMisses),
+		FatLookups:     atomic.LoadUint64(&f.stats.fatLookups),
+	}
+}
+
+// ResetStats sets all counters back to 0.
+func (f *Fs) ResetStats() {
+	for _, counter := range []*uint64{
+		&f.stats.sectorsFetched,
+		&f.stats.bytesRead,
+		&f.stats.sectorsWritten,
+		&f.stats.bytesWritten,
+		&f.stats.cacheHits,
+		&f.stats.cacheMisses,
+		&f.stats.fatLookups,
+	} {
+		atomic.StoreUint64(counter, 0)
+	}
+}
@@ -0,0 +1,56 @@
+package gofat
+
+import (
+	"context"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestFs_Stats(t *testing.T) {
+	fs, err := NewWithOptions(testFileReader(fat16), Options{CacheSize: 4096})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fs.ResetStats()
+	if got := fs.Stats(); got != (Stats{}) {
+		t.Fatalf("Fs.Stats() after ResetStats() = %+v, want all 0", got)
+	}
+
+	if _, err := afero.ReadFile(fs, "DoNotEdit_tests/README.md"); err != nil {
+		t.Fatal(err)
+	}
+	first := fs.Stats()
+	if first.CacheMisses == 0 || first.SectorsFetched != first.CacheMisses || first.FatLookups == 0 {
+		t.Errorf("Fs.Stats() after the first read = %+v", first)
+	}
+	if first.BytesRead != first.SectorsFetched*uint64(fs.info.BytesPerSector) {
+		t.Errorf("Fs.Stats() counted %v bytes for %v sectors", first.BytesRead, first.SectorsFetched)
+	}
+
+	// Reading again only uses the cache. Copies share the counters.
+	if _, err := afero.ReadFile(fs.WithContext(context.Background()), "DoNotEdit_tests/README.md"); err != nil {
+		t.Fatal(err)
+	}
+	second := fs.Stats()
+	if second.CacheMisses != first.CacheMisses || second.SectorsFetched != first.SectorsFetched ||
+		second.CacheHits <= first.CacheHits {
+		t.Errorf("Fs.Stats() after the second read = %+v, want only more cache hits than %+v", second, first)
+	}
+}
+
+func TestFs_Stats_write(t *testing.T) {
+	fs := testingFormat(t, FormatOptions{Size: 32 * 1024 * 1024})
+	fs.ResetStats()
+
+	data := testData(int(fs.clusterSize()) * 2)
+	if err := afero.WriteFile(fs, "file", data, 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	got := fs.Stats()
+	if got.BytesWritten < uint64(len(data)) || got.BytesWritten != got.SectorsWritten*uint64(fs.info.BytesPerSector) {
+		t.Errorf("Fs.Stats() after writing %v bytes = %+v", len(data), got)
+	}
+}
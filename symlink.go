@@ -0,0 +1,248 @@
+package gofat
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/aligator/gofat/checkpoint"
+	"github.com/spf13/afero"
+)
+
+// ErrNoSymlink is returned (wrapped in an os.LinkError or os.PathError) by the symlink methods of Fs,
+// as FAT has no symlinks. It is the same error as afero.ErrNoSymlink, so checking for either one works.
+var ErrNoSymlink = afero.ErrNoSymlink
+
+// shortcutSizeLimit is the size up to which files are read to interpret them as shortcut.
+// Real shortcuts are only a few KiB big.
+const shortcutSizeLimit = 64 * 1024
+
+// shortcutCLSID is the class identifier every Windows shortcut (.lnk file) starts with.
+var shortcutCLSID = []byte{0x01, 0x14, 0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0xc0, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x46}
+
+// folderShortcutCLSID marks a directory as folder shortcut in its desktop.ini. Its target is the one of the
+// target.lnk in the directory.
+const folderShortcutCLSID = "{0AFACED1-E828-11D1-9187-B532F1E9575D}"
+
+// The flags of a shortcut telling which of the optional structures it contains.
+const (
+	shortcutHasTargetIDList = 1 << iota
+	shortcutHasLinkInfo
+	shortcutHasName
+	shortcutHasRelativePath
+	shortcutHasWorkingDir
+	shortcutHasArguments
+	shortcutHasIconLocation
+	shortcutIsUnicode
+)
+
+// SymlinkIfPossible always fails with ErrNoSymlink as FAT has no symlinks.
+func (f *Fs) SymlinkIfPossible(oldname, newname string) error {
+	return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: checkpoint.From(ErrNoSymlink)}
+}
+
+// ReadlinkIfPossible fails with ErrNoSymlink as FAT has no symlinks.
+// If Options.ResolveShortcuts is set, it returns the targets of shortcuts instead, see LstatIfPossible.
+func (f *Fs) ReadlinkIfPossible(name string) (string, error) {
+	if f.shortcuts {
+		target, ok, err := f.shortcutTarget(name)
+		if err != nil {
+			return "", &os.PathError{Op: "readlink", Path: name, Err: err}
+		}
+		if ok {
+			return target, nil
+		}
+	}
+
+	return "", &os.PathError{Op: "readlink", Path: name, Err: checkpoint.From(ErrNoSymlink)}
+}
+
+// LstatIfPossible returns the FileInfo of the path just like Stat. The returned bool is only true if
+// Options.ResolveShortcuts is set. Then Windows shortcuts (.lnk files) and folder shortcuts (directories with a
+// desktop.ini marking them as such) are reported with os.ModeSymlink, and ReadlinkIfPossible returns their targets.
+// Shortcuts are only interpreted when reading, they cannot be created.
+//
+// The target is the relative path stored in the shortcut with slashes as separator (e.g. "../docs/manual.pdf").
+// If there is none, it is the absolute Windows path (e.g. "C:/docs/manual.pdf"), which usually points outside
+// of the filesystem.
+func (f *Fs) LstatIfPossible(name string) (os.FileInfo, bool, error) {
+	info, err := f.Stat(name)
+	if err != nil || !f.shortcuts {
+		return info, false, err
+	}
+
+	// Invalid shortcuts are reported as they are, so that they can still be listed and read.
+	if _, ok, err := f.shortcutTarget(name); err == nil && ok {
+		info = symlinkFileInfo{info}
+	}
+	return info, true, nil
+}
+
+// symlinkFileInfo reports a shortcut as symlink.
+type symlinkFileInfo struct {
+	os.FileInfo
+}
+
+func (s symlinkFileInfo) Mode() os.FileMode {
+	return s.FileInfo.Mode().Perm() | os.ModeSymlink
+}
+
+func (s symlinkFileInfo) IsDir() bool {
+	return false
+}
+
+// shortcutTarget returns the target of the shortcut at the given path.
+// It returns false if the path is no shortcut.
+func (f *Fs) shortcutTarget(name string) (string, bool, error) {
+	info, err := f.Stat(name)
+	if err != nil {
+		return "", false, err
+	}
+
+	if info.IsDir() {
+		desktop, err := f.readShortcutFile(path.Join(name, "desktop.ini"))
+		if err != nil || !isFolderShortcut(desktop) {
+			// A directory without a valid desktop.ini is just a directory.
+			return "", false, nil
+		}
+		name = path.Join(name, "target.lnk")
+	} else if !strings.EqualFold(path.Ext(name), ".lnk") {
+		return "", false, nil
+	}
+
+	data, err := f.readShortcutFile(name)
+	if err != nil {
+		return "", false, err
+	}
+
+	target, err := parseShortcut(data)
+	if err != nil {
+		return "", false, checkpoint.From(fmt.Errorf("%w: %v", ErrNotSupported, err))
+	}
+	return target, true, nil
+}
+
+// readShortcutFile reads the file which is part of a shortcut.
+func (f *Fs) readShortcutFile(name string) ([]byte, error) {
+	file, err := f.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return io.ReadAll(io.LimitReader(file, shortcutSizeLimit))
+}
+
+// isFolderShortcut checks if the content of a desktop.ini marks its directory as folder shortcut.
+// The file may be encoded in UTF-16 (with BOM) or in an ANSI code page.
+func isFolderShortcut(desktop []byte) bool {
+	content := decodeShortcutString(desktop, bytes.HasPrefix(desktop, []byte{0xff, 0xfe}))
+	return strings.Contains(strings.ToUpper(content), "CLSID2="+folderShortcutCLSID)
+}
+
+// parseShortcut returns the target of a Windows shortcut as described in [MS-SHLLINK].
+// The relative path is preferred over the absolute one as it works inside of the filesystem.
+func parseShortcut(data []byte) (string, error) {
+	const headerSize = 76
+	if len(data) < headerSize || binary.LittleEndian.Uint32(data) != headerSize || !bytes.Equal(data[4:20], shortcutCLSID) {
+		return "", fmt.Errorf("invalid shortcut header")
+	}
+
+	flags := binary.LittleEndian.Uint32(data[20:])
+	offset := headerSize
+
+	if flags&shortcutHasTargetIDList != 0 {
+		if offset+2 > len(data) {
+			return "", io.ErrUnexpectedEOF
+		}
+		offset += 2 + int(binary.LittleEndian.Uint16(data[offset:]))
+	}
+
+	var absolute string
+	if flags&shortcutHasLinkInfo != 0 {
+		if offset+28 > len(data) {
+			return "", io.ErrUnexpectedEOF
+		}
+		info := data[offset:]
+		size := int(binary.LittleEndian.Uint32(info))
+		if size < 28 || size > len(info) {
+			return "", io.ErrUnexpectedEOF
+		}
+		info = info[:size]
+
+		// Only links with a local base path have an absolute path, links to network shares are not supported.
+		if binary.LittleEndian.Uint32(info[8:])&1 != 0 {
+			absolute = cString(info, binary.LittleEndian.Uint32(info[16:])) + cString(info, binary.LittleEndian.Uint32(info[24:]))
+		}
+		offset += size
+	}
+
+	var relative string
+	for _, flag := range []uint32{shortcutHasName, shortcutHasRelativePath} {
+		if flags&flag == 0 {
+			continue
+		}
+
+		if offset+2 > len(data) {
+			return "", io.ErrUnexpectedEOF
+		}
+		length := int(binary.LittleEndian.Uint16(data[offset:]))
+		if flags&shortcutIsUnicode != 0 {
+			length *= 2
+		}
+		offset += 2
+		if offset+length > len(data) {
+			return "", io.ErrUnexpectedEOF
+		}
+
+		if flag == shortcutHasRelativePath {
+			relative = decodeShortcutString(data[offset:offset+length], flags&shortcutIsUnicode != 0)
+		}
+		offset += length
+	}
+
+	switch {
+	case relative != "":
+		return path.Clean(strings.ReplaceAll(relative, "\\", "/")), nil
+	case absolute != "":
+		return strings.ReplaceAll(absolute, "\\", "/"), nil
+	default:
+		return "", fmt.Errorf("the shortcut has no target path")
+	}
+}
+
+// cString returns the null terminated string at the given offset. It is empty if the offset is out of range.
+func cString(data []byte, offset uint32) string {
+	if offset == 0 || int(offset) >= len(data) {
+		return ""
+	}
+
+	data = data[offset:]
+	if end := bytes.IndexByte(data, 0); end >= 0 {
+		data = data[:end]
+	}
+	return string(data)
+}
+
+// decodeShortcutString decodes UTF-16LE (if unicode is set) or single byte strings.
+// Single bytes are interpreted as Latin-1, which matches the ASCII part of all Windows code pages.
+func decodeShortcutString(data []byte, unicode bool) string {
+	if !unicode {
+		runes := make([]rune, len(data))
+		for i, b := range data {
+			runes[i] = rune(b)
+		}
+		return string(runes)
+	}
+
+	chars := make([]uint16, len(data)/2)
+	for i := range chars {
+		chars[i] = binary.LittleEndian.Uint16(data[i*2:])
+	}
+	return strings.TrimPrefix(string(utf16.Decode(chars)), "\ufeff")
+}
@@ -0,0 +1,147 @@
+package gofat
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/spf13/afero"
+)
+
+// testShortcut builds a shortcut with the given local base path and, if it is not empty, the relative path
+// stored as UTF-16.
+func testShortcut(absolute string, relative string) []byte {
+	flags := uint32(shortcutHasLinkInfo)
+	if relative != "" {
+		flags |= shortcutHasRelativePath | shortcutIsUnicode
+	}
+
+	data := make([]byte, 76)
+	binary.LittleEndian.PutUint32(data, 76)
+	copy(data[4:], shortcutCLSID)
+	binary.LittleEndian.PutUint32(data[20:], flags)
+
+	info := make([]byte, 28)
+	binary.LittleEndian.PutUint32(info[8:], 1)
+	binary.LittleEndian.PutUint32(info[16:], 28)
+	info = append(info, absolute...)
+	info = append(info, 0)
+	binary.LittleEndian.PutUint32(info[24:], uint32(len(info)))
+	info = append(info, 0)
+	binary.LittleEndian.PutUint32(info, uint32(len(info)))
+	data = append(data, info...)
+
+	if relative != "" {
+		chars := append([]uint16{0}, utf16.Encode([]rune(relative))...)
+		chars[0] = uint16(len(chars) - 1)
+		for _, c := range chars {
+			data = append(data, byte(c), byte(c>>8))
+		}
+	}
+	return data
+}
+
+func Test_parseShortcut(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		want    string
+		wantErr bool
+	}{
+		{name: "relative path", data: testShortcut(`C:\docs\manual.pdf`, `..\docs\manuäl.pdf`), want: "../docs/manuäl.pdf"},
+		{name: "absolute path", data: testShortcut(`C:\docs\manual.pdf`, ""), want: "C:/docs/manual.pdf"},
+		{name: "no target", data: testShortcut("", ""), wantErr: true},
+		{name: "truncated", data: testShortcut(`C:\docs\manual.pdf`, `..\docs`)[:110], wantErr: true},
+		{name: "no shortcut", data: make([]byte, 100), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseShortcut(tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseShortcut() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseShortcut() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFs_symlinks(t *testing.T) {
+	for _, resolve := range []bool{false, true} {
+		fs, err := NewWithOptions(testingCopy(t, fat32), Options{ResolveShortcuts: resolve})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		files := map[string][]byte{
+			"manual.lnk":         testShortcut(`C:\docs\manual.pdf`, `docs\manual.pdf`),
+			"broken.lnk":         []byte("no shortcut"),
+			"folder/desktop.ini": []byte("[.ShellClassInfo]\r\nCLSID2={0AFACED1-E828-11D1-9187-B532F1E9575D}\r\n"),
+			"folder/target.lnk":  testShortcut(`D:\music`, ""),
+			"plain/desktop.ini":  []byte("[.ShellClassInfo]\r\nIconResource=icon.ico\r\n"),
+		}
+		for _, dir := range []string{"folder", "plain"} {
+			if err := fs.Mkdir(dir, 0755); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for name, data := range files {
+			if err := afero.WriteFile(fs, name, data, 0666); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if err := fs.SymlinkIfPossible("manual.lnk", "link"); !errors.Is(err, ErrNoSymlink) {
+			t.Errorf("Fs.SymlinkIfPossible() error = %v, want %v", err, ErrNoSymlink)
+		}
+
+		tests := []struct {
+			name     string
+			want     string
+			wantMode os.FileMode
+		}{
+			{name: "manual.lnk", want: "docs/manual.pdf", wantMode: os.ModeSymlink},
+			{name: "folder", want: "D:/music", wantMode: os.ModeSymlink},
+			{name: "broken.lnk"},
+			{name: "plain", wantMode: os.ModeDir},
+			{name: "go/main.go"},
+		}
+		for _, tt := range tests {
+			if !resolve {
+				// Without interpreting the shortcuts they are just the files they are.
+				if tt.wantMode == os.ModeSymlink {
+					tt.wantMode = 0
+					if tt.name == "folder" {
+						tt.wantMode = os.ModeDir
+					}
+				}
+				tt.want = ""
+			}
+
+			info, lstat, err := fs.LstatIfPossible(tt.name)
+			if err != nil {
+				t.Fatalf("Fs.LstatIfPossible(%v) error = %v", tt.name, err)
+			}
+			if lstat != resolve {
+				t.Errorf("Fs.LstatIfPossible(%v) used lstat = %v, want %v", tt.name, lstat, resolve)
+			}
+			if info.Mode().Type() != tt.wantMode {
+				t.Errorf("Fs.LstatIfPossible(%v) mode = %v, want type %v", tt.name, info.Mode(), tt.wantMode)
+			}
+
+			target, err := fs.ReadlinkIfPossible(tt.name)
+			if tt.want == "" {
+				if !errors.Is(err, ErrNoSymlink) && (tt.name != "broken.lnk" || !resolve) {
+					t.Errorf("Fs.ReadlinkIfPossible(%v) error = %v, want %v", tt.name, err, ErrNoSymlink)
+				}
+				continue
+			}
+			if err != nil || target != tt.want {
+				t.Errorf("Fs.ReadlinkIfPossible(%v) = %v, %v, want %v", tt.name, target, err, tt.want)
+			}
+		}
+	}
+}
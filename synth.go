@@ -0,0 +1,217 @@
+package gofat
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"path"
+	"time"
+
+	"github.com/aligator/gofat/checkpoint"
+)
+
+// ErrSynthesize is returned if a synthetic filesystem could not be created.
+var ErrSynthesize = errors.New("could not synthesize the filesystem")
+
+// synthFragmentGroup is the count of fragmented files which are written interleaved with each other.
+const synthFragmentGroup = 4
+
+// SynthOptions describe the synthetic filesystem created by Synthesize.
+type SynthOptions struct {
+	// Format is used to format the device. Format.Size has to be set if the device is empty.
+	// If Format.Clock is nil, a fixed time is used, so that the same options always create the same image.
+	Format FormatOptions
+
+	// Seed initializes the random generator for the names, sizes, contents and the fragmentation.
+	Seed int64
+
+	// Files is the count of files and Dirs the count of directories. The files are spread over all directories.
+	Files int
+	Dirs  int
+	// MaxDepth is the count of directory levels below the root. If it is 0 or 1, all directories are in the root.
+	MaxDepth int
+
+	// The file sizes follow a log-normal distribution like the sizes on real disks do: most files are around the
+	// MedianSize but a few are much bigger. SizeSpread is the standard deviation of the logarithm of the sizes;
+	// if it is 0, all files have the MedianSize. No file is bigger than MaxSize, if it is set.
+	MedianSize int64
+	SizeSpread float64
+	MaxSize    int64
+
+	// Fragmentation is the share of files (0 to 1) whose clusters are interleaved with other files,
+	// as it happens if several files are written at once.
+	Fragmentation float64
+}
+
+// Synthesize formats the device and fills it with files and directories as described by the options.
+// It creates exactly the same image for the same options, so that performance work (e.g. on caching or readahead)
+// can be measured on realistic workloads reproducibly.
+func Synthesize(device io.ReadWriteSeeker, opts SynthOptions) (*Fs, error) {
+	if opts.Files < 0 || opts.Dirs < 0 || opts.MaxDepth < 0 || opts.MedianSize < 0 || opts.SizeSpread < 0 ||
+		opts.Fragmentation < 0 || opts.Fragmentation > 1 {
+		return nil, checkpoint.From(fmt.Errorf("%w: invalid options %+v", ErrSynthesize, opts))
+	}
+
+	if opts.Format.Clock == nil {
+		opts.Format.Clock = FixedClock(time.Date(2020, time.January, 1, 12, 0, 0, 0, time.UTC))
+	}
+
+	if err := Format(device, opts.Format); err != nil {
+		return nil, checkpoint.Wrap(err, ErrSynthesize)
+	}
+
+	fs, err := NewWithOptions(device, Options{Clock: opts.Format.Clock})
+	if err != nil {
+		return nil, checkpoint.Wrap(err, ErrSynthesize)
+	}
+
+	s := &synthesizer{fs: fs, opts: opts, random: rand.New(rand.NewSource(opts.Seed))}
+	if err := s.run(); err != nil {
+		return nil, checkpoint.Wrap(err, ErrSynthesize)
+	}
+	return fs, nil
+}
+
+// synthesizer creates the content of a synthetic filesystem.
+type synthesizer struct {
+	fs     *Fs
+	opts   SynthOptions
+	random *rand.Rand
+}
+
+// synthFile is a file which is not written yet.
+type synthFile struct {
+	path string
+	size int64
+	seed int64
+}
+
+func (s *synthesizer) run() error {
+	maxDepth := s.opts.MaxDepth
+	if maxDepth < 1 {
+		maxDepth = 1
+	}
+
+	dirs := []string{"."}
+	depths := []int{0}
+	for i := 0; i < s.opts.Dirs; i++ {
+		// Pick a parent which is not too deep yet. The root is always allowed.
+		parent := s.random.Intn(len(dirs))
+		if depths[parent] >= maxDepth {
+			parent = 0
+		}
+
+		dir := path.Join(dirs[parent], s.dirName(i))
+		if err := s.fs.Mkdir(dir, 0777); err != nil {
+			return err
+		}
+		dirs = append(dirs, dir)
+		depths = append(depths, depths[parent]+1)
+	}
+
+	var fragmented []synthFile
+	for i := 0; i < s.opts.Files; i++ {
+		file := synthFile{
+			path: path.Join(dirs[s.random.Intn(len(dirs))], s.fileName(i)),
+			size: s.size(),
+			seed: s.random.Int63(),
+		}
+
+		if s.random.Float64() >= s.opts.Fragmentation {
+			if err := s.write([]synthFile{file}); err != nil {
+				return err
+			}
+			continue
+		}
+
+		fragmented = append(fragmented, file)
+		if len(fragmented) == synthFragmentGroup {
+			if err := s.write(fragmented); err != nil {
+				return err
+			}
+			fragmented = nil
+		}
+	}
+
+	return s.write(fragmented)
+}
+
+// dirName returns a unique name for the i-th directory.
+func (s *synthesizer) dirName(i int) string {
+	names := []string{"DCIM", "docs", "Music", "logs", "backup", "src", "Photos 2019", "tmp"}
+	return fmt.Sprintf("%s %d", names[s.random.Intn(len(names))], i)
+}
+
+// fileName returns a unique name for the i-th file. About half of them need a long name.
+func (s *synthesizer) fileName(i int) string {
+	switch s.random.Intn(4) {
+	case 0:
+		return fmt.Sprintf("IMG%05d.JPG", i)
+	case 1:
+		return fmt.Sprintf("LOG%05d.TXT", i)
+	case 2:
+		return fmt.Sprintf("Report %d (final version).docx", i)
+	default:
+		return fmt.Sprintf("track-%d.mp3", i)
+	}
+}
+
+// size returns the size of the next file.
+func (s *synthesizer) size() int64 {
+	size := float64(s.opts.MedianSize)
+	if s.opts.SizeSpread > 0 && size > 0 {
+		size = math.Exp(math.Log(size) + s.opts.SizeSpread*s.random.NormFloat64())
+	}
+
+	if s.opts.MaxSize > 0 && size > float64(s.opts.MaxSize) {
+		return s.opts.MaxSize
+	}
+	return int64(size)
+}
+
+// write creates the files. If there are several, they are written one cluster after another in turns,
+// so that their clusters are interleaved.
+func (s *synthesizer) write(files []synthFile) error {
+	if len(files) == 0 {
+		return nil
+	}
+
+	handles := make([]*File, len(files))
+	contents := make([]io.Reader, len(files))
+	for i, file := range files {
+		handle, err := s.fs.OpenFile(file.path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+		if err != nil {
+			return err
+		}
+		defer handle.Close()
+
+		handles[i] = handle.(*File)
+		contents[i] = io.LimitReader(rand.New(rand.NewSource(file.seed)), file.size)
+	}
+
+	if len(files) == 1 {
+		_, err := handles[0].ReadFrom(contents[0])
+		return err
+	}
+
+	chunk := make([]byte, s.fs.clusterSize())
+	for done := false; !done; {
+		done = true
+		for i, content := range contents {
+			n, err := io.ReadFull(content, chunk)
+			if n > 0 {
+				done = false
+				if _, err := handles[i].Write(chunk[:n]); err != nil {
+					return err
+				}
+			}
+			if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+				return err
+			}
+		}
+	}
+	return nil
+}
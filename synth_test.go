@@ -0,0 +1,205 @@
+package gofat
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+// testingSynthesize creates a synthetic filesystem in memory.
+func testingSynthesize(t testing.TB, opts SynthOptions) (*Fs, *testImage) {
+	image := testingImage(t)
+	fs, err := Synthesize(image, opts)
+	if err != nil {
+		t.Fatalf("Synthesize() error = %v", err)
+	}
+	return fs, image
+}
+
+func TestSynthesize(t *testing.T) {
+	const mib = 1024 * 1024
+	tests := []struct {
+		name string
+		opts SynthOptions
+	}{
+		{name: "empty", opts: SynthOptions{Format: FormatOptions{Size: 8 * mib}}},
+		{name: "flat", opts: SynthOptions{Format: FormatOptions{Size: 16 * mib}, Files: 50, Dirs: 5, MedianSize: 4096}},
+		{name: "nested and spread", opts: SynthOptions{
+			Format: FormatOptions{Size: 32 * mib}, Seed: 7, Files: 200, Dirs: 20, MaxDepth: 4,
+			MedianSize: 8 * 1024, SizeSpread: 1.5, MaxSize: 512 * 1024,
+		}},
+		{name: "fragmented FAT32", opts: SynthOptions{
+			Format: FormatOptions{Size: 600 * mib, FSType: FAT32}, Seed: 3, Files: 30, Dirs: 3, MaxDepth: 2,
+			MedianSize: 64 * 1024, Fragmentation: 1,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs, image := testingSynthesize(t, tt.opts)
+
+			report, err := fs.Check()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !report.OK() || report.Files != tt.opts.Files || report.Dirs != tt.opts.Dirs {
+				t.Errorf("Fs.Check() = %v files and %v dirs with findings %v, want %v files and %v dirs",
+					report.Files, report.Dirs, report.Findings, tt.opts.Files, tt.opts.Dirs)
+			}
+
+			err = afero.Walk(fs, ".", func(path string, info os.FileInfo, err error) error {
+				if err == nil && tt.opts.MaxSize > 0 && info.Size() > tt.opts.MaxSize {
+					t.Errorf("%v has %v bytes, want at most %v", path, info.Size(), tt.opts.MaxSize)
+				}
+				return err
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// The same options always result in the same image.
+			_, again := testingSynthesize(t, tt.opts)
+			if !bytes.Equal(image.data, again.data) {
+				t.Errorf("Synthesize() created different images for the same options")
+			}
+		})
+	}
+}
+
+func TestSynthesize_seed(t *testing.T) {
+	opts := SynthOptions{Format: FormatOptions{Size: 16 * 1024 * 1024}, Files: 20, Dirs: 2, MedianSize: 1000}
+	_, first := testingSynthesize(t, opts)
+	opts.Seed = 1
+	_, second := testingSynthesize(t, opts)
+
+	if bytes.Equal(first.data, second.data) {
+		t.Errorf("Synthesize() created the same image for different seeds")
+	}
+}
+
+func TestSynthesize_fragmentation(t *testing.T) {
+	// fragmented returns the count of files whose clusters are not contiguous.
+	fragmented := func(fragmentation float64) int {
+		fs, _ := testingSynthesize(t, SynthOptions{
+			Format: FormatOptions{Size: 32 * 1024 * 1024}, Files: 40, MedianSize: 64 * 1024, Fragmentation: fragmentation,
+		})
+
+		count := 0
+		err := afero.Walk(fs, ".", func(path string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() {
+				return err
+			}
+
+			chain, err := fs.clusterChain(fatEntry(info.(FileInfo).Entry().FirstCluster()))
+			if err != nil {
+				return err
+			}
+			for i := 1; i < len(chain); i++ {
+				if chain[i] != chain[i-1]+1 {
+					count++
+					break
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return count
+	}
+
+	if got := fragmented(0); got != 0 {
+		t.Errorf("Synthesize() without fragmentation created %v fragmented files", got)
+	}
+	if got := fragmented(1); got != 40 {
+		t.Errorf("Synthesize() with full fragmentation created %v fragmented files, want 40", got)
+	}
+}
+
+func TestSynthesize_invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		opts SynthOptions
+	}{
+		{name: "negative files", opts: SynthOptions{Format: FormatOptions{Size: 8 * 1024 * 1024}, Files: -1}},
+		{name: "fragmentation above 1", opts: SynthOptions{Format: FormatOptions{Size: 8 * 1024 * 1024}, Fragmentation: 2}},
+		{name: "no space left", opts: SynthOptions{Format: FormatOptions{Size: 8 * 1024 * 1024}, Files: 10, MedianSize: 1024 * 1024}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Synthesize(testingImage(t), tt.opts); !errors.Is(err, ErrSynthesize) {
+				t.Errorf("Synthesize() error = %v, want %v", err, ErrSynthesize)
+			}
+		})
+	}
+}
+
+// benchmarkImage is a synthetic filesystem with a typical mix of file sizes.
+func benchmarkImage(b *testing.B, fragmentation float64) *testImage {
+	_, image := testingSynthesize(b, SynthOptions{
+		Format: FormatOptions{Size: 128 * 1024 * 1024}, Seed: 1, Files: 1000, Dirs: 50, MaxDepth: 3,
+		MedianSize: 16 * 1024, SizeSpread: 1.2, MaxSize: 4 * 1024 * 1024, Fragmentation: fragmentation,
+	})
+	return image
+}
+
+func BenchmarkWalk(b *testing.B) {
+	image := benchmarkImage(b, 0)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		fs := testingNew(b, bytes.NewReader(image.data))
+		if err := afero.Walk(fs, ".", func(string, os.FileInfo, error) error { return nil }); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkReadAll(b *testing.B) {
+	for _, bench := range []struct {
+		name          string
+		fragmentation float64
+	}{
+		{name: "contiguous", fragmentation: 0},
+		{name: "fragmented", fragmentation: 0.5},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			image := benchmarkImage(b, bench.fragmentation)
+
+			var total int64
+			err := afero.Walk(testingNew(b, bytes.NewReader(image.data)), ".", func(_ string, info os.FileInfo, err error) error {
+				if err == nil {
+					total += info.Size()
+				}
+				return err
+			})
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.SetBytes(total)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				fs := testingNew(b, bytes.NewReader(image.data))
+				err := afero.Walk(fs, ".", func(path string, info os.FileInfo, err error) error {
+					if err != nil || info.IsDir() {
+						return err
+					}
+					file, err := fs.Open(path)
+					if err != nil {
+						return err
+					}
+					defer file.Close()
+
+					_, err = io.Copy(io.Discard, file)
+					return err
+				})
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
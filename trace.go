@@ -0,0 +1,71 @@
+package gofat
+
+import (
+	"time"
+)
+
+// Trace describes a single access traced by a Tracer.
+type Trace struct {
+	// Start is the time the access started.
+	Start time.Time
+	// Duration of the access.
+	Duration time.Duration
+	// Err is the error of the access if it failed.
+	Err error
+}
+
+// Tracer receives callbacks after each access to the storage, e.g. to record OpenTelemetry spans
+// (using Trace.Start as start time) or to profile the storage.
+// The callbacks are called synchronously and possibly concurrently by the goroutines accessing the storage,
+// so they should return quickly.
+type Tracer interface {
+	// SectorFetch is called after count sectors starting at sector were read from the reader.
+	// Sectors which are served by the cache are not read and therefore not traced.
+	SectorFetch(sector uint32, count int, trace Trace)
+
+	// FatLookup is called after the FAT entry of the cluster was looked up.
+	// Its sector may come from the cache or the FAT may be kept in memory, see Options.FatInMemory.
+	FatLookup(cluster uint32, trace Trace)
+
+	// DirParse is called after the entries of the directory starting at cluster were parsed from the sectors.
+	// The cluster is 0 for the root directory. The sectors must not be modified.
+	DirParse(cluster uint32, sectors []uint32, trace Trace)
+}
+
+// traceStart returns the start time for a trace. It is the zero time if no Tracer is set.
+func (f *Fs) traceStart() time.Time {
+	if f.tracer == nil {
+		return time.Time{}
+	}
+	return time.Now()
+}
+
+// newTrace finishes the trace of an access which started at start.
+func newTrace(start time.Time, err error) Trace {
+	return Trace{
+		Start:    start,
+		Duration: time.Since(start),
+		Err:      err,
+	}
+}
+
+// traceSectorFetch calls Tracer.SectorFetch if a Tracer is set.
+func (f *Fs) traceSectorFetch(sector uint32, count int, start time.Time, err error) {
+	if f.tracer != nil {
+		f.tracer.SectorFetch(sector, count, newTrace(start, err))
+	}
+}
+
+// traceFatLookup calls Tracer.FatLookup if a Tracer is set.
+func (f *Fs) traceFatLookup(cluster fatEntry, start time.Time, err error) {
+	if f.tracer != nil {
+		f.tracer.FatLookup(cluster.Value(), newTrace(start, err))
+	}
+}
+
+// traceDirParse calls Tracer.DirParse if a Tracer is set.
+func (f *Fs) traceDirParse(cluster fatEntry, sectors []uint32, start time.Time, err error) {
+	if f.tracer != nil {
+		f.tracer.DirParse(cluster.Value(), sectors, newTrace(start, err))
+	}
+}
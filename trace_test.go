@@ -0,0 +1,132 @@
+package gofat
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/aligator/gofat/fattest"
+	"github.com/spf13/afero"
+)
+
+// testTracer records all traced accesses.
+type testTracer struct {
+	lock    sync.Mutex
+	sectors map[uint32]int
+	fat     map[uint32]bool
+	dirs    map[uint32]bool
+	errs    []error
+}
+
+func newTestTracer() *testTracer {
+	return &testTracer{
+		sectors: make(map[uint32]int),
+		fat:     make(map[uint32]bool),
+		dirs:    make(map[uint32]bool),
+	}
+}
+
+func (t *testTracer) record(trace Trace) {
+	if trace.Start.IsZero() || trace.Duration < 0 {
+		panic("invalid trace timing")
+	}
+	if trace.Err != nil {
+		t.errs = append(t.errs, trace.Err)
+	}
+}
+
+func (t *testTracer) SectorFetch(sector uint32, count int, trace Trace) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.record(trace)
+	t.sectors[sector] = count
+}
+
+func (t *testTracer) FatLookup(cluster uint32, trace Trace) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.record(trace)
+	t.fat[cluster] = true
+}
+
+func (t *testTracer) DirParse(cluster uint32, sectors []uint32, trace Trace) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.record(trace)
+	if len(sectors) == 0 && trace.Err == nil {
+		panic("directory parsed without sectors")
+	}
+	t.dirs[cluster] = true
+}
+
+func TestFs_Tracer(t *testing.T) {
+	tests := []struct {
+		name        string
+		fatInMemory bool
+		// wantBulk is true if the whole FAT is read at once.
+		wantBulk bool
+	}{
+		{
+			name: "single sectors",
+		},
+		{
+			name:        "FAT in memory",
+			fatInMemory: true,
+			wantBulk:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracer := newTestTracer()
+			fs, err := NewWithOptions(testingReadOnly(t, fat16), Options{FatInMemory: tt.fatInMemory, Tracer: tracer})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := afero.ReadFile(fs, "DoNotEdit_tests/README.md"); err != nil {
+				t.Fatal(err)
+			}
+
+			if tracer.sectors[0] != 1 {
+				t.Errorf("Tracer.SectorFetch() of the boot sector count = %v, want 1", tracer.sectors[0])
+			}
+			firstFatSector := uint32(fs.info.ReservedSectorCount)
+			if tt.wantBulk && tracer.sectors[firstFatSector] != int(fs.info.FatSize) {
+				t.Errorf("Tracer.SectorFetch() of the FAT count = %v, want %v", tracer.sectors[firstFatSector], fs.info.FatSize)
+			}
+
+			// The README starts with the clusters 6 and 8.
+			for _, cluster := range []uint32{6, 8} {
+				if !tracer.fat[cluster] {
+					t.Errorf("Tracer.FatLookup() was not called for cluster %v", cluster)
+				}
+			}
+			if !tracer.dirs[0] || len(tracer.dirs) < 2 {
+				t.Errorf("Tracer.DirParse() was called for %v, want the root and DoNotEdit_tests", tracer.dirs)
+			}
+			if len(tracer.errs) > 0 {
+				t.Errorf("traced errors = %v, want none", tracer.errs)
+			}
+		})
+	}
+}
+
+func TestFs_TracerErrors(t *testing.T) {
+	device := fattest.NewFaultyDevice(testingCopy(t, fat16), 512)
+
+	tracer := newTestTracer()
+	fs, err := NewWithOptions(device, Options{Tracer: tracer})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Break the whole device after mounting.
+	device.FailAfter(fattest.Read, 0, nil)
+	if _, err := fs.Stat("DoNotEdit_tests"); err == nil {
+		t.Fatal("Fs.Stat() error = nil, want an error")
+	}
+
+	// The failing sector fetch and the failing directory parse are traced.
+	if len(tracer.errs) != 2 {
+		t.Errorf("traced errors = %v, want 2 errors", tracer.errs)
+	}
+}
@@ -0,0 +1,242 @@
+package gofat
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"syscall"
+
+	"github.com/aligator/gofat/checkpoint"
+)
+
+// ErrNotRecoverable is returned if the data of a deleted entry has already been overwritten.
+var ErrNotRecoverable = errors.New("the deleted entry cannot be recovered")
+
+// DeletedEntry is a deleted file or directory whose slot is still present in its directory.
+type DeletedEntry struct {
+	ExtendedEntryHeader
+	// Path of the entry including the recovered name.
+	// Deleting overwrites the first character of the short name. It is restored from the long filename slots
+	// if they are still present, otherwise it is replaced by '_'.
+	Path string
+	// Recoverable is false if the first cluster of the entry is used by another file or directory by now.
+	// Even if it is true, the data may be partially overwritten, see RecoverChain.
+	Recoverable bool
+}
+
+// Deleted returns the deleted entries of the directory at dir and of all its subdirectories in the order of their
+// slots. The content of deleted directories is not searched.
+func (f *Fs) Deleted(dir string) ([]DeletedEntry, error) {
+	dirPath, err := cleanPath(dir)
+	if err != nil {
+		return nil, checkpoint.Wrap(err, ErrReadDir)
+	}
+
+	ref, err := f.resolve(dirPath)
+	if err != nil {
+		return nil, checkpoint.Wrap(err, ErrReadDir)
+	}
+
+	if !ref.isDir() {
+		return nil, checkpoint.Wrap(syscall.ENOTDIR, fmt.Errorf("%w: %v", ErrReadDir, dirPath))
+	}
+
+	deleted := make([]DeletedEntry, 0)
+	if err := f.findDeleted(f.entryDirCluster(ref), dirPath, &deleted); err != nil {
+		return nil, checkpoint.Wrap(err, ErrReadDir)
+	}
+	return deleted, nil
+}
+
+// findDeleted appends the deleted entries of the directory starting at dirCluster and of its subdirectories.
+func (f *Fs) findDeleted(dirCluster fatEntry, dirPath string, deleted *[]DeletedEntry) error {
+	data, _, err := f.readDirSlots(dirCluster)
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < len(data)/entrySize; i++ {
+		slot := data[i*entrySize : (i+1)*entrySize]
+		if slot[0] == 0x00 {
+			break
+		}
+		if slot[0] != 0xE5 || slot[11]&AttrLongName == AttrLongName || slot[11]&AttrVolumeId == AttrVolumeId {
+			continue
+		}
+
+		entry := DeletedEntry{
+			ExtendedEntryHeader: recoverDeletedName(data, i),
+			Recoverable:         true,
+		}
+		entry.Path = path.Join(dirPath, entry.FileInfo().Name())
+
+		if first := entry.firstCluster(); first != 0 {
+			entry.Recoverable = false
+			if f.validCluster(first) {
+				next, err := f.getFatEntry(first)
+				if err != nil {
+					return err
+				}
+				entry.Recoverable = next.IsFree()
+			}
+		}
+
+		*deleted = append(*deleted, entry)
+	}
+
+	refs, err := f.parseDirRefs(data)
+	if err != nil {
+		return err
+	}
+
+	for _, ref := range refs {
+		if !ref.isDir() {
+			continue
+		}
+
+		err := f.findDeleted(ref.firstCluster(), path.Join(dirPath, ref.FileInfo().Name()), deleted)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// recoverDeletedName decodes the deleted short entry at the slot index together with the deleted long filename
+// slots directly in front of it. As their sequence numbers are overwritten by the deletion marker, they are
+// collected until the end of the name or until the checksum changes.
+// The checksum also reveals the first character of the short name, as only one character results in it.
+func recoverDeletedName(data []byte, index int) ExtendedEntryHeader {
+	header := ExtendedEntryHeader{EntryHeader: decodeEntryHeader(data[index*entrySize:])}
+	header.Name[0] = '_'
+
+	var chars []uint16
+	var checksum byte
+	for i := index - 1; i >= 0 && index-i <= 20; i-- {
+		slot := data[i*entrySize : (i+1)*entrySize]
+		if slot[0] != 0xE5 || slot[11]&AttrLongName != AttrLongName {
+			break
+		}
+
+		part := decodeLongFilenameEntry(slot)
+		if i == index-1 {
+			checksum = part.Checksum
+		} else if part.Checksum != checksum {
+			break
+		}
+
+		chars = append(chars, part.First[:]...)
+		chars = append(chars, part.Second[:]...)
+		chars = append(chars, part.Third[:]...)
+		if containsZero(chars) {
+			break
+		}
+	}
+
+	if len(chars) == 0 {
+		return header
+	}
+
+	name := header.Name
+	for c := 0; c < 256; c++ {
+		name[0] = byte(c)
+		if shortNameChecksum(name) != checksum {
+			continue
+		}
+
+		// Only accept the long name if the character is plausible.
+		if name[0] == 0x05 {
+			name[0] = 0xE5
+		} else if !isShortNameChar(name[0]) && name[0] < 0x80 {
+			return header
+		}
+
+		header.Name = name
+		header.ExtendedName, _ = (*nameInterner)(nil).decodeLongName(chars, nil)
+		break
+	}
+
+	return header
+}
+
+// containsZero returns true if the characters contain the end of a long filename.
+func containsZero(chars []uint16) bool {
+	for _, char := range chars {
+		if char == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// RecoverChain guesses the clusters which contained the data of the deleted entry.
+// Deleting clears the cluster chain in the FAT, so the data is assumed to be stored in the next free clusters
+// starting at the first cluster of the entry, which is the case for all files written without fragmentation.
+// Clusters which are used by other files are skipped. Deleted directories only get their first cluster,
+// as their size is unknown.
+// It fails with ErrNotRecoverable if the first cluster is used by now or not enough free clusters are left.
+func (f *Fs) RecoverChain(entry DeletedEntry) ([]uint32, error) {
+	first := entry.firstCluster()
+	needed := (int64(entry.FileSize) + f.clusterSize() - 1) / f.clusterSize()
+	if entry.Attribute&AttrDirectory == AttrDirectory {
+		needed = 1
+	}
+
+	chain := make([]uint32, 0, needed)
+	if needed == 0 {
+		return chain, nil
+	}
+
+	if !f.validCluster(first) {
+		return nil, checkpoint.From(fmt.Errorf("%w: %v has the invalid first cluster %d", ErrNotRecoverable, entry.Path, first))
+	}
+
+	for cluster := first; int64(len(chain)) < needed && f.validCluster(cluster); cluster++ {
+		next, err := f.getFatEntry(cluster)
+		if err != nil {
+			return nil, checkpoint.Wrap(err, ErrReadFat)
+		}
+
+		if !next.IsFree() {
+			if cluster == first {
+				return nil, checkpoint.From(fmt.Errorf("%w: the first cluster %d of %v is used", ErrNotRecoverable, first, entry.Path))
+			}
+			continue
+		}
+
+		chain = append(chain, cluster.Value())
+	}
+
+	if int64(len(chain)) < needed {
+		return nil, checkpoint.From(fmt.Errorf("%w: not enough free clusters behind cluster %d for %v", ErrNotRecoverable, first, entry.Path))
+	}
+
+	return chain, nil
+}
+
+// ReadDeleted returns the data of the deleted file as far as it can be recovered using RecoverChain.
+// Note that the data may have been overwritten partially even if it could be read.
+func (f *Fs) ReadDeleted(entry DeletedEntry) ([]byte, error) {
+	if entry.Attribute&AttrDirectory == AttrDirectory {
+		return nil, checkpoint.Wrap(syscall.EISDIR, fmt.Errorf("%w: %v", ErrReadFile, entry.Path))
+	}
+
+	chain, err := f.RecoverChain(entry)
+	if err != nil {
+		return nil, checkpoint.Wrap(err, ErrReadFile)
+	}
+
+	data := make([]byte, 0, int64(len(chain))*f.clusterSize())
+	for _, cluster := range chain {
+		clusterData, err := f.readSectors(f.firstSectorOfCluster(fatEntry(cluster)), uint32(f.info.SectorsPerCluster))
+		if err != nil {
+			return nil, checkpoint.Wrap(err, fmt.Errorf("%w: %v", ErrReadFile, entry.Path))
+		}
+
+		data = append(data, clusterData...)
+		f.buffers.put(clusterData)
+	}
+
+	return data[:entry.FileSize], nil
+}
@@ -0,0 +1,97 @@
+package gofat
+
+import (
+	"bytes"
+	"errors"
+	"path"
+	"syscall"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestFs_Deleted(t *testing.T) {
+	fs := testingFormat(t, FormatOptions{Size: 32 * 1024 * 1024})
+	clusterSize := int(fs.clusterSize())
+	files := map[string][]byte{
+		"a long name.txt":            testData(clusterSize*3 + 7),
+		"SHORT.TXT":                  []byte("short"),
+		"dir/nested-file.bin":        testData(clusterSize / 2),
+		"dir/deleted/child.txt":      []byte("child"),
+		"overwritten.txt":            testData(clusterSize),
+		"empty.txt":                  {},
+		"dir/kept-as-reference.txt":  []byte("kept"),
+		"aaaaaaaaaaaaaaaaaaaaaaaaaa": []byte("exactly 26 characters"),
+	}
+	for name, data := range files {
+		if err := fs.MkdirAll(path.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := afero.WriteFile(fs, name, data, 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	overwritten, err := fs.ClusterChain("overwritten.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a long name.txt", "SHORT.TXT", "dir/nested-file.bin", "overwritten.txt", "empty.txt", "aaaaaaaaaaaaaaaaaaaaaaaaaa"} {
+		if err := fs.Remove(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := fs.RemoveAll("dir/deleted"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Simulate that another file reused the first cluster.
+	if err := fs.setFatEntry(fatEntry(overwritten[0]), eocMarker); err != nil {
+		t.Fatal(err)
+	}
+
+	deleted, err := fs.Deleted(".")
+	if err != nil {
+		t.Fatalf("Fs.Deleted() error = %v", err)
+	}
+
+	got := make(map[string]DeletedEntry)
+	for _, entry := range deleted {
+		got[entry.Path] = entry
+	}
+
+	tests := []struct {
+		path    string
+		want    []byte
+		wantErr error
+	}{
+		{path: "a long name.txt", want: files["a long name.txt"]},
+		{path: "_HORT.TXT", want: files["SHORT.TXT"]},
+		{path: "dir/nested-file.bin", want: files["dir/nested-file.bin"]},
+		{path: "empty.txt", want: []byte{}},
+		{path: "aaaaaaaaaaaaaaaaaaaaaaaaaa", want: files["aaaaaaaaaaaaaaaaaaaaaaaaaa"]},
+		{path: "dir/deleted", wantErr: syscall.EISDIR},
+		{path: "overwritten.txt", wantErr: ErrNotRecoverable},
+	}
+	if len(got) != len(tests) {
+		t.Errorf("Fs.Deleted() = %v, want %d entries", deleted, len(tests))
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			entry, ok := got[tt.path]
+			if !ok {
+				t.Fatalf("Fs.Deleted() did not find %v", tt.path)
+			}
+			if entry.Recoverable != !errors.Is(tt.wantErr, ErrNotRecoverable) {
+				t.Errorf("DeletedEntry.Recoverable = %v", entry.Recoverable)
+			}
+
+			data, err := fs.ReadDeleted(entry)
+			if !errors.Is(err, tt.wantErr) || (err != nil) != (tt.wantErr != nil) {
+				t.Fatalf("Fs.ReadDeleted() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && !bytes.Equal(data, tt.want) {
+				t.Errorf("Fs.ReadDeleted() returned %d bytes, want %d", len(data), len(tt.want))
+			}
+		})
+	}
+}
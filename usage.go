@@ -0,0 +1,269 @@
+package gofat
+
+import (
+	"path"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/aligator/gofat/checkpoint"
+)
+
+// Usage describes the disk usage of a directory including all of its subdirectories.
+type Usage struct {
+	// Path of the directory.
+	Path string
+	// Size is the sum of the sizes of all files.
+	Size int64
+	// Allocated is the size of all clusters used by the files and directories (cluster count × cluster size).
+	// The root directory of FAT12/FAT16 is not counted as it is not stored in clusters.
+	Allocated int64
+	// Files is the count of all files.
+	Files int
+	// Dirs is the count of all subdirectories.
+	Dirs int
+	// Children contains the usage of each direct subdirectory.
+	Children []Usage
+}
+
+// DiskUsage calculates the disk usage of the directory at the given root and all of its subdirectories.
+// If root is a file, only that file is counted.
+func (f *Fs) DiskUsage(root string) (Usage, error) {
+	cleaned, err := cleanPath(root)
+	if err != nil {
+		return Usage{}, checkpoint.Wrap(err, ErrReadFilesystemDir)
+	}
+
+	ref, err := f.resolve(cleaned)
+	if err != nil {
+		return Usage{}, checkpoint.Wrap(err, ErrReadFilesystemDir)
+	}
+
+	if !ref.isDir() {
+		allocated, err := f.allocatedSize(ref.firstCluster())
+		if err != nil {
+			return Usage{}, checkpoint.Wrap(err, ErrReadFilesystemDir)
+		}
+
+		return Usage{
+			Path:      cleaned,
+			Size:      int64(ref.FileSize),
+			Allocated: allocated,
+			Files:     1,
+		}, nil
+	}
+
+	usage, err := f.dirUsage(cleaned, ref)
+	if err != nil {
+		return Usage{}, checkpoint.Wrap(err, ErrReadFilesystemDir)
+	}
+
+	return usage, nil
+}
+
+// dirUsage calculates the usage of the given directory recursively.
+func (f *Fs) dirUsage(dirPath string, dir entryRef) (Usage, error) {
+	usage := Usage{
+		Path: dirPath,
+	}
+
+	dirCluster := f.entryDirCluster(dir)
+	if cluster := f.dirClusterOrRoot(dirCluster); cluster != 0 {
+		allocated, err := f.allocatedSize(cluster)
+		if err != nil {
+			return Usage{}, err
+		}
+		usage.Allocated = allocated
+	}
+
+	refs, err := f.readDirRefs(dirCluster)
+	if err != nil {
+		return Usage{}, err
+	}
+
+	for _, ref := range refs {
+		if ref.isDir() {
+			child, err := f.dirUsage(path.Join(dirPath, ref.FileInfo().Name()), ref)
+			if err != nil {
+				return Usage{}, err
+			}
+
+			usage.Size += child.Size
+			usage.Allocated += child.Allocated
+			usage.Files += child.Files
+			usage.Dirs += child.Dirs + 1
+			usage.Children = append(usage.Children, child)
+			continue
+		}
+
+		allocated, err := f.allocatedSize(ref.firstCluster())
+		if err != nil {
+			return Usage{}, err
+		}
+
+		usage.Size += int64(ref.FileSize)
+		usage.Allocated += allocated
+		usage.Files++
+	}
+
+	return usage, nil
+}
+
+// allocatedSize returns the size of all clusters of the chain starting at the given cluster.
+func (f *Fs) allocatedSize(cluster fatEntry) (int64, error) {
+	chain, err := f.clusterChain(cluster)
+	if err != nil {
+		return 0, err
+	}
+
+	return int64(len(chain)) * f.clusterSize(), nil
+}
+
+// ExtensionUsage is the disk usage of all files with the same extension.
+type ExtensionUsage struct {
+	// Extension in lower case including the dot (e.g. ".bin"). It is empty for files without an extension.
+	Extension string `json:"extension"`
+	// Files is the count of the files.
+	Files int `json:"files"`
+	// Size is the sum of the sizes of the files.
+	Size int64 `json:"size"`
+	// Allocated is the size of all clusters used by the files.
+	Allocated int64 `json:"allocated"`
+}
+
+// UsageByExtension aggregates the files below the given root by their extension, e.g. to decide what to trim from a
+// boot partition. The result is sorted by the allocated size with the biggest first.
+func (f *Fs) UsageByExtension(root string) ([]ExtensionUsage, error) {
+	cleaned, err := cleanPath(root)
+	if err != nil {
+		return nil, checkpoint.Wrap(err, ErrReadFilesystemDir)
+	}
+
+	ref, err := f.resolve(cleaned)
+	if err != nil {
+		return nil, checkpoint.Wrap(err, ErrReadFilesystemDir)
+	}
+
+	extensions := make(map[string]*ExtensionUsage)
+	if err := f.extensionUsage(ref, extensions); err != nil {
+		return nil, checkpoint.Wrap(err, ErrReadFilesystemDir)
+	}
+
+	result := make([]ExtensionUsage, 0, len(extensions))
+	for _, usage := range extensions {
+		result = append(result, *usage)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Allocated != result[j].Allocated {
+			return result[i].Allocated > result[j].Allocated
+		}
+		return result[i].Extension < result[j].Extension
+	})
+
+	return result, nil
+}
+
+// extensionUsage adds the file or all files below the directory to the usage of their extensions.
+func (f *Fs) extensionUsage(ref entryRef, extensions map[string]*ExtensionUsage) error {
+	if !ref.isDir() {
+		allocated, err := f.allocatedSize(ref.firstCluster())
+		if err != nil {
+			return err
+		}
+
+		extension := strings.ToLower(path.Ext(ref.FileInfo().Name()))
+		usage, ok := extensions[extension]
+		if !ok {
+			usage = &ExtensionUsage{Extension: extension}
+			extensions[extension] = usage
+		}
+
+		usage.Files++
+		usage.Size += int64(ref.FileSize)
+		usage.Allocated += allocated
+		return nil
+	}
+
+	refs, err := f.readDirRefs(f.entryDirCluster(ref))
+	if err != nil {
+		return err
+	}
+
+	for _, child := range refs {
+		if err := f.extensionUsage(child, extensions); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// PathReport contains the deepest and the longest paths of a directory tree, e.g. to validate an image against the
+// path limits of a target device before flashing it.
+// Depth and length are measured from the root of the filesystem, even if the report is for a subdirectory.
+type PathReport struct {
+	// MaxDepth is the count of elements of the deepest path, e.g. 3 for "boot/overlays/a.dtbo".
+	MaxDepth int `json:"maxDepth"`
+	// DeepestPath is the first path found with MaxDepth elements.
+	DeepestPath string `json:"deepestPath"`
+	// MaxLength is the count of characters of the longest path without a leading slash.
+	MaxLength int `json:"maxLength"`
+	// LongestPath is the first path found with MaxLength characters.
+	LongestPath string `json:"longestPath"`
+}
+
+// Paths reports the deepest and the longest paths of all files and directories below the given root.
+// The root itself is included unless it is the root directory of the filesystem.
+func (f *Fs) Paths(root string) (PathReport, error) {
+	cleaned, err := cleanPath(root)
+	if err != nil {
+		return PathReport{}, checkpoint.Wrap(err, ErrReadFilesystemDir)
+	}
+
+	ref, err := f.resolve(cleaned)
+	if err != nil {
+		return PathReport{}, checkpoint.Wrap(err, ErrReadFilesystemDir)
+	}
+
+	var report PathReport
+	if err := f.pathReport(cleaned, ref, &report); err != nil {
+		return PathReport{}, checkpoint.Wrap(err, ErrReadFilesystemDir)
+	}
+	return report, nil
+}
+
+// pathReport adds the entry at the given path and all entries below it to the report.
+func (f *Fs) pathReport(entryPath string, ref entryRef, report *PathReport) error {
+	if !ref.isRoot() {
+		if depth := strings.Count(entryPath, "/") + 1; depth > report.MaxDepth {
+			report.MaxDepth = depth
+			report.DeepestPath = entryPath
+		}
+		if length := utf8.RuneCountInString(entryPath); length > report.MaxLength {
+			report.MaxLength = length
+			report.LongestPath = entryPath
+		}
+	}
+
+	if !ref.isDir() {
+		return nil
+	}
+
+	refs, err := f.readDirRefs(f.entryDirCluster(ref))
+	if err != nil {
+		return err
+	}
+
+	for _, child := range refs {
+		childPath := child.FileInfo().Name()
+		if !ref.isRoot() {
+			childPath = entryPath + "/" + childPath
+		}
+
+		if err := f.pathReport(childPath, child, report); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
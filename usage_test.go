@@ -0,0 +1,230 @@
+package gofat
+
+import (
+	"io"
+	"path"
+	"reflect"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestFs_DiskUsage(t *testing.T) {
+	tests := []struct {
+		name    string
+		reader  io.ReadSeeker
+		root    string
+		want    Usage
+		wantErr bool
+	}{
+		{
+			name:   "FAT32 whole filesystem",
+			reader: testFileReader(fat32),
+			root:   ".",
+			want: Usage{
+				Path:      "",
+				Size:      10513*2 + 76,
+				Allocated: 10 * 4096,
+				Files:     4,
+				Dirs:      2,
+				Children: []Usage{
+					{
+						Path:      "go",
+						Size:      76,
+						Allocated: 2 * 4096,
+						Files:     1,
+					},
+					{
+						Path:      "DoNotEdit_tests",
+						Size:      10513,
+						Allocated: 4 * 4096,
+						Files:     2,
+					},
+				},
+			},
+		},
+		{
+			name:   "FAT16 subdirectory",
+			reader: testFileReader(fat16),
+			root:   "DoNotEdit_tests",
+			want: Usage{
+				Path:      "DoNotEdit_tests",
+				Size:      10513,
+				Allocated: 7 * 2048,
+				Files:     2,
+			},
+		},
+		{
+			name:   "single file",
+			reader: testFileReader(fat32),
+			root:   "go/main.go",
+			want: Usage{
+				Path:      "go/main.go",
+				Size:      76,
+				Allocated: 4096,
+				Files:     1,
+			},
+		},
+		{
+			name:    "not existing",
+			reader:  testFileReader(fat32),
+			root:    "not existing",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := testingNew(t, tt.reader)
+			got, err := fs.DiskUsage(tt.root)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Fs.DiskUsage() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Fs.DiskUsage() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFs_UsageByExtension(t *testing.T) {
+	fs := testingFormat(t, FormatOptions{Size: 32 * 1024 * 1024})
+	clusterSize := int64(fs.clusterSize())
+	for name, size := range map[string]int64{
+		"kernel.img":         clusterSize*3 + 1,
+		"firmware/boot.BIN":  10,
+		"firmware/start.bin": clusterSize,
+		"overlays/a.dtbo":    100,
+		"README":             5,
+		"empty.txt":          0,
+	} {
+		if err := fs.MkdirAll(path.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := afero.WriteFile(fs, name, testData(int(size)), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		root    string
+		want    []ExtensionUsage
+		wantErr bool
+	}{
+		{
+			name: "whole filesystem",
+			root: ".",
+			want: []ExtensionUsage{
+				{Extension: ".img", Files: 1, Size: clusterSize*3 + 1, Allocated: clusterSize * 4},
+				{Extension: ".bin", Files: 2, Size: clusterSize + 10, Allocated: clusterSize * 2},
+				{Extension: "", Files: 1, Size: 5, Allocated: clusterSize},
+				{Extension: ".dtbo", Files: 1, Size: 100, Allocated: clusterSize},
+				{Extension: ".txt", Files: 1},
+			},
+		},
+		{
+			name: "directory",
+			root: "firmware",
+			want: []ExtensionUsage{
+				{Extension: ".bin", Files: 2, Size: clusterSize + 10, Allocated: clusterSize * 2},
+			},
+		},
+		{
+			name: "single file",
+			root: "README",
+			want: []ExtensionUsage{
+				{Extension: "", Files: 1, Size: 5, Allocated: clusterSize},
+			},
+		},
+		{
+			name:    "not existing",
+			root:    "not existing",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := fs.UsageByExtension(tt.root)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Fs.UsageByExtension() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Fs.UsageByExtension() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFs_Paths(t *testing.T) {
+	fs := testingFormat(t, FormatOptions{Size: 32 * 1024 * 1024})
+	for _, name := range []string{
+		"boot/overlays/deep/a.dtbo",
+		"boot/a-very-long-firmware-name-äöü.bin",
+		"top.txt",
+	} {
+		if err := fs.MkdirAll(path.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := afero.WriteFile(fs, name, nil, 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := fs.Mkdir("empty", 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		root    string
+		want    PathReport
+		wantErr bool
+	}{
+		{
+			name: "whole filesystem",
+			root: ".",
+			want: PathReport{
+				MaxDepth:    4,
+				DeepestPath: "boot/overlays/deep/a.dtbo",
+				MaxLength:   38,
+				LongestPath: "boot/a-very-long-firmware-name-äöü.bin",
+			},
+		},
+		{
+			name: "subdirectory",
+			root: "boot/overlays",
+			want: PathReport{
+				MaxDepth:    4,
+				DeepestPath: "boot/overlays/deep/a.dtbo",
+				MaxLength:   25,
+				LongestPath: "boot/overlays/deep/a.dtbo",
+			},
+		},
+		{
+			name: "file",
+			root: "top.txt",
+			want: PathReport{
+				MaxDepth:    1,
+				DeepestPath: "top.txt",
+				MaxLength:   7,
+				LongestPath: "top.txt",
+			},
+		},
+		{
+			name:    "not existing",
+			root:    "not existing",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := fs.Paths(tt.root)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Fs.Paths() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Fs.Paths() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,16 @@
+// Package gofat is the second version of the GoFAT API. It reads and writes FAT12, FAT16 and FAT32 filesystems
+// in pure Go, with the io/fs interfaces of the standard library as its primary interface.
+//
+// Compared to the first version:
+//   - FS implements fs.FS, fs.StatFS, fs.ReadDirFS and fs.ReadFileFS directly. afero is only an adapter (FS.Afero).
+//   - Filesystems are opened with Open and functional options instead of several constructors.
+//   - All errors are of the type *Error, which names the operation and the path and classifies the problem.
+//     errors.Is works with the errors of io/fs (e.g. fs.ErrNotExist) and the sentinel errors of this package.
+//   - Writing is part of the API from the start: Create, OpenFile, Mkdir, Remove, Rename and WriteFile.
+//
+// The v2 API uses the v1 implementation underneath, so both can be mixed during a migration:
+// FromV1 wraps an existing v1 filesystem and FS.V1 returns the v1 filesystem behind a v2 one.
+//
+// It is a module of its own, github.com/aligator/gofat/v2, which requires the v1.0.0 release of the v1 module
+// github.com/aligator/gofat.
+package gofat
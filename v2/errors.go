@@ -0,0 +1,114 @@
+package gofat
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"syscall"
+
+	v1 "github.com/aligator/gofat"
+)
+
+// These errors classify the problems which are not covered by the errors of io/fs.
+// Check them using errors.Is.
+var (
+	ErrReadOnly     = errors.New("the filesystem is read only")
+	ErrNoSpace      = errors.New("no space left on the filesystem")
+	ErrNotSupported = errors.New("not supported")
+	ErrNotDir       = errors.New("not a directory")
+	ErrIsDir        = errors.New("is a directory")
+	ErrNotEmpty     = errors.New("directory not empty")
+	// ErrIO is used for all problems while reading or writing the device and for corrupt filesystems.
+	ErrIO = errors.New("input/output error")
+)
+
+// Error is returned by all operations of FS and File.
+//
+// Kind classifies the problem. It is one of fs.ErrNotExist, fs.ErrExist, fs.ErrPermission, fs.ErrInvalid,
+// fs.ErrClosed, context.Canceled, context.DeadlineExceeded or one of the errors of this package.
+// errors.Is(err, kind) is true for the kind and for all errors in the chain of Err.
+type Error struct {
+	// Op is the failed operation, e.g. "open" or "write".
+	Op string
+	// Path is the path of the file the operation was called with. It is empty for operations on the whole FS.
+	Path string
+	// Kind classifies the problem.
+	Kind error
+	// Err is the detailed cause including the trace where it happened.
+	Err error
+}
+
+func (e *Error) Error() string {
+	if e.Path == "" {
+		return e.Op + ": " + e.Kind.Error()
+	}
+	return e.Op + " " + e.Path + ": " + e.Kind.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is reports if the target is the kind of the error. The errors wrapped by Err are checked by errors.Is using Unwrap.
+func (e *Error) Is(target error) bool {
+	return target == e.Kind
+}
+
+// wrapErr converts an error of the v1 implementation into an *Error.
+// It returns nil for nil errors and io.EOF as it is, as readers must return io.EOF itself.
+func wrapErr(op, path string, err error) error {
+	if err == nil || err == io.EOF {
+		return err
+	}
+
+	var typed *Error
+	if errors.As(err, &typed) {
+		return err
+	}
+
+	return &Error{Op: op, Path: path, Kind: errorKind(err), Err: err}
+}
+
+// errorKind classifies the error.
+func errorKind(err error) error {
+	// The specific errors are checked first, as they also match the more general errors of io/fs
+	// (e.g. syscall.ENOTEMPTY is fs.ErrExist).
+	switch {
+	case errors.Is(err, syscall.ENOTEMPTY):
+		return ErrNotEmpty
+	case errors.Is(err, syscall.ENOTDIR):
+		return ErrNotDir
+	case errors.Is(err, syscall.EISDIR):
+		return ErrIsDir
+	case errors.Is(err, v1.ErrReadOnlyFilesystem):
+		return ErrReadOnly
+	}
+
+	for _, kind := range []error{
+		fs.ErrNotExist,
+		fs.ErrExist,
+		fs.ErrPermission,
+		fs.ErrClosed,
+		context.Canceled,
+		context.DeadlineExceeded,
+	} {
+		if errors.Is(err, kind) {
+			return kind
+		}
+	}
+
+	switch {
+	case errors.Is(err, v1.ErrFilesystemFull), errors.Is(err, v1.ErrDirectoryFull), errors.Is(err, syscall.EFBIG):
+		return ErrNoSpace
+	case errors.Is(err, v1.ErrNotSupported):
+		return ErrNotSupported
+	case errors.Is(err, syscall.EBADF):
+		// E.g. writing to a file which was opened read only.
+		return fs.ErrPermission
+	case errors.Is(err, v1.ErrInvalidPath), errors.Is(err, syscall.EINVAL):
+		return fs.ErrInvalid
+	default:
+		return ErrIO
+	}
+}
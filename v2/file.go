@@ -0,0 +1,105 @@
+package gofat
+
+import (
+	"io"
+	"io/fs"
+
+	v1 "github.com/aligator/gofat"
+)
+
+// File is an open file or directory of a FS.
+// It implements fs.File and fs.ReadDirFile and also supports seeking, random access and writing.
+type File struct {
+	file *v1.File
+	// name is the path the file was opened with.
+	name string
+}
+
+var (
+	_ fs.ReadDirFile     = (*File)(nil)
+	_ io.ReadWriteSeeker = (*File)(nil)
+	_ io.ReaderAt        = (*File)(nil)
+	_ io.WriterAt        = (*File)(nil)
+)
+
+// Name returns the path the file was opened with.
+func (f *File) Name() string {
+	return f.name
+}
+
+// Stat returns the information about the file.
+func (f *File) Stat() (fs.FileInfo, error) {
+	info, err := f.file.Stat()
+	return info, wrapErr("stat", f.name, err)
+}
+
+// Read reads up to len(p) bytes from the current offset.
+func (f *File) Read(p []byte) (int, error) {
+	n, err := f.file.Read(p)
+	return n, wrapErr("read", f.name, err)
+}
+
+// ReadAt reads len(p) bytes starting at the offset. It does not change the offset of the file
+// and may be called concurrently.
+func (f *File) ReadAt(p []byte, off int64) (int, error) {
+	n, err := f.file.ReadAt(p, off)
+	return n, wrapErr("read", f.name, err)
+}
+
+// WriteTo copies the rest of the file to w cluster by cluster. It is used by io.Copy.
+func (f *File) WriteTo(w io.Writer) (int64, error) {
+	n, err := f.file.WriteTo(w)
+	return n, wrapErr("read", f.name, err)
+}
+
+// Seek sets the offset of the next Read or Write, see io.Seeker.
+func (f *File) Seek(offset int64, whence int) (int64, error) {
+	n, err := f.file.Seek(offset, whence)
+	return n, wrapErr("seek", f.name, err)
+}
+
+// Write writes the data at the current offset. The file has to be opened for writing.
+func (f *File) Write(p []byte) (int, error) {
+	n, err := f.file.Write(p)
+	return n, wrapErr("write", f.name, err)
+}
+
+// WriteAt writes the data starting at the offset. It does not change the offset of the file.
+func (f *File) WriteAt(p []byte, off int64) (int, error) {
+	n, err := f.file.WriteAt(p, off)
+	return n, wrapErr("write", f.name, err)
+}
+
+// ReadFrom writes everything from r into the file, see io.ReaderFrom. It is used by io.Copy.
+func (f *File) ReadFrom(r io.Reader) (int64, error) {
+	n, err := f.file.ReadFrom(r)
+	return n, wrapErr("write", f.name, err)
+}
+
+// Truncate changes the size of the file.
+func (f *File) Truncate(size int64) error {
+	return wrapErr("truncate", f.name, f.file.Truncate(size))
+}
+
+// Sync flushes the device if it supports it.
+func (f *File) Sync() error {
+	return wrapErr("sync", f.name, f.file.Sync())
+}
+
+// Close closes the file.
+func (f *File) Close() error {
+	return wrapErr("close", f.name, f.file.Close())
+}
+
+// ReadDir returns the next n entries of the directory, see fs.ReadDirFile.
+// If n <= 0, all remaining entries are returned.
+func (f *File) ReadDir(n int) ([]fs.DirEntry, error) {
+	infos, err := f.file.Readdir(n)
+
+	entries := make([]fs.DirEntry, len(infos))
+	for i, info := range infos {
+		entries[i] = v1.GoDirEntry{FileInfo: info}
+	}
+
+	return entries, wrapErr("readdir", f.name, err)
+}
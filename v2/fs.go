@@ -0,0 +1,197 @@
+package gofat
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"sort"
+	"time"
+
+	v1 "github.com/aligator/gofat"
+	"github.com/spf13/afero"
+)
+
+// FS is a FAT16 or FAT32 filesystem.
+// It is read only if the device passed to Open does not implement io.Writer.
+//
+// All paths are unrooted slash separated paths as described by fs.ValidPath, e.g. "dir/file.txt".
+// The root directory is ".".
+type FS struct {
+	fs *v1.Fs
+}
+
+var (
+	_ fs.FS         = (*FS)(nil)
+	_ fs.StatFS     = (*FS)(nil)
+	_ fs.ReadDirFS  = (*FS)(nil)
+	_ fs.ReadFileFS = (*FS)(nil)
+)
+
+// Open opens the FAT filesystem on the device, e.g. an *os.File of an image or a block device.
+// If the device also implements io.Writer, the filesystem can be modified.
+func Open(device io.ReadSeeker, opts ...Option) (*FS, error) {
+	var options v1.Options
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	fatFs, err := v1.NewWithOptions(device, options)
+	if err != nil {
+		return nil, wrapErr("mount", "", err)
+	}
+
+	return &FS{fs: fatFs}, nil
+}
+
+// FromV1 wraps a filesystem opened by the v1 API. Both can be used at the same time.
+func FromV1(fatFs *v1.Fs) *FS {
+	return &FS{fs: fatFs}
+}
+
+// V1 returns the v1 filesystem behind the FS, e.g. for features which are not part of the v2 API yet.
+func (f *FS) V1() *v1.Fs {
+	return f.fs
+}
+
+// Afero returns the filesystem as afero.Fs. It uses the same paths as FS.
+func (f *FS) Afero() afero.Fs {
+	return f.fs
+}
+
+// Label returns the volume label.
+func (f *FS) Label() string {
+	return f.fs.Label()
+}
+
+// Type returns the FAT type, either v1.FAT16 or v1.FAT32.
+func (f *FS) Type() v1.FATType {
+	return f.fs.FSType()
+}
+
+// Open opens the named file or directory for reading.
+func (f *FS) Open(name string) (fs.File, error) {
+	return f.OpenFile(name, os.O_RDONLY, 0)
+}
+
+// Create creates or truncates the named file and opens it for reading and writing.
+func (f *FS) Create(name string) (*File, error) {
+	return f.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+// OpenFile opens the named file using the flags of os.OpenFile.
+// The perm is only used to set the read only attribute of new files.
+func (f *FS) OpenFile(name string, flag int, perm fs.FileMode) (*File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &Error{Op: "open", Path: name, Kind: fs.ErrInvalid, Err: v1.ErrInvalidPath}
+	}
+
+	file, err := f.fs.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, wrapErr("open", name, err)
+	}
+
+	return &File{file: file.(*v1.File), name: name}, nil
+}
+
+// Stat returns the information about the named file or directory.
+// The result also implements v1.FileInfo, which provides the FAT specific fields.
+func (f *FS) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &Error{Op: "stat", Path: name, Kind: fs.ErrInvalid, Err: v1.ErrInvalidPath}
+	}
+
+	info, err := f.fs.Stat(name)
+	return info, wrapErr("stat", name, err)
+}
+
+// ReadDir returns the entries of the named directory sorted by name.
+func (f *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	file, err := f.OpenFile(name, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, wrapErr("readdir", name, err)
+	}
+	defer file.Close()
+
+	entries, err := file.ReadDir(-1)
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	return entries, wrapErr("readdir", name, err)
+}
+
+// ReadFile returns the whole content of the named file.
+func (f *FS) ReadFile(name string) ([]byte, error) {
+	file, err := f.OpenFile(name, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, wrapErr("read", name, err)
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	return data, wrapErr("read", name, err)
+}
+
+// WriteFile writes the data into the named file. It is created if it does not exist and truncated otherwise.
+func (f *FS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	file, err := f.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return wrapErr("write", name, err)
+	}
+
+	_, err = file.Write(data)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return wrapErr("write", name, err)
+}
+
+// Mkdir creates the named directory. Its parent has to exist.
+func (f *FS) Mkdir(name string) error {
+	if !fs.ValidPath(name) {
+		return &Error{Op: "mkdir", Path: name, Kind: fs.ErrInvalid, Err: v1.ErrInvalidPath}
+	}
+	return wrapErr("mkdir", name, f.fs.Mkdir(name, 0777))
+}
+
+// MkdirAll creates the named directory including all missing parents.
+func (f *FS) MkdirAll(name string) error {
+	if !fs.ValidPath(name) {
+		return &Error{Op: "mkdir", Path: name, Kind: fs.ErrInvalid, Err: v1.ErrInvalidPath}
+	}
+	return wrapErr("mkdir", name, f.fs.MkdirAll(name, 0777))
+}
+
+// Remove removes the named file or empty directory.
+func (f *FS) Remove(name string) error {
+	if !fs.ValidPath(name) {
+		return &Error{Op: "remove", Path: name, Kind: fs.ErrInvalid, Err: v1.ErrInvalidPath}
+	}
+	return wrapErr("remove", name, f.fs.Remove(name))
+}
+
+// RemoveAll removes the named file or directory including all of its content.
+// It returns nil if the path does not exist.
+func (f *FS) RemoveAll(name string) error {
+	if !fs.ValidPath(name) {
+		return &Error{Op: "remove", Path: name, Kind: fs.ErrInvalid, Err: v1.ErrInvalidPath}
+	}
+	return wrapErr("remove", name, f.fs.RemoveAll(name))
+}
+
+// Rename moves the file or directory oldname to newname.
+func (f *FS) Rename(oldname, newname string) error {
+	for _, name := range []string{oldname, newname} {
+		if !fs.ValidPath(name) {
+			return &Error{Op: "rename", Path: name, Kind: fs.ErrInvalid, Err: v1.ErrInvalidPath}
+		}
+	}
+	return wrapErr("rename", oldname, f.fs.Rename(oldname, newname))
+}
+
+// Chtimes changes the access and modification times of the named file.
+func (f *FS) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	if !fs.ValidPath(name) {
+		return &Error{Op: "chtimes", Path: name, Kind: fs.ErrInvalid, Err: v1.ErrInvalidPath}
+	}
+	return wrapErr("chtimes", name, f.fs.Chtimes(name, atime, mtime))
+}
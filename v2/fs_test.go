@@ -0,0 +1,214 @@
+package gofat
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"testing/fstest"
+
+	v1 "github.com/aligator/gofat"
+)
+
+// testingImage formats a new FAT32 image in a temporary file and opens it.
+func testingImage(t *testing.T) *FS {
+	file, err := os.Create(filepath.Join(t.TempDir(), "fat.img"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		file.Close()
+	})
+
+	if err := v1.Format(file, v1.FormatOptions{Size: 128 * 1024 * 1024, FSType: v1.FAT32}); err != nil {
+		t.Fatal(err)
+	}
+
+	fsys, err := Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fsys
+}
+
+// testingReadOnly opens a test image of the v1 package read only.
+func testingReadOnly(t *testing.T) *FS {
+	data, err := os.ReadFile("../testdata/fat32.img")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fsys, err := Open(bytes.NewReader(data), WithCacheSize(16), WithFatInMemory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fsys
+}
+
+func TestFS(t *testing.T) {
+	fsys := testingReadOnly(t)
+	if err := fstest.TestFS(fsys, "DoNotEdit_tests/HelloWorldThisIsALoongFileName.txt", "DoNotEdit_tests/README.md"); err != nil {
+		t.Fatal(err)
+	}
+
+	if fsys.Type() != v1.FAT32 || fsys.V1() == nil || FromV1(fsys.V1()).Label() != fsys.Label() {
+		t.Errorf("the FS does not wrap the v1 filesystem")
+	}
+}
+
+func TestFS_write(t *testing.T) {
+	fsys := testingImage(t)
+
+	data := bytes.Repeat([]byte("GoFAT"), 2000)
+	if err := fsys.MkdirAll("a/b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fsys.WriteFile("a/b/file.txt", data, 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := fsys.Rename("a/b/file.txt", "a/moved.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := fsys.ReadFile("a/moved.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("FS.ReadFile() returned %v bytes, want %v bytes", len(got), len(data))
+	}
+
+	file, err := fsys.Create("a/created.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := file.WriteAt([]byte("hello"), 3); err != nil {
+		t.Fatal(err)
+	}
+	if err := file.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := fsys.ReadDir("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	if want := []string{"b", "created.txt", "moved.txt"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("FS.ReadDir() = %v, want %v", names, want)
+	}
+
+	if err := fsys.RemoveAll("a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fsys.Stat("a"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("FS.Stat() after RemoveAll error = %v, want %v", err, fs.ErrNotExist)
+	}
+
+	// The afero adapter works on the same filesystem.
+	if err := fsys.WriteFile("afero.txt", data, 0666); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := fsys.Afero().Stat("afero.txt"); err != nil || info.Size() != int64(len(data)) {
+		t.Errorf("Afero().Stat() = %v, %v", info, err)
+	}
+}
+
+func TestFS_errors(t *testing.T) {
+	fsys := testingImage(t)
+	if err := fsys.WriteFile("file", []byte("data"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := fsys.MkdirAll("dir/sub"); err != nil {
+		t.Fatal(err)
+	}
+	readOnly := testingReadOnly(t)
+
+	tests := []struct {
+		name     string
+		run      func() error
+		wantOp   string
+		wantPath string
+		wantKind error
+	}{
+		{
+			name:     "missing file",
+			run:      func() error { _, err := fsys.Open("missing"); return err },
+			wantOp:   "open",
+			wantPath: "missing",
+			wantKind: fs.ErrNotExist,
+		},
+		{
+			name:     "invalid path",
+			run:      func() error { _, err := fsys.Stat("/file"); return err },
+			wantOp:   "stat",
+			wantPath: "/file",
+			wantKind: fs.ErrInvalid,
+		},
+		{
+			name:     "existing directory",
+			run:      func() error { return fsys.Mkdir("dir") },
+			wantOp:   "mkdir",
+			wantPath: "dir",
+			wantKind: fs.ErrExist,
+		},
+		{
+			name:     "directory not empty",
+			run:      func() error { return fsys.Remove("dir") },
+			wantOp:   "remove",
+			wantPath: "dir",
+			wantKind: ErrNotEmpty,
+		},
+		{
+			name:     "file as directory",
+			run:      func() error { return fsys.Mkdir("file/sub") },
+			wantOp:   "mkdir",
+			wantPath: "file/sub",
+			wantKind: ErrNotDir,
+		},
+		{
+			name: "write to a file opened read only",
+			run: func() error {
+				file, err := fsys.OpenFile("file", os.O_RDONLY, 0)
+				if err != nil {
+					return err
+				}
+				defer file.Close()
+				_, err = file.Write([]byte("data"))
+				return err
+			},
+			wantOp:   "write",
+			wantPath: "file",
+			wantKind: fs.ErrPermission,
+		},
+		{
+			name:     "read only filesystem",
+			run:      func() error { return readOnly.Mkdir("dir") },
+			wantOp:   "mkdir",
+			wantPath: "dir",
+			wantKind: ErrReadOnly,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.run()
+
+			var typed *Error
+			if !errors.As(err, &typed) {
+				t.Fatalf("error = %v, want an *Error", err)
+			}
+			if typed.Op != tt.wantOp || typed.Path != tt.wantPath || typed.Kind != tt.wantKind {
+				t.Errorf("error = %q %q %v, want %q %q %v", typed.Op, typed.Path, typed.Kind, tt.wantOp, tt.wantPath, tt.wantKind)
+			}
+			if !errors.Is(err, tt.wantKind) {
+				t.Errorf("errors.Is(%v, %v) = false", err, tt.wantKind)
+			}
+		})
+	}
+}
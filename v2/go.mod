@@ -0,0 +1,8 @@
+module github.com/aligator/gofat/v2
+
+go 1.16
+
+require (
+	github.com/aligator/gofat v1.0.0
+	github.com/spf13/afero v1.5.1
+)
@@ -0,0 +1,117 @@
+package gofat
+
+import (
+	"io"
+
+	v1 "github.com/aligator/gofat"
+)
+
+// Option configures how a filesystem is opened, see Open.
+type Option func(o *v1.Options)
+
+// WithSkipChecks skips some filesystem validations which may allow to open not perfectly standard FAT filesystems.
+// Use with caution!
+func WithSkipChecks() Option {
+	return func(o *v1.Options) {
+		o.SkipChecks = true
+	}
+}
+
+// WithCacheSize sets the count of sectors which are kept in memory.
+func WithCacheSize(sectors int) Option {
+	return func(o *v1.Options) {
+		o.CacheSize = sectors
+	}
+}
+
+// WithFatInMemory loads the whole FAT into memory, so that following cluster chains needs no reads.
+func WithFatInMemory() Option {
+	return func(o *v1.Options) {
+		o.FatInMemory = true
+	}
+}
+
+// WithSortedEntries keeps the entries of each directory sorted by name when new entries are added.
+// Some embedded firmware needs this to find files.
+func WithSortedEntries() Option {
+	return func(o *v1.Options) {
+		o.SortEntries = true
+	}
+}
+
+// WithIndexSize sets the count of directories for which the entry names are indexed. A negative size disables it.
+func WithIndexSize(directories int) Option {
+	return func(o *v1.Options) {
+		o.IndexSize = directories
+	}
+}
+
+// WithNameMatcher overrides how names from paths are compared with the names of directory entries.
+// By default they are compared case-insensitively like FAT does it.
+func WithNameMatcher(match func(entryName, name string) bool) Option {
+	return func(o *v1.Options) {
+		o.MatchName = match
+	}
+}
+
+// WithProgress sets a func which is called by long-running operations with the count of bytes processed so far.
+func WithProgress(progress func(done, total int64)) Option {
+	return func(o *v1.Options) {
+		o.Progress = progress
+	}
+}
+
+// WithLogger sets a logger for debug messages, e.g. the details of the mounted filesystem and the findings of checks.
+// A *slog.Logger can be used directly.
+func WithLogger(logger v1.Logger) Option {
+	return func(o *v1.Options) {
+		o.Logger = logger
+	}
+}
+
+// WithTracer sets a tracer which is called after each sector fetch, FAT lookup and directory parse,
+// e.g. to record tracing spans.
+func WithTracer(tracer v1.Tracer) Option {
+	return func(o *v1.Options) {
+		o.Tracer = tracer
+	}
+}
+
+// WithDryRun keeps all writes in memory instead of applying them to the image.
+// The recorded changes can be listed with Changes.
+func WithDryRun() Option {
+	return func(o *v1.Options) {
+		o.DryRun = true
+	}
+}
+
+// WithClock sets the clock which provides the time for all written timestamps, e.g. a FixedClock for
+// reproducible images.
+func WithClock(clock v1.Clock) Option {
+	return func(o *v1.Options) {
+		o.Clock = clock
+	}
+}
+
+// WithRecord records every sector read and write into w, so that problems can be reproduced offline.
+// See the Options.Record of the v1 API for the format.
+func WithRecord(w io.Writer) Option {
+	return func(o *v1.Options) {
+		o.Record = w
+	}
+}
+
+// WithOpenFileTracking keeps a registry of the open files, see the Options.TrackOpenFiles of the v1 API.
+// The open files and leaks are available through FS.V1().
+func WithOpenFileTracking() Option {
+	return func(o *v1.Options) {
+		o.TrackOpenFiles = true
+	}
+}
+
+// WithMaxOpenFiles limits the count of files which may be open at once, see the Options.MaxOpenFiles of the v1 API.
+func WithMaxOpenFiles(max int) Option {
+	return func(o *v1.Options) {
+		o.MaxOpenFiles = max
+	}
+}
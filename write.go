@@ -0,0 +1,1239 @@
+package gofat
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/aligator/gofat/checkpoint"
+)
+
+// eocMarker is the value written into the FAT to mark the end of a cluster chain.
+const eocMarker fatEntry = 0x0FFFFFFF
+
+// unknownFreeCount is the value of the FSInfo free count if it is not known.
+const unknownFreeCount = 0xFFFFFFFF
+
+// allocation holds the state needed to allocate clusters.
+// It is mirrored into the FSInfo sector for FAT32.
+type allocation struct {
+	// freeCount is the count of free clusters or unknownFreeCount.
+	freeCount uint32
+	// nextFree is a hint where to start searching for the next free cluster.
+	nextFree uint32
+	// dirty is true if the values changed since they were written the last time.
+	dirty bool
+}
+
+// entryRef is a directory entry together with its position inside of the parent directory.
+type entryRef struct {
+	ExtendedEntryHeader
+	// dirCluster is the first cluster of the parent directory. It is 0 if the parent is the root directory.
+	dirCluster fatEntry
+	// index is the slot of the short entry inside of the parent directory.
+	// It is -1 for the root directory itself.
+	index int
+	// lfnCount is the count of long filename slots directly in front of the short entry.
+	lfnCount int
+}
+
+// rootRef returns a fake entry for the root directory as the root directory has no own entry.
+func rootRef() entryRef {
+	return entryRef{
+		ExtendedEntryHeader: ExtendedEntryHeader{
+			EntryHeader: EntryHeader{
+				Name:      [11]byte{' ', ' ', ' ', ' ', ' ', ' ', ' ', ' ', ' ', ' ', ' '},
+				Attribute: AttrDirectory,
+			},
+		},
+		index: -1,
+	}
+}
+
+func (e entryRef) isRoot() bool {
+	return e.index < 0
+}
+
+func (e entryRef) isDir() bool {
+	return e.Attribute&AttrDirectory == AttrDirectory
+}
+
+// firstCluster returns the first cluster of the entry.
+func (h EntryHeader) firstCluster() fatEntry {
+	return fatEntry(uint32(h.FirstClusterHI)<<16 | uint32(h.FirstClusterLO))
+}
+
+// setFirstCluster sets the first cluster of the entry.
+func (h *EntryHeader) setFirstCluster(cluster fatEntry) {
+	h.FirstClusterHI = uint16(cluster.Value() >> 16)
+	h.FirstClusterLO = uint16(cluster.Value() & 0xFFFF)
+}
+
+// newEntryHeader creates an entry header with all timestamps set to now.
+func newEntryHeader(attribute byte, now time.Time) EntryHeader {
+	return EntryHeader{
+		Attribute:       attribute,
+		CreateTimeTenth: formatTimeTenth(now),
+		CreateTime:      FormatTime(now),
+		CreateDate:      FormatDate(now),
+		LastAccessDate:  FormatDate(now),
+		WriteTime:       FormatTime(now),
+		WriteDate:       FormatDate(now),
+	}
+}
+
+// encodeEntry converts a directory entry (EntryHeader or LongFilenameEntry) into its 32 byte representation.
+func encodeEntry(entry interface{}) []byte {
+	if header, ok := entry.(EntryHeader); ok && header.Name[0] == 0xE5 {
+		// An initial 0xE5 has to be stored as 0x05 as 0xE5 marks deleted entries.
+		header.Name[0] = 0x05
+		entry = header
+	}
+
+	buffer := bytes.NewBuffer(make([]byte, 0, 32))
+	// Writing fixed size structs into a bytes.Buffer cannot fail.
+	_ = binary.Write(buffer, binary.LittleEndian, entry)
+	return buffer.Bytes()
+}
+
+// mutate runs the given operation while holding the write lock.
+// It is the entry point for all operations which modify the filesystem.
+// The mutation is recorded in the journal with the clusters changed by the operation.
+func (f *Fs) mutate(mutation Mutation, op func() error) error {
+	if f.writer == nil {
+		return checkpoint.From(ErrReadOnlyFilesystem)
+	}
+
+	f.writeLock.Lock()
+	defer f.writeLock.Unlock()
+
+	if f.freeze.isFrozen() {
+		return checkpoint.From(errFrozen)
+	}
+
+	if err := f.canceled(); err != nil {
+		return err
+	}
+	atomic.StoreInt32(&f.mutating, 1)
+	defer atomic.StoreInt32(&f.mutating, 0)
+
+	f.journal.begin(mutation)
+	err := op()
+	if flushErr := f.flushFSInfo(); err == nil {
+		err = flushErr
+	}
+	f.journal.end(err)
+
+	return err
+}
+
+// clusterSize returns the size of one cluster in bytes.
+func (f *Fs) clusterSize() int64 {
+	return int64(f.info.SectorsPerCluster) * int64(f.info.BytesPerSector)
+}
+
+// firstSectorOfCluster returns the first sector of the given data cluster.
+func (f *Fs) firstSectorOfCluster(cluster fatEntry) uint32 {
+	return ((cluster.Value() - 2) * uint32(f.info.SectorsPerCluster)) + f.info.FirstDataSector
+}
+
+// rootDirSectors returns the count of sectors used by the root directory for FAT types < FAT32.
+func (f *Fs) rootDirSectors() uint32 {
+	return ((uint32(f.info.RootEntryCount) * 32) + (uint32(f.info.BytesPerSector) - 1)) / uint32(f.info.BytesPerSector)
+}
+
+// validCluster returns true if the cluster is a data cluster of this filesystem.
+func (f *Fs) validCluster(cluster fatEntry) bool {
+	return cluster.Value() >= 2 && cluster.Value() < f.info.ClusterCount+2
+}
+
+// store writes the given sector back to the filesystem and updates the sector cache.
+func (f *Fs) store(sector Sector) error {
+	if f.writer == nil {
+		return checkpoint.From(ErrReadOnlyFilesystem)
+	}
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	_, err := f.reader.Seek(int64(sector.current)*int64(f.info.BytesPerSector), io.SeekStart)
+	if err != nil {
+		return checkpoint.Wrap(err, fmt.Errorf("%w: sector %d", ErrWriteFilesystem, sector.current))
+	}
+
+	_, err = f.writer.Write(sector.buffer)
+	f.record(RecordWrite, sector.current, sector.buffer, len(sector.buffer), err)
+	if err != nil {
+		return checkpoint.Wrap(err, fmt.Errorf("%w: sector %d", ErrWriteFilesystem, sector.current))
+	}
+	f.stats.written(1, len(sector.buffer))
+	f.touchSectors(sector.current, 1)
+
+	shard := f.sectorCache.shard(sector.current)
+	shard.lock.Lock()
+	shard.cache.put(sector)
+	shard.cache.generation++
+	shard.lock.Unlock()
+	f.dirIndex.clear()
+	f.chains.clear()
+	return nil
+}
+
+// storeSectors writes the data to the filesystem starting at the given sector.
+// The data has to be a multiple of the sector size.
+func (f *Fs) storeSectors(sectorNum uint32, data []byte) error {
+	if f.writer == nil {
+		return checkpoint.From(ErrReadOnlyFilesystem)
+	}
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	_, err := f.reader.Seek(int64(sectorNum)*int64(f.info.BytesPerSector), io.SeekStart)
+	if err != nil {
+		return checkpoint.Wrap(err, fmt.Errorf("%w: sector %d", ErrWriteFilesystem, sectorNum))
+	}
+
+	_, err = f.writer.Write(data)
+	f.record(RecordWrite, sectorNum, data, len(data), err)
+	if err != nil {
+		return checkpoint.Wrap(err, fmt.Errorf("%w: sector %d", ErrWriteFilesystem, sectorNum))
+	}
+	f.stats.written(uint64(len(data)/int(f.info.BytesPerSector)), len(data))
+	f.touchSectors(sectorNum, uint32(len(data)/int(f.info.BytesPerSector)))
+
+	f.sectorCache.invalidate(sectorNum, uint32(len(data)/int(f.info.BytesPerSector)))
+	f.dirIndex.clear()
+	f.chains.clear()
+
+	return nil
+}
+
+// readSectors reads count sectors at once starting at the given sector.
+// The returned buffer is taken from f.buffers and should be given back with f.buffers.put after it was used.
+func (f *Fs) readSectors(sectorNum uint32, count uint32) ([]byte, error) {
+	data := f.buffers.get(int(count) * int(f.info.BytesPerSector))
+	if err := f.readSectorsInto(sectorNum, data); err != nil {
+		f.buffers.put(data)
+		return nil, err
+	}
+	return data, nil
+}
+
+// readSectorsInto fills the data with the sectors starting at the given sector.
+// The length of the data has to be a multiple of the sector size.
+func (f *Fs) readSectorsInto(sectorNum uint32, data []byte) error {
+	if err := f.canceled(); err != nil {
+		return err
+	}
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	count := len(data) / int(f.info.BytesPerSector)
+	start := f.traceStart()
+	_, err := f.reader.Seek(int64(sectorNum)*int64(f.info.BytesPerSector), io.SeekStart)
+	if err == nil {
+		_, err = io.ReadFull(f.reader, data)
+	}
+
+	f.traceSectorFetch(sectorNum, count, start, err)
+	f.record(RecordRead, sectorNum, data, len(data), err)
+	if err != nil {
+		return checkpoint.Wrap(err, fmt.Errorf("%w: sector %d", ErrFetchingSector, sectorNum))
+	}
+
+	f.stats.read(uint64(count), len(data))
+	return nil
+}
+
+// modifySector loads a sector, passes a copy of its content to modify and stores the result.
+func (f *Fs) modifySector(sectorNum uint32, modify func(buffer []byte)) error {
+	// fetch already returns a copy.
+	sector, err := f.fetch(sectorNum)
+	if err != nil {
+		return err
+	}
+
+	modify(sector.buffer)
+	return f.store(sector)
+}
+
+// setFatEntry sets the fat entry of the given cluster to the given value in all FATs.
+func (f *Fs) setFatEntry(cluster fatEntry, value fatEntry) error {
+	if !f.validCluster(cluster) {
+		return checkpoint.From(fmt.Errorf("%w: invalid cluster %d", ErrWriteFat, cluster))
+	}
+
+	f.journal.touch(cluster.Value())
+	if f.info.FSType == FAT12 {
+		return f.setFat12Entry(cluster, value)
+	}
+
+	fatOffset := f.fatOffset(cluster)
+	fatEntryOffset := fatOffset % uint32(f.info.BytesPerSector)
+
+	for i := uint32(0); i < uint32(f.info.FatCount); i++ {
+		fatSectorNumber := uint32(f.info.ReservedSectorCount) + i*f.info.FatSize + (fatOffset / uint32(f.info.BytesPerSector))
+
+		err := f.modifySector(fatSectorNumber, func(buffer []byte) {
+			switch f.info.FSType {
+			case FAT16:
+				// The FAT32 special values just get truncated to the FAT16 ones (e.g. 0x0FFFFFFF -> 0xFFFF).
+				binary.LittleEndian.PutUint16(buffer[fatEntryOffset:fatEntryOffset+2], uint16(value.Value()))
+			case FAT32:
+				// The high 4 bits are reserved and have to be preserved.
+				old := binary.LittleEndian.Uint32(buffer[fatEntryOffset : fatEntryOffset+4])
+				binary.LittleEndian.PutUint32(buffer[fatEntryOffset:fatEntryOffset+4], old&0xF0000000|value.Value()&0x0FFFFFFF)
+			}
+
+			if i == 0 {
+				f.updateFat(fatOffset, buffer[fatEntryOffset:])
+			}
+		})
+		if err != nil {
+			return checkpoint.Wrap(err, ErrWriteFat)
+		}
+	}
+
+	return nil
+}
+
+// setFat12Entry sets the 12 bit fat entry of the given cluster in all FATs.
+// The entry shares its bytes with the neighbouring entries and may continue in the next sector,
+// so each of its two bytes is modified on its own.
+func (f *Fs) setFat12Entry(cluster fatEntry, value fatEntry) error {
+	fatOffset := f.fatOffset(cluster)
+
+	// The FAT32 special values just get truncated to the FAT12 ones (e.g. 0x0FFFFFFF -> 0xFFF).
+	entry, mask := uint16(value.Value()&0x0FFF), uint16(0x0FFF)
+	if cluster.Value()%2 == 1 {
+		entry, mask = entry<<4, mask<<4
+	}
+
+	for i := uint32(0); i < uint32(f.info.FatCount); i++ {
+		for b := uint32(0); b < 2; b++ {
+			offset := fatOffset + b
+			fatSectorNumber := uint32(f.info.ReservedSectorCount) + i*f.info.FatSize + (offset / uint32(f.info.BytesPerSector))
+			fatByteOffset := offset % uint32(f.info.BytesPerSector)
+			entryByte, maskByte := byte(entry>>(8*b)), byte(mask>>(8*b))
+
+			err := f.modifySector(fatSectorNumber, func(buffer []byte) {
+				buffer[fatByteOffset] = buffer[fatByteOffset]&^maskByte | entryByte
+
+				if i == 0 {
+					f.updateFat(offset, buffer[fatByteOffset:fatByteOffset+1])
+				}
+			})
+			if err != nil {
+				return checkpoint.Wrap(err, ErrWriteFat)
+			}
+		}
+	}
+
+	return nil
+}
+
+// clusterChain returns all clusters of the chain starting at the given cluster.
+// A cluster of 0 results in an empty chain.
+func (f *Fs) clusterChain(cluster fatEntry) ([]fatEntry, error) {
+	var chain []fatEntry
+
+	for current := cluster; current.IsNextCluster(); {
+		if !f.validCluster(current) || uint32(len(chain)) > f.info.ClusterCount {
+			return chain, checkpoint.From(fmt.Errorf("%w: invalid cluster chain starting at cluster %d", ErrReadFat, cluster))
+		}
+
+		chain = append(chain, current)
+
+		next, err := f.getFatEntry(current)
+		if err != nil {
+			return chain, err
+		}
+		current = next
+	}
+
+	return chain, nil
+}
+
+// allocateCluster searches a free cluster, marks it as end of the chain and appends it to the chain ending at prev.
+// If prev is 0, the cluster starts a new chain.
+func (f *Fs) allocateCluster(prev fatEntry) (fatEntry, error) {
+	count := f.info.ClusterCount
+
+	start := f.alloc.nextFree
+	if start < 2 || start >= count+2 {
+		start = 2
+	}
+
+	for i := uint32(0); i < count; i++ {
+		cluster := fatEntry(2 + (start-2+i)%count)
+
+		entry, err := f.getFatEntry(cluster)
+		if err != nil {
+			return 0, err
+		}
+
+		if !entry.IsFree() {
+			continue
+		}
+
+		err = f.setFatEntry(cluster, eocMarker)
+		if err != nil {
+			return 0, err
+		}
+
+		if prev != 0 {
+			err = f.setFatEntry(prev, cluster)
+			if err != nil {
+				return 0, err
+			}
+		}
+
+		f.alloc.nextFree = cluster.Value() + 1
+		if f.alloc.freeCount != unknownFreeCount && f.alloc.freeCount > 0 {
+			f.alloc.freeCount--
+		}
+		f.alloc.dirty = true
+
+		return cluster, nil
+	}
+
+	return 0, checkpoint.From(ErrFilesystemFull)
+}
+
+// freeChain marks all clusters of the chain starting at the given cluster as free.
+func (f *Fs) freeChain(cluster fatEntry) error {
+	chain, err := f.clusterChain(cluster)
+	if err != nil {
+		return err
+	}
+
+	for _, current := range chain {
+		err = f.setFatEntry(current, 0)
+		if err != nil {
+			return err
+		}
+
+		if f.alloc.freeCount != unknownFreeCount {
+			f.alloc.freeCount++
+		}
+		f.alloc.dirty = true
+	}
+
+	return nil
+}
+
+// zeroCluster overwrites the whole cluster with zeros.
+func (f *Fs) zeroCluster(cluster fatEntry) error {
+	return f.storeSectors(f.firstSectorOfCluster(cluster), make([]byte, f.clusterSize()))
+}
+
+// flushFSInfo writes the allocation state into the FSInfo sector if it changed.
+// This is only needed for FAT32.
+func (f *Fs) flushFSInfo() error {
+	if !f.alloc.dirty || f.info.FSType != FAT32 || f.info.fat32Specific.FSInfo == 0 || f.info.fat32Specific.FSInfo == 0xFFFF {
+		return nil
+	}
+
+	err := f.modifySector(uint32(f.info.fat32Specific.FSInfo), func(buffer []byte) {
+		binary.LittleEndian.PutUint32(buffer[488:492], f.alloc.freeCount)
+		binary.LittleEndian.PutUint32(buffer[492:496], f.alloc.nextFree)
+	})
+	if err != nil {
+		return err
+	}
+
+	f.alloc.dirty = false
+	return nil
+}
+
+// growChain appends new clusters to the chain until it can hold size bytes.
+// If the chain is empty, a new chain is created. The clusters are not cleared.
+// If not all clusters can be allocated, the new ones are given back and the chain is left as it was.
+func (f *Fs) growChain(chain []fatEntry, size int64) ([]fatEntry, error) {
+	clusterSize := f.clusterSize()
+	originalLength := len(chain)
+	for int64(len(chain))*clusterSize < size {
+		var prev fatEntry
+		if len(chain) > 0 {
+			prev = chain[len(chain)-1]
+		}
+
+		next, err := f.allocateCluster(prev)
+		if err != nil {
+			// Give the already allocated clusters back.
+			if originalLength == 0 && len(chain) > 0 {
+				_ = f.freeChain(chain[0])
+			} else if len(chain) > originalLength {
+				_ = f.setFatEntry(chain[originalLength-1], eocMarker)
+				_ = f.freeChain(chain[originalLength])
+			}
+			return chain[:originalLength], err
+		}
+		chain = append(chain, next)
+	}
+
+	return chain, nil
+}
+
+// reserveChain makes sure that the chain starting at the given cluster can hold size bytes
+// without changing the data stored in it. A cluster of 0 creates a new chain.
+// It returns the whole (possibly new) chain.
+func (f *Fs) reserveChain(cluster fatEntry, size int64) ([]fatEntry, error) {
+	chain, err := f.clusterChain(cluster)
+	if err != nil {
+		return chain, err
+	}
+
+	return f.growChain(chain, size)
+}
+
+// writeChainAt writes the data into the file starting at the given cluster at the given offset.
+// Missing clusters are allocated. If the offset is behind the fileSize, the gap is filled with zeros
+// so that no old data of the clusters gets visible.
+// It returns the (maybe new) first cluster of the file.
+func (f *Fs) writeChainAt(cluster fatEntry, fileSize int64, offset int64, data []byte) (fatEntry, error) {
+	start := offset
+	if fileSize < offset {
+		start = fileSize
+	}
+	end := offset + int64(len(data))
+
+	if start >= end {
+		return cluster, nil
+	}
+
+	chain, err := f.clusterChain(cluster)
+	if err != nil {
+		return cluster, err
+	}
+
+	chain, err = f.growChain(chain, end)
+	if err != nil {
+		return cluster, err
+	}
+
+	return chain[0], f.writeClusters(chain, fileSize, offset, data)
+}
+
+// writeClusters writes the data into the file with the given chain at the given offset.
+// The chain has to be able to hold all data already. See writeChainAt for details.
+func (f *Fs) writeClusters(chain []fatEntry, fileSize int64, offset int64, data []byte) error {
+	start := offset
+	if fileSize < offset {
+		start = fileSize
+	}
+	end := offset + int64(len(data))
+
+	clusterSize := f.clusterSize()
+	bytesPerSector := int64(f.info.BytesPerSector)
+
+	// content returns the bytes to write for the range [from, to).
+	// Everything in front of the offset is part of the gap and therefore zero.
+	content := func(from, to int64) []byte {
+		result := make([]byte, to-from)
+		if to > offset {
+			dataFrom := from - offset
+			if dataFrom < 0 {
+				dataFrom = 0
+			}
+			copy(result[max64(offset-from, 0):], data[dataFrom:to-offset])
+		}
+		return result
+	}
+
+	for pos := start; pos < end; {
+		currentCluster := chain[pos/clusterSize]
+		inCluster := pos % clusterSize
+		segmentEnd := pos - inCluster + clusterSize
+		if segmentEnd > end {
+			segmentEnd = end
+		}
+
+		firstSector := f.firstSectorOfCluster(currentCluster)
+
+		for pos < segmentEnd {
+			inCluster = pos % clusterSize
+			sectorNum := firstSector + uint32(inCluster/bytesPerSector)
+			inSector := pos % bytesPerSector
+
+			// Write all full sectors at once.
+			if inSector == 0 && segmentEnd-pos >= bytesPerSector {
+				fullEnd := pos + (segmentEnd-pos)/bytesPerSector*bytesPerSector
+				err := f.storeSectors(sectorNum, content(pos, fullEnd))
+				if err != nil {
+					return err
+				}
+				pos = fullEnd
+				continue
+			}
+
+			// Partial sectors have to be merged with the existing data.
+			partEnd := pos - inSector + bytesPerSector
+			if partEnd > segmentEnd {
+				partEnd = segmentEnd
+			}
+			part := content(pos, partEnd)
+			err := f.modifySector(sectorNum, func(buffer []byte) {
+				copy(buffer[inSector:], part)
+			})
+			if err != nil {
+				return err
+			}
+			pos = partEnd
+		}
+	}
+
+	return nil
+}
+
+// truncateChain cuts the chain starting at cluster so that it fits the given size.
+// If the size is bigger than the fileSize, the file is extended with zeros.
+// It returns the (maybe new) first cluster which is 0 for empty files.
+func (f *Fs) truncateChain(cluster fatEntry, fileSize int64, size int64) (fatEntry, error) {
+	if size > fileSize {
+		return f.writeChainAt(cluster, fileSize, size, nil)
+	}
+
+	needed := (size + f.clusterSize() - 1) / f.clusterSize()
+	if needed == 0 {
+		return 0, f.freeChain(cluster)
+	}
+
+	chain, err := f.clusterChain(cluster)
+	if err != nil {
+		return cluster, err
+	}
+
+	if int64(len(chain)) > needed {
+		err = f.setFatEntry(chain[needed-1], eocMarker)
+		if err != nil {
+			return cluster, err
+		}
+
+		err = f.freeChain(chain[needed])
+		if err != nil {
+			return cluster, err
+		}
+	}
+
+	return cluster, nil
+}
+
+// dirSectors returns all sectors of the directory starting at the given cluster in order.
+// A dirCluster of 0 references the root directory.
+func (f *Fs) dirSectors(dirCluster fatEntry) ([]uint32, error) {
+	var sectors []uint32
+
+	if dirCluster == 0 && f.info.FSType != FAT32 {
+		firstRootSector := uint32(f.info.ReservedSectorCount) + (uint32(f.info.FatCount) * f.info.FatSize)
+		for i := uint32(0); i < f.rootDirSectors(); i++ {
+			sectors = append(sectors, firstRootSector+i)
+		}
+		return sectors, nil
+	}
+
+	if dirCluster == 0 {
+		dirCluster = f.info.fat32Specific.RootCluster
+	}
+
+	chain, err := f.clusterChain(dirCluster)
+	if err != nil {
+		return nil, checkpoint.Wrap(err, ErrReadFilesystemDir)
+	}
+
+	for _, cluster := range chain {
+		firstSector := f.firstSectorOfCluster(cluster)
+		for i := uint32(0); i < uint32(f.info.SectorsPerCluster); i++ {
+			sectors = append(sectors, firstSector+i)
+		}
+	}
+
+	return sectors, nil
+}
+
+// readDirSlots reads the raw data of the directory starting at the given cluster.
+// A dirCluster of 0 references the root directory.
+func (f *Fs) readDirSlots(dirCluster fatEntry) ([]byte, []uint32, error) {
+	sectors, err := f.dirSectors(dirCluster)
+	if err != nil {
+		return nil, nil, checkpoint.Wrap(err, fmt.Errorf("%w: directory at cluster %d", ErrReadFilesystemDir, dirCluster))
+	}
+
+	data := make([]byte, 0, len(sectors)*int(f.info.BytesPerSector))
+	for _, sectorNum := range sectors {
+		err := f.readSector(sectorNum, func(buffer []byte) {
+			data = append(data, buffer...)
+		})
+		if err != nil {
+			return nil, nil, checkpoint.Wrap(err, fmt.Errorf("%w: directory at cluster %d", ErrReadFilesystemDir, dirCluster))
+		}
+	}
+
+	return data, sectors, nil
+}
+
+// readDirRefs reads the directory starting at the given cluster including the positions of all entries.
+// A dirCluster of 0 references the root directory.
+// The sectors are parsed while reading them and reading stops at the end marker of the directory.
+func (f *Fs) readDirRefs(dirCluster fatEntry) ([]entryRef, error) {
+	start := f.traceStart()
+	sectors, err := f.dirSectors(dirCluster)
+	if err != nil {
+		f.traceDirParse(dirCluster, nil, start, err)
+		return nil, checkpoint.Wrap(err, fmt.Errorf("%w: directory at cluster %d", ErrReadFilesystemDir, dirCluster))
+	}
+
+	parser := newDirParser(f.names)
+	for i, sectorNum := range sectors {
+		more := true
+		err := f.readSector(sectorNum, func(buffer []byte) {
+			more = parser.parse(buffer)
+		})
+		if err != nil {
+			f.traceDirParse(dirCluster, sectors[:i+1], start, err)
+			return nil, checkpoint.Wrap(err, fmt.Errorf("%w: directory at cluster %d", ErrReadFilesystemDir, dirCluster))
+		}
+
+		if !more {
+			sectors = sectors[:i+1]
+			break
+		}
+	}
+	f.traceDirParse(dirCluster, sectors, start, nil)
+
+	refs := parser.directory
+	for i := range refs {
+		refs[i].dirCluster = dirCluster
+	}
+
+	return refs, nil
+}
+
+// writeDirSlots writes the raw slots into the directory consisting of the given sectors starting at the slot index.
+func (f *Fs) writeDirSlots(sectors []uint32, index int, slots []byte) error {
+	slotsPerSector := int(f.info.BytesPerSector) / 32
+
+	for len(slots) > 0 {
+		sectorIndex := index / slotsPerSector
+		if sectorIndex >= len(sectors) {
+			return checkpoint.From(fmt.Errorf("%w: slot %d is outside of the directory", ErrWriteFilesystem, index))
+		}
+
+		inSector := (index % slotsPerSector) * 32
+		count := len(slots)
+		if count > int(f.info.BytesPerSector)-inSector {
+			count = int(f.info.BytesPerSector) - inSector
+		}
+
+		part := slots[:count]
+		err := f.modifySector(sectors[sectorIndex], func(buffer []byte) {
+			copy(buffer[inSector:], part)
+		})
+		if err != nil {
+			return err
+		}
+
+		slots = slots[count:]
+		index += count / 32
+	}
+
+	return nil
+}
+
+// writeEntrySet writes the slots of one entry starting at the slot index.
+// The slots consist of the long filename slots followed by the short entry.
+// The long filename slots are written first and the short entry only after they have been written completely,
+// even if they are in the same sector. So if writing is interrupted (e.g. by a power loss tearing a sector),
+// the directory either contains the complete entry or only long filename slots without their short entry.
+// Such orphaned slots are harmless: they are ignored when reading the directory and can be reused.
+func (f *Fs) writeEntrySet(sectors []uint32, index int, slots []byte) error {
+	lfnSlots := slots[:len(slots)-entrySize]
+	if len(lfnSlots) > 0 {
+		err := f.writeDirSlots(sectors, index, lfnSlots)
+		if err != nil {
+			return err
+		}
+	}
+
+	return f.writeDirSlots(sectors, index+len(lfnSlots)/entrySize, slots[len(lfnSlots):])
+}
+
+// writeDirEntry overwrites the short entry at the given slot index of the directory.
+func (f *Fs) writeDirEntry(dirCluster fatEntry, index int, entry EntryHeader) error {
+	sectors, err := f.dirSectors(dirCluster)
+	if err != nil {
+		return err
+	}
+
+	return f.writeDirSlots(sectors, index, encodeEntry(entry))
+}
+
+// removeDirEntry marks the entry and all of its long filename slots as deleted.
+// The short entry is deleted first, so that an interruption cannot leave the entry visible without its long name.
+func (f *Fs) removeDirEntry(ref entryRef) error {
+	ref, err := f.refreshRef(ref)
+	if err != nil {
+		return err
+	}
+
+	sectors, err := f.dirSectors(ref.dirCluster)
+	if err != nil {
+		return err
+	}
+
+	slotsPerSector := int(f.info.BytesPerSector) / 32
+	for i := ref.index; i >= ref.index-ref.lfnCount; i-- {
+		inSector := (i % slotsPerSector) * 32
+		err = f.modifySector(sectors[i/slotsPerSector], func(buffer []byte) {
+			buffer[inSector] = 0xE5
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// addDirEntry adds a new entry with the given name to the directory starting at dirCluster.
+// The name of the header is used as short name if it is set and not already in use.
+// Otherwise a short name is generated. Long filename entries are added if the name cannot be represented
+// by the short name.
+// The directory is extended by a new cluster if there is not enough space left.
+// See writeEntrySet for what happens if writing the entry is interrupted.
+func (f *Fs) addDirEntry(dirCluster fatEntry, name string, header EntryHeader) (entryRef, error) {
+	return f.addDirEntryExcept(dirCluster, name, header, -1)
+}
+
+// addDirEntryExcept works like addDirEntry, but the name of the entry at the slot index except may collide with the
+// new name. This is needed to change only the case of a name. An index of -1 checks all entries.
+func (f *Fs) addDirEntryExcept(dirCluster fatEntry, name string, header EntryHeader, except int) (entryRef, error) {
+	err := validateName(name)
+	if err != nil {
+		return entryRef{}, checkpoint.From(err)
+	}
+
+	data, sectors, err := f.readDirSlots(dirCluster)
+	if err != nil {
+		return entryRef{}, err
+	}
+
+	refs, err := f.parseDirRefs(data)
+	if err != nil {
+		return entryRef{}, err
+	}
+
+	for _, ref := range refs {
+		if ref.index == except {
+			continue
+		}
+		if f.match(ref.FileInfo().Name(), name) || f.match(shortNameString(ref.Name), name) {
+			return entryRef{}, checkpoint.Wrap(syscall.EEXIST, fmt.Errorf("%w: %v", ErrWriteFilesystem, name))
+		}
+	}
+
+	exists := func(shortName [11]byte) bool {
+		for _, ref := range refs {
+			if ref.Name == shortName {
+				return true
+			}
+		}
+		return false
+	}
+
+	if header.Name == ([11]byte{}) || exists(header.Name) {
+		header.Name, err = generateShortName(name, exists)
+		if err != nil {
+			return entryRef{}, checkpoint.From(err)
+		}
+	}
+
+	slots, lfnCount := entrySlots(name, header)
+	needed := lfnCount + 1
+
+	// Search enough consecutive free slots.
+	// All slots after the first slot starting with 0x00 are free.
+	slotCount := len(data) / 32
+	start, run, end := 0, 0, -1
+	for i := 0; i < slotCount && run < needed; i++ {
+		first := data[i*32]
+		if end < 0 && first == 0x00 {
+			end = i
+		}
+
+		if end >= 0 || first == 0xE5 {
+			if run == 0 {
+				start = i
+			}
+			run++
+			continue
+		}
+		run = 0
+	}
+
+	if run < needed {
+		if run == 0 {
+			start = slotCount
+		}
+
+		if dirCluster == 0 && f.info.FSType != FAT32 {
+			return entryRef{}, checkpoint.From(fmt.Errorf("%w: the root directory can only hold %d entries", ErrDirectoryFull, f.info.RootEntryCount))
+		}
+
+		chain, err := f.clusterChain(f.dirClusterOrRoot(dirCluster))
+		if err != nil {
+			return entryRef{}, err
+		}
+
+		last := chain[len(chain)-1]
+		for slotCount-start < needed {
+			last, err = f.allocateCluster(last)
+			if err != nil {
+				return entryRef{}, err
+			}
+
+			err = f.zeroCluster(last)
+			if err != nil {
+				return entryRef{}, err
+			}
+
+			firstSector := f.firstSectorOfCluster(last)
+			for i := uint32(0); i < uint32(f.info.SectorsPerCluster); i++ {
+				sectors = append(sectors, firstSector+i)
+			}
+			slotCount += int(f.clusterSize() / 32)
+		}
+	}
+
+	// If the slots are placed behind the end marker, the slot after them must be an end marker again.
+	if end >= 0 && start+needed > end && start+needed < len(data)/32 && data[(start+needed)*32] != 0x00 {
+		err = f.writeDirSlots(sectors, start+needed, make([]byte, 32))
+		if err != nil {
+			return entryRef{}, err
+		}
+	}
+
+	err = f.writeEntrySet(sectors, start, slots)
+	if err != nil {
+		return entryRef{}, err
+	}
+
+	ref := entryRef{
+		ExtendedEntryHeader: ExtendedEntryHeader{
+			EntryHeader: header,
+		},
+		dirCluster: dirCluster,
+		index:      start + lfnCount,
+		lfnCount:   lfnCount,
+	}
+	if lfnCount > 0 {
+		ref.ExtendedName = name
+	}
+
+	if f.sortEntries {
+		ref.index, err = f.sortDir(dirCluster, header.Name)
+		if err != nil {
+			return entryRef{}, err
+		}
+	}
+
+	return ref, nil
+}
+
+// entrySlots encodes the long filename slots for the name, if the short name of the header cannot represent it,
+// followed by the short entry. It returns the slots and the count of long filename slots.
+func entrySlots(name string, header EntryHeader) ([]byte, int) {
+	var slots []byte
+	var lfnCount int
+	if shortNameString(header.Name) != name {
+		for _, lfn := range longFilenameEntries(name, shortNameChecksum(header.Name)) {
+			slots = append(slots, encodeEntry(lfn)...)
+			lfnCount++
+		}
+	}
+	return append(slots, encodeEntry(header)...), lfnCount
+}
+
+// dirClusterOrRoot converts the dirCluster 0 into the real root cluster for FAT32.
+func (f *Fs) dirClusterOrRoot(dirCluster fatEntry) fatEntry {
+	if dirCluster == 0 && f.info.FSType == FAT32 {
+		return f.info.fat32Specific.RootCluster
+	}
+	return dirCluster
+}
+
+// entryDirCluster returns the cluster which is used to reference the directory of the given entry.
+// For the root directory this is always 0.
+func (f *Fs) entryDirCluster(ref entryRef) fatEntry {
+	if ref.isRoot() {
+		return 0
+	}
+	return ref.firstCluster()
+}
+
+// resolveParent resolves the parent directory of the given path and returns it together with the base name.
+func (f *Fs) resolveParent(path string) (entryRef, string, error) {
+	if path == "" {
+		return entryRef{}, "", checkpoint.From(fmt.Errorf("%w: the root directory has no parent", ErrInvalidPath))
+	}
+
+	dir, name := "", path
+	if i := strings.LastIndexByte(path, '/'); i >= 0 {
+		dir, name = path[:i], path[i+1:]
+	}
+
+	parent, err := f.resolve(dir)
+	if err != nil {
+		return entryRef{}, "", err
+	}
+
+	if !parent.isDir() {
+		return entryRef{}, "", checkpoint.Wrap(syscall.ENOTDIR, fmt.Errorf("%w: %v", ErrInvalidPath, dir))
+	}
+
+	return parent, name, nil
+}
+
+// createEntry adds the entry for the given path into its parent directory.
+func (f *Fs) createEntry(path string, header EntryHeader) (entryRef, error) {
+	parent, name, err := f.resolveParent(path)
+	if err != nil {
+		return entryRef{}, err
+	}
+
+	return f.addDirEntry(f.entryDirCluster(parent), name, header)
+}
+
+// mkdir creates a new directory at the given path. The header is used as template for the new entry.
+func (f *Fs) mkdir(path string, header EntryHeader) (entryRef, error) {
+	parent, name, err := f.resolveParent(path)
+	if err != nil {
+		return entryRef{}, err
+	}
+
+	return f.mkdirAt(f.entryDirCluster(parent), name, header)
+}
+
+// mkdirAt creates a new directory with the given name inside of the directory starting at dirCluster.
+// The header is used as template for the new entry.
+func (f *Fs) mkdirAt(dirCluster fatEntry, name string, header EntryHeader) (entryRef, error) {
+	cluster, err := f.allocateCluster(0)
+	if err != nil {
+		return entryRef{}, err
+	}
+
+	err = f.zeroCluster(cluster)
+	if err != nil {
+		_ = f.freeChain(cluster)
+		return entryRef{}, err
+	}
+
+	header.Attribute |= AttrDirectory
+	header.FileSize = 0
+	header.setFirstCluster(cluster)
+
+	dot := header
+	dot.Name = [11]byte{'.', ' ', ' ', ' ', ' ', ' ', ' ', ' ', ' ', ' ', ' '}
+	dotDot := header
+	dotDot.Name = [11]byte{'.', '.', ' ', ' ', ' ', ' ', ' ', ' ', ' ', ' ', ' '}
+	dotDot.setFirstCluster(dirCluster)
+
+	sectors, err := f.dirSectors(cluster)
+	if err == nil {
+		err = f.writeDirSlots(sectors, 0, append(encodeEntry(dot), encodeEntry(dotDot)...))
+	}
+	if err != nil {
+		_ = f.freeChain(cluster)
+		return entryRef{}, err
+	}
+
+	ref, err := f.addDirEntry(dirCluster, name, header)
+	if err != nil {
+		_ = f.freeChain(cluster)
+		return entryRef{}, err
+	}
+
+	return ref, nil
+}
+
+// removeEntry removes the entry and frees its clusters. Directories have to be empty.
+func (f *Fs) removeEntry(ref entryRef) error {
+	if ref.isRoot() {
+		return checkpoint.From(fmt.Errorf("%w: the root directory cannot be removed", ErrInvalidPath))
+	}
+
+	if ref.isDir() {
+		children, err := f.readDirRefs(ref.firstCluster())
+		if err != nil {
+			return err
+		}
+
+		if len(children) > 0 {
+			return checkpoint.From(syscall.ENOTEMPTY)
+		}
+	}
+
+	err := f.removeDirEntry(ref)
+	if err != nil {
+		return err
+	}
+
+	return f.freeChain(ref.firstCluster())
+}
+
+// removeAll removes the entry and, if it is a directory, everything in it.
+func (f *Fs) removeAll(ref entryRef) error {
+	if ref.isDir() {
+		children, err := f.readDirRefs(ref.firstCluster())
+		if err != nil {
+			return err
+		}
+
+		for _, child := range children {
+			err = f.removeAll(child)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return f.removeEntry(ref)
+}
+
+// rename moves the entry at oldPath to newPath.
+// An existing file at newPath is replaced. An existing directory is only replaced if it is empty.
+func (f *Fs) rename(oldPath, newPath string) error {
+	oldRef, err := f.resolve(oldPath)
+	if err != nil {
+		return err
+	}
+
+	if oldRef.isRoot() {
+		return checkpoint.From(fmt.Errorf("%w: the root directory cannot be renamed", ErrInvalidPath))
+	}
+
+	if oldRef.isDir() && len(newPath) > len(oldPath) && f.match(newPath[:len(oldPath)+1], oldPath+"/") {
+		return checkpoint.From(fmt.Errorf("%w: cannot move '%v' into itself", ErrInvalidPath, oldPath))
+	}
+
+	parent, name, err := f.resolveParent(newPath)
+	if err != nil {
+		return err
+	}
+
+	existing, err := f.resolve(newPath)
+	if err == nil {
+		if existing.dirCluster == oldRef.dirCluster && existing.index == oldRef.index {
+			// Just a change of the case.
+			return f.renameCase(oldRef, name)
+		}
+
+		if existing.isDir() != oldRef.isDir() {
+			if existing.isDir() {
+				return checkpoint.From(syscall.EISDIR)
+			}
+			return checkpoint.From(syscall.ENOTDIR)
+		}
+
+		// Directories are only replaced if they are empty which is checked by removeEntry.
+		err = f.removeEntry(existing)
+		if err != nil {
+			return err
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	// Add the new entry before removing the old one.
+	// That way an interruption cannot lose the data.
+	header := oldRef.EntryHeader
+	header.Name = [11]byte{}
+	newRef, err := f.addDirEntry(f.entryDirCluster(parent), name, header)
+	if err != nil {
+		return err
+	}
+
+	err = f.removeDirEntry(oldRef)
+	if err != nil {
+		return err
+	}
+
+	// A moved directory has to point to its new parent.
+	if oldRef.isDir() && newRef.dirCluster != oldRef.dirCluster {
+		sectors, err := f.dirSectors(oldRef.firstCluster())
+		if err != nil {
+			return err
+		}
+
+		sector, err := f.fetch(sectors[0])
+		if err != nil {
+			return err
+		}
+
+		dotDot := decodeEntryHeader(sector.buffer[entrySize:])
+		dotDot.setFirstCluster(newRef.dirCluster)
+		err = f.writeDirSlots(sectors, 1, encodeEntry(dotDot))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// renameCase changes only the case of the name of the entry. The short name is kept, so if the new long filename
+// slots fit into the old ones, the entry is rewritten in place and the slots which are not needed anymore are
+// deleted afterwards. Otherwise the new entry is added before the old one is removed, like in rename.
+// In both cases an interruption cannot lose the entry.
+func (f *Fs) renameCase(ref entryRef, name string) error {
+	slots, lfnCount := entrySlots(name, ref.EntryHeader)
+	if lfnCount > ref.lfnCount {
+		header := ref.EntryHeader
+		header.Name = [11]byte{}
+		_, err := f.addDirEntryExcept(ref.dirCluster, name, header, ref.index)
+		if err != nil {
+			return err
+		}
+
+		return f.removeDirEntry(ref)
+	}
+
+	sectors, err := f.dirSectors(ref.dirCluster)
+	if err != nil {
+		return err
+	}
+
+	err = f.writeEntrySet(sectors, ref.index-lfnCount, slots)
+	if err != nil {
+		return err
+	}
+
+	slotsPerSector := int(f.info.BytesPerSector) / 32
+	for i := ref.index - ref.lfnCount; i < ref.index-lfnCount; i++ {
+		inSector := (i % slotsPerSector) * 32
+		err = f.modifySector(sectors[i/slotsPerSector], func(buffer []byte) {
+			buffer[inSector] = 0xE5
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func max64(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
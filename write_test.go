@@ -0,0 +1,609 @@
+package gofat
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/aligator/gofat/fattest"
+	"github.com/spf13/afero"
+)
+
+// testingCopy copies the given test image into a writable in-memory image.
+func testingCopy(t testing.TB, file string) *testImage {
+	image := testingImage(t)
+	reader := testFileReader(file)
+	if _, err := io.Copy(image, reader); err != nil {
+		t.Fatal(err)
+	}
+	return image
+}
+
+// testData returns size bytes of not repeating data.
+func testData(size int) []byte {
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = byte(i * 7 / 3)
+	}
+	return data
+}
+
+func readDirNames(t testing.TB, fs afero.Fs, path string) []string {
+	names, err := afero.ReadDir(fs, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := make([]string, len(names))
+	for i, info := range names {
+		result[i] = info.Name()
+	}
+	sort.Strings(result)
+	return result
+}
+
+func TestFs_write(t *testing.T) {
+	tests := []struct {
+		name  string
+		image func(t testing.TB) *testImage
+	}{
+		{
+			name: "FAT16",
+			image: func(t testing.TB) *testImage {
+				image := testingImage(t)
+				if err := Format(image, FormatOptions{Size: 32 * 1024 * 1024}); err != nil {
+					t.Fatal(err)
+				}
+				return image
+			},
+		},
+		{
+			name: "FAT32",
+			image: func(t testing.TB) *testImage {
+				image := testingImage(t)
+				if err := Format(image, FormatOptions{Size: 128 * 1024 * 1024, FSType: FAT32, SectorsPerCluster: 2}); err != nil {
+					t.Fatal(err)
+				}
+				return image
+			},
+		},
+		{
+			name: "existing FAT16 image",
+			image: func(t testing.TB) *testImage {
+				return testingCopy(t, fat16)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			image := tt.image(t)
+			fs := testingNew(t, image)
+			size := int(fs.clusterSize())*3 + 17
+			data := testData(size)
+
+			if err := fs.MkdirAll("a/long directory name/c", 0777); err != nil {
+				t.Fatalf("MkdirAll() error = %v", err)
+			}
+
+			if err := afero.WriteFile(fs, "a/long directory name/c/A long file name.txt", data, 0666); err != nil {
+				t.Fatalf("WriteFile() error = %v", err)
+			}
+
+			if err := afero.WriteFile(fs, "a/SHORT.TXT", []byte("short"), 0666); err != nil {
+				t.Fatalf("WriteFile() error = %v", err)
+			}
+
+			// Overwrite in the middle of the file across a cluster boundary.
+			file, err := fs.OpenFile("a/long directory name/c/A long file name.txt", os.O_RDWR, 0)
+			if err != nil {
+				t.Fatalf("OpenFile() error = %v", err)
+			}
+			patch := bytes.Repeat([]byte{0xAB}, 100)
+			offset := int(fs.clusterSize()) - 50
+			if _, err := file.WriteAt(patch, int64(offset)); err != nil {
+				t.Fatalf("WriteAt() error = %v", err)
+			}
+			copy(data[offset:], patch)
+			if err := file.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			// Reopen the image to make sure everything got persisted.
+			fs = testingNew(t, image)
+
+			got, err := afero.ReadFile(fs, "a/long directory name/c/A long file name.txt")
+			if err != nil {
+				t.Fatalf("ReadFile() error = %v", err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Errorf("ReadFile() returned other data than written")
+			}
+
+			if got := readDirNames(t, fs, "a"); !equalStrings(got, []string{"SHORT.TXT", "long directory name"}) {
+				t.Errorf("ReadDir() = %v", got)
+			}
+
+			if err := fs.Remove("a"); err == nil {
+				t.Errorf("Remove() of a non empty directory succeeded")
+			}
+
+			if err := fs.Rename("a/SHORT.TXT", "a/long directory name/renamed.txt"); err != nil {
+				t.Fatalf("Rename() error = %v", err)
+			}
+			if got, _ := afero.ReadFile(fs, "a/long directory name/renamed.txt"); string(got) != "short" {
+				t.Errorf("ReadFile() after rename = %q", got)
+			}
+
+			if err := fs.Rename("a/long directory name", "moved"); err != nil {
+				t.Fatalf("Rename() error = %v", err)
+			}
+			if _, err := fs.Stat("moved/c/A long file name.txt"); err != nil {
+				t.Errorf("Stat() after moving the directory error = %v", err)
+			}
+			if got := readDirNames(t, fs, "moved"); !equalStrings(got, []string{"c", "renamed.txt"}) {
+				t.Errorf("ReadDir() after moving the directory = %v", got)
+			}
+
+			if err := fs.RemoveAll("moved"); err != nil {
+				t.Fatalf("RemoveAll() error = %v", err)
+			}
+			if err := fs.Remove("a"); err != nil {
+				t.Fatalf("Remove() error = %v", err)
+			}
+			if _, err := fs.Stat("moved"); !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("Stat() after RemoveAll error = %v, want %v", err, os.ErrNotExist)
+			}
+		})
+	}
+}
+
+func TestFs_writeFreesClusters(t *testing.T) {
+	image := testingImage(t)
+	if err := Format(image, FormatOptions{Size: 128 * 1024 * 1024, FSType: FAT32, SectorsPerCluster: 2}); err != nil {
+		t.Fatal(err)
+	}
+	fs := testingNew(t, image)
+	freeCount := fs.alloc.freeCount
+
+	if err := afero.WriteFile(fs, "file", testData(10000), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if fs.alloc.freeCount != freeCount-10 {
+		t.Errorf("free count = %v, want %v", fs.alloc.freeCount, freeCount-10)
+	}
+
+	file, err := fs.OpenFile("file", os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := file.Truncate(1024); err != nil {
+		t.Fatalf("Truncate() error = %v", err)
+	}
+	if err := file.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if fs.alloc.freeCount != freeCount-1 {
+		t.Errorf("free count after Truncate = %v, want %v", fs.alloc.freeCount, freeCount-1)
+	}
+
+	if err := fs.Remove("file"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The FSInfo has to be persisted.
+	fs = testingNew(t, image)
+	if fs.alloc.freeCount != freeCount {
+		t.Errorf("free count after Remove = %v, want %v", fs.alloc.freeCount, freeCount)
+	}
+}
+
+func TestFs_writeReadOnly(t *testing.T) {
+	fs := testingNew(t, testingReadOnly(t, fat16))
+
+	if _, err := fs.Create("file"); !errors.Is(err, ErrReadOnlyFilesystem) {
+		t.Errorf("Create() error = %v, want %v", err, ErrReadOnlyFilesystem)
+	}
+	if err := fs.Mkdir("dir", 0777); !errors.Is(err, ErrReadOnlyFilesystem) {
+		t.Errorf("Mkdir() error = %v, want %v", err, ErrReadOnlyFilesystem)
+	}
+}
+
+// testingReadOnly loads the given test image into a reader which does not implement io.Writer.
+func testingReadOnly(t testing.TB, file string) io.ReadSeeker {
+	data, err := io.ReadAll(testFileReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bytes.NewReader(data)
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestFs_renamePreservesMetadata(t *testing.T) {
+	fs := testingFormat(t, FormatOptions{Size: 32 * 1024 * 1024})
+
+	if err := afero.WriteFile(fs, "file", testData(100), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Mkdir("dir", 0777); err != nil {
+		t.Fatal(err)
+	}
+
+	// Use values which cannot be produced by the current time.
+	ref, err := fs.resolve("file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := ref.EntryHeader
+	entry.CreateTimeTenth = 199
+	entry.CreateTime = 0xBF7D
+	entry.CreateDate = 0x2A21
+	entry.LastAccessDate = 0x2A22
+	entry.WriteTime = 0x0001
+	entry.WriteDate = 0x2A23
+	if err := fs.updateEntry(OpChange, "", ref.dirCluster, ref.index, entry); err != nil {
+		t.Fatal(err)
+	}
+
+	before, err := fs.Stat("file")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := fs.Rename("file", "dir/renamed with a long name"); err != nil {
+		t.Fatal(err)
+	}
+
+	after, err := fs.Stat("dir/renamed with a long name")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := entryMetadata(after), entryMetadata(before); got != want {
+		t.Errorf("Rename() changed the metadata to %v, want %v", got, want)
+	}
+	if got, want := after.(FileInfo).CreateTime(), before.(FileInfo).CreateTime(); !got.Equal(want) {
+		t.Errorf("Rename() changed the creation time to %v, want %v", got, want)
+	}
+}
+
+func TestFs_RenameCase(t *testing.T) {
+	tests := []struct {
+		name        string
+		oldName     string
+		newName     string
+		fillRoot    bool
+		wantInPlace bool
+		wantErr     error
+	}{
+		{name: "same slot count", oldName: "Readme.txt", newName: "readme.txt", wantInPlace: true},
+		{name: "less slots", oldName: "readme.txt", newName: "README.TXT", wantInPlace: true},
+		{name: "more slots", oldName: "README.TXT", newName: "Readme.txt"},
+		{name: "more slots in a full root", oldName: "README.TXT", newName: "Readme.txt", fillRoot: true, wantErr: ErrDirectoryFull},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := testingFormat(t, FormatOptions{Size: 16 * 1024 * 1024, FSType: FAT16})
+			data := testData(5000)
+			if err := afero.WriteFile(fs, tt.oldName, data, 0666); err != nil {
+				t.Fatal(err)
+			}
+
+			for i := 0; tt.fillRoot; i++ {
+				_, err := fs.Create(fmt.Sprintf("F%d", i))
+				if errors.Is(err, ErrDirectoryFull) {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			before, err := fs.resolve(tt.oldName)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = fs.Rename(tt.oldName, tt.newName)
+			if !errors.Is(err, tt.wantErr) || (err != nil) != (tt.wantErr != nil) {
+				t.Fatalf("Rename() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			// On errors the old entry has to be kept.
+			wantName := tt.newName
+			if tt.wantErr != nil {
+				wantName = tt.oldName
+			}
+
+			after, err := fs.resolve(wantName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := after.FileInfo().Name(); got != wantName {
+				t.Errorf("the entry is named %v, want %v", got, wantName)
+			}
+			if tt.wantInPlace && after.index != before.index {
+				t.Errorf("the short entry moved from slot %d to %d, want it to be rewritten in place", before.index, after.index)
+			}
+
+			got, err := afero.ReadFile(fs, wantName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Errorf("the file contains %v bytes, want %v bytes", len(got), len(data))
+			}
+
+			report, err := fs.Check()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !report.OK() {
+				t.Errorf("Fs.Check() = %+v, want no findings", report.Findings)
+			}
+		})
+	}
+}
+
+func TestFs_SetNTReserved(t *testing.T) {
+	fs := testingFormat(t, FormatOptions{Size: 32 * 1024 * 1024})
+
+	if err := afero.WriteFile(fs, "file", testData(100), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Mkdir("dir", 0777); err != nil {
+		t.Fatal(err)
+	}
+
+	const flags = 0xA5
+	if err := fs.SetNTReserved("file", flags); err != nil {
+		t.Fatal(err)
+	}
+
+	// Changing the file in any other way must keep the byte.
+	if err := afero.WriteFile(fs, "file", testData(5000), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Chmod("file", 0444); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Chtimes("file", time.Now(), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Rename("file", "dir/renamed"); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := fs.Stat("dir/renamed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := info.(FileInfo).NTReserved(); got != flags {
+		t.Errorf("FileInfo.NTReserved() = %#x, want %#x", got, flags)
+	}
+
+	if err := fs.SetNTReserved(".", flags); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("Fs.SetNTReserved() of the root error = %v, want %v", err, ErrNotSupported)
+	}
+	if err := fs.SetNTReserved("missing", flags); err == nil {
+		t.Errorf("Fs.SetNTReserved() of a missing file expected an error")
+	}
+}
+
+func TestFs_SetAttributes(t *testing.T) {
+	fs := testingFormat(t, FormatOptions{Size: 32 * 1024 * 1024})
+
+	if err := afero.WriteFile(fs, "file", testData(100), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Mkdir("dir", 0777); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		path       string
+		attributes byte
+		want       byte
+	}{
+		{
+			name:       "file",
+			path:       "file",
+			attributes: AttrHidden | AttrSystem | AttrReadOnly,
+			want:       AttrHidden | AttrSystem | AttrReadOnly,
+		},
+		{
+			name:       "keeps the directory attribute",
+			path:       "dir",
+			attributes: AttrHidden,
+			want:       AttrHidden | AttrDirectory,
+		},
+		{
+			name:       "ignores type attributes",
+			path:       "file",
+			attributes: AttrArchive | AttrDirectory | AttrVolumeId,
+			want:       AttrArchive,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := fs.SetAttributes(tt.path, tt.attributes); err != nil {
+				t.Fatalf("Fs.SetAttributes() error = %v", err)
+			}
+
+			info, err := fs.Stat(tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := info.(FileInfo).Entry().Attribute; got != tt.want {
+				t.Errorf("Fs.SetAttributes() attribute = %#x, want %#x", got, tt.want)
+			}
+		})
+	}
+}
+
+// errTorn is returned by tornImage for the interrupted write.
+var errTorn = errors.New("torn write")
+
+// tornImage simulates an interruption after the given count of writes.
+// The interrupted write only stores the second half of its data, like a torn sector could do.
+// All following writes fail.
+type tornImage struct {
+	*testImage
+	writes int
+}
+
+func (i *tornImage) Write(p []byte) (int, error) {
+	if i.writes < 0 {
+		return 0, errTorn
+	}
+
+	if i.writes == 0 {
+		i.writes--
+		i.offset += int64(len(p) / 2)
+		_, _ = i.testImage.Write(p[len(p)/2:])
+		return 0, errTorn
+	}
+
+	i.writes--
+	return i.testImage.Write(p)
+}
+
+func TestFs_tornEntryWrites(t *testing.T) {
+	const name = "a long file name.txt"
+
+	base := testingImage(t)
+	if err := Format(base, FormatOptions{Size: 32 * 1024 * 1024}); err != nil {
+		t.Fatal(err)
+	}
+	fs := testingNew(t, base)
+	if err := fs.Mkdir("dir", 0777); err != nil {
+		t.Fatal(err)
+	}
+	// Fill the slots 2 to 5 of the directory and mark the slots 6 to 8 as deleted, so that the 3 slots
+	// of the new entry cross the middle of the first sector and are not behind the end marker.
+	for _, file := range []string{"A", "B", "C", "D", "E", "F", "G"} {
+		if err := afero.WriteFile(fs, "dir/"+file, nil, 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, file := range []string{"E", "F", "G"} {
+		if err := fs.Remove("dir/" + file); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// checkDir makes sure that the directory only contains complete entries.
+	checkDir := func(t *testing.T, data []byte) {
+		fs := testingNew(t, &testImage{data: data})
+		for _, got := range readDirNames(t, fs, "dir") {
+			switch got {
+			case "A", "B", "C", "D", name:
+			default:
+				t.Errorf("the directory contains the incomplete entry %q", got)
+			}
+		}
+	}
+
+	for writes := 0; writes < 4; writes++ {
+		t.Run(fmt.Sprintf("create interrupted after %v writes", writes), func(t *testing.T) {
+			image := &tornImage{testImage: &testImage{data: append([]byte(nil), base.data...)}, writes: writes}
+			_ = afero.WriteFile(testingNew(t, image), "dir/"+name, nil, 0666)
+			checkDir(t, image.data)
+		})
+	}
+
+	if err := afero.WriteFile(fs, "dir/"+name, nil, 0666); err != nil {
+		t.Fatal(err)
+	}
+	for writes := 0; writes < 4; writes++ {
+		t.Run(fmt.Sprintf("remove interrupted after %v writes", writes), func(t *testing.T) {
+			image := &tornImage{testImage: &testImage{data: append([]byte(nil), base.data...)}, writes: writes}
+			_ = testingNew(t, image).Remove("dir/" + name)
+			checkDir(t, image.data)
+		})
+	}
+}
+
+// TestFs_mirror runs random mutations through a fattest.MirrorFs, so that every difference to the reference is found.
+func TestFs_mirror(t *testing.T) {
+	tests := []struct {
+		name  string
+		image func(t *testing.T) *Fs
+		seed  int64
+	}{
+		{name: "fat16 test image", image: func(t *testing.T) *Fs { return testingNew(t, testingCopy(t, fat16)) }, seed: 1},
+		{name: "empty FAT16", image: func(t *testing.T) *Fs { return testingFormat(t, FormatOptions{Size: 16 * 1024 * 1024}) }, seed: 2},
+		{name: "empty FAT32", image: func(t *testing.T) *Fs { return testingFormat(t, FormatOptions{Size: 128 * 1024 * 1024, FSType: FAT32}) }, seed: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mirror, err := fattest.NewMirrorFs(tt.image(t))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			random := rand.New(rand.NewSource(tt.seed))
+			dirs := []string{"a", "a/b", "Long directory", "go"}
+			files := []string{"file.txt", "a/file.txt", "a/b/A long file name.data", "Long directory/x", "go/main.go", "README.md"}
+			pick := func(names []string) string { return names[random.Intn(len(names))] }
+
+			for i := 0; i < 500; i++ {
+				switch random.Intn(9) {
+				case 0:
+					_ = mirror.Mkdir(pick(dirs), 0777)
+				case 1:
+					_ = mirror.MkdirAll(pick(dirs), 0777)
+				case 2:
+					_ = afero.WriteFile(mirror, pick(files), testData(random.Intn(10000)), 0666)
+				case 3:
+					if file, err := mirror.OpenFile(pick(files), os.O_RDWR, 0); err == nil {
+						_, _ = file.WriteAt(testData(random.Intn(5000)), random.Int63n(8000))
+						_ = file.Close()
+					}
+				case 4:
+					if file, err := mirror.OpenFile(pick(files), os.O_WRONLY|os.O_APPEND, 0); err == nil {
+						_, _ = file.Write(testData(random.Intn(3000)))
+						_ = file.Close()
+					}
+				case 5:
+					if file, err := mirror.OpenFile(pick(files), os.O_RDWR, 0); err == nil {
+						_ = file.Truncate(random.Int63n(6000))
+						_, _ = io.ReadAll(file)
+						_ = file.Close()
+					}
+				case 6:
+					_ = mirror.Remove(pick(append(files, dirs...)))
+				case 7:
+					_ = mirror.Rename(pick(files), pick(files))
+				case 8:
+					if random.Intn(4) == 0 {
+						_ = mirror.RemoveAll(pick(dirs))
+					} else {
+						_ = mirror.Rename(pick(dirs), pick(dirs))
+					}
+				}
+			}
+
+			if err := mirror.Verify(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}